@@ -0,0 +1,272 @@
+// Package client is the Go client for the tandas daemon: typed calls for
+// reading tandas, recording runs and following events over the daemon's
+// unix socket, its localhost TCP listener or a team server, so tools need
+// not speak JSON-RPC themselves.
+//
+//	c, err := client.Find(".")
+//	if err != nil {
+//		return err
+//	}
+//	tandas, err := c.Query(ctx, client.Filter{Status: "open"})
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+// The daemon's own types, named here so importers outside the module can
+// use them
+type (
+	Tanda     = db.Tanda
+	Filter    = db.Filter
+	RunResult = db.RunResult
+	// Event is a daemon event numbered in its feed
+	Event     = rpc.TailEvent
+	TLSConfig = config.TLSConfig
+	// Error is a failure the daemon reported, with its JSON-RPC code
+	Error = rpc.RPCError
+)
+
+// ErrNotRunning is returned, possibly wrapped, when no daemon answers
+var ErrNotRunning = rpc.ErrNotRunning
+
+// ErrNotFound is returned, wrapped, by Get for an unknown tanda
+var ErrNotFound = errors.New("not found")
+
+// Defaults for the zero fields of Options
+const (
+	DefaultRetries = 2
+	DefaultBackoff = 200 * time.Millisecond
+)
+
+// maxBackoff caps the wait between attempts, including a rate limiter's
+// retry_after
+const maxBackoff = 5 * time.Second
+
+// subscribeWait is how long each poll of the event feed waits for new
+// events, in seconds
+const subscribeWait = 20
+
+// Options tune how a Client retries calls that did not reach the daemon or
+// that it turned away as busy or rate limited. Other failures, and calls
+// the daemon acted on, are never retried.
+type Options struct {
+	// Retries is the attempts after the first, DefaultRetries when zero;
+	// negative disables retries
+	Retries int
+	// Backoff is the wait before the first retry, doubling after each,
+	// DefaultBackoff when zero
+	Backoff time.Duration
+}
+
+func (o Options) retries() int {
+	switch {
+	case o.Retries < 0:
+		return 0
+	case o.Retries == 0:
+		return DefaultRetries
+	}
+	return o.Retries
+}
+
+func (o Options) backoff() time.Duration {
+	if o.Backoff <= 0 {
+		return DefaultBackoff
+	}
+	return o.Backoff
+}
+
+// Client calls one daemon. It is safe for concurrent use; each call uses
+// its own connection.
+type Client struct {
+	// dir is the .tandas directory of a local daemon, empty for a team
+	// server
+	dir  string
+	team *rpc.TeamClient
+	opts Options
+}
+
+// New returns a client for the daemon serving the .tandas directory dir.
+// It connects over the daemon's socket, or over the localhost TCP listener
+// recorded in its lock file when the socket can't be reached.
+func New(dir string, opts Options) *Client {
+	return &Client{dir: dir, opts: opts}
+}
+
+// Find returns a client for the daemon of the project containing start,
+// looking for a .tandas directory with a daemon lock file in start and its
+// parents. It returns ErrNotRunning when there is none.
+func Find(start string) (*Client, error) {
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		candidate := filepath.Join(dir, ".tandas")
+		if _, err := rpc.ReadLockFile(candidate); err == nil {
+			return New(candidate, Options{}), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, fmt.Errorf("no daemon found from %s: %w", start, ErrNotRunning)
+		}
+		dir = parent
+	}
+}
+
+// Dial returns a client for the team server at addr, which may be
+// host:port or tls://host:port, authenticating with token when it is set
+func Dial(addr, token string, tlsCfg TLSConfig, opts Options) (*Client, error) {
+	team, err := rpc.NewTeamClient(addr, token, tlsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{team: team, opts: opts}, nil
+}
+
+// Call sends method with params and decodes the result into out, which may
+// be nil. It is the escape hatch for methods without a typed wrapper.
+func (c *Client) Call(ctx context.Context, method string, params, out interface{}) error {
+	wait := c.opts.backoff()
+	for attempt := 0; ; attempt++ {
+		err := c.call(method, params, out)
+		retry, after := retryable(err)
+		if !retry || attempt >= c.opts.retries() {
+			return err
+		}
+		if after == 0 {
+			after, wait = wait, wait*2
+		}
+		timer := time.NewTimer(min(after, maxBackoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) call(method string, params, out interface{}) error {
+	if c.team != nil {
+		return c.team.Call(method, params, out)
+	}
+	return rpc.Call(c.dir, method, params, out)
+}
+
+// retryable reports whether err means the daemon did not act on the call,
+// and how long it asked to wait before the next attempt
+func retryable(err error) (bool, time.Duration) {
+	if err == nil {
+		return false, 0
+	}
+	if errors.Is(err, ErrNotRunning) {
+		return true, 0
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true, 0
+	}
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) {
+		return false, 0
+	}
+	switch rpcErr.Code {
+	case rpc.CodeBusy:
+		return true, 0
+	case rpc.CodeRateLimited:
+		var data struct {
+			RetryAfter float64 `json:"retry_after"`
+		}
+		if raw, err := json.Marshal(rpcErr.Data); err == nil {
+			json.Unmarshal(raw, &data)
+		}
+		return true, time.Duration(data.RetryAfter * float64(time.Second))
+	}
+	return false, 0
+}
+
+// Ping checks that the daemon answers
+func (c *Client) Ping(ctx context.Context) error {
+	return c.Call(ctx, "ping", nil, nil)
+}
+
+// Query returns the tandas matching filter
+func (c *Client) Query(ctx context.Context, filter Filter) ([]*Tanda, error) {
+	var tandas []*Tanda
+	if err := c.Call(ctx, "query", filter, &tandas); err != nil {
+		return nil, err
+	}
+	return tandas, nil
+}
+
+// Get returns the tanda with id, or an error wrapping ErrNotFound
+func (c *Client) Get(ctx context.Context, id string) (*Tanda, error) {
+	var t Tanda
+	err := c.Call(ctx, "get", map[string]string{"id": id}, &t)
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) && rpcErr.Code == rpc.CodeNotFound {
+		return nil, fmt.Errorf("tanda %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// RecordRun appends run to the tanda's history and returns the updated
+// tanda. An empty run timestamp is set to now.
+func (c *Client) RecordRun(ctx context.Context, tandaID string, run RunResult) (*Tanda, error) {
+	if run.Timestamp == "" {
+		run.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+	var t Tanda
+	if err := c.Call(ctx, "record_run", rpc.RecordRunParams{TandaID: tandaID, Run: run}, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Subscribe calls handler with each daemon event published after it is
+// called, in order, until ctx is done or handler returns an error, which
+// Subscribe returns. Events the daemon dropped while the subscriber fell
+// more than its feed behind are skipped. A daemon that stops ends the
+// subscription with an error wrapping ErrNotRunning once retries run out.
+func (c *Client) Subscribe(ctx context.Context, handler func(Event) error) error {
+	var result rpc.TailResult
+	if err := c.Call(ctx, "tail", rpc.TailParams{}, &result); err != nil {
+		return err
+	}
+	for {
+		since := result.Seq
+		result = rpc.TailResult{}
+		// A poll can't be interrupted, so it runs apart from the wait on ctx
+		done := make(chan error, 1)
+		go func() {
+			done <- c.Call(ctx, "tail", rpc.TailParams{Since: since, Wait: subscribeWait}, &result)
+		}()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+		}
+		for _, e := range result.Events {
+			if err := handler(e); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/client"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+// fakeDaemon answers requests on a socket in a .tandas directory under a
+// temporary project with handle, and returns the project
+func fakeDaemon(t *testing.T, handle func(req rpc.RPCRequest) (interface{}, *client.Error)) string {
+	t.Helper()
+	project := t.TempDir()
+	dir := filepath.Join(project, ".tandas")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "td.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	lock, _ := json.Marshal(rpc.LockFile{PID: os.Getpid(), Socket: socket, Version: rpc.Version, Protocol: rpc.ProtocolVersion})
+	if err := os.WriteFile(filepath.Join(dir, "daemon.lock"), lock, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var req rpc.RPCRequest
+			if err := json.NewDecoder(conn).Decode(&req); err == nil {
+				result, rpcErr := handle(req)
+				resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "protocol": rpc.ProtocolVersion}
+				if rpcErr != nil {
+					resp["error"] = rpcErr
+				} else {
+					resp["result"] = result
+				}
+				json.NewEncoder(conn).Encode(resp)
+			}
+			conn.Close()
+		}
+	}()
+	return project
+}
+
+func TestClient(t *testing.T) {
+	var queries atomic.Int32
+	var recorded rpc.RecordRunParams
+	project := fakeDaemon(t, func(req rpc.RPCRequest) (interface{}, *client.Error) {
+		switch req.Method {
+		case "query":
+			// The first attempt is turned away
+			if queries.Add(1) == 1 {
+				return nil, &client.Error{Code: rpc.CodeBusy, Message: "too many connections"}
+			}
+			var filter client.Filter
+			json.Unmarshal(req.Params, &filter)
+			return []client.Tanda{{ID: "td-1", Status: filter.Status}}, nil
+		case "get":
+			return nil, &client.Error{Code: rpc.CodeNotFound, Message: "tanda td-x not found"}
+		case "record_run":
+			json.Unmarshal(req.Params, &recorded)
+			return client.Tanda{ID: recorded.TandaID, RunHistory: []client.RunResult{recorded.Run}}, nil
+		case "create":
+			return nil, &client.Error{Code: rpc.CodeReadOnly, Message: "read-only follower"}
+		}
+		return nil, &client.Error{Code: rpc.CodeMethodNotFound, Message: "unknown method"}
+	})
+
+	c, err := client.Find(filepath.Join(project, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	tandas, err := c.Query(ctx, client.Filter{Status: "flaky"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tandas) != 1 || tandas[0].Status != "flaky" || queries.Load() != 2 {
+		t.Errorf("query = %+v after %d attempts, want td-1 flaky after a retry", tandas, queries.Load())
+	}
+
+	if _, err := c.Get(ctx, "td-x"); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("get of an unknown tanda = %v, want ErrNotFound", err)
+	}
+
+	tanda, err := c.RecordRun(ctx, "td-1", client.RunResult{Result: "fail", Commit: "abc123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.TandaID != "td-1" || recorded.Run.Commit != "abc123" || recorded.Run.Timestamp == "" {
+		t.Errorf("recorded %+v, want td-1's run stamped with a time", recorded)
+	}
+	if len(tanda.RunHistory) != 1 {
+		t.Errorf("record_run returned %+v", tanda)
+	}
+
+	// Errors the daemon acted on are not retried
+	var rpcErr *client.Error
+	if err := c.Call(ctx, "create", nil, nil); !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeReadOnly {
+		t.Errorf("create = %v, want a read-only error", err)
+	}
+}
+
+func TestFindWithoutDaemon(t *testing.T) {
+	if _, err := client.Find(t.TempDir()); !errors.Is(err, client.ErrNotRunning) {
+		t.Errorf("Find = %v, want ErrNotRunning", err)
+	}
+}
+
+func TestRetriesRunOut(t *testing.T) {
+	c := client.New(filepath.Join(t.TempDir(), ".tandas"), client.Options{Retries: 2, Backoff: time.Millisecond})
+	if err := c.Ping(context.Background()); !errors.Is(err, client.ErrNotRunning) {
+		t.Errorf("Ping = %v, want ErrNotRunning", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c = client.New(filepath.Join(t.TempDir(), ".tandas"), client.Options{Backoff: time.Hour})
+	if err := c.Ping(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Ping with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	project := fakeDaemon(t, func(req rpc.RPCRequest) (interface{}, *client.Error) {
+		var params rpc.TailParams
+		json.Unmarshal(req.Params, &params)
+		switch params.Since {
+		case 0:
+			// The backlog is skipped
+			return rpc.TailResult{Seq: 5, Events: []rpc.TailEvent{{Seq: 5}}}, nil
+		case 5:
+			e := client.Event{Seq: 6}
+			e.Type = "run_recorded"
+			return rpc.TailResult{Seq: 6, Events: []rpc.TailEvent{e}}, nil
+		}
+		time.Sleep(10 * time.Millisecond)
+		return rpc.TailResult{Seq: params.Since}, nil
+	})
+	c, err := client.Find(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []uint64
+	stop := errors.New("stop")
+	err = c.Subscribe(context.Background(), func(e client.Event) error {
+		seen = append(seen, e.Seq)
+		return stop
+	})
+	if err != stop || len(seen) != 1 || seen[0] != 6 {
+		t.Errorf("Subscribe = %v after %v, want event 6 then the handler's error", err, seen)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = c.Subscribe(ctx, func(client.Event) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Subscribe past its deadline = %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/badge"
+	"github.com/tandas/daemon/internal/db"
+)
+
+func newBadgeCmd() *cobra.Command {
+	var output string
+	var all bool
+	badgeCmd := &cobra.Command{
+		Use:   "badge [pass-rate|flaky|quarantined]",
+		Short: "Render a status badge as SVG",
+		Long: `Render a shields-style SVG badge for READMEs and dashboards: pass-rate, the
+share of tandas whose latest run passed (the default); flaky, how many tandas
+are flaky; or quarantined, how many are flaky or quarantined.
+
+With --all, every badge is written into the --output directory as <kind>.svg.
+Set badges.dir in config.yaml to have the daemon rewrite them after each sync.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			kind := badge.PassRate
+			if len(args) > 0 {
+				kind = args[0]
+			}
+			if err := badge.CheckKind(kind); err != nil && !all {
+				return err
+			}
+			tandas, err := queryTandas(socketDir, db.Filter{})
+			if err != nil {
+				return err
+			}
+
+			if all {
+				if output == "" || output == "-" {
+					return fmt.Errorf("--output directory is required with --all")
+				}
+				paths, err := badge.WriteFiles(output, tandas)
+				if err != nil {
+					return err
+				}
+				for _, p := range paths {
+					fmt.Printf("Wrote %s\n", p)
+				}
+				return nil
+			}
+
+			b, err := badge.Build(tandas, kind)
+			if err != nil {
+				return err
+			}
+			if output == "" || output == "-" {
+				_, err = os.Stdout.Write(b.SVG())
+				return err
+			}
+			return os.WriteFile(output, b.SVG(), 0o644)
+		},
+	}
+	badgeCmd.Flags().StringVarP(&output, "output", "o", "", "Write to this file instead of stdout (a directory with --all)")
+	badgeCmd.Flags().BoolVar(&all, "all", false, "Write every badge into the --output directory")
+	badgeCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return badgeCmd
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/bisect"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/paths"
+)
+
+func newBisectCmd() *cobra.Command {
+	var asJSON bool
+	bisectCmd := &cobra.Command{
+		Use:   "bisect <id>",
+		Short: "Show the commits between a tanda's last pass and its first failure",
+		Long: `Find where a tanda's latest failure streak began from the git SHAs recorded
+with its runs, and list the commits after the last passing commit up to the
+first failing one, to start a git bisect from.
+
+Runs record a commit from --run-commit, TD_COMMIT or the SHA CI is building
+(CI_COMMIT_SHA, GITHUB_SHA); td-daemon run records the checked-out commit.
+
+Goes through the daemon when it is running.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := runBisect(socketDir, args[0])
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(r)
+			}
+
+			fmt.Printf("%s  %s\n", r.TandaID, r.Title)
+			if r.Failures > 0 {
+				state := "ended"
+				if r.Failing {
+					state = "still failing"
+				}
+				fmt.Printf("Latest failure streak: %d run(s), %s\n", r.Failures, state)
+			}
+			if p := r.LastPass; p != nil {
+				fmt.Printf("Last pass:  %s  %s\n", shortSHA(p.Commit), p.Timestamp)
+			}
+			if p := r.FirstFail; p != nil {
+				fmt.Printf("First fail: %s  %s\n", shortSHA(p.Commit), p.Timestamp)
+				if p.Error != "" {
+					fmt.Printf("            %s\n", p.Error)
+				}
+			}
+			if r.Note != "" {
+				fmt.Printf("Note: %s\n", r.Note)
+			}
+			if len(r.Commits) == 0 {
+				return nil
+			}
+			more := ""
+			if r.Truncated {
+				more = fmt.Sprintf(", newest %d shown", bisect.MaxCommits)
+			}
+			fmt.Printf("\nCommits after the last pass (%d%s):\n", len(r.Commits), more)
+			for _, c := range r.Commits {
+				fmt.Printf("  %s  %s  %s  %s\n", shortSHA(c.SHA), c.Date, c.Author, c.Subject)
+			}
+			fmt.Printf("\nTo bisect: git bisect start %s %s\n", shortSHA(r.FirstFail.Commit), shortSHA(r.LastPass.Commit))
+			return nil
+		},
+	}
+	bisectCmd.Flags().BoolVar(&asJSON, "json", false, "Print the result as JSON")
+	bisectCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return bisectCmd
+}
+
+// runBisect asks the daemon when it is running and reads the registry
+// otherwise
+func runBisect(dir, id string) (*bisect.Result, error) {
+	return callOrBuild(dir, "bisect", map[string]string{"tanda_id": id}, func(tandas []*db.Tanda) (*bisect.Result, error) {
+		for _, t := range tandas {
+			if t.ID != id {
+				continue
+			}
+			root, err := paths.Root(dir)
+			if err != nil {
+				return nil, err
+			}
+			result := bisect.Locate(t)
+			result.Log(root)
+			return result, nil
+		}
+		return nil, fmt.Errorf("tanda %s not found", id)
+	})
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 10 {
+		return sha[:10]
+	}
+	return sha
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/burndown"
+	"github.com/tandas/daemon/internal/db"
+)
+
+// burndownBarWidth is the longest bar drawn for the quarantine count
+const burndownBarWidth = 40
+
+func newBurndownCmd() *cobra.Command {
+	var opts burndown.Options
+	var weekly, asJSON bool
+	burndownCmd := &cobra.Command{
+		Use:   "burndown",
+		Short: "Show how the number of quarantined tandas changes over time",
+		Long: `Show how many tandas sat in quarantine (status flaky or quarantined) over the
+last --days days, how many entered and left it, and how long they stayed, so
+you can see whether flaky-test debt is shrinking. The daemon records when each
+tanda enters and leaves quarantine as its status changes.
+
+Goes through the daemon when it is running.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if weekly && opts.Step == 0 {
+				opts.Step = 7
+			}
+			if err := opts.Check(); err != nil {
+				return err
+			}
+			r, err := runBurndown(socketDir, opts)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(r)
+			}
+
+			days := int(r.Until.Sub(r.Since).Hours()/24 + 0.5)
+			fmt.Printf("Quarantined: %d (%+d over %d days), %d entered, %d left\n", r.Quarantined, r.Change, days, r.Entered, r.Left)
+			if r.Resolved > 0 {
+				fmt.Printf("Time in quarantine: %.1f days on average for the %d that left", r.AverageDays, r.Resolved)
+			} else {
+				fmt.Print("Time in quarantine: none left in the window")
+			}
+			if r.Quarantined > 0 {
+				fmt.Printf("; %.1f days so far for those still in", r.OpenAverageDays)
+			}
+			fmt.Println()
+
+			most := 0
+			for _, p := range r.Points {
+				if p.Quarantined > most {
+					most = p.Quarantined
+				}
+			}
+			fmt.Println()
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "DATE\tQUARANTINED\tIN\tOUT\t")
+			for _, p := range r.Points {
+				bar := 0
+				if most > 0 {
+					bar = (p.Quarantined*burndownBarWidth + most - 1) / most
+				}
+				fmt.Fprintf(w, "%s\t%d\t+%d\t-%d\t%s\n", p.Date, p.Quarantined, p.Entered, p.Left, strings.Repeat("#", bar))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			if len(r.Oldest) > 0 {
+				fmt.Println("\nLongest in quarantine:")
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				for _, e := range r.Oldest {
+					fmt.Fprintf(w, "  %s\t%.1f days\t%s\t%s\n", e.ID, e.Days, orDash(strings.Join(e.Owners, ",")), e.Title)
+				}
+				return w.Flush()
+			}
+			return nil
+		},
+	}
+	burndownCmd.Flags().IntVar(&opts.Days, "days", burndown.DefaultDays, "Cover the last N days")
+	burndownCmd.Flags().IntVar(&opts.Step, "step", 0, "Days between points (default 1, or 7 with --weekly)")
+	burndownCmd.Flags().BoolVar(&weekly, "weekly", false, "One point per week")
+	burndownCmd.Flags().BoolVar(&asJSON, "json", false, "Print the burn-down as JSON")
+	burndownCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return burndownCmd
+}
+
+// runBurndown asks the daemon when it is running and reads the registry
+// otherwise
+func runBurndown(dir string, opts burndown.Options) (*burndown.Report, error) {
+	return callOrBuild(dir, "quarantine_burndown", opts, func(tandas []*db.Tanda) (*burndown.Report, error) {
+		return burndown.Build(tandas, opts, time.Now()), nil
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/ci"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+)
+
+func newCICmd() *cobra.Command {
+	ciCmd := &cobra.Command{
+		Use:   "ci",
+		Short: "Ingest CI test reports, manage quarantine issues and comment on pull requests",
+	}
+
+	var pipeline string
+	ingestCmd := &cobra.Command{
+		Use:   "ingest",
+		Short: "Record run results from a CI pipeline's test report",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, provider, err := loadCIProvider()
+			if err != nil {
+				return err
+			}
+
+			store, syncer, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			ctx := context.Background()
+			cases, err := provider.FetchTestReport(ctx, pipeline)
+			if err != nil {
+				return err
+			}
+
+			result, err := ci.Ingest(store, cases, pipeline)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Ingested %d test case(s): %d tanda(s) updated, %d unmatched\n",
+				len(cases), len(result.Updated), len(result.Unmatched))
+			for _, name := range result.Unmatched {
+				fmt.Printf("  unmatched: %s\n", name)
+			}
+
+			if cfg.CI.GitLab.CreateIssues {
+				if err := syncIssues(ctx, store, provider); err != nil {
+					return err
+				}
+			}
+
+			return syncer.ExportToJSONL()
+		},
+	}
+	ingestCmd.Flags().StringVar(&pipeline, "pipeline", "", "Pipeline ID to ingest")
+	ingestCmd.MarkFlagRequired("pipeline")
+
+	issuesCmd := &cobra.Command{
+		Use:   "issues",
+		Short: "Open issues for quarantined tandas and close resolved ones",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, provider, err := loadCIProvider()
+			if err != nil {
+				return err
+			}
+
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			return syncIssues(context.Background(), store, provider)
+		},
+	}
+
+	for _, c := range []*cobra.Command{ingestCmd, issuesCmd, newCICommentCmd()} {
+		c.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+		ciCmd.AddCommand(c)
+	}
+	return ciCmd
+}
+
+func loadCIProvider() (*config.Config, ci.Provider, error) {
+	cfg, err := config.Load(socketDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider, err := ci.NewProvider(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, provider, nil
+}
+
+func syncIssues(ctx context.Context, store *db.Store, provider ci.Provider) error {
+	result, err := ci.SyncIssues(ctx, store, provider)
+	if err != nil {
+		return err
+	}
+	for _, id := range result.Opened {
+		fmt.Printf("Opened %s issue for %s\n", provider.Name(), id)
+	}
+	for _, id := range result.Closed {
+		fmt.Printf("Closed %s issue for %s\n", provider.Name(), id)
+	}
+	return nil
+}
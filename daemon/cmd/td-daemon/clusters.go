@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/cluster"
+)
+
+func newClustersCmd() *cobra.Command {
+	var minSize int
+	clustersCmd := &cobra.Command{
+		Use:   "clusters",
+		Short: "Group failing tandas by error signature",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			tandas, err := store.GetAllTandas()
+			if err != nil {
+				return err
+			}
+			clusters := cluster.Build(tandas, minSize)
+			if len(clusters) == 0 {
+				fmt.Println("No failure clusters")
+				return nil
+			}
+			for _, c := range clusters {
+				fmt.Printf("%s  %d tanda(s)  %s\n", c.ID, len(c.TandaIDs), c.Signature)
+				fmt.Printf("    %s\n", strings.Join(c.TandaIDs, ", "))
+			}
+			return nil
+		},
+	}
+	clustersCmd.Flags().IntVar(&minSize, "min-size", 2, "Only show clusters with at least this many tandas")
+	clustersCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return clustersCmd
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/ci"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/impact"
+	"github.com/tandas/daemon/internal/rundiff"
+)
+
+func newCICommentCmd() *cobra.Command {
+	var pr, provider, base string
+	var opts rundiff.Options
+	var dryRun bool
+	commentCmd := &cobra.Command{
+		Use:   "comment",
+		Short: "Post or update a pull request comment summarizing the change",
+		Long: `Post a comment on a pull request (a merge request on GitLab) listing the
+tandas the change affects, those it newly broke or fixed, and the tandas that
+entered or left quarantine. Later runs update the same comment in place.
+
+The affected tandas come from the files changed since --base. The health
+changes come from comparing --to-batch with --from-batch, or the batch before
+it, as td-daemon diff does; --from and --to compare times instead. In CI the
+defaults come from the environment:
+
+  pull request  CI_MERGE_REQUEST_IID, or GITHUB_REF (refs/pull/<n>/merge)
+  base          CI_MERGE_REQUEST_DIFF_BASE_SHA, or origin/$GITHUB_BASE_REF
+  batch         TD_BATCH, CI_PIPELINE_ID or GITHUB_RUN_ID
+
+The provider is ci.provider, github or gitlab, with credentials from
+ci.github or ci.gitlab in config.yaml; on GitHub Actions, GITHUB_TOKEN and
+GITHUB_REPOSITORY are enough. --dry-run prints the comment instead.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if pr == "" {
+				pr = prFromEnv()
+			}
+			if pr == "" && !dryRun {
+				return fmt.Errorf("--pr is required outside a pull request pipeline")
+			}
+			if base == "" {
+				base = baseFromEnv()
+			}
+			if base == "" {
+				return fmt.Errorf("--base is required outside a pull request pipeline")
+			}
+			timed := opts.From != "" || opts.To != ""
+			if opts.ToBatch == "" && !timed {
+				opts.ToBatch = firstEnv("TD_BATCH", "CI_PIPELINE_ID", "GITHUB_RUN_ID")
+			}
+			if opts.ToBatch != "" || opts.FromBatch != "" || timed {
+				if err := opts.Check(); err != nil {
+					return err
+				}
+			}
+
+			root, _, err := projectPaths(socketDir)
+			if err != nil {
+				return err
+			}
+			changed, err := impact.GitChanged(root, base)
+			if err != nil {
+				return err
+			}
+			affected, err := runImpacted(socketDir, root, changed)
+			if err != nil {
+				return err
+			}
+			var diff *rundiff.Diff
+			if opts.ToBatch != "" || timed {
+				// Without runs to compare, the comment still lists the
+				// affected tandas
+				if diff, err = runDiff(socketDir, opts); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: leaving out test health changes: %v\n", err)
+					diff = nil
+				}
+			}
+			body := ci.PRSummary(affected, diff)
+			if dryRun {
+				fmt.Print(body)
+				return nil
+			}
+
+			cfg, err := config.Load(socketDir)
+			if err != nil {
+				return err
+			}
+			commenter, err := ci.NewCommenter(cfg, provider)
+			if err != nil {
+				return err
+			}
+			comment, updated, err := ci.UpsertComment(context.Background(), commenter, pr, body)
+			if err != nil {
+				return err
+			}
+			verb := "Posted"
+			if updated {
+				verb = "Updated"
+			}
+			fmt.Printf("%s %s comment %s on #%s %s\n", verb, commenter.Name(), comment.ID, pr, comment.URL)
+			return nil
+		},
+	}
+	commentCmd.Flags().StringVar(&pr, "pr", "", "Pull or merge request number")
+	commentCmd.Flags().StringVar(&provider, "provider", "", "github or gitlab (default ci.provider)")
+	commentCmd.Flags().StringVar(&base, "base", "", "Git ref the pull request is compared against")
+	commentCmd.Flags().StringVar(&opts.FromBatch, "from-batch", "", "Batch to compare from (default: the one before --to-batch)")
+	commentCmd.Flags().StringVar(&opts.ToBatch, "to-batch", "", "Batch to compare to")
+	commentCmd.Flags().StringVar(&opts.From, "from", "", "Time to compare from (RFC 3339)")
+	commentCmd.Flags().StringVar(&opts.To, "to", "", "Time to compare to (RFC 3339, default now)")
+	commentCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the comment instead of posting it")
+	return commentCmd
+}
+
+// prFromEnv is the pull or merge request the CI pipeline runs for
+func prFromEnv() string {
+	if iid := os.Getenv("CI_MERGE_REQUEST_IID"); iid != "" {
+		return iid
+	}
+	if ref := os.Getenv("GITHUB_REF"); strings.HasPrefix(ref, "refs/pull/") {
+		return strings.Split(strings.TrimPrefix(ref, "refs/pull/"), "/")[0]
+	}
+	return ""
+}
+
+// baseFromEnv is the git ref the pipeline's pull request targets
+func baseFromEnv() string {
+	if sha := os.Getenv("CI_MERGE_REQUEST_DIFF_BASE_SHA"); sha != "" {
+		return sha
+	}
+	if ref := os.Getenv("GITHUB_BASE_REF"); ref != "" {
+		return "origin/" + ref
+	}
+	return ""
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
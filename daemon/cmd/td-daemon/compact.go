@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/compact"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func newCompactCmd() *cobra.Command {
+	var opts compact.Options
+	compactCmd := &cobra.Command{
+		Use:   "compact",
+		Short: "Compact the trace inbox, old traces, snapshots and attachments, and the database",
+		Long: `Housekeeping in one pass, for a periodic CI job:
+
+  - delete trace files under test-results older than --trace-days that no run
+    links to and no pending inbox entry waits on
+  - drop duplicate trace inbox entries and entries whose file is gone
+  - remove temp files left by interrupted exports and snapshots
+  - keep only the newest --keep-snapshots snapshots
+  - delete note attachments under blobs that no note references any more
+  - VACUUM the database
+
+Goes through the daemon when it is running.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			result, err := runCompact(socketDir, opts)
+			if err != nil {
+				return err
+			}
+			verb := "Removed"
+			if opts.DryRun {
+				verb = "Would remove"
+			}
+			fmt.Printf("%s %d trace(s), %d inbox line(s), %d leftover file(s), %d snapshot(s) and %d attachment(s) (%d bytes)\n",
+				verb, result.Traces, result.InboxEntries, result.Leftovers, result.Snapshots, result.Blobs, result.BlobBytes)
+			if !opts.DryRun {
+				fmt.Printf("Database: %d -> %d bytes\n", result.DBBytesBefore, result.DBBytesAfter)
+			}
+			return nil
+		},
+	}
+	compactCmd.Flags().IntVar(&opts.TraceDays, "trace-days", compact.DefaultTraceDays, "Delete unreferenced traces older than this many days (0 keeps all)")
+	compactCmd.Flags().IntVar(&opts.KeepSnapshots, "keep-snapshots", compact.DefaultKeepSnapshots, "Keep this many newest snapshots (0 keeps all)")
+	compactCmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "Show what would be removed without removing it")
+	compactCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return compactCmd
+}
+
+// runCompact compacts through the daemon when it is running, since it owns
+// the database, and directly otherwise
+func runCompact(dir string, opts compact.Options) (*compact.Result, error) {
+	var result compact.Result
+	err := rpc.Call(dir, "compact", opts, &result)
+	if !errors.Is(err, rpc.ErrNotRunning) {
+		return &result, err
+	}
+
+	store, _, err := openRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return compact.Run(dir, store, opts, time.Now())
+}
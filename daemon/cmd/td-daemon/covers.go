@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/coverage"
+	"github.com/tandas/daemon/internal/paths"
+)
+
+func newCoversCmd() *cobra.Command {
+	coversCmd := &cobra.Command{
+		Use:   "covers",
+		Short: "Populate and look up tanda covers",
+	}
+
+	var format, tanda string
+	var merge bool
+	importCmd := &cobra.Command{
+		Use:   "import <profile>...",
+		Short: "Set covers from Go cover profiles or lcov files",
+		Long: `Set each tanda's covers to the source files its tests covered.
+
+lcov records are attributed by their TN (test name), matched against tanda
+ID, title or file. Go cover profiles carry no test names, so each profile is
+attributed to --tanda, or to the tanda named by the profile's file name
+(e.g. td-1a2b3c4d.out).`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, _, err := projectPaths(socketDir)
+			if err != nil {
+				return err
+			}
+			module := coverage.ModulePath(root)
+
+			byTest := make(map[string]coverage.Files)
+			for _, path := range args {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+
+				if profileFormat(format, path, data) == "go" {
+					files, err := coverage.ParseGoProfile(bytes.NewReader(data), module)
+					if err != nil {
+						return fmt.Errorf("%s: %w", path, err)
+					}
+					key := tanda
+					if key == "" {
+						key = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+					}
+					byTest[key] = byTest[key].Add(files)
+					continue
+				}
+
+				sections, err := coverage.ParseLCOV(bytes.NewReader(data), root)
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				for test, files := range sections {
+					if tanda != "" {
+						test = tanda
+					}
+					byTest[test] = byTest[test].Add(files)
+				}
+			}
+
+			store, syncer, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			result, err := coverage.Apply(store, byTest, merge)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Updated covers on %d tanda(s)\n", len(result.Updated))
+			for _, key := range result.Unmatched {
+				fmt.Printf("  no tanda for %q\n", key)
+			}
+
+			if len(result.Updated) == 0 {
+				return nil
+			}
+			return syncer.ExportToJSONL()
+		},
+	}
+	importCmd.Flags().StringVar(&format, "format", "auto", "Profile format: auto, go or lcov")
+	importCmd.Flags().StringVar(&tanda, "tanda", "", "Attribute all coverage to this tanda ID")
+	importCmd.Flags().BoolVar(&merge, "merge", false, "Add to existing covers instead of replacing them")
+	importCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+
+	var prefix, asJSON bool
+	lookupCmd := &cobra.Command{
+		Use:   "lookup <path>",
+		Short: "List the tandas that cover a source file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, _, err := projectPaths(socketDir)
+			if err != nil {
+				return err
+			}
+			path, err := filepath.Abs(args[0])
+			if err != nil {
+				return err
+			}
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			tandas, err := store.CoveredBy(paths.Normalize(root, path), prefix)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(tandas)
+			}
+			if len(tandas) == 0 {
+				fmt.Printf("No tandas cover %s\n", args[0])
+				return nil
+			}
+			for _, t := range tandas {
+				fmt.Printf("%s  %s  [%s]\n", t.ID, t.Title, t.Status)
+			}
+			return nil
+		},
+	}
+	lookupCmd.Flags().BoolVar(&prefix, "prefix", false, "Treat the path as a directory and match files under it")
+	lookupCmd.Flags().BoolVar(&asJSON, "json", false, "Print tandas as JSON")
+	lookupCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+
+	coversCmd.AddCommand(importCmd, lookupCmd)
+	return coversCmd
+}
+
+func profileFormat(flag, path string, data []byte) string {
+	if flag != "auto" {
+		return flag
+	}
+	switch filepath.Ext(path) {
+	case ".info", ".lcov":
+		return "lcov"
+	}
+	if bytes.HasPrefix(data, []byte("mode:")) {
+		return "go"
+	}
+	return "lcov"
+}
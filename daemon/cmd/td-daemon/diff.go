@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rundiff"
+)
+
+func newDiffCmd() *cobra.Command {
+	var opts rundiff.Options
+	var markdown, asJSON bool
+	diffCmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compare test results between two batches or two times",
+		Long: `Compare test results between two ingestion batches, or two times, and list
+the tandas that newly failed, were fixed, still fail, ran for the first time,
+or entered or left quarantine.
+
+A run's batch comes from TD_BATCH, GitLab's CI_PIPELINE_ID or GitHub's
+GITHUB_RUN_ID, from the pipeline on ci ingest, or is one per td-daemon run.
+With only --to-batch, the batch is compared with the one before it:
+
+  td-daemon diff --to-batch "$CI_PIPELINE_ID" --markdown > comment.md
+  td-daemon diff --from 2025-06-01T00:00:00Z       # until now
+
+Goes through the daemon when it is running.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Check(); err != nil {
+				return err
+			}
+			d, err := runDiff(socketDir, opts)
+			if err != nil {
+				return err
+			}
+			switch {
+			case asJSON:
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(d)
+			case markdown:
+				fmt.Print(d.Markdown())
+				return nil
+			}
+
+			fmt.Printf("%s -> %s: %d newly failing, %d fixed, %d still failing, %d new, %d unchanged\n", d.From, d.To,
+				len(d.NewlyFailing), len(d.NewlyPassing), len(d.StillFailing), len(d.New), d.Unchanged)
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			for _, s := range []struct {
+				label   string
+				entries []rundiff.Entry
+			}{
+				{"newly failing", d.NewlyFailing}, {"fixed", d.NewlyPassing}, {"still failing", d.StillFailing},
+				{"new", d.New}, {"quarantined", d.Quarantined}, {"released", d.Released},
+			} {
+				for _, e := range s.entries {
+					fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", s.label, e.ID, orDash(strings.Join(e.Owners, ",")), e.Title)
+				}
+			}
+			return w.Flush()
+		},
+	}
+	diffCmd.Flags().StringVar(&opts.FromBatch, "from-batch", "", "Batch to compare from (default: the one before --to-batch)")
+	diffCmd.Flags().StringVar(&opts.ToBatch, "to-batch", "", "Batch to compare to")
+	diffCmd.Flags().StringVar(&opts.From, "from", "", "Time to compare from (RFC 3339)")
+	diffCmd.Flags().StringVar(&opts.To, "to", "", "Time to compare to (RFC 3339, default now)")
+	diffCmd.Flags().BoolVar(&markdown, "markdown", false, "Print the diff as Markdown, for a CI or pull request comment")
+	diffCmd.Flags().BoolVar(&asJSON, "json", false, "Print the diff as JSON")
+	diffCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return diffCmd
+}
+
+// runDiff asks the daemon when it is running and reads the registry
+// otherwise
+func runDiff(dir string, opts rundiff.Options) (*rundiff.Diff, error) {
+	return callOrBuild(dir, "run_diff", opts, func(tandas []*db.Tanda) (*rundiff.Diff, error) {
+		return rundiff.Build(tandas, opts, time.Now())
+	})
+}
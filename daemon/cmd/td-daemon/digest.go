@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/digest"
+)
+
+func newDigestCmd() *cobra.Command {
+	var dryRun bool
+	var owner string
+	var format string
+	digestCmd := &cobra.Command{
+		Use:   "digest",
+		Short: "Compose and send the registry digest now",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(socketDir)
+			if err != nil {
+				return err
+			}
+
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if owner != "" {
+				return printOwnerDigest(socketDir, store, cfg.Digest, owner, format)
+			}
+			d, err := digest.Run(socketDir, store, cfg.Digest, loadWorkflow(socketDir), dryRun)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				return printDigest(d, format)
+			}
+			fmt.Printf("Sent: %s\n", d.Subject())
+			if n := len(cfg.Digest.Owners); n > 0 {
+				fmt.Printf("Sent owner digests to %d owner(s)\n", n)
+			}
+			return nil
+		},
+	}
+	digestCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the digest instead of sending it")
+	digestCmd.Flags().StringVar(&owner, "owner", "", "Print this owner's digest instead of sending anything")
+	digestCmd.Flags().StringVar(&format, "format", "markdown", "Format of a printed digest: markdown or html")
+	digestCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return digestCmd
+}
+
+// printOwnerDigest prints the digest owner would get, without sending it
+// or moving the baseline
+func printOwnerDigest(dir string, store *db.Store, cfg config.DigestConfig, owner, format string) error {
+	prev, err := digest.LoadState(filepath.Join(dir, digest.StateFileName))
+	if err != nil {
+		return err
+	}
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		return err
+	}
+	d := digest.Build(digest.OwnedBy(tandas, owner), loadWorkflow(dir), prev, digest.Period(cfg), time.Now().UTC())
+	d.Owner = owner
+	return printDigest(d, format)
+}
+
+func printDigest(d *digest.Digest, format string) error {
+	out, err := d.Render(format)
+	if err != nil {
+		return err
+	}
+	fmt.Print(out)
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/orphans"
+	"github.com/tandas/daemon/internal/prune"
+	"github.com/tandas/daemon/internal/rpc"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+// doctorReport is the outcome of every check `doctor` runs
+type doctorReport struct {
+	Registry  []sync.ValidationError `json:"registry"`
+	Paths     []orphans.Finding      `json:"paths"`
+	Retention doctorRetention        `json:"retention"`
+	Daemon    doctorDaemon           `json:"daemon"`
+}
+
+// doctorRetention is the configured prune policy and what it would prune
+// now; it is informational, not a problem
+type doctorRetention struct {
+	Policy   prune.Options `json:"policy"`
+	Schedule string        `json:"schedule,omitempty"`
+	Pending  *prune.Result `json:"pending,omitempty"`
+}
+
+type doctorDaemon struct {
+	Running bool `json:"running"`
+	PID     int  `json:"pid,omitempty"`
+	// Degraded lists subsystems that failed when the daemon started
+	Degraded []rpc.Degradation `json:"degraded,omitempty"`
+}
+
+func (r *doctorReport) problems() int {
+	return len(r.Registry) + len(r.Paths) + len(r.Daemon.Degraded)
+}
+
+func newDoctorCmd() *cobra.Command {
+	var renames, asJSON bool
+	doctorCmd := &cobra.Command{
+		Use:          "doctor",
+		Short:        "Check the registry, referenced paths and daemon for problems",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report := doctorReport{}
+
+			problems, err := sync.ValidateFile(filepath.Join(socketDir, "issues.jsonl"), validateOptions(socketDir))
+			if err != nil {
+				return err
+			}
+			report.Registry = append([]sync.ValidationError{}, problems...)
+
+			root, _, err := projectPaths(socketDir)
+			if err != nil {
+				return err
+			}
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			tandas, err := store.GetAllTandas()
+			if err == nil {
+				report.Retention, err = retentionReport(store, socketDir)
+			}
+			store.Close()
+			if err != nil {
+				return err
+			}
+			statuses := loadWorkflow(socketDir)
+			report.Paths, err = orphans.Detect(tandas, root, statuses, renames)
+			if err != nil && renames {
+				slog.Warn("Skipping rename suggestions", "err", err)
+				report.Paths, err = orphans.Detect(tandas, root, statuses, false)
+			}
+			if err != nil {
+				return err
+			}
+
+			report.Daemon.Running, report.Daemon.PID = rpc.DaemonStatus(socketDir)
+			if report.Daemon.Running {
+				if lock, err := rpc.ReadLockFile(socketDir); err == nil {
+					report.Daemon.Degraded = lock.Startup.Degraded
+				}
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				printDoctor(&report)
+			}
+			if n := report.problems(); n > 0 {
+				return fmt.Errorf("doctor found %d problem(s)", n)
+			}
+			return nil
+		},
+	}
+	doctorCmd.Flags().BoolVar(&renames, "renames", true, "Suggest where git moved missing paths")
+	doctorCmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
+	doctorCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return doctorCmd
+}
+
+// retentionReport reads the prune policy from config.yaml and dry-runs it
+func retentionReport(store *db.Store, dir string) (doctorRetention, error) {
+	cfg, err := config.Load(dir)
+	if err != nil {
+		return doctorRetention{}, err
+	}
+	r := doctorRetention{Policy: prune.FromConfig(cfg.Prune), Schedule: cfg.Jobs.Prune}
+	if r.Schedule == "" {
+		r.Schedule = cfg.Prune.Schedule
+	}
+	if r.Policy.Empty() {
+		return r, nil
+	}
+	r.Pending, err = prune.Run(store, filepath.Join(dir, prune.ArchiveFile), r.Policy, time.Now(), true)
+	return r, err
+}
+
+func printDoctor(r *doctorReport) {
+	if len(r.Registry) == 0 {
+		fmt.Println("Registry: ok")
+	} else {
+		fmt.Printf("Registry: %d problem(s)\n", len(r.Registry))
+		for _, p := range r.Registry {
+			fmt.Printf("  %s\n", p.Error())
+		}
+	}
+
+	if len(r.Paths) == 0 {
+		fmt.Println("Paths: ok")
+	} else {
+		fmt.Printf("Paths: %d missing\n", len(r.Paths))
+		for _, f := range r.Paths {
+			line := fmt.Sprintf("  %s  %s %s", f.TandaID, f.Field, f.Path)
+			if f.RenamedTo != "" {
+				line += fmt.Sprintf(" (renamed to %s)", f.RenamedTo)
+			}
+			fmt.Println(line)
+		}
+	}
+
+	fmt.Printf("Retention: %s", r.Retention.Policy)
+	if r.Retention.Schedule != "" {
+		fmt.Printf(" (pruned on %q)", r.Retention.Schedule)
+	}
+	fmt.Println()
+	if p := r.Retention.Pending; p != nil && p.Tandas > 0 {
+		fmt.Printf("  %d run(s) and %d note(s) from %d tanda(s) due for pruning\n", p.Runs, p.Notes, p.Tandas)
+	}
+
+	switch {
+	case !r.Daemon.Running:
+		fmt.Println("Daemon: not running")
+	case len(r.Daemon.Degraded) == 0:
+		fmt.Printf("Daemon: running (PID: %d)\n", r.Daemon.PID)
+	default:
+		fmt.Printf("Daemon: running degraded (PID: %d)\n", r.Daemon.PID)
+		for _, d := range r.Daemon.Degraded {
+			fmt.Printf("  %s: %s\n", d.Subsystem, d.Reason)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/environment"
+)
+
+func newEnvironmentsCmd() *cobra.Command {
+	var opts environment.Options
+	var asJSON bool
+	environmentsCmd := &cobra.Command{
+		Use:     "environments",
+		Aliases: []string{"envs"},
+		Short:   "Find failures that concentrate in one runner, OS, browser or shard",
+		Long: `Compare failure rates between the environments runs happened in, to tell
+infrastructure flakes from genuine test bugs. Runs carry runner, os, browser and
+shard: td-daemon run and td-daemon ci ingest take them from TD_RUNNER, TD_OS,
+TD_BROWSER and TD_SHARD, or from GitLab CI and GitHub Actions variables, and
+td update --run-env sets them by hand.
+
+Each failing tanda gets a verdict: environment when its failures concentrate in
+one environment, test when it fails alike in several, unknown when it has not
+run in enough environments to tell. Environments failing more than the rest
+across all tandas, such as a broken runner, are listed first.
+
+Goes through the daemon when it is running.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := runEnvironments(socketDir, opts)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(report)
+			}
+
+			if len(report.Environments) > 0 {
+				fmt.Println("Environments failing more than the rest:")
+				for _, s := range report.Environments {
+					fmt.Printf("  %s, %d tanda(s)\n", s, s.Tandas)
+				}
+				fmt.Println()
+			}
+			if len(report.Tandas) == 0 {
+				fmt.Println("No failures with environment metadata")
+				return nil
+			}
+			for _, f := range report.Tandas {
+				detail := fmt.Sprintf("%.0f%% (%d/%d)", f.FailureRate*100, f.Failures, f.Runs)
+				switch f.Verdict {
+				case environment.Environmental:
+					detail = f.Environment.String()
+				case environment.Test:
+					detail += " in " + strings.Join(f.FailingIn, ", ")
+				}
+				fmt.Printf("%s  %s  [%s]  %s\n", f.TandaID, f.Title, f.Verdict, detail)
+			}
+			return nil
+		},
+	}
+	environmentsCmd.Flags().IntVar(&opts.Days, "days", 0, "Count only runs of the last N days (0 = all)")
+	environmentsCmd.Flags().IntVar(&opts.MinRuns, "min-runs", environment.DefaultMinRuns, "Runs an environment needs to be compared")
+	environmentsCmd.Flags().BoolVar(&asJSON, "json", false, "Print the report as JSON")
+	environmentsCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return environmentsCmd
+}
+
+// runEnvironments asks the daemon when it is running and reads the
+// registry otherwise
+func runEnvironments(dir string, opts environment.Options) (*environment.Report, error) {
+	return callOrBuild(dir, "environment_failures", opts, func(tandas []*db.Tanda) (*environment.Report, error) {
+		opts.Statuses = loadWorkflow(dir)
+		return environment.Analyze(tandas, opts, time.Now()), nil
+	})
+}
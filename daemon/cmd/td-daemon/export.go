@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/export"
+)
+
+func newExportCmd() *cobra.Command {
+	var format, output string
+	var filter db.Filter
+	var opts export.Options
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the registry for other tools",
+		Long: `Export the registry for other tools. Tandas are read through the running
+daemon, or from the registry directly when no daemon is running.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tandas, err := queryTandas(socketDir, filter)
+			if err != nil {
+				return err
+			}
+
+			if format == export.FormatParquet || format == export.FormatMarkdown {
+				if output == "" || output == "-" {
+					return fmt.Errorf("--output directory is required for %s", format)
+				}
+				files := export.ParquetFiles
+				if format == export.FormatMarkdown {
+					files = export.MarkdownFiles
+				}
+				paths, err := files(output, tandas)
+				if err != nil {
+					return err
+				}
+				for _, p := range paths {
+					fmt.Printf("Wrote %s\n", p)
+				}
+				return nil
+			}
+
+			var w io.Writer = os.Stdout
+			if output != "" && output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			opts.Statuses = loadWorkflow(socketDir)
+			return export.Write(w, tandas, format, opts)
+		},
+	}
+	exportCmd.Flags().StringVar(&format, "format", export.FormatJUnit, "Export format: junit, csv, tsv, jsonl, json, parquet or markdown")
+	exportCmd.Flags().StringVarP(&output, "output", "o", "", "Write to this file instead of stdout (a directory for parquet and markdown)")
+	exportCmd.Flags().StringVar(&output, "out", "", "Same as --output")
+	exportCmd.Flags().StringSliceVar(&opts.Columns, "columns", nil, "CSV/TSV columns (default id,title,status,file,owners,last_result,last_run,flakiness)")
+	exportCmd.Flags().StringVar(&filter.Status, "status", "", "Only export tandas with this status")
+	exportCmd.Flags().StringVar(&filter.Owner, "owner", "", "Only export tandas owned by this user or team")
+	exportCmd.Flags().StringVar(&filter.Priority, "priority", "", "Only export tandas with this priority")
+	exportCmd.Flags().StringVar(&filter.Triage, "triage", "", "Only export tandas in this triage state")
+	exportCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return exportCmd
+}
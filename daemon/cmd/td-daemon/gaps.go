@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/requirements"
+)
+
+func newGapsCmd() *cobra.Command {
+	var format string
+	var strict bool
+	gapsCmd := &cobra.Command{
+		Use:   "gaps <manifest>",
+		Short: "Report requirements from a YAML or CSV manifest that no healthy tanda covers",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reqs, err := requirements.Load(args[0])
+			if err != nil {
+				return err
+			}
+
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			tandas, err := store.GetAllTandas()
+			if err != nil {
+				return err
+			}
+			report := requirements.Check(reqs, tandas, loadWorkflow(socketDir))
+
+			switch format {
+			case "markdown":
+				fmt.Print(report.Markdown())
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unknown format %q (want markdown or json)", format)
+			}
+
+			if gaps := report.Gaps(); strict && len(gaps) > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%d requirement(s) not covered by a healthy tanda", len(gaps))
+			}
+			return nil
+		},
+	}
+	gapsCmd.Flags().StringVar(&format, "format", "markdown", "Output format: markdown or json")
+	gapsCmd.Flags().BoolVar(&strict, "strict", false, "Exit non-zero when any requirement has a gap")
+	gapsCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return gapsCmd
+}
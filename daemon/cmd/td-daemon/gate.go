@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/gate"
+	"github.com/tandas/daemon/internal/impact"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+func newGateCmd() *cobra.Command {
+	var base string
+	var asJSON bool
+	gateCmd := &cobra.Command{
+		Use:   "gate",
+		Short: "Fail when the registry violates the project's policies, as a required CI check",
+		Long: `Check the registry against the policies in the gate section of config.yaml
+and exit non-zero when any is violated:
+
+  registry         issues.jsonl has validation errors
+  untracked_tests  a test file added since --base is no tanda's file
+  max_quarantined  more tandas are quarantined than gate.max_quarantined
+  max_flaky        more tandas are flaky than gate.max_flaky
+  min_pass_rate    fewer tandas passed their latest run than gate.min_pass_rate
+
+The limits are checked only when set, and gate.skip turns policies off.
+Test files are those matching gate.tests, or common test file names by
+default. In a GitLab merge request pipeline or a GitHub Actions pull_request
+workflow --base defaults to the target branch; without a base,
+untracked_tests is not checked.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(socketDir)
+			if err != nil {
+				return err
+			}
+			problems, err := sync.ValidateFile(filepath.Join(socketDir, "issues.jsonl"), validateOptions(socketDir))
+			if err != nil {
+				return err
+			}
+			in := gate.Input{Problems: problems}
+
+			if base == "" {
+				base = baseFromEnv()
+			}
+			if base != "" {
+				root, _, err := projectPaths(socketDir)
+				if err != nil {
+					return err
+				}
+				if in.Added, err = impact.GitAdded(root, base); err != nil {
+					return err
+				}
+				if in.Added == nil {
+					in.Added = []string{}
+				}
+			}
+
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			in.Tandas, err = store.GetAllTandas()
+			store.Close()
+			if err != nil {
+				return err
+			}
+
+			result, err := gate.Check(cfg.Gate, in)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(result); err != nil {
+					return err
+				}
+			} else {
+				printGate(result)
+			}
+			if result.Failed() {
+				return fmt.Errorf("gate failed: %d violation(s)", len(result.Violations))
+			}
+			return nil
+		},
+	}
+	gateCmd.Flags().StringVar(&base, "base", "", "Git ref new test files are found against (default: the pull request's target)")
+	gateCmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
+	gateCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return gateCmd
+}
+
+func printGate(r *gate.Result) {
+	fmt.Printf("Checked: %s\n", strings.Join(r.Checked, ", "))
+	if !r.Failed() {
+		fmt.Println("Gate: ok")
+		return
+	}
+	fmt.Printf("Gate: %d violation(s)\n", len(r.Violations))
+	for _, v := range r.Violations {
+		fmt.Printf("  %s: %s\n", v.Policy, v.Message)
+	}
+}
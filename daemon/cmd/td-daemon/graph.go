@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/graph"
+)
+
+func newGraphCmd() *cobra.Command {
+	var format string
+	graphCmd := &cobra.Command{
+		Use:   "graph [root-id]",
+		Short: "Export the depends_on graph as Graphviz DOT or Mermaid",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			tandas, err := store.GetAllTandas()
+			if err != nil {
+				return err
+			}
+			var root string
+			if len(args) == 1 {
+				root = args[0]
+			}
+			g, err := graph.Build(tandas, loadWorkflow(socketDir), root)
+			if err != nil {
+				return err
+			}
+			out, err := graph.Render(g, format)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+
+			for _, c := range g.Cycles {
+				slog.Warn("Dependency cycle", "tandas", strings.Join(c, ", "))
+			}
+			return nil
+		},
+	}
+	graphCmd.Flags().StringVar(&format, "format", graph.FormatDOT, "Output format: dot or mermaid")
+	graphCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return graphCmd
+}
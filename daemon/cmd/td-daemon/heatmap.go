@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/heatmap"
+)
+
+func newHeatmapCmd() *cobra.Command {
+	var opts heatmap.Options
+	var minRuns, depth, limit int
+	var asJSON bool
+	heatmapCmd := &cobra.Command{
+		Use:   "heatmap",
+		Short: "Show failure hotspots by directory",
+		Long: `Roll failure and flakiness rates up the directory tree of the tandas' files,
+or with --by covers of the covers entries that are paths, to show where in the
+codebase failures concentrate. Each directory counts every tanda under it once.
+
+Without --json the hottest directories and files are listed, highest failure
+rate first. --json prints the whole tree with name, value (the tanda count)
+and children, ready for a treemap such as d3.hierarchy:
+
+  td-daemon heatmap --by covers --days 30 --json > heatmap.json
+
+Goes through the daemon when it is running.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := runHeatmap(socketDir, opts)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(root)
+			}
+
+			hot := heatmap.Hotspots(root, minRuns, depth)
+			if len(hot) == 0 {
+				fmt.Println("No failures")
+				return nil
+			}
+			if limit > 0 && len(hot) > limit {
+				hot = hot[:limit]
+			}
+			fmt.Printf("%-40s  %6s  %9s  %6s  %5s\n", "PATH", "FAIL%", "FAIL/RUNS", "TANDAS", "FLAKY")
+			for _, n := range hot {
+				fmt.Printf("%-40s  %5.0f%%  %9s  %6d  %5d\n", n.Path, n.FailureRate*100,
+					fmt.Sprintf("%d/%d", n.Failures, n.Runs), n.Value, n.Flaky)
+			}
+			return nil
+		},
+	}
+	heatmapCmd.Flags().StringVar(&opts.By, "by", heatmap.ByFile, "Place tandas by their file or covers")
+	heatmapCmd.Flags().IntVar(&opts.Days, "days", 0, "Count only runs of the last N days (0 = all)")
+	heatmapCmd.Flags().IntVar(&minRuns, "min-runs", 5, "List only paths with at least this many runs")
+	heatmapCmd.Flags().IntVar(&depth, "depth", 0, "List paths at most this many levels deep (0 = all)")
+	heatmapCmd.Flags().IntVar(&limit, "limit", 20, "List at most this many paths (0 = all)")
+	heatmapCmd.Flags().BoolVar(&asJSON, "json", false, "Print the whole tree as JSON")
+	heatmapCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return heatmapCmd
+}
+
+// runHeatmap asks the daemon when it is running and reads the registry
+// otherwise
+func runHeatmap(dir string, opts heatmap.Options) (*heatmap.Node, error) {
+	return callOrBuild(dir, "heatmap", opts, func(tandas []*db.Tanda) (*heatmap.Node, error) {
+		opts.Statuses = loadWorkflow(dir)
+		return heatmap.Build(tandas, opts, time.Now())
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/hooks"
+	"github.com/tandas/daemon/internal/rpc"
+	"github.com/tandas/daemon/internal/sync"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+func newHooksCmd() *cobra.Command {
+	hooksCmd := &cobra.Command{
+		Use:   "hooks",
+		Short: "Manage git hooks that keep the registry in sync with git",
+	}
+
+	var force bool
+	installCmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install post-merge, post-checkout and pre-commit hooks",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return installHooks(socketDir, force)
+		},
+	}
+	installCmd.Flags().BoolVar(&force, "force", false, "Overwrite hooks not managed by td-daemon")
+
+	uninstallCmd := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove hooks installed by td-daemon",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, _, err := projectPaths(socketDir)
+			if err != nil {
+				return err
+			}
+			removed, err := hooks.Uninstall(root)
+			for _, name := range removed {
+				fmt.Printf("Removed %s hook\n", name)
+			}
+			return err
+		},
+	}
+
+	runCmd := &cobra.Command{
+		Use:          "run <hook>",
+		Short:        "Run the action for a git hook (called by the installed hooks)",
+		Args:         cobra.ExactValidArgs(1),
+		ValidArgs:    hooks.Names,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if args[0] == "pre-commit" {
+				return validateRegistry(socketDir)
+			}
+			return importNow(socketDir)
+		},
+	}
+
+	for _, c := range []*cobra.Command{installCmd, uninstallCmd, runCmd} {
+		c.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+		hooksCmd.AddCommand(c)
+	}
+	return hooksCmd
+}
+
+// projectPaths returns the project root (the parent of the Tandas
+// directory) and the Tandas directory relative to it
+func projectPaths(dir string) (string, string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	root := filepath.Dir(abs)
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", "", err
+	}
+	return root, rel, nil
+}
+
+// installHooks installs the managed git hooks for the Tandas directory dir
+func installHooks(dir string, force bool) error {
+	root, rel, err := projectPaths(dir)
+	if err != nil {
+		return err
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate td-daemon binary: %w", err)
+	}
+
+	installed, err := hooks.Install(root, binary, rel, force)
+	for _, name := range installed {
+		fmt.Printf("Installed %s hook\n", name)
+	}
+	return err
+}
+
+// importNow reloads the registry through the running daemon, or directly
+// when no daemon is running
+func importNow(dir string) error {
+	err := rpc.Call(dir, "import", nil, nil)
+	if !errors.Is(err, rpc.ErrNotRunning) {
+		return err
+	}
+
+	store, _, err := openRegistry(dir)
+	if err != nil {
+		return err
+	}
+	return store.Close()
+}
+
+// validateOptions reads the registry settings validation reports against
+// from config.yaml, falling back to the defaults
+func validateOptions(dir string) sync.ValidateOptions {
+	var opts sync.ValidateOptions
+	if cfg, err := config.Load(dir); err == nil {
+		opts.Duplicates, _ = sync.ParseDuplicatePolicy(cfg.Import.Duplicates)
+		opts.Statuses, _ = workflow.New(cfg.Statuses)
+		opts.MaxLineBytes = cfg.Import.MaxLineBytes
+	}
+	return opts
+}
+
+func validateRegistry(dir string) error {
+	path := filepath.Join(dir, "issues.jsonl")
+	problems, err := sync.ValidateFile(path, validateOptions(dir))
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, p.Error())
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d validation error(s) in %s", len(problems), path)
+	}
+	return nil
+}
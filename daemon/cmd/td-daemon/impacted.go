@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/impact"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func newImpactedCmd() *cobra.Command {
+	var base string
+	var idsOnly, asJSON bool
+	impactedCmd := &cobra.Command{
+		Use:   "impacted [path...]",
+		Short: "List the tandas affected by changed files",
+		Long: `List the tandas to run for a change: those whose file changed or that cover a
+changed path, and then everything that depends on them. Paths come from the
+arguments, from stdin with "-", or else from git: the files changed since
+--base (HEAD by default, so uncommitted changes) plus untracked files.
+
+--ids prints just the IDs, for td-daemon run:
+
+  td-daemon run $(td-daemon impacted --base origin/main --ids)
+
+Goes through the daemon when it is running.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, _, err := projectPaths(socketDir)
+			if err != nil {
+				return err
+			}
+			changed := args
+			if len(args) == 1 && args[0] == "-" {
+				if changed, err = readLines(os.Stdin); err != nil {
+					return err
+				}
+			} else if len(args) == 0 {
+				if changed, err = impact.GitChanged(root, base); err != nil {
+					return err
+				}
+			}
+			result, err := runImpacted(socketDir, root, changed)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case asJSON:
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(result)
+			case idsOnly:
+				if len(result.Tandas) > 0 {
+					fmt.Println(strings.Join(result.IDs(), " "))
+				}
+				return nil
+			}
+			if len(result.Changed) == 0 {
+				fmt.Println("No changed files")
+				return nil
+			}
+			if len(result.Tandas) == 0 {
+				fmt.Printf("No tandas affected by %d changed file(s)\n", len(result.Changed))
+			}
+			for _, a := range result.Tandas {
+				fmt.Printf("%s  %s  [%s]  %s\n", a.TandaID, a.Title, a.Status, formatReasons(a.Reasons))
+			}
+			if len(result.Uncovered) > 0 {
+				fmt.Printf("\nNot covered by any tanda (%d):\n", len(result.Uncovered))
+				for _, p := range result.Uncovered {
+					fmt.Printf("    %s\n", p)
+				}
+			}
+			return nil
+		},
+	}
+	impactedCmd.Flags().StringVar(&base, "base", "", "Compare against this git ref (default HEAD)")
+	impactedCmd.Flags().BoolVar(&idsOnly, "ids", false, "Print only the affected tanda IDs")
+	impactedCmd.Flags().BoolVar(&asJSON, "json", false, "Print the result as JSON")
+	impactedCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return impactedCmd
+}
+
+// runImpacted asks the daemon when it is running and reads the registry
+// otherwise
+func runImpacted(dir, root string, changed []string) (*impact.Result, error) {
+	return callOrBuild(dir, "impacted", rpc.ImpactedParams{Paths: changed}, func(tandas []*db.Tanda) (*impact.Result, error) {
+		return impact.Analyze(tandas, root, loadWorkflow(dir), changed), nil
+	})
+}
+
+// formatReasons renders why a tanda is affected
+func formatReasons(reasons []impact.Reason) string {
+	parts := make([]string, 0, len(reasons))
+	for _, r := range reasons {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// readLines returns the non-empty lines of f
+func readLines(f *os.File) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
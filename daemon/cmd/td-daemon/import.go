@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/paths"
+	"github.com/tandas/daemon/internal/rpc"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+func newImportCmd() *cobra.Command {
+	var mode string
+	var dryRun bool
+	importCmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Merge another JSONL registry into this one, or replace it",
+		Long: `Import tandas from any JSONL file, such as another repository's issues.jsonl
+or a generated catalog. merge combines each tanda with the local copy as a team
+pull does and removes nothing; replace makes the registry exactly the file.
+Tandas are checked as a team push checks them, and repeated IDs follow
+import.duplicates in config.yaml. A running daemon applies the import.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := sync.ParseImportMode(mode)
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			tandas, err := sync.ParseJSONL(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+			plan, err := importTandas(socketDir, rpc.ImportTandasParams{Tandas: tandas, Mode: m, DryRun: dryRun})
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Printf("Would add %d, update %d and remove %d tanda(s)\n", len(plan.Added), len(plan.Updated), len(plan.Removed))
+				printIDs("+", plan.Added)
+				printIDs("~", plan.Updated)
+				printIDs("-", plan.Removed)
+				return nil
+			}
+			fmt.Printf("Added %d, updated %d and removed %d tanda(s)\n", len(plan.Added), len(plan.Updated), len(plan.Removed))
+			return nil
+		},
+	}
+	importCmd.Flags().StringVar(&mode, "mode", string(sync.ImportMerge), "merge or replace")
+	importCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would change without writing")
+	importCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return importCmd
+}
+
+// importTandas has the running daemon apply the import, so it goes
+// through the write queue, or applies it to the registry directly when no
+// daemon is running
+func importTandas(dir string, params rpc.ImportTandasParams) (*sync.ImportPlan, error) {
+	var plan sync.ImportPlan
+	err := rpc.Call(dir, "import_tandas", params, &plan)
+	if !errors.Is(err, rpc.ErrNotRunning) {
+		if err != nil {
+			return nil, err
+		}
+		return &plan, nil
+	}
+
+	root, err := paths.Root(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range params.Tandas {
+		paths.NormalizeTanda(root, t)
+	}
+	store, syncer, err := openRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	result, err := sync.Import(store, params.Tandas, sync.ImportOptions{
+		Mode:       params.Mode,
+		DryRun:     params.DryRun,
+		Duplicates: syncer.Duplicates(),
+		Statuses:   loadWorkflow(dir),
+	})
+	if err != nil || params.DryRun || result.Empty() {
+		return result, err
+	}
+	return result, syncer.ExportToJSONL()
+}
+
+func printIDs(mark string, ids []string) {
+	for _, id := range ids {
+		fmt.Printf("  %s %s\n", mark, id)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/importer"
+)
+
+func newImportExternalCmd() *cobra.Command {
+	var format string
+	var dryRun bool
+	importCmd := &cobra.Command{
+		Use:   "import-external <source> <file>",
+		Short: "Import test cases from a TestRail, Xray or Zephyr export",
+		Long: "Import test cases from a test-management export. Sources: " +
+			strings.Join(importer.Sources(), ", ") + ". Re-running an import updates the tandas it created.",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			source, path := args[0], args[1]
+			if format == "" {
+				format = importer.FormatOf(path)
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			cases, err := importer.Parse(source, format, file)
+			if err != nil {
+				return err
+			}
+
+			store, syncer, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			now := time.Now().UTC().Format(time.RFC3339)
+			result, err := importer.Apply(store, source, cases, now, dryRun)
+			if err != nil {
+				return err
+			}
+			verb := "Imported"
+			if dryRun {
+				verb = "Would import"
+			}
+			fmt.Printf("%s %d case(s): %d created, %d updated, %d unchanged\n",
+				verb, len(cases), len(result.Created), len(result.Updated), result.Unchanged)
+			if dryRun || len(result.Created)+len(result.Updated) == 0 {
+				return nil
+			}
+			return syncer.ExportToJSONL()
+		},
+	}
+	importCmd.Flags().StringVar(&format, "format", "", "Export format: csv or json (default from the file extension)")
+	importCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would change without writing")
+	importCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return importCmd
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/scaffold"
+)
+
+func newInitCmd() *cobra.Command {
+	var withHooks, force bool
+	initCmd := &cobra.Command{
+		Use:          "init",
+		Short:        "Set up the Tandas directory, config and .gitignore for a new project",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			created, err := scaffold.Init(socketDir)
+			for _, name := range created {
+				fmt.Printf("Created %s\n", filepath.Join(socketDir, name))
+			}
+			if err != nil {
+				return err
+			}
+			if len(created) == 0 {
+				fmt.Printf("%s is already set up\n", socketDir)
+			}
+			if withHooks {
+				return installHooks(socketDir, force)
+			}
+			return nil
+		},
+	}
+	initCmd.Flags().BoolVar(&withHooks, "hooks", false, "Also install the git hooks")
+	initCmd.Flags().BoolVar(&force, "force", false, "With --hooks, overwrite hooks not managed by td-daemon")
+	initCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return initCmd
+}
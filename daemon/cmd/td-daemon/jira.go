@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/jira"
+)
+
+func newJiraCmd() *cobra.Command {
+	jiraCmd := &cobra.Command{
+		Use:   "jira",
+		Short: "Sync tandas with linked Jira tickets",
+	}
+
+	syncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Push status/flakiness to linked tickets and pull ticket status into notes",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(socketDir)
+			if err != nil {
+				return err
+			}
+			client, err := jira.New(cfg.Jira)
+			if err != nil {
+				return err
+			}
+
+			store, syncer, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			result, err := jira.Sync(context.Background(), store, client)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Commented on %d ticket(s), updated %d tanda(s)\n",
+				len(result.Commented), len(result.Updated))
+
+			if len(result.Updated) == 0 {
+				return nil
+			}
+			return syncer.ExportToJSONL()
+		},
+	}
+	syncCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+
+	jiraCmd.AddCommand(syncCmd)
+	return jiraCmd
+}
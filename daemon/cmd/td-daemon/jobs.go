@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func newJobsCmd() *cobra.Command {
+	var asJSON bool
+	jobsCmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "Show the daemon's scheduled jobs and their last runs",
+		Long: `List the maintenance jobs scheduled under jobs in config.yaml, when each
+runs next, and how its last run went.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var jobs []rpc.JobStatus
+			if err := rpc.Call(socketDir, "jobs", nil, &jobs); err != nil {
+				if errors.Is(err, rpc.ErrNotRunning) {
+					return fmt.Errorf("the daemon is not running; scheduled jobs run only in the daemon")
+				}
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(jobs)
+			}
+			if len(jobs) == 0 {
+				fmt.Println("No jobs scheduled")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "JOB\tSCHEDULE\tNEXT\tLAST RUN\tRESULT")
+			for _, j := range jobs {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", j.Name, j.Schedule,
+					j.Next.Local().Format("2006-01-02 15:04"), jobLastRun(j), jobResult(j))
+			}
+			return w.Flush()
+		},
+	}
+	jobsCmd.Flags().BoolVar(&asJSON, "json", false, "Print JSON")
+	jobsCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return jobsCmd
+}
+
+func jobLastRun(j rpc.JobStatus) string {
+	if j.LastRun == nil {
+		return "-"
+	}
+	return j.LastRun.Local().Format("2006-01-02 15:04") + " (" + j.Duration + ")"
+}
+
+func jobResult(j rpc.JobStatus) string {
+	switch {
+	case j.Running:
+		return "running"
+	case j.Error != "":
+		return "failed: " + j.Error
+	case j.LastRun == nil:
+		return "-"
+	}
+	return j.Result
+}
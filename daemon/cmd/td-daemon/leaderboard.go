@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/leaderboard"
+)
+
+func newLeaderboardCmd() *cobra.Command {
+	var opts leaderboard.Options
+	var asJSON bool
+	leaderboardCmd := &cobra.Command{
+		Use:   "leaderboard",
+		Short: "Rank the tandas failing the most, leaving out known offenders",
+		Long: `Rank the tandas that failed by failure rate, leaving out those acknowledged or
+marked wontfix in triage and those snoozed, so the list surfaces new problems
+instead of the same known offenders. Snooze a tanda for a number of days with
+triage:
+
+  td-daemon triage td-0042 --snooze 7
+  td-daemon triage td-0042 --snooze none   # wake it early
+
+--all lists the hidden tandas too. Goes through the daemon when it is running.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			board, err := runLeaderboard(socketDir, opts)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(board)
+			}
+
+			if len(board.Entries) == 0 {
+				fmt.Println("No failing tandas")
+			} else {
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "#\tID\tFAIL%\tFAIL/RUNS\tLAST FAILURE\tTRIAGE\tOWNERS\tTITLE")
+				for _, e := range board.Entries {
+					triage := orDash(e.Triage)
+					if e.SnoozedUntil != "" {
+						triage += " (snoozed)"
+					}
+					fmt.Fprintf(w, "%d\t%s\t%.0f%%\t%d/%d\t%s\t%s\t%s\t%s\n", e.Rank, e.ID, e.FailureRate*100,
+						e.Failures, e.Runs, e.LastFailure, triage, orDash(strings.Join(e.Owners, ",")), e.Title)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+			}
+			if h := board.Hidden; !opts.All && h.Acknowledged+h.Wontfix+h.Snoozed > 0 {
+				fmt.Printf("\nHidden: %d acknowledged, %d wontfix, %d snoozed (--all lists them)\n",
+					h.Acknowledged, h.Wontfix, h.Snoozed)
+			}
+			return nil
+		},
+	}
+	leaderboardCmd.Flags().IntVar(&opts.Days, "days", 0, "Count only runs of the last N days (0 = all)")
+	leaderboardCmd.Flags().IntVar(&opts.Limit, "limit", leaderboard.DefaultLimit, "List at most this many tandas (-1 = all)")
+	leaderboardCmd.Flags().BoolVar(&opts.All, "all", false, "Also list acknowledged, wontfix and snoozed tandas")
+	leaderboardCmd.Flags().BoolVar(&asJSON, "json", false, "Print the leaderboard as JSON")
+	leaderboardCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return leaderboardCmd
+}
+
+// runLeaderboard asks the daemon when it is running and reads the registry
+// otherwise
+func runLeaderboard(dir string, opts leaderboard.Options) (*leaderboard.Board, error) {
+	return callOrBuild(dir, "leaderboard", opts, func(tandas []*db.Tanda) (*leaderboard.Board, error) {
+		opts.Statuses = loadWorkflow(dir)
+		return leaderboard.Build(tandas, opts, time.Now()), nil
+	})
+}
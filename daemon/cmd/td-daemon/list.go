@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/db"
+)
+
+func newListCmd() *cobra.Command {
+	var filter db.Filter
+	var search string
+	var limit int
+	var asJSON bool
+	listCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List tandas in a table",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tandas, err := queryTandas(socketDir, filter)
+			if err != nil {
+				return err
+			}
+			tandas = matching(tandas, search)
+			sort.Slice(tandas, func(i, j int) bool { return tandas[i].ID < tandas[j].ID })
+			if limit > 0 && len(tandas) > limit {
+				tandas = tandas[:limit]
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(tandas)
+			}
+			if len(tandas) == 0 {
+				fmt.Println("No tandas")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tSTATUS\tPRIORITY\tTRIAGE\tLAST RUN\tRUNS\tOWNERS\tTITLE")
+			for _, t := range tandas {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", t.ID, t.Status, orDash(t.Priority), orDash(t.Triage),
+					lastRun(t), len(t.RunHistory), orDash(strings.Join(t.Owners, ",")), t.Title)
+			}
+			return w.Flush()
+		},
+	}
+	listCmd.Flags().StringVar(&filter.Status, "status", "", "Only tandas with this status")
+	listCmd.Flags().StringVar(&filter.Owner, "owner", "", "Only tandas with this owner")
+	listCmd.Flags().StringVar(&filter.Priority, "priority", "", "Only tandas with this priority (p0-p3)")
+	listCmd.Flags().StringVar(&filter.Triage, "triage", "", "Only tandas in this triage state")
+	listCmd.Flags().DurationVar(&filter.SlowerThan, "slower-than", 0, "Only tandas whose p95 duration is at least this long, e.g. 30s")
+	listCmd.Flags().StringVar(&search, "search", "", "Only tandas whose ID, title or file contains this text")
+	listCmd.Flags().IntVar(&limit, "limit", 0, "Show at most this many tandas")
+	listCmd.Flags().BoolVar(&asJSON, "json", false, "Print tandas as JSON")
+	listCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return listCmd
+}
+
+func newShowCmd() *cobra.Command {
+	var runs int
+	var asJSON bool
+	showCmd := &cobra.Command{
+		Use:          "show <id>",
+		Short:        "Show a tanda with its notes and recent runs",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := getTanda(socketDir, args[0])
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(t)
+			}
+			printTanda(t, runs)
+			return nil
+		},
+	}
+	showCmd.Flags().IntVar(&runs, "runs", 10, "Show this many of the most recent runs")
+	showCmd.Flags().BoolVar(&asJSON, "json", false, "Print the tanda as JSON")
+	showCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return showCmd
+}
+
+func printTanda(t *db.Tanda, runs int) {
+	fmt.Printf("%s  %s\n", t.ID, t.Title)
+	fmt.Printf("Status:   %s\n", t.Status)
+	fmt.Printf("File:     %s\n", orDash(t.File))
+	fmt.Printf("Owners:   %s\n", orDash(strings.Join(t.Owners, ", ")))
+	fmt.Printf("Priority: %s\n", orDash(t.Priority))
+	fmt.Printf("Triage:   %s\n", orDash(t.Triage))
+	if t.SnoozedUntil != "" {
+		fmt.Printf("Snoozed:  until %s\n", t.SnoozedUntil)
+	}
+	if d := t.Durations(); d.Runs > 0 {
+		fmt.Printf("Duration: p50 %s, p95 %s over %d run(s)\n", d.P50, d.P95, d.Runs)
+	}
+	fmt.Printf("Covers:   %s\n", orDash(strings.Join(t.Covers, ", ")))
+	fmt.Printf("Depends:  %s\n", orDash(strings.Join(t.DependsOn, ", ")))
+	fmt.Printf("Refs:     %s\n", orDash(strings.Join(t.ExternalRefs, ", ")))
+	fmt.Printf("Created:  %s\n", orDash(t.CreatedAt))
+	fmt.Printf("Updated:  %s\n", orDash(t.UpdatedAt))
+
+	if len(t.Refs) > 0 {
+		fmt.Printf("\nLinks (%d):\n", len(t.Refs))
+		for _, r := range t.Refs {
+			fmt.Printf("  %s\n", r)
+		}
+	}
+
+	if len(t.Notes) == 0 {
+		fmt.Println("\nNo notes")
+	} else {
+		fmt.Printf("\nNotes (%d):\n", len(t.Notes))
+		for _, n := range db.Thread(t.Notes) {
+			indent := strings.Repeat("    ", n.Depth)
+			text := n.Text
+			if n.Author != "" {
+				text = n.Author + ": " + text
+			}
+			fmt.Printf("  %s%s  %s [%s] %s\n", indent, n.Timestamp, n.Key(), n.Type, text)
+			for _, a := range n.Attachments {
+				fmt.Printf("  %s    attached %s\n", indent, formatAttachment(a))
+			}
+		}
+	}
+
+	if len(t.RunHistory) == 0 {
+		fmt.Println("\nNo runs")
+		return
+	}
+	recent := t.RunHistory
+	if runs > 0 && len(recent) > runs {
+		recent = recent[len(recent)-runs:]
+	}
+	fmt.Printf("\nRecent runs (%d of %d):\n", len(recent), len(t.RunHistory))
+	for i := len(recent) - 1; i >= 0; i-- {
+		r := recent[i]
+		line := fmt.Sprintf("  %s  %-5s", r.Timestamp, r.Result)
+		if r.Duration != "" {
+			line += "  " + r.Duration
+		}
+		if r.Commit != "" {
+			line += "  commit: " + shortSHA(r.Commit)
+		}
+		if r.Trace != "" {
+			line += "  trace: " + r.Trace
+		}
+		if s := r.Summary; s != nil {
+			line += fmt.Sprintf("  daily summary: %d run(s), %d failed", s.Runs, s.Failures)
+		}
+		fmt.Println(line)
+		if r.Error != "" {
+			fmt.Printf("      %s\n", r.Error)
+		}
+	}
+}
+
+// matching keeps the tandas whose ID, title or file contains text, ignoring
+// case
+func matching(tandas []*db.Tanda, text string) []*db.Tanda {
+	if text == "" {
+		return tandas
+	}
+	text = strings.ToLower(text)
+	var out []*db.Tanda
+	for _, t := range tandas {
+		if strings.Contains(strings.ToLower(t.ID+"\n"+t.Title+"\n"+t.File), text) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// lastRun describes a tanda's newest run as "result date"
+func lastRun(t *db.Tanda) string {
+	if len(t.RunHistory) == 0 {
+		return "-"
+	}
+	r := t.RunHistory[len(t.RunHistory)-1]
+	date := r.Timestamp
+	if len(date) > 10 {
+		date = date[:10]
+	}
+	return strings.TrimSpace(r.Result + " " + date)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/logging"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func newLogsCmd() *cobra.Command {
+	var level string
+	var lines int
+	var asJSON bool
+	logsCmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Print the daemon's recent log records",
+		Long: `Print the last --lines log records the running daemon keeps in memory, at or
+above --level. They are there even when the daemon's log output was not
+kept or its log file was rotated away. --json prints one record per line.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var records []logging.Record
+			err := rpc.Call(socketDir, "logs", rpc.LogsParams{Level: level, Limit: lines}, &records)
+			if errors.Is(err, rpc.ErrNotRunning) {
+				return fmt.Errorf("daemon not running; its recent logs are kept in memory only")
+			}
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(os.Stdout)
+			for _, r := range records {
+				if asJSON {
+					if err := enc.Encode(r); err != nil {
+						return err
+					}
+					continue
+				}
+				fmt.Println(formatRecord(r))
+			}
+			return nil
+		},
+	}
+	logsCmd.Flags().StringVar(&level, "level", "info", "Only print records at or above this level: debug, info, warn or error")
+	logsCmd.Flags().IntVarP(&lines, "lines", "n", 100, "Print at most this many records")
+	logsCmd.Flags().BoolVar(&asJSON, "json", false, "Print records as JSON lines")
+	logsCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return logsCmd
+}
+
+// formatRecord renders a record as "time  LEVEL  message  key=value ..."
+func formatRecord(r logging.Record) string {
+	parts := []string{r.Time.Local().Format("2006-01-02 15:04:05"), fmt.Sprintf("%-5s", r.Level), r.Message}
+	keys := make([]string, 0, len(r.Attrs))
+	for k := range r.Attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, r.Attrs[k]))
+	}
+	return strings.Join(parts, "  ")
+}
@@ -3,15 +3,19 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
 
 	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/logging"
 	"github.com/tandas/daemon/internal/rpc"
 )
 
 var (
-	version   = "0.2.0"
+	version   = rpc.Version
 	interval  = "5s"
 	socketDir = ".tandas"
+	logLevel  = "info"
+	logFormat = logging.Text
 )
 
 func main() {
@@ -19,17 +23,29 @@ func main() {
 		Use:     "td-daemon",
 		Short:   "Tandas background daemon for JSONL/SQLite sync",
 		Version: version,
+		// Logs go to stderr so command output on stdout stays clean
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return logging.Setup(os.Stderr, logLevel, logFormat)
+		},
 	}
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", logLevel, "Log level: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logFormat, "Log format: text or json")
 
+	var startOpts rpc.StartOptions
 	startCmd := &cobra.Command{
 		Use:   "start",
 		Short: "Start the daemon",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return rpc.StartDaemon(socketDir, interval)
+			return rpc.StartDaemon(socketDir, interval, startOpts)
 		},
 	}
 	startCmd.Flags().StringVar(&interval, "interval", "5s", "Sync interval")
 	startCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	startCmd.Flags().BoolVar(&startOpts.Server, "server", false, "Run as a team server accepting pushes over TCP")
+	startCmd.Flags().StringVar(&startOpts.Listen, "listen", "", "TCP address for team server mode (default "+rpc.DefaultTeamAddr+"), or tcp://127.0.0.1:0 for a local listener")
+	startCmd.Flags().StringVar(&startOpts.Follow, "follow", "", "Replicate a leader's registry read-only (host:port or tls://host:port)")
+	startCmd.Flags().StringVar(&startOpts.Debug, "debug-addr", "", "Serve pprof profiles on a localhost address, e.g. localhost:6060")
+	startCmd.Flags().BoolVar(&startOpts.ExitWithParent, "exit-with-parent", false, "Exit when the process that started the daemon exits, e.g. an editor")
 
 	stopCmd := &cobra.Command{
 		Use:   "stop",
@@ -40,13 +56,25 @@ func main() {
 	}
 	stopCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
 
+	var watchFlag bool
 	statusCmd := &cobra.Command{
 		Use:   "status",
 		Short: "Check daemon status",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if watchFlag {
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+				defer stop()
+				return watchStatus(ctx, os.Stdout, socketDir, watchInterval)
+			}
 			running, pid := rpc.DaemonStatus(socketDir)
 			if running {
 				fmt.Printf("Daemon running (PID: %d)\n", pid)
+				if lock, err := rpc.ReadLockFile(socketDir); err == nil && !lock.Startup.OK() {
+					fmt.Println("Degraded since startup:")
+					for _, d := range lock.Startup.Degraded {
+						fmt.Printf("  %s: %s\n", d.Subsystem, d.Reason)
+					}
+				}
 			} else {
 				fmt.Println("Daemon not running")
 			}
@@ -54,8 +82,57 @@ func main() {
 		},
 	}
 	statusCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	statusCmd.Flags().BoolVar(&watchFlag, "watch", false, "Redraw sync health, inbox and recent errors every second")
 
 	rootCmd.AddCommand(startCmd, stopCmd, statusCmd)
+	rootCmd.AddCommand(
+		newCICmd(),
+		newJiraCmd(),
+		newDigestCmd(),
+		newHooksCmd(),
+		newOwnersCmd(),
+		newCoversCmd(),
+		newTrendCmd(),
+		newClustersCmd(),
+		newGraphCmd(),
+		newGapsCmd(),
+		newStaleCmd(),
+		newReportCmd(),
+		newExportCmd(),
+		newRemoteCmd(),
+		newTeamCmd(),
+		newSnapshotCmd(),
+		newImportExternalCmd(),
+		newMirrorCmd(),
+		newPeerPushCmd(),
+		newPeerPullCmd(),
+		newSchemaCmd(),
+		newDoctorCmd(),
+		newInitCmd(),
+		newImportCmd(),
+		newPruneCmd(),
+		newCompactCmd(),
+		newListCmd(),
+		newShowCmd(),
+		newTailCmd(),
+		newProgressCmd(),
+		newJobsCmd(),
+		newLogsCmd(),
+		newRunCmd(),
+		newImpactedCmd(),
+		newHeatmapCmd(),
+		newEnvironmentsCmd(),
+		newLeaderboardCmd(),
+		newBurndownCmd(),
+		newDiffCmd(),
+		newBisectCmd(),
+		newBadgeCmd(),
+		newGateCmd(),
+		newOrderCmd(),
+		newTriageCmd(),
+		newNoteCmd(),
+		newAttachmentCmd(),
+	)
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/mirror"
+)
+
+func newMirrorCmd() *cobra.Command {
+	var dsn string
+	mirrorCmd := &cobra.Command{
+		Use:          "mirror",
+		Short:        "Copy tandas and run history to the Postgres mirror",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(socketDir)
+			if err != nil {
+				return err
+			}
+			pgCfg := cfg.Mirror.Postgres
+			if dsn != "" {
+				pgCfg.DSN = dsn
+			}
+			if pgCfg.DSN == "" {
+				return fmt.Errorf("no Postgres DSN: set mirror.postgres.dsn in %s or pass --dsn", config.FileName)
+			}
+
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			tandas, err := store.GetAllTandas()
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+			repo := mirror.RepoName(socketDir, pgCfg)
+			pg, err := mirror.OpenPostgres(ctx, pgCfg, repo)
+			if err != nil {
+				return err
+			}
+			defer pg.Close()
+			stats, err := pg.Sync(ctx, tandas)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Mirrored %d tanda(s) and %d run(s) for %s; removed %d\n",
+				stats.Tandas, stats.Runs, repo, stats.Deleted)
+			return nil
+		},
+	}
+	mirrorCmd.Flags().StringVar(&dsn, "dsn", "", "Postgres connection string (overrides config)")
+	mirrorCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return mirrorCmd
+}
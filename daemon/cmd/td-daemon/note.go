@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/blobs"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func newNoteCmd() *cobra.Command {
+	var params rpc.AddNoteParams
+	var attach []string
+	noteCmd := &cobra.Command{
+		Use:   "note <id> [text]",
+		Short: "Add a note or a reply to a tanda, with files attached",
+		Long: `Add a note to a tanda, signed by the author setting in config.yaml or
+else git config user.name. --reply answers the note with that ID, as
+td-daemon show lists it, starting a discussion thread. --attach stores a file, such as a screenshot or a log
+excerpt, under .tandas/blobs by its SHA-256 and references it from the note,
+so the evidence is committed with the registry. Each file may be up to
+storage.max_attachment_bytes (default 1 MiB); trim logs to the relevant part.
+
+  td-daemon note td-0042 "fails after session refresh" --attach shot.png --attach tail.log
+  td-daemon note td-0042 "fixed by #512" --reply n-3f9a1c20
+
+Attachments no note references any more are deleted by td-daemon compact.
+The daemon must be running.`,
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params.ID = args[0]
+			if len(args) == 2 {
+				params.Text = args[1]
+			}
+			if params.Text == "" && len(attach) == 0 {
+				return errors.New("give the note text or an --attach file")
+			}
+			var max int64
+			if cfg, err := config.Load(socketDir); err == nil {
+				max = cfg.Storage.MaxAttachmentBytes
+				if params.Author == "" {
+					params.Author = cfg.Author
+				}
+			}
+			if params.Author == "" {
+				params.Author = gitUserName(socketDir)
+			}
+			for _, path := range attach {
+				a, err := storeAttachment(socketDir, path, max)
+				if err != nil {
+					return err
+				}
+				params.Attachments = append(params.Attachments, a)
+			}
+
+			var t db.Tanda
+			if err := rpc.Call(socketDir, "add_note", params, &t); err != nil {
+				if errors.Is(err, rpc.ErrNotRunning) {
+					return errors.New("daemon is not running; start it with td-daemon start")
+				}
+				return err
+			}
+			fmt.Printf("Added a note to %s", t.ID)
+			if len(params.Attachments) > 0 {
+				fmt.Printf(" with %d attachment(s)", len(params.Attachments))
+			}
+			fmt.Println()
+			return nil
+		},
+	}
+	noteCmd.Flags().StringArrayVar(&attach, "attach", nil, "Attach a file (repeatable)")
+	noteCmd.Flags().StringVar(&params.Type, "type", "note", "Note type")
+	noteCmd.Flags().StringVar(&params.Parent, "reply", "", "Reply to the note with this ID")
+	noteCmd.Flags().StringVar(&params.Author, "author", "", "Sign the note as this author")
+	noteCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return noteCmd
+}
+
+// gitUserName returns git config user.name for the repository holding dir,
+// or "" when it is not set
+func gitUserName(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "config", "user.name").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func storeAttachment(dir, path string, max int64) (db.Attachment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return db.Attachment{}, err
+	}
+	defer f.Close()
+	return blobs.Put(dir, path, f, max)
+}
+
+func newAttachmentCmd() *cobra.Command {
+	var output string
+	attachmentCmd := &cobra.Command{
+		Use:   "attachment <hash>",
+		Short: "Write a note attachment to stdout or a file",
+		Long: `Write the attachment with the given hash, as td-daemon show lists it
+(sha256:...), to stdout or to --output.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := blobs.Path(socketDir, args[0])
+			if err != nil {
+				return err
+			}
+			in, err := os.Open(path)
+			if os.IsNotExist(err) {
+				return fmt.Errorf("attachment %s is not stored", args[0])
+			}
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+
+			out := os.Stdout
+			if output != "" {
+				if out, err = os.Create(output); err != nil {
+					return err
+				}
+				defer out.Close()
+			}
+			_, err = io.Copy(out, in)
+			return err
+		},
+	}
+	attachmentCmd.Flags().StringVarP(&output, "output", "o", "", "Write to this file")
+	attachmentCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return attachmentCmd
+}
+
+// formatAttachment renders an attachment as show lists it
+func formatAttachment(a db.Attachment) string {
+	parts := []string{fmt.Sprintf("%d bytes", a.Size)}
+	if a.Type != "" {
+		parts = append(parts, a.Type)
+	}
+	return fmt.Sprintf("%s (%s) %s", a.Name, strings.Join(parts, ", "), a.Hash)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/graph"
+)
+
+func newOrderCmd() *cobra.Command {
+	var includeDeps, asJSON bool
+	orderCmd := &cobra.Command{
+		Use:   "order [id...]",
+		Short: "Order tandas by depends_on into waves that can run in parallel",
+		Long: `Sort the given tandas, or all but retired ones, so each runs after what it
+depends on, grouped into waves whose tandas don't depend on each other.
+Tandas in a dependency cycle, or depending on one, are reported as blocked.
+Dependencies left out of the set are assumed to have run; --include-deps
+schedules them too.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			tandas, err := store.GetAllTandas()
+			if err != nil {
+				return err
+			}
+			s, err := graph.Waves(tandas, loadWorkflow(socketDir), args, includeDeps)
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(s)
+			}
+			for i, w := range s.Waves {
+				fmt.Printf("Wave %d: %s\n", i+1, strings.Join(w, " "))
+			}
+			if len(s.Blocked) > 0 {
+				fmt.Printf("Blocked: %s\n", strings.Join(s.Blocked, " "))
+			}
+			for _, c := range s.Cycles {
+				fmt.Printf("Cycle: %s\n", strings.Join(c, ", "))
+			}
+			if len(s.External) > 0 {
+				fmt.Printf("Assumed done: %s\n", strings.Join(s.External, " "))
+			}
+			if len(s.Missing) > 0 {
+				fmt.Printf("Missing dependencies: %s\n", strings.Join(s.Missing, " "))
+			}
+			return nil
+		},
+	}
+	orderCmd.Flags().BoolVar(&includeDeps, "include-deps", false, "Also schedule the tandas' dependencies")
+	orderCmd.Flags().BoolVar(&asJSON, "json", false, "Print the schedule as JSON")
+	orderCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return orderCmd
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/owners"
+)
+
+func newOwnersCmd() *cobra.Command {
+	var noBlame bool
+	ownersCmd := &cobra.Command{
+		Use:   "owners",
+		Short: "Attribute tandas to owners from CODEOWNERS and git blame",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, _, err := projectPaths(socketDir)
+			if err != nil {
+				return err
+			}
+			resolver, err := owners.NewResolver(root, !noBlame)
+			if err != nil {
+				return err
+			}
+
+			store, syncer, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			updated, err := owners.Enrich(store, resolver)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Updated owners on %d tanda(s)\n", len(updated))
+
+			if len(updated) == 0 {
+				return nil
+			}
+			return syncer.ExportToJSONL()
+		},
+	}
+	ownersCmd.Flags().BoolVar(&noBlame, "no-blame", false, "Only use CODEOWNERS, never git blame")
+	ownersCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return ownersCmd
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/peer"
+	"github.com/tandas/daemon/internal/rpc"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+func newPeerPushCmd() *cobra.Command {
+	var full bool
+	pushCmd := &cobra.Command{
+		Use:          "push <peer>",
+		Short:        "Send tandas changed since the last sync to a peer's listener",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, state, err := peerClient(args[0])
+			if err != nil {
+				return err
+			}
+			mark := state[client.Addr]
+			since := mark.PushedAsOf
+			if full {
+				since = ""
+			}
+
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			asOf := peer.Now()
+			tandas, err := store.GetAllTandas()
+			if err != nil {
+				return err
+			}
+			delta := peer.ChangedSince(tandas, since)
+
+			if len(delta) > 0 {
+				var result rpc.PushResult
+				host, _ := os.Hostname()
+				if err := client.Call("push", rpc.PushParams{Source: host, Tandas: delta}, &result); err != nil {
+					return err
+				}
+				fmt.Printf("Sent %d tanda(s) to %s; %d changed there\n", len(delta), args[0], len(result.Changed))
+			} else {
+				fmt.Printf("Nothing to send to %s\n", args[0])
+			}
+			mark.PushedAsOf = asOf
+			state[client.Addr] = mark
+			return state.Save(socketDir)
+		},
+	}
+	peerFlags(pushCmd, &full)
+	return pushCmd
+}
+
+func newPeerPullCmd() *cobra.Command {
+	var full bool
+	pullCmd := &cobra.Command{
+		Use:          "pull <peer>",
+		Short:        "Merge tandas a peer changed since the last sync",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, state, err := peerClient(args[0])
+			if err != nil {
+				return err
+			}
+			mark := state[client.Addr]
+			params := rpc.DeltaParams{Since: mark.PulledAsOf}
+			if full {
+				params.Since = ""
+			}
+			var result rpc.DeltaResult
+			if err := client.Call("delta", params, &result); err != nil {
+				return err
+			}
+
+			store, syncer, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			changed, err := sync.MergeInto(store, result.Tandas)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Received %d tanda(s) from %s; merged %d\n", len(result.Tandas), args[0], len(changed))
+			if len(changed) > 0 {
+				if err := syncer.ExportToJSONL(); err != nil {
+					return err
+				}
+			}
+			mark.PulledAsOf = result.AsOf
+			state[client.Addr] = mark
+			return state.Save(socketDir)
+		},
+	}
+
+	peerFlags(pullCmd, &full)
+	return pullCmd
+}
+
+func peerFlags(c *cobra.Command, full *bool) {
+	c.Flags().BoolVar(full, "full", false, "Ignore the last sync point and exchange every tanda")
+	c.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	c.Flags().StringVar(&teamToken, "token", "", "Bearer token (default $"+teamTokenEnv+" or team.token)")
+}
+
+// peerClient resolves a peer name from config peers, or takes an address
+func peerClient(nameOrAddr string) (*rpc.TeamClient, peer.State, error) {
+	cfg, err := config.Load(socketDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	addr := nameOrAddr
+	if a, ok := cfg.Peers[nameOrAddr]; ok {
+		addr = a
+	} else if !strings.Contains(nameOrAddr, ":") {
+		return nil, nil, fmt.Errorf("unknown peer %q (add it under peers in %s or give host:port)", nameOrAddr, config.FileName)
+	}
+	client, err := dialTeam(cfg, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := peer.Load(socketDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, state, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func newProgressCmd() *cobra.Command {
+	var p rpc.ProgressParams
+	progressCmd := &cobra.Command{
+		Use:   "progress",
+		Short: "Report test runner progress to the daemon without waiting for a reply",
+		Long: `Send a progress notification for a test runner, shown by status --watch and
+tail. The daemon does not reply, so this returns as soon as the message is
+sent; it fails only when no daemon is running.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if p.Runner == "" {
+				p.Runner, _ = os.Hostname()
+			}
+			return rpc.Notify(socketDir, "progress", p)
+		},
+	}
+	progressCmd.Flags().StringVar(&p.Runner, "runner", "", "Runner name (default: the hostname)")
+	progressCmd.Flags().StringVar(&p.TandaID, "tanda", "", "Tanda being run")
+	progressCmd.Flags().IntVar(&p.Done, "done", 0, "Tests finished so far")
+	progressCmd.Flags().IntVar(&p.Total, "total", 0, "Tests in the run")
+	progressCmd.Flags().StringVar(&p.Message, "message", "", "Short status message")
+	progressCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return progressCmd
+}
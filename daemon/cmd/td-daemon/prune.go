@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/prune"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func newPruneCmd() *cobra.Command {
+	var dryRun bool
+	var keepRuns, keepDays, noteDays, failureDays int
+	var downsample bool
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Trim old run history and notes, archiving them to archive.jsonl",
+		Long: `Trim each tanda's run history to the newest --keep-runs runs and drop runs
+older than --keep-days and notes older than --note-days. Failures under
+--keep-failures-days old are kept regardless, and --downsample leaves one
+summary per day of the runs dropped. Limits not given on the command line come
+from the prune section of config.yaml; doctor shows the configured policy.
+Everything removed is appended to .tandas/archive.jsonl first.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(socketDir)
+			if err != nil {
+				return err
+			}
+			opts := prune.FromConfig(cfg.Prune)
+			if cmd.Flags().Changed("keep-runs") {
+				opts.KeepRuns = keepRuns
+			}
+			if cmd.Flags().Changed("keep-days") {
+				opts.KeepDays = keepDays
+			}
+			if cmd.Flags().Changed("note-days") {
+				opts.NoteDays = noteDays
+			}
+			if cmd.Flags().Changed("keep-failures-days") {
+				opts.FailureDays = failureDays
+			}
+			if cmd.Flags().Changed("downsample") {
+				opts.Downsample = downsample
+			}
+
+			result, err := runPrune(socketDir, opts, dryRun)
+			if err != nil {
+				return err
+			}
+			verb := "Pruned"
+			if dryRun {
+				verb = "Would prune"
+			}
+			fmt.Printf("%s %d run(s) and %d note(s) from %d tanda(s)\n", verb, result.Runs, result.Notes, result.Tandas)
+			if result.Downsampled > 0 {
+				fmt.Printf("%d of the runs kept in daily summaries\n", result.Downsampled)
+			}
+			return nil
+		},
+	}
+	pruneCmd.Flags().IntVar(&keepRuns, "keep-runs", 0, "Keep at most this many runs per tanda")
+	pruneCmd.Flags().IntVar(&keepDays, "keep-days", 0, "Drop runs older than this many days")
+	pruneCmd.Flags().IntVar(&noteDays, "note-days", 0, "Drop notes older than this many days")
+	pruneCmd.Flags().IntVar(&failureDays, "keep-failures-days", 0, "Keep failed runs newer than this many days regardless")
+	pruneCmd.Flags().BoolVar(&downsample, "downsample", false, "Keep a summary per day of the runs dropped")
+	pruneCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be pruned without writing")
+	pruneCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return pruneCmd
+}
+
+// runPrune prunes through the daemon when it is running, so its database
+// and issues.jsonl stay in step, and directly otherwise
+func runPrune(dir string, opts prune.Options, dryRun bool) (*prune.Result, error) {
+	if opts.Empty() {
+		return nil, fmt.Errorf("no prune limits set; pass --keep-runs, --keep-days or --note-days, or configure prune in config.yaml")
+	}
+	var result prune.Result
+	err := rpc.Call(dir, "prune", rpc.PruneParams{Options: opts, DryRun: dryRun}, &result)
+	if !errors.Is(err, rpc.ErrNotRunning) {
+		return &result, err
+	}
+
+	store, syncer, err := openRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	r, err := prune.Run(store, filepath.Join(dir, prune.ArchiveFile), opts, time.Now(), dryRun)
+	if err != nil || dryRun || r.Tandas == 0 {
+		return r, err
+	}
+	return r, syncer.ExportToJSONL()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rpc"
+	"github.com/tandas/daemon/internal/snapshot"
+	"github.com/tandas/daemon/internal/sync"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// openRegistry opens the SQLite cache for one-shot commands and refreshes
+// it from issues.jsonl, which stays the source of truth. Callers that
+// mutate tandas must call syncer.ExportToJSONL before closing the store.
+func openRegistry(dir string) (*db.Store, *sync.Syncer, error) {
+	store, _, err := snapshot.OpenDB(dir, time.Now())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	syncer := sync.New(store, filepath.Join(dir, "issues.jsonl"))
+	if cfg, err := config.Load(dir); err == nil {
+		store.SetCompression(cfg.Storage.Compress)
+		syncer.SetMaxLineBytes(cfg.Import.MaxLineBytes)
+		policy, err := sync.ParseDuplicatePolicy(cfg.Import.Duplicates)
+		if err != nil {
+			slog.Warn("Invalid duplicate policy; keeping the later line", "err", err)
+		} else {
+			syncer.SetDuplicatePolicy(policy)
+		}
+		if statuses, err := workflow.New(cfg.Statuses); err != nil {
+			slog.Warn("Invalid statuses; using the defaults", "err", err)
+		} else {
+			syncer.SetWorkflow(statuses)
+		}
+	}
+
+	if err := syncer.ImportFromJSONL(); err != nil {
+		store.Close()
+		return nil, nil, fmt.Errorf("failed to import JSONL: %w", err)
+	}
+
+	return store, syncer, nil
+}
+
+// loadWorkflow returns the configured statuses, or nil, meaning the
+// defaults, when config.yaml or its statuses are invalid
+func loadWorkflow(dir string) *workflow.Workflow {
+	cfg, err := config.Load(dir)
+	if err != nil {
+		return nil
+	}
+	statuses, err := workflow.New(cfg.Statuses)
+	if err != nil {
+		return nil
+	}
+	return statuses
+}
+
+// queryTandas returns the tandas matching filter from the running daemon,
+// or from the registry directly when no daemon is running
+func queryTandas(dir string, filter db.Filter) ([]*db.Tanda, error) {
+	var tandas []*db.Tanda
+	if err := rpc.Call(dir, "query", filter, &tandas); !errors.Is(err, rpc.ErrNotRunning) {
+		return tandas, err
+	}
+
+	store, _, err := openRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return store.QueryTandas(filter)
+}
+
+// getTanda returns one tanda from the running daemon, or from the
+// registry when no daemon is running
+func getTanda(dir, id string) (*db.Tanda, error) {
+	var t *db.Tanda
+	if err := rpc.Call(dir, "get", map[string]string{"id": id}, &t); !errors.Is(err, rpc.ErrNotRunning) {
+		return t, err
+	}
+
+	store, _, err := openRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	t, err = store.GetTanda(id)
+	if err == nil && t == nil {
+		err = fmt.Errorf("tanda %s not found", id)
+	}
+	return t, err
+}
+
+// callOrBuild returns the result of method from the running daemon, or,
+// when no daemon is running, builds it from the registry's tandas
+func callOrBuild[T any](dir, method string, params interface{}, build func([]*db.Tanda) (*T, error)) (*T, error) {
+	var result T
+	if err := rpc.Call(dir, method, params, &result); !errors.Is(err, rpc.ErrNotRunning) {
+		if err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+
+	store, _, err := openRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		return nil, err
+	}
+	return build(tandas)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/remote"
+)
+
+func newRemoteCmd() *cobra.Command {
+	remoteCmd := &cobra.Command{
+		Use:   "remote",
+		Short: "Push and pull the registry over SSH",
+	}
+
+	pullCmd := &cobra.Command{
+		Use:   "pull <remote>",
+		Short: "Merge a remote registry into the local one",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveRemote(args[0])
+			if err != nil {
+				return err
+			}
+			return pullRemote(context.Background(), target)
+		},
+	}
+
+	var force bool
+	pushCmd := &cobra.Command{
+		Use:   "push <remote>",
+		Short: "Upload the local registry to a remote",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveRemote(args[0])
+			if err != nil {
+				return err
+			}
+			return pushRemote(context.Background(), target, force)
+		},
+	}
+	pushCmd.Flags().BoolVar(&force, "force", false, "Overwrite remote changes that are not present locally")
+
+	syncCmd := &cobra.Command{
+		Use:   "sync <remote>",
+		Short: "Pull, merge, then push",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveRemote(args[0])
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			if err := pullRemote(ctx, target); err != nil {
+				return err
+			}
+			return pushRemote(ctx, target, false)
+		},
+	}
+
+	for _, c := range []*cobra.Command{pullCmd, pushCmd, syncCmd} {
+		c.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+		remoteCmd.AddCommand(c)
+	}
+	return remoteCmd
+}
+
+// resolveRemote accepts an ssh:// URL or a name from config remotes
+func resolveRemote(nameOrURL string) (*remote.Target, error) {
+	if strings.Contains(nameOrURL, "://") {
+		return remote.Parse(nameOrURL)
+	}
+	cfg, err := config.Load(socketDir)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := cfg.Remotes[nameOrURL]
+	if !ok {
+		return nil, fmt.Errorf("unknown remote %q (add it under remotes in %s)", nameOrURL, config.FileName)
+	}
+	return remote.Parse(raw)
+}
+
+func pullRemote(ctx context.Context, target *remote.Target) error {
+	store, syncer, err := openRegistry(socketDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	changed, err := remote.Pull(ctx, target, store)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		fmt.Printf("Already up to date with %s\n", target)
+		return nil
+	}
+	fmt.Printf("Merged %d tanda(s) from %s\n", len(changed), target)
+	return syncer.ExportToJSONL()
+}
+
+func pushRemote(ctx context.Context, target *remote.Target, force bool) error {
+	pushed, err := remote.Push(ctx, target, filepath.Join(socketDir, "issues.jsonl"), force)
+	if err != nil {
+		return err
+	}
+	if pushed {
+		fmt.Printf("Pushed to %s\n", target)
+	} else {
+		fmt.Printf("%s is up to date\n", target)
+	}
+	return nil
+}
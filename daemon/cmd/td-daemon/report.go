@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/report"
+)
+
+func newReportCmd() *cobra.Command {
+	var htmlDir string
+	reportCmd := &cobra.Command{
+		Use:   "report",
+		Short: "Generate a static report of the registry",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if htmlDir == "" {
+				return fmt.Errorf("--html is required")
+			}
+			root, _, err := projectPaths(socketDir)
+			if err != nil {
+				return err
+			}
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			tandas, err := store.GetAllTandas()
+			if err != nil {
+				return err
+			}
+			path, err := report.WriteHTML(report.Build(tandas, time.Now()), htmlDir, root)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Wrote %s\n", path)
+			return nil
+		},
+	}
+	reportCmd.Flags().StringVar(&htmlDir, "html", "", "Write a self-contained HTML report into this directory")
+	reportCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return reportCmd
+}
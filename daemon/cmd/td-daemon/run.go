@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func newRunCmd() *cobra.Command {
+	var params rpc.RunParams
+	var detach, asJSON bool
+	runCmd := &cobra.Command{
+		Use:   "run [id...]",
+		Short: "Run the tests of selected tandas and record the results",
+		Long: `Have the daemon run the tests of the given tandas, or of those with --status
+or whose last run failed (--failing), using the runners in config.yaml. Each
+tanda goes to the runner named by --runner, or else to the first runner whose
+match globs its file. Output is streamed as the commands run and the results
+are recorded against the tandas when each command finishes.
+
+Ctrl-C cancels the run and kills its commands; --detach starts the run and
+returns, leaving it to finish in the daemon.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params.IDs = args
+			var st rpc.RunStatus
+			if err := rpc.Call(socketDir, "run", params, &st); err != nil {
+				return err
+			}
+			if detach {
+				return printRunStatus(st, asJSON)
+			}
+
+			interrupt := make(chan os.Signal, 1)
+			signal.Notify(interrupt, os.Interrupt)
+			defer signal.Stop(interrupt)
+			go func() {
+				<-interrupt
+				fmt.Fprintln(os.Stderr, "Cancelling run...")
+				rpc.Call(socketDir, "run_cancel", rpc.RunCancelParams{ID: st.ID}, nil)
+			}()
+
+			since := 0
+			for {
+				var out rpc.RunOutputResult
+				if err := rpc.Call(socketDir, "run_output", rpc.RunOutputParams{ID: st.ID, Since: since, Wait: tailWait}, &out); err != nil {
+					if errors.Is(err, rpc.ErrNotRunning) {
+						return errors.New("daemon stopped during the run")
+					}
+					return err
+				}
+				for _, line := range out.Lines {
+					if asJSON {
+						fmt.Fprintln(os.Stderr, line)
+					} else {
+						fmt.Println(line)
+					}
+				}
+				since = out.Next
+				if out.Run.State != rpc.RunRunning && len(out.Lines) == 0 {
+					st = out.Run
+					break
+				}
+			}
+			if err := printRunStatus(st, asJSON); err != nil {
+				return err
+			}
+			if st.State != rpc.RunPassed {
+				return fmt.Errorf("run %s", st.State)
+			}
+			return nil
+		},
+	}
+	runCmd.Flags().StringVar(&params.Status, "status", "", "Run the tandas with this status")
+	runCmd.Flags().BoolVar(&params.Failing, "failing", false, "Run the tandas whose last run failed")
+	runCmd.Flags().StringVar(&params.Runner, "runner", "", "Use this runner for every tanda")
+	runCmd.Flags().BoolVar(&detach, "detach", false, "Start the run and return without waiting")
+	runCmd.Flags().BoolVar(&asJSON, "json", false, "Print the run as JSON, with its output on stderr")
+	runCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return runCmd
+}
+
+// printRunStatus summarizes a run, or prints it as JSON
+func printRunStatus(st rpc.RunStatus, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(st)
+	}
+	if st.State == rpc.RunRunning {
+		fmt.Printf("Run %d started: %d command(s)\n", st.ID, len(st.Commands))
+		for _, c := range st.Commands {
+			fmt.Printf("  %s: %s\n", c.Runner, strings.Join(c.Tandas, ", "))
+		}
+		return nil
+	}
+	fmt.Printf("\nRun %d %s: %d passed, %d failed, %d skipped\n", st.ID, st.State, len(st.Passed), len(st.Failed), len(st.Skipped))
+	if len(st.Failed) > 0 {
+		fmt.Printf("  Failed: %s\n", strings.Join(st.Failed, ", "))
+	}
+	if len(st.NotRun) > 0 {
+		fmt.Printf("  Not run: %s\n", strings.Join(st.NotRun, ", "))
+	}
+	if len(st.Unmatched) > 0 {
+		fmt.Printf("  Unmatched tests: %s\n", strings.Join(st.Unmatched, ", "))
+	}
+	if st.Error != "" {
+		fmt.Printf("  Error: %s\n", st.Error)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/rpc"
+	"github.com/tandas/daemon/internal/schema"
+)
+
+func newSchemaCmd() *cobra.Command {
+	var rpcSchema bool
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of a tanda document",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc := schema.JSON()
+			if rpcSchema {
+				var err error
+				if doc, err = rpc.Schema(); err != nil {
+					return err
+				}
+			}
+			_, err := os.Stdout.Write(doc)
+			return err
+		},
+	}
+	schemaCmd.Flags().BoolVar(&rpcSchema, "rpc", false, "Print the schema of the RPC messages instead")
+	schemaCmd.AddCommand(newSchemaExportCmd())
+	return schemaCmd
+}
+
+func newSchemaExportCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "export <dir>",
+		Short: "Write the tanda and RPC JSON Schemas for generating clients",
+		Long: `Write tanda.schema.json, the tanda document, and rpc.schema.json, the JSON-RPC
+request, response and each method's params and result, to dir. The RPC schema
+refers to the tanda schema by its file name, so keep the two together.
+
+Code generators such as quicktype or datamodel-code-generator turn them into
+Python or TypeScript types that match this daemon release.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, err := rpc.Schema()
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(args[0], 0755); err != nil {
+				return err
+			}
+			files := map[string][]byte{rpc.TandaSchemaFile: schema.JSON(), rpc.SchemaFile: append(doc, '\n')}
+			for _, name := range []string{rpc.TandaSchemaFile, rpc.SchemaFile} {
+				path := filepath.Join(args[0], name)
+				if err := os.WriteFile(path, files[name], 0644); err != nil {
+					return fmt.Errorf("failed to write %s: %w", path, err)
+				}
+				fmt.Println(path)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/rpc"
+	"github.com/tandas/daemon/internal/snapshot"
+)
+
+func newSnapshotCmd() *cobra.Command {
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Create and restore point-in-time copies of the .tandas state",
+	}
+
+	var note string
+	createCmd := &cobra.Command{
+		Use:   "create [name]",
+		Short: "Bundle the registry, cache, trace inbox and config into a snapshot",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if len(args) == 1 {
+				name = args[0]
+			}
+			m, err := snapshot.Create(socketDir, name, note, time.Now())
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Created snapshot %s (%d files)\n", m.Name, len(m.Files))
+			return nil
+		},
+	}
+	createCmd.Flags().StringVar(&note, "note", "", "Describe why the snapshot was taken")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List snapshots",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifests, err := snapshot.List(socketDir)
+			if err != nil {
+				return err
+			}
+			if len(manifests) == 0 {
+				fmt.Println("No snapshots")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tCREATED\tSIZE\tNOTE")
+			for _, m := range manifests {
+				var size int64
+				for _, f := range m.Files {
+					size += f.Size
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Name, m.CreatedAt.Local().Format("2006-01-02 15:04:05"), formatSize(size), m.Note)
+			}
+			return w.Flush()
+		},
+	}
+
+	var noBackup bool
+	restoreCmd := &cobra.Command{
+		Use:          "restore <name>",
+		Short:        "Replace the current state with a snapshot",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The daemon holds the database open and would export over the
+			// restored registry
+			if err := rpc.Call(socketDir, "ping", nil, nil); !errors.Is(err, rpc.ErrNotRunning) {
+				return fmt.Errorf("the daemon is running; stop it with 'td-daemon stop' before restoring")
+			}
+			if !noBackup {
+				m, err := snapshot.Create(socketDir, "pre-restore-"+time.Now().Format("20060102-150405"),
+					"automatic backup before restoring "+args[0], time.Now())
+				if err != nil {
+					return fmt.Errorf("failed to back up current state: %w", err)
+				}
+				fmt.Printf("Saved current state as %s\n", m.Name)
+			}
+			m, err := snapshot.Restore(socketDir, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Restored snapshot %s from %s\n", m.Name, m.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+			return nil
+		},
+	}
+	restoreCmd.Flags().BoolVar(&noBackup, "no-backup", false, "Do not snapshot the current state first")
+
+	for _, c := range []*cobra.Command{createCmd, listCmd, restoreCmd} {
+		c.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+		snapshotCmd.AddCommand(c)
+	}
+	return snapshotCmd
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
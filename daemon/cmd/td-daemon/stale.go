@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/stale"
+)
+
+func newStaleCmd() *cobra.Command {
+	var days int
+	var asJSON bool
+	staleCmd := &cobra.Command{
+		Use:   "stale",
+		Short: "Find tandas that have not run recently or whose file is gone",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, _, err := projectPaths(socketDir)
+			if err != nil {
+				return err
+			}
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			tandas, err := store.GetAllTandas()
+			if err != nil {
+				return err
+			}
+			findings, err := stale.Detect(tandas, root, loadWorkflow(socketDir), days, time.Now())
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(findings)
+			}
+			if len(findings) == 0 {
+				fmt.Println("No stale tandas")
+				return nil
+			}
+			for _, f := range findings {
+				fmt.Printf("%s  %s  [%s]\n", f.TandaID, f.Title, strings.Join(f.Reasons, ", "))
+				for _, s := range f.Suggestions {
+					fmt.Printf("    %s\n", s)
+				}
+			}
+			return nil
+		},
+	}
+	staleCmd.Flags().IntVar(&days, "days", stale.DefaultDays, "Report tandas with no run in this many days")
+	staleCmd.Flags().BoolVar(&asJSON, "json", false, "Print findings as JSON")
+	staleCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return staleCmd
+}
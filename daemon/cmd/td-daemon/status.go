@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/rpc"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+// watchInterval is how often status --watch redraws
+const watchInterval = time.Second
+
+// daemonStatus is the part of the status RPC result status --watch shows
+type daemonStatus struct {
+	PID          int                  `json:"pid"`
+	Interval     string               `json:"interval"`
+	LastSync     time.Time            `json:"last_sync"`
+	InboxPending int                  `json:"inbox_pending"`
+	Runners      []rpc.RunnerStatus   `json:"runners"`
+	Writes       rpc.WriteQueueStatus `json:"writes"`
+	RecentErrors []rpc.RecentError    `json:"recent_errors"`
+	Crashes      rpc.CrashStatus      `json:"crashes"`
+	Resources    rpc.ResourceStats    `json:"resources"`
+	Import       *sync.ImportProgress `json:"import"`
+	Startup      rpc.StartupReport    `json:"startup"`
+}
+
+// watchStatus redraws the daemon's sync health to w every interval until
+// ctx is done, carrying on while the daemon is down or stopping
+func watchStatus(ctx context.Context, w io.Writer, dir string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var st daemonStatus
+		err := rpc.Call(dir, "status", nil, &st)
+		// Clear the screen and redraw from the top
+		fmt.Fprint(w, "\033[H\033[2J")
+		fmt.Fprintf(w, "td-daemon status, every %s (Ctrl-C to stop)    %s\n\n", interval, time.Now().Format("15:04:05"))
+		switch {
+		case errors.Is(err, rpc.ErrNotRunning):
+			fmt.Fprintln(w, "Daemon not running")
+		case err != nil:
+			// A daemon shutting down can drop the call half answered
+			fmt.Fprintf(w, "Status unavailable: %v\n", err)
+		default:
+			printStatus(w, st, time.Now())
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			fmt.Fprintln(w)
+			return nil
+		}
+	}
+}
+
+// writesLine describes the write queue as "import running 3s, 2 queued"
+func writesLine(w rpc.WriteQueueStatus, now time.Time) string {
+	line := "idle"
+	if w.Since != nil {
+		line = fmt.Sprintf("%s running %s", w.Running, now.Sub(*w.Since).Round(time.Second))
+	}
+	if w.Depth > 0 {
+		line += fmt.Sprintf(", %d queued", w.Depth)
+	}
+	return line
+}
+
+// resourcesLine describes the runtime as "12 goroutines, 4.1 MB heap, 9 open files"
+func resourcesLine(r rpc.ResourceStats) string {
+	line := fmt.Sprintf("%d goroutines, %s heap", r.Goroutines, formatSize(int64(r.HeapInUse)))
+	if r.OpenFiles >= 0 {
+		line += fmt.Sprintf(", %d open files", r.OpenFiles)
+	}
+	return line
+}
+
+// runnerLine describes a runner as "name done/total tanda message (age)"
+func runnerLine(r rpc.RunnerStatus, now time.Time) string {
+	parts := []string{r.Runner}
+	if r.Total > 0 {
+		parts = append(parts, fmt.Sprintf("%d/%d", r.Done, r.Total))
+	}
+	if r.TandaID != "" {
+		parts = append(parts, r.TandaID)
+	}
+	if r.Message != "" {
+		parts = append(parts, r.Message)
+	}
+	parts = append(parts, fmt.Sprintf("(%s ago)", now.Sub(r.LastSeen).Round(time.Second)))
+	return strings.Join(parts, " ")
+}
+
+func printStatus(w io.Writer, st daemonStatus, now time.Time) {
+	fmt.Fprintf(w, "Daemon:   running (PID: %d, interval: %s)\n", st.PID, st.Interval)
+	fmt.Fprintf(w, "Sync:     %s\n", syncHealth(st, now))
+	fmt.Fprintf(w, "Inbox:    %d pending\n", st.InboxPending)
+	fmt.Fprintf(w, "Writes:   %s\n", writesLine(st.Writes, now))
+	fmt.Fprintf(w, "Memory:   %s\n", resourcesLine(st.Resources))
+	fmt.Fprintf(w, "Storage:  db %s, wal %s, traces %s in %d files\n", formatSize(st.Resources.DBSize),
+		formatSize(st.Resources.WALSize), formatSize(st.Resources.TraceSize), st.Resources.TraceFiles)
+	for _, r := range st.Runners {
+		fmt.Fprintf(w, "Runner:   %s\n", runnerLine(r, now))
+	}
+	if !st.Startup.OK() {
+		var names []string
+		for _, d := range st.Startup.Degraded {
+			names = append(names, d.Subsystem)
+		}
+		fmt.Fprintf(w, "Degraded: %s\n", strings.Join(names, ", "))
+	}
+	if st.Crashes.Count > 0 {
+		fmt.Fprintf(w, "Crashes:  %d recovered, last %s\n", st.Crashes.Count, st.Crashes.Last)
+	}
+
+	if len(st.RecentErrors) == 0 {
+		fmt.Fprintln(w, "\nNo recent errors")
+		return
+	}
+	fmt.Fprintln(w, "\nRecent errors:")
+	for _, e := range st.RecentErrors {
+		fmt.Fprintf(w, "  %s  %s\n", e.At.Local().Format("15:04:05"), e.Message)
+	}
+}
+
+// syncHealth summarizes the sync state: importing, failing when the newest
+// error is later than the last good sync, or ok
+func syncHealth(st daemonStatus, now time.Time) string {
+	if st.Import != nil && st.Import.Running {
+		return fmt.Sprintf("importing, %d rows (%.0f%%)", st.Import.Rows, st.Import.Percent)
+	}
+	last := "never synced"
+	if !st.LastSync.IsZero() {
+		last = fmt.Sprintf("last sync %s ago", now.Sub(st.LastSync).Round(time.Second))
+	}
+	if len(st.RecentErrors) > 0 && st.RecentErrors[0].At.After(st.LastSync) {
+		return "failing, " + last
+	}
+	return "ok, " + last
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe to read while watchStatus writes it
+type lockedBuffer struct {
+	mu  gosync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatchStatus(t *testing.T) {
+	// A short path keeps the socket under the unix path length limit
+	dir, err := os.MkdirTemp("", "td")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := net.Listen("unix", filepath.Join(dir, "td.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// Each status answer reports one more pending trace, so redraws show
+	go func() {
+		for pending := 1; ; pending++ {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			if _, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+				fmt.Fprintf(conn, `{"jsonrpc":"2.0","id":1,"result":{"pid":4242,"interval":"5s","inbox_pending":%d}}`+"\n", pending)
+			}
+			conn.Close()
+		}
+	}()
+
+	var out lockedBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watchStatus(ctx, &out, dir, 10*time.Millisecond) }()
+
+	waitFor := func(what, text string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(out.String(), text) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s:\n%s", what, out.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("the first redraw", "Inbox:    1 pending")
+	waitFor("a refresh", "Inbox:    2 pending")
+	if !strings.Contains(out.String(), "Daemon:   running (PID: 4242, interval: 5s)") {
+		t.Errorf("unexpected status:\n%s", out.String())
+	}
+
+	// The watch carries on while the daemon is down
+	l.Close()
+	waitFor("the stopped daemon", "Daemon not running")
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("watchStatus = %v, want nil after cancel", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchStatus did not return after cancel")
+	}
+}
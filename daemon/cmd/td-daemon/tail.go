@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+// tailWait is how long each tail call waits for new events, in seconds
+const tailWait = 20
+
+func newTailCmd() *cobra.Command {
+	var lines int
+	var types []string
+	var asJSON bool
+	tailCmd := &cobra.Command{
+		Use:   "tail",
+		Short: "Print daemon events as they happen",
+		Long: `Print syncs, recorded runs, quarantine changes and the other daemon events as
+they happen, starting with the last --lines already seen. --json prints one
+event per line for jq.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			want := make(map[string]bool)
+			for _, t := range types {
+				want[t] = true
+			}
+			enc := json.NewEncoder(os.Stdout)
+
+			var result rpc.TailResult
+			if err := rpc.Call(socketDir, "tail", rpc.TailParams{}, &result); err != nil {
+				return err
+			}
+			backlog := result.Events
+			if len(backlog) > lines {
+				backlog = backlog[len(backlog)-lines:]
+			}
+			for {
+				for _, e := range backlog {
+					if len(want) > 0 && !want[e.Type] {
+						continue
+					}
+					if asJSON {
+						if err := enc.Encode(e); err != nil {
+							return err
+						}
+						continue
+					}
+					fmt.Println(formatEvent(e))
+				}
+
+				since := result.Seq
+				result = rpc.TailResult{}
+				if err := rpc.Call(socketDir, "tail", rpc.TailParams{Since: since, Wait: tailWait}, &result); err != nil {
+					// The daemon closes connections as it shuts down
+					if errors.Is(rpc.Call(socketDir, "ping", nil, nil), rpc.ErrNotRunning) {
+						fmt.Fprintln(os.Stderr, "Daemon stopped")
+						return nil
+					}
+					return err
+				}
+				backlog = result.Events
+			}
+		},
+	}
+	tailCmd.Flags().IntVarP(&lines, "lines", "n", 10, "Print this many past events first")
+	tailCmd.Flags().StringSliceVar(&types, "type", nil, "Only print events of these types (repeatable)")
+	tailCmd.Flags().BoolVar(&asJSON, "json", false, "Print events as JSON lines")
+	tailCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return tailCmd
+}
+
+// formatEvent renders an event as "time  type  tanda  key=value ..."
+func formatEvent(e rpc.TailEvent) string {
+	parts := []string{e.Time.Local().Format("15:04:05"), e.Type}
+	if e.TandaID != "" {
+		parts = append(parts, e.TandaID)
+	}
+	keys := make([]string, 0, len(e.Data))
+	for k, v := range e.Data {
+		if v != nil && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, e.Data[k]))
+	}
+	return strings.Join(parts, "  ")
+}
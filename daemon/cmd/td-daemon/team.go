@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rpc"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+func newTeamCmd() *cobra.Command {
+	teamCmd := &cobra.Command{
+		Use:   "team",
+		Short: "Exchange the registry with a team server",
+	}
+
+	pushCmd := &cobra.Command{
+		Use:          "push [addr]",
+		Short:        "Merge the local registry into the team server",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := teamClient(args)
+			if err != nil {
+				return err
+			}
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			tandas, err := store.GetAllTandas()
+			if err != nil {
+				return err
+			}
+			host, _ := os.Hostname()
+			var result rpc.PushResult
+			if err := client.Call("push", rpc.PushParams{Source: host, Tandas: tandas}, &result); err != nil {
+				return err
+			}
+			fmt.Printf("Pushed %d tanda(s) to %s, %d changed on the server\n", len(tandas), client.Addr, len(result.Changed))
+			return nil
+		},
+	}
+
+	pullCmd := &cobra.Command{
+		Use:          "pull [addr]",
+		Short:        "Merge the team server's combined registry into the local one",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := teamClient(args)
+			if err != nil {
+				return err
+			}
+			var tandas []*db.Tanda
+			if err := client.Call("query", nil, &tandas); err != nil {
+				return err
+			}
+
+			store, syncer, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			changed, err := sync.MergeInto(store, tandas)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Merged %d tanda(s) from %s\n", len(changed), client.Addr)
+			if len(changed) == 0 {
+				return nil
+			}
+			return syncer.ExportToJSONL()
+		},
+	}
+
+	for _, c := range []*cobra.Command{pushCmd, pullCmd} {
+		c.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+		c.Flags().StringVar(&teamToken, "token", "", "Bearer token (default $"+teamTokenEnv+" or team.token)")
+		teamCmd.AddCommand(c)
+	}
+	return teamCmd
+}
+
+// teamTokenEnv overrides team.token for `team` commands
+const teamTokenEnv = "TANDAS_TOKEN"
+
+var teamToken string
+
+// teamClient connects to the server from args or team.upstream
+func teamClient(args []string) (*rpc.TeamClient, error) {
+	cfg, err := config.Load(socketDir)
+	if err != nil {
+		return nil, err
+	}
+	addr := cfg.Team.Upstream
+	if len(args) == 1 {
+		addr = args[0]
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("no server address given and team.upstream is not set in %s", config.FileName)
+	}
+	return dialTeam(cfg, addr)
+}
+
+// dialTeam builds a client for addr with the token from --token,
+// $TANDAS_TOKEN or team.token, and team.upstream_tls
+func dialTeam(cfg *config.Config, addr string) (*rpc.TeamClient, error) {
+	token := teamToken
+	if token == "" {
+		token = os.Getenv(teamTokenEnv)
+	}
+	if token == "" {
+		token = cfg.Team.Token
+	}
+	return rpc.NewTeamClient(addr, token, cfg.Team.UpstreamTLS)
+}
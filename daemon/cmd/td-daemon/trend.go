@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/trend"
+)
+
+func newTrendCmd() *cobra.Command {
+	var windows []string
+	var tandaID string
+	trendCmd := &cobra.Command{
+		Use:   "trend",
+		Short: "Report whether flakiness is improving or worsening",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, _, err := openRegistry(socketDir)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			now := time.Now()
+			if _, err := store.RecordFlakiness(now); err != nil {
+				return err
+			}
+			trends, err := trend.Compute(store, tandaID, windows, now)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprint(w, "ID\tTITLE\tCURRENT")
+			for _, win := range windowsOrDefault(windows) {
+				fmt.Fprintf(w, "\t%s", win)
+			}
+			fmt.Fprintln(w)
+			for _, t := range trends {
+				fmt.Fprintf(w, "%s\t%s\t%.0f%%", t.TandaID, t.Title, t.Current*100)
+				for _, win := range t.Windows {
+					if win.Trend == trend.Unknown {
+						fmt.Fprint(w, "\t-")
+						continue
+					}
+					fmt.Fprintf(w, "\t%s (%+.0f%%)", win.Trend, win.Delta*100)
+				}
+				fmt.Fprintln(w)
+			}
+			return w.Flush()
+		},
+	}
+	trendCmd.Flags().StringSliceVar(&windows, "window", nil, "Window to compare against, e.g. 7d (repeatable; default 7d,30d)")
+	trendCmd.Flags().StringVar(&tandaID, "tanda", "", "Only report this tanda")
+	trendCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return trendCmd
+}
+
+func windowsOrDefault(windows []string) []string {
+	if len(windows) == 0 {
+		return trend.DefaultWindows
+	}
+	return windows
+}
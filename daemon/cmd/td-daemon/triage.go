@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/report"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func newTriageCmd() *cobra.Command {
+	var params rpc.TriageParams
+	var asJSON bool
+	triageCmd := &cobra.Command{
+		Use:   "triage [id]",
+		Short: "Show the triage queue or move a tanda through triage",
+		Long: `Without an ID, list the tandas open in triage (untriaged, acknowledged or
+fixing), most urgent priority first. Tandas that turn flaky enter triage as
+untriaged.
+
+With an ID, set its triage state (` + strings.Join(db.TriageStates, ", ") + `)
+and/or priority (` + strings.Join(db.Priorities, ", ") + `); "none" clears either. --snooze keeps the
+tanda off the leaderboard for a number of days. Each change is kept as a
+triage note, so show lists the tanda's triage history:
+
+  td-daemon triage td-0042 --state fixing --priority p1 --note "race in session refresh"
+  td-daemon triage td-0042 --snooze 7
+
+Changes go through the daemon, which must be running.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				if params.State != "" || params.Priority != "" || params.Snooze != "" || params.Note != "" {
+					return errors.New("an ID is required to change triage")
+				}
+				tandas, err := queryTandas(socketDir, db.Filter{})
+				if err != nil {
+					return err
+				}
+				return printTriageQueue(report.Build(tandas, time.Now()), asJSON)
+			}
+
+			if params.State == "" && params.Priority == "" && params.Snooze == "" && params.Note == "" {
+				return errors.New("nothing to change: use --state, --priority, --snooze or --note")
+			}
+			params.ID = args[0]
+			var t db.Tanda
+			if err := rpc.Call(socketDir, "triage", params, &t); err != nil {
+				if errors.Is(err, rpc.ErrNotRunning) {
+					return errors.New("daemon is not running; start it with td-daemon start")
+				}
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(t)
+			}
+			fmt.Printf("%s  triage %s, priority %s", t.ID, orDash(t.Triage), orDash(t.Priority))
+			if t.SnoozedUntil != "" {
+				fmt.Printf(", snoozed until %s", t.SnoozedUntil)
+			}
+			fmt.Println()
+			return nil
+		},
+	}
+	triageCmd.Flags().StringVar(&params.State, "state", "", "Set the triage state")
+	triageCmd.Flags().StringVar(&params.Priority, "priority", "", "Set the priority")
+	triageCmd.Flags().StringVar(&params.Snooze, "snooze", "", "Keep off the leaderboard for this many days (none wakes it)")
+	triageCmd.Flags().StringVar(&params.Note, "note", "", "Add a triage note")
+	triageCmd.Flags().BoolVar(&asJSON, "json", false, "Print the result as JSON")
+	triageCmd.Flags().StringVar(&socketDir, "dir", ".tandas", "Tandas directory")
+	return triageCmd
+}
+
+// printTriageQueue lists the open tandas of a report and counts by state
+func printTriageQueue(r *report.Report, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]interface{}{"by_triage": r.ByTriage, "open": r.Triage})
+	}
+	counts := make([]string, 0, len(db.TriageStates))
+	for _, s := range db.TriageStates {
+		counts = append(counts, fmt.Sprintf("%d %s", r.ByTriage[s], s))
+	}
+	fmt.Println(strings.Join(counts, ", "))
+	if len(r.Triage) == 0 {
+		fmt.Println("Nothing to triage")
+		return nil
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPRIORITY\tTRIAGE\tSTATUS\tOWNERS\tTITLE")
+	for _, e := range r.Triage {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, orDash(e.Priority), e.Triage, e.Status,
+			orDash(strings.Join(e.Owners, ",")), e.Title)
+	}
+	return w.Flush()
+}
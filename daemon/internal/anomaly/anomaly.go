@@ -0,0 +1,197 @@
+// Package anomaly flags runs whose duration jumps well above the tanda's
+// recent baseline, catching performance regressions as results land
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/events"
+)
+
+// Defaults for the zero fields of config.AnomalyConfig
+const (
+	DefaultZScore      = 3.0
+	DefaultMinRatio    = 1.5
+	DefaultMinIncrease = 100 * time.Millisecond
+	DefaultBaseline    = 20
+	DefaultMinRuns     = 5
+)
+
+// Detector checks the runs recorded since the previous call against the
+// timed runs before them
+type Detector struct {
+	zScore      float64
+	minRatio    float64
+	minIncrease time.Duration
+	baseline    int
+	minRuns     int
+
+	mu     sync.Mutex
+	seeded bool
+	runs   map[string]int
+	// slow holds the tandas whose latest timed run was anomalous, so a
+	// regression is reported when it starts rather than on every run
+	slow map[string]bool
+}
+
+// New validates the config and fills in the defaults
+func New(c config.AnomalyConfig) (*Detector, error) {
+	d := &Detector{zScore: c.ZScore, minRatio: c.MinRatio, minIncrease: DefaultMinIncrease,
+		baseline: c.Baseline, minRuns: c.MinRuns, slow: make(map[string]bool)}
+	if d.zScore == 0 {
+		d.zScore = DefaultZScore
+	}
+	if d.minRatio == 0 {
+		d.minRatio = DefaultMinRatio
+	}
+	if d.baseline == 0 {
+		d.baseline = DefaultBaseline
+	}
+	if d.minRuns == 0 {
+		d.minRuns = DefaultMinRuns
+	}
+	if c.MinIncrease != "" {
+		inc, err := time.ParseDuration(c.MinIncrease)
+		if err != nil {
+			return nil, fmt.Errorf("anomalies: invalid min_increase %q", c.MinIncrease)
+		}
+		d.minIncrease = inc
+	}
+	if d.zScore < 0 || d.minIncrease < 0 {
+		return nil, fmt.Errorf("anomalies: z_score and min_increase must not be negative")
+	}
+	if d.minRatio < 1 {
+		return nil, fmt.Errorf("anomalies: min_ratio must be at least 1")
+	}
+	if d.minRuns < 2 || d.baseline < d.minRuns {
+		return nil, fmt.Errorf("anomalies: min_runs must be at least 2 and baseline at least min_runs")
+	}
+	return d, nil
+}
+
+// Observe returns a duration_anomaly event for each tanda whose runs since
+// the previous call include one that jumped above its baseline. The first
+// call only records run counts, like events.Detector.
+func (d *Detector) Observe(tandas []*db.Tanda) []events.Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var out []events.Event
+	runs := make(map[string]int, len(tandas))
+	for _, t := range tandas {
+		n := len(t.RunHistory)
+		runs[t.ID] = n
+		prev, seen := d.runs[t.ID]
+		if !d.seeded || !seen || n <= prev {
+			continue
+		}
+		var worst *finding
+		for i := prev; i < n; i++ {
+			a, timed := d.check(t.RunHistory[:i+1])
+			if !timed {
+				continue
+			}
+			if a == nil {
+				delete(d.slow, t.ID)
+				continue
+			}
+			if !d.slow[t.ID] && (worst == nil || a.ZScore > worst.ZScore) {
+				worst = a
+			}
+			d.slow[t.ID] = true
+		}
+		if worst != nil {
+			out = append(out, worst.event(t))
+		}
+	}
+	for id := range d.slow {
+		if _, ok := runs[id]; !ok {
+			delete(d.slow, id)
+		}
+	}
+	d.runs = runs
+	d.seeded = true
+	return out
+}
+
+// finding is a run slower than its baseline
+type finding struct {
+	Run      db.RunResult
+	Duration time.Duration
+	Mean     time.Duration
+	StdDev   time.Duration
+	ZScore   float64
+	Baseline int
+}
+
+// check compares the last run of history with the timed runs before it.
+// timed is false when the last run has no duration.
+func (d *Detector) check(history []db.RunResult) (a *finding, timed bool) {
+	last := history[len(history)-1]
+	dur, ok := db.ParseDuration(last.Duration)
+	if !ok || last.Summary != nil {
+		return nil, false
+	}
+	var base []float64
+	for i := len(history) - 2; i >= 0 && len(base) < d.baseline; i-- {
+		if b, ok := db.ParseDuration(history[i].Duration); ok && history[i].Summary == nil {
+			base = append(base, float64(b))
+		}
+	}
+	if len(base) < d.minRuns {
+		return nil, true
+	}
+	mean, sd := meanStdDev(base)
+	x := float64(dur)
+	if x < mean*d.minRatio || x-mean < float64(d.minIncrease) {
+		return nil, true
+	}
+	z := math.Inf(1)
+	if sd > 0 {
+		z = (x - mean) / sd
+	}
+	if z < d.zScore {
+		return nil, true
+	}
+	return &finding{Run: last, Duration: dur, Mean: time.Duration(mean), StdDev: time.Duration(sd),
+		ZScore: z, Baseline: len(base)}, true
+}
+
+func (a *finding) event(t *db.Tanda) events.Event {
+	// JSON has no infinity; a constant baseline reports a z-score of 0,
+	// and a baseline of 0s a ratio of 0
+	z, ratio := a.ZScore, 0.0
+	if math.IsInf(z, 1) {
+		z = 0
+	}
+	if a.Mean > 0 {
+		ratio = math.Round(float64(a.Duration)/float64(a.Mean)*100) / 100
+	}
+	return events.Event{Type: events.DurationAnomaly, TandaID: t.ID, Data: map[string]interface{}{
+		"title":    t.Title,
+		"owners":   t.Owners,
+		"ts":       a.Run.Timestamp,
+		"duration": a.Duration.String(),
+		"baseline": a.Mean.Round(time.Millisecond).String(),
+		"stddev":   a.StdDev.Round(time.Millisecond).String(),
+		"ratio":    ratio,
+		"z_score":  math.Round(z*100) / 100,
+		"runs":     a.Baseline,
+	}}
+}
+
+func meanStdDev(xs []float64) (mean, sd float64) {
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	for _, x := range xs {
+		sd += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(sd / float64(len(xs)))
+}
@@ -0,0 +1,69 @@
+package anomaly_test
+
+import (
+	"testing"
+
+	"github.com/tandas/daemon/internal/anomaly"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/events"
+)
+
+func timed(durations ...string) []db.RunResult {
+	out := make([]db.RunResult, len(durations))
+	for i, d := range durations {
+		out[i] = db.RunResult{Timestamp: "2025-06-01T10:00:00Z", Result: "pass", Duration: d}
+	}
+	return out
+}
+
+func TestObserve(t *testing.T) {
+	d, err := anomaly.New(config.AnomalyConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseline := timed("2s", "2.1s", "1.9s", "2s", "2.2s", "1.8s")
+	checkout := &db.Tanda{ID: "td-checkout", Title: "Checkout", Owners: []string{"@org/shop"}, RunHistory: baseline}
+	login := &db.Tanda{ID: "td-login", Title: "Login", RunHistory: timed("1s", "1s", "1s", "1s", "1s")}
+	tandas := []*db.Tanda{checkout, login}
+
+	// The first call only records the runs seen
+	if got := d.Observe(tandas); len(got) != 0 {
+		t.Fatalf("expected no events on the first call, got %+v", got)
+	}
+
+	// Within the noise, and a constant baseline within min_increase
+	checkout.RunHistory = append(checkout.RunHistory, timed("2.3s")...)
+	login.RunHistory = append(login.RunHistory, timed("1.05s")...)
+	if got := d.Observe(tandas); len(got) != 0 {
+		t.Fatalf("expected no anomaly, got %+v", got)
+	}
+
+	checkout.RunHistory = append(checkout.RunHistory, timed("6s")...)
+	got := d.Observe(tandas)
+	if len(got) != 1 || got[0].Type != events.DurationAnomaly || got[0].TandaID != "td-checkout" {
+		t.Fatalf("expected an anomaly for td-checkout, got %+v", got)
+	}
+	if got[0].Data["duration"] != "6s" || got[0].Data["ratio"].(float64) < 2.8 || len(got[0].Owners()) != 1 {
+		t.Errorf("unexpected event data %+v", got[0].Data)
+	}
+
+	// A regression is reported once, then again after recovering
+	checkout.RunHistory = append(checkout.RunHistory, timed("6.1s")...)
+	if got := d.Observe(tandas); len(got) != 0 {
+		t.Fatalf("expected the ongoing regression reported once, got %+v", got)
+	}
+	checkout.RunHistory = append(checkout.RunHistory, timed("2s", "2s", "2s", "2s", "2s", "2s", "2s", "2s", "2s", "2s", "2s")...)
+	d.Observe(tandas)
+	checkout.RunHistory = append(checkout.RunHistory, timed("7s")...)
+	if got := d.Observe(tandas); len(got) != 1 {
+		t.Fatalf("expected a new regression after recovery, got %+v", got)
+	}
+
+	if _, err := anomaly.New(config.AnomalyConfig{MinIncrease: "soon"}); err == nil {
+		t.Error("expected an invalid min_increase to be rejected")
+	}
+	if _, err := anomaly.New(config.AnomalyConfig{MinRatio: 0.5}); err == nil {
+		t.Error("expected a min_ratio below 1 to be rejected")
+	}
+}
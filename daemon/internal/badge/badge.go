@@ -0,0 +1,169 @@
+// Package badge renders shields-style SVG badges of the registry's health
+// for READMEs and dashboards to embed
+package badge
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/events"
+)
+
+// Kinds of badge
+const (
+	// PassRate is the share of tandas whose latest run passed
+	PassRate = "pass-rate"
+	// Flaky counts the tandas with status flaky
+	Flaky = "flaky"
+	// Quarantined counts the tandas in quarantine, flaky or quarantined
+	Quarantined = "quarantined"
+)
+
+// Kinds are the badges WriteFiles writes, each as <kind>.svg
+var Kinds = []string{PassRate, Flaky, Quarantined}
+
+// Colors, as shields.io names them
+const (
+	green     = "#4c1"
+	yellow    = "#dfb317"
+	orange    = "#fe7d37"
+	red       = "#e05d44"
+	lightgrey = "#9f9f9f"
+)
+
+// Badge is a label and a message on a colored background
+type Badge struct {
+	Kind    string `json:"kind"`
+	Label   string `json:"label"`
+	Message string `json:"message"`
+	Color   string `json:"color"`
+}
+
+// CheckKind returns an error unless kind is one of Kinds
+func CheckKind(kind string) error {
+	for _, k := range Kinds {
+		if kind == k {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown badge %q: use pass-rate, flaky or quarantined", kind)
+}
+
+// Build computes the badge of the given kind for the registry
+func Build(tandas []*db.Tanda, kind string) (Badge, error) {
+	if err := CheckKind(kind); err != nil {
+		return Badge{}, err
+	}
+	b := Badge{Kind: kind}
+	switch kind {
+	case PassRate:
+		b.Label = "tests"
+		ran := false
+		for _, t := range tandas {
+			if len(t.RunHistory) > 0 {
+				ran = true
+				break
+			}
+		}
+		if !ran {
+			b.Message, b.Color = "no runs", lightgrey
+			return b, nil
+		}
+		rate := events.PassRate(tandas)
+		// Rounded down, so a failing suite never shows 100%
+		b.Message = fmt.Sprintf("%d%% passing", int(rate*100))
+		switch {
+		case rate >= 0.95:
+			b.Color = green
+		case rate >= 0.8:
+			b.Color = yellow
+		default:
+			b.Color = red
+		}
+	default:
+		b.Label = kind
+		n := 0
+		for _, t := range tandas {
+			if kind == Flaky && t.Status == "flaky" || kind == Quarantined && db.IsQuarantined(t.Status) {
+				n++
+			}
+		}
+		b.Message, b.Color = fmt.Sprint(n), green
+		if n > 0 {
+			b.Color = orange
+			if kind == Quarantined {
+				b.Color = yellow
+			}
+		}
+	}
+	return b, nil
+}
+
+const svgTemplate = `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[2]s: %[3]s">
+<title>%[2]s: %[3]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="%[4]d" height="20" fill="#555"/><rect x="%[4]d" width="%[5]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%[7]g" y="15" fill="#010101" fill-opacity=".3">%[2]s</text><text x="%[7]g" y="14">%[2]s</text>
+<text x="%[8]g" y="15" fill="#010101" fill-opacity=".3">%[3]s</text><text x="%[8]g" y="14">%[3]s</text>
+</g>
+</svg>
+`
+
+// SVG renders the badge in the shields.io flat style
+func (b Badge) SVG() []byte {
+	left, right := textWidth(b.Label)+10, textWidth(b.Message)+10
+	return []byte(fmt.Sprintf(svgTemplate, left+right, html.EscapeString(b.Label), html.EscapeString(b.Message),
+		left, right, b.Color, float64(left)/2, float64(left)+float64(right)/2))
+}
+
+// textWidth estimates the width in pixels of s in 11px Verdana
+func textWidth(s string) int {
+	var w float64
+	for _, r := range s {
+		switch {
+		case r == 'i' || r == 'j' || r == 'l' || r == '.' || r == ',' || r == ':' || r == '!' || r == '|' || r == '\'':
+			w += 3.5
+		case r == ' ' || r == 'f' || r == 'r' || r == 't' || r == '(' || r == ')':
+			w += 4.5
+		case r == 'm' || r == 'w' || r == 'M' || r == 'W' || r == '%':
+			w += 11
+		case r >= 'A' && r <= 'Z':
+			w += 7.5
+		default:
+			w += 7
+		}
+	}
+	return int(w + 0.5)
+}
+
+// WriteFiles writes every kind of badge into dir as <kind>.svg and returns
+// the paths it wrote. Badges that have not changed are left alone, so a
+// badge directory committed to git only changes when a badge does.
+func WriteFiles(dir string, tandas []*db.Tanda) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create badge directory: %w", err)
+	}
+	var written []string
+	for _, kind := range Kinds {
+		b, err := Build(tandas, kind)
+		if err != nil {
+			return written, err
+		}
+		path := filepath.Join(dir, kind+".svg")
+		svg := b.SVG()
+		if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, svg) {
+			continue
+		}
+		if err := os.WriteFile(path, svg, 0o644); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
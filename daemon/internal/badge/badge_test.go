@@ -0,0 +1,81 @@
+package badge_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/badge"
+	"github.com/tandas/daemon/internal/db"
+)
+
+func registry() []*db.Tanda {
+	run := func(result string) []db.RunResult {
+		return []db.RunResult{{Timestamp: "2025-06-01T10:00:00Z", Result: result}}
+	}
+	return []*db.Tanda{
+		{ID: "td-1", Status: "active", RunHistory: run("pass")},
+		{ID: "td-2", Status: "active", RunHistory: run("pass")},
+		{ID: "td-3", Status: "flaky", RunHistory: run("pass")},
+		{ID: "td-4", Status: "quarantined", RunHistory: run("fail")},
+		{ID: "td-5", Status: "active"},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	for _, tc := range []struct {
+		kind, message, color string
+	}{
+		{badge.PassRate, "75% passing", "#e05d44"},
+		{badge.Flaky, "1", "#fe7d37"},
+		{badge.Quarantined, "2", "#dfb317"},
+	} {
+		b, err := badge.Build(registry(), tc.kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Message != tc.message || b.Color != tc.color {
+			t.Errorf("%s = %s %s, want %s %s", tc.kind, b.Message, b.Color, tc.message, tc.color)
+		}
+	}
+
+	b, _ := badge.Build([]*db.Tanda{{ID: "td-1", Status: "active"}}, badge.PassRate)
+	if b.Message != "no runs" {
+		t.Errorf("pass rate without runs = %s", b.Message)
+	}
+	if _, err := badge.Build(registry(), "coverage"); err == nil {
+		t.Error("unknown badge should fail")
+	}
+
+	svg := string(b.SVG())
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, "<title>tests: no runs</title>") {
+		t.Errorf("svg = %s", svg)
+	}
+}
+
+func TestWriteFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "badges")
+	written, err := badge.WriteFiles(dir, registry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != len(badge.Kinds) {
+		t.Fatalf("wrote %v", written)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "flaky.svg"))
+	if err != nil || !strings.Contains(string(data), "flaky: 1") {
+		t.Fatalf("flaky.svg = %s, %v", data, err)
+	}
+
+	// Only changed badges are rewritten
+	tandas := registry()
+	tandas[2].Status = "active"
+	written, err = badge.WriteFiles(dir, tandas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 2 || filepath.Base(written[0]) != "flaky.svg" || filepath.Base(written[1]) != "quarantined.svg" {
+		t.Errorf("rewrote %v, want flaky and quarantined", written)
+	}
+}
@@ -0,0 +1,165 @@
+// Package bisect narrows down the commit that broke a tanda from the git
+// SHAs recorded with its runs: where its latest failure streak began, the
+// last commit it passed on, and the commits in between, to start a git
+// bisect from
+package bisect
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// MaxCommits caps the commits listed between the last pass and the first
+// failure
+const MaxCommits = 200
+
+// Point is a run on one side of the break
+type Point struct {
+	Timestamp string `json:"ts"`
+	Commit    string `json:"commit"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Commit is a commit between the last pass and the first failure
+type Commit struct {
+	SHA     string `json:"sha"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+}
+
+// Result locates where a tanda's latest failure streak began. FirstFail is
+// the earliest failing run of the streak with a commit and LastPass the
+// latest passing run before it with one; either is nil when no such run
+// recorded a commit. Failing reports whether the streak is still going.
+type Result struct {
+	TandaID   string   `json:"tanda_id"`
+	Title     string   `json:"title"`
+	Failing   bool     `json:"failing"`
+	Failures  int      `json:"failures"`
+	FirstFail *Point   `json:"first_fail,omitempty"`
+	LastPass  *Point   `json:"last_pass,omitempty"`
+	Commits   []Commit `json:"commits"`
+	// Truncated is set when there were more than MaxCommits commits
+	Truncated bool `json:"truncated,omitempty"`
+	// Note explains why no commits are listed
+	Note string `json:"note,omitempty"`
+}
+
+// Locate finds the start of the tanda's latest failure streak, skipping
+// skipped runs and daily summaries. It lists no commits; Log does.
+func Locate(t *db.Tanda) *Result {
+	r := &Result{TandaID: t.ID, Title: t.Title, Commits: []Commit{}}
+	var runs []db.RunResult
+	for _, run := range t.RunHistory {
+		if run.Summary == nil && (run.Result == "pass" || run.Result == "fail") {
+			runs = append(runs, run)
+		}
+	}
+
+	// start is the first run of the latest streak of failures, end the
+	// run after its last
+	start, end := -1, len(runs)
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Result == "fail" {
+			start = i
+			continue
+		}
+		if start >= 0 {
+			break
+		}
+		end = i
+	}
+	if start < 0 {
+		r.Note = "no failures recorded"
+		return r
+	}
+	r.Failing = end == len(runs)
+	r.Failures = end - start
+
+	for _, run := range runs[start:end] {
+		if run.Commit != "" {
+			r.FirstFail = &Point{Timestamp: run.Timestamp, Commit: run.Commit, Error: run.Error}
+			break
+		}
+	}
+	for i := start - 1; i >= 0 && runs[i].Result == "pass"; i-- {
+		if runs[i].Commit != "" {
+			r.LastPass = &Point{Timestamp: runs[i].Timestamp, Commit: runs[i].Commit}
+			break
+		}
+	}
+	switch {
+	case start == 0:
+		r.Note = "the tanda has failed since its first recorded run"
+	case r.FirstFail == nil || r.LastPass == nil:
+		r.Note = "runs on one side of the break recorded no commit"
+	}
+	return r
+}
+
+// Log fills in the commits after the last pass up to and including the
+// first failure, oldest first, from the git repository at root. A failure
+// to read them is kept as the note rather than returned, since the two
+// points are still worth reporting.
+func (r *Result) Log(root string) {
+	if r.FirstFail == nil || r.LastPass == nil {
+		return
+	}
+	if r.FirstFail.Commit == r.LastPass.Commit {
+		r.Note = "the tanda passed and failed on the same commit, so it is likely flaky"
+		return
+	}
+	commits, err := gitLog(root, r.LastPass.Commit, r.FirstFail.Commit)
+	if err != nil {
+		r.Note = err.Error()
+		return
+	}
+	if len(commits) == 0 {
+		r.Note = "the first failing commit does not follow the last passing one"
+	}
+	if len(commits) > MaxCommits {
+		commits, r.Truncated = commits[len(commits)-MaxCommits:], true
+	}
+	r.Commits = commits
+}
+
+// gitLog lists the commits in from..to, oldest first
+func gitLog(root, from, to string) ([]Commit, error) {
+	cmd := exec.Command("git", "log", "--reverse", "--format=%H%x00%an%x00%aI%x00%s", from+".."+to, "--")
+	cmd.Dir = root
+	out, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+			return nil, fmt.Errorf("git log %s..%s: %s", from, to, strings.TrimSpace(string(ee.Stderr)))
+		}
+		return nil, fmt.Errorf("git log %s..%s: %w", from, to, err)
+	}
+	commits := []Commit{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\x00", 4)
+		if len(parts) != 4 {
+			continue
+		}
+		commits = append(commits, Commit{SHA: parts[0], Author: parts[1], Date: parts[2], Subject: parts[3]})
+	}
+	return commits, scanner.Err()
+}
+
+// Head returns the commit checked out at root
+func Head(root string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = root
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.New("not a git checkout")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,79 @@
+package bisect_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/bisect"
+	"github.com/tandas/daemon/internal/db"
+)
+
+func TestLocate(t *testing.T) {
+	run := func(result, commit string) db.RunResult {
+		return db.RunResult{Timestamp: "2025-06-01T10:00:00Z", Result: result, Commit: commit, Error: map[string]string{"fail": "boom"}[result]}
+	}
+	tanda := &db.Tanda{ID: "td-cart", Title: "Cart", RunHistory: []db.RunResult{
+		run("fail", "c0"), run("pass", "c1"), run("pass", "c2"), run("pass", ""),
+		run("fail", ""), run("skip", "c3"), run("fail", "c4"), run("fail", "c5"),
+	}}
+
+	r := bisect.Locate(tanda)
+	if !r.Failing || r.Failures != 3 || r.Note != "" {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	// The first failure without a commit is passed over, as is the pass
+	if r.FirstFail.Commit != "c4" || r.FirstFail.Error != "boom" || r.LastPass.Commit != "c2" {
+		t.Fatalf("first fail %+v, last pass %+v", r.FirstFail, r.LastPass)
+	}
+
+	tanda.RunHistory = append(tanda.RunHistory, run("pass", "c6"))
+	if r := bisect.Locate(tanda); r.Failing || r.Failures != 3 {
+		t.Fatalf("expected a finished streak, got %+v", r)
+	}
+	if r := bisect.Locate(&db.Tanda{RunHistory: []db.RunResult{run("pass", "c1")}}); r.FirstFail != nil || r.Note == "" {
+		t.Fatalf("expected no failures, got %+v", r)
+	}
+}
+
+func TestLog(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		cmd.Dir = root
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	var shas []string
+	for _, msg := range []string{"add cart", "tweak checkout", "break cart"} {
+		git("commit", "-q", "--allow-empty", "-m", msg)
+		shas = append(shas, git("rev-parse", "HEAD"))
+	}
+	if head, err := bisect.Head(root); err != nil || head != shas[2] {
+		t.Fatalf("head = %q, %v", head, err)
+	}
+
+	tanda := &db.Tanda{ID: "td-cart", RunHistory: []db.RunResult{
+		{Timestamp: "2025-06-01T10:00:00Z", Result: "pass", Commit: shas[0]},
+		{Timestamp: "2025-06-02T10:00:00Z", Result: "fail", Commit: shas[2]},
+	}}
+	r := bisect.Locate(tanda)
+	r.Log(root)
+	if len(r.Commits) != 2 || r.Commits[0].Subject != "tweak checkout" || r.Commits[1].SHA != shas[2] || r.Note != "" {
+		t.Fatalf("unexpected commits %+v (%s)", r.Commits, r.Note)
+	}
+
+	tanda.RunHistory[0].Commit = "0000000"
+	r = bisect.Locate(tanda)
+	r.Log(root)
+	if len(r.Commits) != 0 || !strings.Contains(r.Note, "git log") {
+		t.Fatalf("expected an unknown commit to be noted, got %+v", r)
+	}
+}
@@ -0,0 +1,180 @@
+// Package blobs stores note attachments content-addressed under
+// .tandas/blobs, so the evidence behind a note is committed with the
+// registry and identical files are kept once
+package blobs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// Dir holds blobs inside the .tandas dir, as <hex[:2]>/<hex[2:]>
+const Dir = "blobs"
+
+// DefaultMaxSize caps one attachment, 1 MiB
+const DefaultMaxSize = 1 << 20
+
+// hashPrefix marks the algorithm in Attachment.Hash
+const hashPrefix = "sha256:"
+
+// ErrTooLarge is returned by Put for data over the size limit
+var ErrTooLarge = errors.New("attachment is too large")
+
+// Put stores data read from r and returns the attachment referencing it.
+// Data over max bytes, DefaultMaxSize when zero, is refused with
+// ErrTooLarge. Storing a blob that
+// already exists refreshes its time, so collection gives the note that
+// will reference it the same grace as a new blob.
+func Put(dir, name string, r io.Reader, max int64) (db.Attachment, error) {
+	max = Limit(max)
+	blobDir := filepath.Join(dir, Dir)
+	if err := os.MkdirAll(blobDir, 0o755); err != nil {
+		return db.Attachment{}, fmt.Errorf("failed to create %s: %w", Dir, err)
+	}
+	tmp, err := os.CreateTemp(blobDir, ".blob-*.tmp")
+	if err != nil {
+		return db.Attachment{}, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	sniff := &prefixWriter{max: 512}
+	n, err := io.Copy(io.MultiWriter(tmp, h, sniff), io.LimitReader(r, max+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return db.Attachment{}, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	if n > max {
+		return db.Attachment{}, fmt.Errorf("%w: %s is over the %d byte limit", ErrTooLarge, name, max)
+	}
+
+	a := db.Attachment{
+		Name: filepath.Base(name),
+		Hash: hashPrefix + hex.EncodeToString(h.Sum(nil)),
+		Size: n,
+		Type: http.DetectContentType(sniff.buf),
+	}
+	path, _ := Path(dir, a.Hash)
+	if _, err := os.Stat(path); err == nil {
+		now := time.Now()
+		return a, os.Chtimes(path, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return db.Attachment{}, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return db.Attachment{}, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	return a, nil
+}
+
+// Limit returns max, or DefaultMaxSize when it is not positive
+func Limit(max int64) int64 {
+	if max > 0 {
+		return max
+	}
+	return DefaultMaxSize
+}
+
+// Path returns where the blob with hash is stored
+func Path(dir, hash string) (string, error) {
+	sum, ok := strings.CutPrefix(hash, hashPrefix)
+	if !ok || len(sum) != 2*sha256.Size || strings.Trim(sum, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid blob hash %q", hash)
+	}
+	return filepath.Join(dir, Dir, sum[:2], sum[2:]), nil
+}
+
+// Check returns an error unless the attachment's blob is stored with the
+// recorded size
+func Check(dir string, a db.Attachment) error {
+	path, err := Path(dir, a.Hash)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("attachment %s: blob %s is not stored", a.Name, a.Hash)
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() != a.Size {
+		return fmt.Errorf("attachment %s: blob is %d bytes, not %d", a.Name, info.Size(), a.Size)
+	}
+	return nil
+}
+
+// GCResult counts the blobs collection removed, or would remove
+type GCResult struct {
+	Blobs int   `json:"blobs"`
+	Bytes int64 `json:"bytes"`
+}
+
+// GC removes the blobs no note of tandas references that were last written
+// before cutoff; newer ones may belong to a note not yet saved. Temp files
+// left by interrupted writes go too.
+func GC(dir string, tandas []*db.Tanda, cutoff time.Time, dryRun bool) (*GCResult, error) {
+	keep := make(map[string]bool)
+	for _, t := range tandas {
+		for _, n := range t.Notes {
+			for _, a := range n.Attachments {
+				if path, err := Path(dir, a.Hash); err == nil {
+					keep[path] = true
+				}
+			}
+		}
+	}
+
+	result := &GCResult{}
+	root := filepath.Join(dir, Dir)
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == root {
+			return filepath.SkipDir
+		}
+		if err != nil || !d.Type().IsRegular() || keep[path] {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			return err
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove blob: %w", err)
+			}
+		}
+		result.Blobs++
+		result.Bytes += info.Size()
+		return nil
+	})
+	return result, err
+}
+
+// prefixWriter keeps the first max bytes written, for type detection
+type prefixWriter struct {
+	buf []byte
+	max int
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if room := w.max - len(w.buf); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		w.buf = append(w.buf, p[:room]...)
+	}
+	return len(p), nil
+}
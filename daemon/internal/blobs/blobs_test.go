@@ -0,0 +1,91 @@
+package blobs_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/blobs"
+	"github.com/tandas/daemon/internal/db"
+)
+
+func TestPut(t *testing.T) {
+	dir := t.TempDir()
+
+	a, err := blobs.Put(dir, "logs/tail.log", strings.NewReader("timeout waiting for #login\n"), 0)
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if a.Name != "tail.log" || a.Size != 27 || !strings.HasPrefix(a.Hash, "sha256:") || !strings.HasPrefix(a.Type, "text/plain") {
+		t.Fatalf("unexpected attachment %+v", a)
+	}
+	if err := blobs.Check(dir, a); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	path, _ := blobs.Path(dir, a.Hash)
+	if data, _ := os.ReadFile(path); string(data) != "timeout waiting for #login\n" {
+		t.Fatalf("expected the content stored at %s, got %q", path, data)
+	}
+
+	// The same content is stored once
+	again, err := blobs.Put(dir, "copy.log", strings.NewReader("timeout waiting for #login\n"), 0)
+	if err != nil || again.Hash != a.Hash {
+		t.Fatalf("expected the same hash, got %+v, %v", again, err)
+	}
+
+	if _, err := blobs.Put(dir, "big.png", strings.NewReader(strings.Repeat("x", 11)), 10); !errors.Is(err, blobs.ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+	if err := blobs.Check(dir, db.Attachment{Name: "x", Hash: a.Hash, Size: 3}); err == nil {
+		t.Error("expected a size mismatch to fail the check")
+	}
+	for _, bad := range []string{"", "sha256:abc", "md5:" + strings.Repeat("0", 64), "sha256:../" + strings.Repeat("0", 61)} {
+		if _, err := blobs.Path(dir, bad); err == nil {
+			t.Errorf("expected hash %q to be rejected", bad)
+		}
+	}
+}
+
+func TestGC(t *testing.T) {
+	dir := t.TempDir()
+	put := func(content string) db.Attachment {
+		a, err := blobs.Put(dir, "f", strings.NewReader(content), 0)
+		if err != nil {
+			t.Fatalf("put: %v", err)
+		}
+		return a
+	}
+	kept, orphan, fresh := put("kept"), put("orphan"), put("fresh")
+	old := time.Now().Add(-2 * time.Hour)
+	for _, a := range []db.Attachment{kept, orphan} {
+		path, _ := blobs.Path(dir, a.Hash)
+		os.Chtimes(path, old, old)
+	}
+	tandas := []*db.Tanda{{ID: "td-1", Notes: []db.Note{{Text: "see log", Attachments: []db.Attachment{kept}}}}}
+	cutoff := time.Now().Add(-time.Hour)
+
+	result, err := blobs.GC(dir, tandas, cutoff, true)
+	if err != nil || result.Blobs != 1 || result.Bytes != int64(len("orphan")) {
+		t.Fatalf("expected a dry run to count the orphan, got %+v, %v", result, err)
+	}
+	if err := blobs.Check(dir, orphan); err != nil {
+		t.Fatalf("expected a dry run to keep the orphan: %v", err)
+	}
+	if _, err := blobs.GC(dir, tandas, cutoff, false); err != nil {
+		t.Fatalf("gc: %v", err)
+	}
+	if err := blobs.Check(dir, orphan); err == nil {
+		t.Error("expected the old unreferenced blob removed")
+	}
+	for _, a := range []db.Attachment{kept, fresh} {
+		if err := blobs.Check(dir, a); err != nil {
+			t.Errorf("expected %s kept: %v", a.Hash, err)
+		}
+	}
+
+	if result, err := blobs.GC(t.TempDir(), nil, cutoff, false); err != nil || result.Blobs != 0 {
+		t.Fatalf("expected no blobs dir to be fine, got %+v, %v", result, err)
+	}
+}
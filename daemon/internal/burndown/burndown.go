@@ -0,0 +1,196 @@
+// Package burndown follows flaky-test debt over time: how many tandas sat
+// in quarantine at each point of a window, how many entered and left, and
+// how long they stayed, from the quarantine spans kept on each tanda
+package burndown
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// Defaults for the zero fields of Options
+const (
+	DefaultDays = 30
+	DefaultStep = 1
+)
+
+// oldestLimit is how many of the longest-quarantined tandas are listed
+const oldestLimit = 5
+
+const day = 24 * time.Hour
+
+// Options bound the window and how finely it is sampled
+type Options struct {
+	// Days is the length of the window, DefaultDays when zero
+	Days int `json:"days,omitempty"`
+	// Step is the days between points, DefaultStep when zero; 7 gives a
+	// weekly burn-down
+	Step int `json:"step,omitempty"`
+}
+
+// Point is the quarantine count at the end of a step, with the tandas that
+// entered and left quarantine during it
+type Point struct {
+	Date        string `json:"date"`
+	Quarantined int    `json:"quarantined"`
+	Entered     int    `json:"entered"`
+	Left        int    `json:"left"`
+}
+
+// Entry is a tanda still in quarantine
+type Entry struct {
+	ID      string   `json:"id"`
+	Title   string   `json:"title"`
+	Owners  []string `json:"owners,omitempty"`
+	Entered string   `json:"entered"`
+	Days    float64  `json:"days"`
+}
+
+// Report is the burn-down over a window. AverageDays is the mean time in
+// quarantine of the Resolved spans that closed in the window, and
+// OpenAverageDays the mean age of the spans still open.
+type Report struct {
+	Since           time.Time `json:"since"`
+	Until           time.Time `json:"until"`
+	Points          []Point   `json:"points"`
+	Quarantined     int       `json:"quarantined"`
+	Change          int       `json:"change"`
+	Entered         int       `json:"entered"`
+	Left            int       `json:"left"`
+	Resolved        int       `json:"resolved"`
+	AverageDays     float64   `json:"average_days"`
+	OpenAverageDays float64   `json:"open_average_days"`
+	Oldest          []Entry   `json:"oldest"`
+}
+
+// Check returns an error unless the options describe a window
+func (o Options) Check() error {
+	if o.Days < 0 || o.Step < 0 {
+		return fmt.Errorf("days and step must not be negative")
+	}
+	if o.Step > o.days() {
+		return fmt.Errorf("step of %d days is longer than the %d-day window", o.Step, o.days())
+	}
+	return nil
+}
+
+func (o Options) days() int {
+	if o.Days == 0 {
+		return DefaultDays
+	}
+	return o.Days
+}
+
+func (o Options) step() int {
+	if o.Step == 0 {
+		return DefaultStep
+	}
+	return o.Step
+}
+
+// span is a quarantine span with parsed times; left is zero while open
+type span struct {
+	t             *db.Tanda
+	q             db.Quarantine
+	entered, left time.Time
+}
+
+func (s span) in(at time.Time) bool {
+	return !s.entered.After(at) && (s.left.IsZero() || s.left.After(at))
+}
+
+// Build samples the quarantine count every Step days back from now over
+// the window. Spans with timestamps that do not parse are left out.
+func Build(tandas []*db.Tanda, opts Options, now time.Time) *Report {
+	days, step := opts.days(), opts.step()
+	r := &Report{Since: now.Add(-time.Duration(days) * day), Until: now, Points: []Point{}, Oldest: []Entry{}}
+
+	var spans []span
+	for _, t := range tandas {
+		for _, q := range t.Quarantines {
+			s := span{t: t, q: q}
+			var ok bool
+			if s.entered, ok = db.ParseTimestamp(q.Entered); !ok {
+				continue
+			}
+			if q.Left != "" {
+				if s.left, ok = db.ParseTimestamp(q.Left); !ok {
+					continue
+				}
+			}
+			spans = append(spans, s)
+		}
+	}
+
+	var resolved, open time.Duration
+	var opened int
+	for _, s := range spans {
+		if s.entered.After(r.Since) && !s.entered.After(now) {
+			r.Entered++
+		}
+		switch {
+		case s.left.IsZero():
+			open += now.Sub(s.entered)
+			opened++
+			r.Oldest = append(r.Oldest, Entry{ID: s.t.ID, Title: s.t.Title, Owners: s.t.Owners,
+				Entered: s.q.Entered, Days: roundDays(now.Sub(s.entered))})
+		case s.left.After(r.Since) && !s.left.After(now):
+			r.Left++
+			r.Resolved++
+			resolved += s.left.Sub(s.entered)
+		}
+	}
+	if r.Resolved > 0 {
+		r.AverageDays = roundDays(resolved / time.Duration(r.Resolved))
+	}
+	if opened > 0 {
+		r.OpenAverageDays = roundDays(open / time.Duration(opened))
+	}
+
+	// Points run from the start of the window to now, one per step
+	for k := days / step; k >= 0; k-- {
+		at := now.Add(-time.Duration(k*step) * day)
+		p := Point{Date: at.UTC().Format("2006-01-02")}
+		from := at.Add(-time.Duration(step) * day)
+		for _, s := range spans {
+			if s.in(at) {
+				p.Quarantined++
+			}
+			if s.entered.After(from) && !s.entered.After(at) {
+				p.Entered++
+			}
+			if !s.left.IsZero() && s.left.After(from) && !s.left.After(at) {
+				p.Left++
+			}
+		}
+		r.Points = append(r.Points, p)
+	}
+	r.Quarantined = r.Points[len(r.Points)-1].Quarantined
+	var before int
+	for _, s := range spans {
+		if s.in(r.Since) {
+			before++
+		}
+	}
+	r.Change = r.Quarantined - before
+
+	sort.Slice(r.Oldest, func(i, j int) bool {
+		if r.Oldest[i].Days != r.Oldest[j].Days {
+			return r.Oldest[i].Days > r.Oldest[j].Days
+		}
+		return r.Oldest[i].ID < r.Oldest[j].ID
+	})
+	if len(r.Oldest) > oldestLimit {
+		r.Oldest = r.Oldest[:oldestLimit]
+	}
+	return r
+}
+
+// roundDays converts d to days, to one decimal
+func roundDays(d time.Duration) float64 {
+	return math.Round(d.Hours()/24*10) / 10
+}
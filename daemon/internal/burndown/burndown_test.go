@@ -0,0 +1,51 @@
+package burndown_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/burndown"
+	"github.com/tandas/daemon/internal/db"
+)
+
+func TestBuild(t *testing.T) {
+	now := time.Date(2025, 6, 30, 12, 0, 0, 0, time.UTC)
+	ago := func(days int) string { return now.Add(-time.Duration(days) * 24 * time.Hour).Format(time.RFC3339) }
+
+	tandas := []*db.Tanda{
+		// Quarantined before the window and fixed in it
+		{ID: "td-cart", Title: "Cart", Quarantines: []db.Quarantine{{Entered: ago(40), Left: ago(10)}}},
+		// In and out within the window, then back in
+		{ID: "td-login", Title: "Login", Quarantines: []db.Quarantine{
+			{Entered: ago(20), Left: ago(18)}, {Entered: ago(3)}}},
+		// Quarantined before the window and still there
+		{ID: "td-search", Title: "Search", Owners: []string{"@org/search"}, Quarantines: []db.Quarantine{{Entered: ago(60)}}},
+		{ID: "td-home", Title: "Home"},
+	}
+
+	r := burndown.Build(tandas, burndown.Options{}, now)
+	if len(r.Points) != 31 || r.Points[0].Quarantined != 2 || r.Points[30].Quarantined != 2 {
+		t.Fatalf("unexpected points %+v", r.Points)
+	}
+	if p := r.Points[10]; p.Date != "2025-06-10" || p.Quarantined != 3 || p.Entered != 1 {
+		t.Fatalf("unexpected point on day 10: %+v", p)
+	}
+	if r.Quarantined != 2 || r.Change != 0 || r.Entered != 2 || r.Left != 2 || r.Resolved != 2 {
+		t.Fatalf("unexpected totals %+v", r)
+	}
+	// Cart stayed 30 days and Login 2
+	if r.AverageDays != 16 || r.OpenAverageDays != 31.5 {
+		t.Fatalf("average %v days, open for %v days", r.AverageDays, r.OpenAverageDays)
+	}
+	if len(r.Oldest) != 2 || r.Oldest[0].ID != "td-search" || r.Oldest[0].Days != 60 {
+		t.Fatalf("unexpected oldest %+v", r.Oldest)
+	}
+
+	weekly := burndown.Build(tandas, burndown.Options{Days: 28, Step: 7}, now)
+	if len(weekly.Points) != 5 || weekly.Points[2].Entered != 1 || weekly.Points[3].Left != 1 {
+		t.Fatalf("unexpected weekly points %+v", weekly.Points)
+	}
+	if err := (burndown.Options{Days: 7, Step: 14}).Check(); err == nil {
+		t.Error("expected a step longer than the window to be rejected")
+	}
+}
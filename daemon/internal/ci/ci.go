@@ -0,0 +1,54 @@
+package ci
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+)
+
+// TestCase is a single test result reported by a CI provider
+type TestCase struct {
+	Name      string
+	Classname string
+	File      string
+	Status    string // pass, fail or skip
+	Duration  time.Duration
+	Message   string
+}
+
+// Provider fetches test reports from a CI system and tracks quarantined
+// tandas as issues in that system's tracker
+type Provider interface {
+	Name() string
+	FetchTestReport(ctx context.Context, pipeline string) ([]TestCase, error)
+	OpenIssue(ctx context.Context, t *db.Tanda) (*db.IssueRef, error)
+	CloseIssue(ctx context.Context, ref *db.IssueRef) error
+}
+
+var providers = map[string]func(*config.Config) (Provider, error){
+	"gitlab": newGitLab,
+}
+
+// NewProvider returns the provider selected by ci.provider in config
+func NewProvider(cfg *config.Config) (Provider, error) {
+	name := cfg.CI.Provider
+	if name == "" {
+		return nil, fmt.Errorf("no CI provider configured (set ci.provider in %s)", config.FileName)
+	}
+
+	factory, ok := providers[name]
+	if !ok {
+		known := make([]string, 0, len(providers))
+		for k := range providers {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return nil, fmt.Errorf("unknown CI provider %q (known: %s)", name, strings.Join(known, ", "))
+	}
+	return factory(cfg)
+}
@@ -0,0 +1,266 @@
+package ci_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/ci"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/impact"
+	"github.com/tandas/daemon/internal/rundiff"
+)
+
+func TestGitLabIngestAndIssues(t *testing.T) {
+	var closed []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/group/app/pipelines/42/test_report", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawPath != "/api/v4/projects/group%2Fapp/pipelines/42/test_report" {
+			t.Errorf("expected escaped project path, got %q", r.URL.RawPath)
+		}
+		if r.Header.Get("PRIVATE-TOKEN") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"test_suites":[{"test_cases":[
+			{"name":"logs in","file":"./tests/login.spec.ts","status":"success","execution_time":1.5},
+			{"name":"logs out","file":"tests/login.spec.ts","status":"failed","execution_time":0.5,"system_output":"timeout waiting for #logout"},
+			{"name":"mystery","file":"tests/unknown.spec.ts","status":"success"}
+		]}]}`))
+	})
+	mux.HandleFunc("/api/v4/projects/group/app/issues", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"iid": 7, "web_url": "https://gitlab.example/issues/7"})
+	})
+	mux.HandleFunc("/api/v4/projects/group/app/issues/7", func(w http.ResponseWriter, r *http.Request) {
+		closed = append(closed, "7")
+		w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.CI.Provider = "gitlab"
+	cfg.CI.GitLab.URL = server.URL
+	cfg.CI.GitLab.Project = "group/app"
+	cfg.CI.GitLab.Token = "token"
+
+	provider, err := ci.NewProvider(cfg)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+
+	store := newStore(t)
+	now := time.Now().UTC().Format(time.RFC3339)
+	login := &db.Tanda{ID: "td-login", Title: "Login", Status: "active", File: "tests/login.spec.ts", CreatedAt: now, UpdatedAt: now}
+	if err := store.UpsertTanda(login); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	ctx := context.Background()
+	cases, err := provider.FetchTestReport(ctx, "42")
+	if err != nil {
+		t.Fatalf("fetch report: %v", err)
+	}
+	result, err := ci.Ingest(store, cases, "77")
+	if err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+	if len(result.Updated) != 1 || len(result.Unmatched) != 1 {
+		t.Fatalf("unexpected ingest result: %+v", result)
+	}
+
+	got, err := store.GetTanda("td-login")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(got.RunHistory) != 1 || got.RunHistory[0].Result != "fail" {
+		t.Fatalf("expected one failed run, got %+v", got.RunHistory)
+	}
+	if got.RunHistory[0].Error != "timeout waiting for #logout" {
+		t.Fatalf("expected failure message on run, got %q", got.RunHistory[0].Error)
+	}
+	if got.Status != "flaky" {
+		t.Fatalf("expected tanda to be auto-marked flaky, got %q", got.Status)
+	}
+
+	synced, err := ci.SyncIssues(ctx, store, provider)
+	if err != nil {
+		t.Fatalf("sync issues: %v", err)
+	}
+	if len(synced.Opened) != 1 {
+		t.Fatalf("expected one opened issue, got %+v", synced)
+	}
+
+	got.Status = "active"
+	if err := store.UpsertTanda(got); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	synced, err = ci.SyncIssues(ctx, store, provider)
+	if err != nil {
+		t.Fatalf("sync issues: %v", err)
+	}
+	if len(synced.Closed) != 1 || len(closed) != 1 {
+		t.Fatalf("expected issue 7 to be closed, got %+v", synced)
+	}
+}
+
+func TestNewProviderUnknown(t *testing.T) {
+	cfg := config.Default()
+	cfg.CI.Provider = "jenkins"
+	if _, err := ci.NewProvider(cfg); err == nil {
+		t.Fatalf("expected error for unknown provider")
+	}
+}
+
+func newStore(t *testing.T) *db.Store {
+	t.Helper()
+	store, err := db.Open(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestParseGoTestJSON(t *testing.T) {
+	out := `{"Action":"run","Package":"app/auth","Test":"TestLogin"}
+{"Action":"output","Package":"app/auth","Test":"TestLogin","Output":"    login_test.go:12: want 200, got 500\n"}
+{"Action":"fail","Package":"app/auth","Test":"TestLogin/admin","Elapsed":0.1}
+{"Action":"fail","Package":"app/auth","Test":"TestLogin","Elapsed":0.25}
+{"Action":"pass","Package":"app/auth","Test":"TestLogout","Elapsed":0.01}
+not json
+{"Action":"fail","Package":"app/auth","Elapsed":0.3}
+`
+	cases, err := ci.ParseGoTestJSON(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 2 {
+		t.Fatalf("expected the two top-level tests, got %+v", cases)
+	}
+	if cases[0].Name != "TestLogin" || cases[0].Status != "fail" || cases[0].Duration != 250*time.Millisecond {
+		t.Errorf("unexpected case %+v", cases[0])
+	}
+	if cases[0].Message != "login_test.go:12: want 200, got 500" {
+		t.Errorf("unexpected message %q", cases[0].Message)
+	}
+	if cases[1].Name != "TestLogout" || cases[1].Status != "pass" || cases[1].Classname != "app/auth" {
+		t.Errorf("unexpected case %+v", cases[1])
+	}
+}
+
+func TestParseJUnit(t *testing.T) {
+	report := `<testsuite name="pytest">
+  <testcase classname="tests.test_login" name="test_ok" file="tests/test_login.py" time="0.2"/>
+  <testcase classname="tests.test_login" name="test_bad" file="tests/test_login.py" time="0.1"><error>boom</error></testcase>
+  <testcase classname="tests.test_login" name="test_later" file="tests/test_login.py"><skipped/></testcase>
+</testsuite>`
+	cases, err := ci.ParseJUnit(strings.NewReader(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 3 || cases[1].Status != "fail" || cases[1].Message != "boom" || cases[2].Status != "skip" {
+		t.Fatalf("unexpected cases %+v", cases)
+	}
+	if _, err := ci.ParseJUnit(strings.NewReader("no report here")); err == nil {
+		t.Error("expected output without a report to fail")
+	}
+}
+
+func TestUpsertComment(t *testing.T) {
+	var comments []map[string]interface{}
+	var patched int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/org/app/issues/12/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodPost {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			c := map[string]interface{}{"id": 900 + len(comments), "body": body["body"], "html_url": "https://github.example/c"}
+			comments = append(comments, c)
+			json.NewEncoder(w).Encode(c)
+			return
+		}
+		json.NewEncoder(w).Encode(append([]map[string]interface{}{{"id": 1, "body": "LGTM"}}, comments...))
+	})
+	mux.HandleFunc("/repos/org/app/issues/comments/900", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		patched++
+		comments[0]["body"] = body["body"]
+		json.NewEncoder(w).Encode(comments[0])
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.CI.GitHub = config.GitHubConfig{URL: server.URL, Repo: "org/app", Token: "token"}
+	commenter, err := ci.NewCommenter(cfg, "github")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	affected := &impact.Result{
+		Changed: []string{"src/auth.go", "README.md"},
+		Tandas: []impact.Affected{{TandaID: "td-login", Title: "Login", Status: "active",
+			Reasons: []impact.Reason{{Kind: impact.Covers, Path: "src/auth.go", Cover: "src/auth.go"}}}},
+		Uncovered: []string{"README.md"},
+	}
+	diff := &rundiff.Diff{From: "41", To: "42", NewlyFailing: []rundiff.Entry{{ID: "td-login", Title: "Login", Error: "timeout"}}}
+	body := ci.PRSummary(affected, diff)
+	for _, part := range []string{ci.CommentMarker, "**1 tanda(s) affected** by 2 changed file(s); 1 changed file(s) not covered",
+		"| `td-login` Login | active | covers src/auth.go |", "#### Newly failing (1)"} {
+		if !strings.Contains(body, part) {
+			t.Errorf("summary lacks %q:\n%s", part, body)
+		}
+	}
+
+	ctx := context.Background()
+	c, updated, err := ci.UpsertComment(ctx, commenter, "12", body)
+	if err != nil || updated || c.ID != "900" {
+		t.Fatalf("first post = %+v, updated %v, %v", c, updated, err)
+	}
+	c, updated, err = ci.UpsertComment(ctx, commenter, "12", ci.PRSummary(affected, nil))
+	if err != nil || !updated || c.ID != "900" || patched != 1 || len(comments) != 1 {
+		t.Fatalf("second post = %+v, updated %v, patched %d, %d comments, %v", c, updated, patched, len(comments), err)
+	}
+	if strings.Contains(comments[0]["body"].(string), "Newly failing") {
+		t.Errorf("comment not replaced: %s", comments[0]["body"])
+	}
+}
+
+func TestGitLabComments(t *testing.T) {
+	var put string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/group/app/merge_requests/5/notes", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id": 3, "body": "` + ci.CommentMarker + ` old"}]`))
+	})
+	mux.HandleFunc("/api/v4/projects/group/app/merge_requests/5/notes/3", func(w http.ResponseWriter, r *http.Request) {
+		put = r.Method
+		w.Write([]byte(`{"id": 3, "body": "new"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.CI.Provider = "gitlab"
+	cfg.CI.GitLab.URL = server.URL
+	cfg.CI.GitLab.Project = "group/app"
+	cfg.CI.GitLab.Token = "token"
+	commenter, err := ci.NewCommenter(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, updated, err := ci.UpsertComment(context.Background(), commenter, "5", "new"); err != nil || !updated || put != http.MethodPut {
+		t.Fatalf("updated %v, method %q, %v", updated, put, err)
+	}
+}
@@ -0,0 +1,141 @@
+package ci
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/impact"
+	"github.com/tandas/daemon/internal/rundiff"
+)
+
+// CommentMarker tags the pull request comment Tandas maintains, so later
+// runs update it instead of adding another
+const CommentMarker = "<!-- tandas:pr-summary -->"
+
+// maxAffected caps the affected tandas listed in a comment
+const maxAffected = 50
+
+// Comment is a comment on a pull or merge request
+type Comment struct {
+	ID   string
+	Body string
+	URL  string
+}
+
+// Commenter reads and writes the comments of a pull or merge request,
+// named by its number
+type Commenter interface {
+	Name() string
+	Comments(ctx context.Context, pr string) ([]Comment, error)
+	CreateComment(ctx context.Context, pr, body string) (*Comment, error)
+	UpdateComment(ctx context.Context, pr, id, body string) (*Comment, error)
+}
+
+var commenters = map[string]func(*config.Config) (Commenter, error){
+	"github": newGitHubCommenter,
+	"gitlab": func(cfg *config.Config) (Commenter, error) {
+		p, err := newGitLab(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return p.(*GitLab), nil
+	},
+}
+
+// NewCommenter returns the commenter for the named provider, or for
+// ci.provider in config when name is empty
+func NewCommenter(cfg *config.Config, name string) (Commenter, error) {
+	if name == "" {
+		name = cfg.CI.Provider
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no CI provider configured (set ci.provider in %s)", config.FileName)
+	}
+	factory, ok := commenters[name]
+	if !ok {
+		known := make([]string, 0, len(commenters))
+		for k := range commenters {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return nil, fmt.Errorf("unknown pull request provider %q (known: %s)", name, strings.Join(known, ", "))
+	}
+	return factory(cfg)
+}
+
+// UpsertComment posts body on the pull request, replacing the comment an
+// earlier run left there. It reports whether a comment was updated.
+func UpsertComment(ctx context.Context, c Commenter, pr, body string) (*Comment, bool, error) {
+	if !strings.Contains(body, CommentMarker) {
+		body = CommentMarker + "\n" + body
+	}
+	comments, err := c.Comments(ctx, pr)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, existing := range comments {
+		if strings.Contains(existing.Body, CommentMarker) {
+			if existing.Body == body {
+				return &existing, true, nil
+			}
+			updated, err := c.UpdateComment(ctx, pr, existing.ID, body)
+			return updated, true, err
+		}
+	}
+	created, err := c.CreateComment(ctx, pr, body)
+	return created, false, err
+}
+
+// PRSummary renders the pull request comment: the tandas the change
+// affects, and, when diff is set, how test health moved over its runs,
+// with the tandas it newly broke or fixed and quarantine changes
+func PRSummary(affected *impact.Result, diff *rundiff.Diff) string {
+	var b strings.Builder
+	b.WriteString(CommentMarker + "\n## Tandas\n\n")
+
+	switch {
+	case affected == nil:
+	case len(affected.Changed) == 0:
+		b.WriteString("No changed files.\n")
+	default:
+		fmt.Fprintf(&b, "**%d tanda(s) affected** by %d changed file(s)", len(affected.Tandas), len(affected.Changed))
+		if n := len(affected.Uncovered); n > 0 {
+			fmt.Fprintf(&b, "; %d changed file(s) not covered by any tanda", n)
+		}
+		b.WriteString(".\n")
+		if len(affected.Tandas) > 0 {
+			b.WriteString("\n| Tanda | Status | Why |\n|---|---|---|\n")
+			for i, a := range affected.Tandas {
+				if i == maxAffected {
+					fmt.Fprintf(&b, "\n…and %d more.\n", len(affected.Tandas)-maxAffected)
+					break
+				}
+				reasons := make([]string, 0, len(a.Reasons))
+				for _, r := range a.Reasons {
+					reasons = append(reasons, r.String())
+				}
+				fmt.Fprintf(&b, "| `%s` %s | %s | %s |\n", a.TandaID, cell(a.Title), a.Status, cell(strings.Join(reasons, ", ")))
+			}
+		}
+		if len(affected.Uncovered) > 0 {
+			b.WriteString("\n<details><summary>Not covered by any tanda</summary>\n\n")
+			for _, p := range affected.Uncovered {
+				fmt.Fprintf(&b, "- `%s`\n", p)
+			}
+			b.WriteString("\n</details>\n")
+		}
+	}
+
+	if diff != nil {
+		b.WriteString("\n" + diff.Markdown())
+	}
+	return b.String()
+}
+
+// cell keeps s on one line of a Markdown table
+func cell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
@@ -0,0 +1,146 @@
+package ci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+)
+
+// GitHub talks to the GitHub REST API. It only comments on pull requests;
+// test reports and issues stay with ci ingest's providers.
+type GitHub struct {
+	baseURL string
+	repo    string
+	token   string
+	client  *http.Client
+}
+
+func newGitHubCommenter(cfg *config.Config) (Commenter, error) {
+	gh := cfg.CI.GitHub
+	if gh.Repo == "" {
+		gh.Repo = os.Getenv("GITHUB_REPOSITORY")
+	}
+	if gh.Token == "" {
+		gh.Token = os.Getenv("GITHUB_TOKEN")
+	}
+	if gh.Repo == "" {
+		return nil, fmt.Errorf("github: ci.github.repo or GITHUB_REPOSITORY is required")
+	}
+	if gh.Token == "" {
+		return nil, fmt.Errorf("github: ci.github.token or GITHUB_TOKEN is required")
+	}
+	if gh.URL == "" {
+		gh.URL = "https://api.github.com"
+	}
+
+	return &GitHub{
+		baseURL: strings.TrimRight(gh.URL, "/"),
+		repo:    gh.Repo,
+		token:   gh.Token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Name returns the provider name
+func (g *GitHub) Name() string {
+	return "github"
+}
+
+type githubComment struct {
+	ID      int64  `json:"id"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+}
+
+func (c githubComment) comment() *Comment {
+	return &Comment{ID: strconv.FormatInt(c.ID, 10), Body: c.Body, URL: c.HTMLURL}
+}
+
+// Comments lists the pull request's conversation comments, oldest first
+func (g *GitHub) Comments(ctx context.Context, pr string) ([]Comment, error) {
+	var comments []Comment
+	for page := 1; ; page++ {
+		var batch []githubComment
+		path := fmt.Sprintf("/issues/%s/comments?per_page=100&page=%d", url.PathEscape(pr), page)
+		if err := g.do(ctx, http.MethodGet, path, nil, &batch); err != nil {
+			return nil, err
+		}
+		for _, c := range batch {
+			comments = append(comments, *c.comment())
+		}
+		if len(batch) < 100 {
+			return comments, nil
+		}
+	}
+}
+
+// CreateComment adds a comment to the pull request
+func (g *GitHub) CreateComment(ctx context.Context, pr, body string) (*Comment, error) {
+	var c githubComment
+	path := fmt.Sprintf("/issues/%s/comments", url.PathEscape(pr))
+	if err := g.do(ctx, http.MethodPost, path, map[string]string{"body": body}, &c); err != nil {
+		return nil, err
+	}
+	return c.comment(), nil
+}
+
+// UpdateComment replaces a comment's body
+func (g *GitHub) UpdateComment(ctx context.Context, pr, id, body string) (*Comment, error) {
+	var c githubComment
+	if err := g.do(ctx, http.MethodPatch, "/issues/comments/"+url.PathEscape(id), map[string]string{"body": body}, &c); err != nil {
+		return nil, err
+	}
+	return c.comment(), nil
+}
+
+func (g *GitHub) do(ctx context.Context, method, path string, body, out interface{}) error {
+	endpoint := fmt.Sprintf("%s/repos/%s%s", g.baseURL, g.repo, path)
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("github: failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("github: failed to build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("github: %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("github: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("github: failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package ci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+)
+
+// GitLab talks to the GitLab REST API (v4)
+type GitLab struct {
+	baseURL string
+	project string
+	token   string
+	labels  []string
+	client  *http.Client
+}
+
+func newGitLab(cfg *config.Config) (Provider, error) {
+	gl := cfg.CI.GitLab
+	if gl.Project == "" {
+		return nil, fmt.Errorf("gitlab: ci.gitlab.project is required")
+	}
+	if gl.Token == "" {
+		return nil, fmt.Errorf("gitlab: ci.gitlab.token is required")
+	}
+
+	return &GitLab{
+		baseURL: strings.TrimRight(gl.URL, "/"),
+		project: gl.Project,
+		token:   gl.Token,
+		labels:  gl.Labels,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Name returns the provider name
+func (g *GitLab) Name() string {
+	return "gitlab"
+}
+
+type gitlabTestReport struct {
+	TestSuites []struct {
+		TestCases []struct {
+			Name          string  `json:"name"`
+			Classname     string  `json:"classname"`
+			File          string  `json:"file"`
+			Status        string  `json:"status"`
+			ExecutionTime float64 `json:"execution_time"`
+			SystemOutput  string  `json:"system_output"`
+		} `json:"test_cases"`
+	} `json:"test_suites"`
+}
+
+// FetchTestReport downloads the JUnit-derived test report for a pipeline
+func (g *GitLab) FetchTestReport(ctx context.Context, pipeline string) ([]TestCase, error) {
+	var report gitlabTestReport
+	path := fmt.Sprintf("/pipelines/%s/test_report", url.PathEscape(pipeline))
+	if err := g.do(ctx, http.MethodGet, path, nil, &report); err != nil {
+		return nil, err
+	}
+
+	var cases []TestCase
+	for _, suite := range report.TestSuites {
+		for _, tc := range suite.TestCases {
+			cases = append(cases, TestCase{
+				Name:      tc.Name,
+				Classname: tc.Classname,
+				File:      tc.File,
+				Status:    gitlabStatus(tc.Status),
+				Duration:  time.Duration(tc.ExecutionTime * float64(time.Second)),
+				Message:   tc.SystemOutput,
+			})
+		}
+	}
+	return cases, nil
+}
+
+// OpenIssue creates an issue describing a quarantined tanda
+func (g *GitLab) OpenIssue(ctx context.Context, t *db.Tanda) (*db.IssueRef, error) {
+	body := map[string]string{
+		"title":       fmt.Sprintf("Quarantined test: %s (%s)", t.Title, t.ID),
+		"description": issueDescription(t),
+		"labels":      strings.Join(g.labels, ","),
+	}
+
+	var issue struct {
+		IID    int    `json:"iid"`
+		WebURL string `json:"web_url"`
+	}
+	if err := g.do(ctx, http.MethodPost, "/issues", body, &issue); err != nil {
+		return nil, err
+	}
+
+	return &db.IssueRef{
+		TandaID:  t.ID,
+		Provider: g.Name(),
+		IssueID:  strconv.Itoa(issue.IID),
+		URL:      issue.WebURL,
+	}, nil
+}
+
+// CloseIssue closes a previously opened issue
+func (g *GitLab) CloseIssue(ctx context.Context, ref *db.IssueRef) error {
+	body := map[string]string{"state_event": "close"}
+	return g.do(ctx, http.MethodPut, "/issues/"+url.PathEscape(ref.IssueID), body, nil)
+}
+
+type gitlabNote struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+}
+
+func (n gitlabNote) comment() *Comment {
+	return &Comment{ID: strconv.FormatInt(n.ID, 10), Body: n.Body}
+}
+
+// Comments lists the merge request's notes, system notes included
+func (g *GitLab) Comments(ctx context.Context, mr string) ([]Comment, error) {
+	var comments []Comment
+	for page := 1; ; page++ {
+		var batch []gitlabNote
+		path := fmt.Sprintf("/merge_requests/%s/notes?per_page=100&page=%d", url.PathEscape(mr), page)
+		if err := g.do(ctx, http.MethodGet, path, nil, &batch); err != nil {
+			return nil, err
+		}
+		for _, n := range batch {
+			comments = append(comments, *n.comment())
+		}
+		if len(batch) < 100 {
+			return comments, nil
+		}
+	}
+}
+
+// CreateComment adds a note to the merge request
+func (g *GitLab) CreateComment(ctx context.Context, mr, body string) (*Comment, error) {
+	var n gitlabNote
+	path := fmt.Sprintf("/merge_requests/%s/notes", url.PathEscape(mr))
+	if err := g.do(ctx, http.MethodPost, path, map[string]string{"body": body}, &n); err != nil {
+		return nil, err
+	}
+	return n.comment(), nil
+}
+
+// UpdateComment replaces a note's body
+func (g *GitLab) UpdateComment(ctx context.Context, mr, id, body string) (*Comment, error) {
+	var n gitlabNote
+	path := fmt.Sprintf("/merge_requests/%s/notes/%s", url.PathEscape(mr), url.PathEscape(id))
+	if err := g.do(ctx, http.MethodPut, path, map[string]string{"body": body}, &n); err != nil {
+		return nil, err
+	}
+	return n.comment(), nil
+}
+
+func (g *GitLab) do(ctx context.Context, method, path string, body, out interface{}) error {
+	endpoint := fmt.Sprintf("%s/api/v4/projects/%s%s", g.baseURL, url.PathEscape(g.project), path)
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("gitlab: failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("gitlab: failed to build request: %w", err)
+	}
+	req.Header.Set("PRIVATE-TOKEN", g.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gitlab: %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("gitlab: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("gitlab: failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func gitlabStatus(status string) string {
+	switch status {
+	case "success":
+		return "pass"
+	case "failed", "error":
+		return "fail"
+	default:
+		return "skip"
+	}
+}
+
+func issueDescription(t *db.Tanda) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Tanda `%s` is quarantined (status: %s).\n\n", t.ID, t.Status)
+	if t.File != "" {
+		fmt.Fprintf(&b, "File: `%s`\n\n", t.File)
+	}
+
+	start := len(t.RunHistory) - 10
+	if start < 0 {
+		start = 0
+	}
+	if recent := t.RunHistory[start:]; len(recent) > 0 {
+		b.WriteString("Recent runs:\n")
+		for _, run := range recent {
+			fmt.Fprintf(&b, "- %s %s\n", run.Timestamp, run.Result)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package ci
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/environment"
+)
+
+// IngestResult summarizes how a test report was applied to the registry
+type IngestResult struct {
+	Updated   []string `json:"updated"`
+	Unmatched []string `json:"unmatched"`
+}
+
+// Run is the run a test report gives one tanda
+type Run struct {
+	Tanda *db.Tanda
+	Run   db.RunResult
+}
+
+// Ingest records one run per tanda from a provider's test cases, as
+// matched by Runs, in the given batch (usually the pipeline ID) and
+// stamped with the CI environment ingesting them
+func Ingest(store *db.Store, cases []TestCase, batch string) (*IngestResult, error) {
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tandas: %w", err)
+	}
+
+	runs, unmatched := Runs(tandas, cases, time.Now())
+	result := &IngestResult{Updated: []string{}, Unmatched: unmatched}
+	for _, r := range runs {
+		r.Run.Batch = batch
+		environment.Stamp(&r.Run, os.Getenv)
+		r.Tanda.AddRun(r.Run)
+		if err := store.UpsertTanda(r.Tanda); err != nil {
+			return result, fmt.Errorf("failed to update tanda %s: %w", r.Tanda.ID, err)
+		}
+		result.Updated = append(result.Updated, r.Tanda.ID)
+	}
+
+	return result, nil
+}
+
+// Runs works out one run per tanda from test cases, in the order the
+// tandas first appear, and returns the names of the cases no tanda
+// matched. Cases are matched to tandas by file, then by a file path ending
+// in the case's (a runner may report paths relative to its test dir), then
+// by title or ID; a tanda fails the run if any of its cases failed.
+// Skipped cases are ignored.
+func Runs(tandas []*db.Tanda, cases []TestCase, now time.Time) ([]Run, []string) {
+	byFile := make(map[string]*db.Tanda)
+	byName := make(map[string]*db.Tanda)
+	for _, t := range tandas {
+		if t.File != "" {
+			byFile[normalizePath(t.File)] = t
+		}
+		byName[t.Title] = t
+		byName[t.ID] = t
+	}
+
+	type aggregate struct {
+		tanda    *db.Tanda
+		failed   bool
+		message  string
+		duration time.Duration
+	}
+	runs := make(map[string]*aggregate)
+	var order []string
+	unmatched := []string{}
+
+	for _, c := range cases {
+		if c.Status == "skip" {
+			continue
+		}
+
+		t := byFile[normalizePath(c.File)]
+		if t == nil {
+			t = bySuffix(tandas, normalizePath(c.File))
+		}
+		if t == nil {
+			t = byName[c.Name]
+		}
+		if t == nil {
+			unmatched = append(unmatched, c.Name)
+			continue
+		}
+
+		agg, ok := runs[t.ID]
+		if !ok {
+			agg = &aggregate{tanda: t}
+			runs[t.ID] = agg
+			order = append(order, t.ID)
+		}
+		if c.Status == "fail" {
+			agg.failed = true
+			if agg.message == "" {
+				agg.message = c.Message
+			}
+		}
+		agg.duration += c.Duration
+	}
+
+	ts := now.UTC().Format(time.RFC3339)
+	out := make([]Run, 0, len(order))
+	for _, id := range order {
+		agg := runs[id]
+		run := db.RunResult{Timestamp: ts, Result: "pass"}
+		if agg.failed {
+			run.Result = "fail"
+			run.Error = agg.message
+		}
+		if agg.duration > 0 {
+			run.Duration = agg.duration.String()
+		}
+		out = append(out, Run{Tanda: agg.tanda, Run: run})
+	}
+	return out, unmatched
+}
+
+// bySuffix returns the one tanda whose file ends in /file, or nil when
+// none or several do
+func bySuffix(tandas []*db.Tanda, file string) *db.Tanda {
+	if file == "" || file == "." {
+		return nil
+	}
+	var found *db.Tanda
+	for _, t := range tandas {
+		if strings.HasSuffix(normalizePath(t.File), "/"+file) {
+			if found != nil {
+				return nil
+			}
+			found = t
+		}
+	}
+	return found
+}
+
+func normalizePath(p string) string {
+	if p == "" {
+		return ""
+	}
+	return filepath.ToSlash(filepath.Clean(p))
+}
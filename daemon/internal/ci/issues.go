@@ -0,0 +1,69 @@
+package ci
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// IssueSyncResult lists the issues opened and closed by SyncIssues
+type IssueSyncResult struct {
+	Opened []string `json:"opened"`
+	Closed []string `json:"closed"`
+}
+
+// SyncIssues opens an issue for every quarantined tanda that lacks one and
+// closes issues for tandas that have left quarantine or been deleted
+func SyncIssues(ctx context.Context, store *db.Store, p Provider) (*IssueSyncResult, error) {
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tandas: %w", err)
+	}
+	refs, err := store.ListIssueRefs(p.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load issue links: %w", err)
+	}
+
+	linked := make(map[string]*db.IssueRef, len(refs))
+	for _, ref := range refs {
+		linked[ref.TandaID] = ref
+	}
+
+	result := &IssueSyncResult{Opened: []string{}, Closed: []string{}}
+	quarantined := make(map[string]bool)
+
+	for _, t := range tandas {
+		if !db.IsQuarantined(t.Status) {
+			continue
+		}
+		quarantined[t.ID] = true
+		if linked[t.ID] != nil {
+			continue
+		}
+
+		ref, err := p.OpenIssue(ctx, t)
+		if err != nil {
+			return result, fmt.Errorf("failed to open issue for %s: %w", t.ID, err)
+		}
+		if err := store.SaveIssueRef(ref); err != nil {
+			return result, fmt.Errorf("failed to record issue for %s: %w", t.ID, err)
+		}
+		result.Opened = append(result.Opened, t.ID)
+	}
+
+	for _, ref := range refs {
+		if quarantined[ref.TandaID] {
+			continue
+		}
+		if err := p.CloseIssue(ctx, ref); err != nil {
+			return result, fmt.Errorf("failed to close issue for %s: %w", ref.TandaID, err)
+		}
+		if err := store.DeleteIssueRef(ref.TandaID, p.Name()); err != nil {
+			return result, fmt.Errorf("failed to unlink issue for %s: %w", ref.TandaID, err)
+		}
+		result.Closed = append(result.Closed, ref.TandaID)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,148 @@
+package ci
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxMessageLines caps the output kept as a failed go test's message
+const maxMessageLines = 20
+
+type junitSuite struct {
+	Name   string       `xml:"name,attr"`
+	File   string       `xml:"file,attr"`
+	Suites []junitSuite `xml:"testsuite"`
+	Cases  []junitCase  `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	Error     *junitFailure `xml:"error"`
+	Skipped   *struct{}     `xml:"skipped"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// ParseJUnit reads a JUnit XML report, rooted at testsuites or a single
+// testsuite, as written by Playwright, pytest, Jest and most other
+// runners. Anything before the XML, such as a runner's progress on the
+// same stdout, is skipped.
+func ParseJUnit(r io.Reader) ([]TestCase, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JUnit report: %w", err)
+	}
+	start := bytes.Index(data, []byte("<testsuite"))
+	if start < 0 {
+		return nil, fmt.Errorf("no JUnit testsuite found in report")
+	}
+	var root junitSuite
+	if err := xml.Unmarshal(data[start:], &root); err != nil {
+		return nil, fmt.Errorf("failed to parse JUnit report: %w", err)
+	}
+	var cases []TestCase
+	collectJUnit(root, "", &cases)
+	return cases, nil
+}
+
+// collectJUnit flattens nested suites; a suite named after a file, as
+// Playwright's are, stands in for the file its cases don't give
+func collectJUnit(s junitSuite, file string, out *[]TestCase) {
+	switch {
+	case s.File != "":
+		file = s.File
+	case filepath.Ext(s.Name) != "" && !strings.Contains(s.Name, " "):
+		file = s.Name
+	}
+	for _, c := range s.Cases {
+		tc := TestCase{Name: c.Name, Classname: c.Classname, File: c.File, Status: "pass"}
+		if tc.File == "" {
+			tc.File = file
+		}
+		if secs, err := strconv.ParseFloat(c.Time, 64); err == nil {
+			tc.Duration = time.Duration(secs * float64(time.Second))
+		}
+		switch {
+		case c.Failure != nil:
+			tc.Status, tc.Message = "fail", failureMessage(c.Failure)
+		case c.Error != nil:
+			tc.Status, tc.Message = "fail", failureMessage(c.Error)
+		case c.Skipped != nil:
+			tc.Status = "skip"
+		}
+		*out = append(*out, tc)
+	}
+	for _, child := range s.Suites {
+		collectJUnit(child, file, out)
+	}
+}
+
+func failureMessage(f *junitFailure) string {
+	if f.Message != "" {
+		return f.Message
+	}
+	return strings.TrimSpace(f.Text)
+}
+
+// goTestEvent is one line of go test -json output
+type goTestEvent struct {
+	Action  string  `json:"Action"`
+	Package string  `json:"Package"`
+	Test    string  `json:"Test"`
+	Elapsed float64 `json:"Elapsed"`
+	Output  string  `json:"Output"`
+}
+
+// ParseGoTestJSON reads go test -json output into one case per top-level
+// test, named after the test function and classed by package. Subtests
+// count towards their parent, and lines that aren't JSON are skipped.
+func ParseGoTestJSON(r io.Reader) ([]TestCase, error) {
+	var cases []TestCase
+	output := make(map[string][]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e goTestEvent
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Test == "" || strings.Contains(e.Test, "/") {
+			continue
+		}
+		key := e.Package + " " + e.Test
+		switch e.Action {
+		case "output":
+			if lines := output[key]; len(lines) < maxMessageLines {
+				output[key] = append(lines, strings.TrimRight(e.Output, "\n"))
+			}
+		case "pass", "fail", "skip":
+			tc := TestCase{
+				Name:      e.Test,
+				Classname: e.Package,
+				Status:    e.Action,
+				Duration:  time.Duration(e.Elapsed * float64(time.Second)),
+			}
+			if e.Action == "fail" {
+				tc.Message = strings.TrimSpace(strings.Join(output[key], "\n"))
+			}
+			delete(output, key)
+			cases = append(cases, tc)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read go test output: %w", err)
+	}
+	return cases, nil
+}
@@ -0,0 +1,94 @@
+package cluster
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// maxSignature caps the length of a signature so long stack traces still
+// group by their leading frames
+const maxSignature = 300
+
+// Cluster is a group of tandas whose latest failure has the same signature
+type Cluster struct {
+	ID        string   `json:"id"`
+	Signature string   `json:"signature"`
+	Example   string   `json:"example"`
+	TandaIDs  []string `json:"tanda_ids"`
+}
+
+// Order matters: timestamps and UUIDs must be replaced before their digits
+// are swallowed by the line number and generic number rules
+var normalizers = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<ts>"},
+	{regexp.MustCompile(`\b\d{2}:\d{2}:\d{2}(\.\d+)?\b`), "<ts>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`), "<addr>"},
+	{regexp.MustCompile(`:\d+(:\d+)?\b`), ":<line>"},
+	{regexp.MustCompile(`(?i)\bline \d+\b`), "line <line>"},
+	{regexp.MustCompile(`\b\d+(\.\d+)?(ms|s|m|h)?\b`), "<n>"},
+	{regexp.MustCompile(`\s+`), " "},
+}
+
+// Signature normalizes a failure message by stripping line numbers, memory
+// addresses, timestamps and other values that differ between occurrences of
+// the same failure
+func Signature(message string) string {
+	sig := message
+	for _, n := range normalizers {
+		sig = n.re.ReplaceAllString(sig, n.repl)
+	}
+	sig = strings.TrimSpace(sig)
+	if r := []rune(sig); len(r) > maxSignature {
+		sig = string(r[:maxSignature])
+	}
+	return sig
+}
+
+// Build groups tandas whose latest run failed by the signature of its error,
+// largest clusters first. Clusters smaller than minSize are dropped.
+func Build(tandas []*db.Tanda, minSize int) []Cluster {
+	bySig := make(map[string]*Cluster)
+	for _, t := range tandas {
+		if len(t.RunHistory) == 0 {
+			continue
+		}
+		last := t.RunHistory[len(t.RunHistory)-1]
+		if last.Result != "fail" || strings.TrimSpace(last.Error) == "" {
+			continue
+		}
+
+		sig := Signature(last.Error)
+		c, ok := bySig[sig]
+		if !ok {
+			sum := sha1.Sum([]byte(sig))
+			c = &Cluster{ID: hex.EncodeToString(sum[:])[:8], Signature: sig, Example: last.Error}
+			bySig[sig] = c
+		}
+		c.TandaIDs = append(c.TandaIDs, t.ID)
+	}
+
+	clusters := []Cluster{}
+	for _, c := range bySig {
+		if len(c.TandaIDs) < minSize {
+			continue
+		}
+		sort.Strings(c.TandaIDs)
+		clusters = append(clusters, *c)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].TandaIDs) != len(clusters[j].TandaIDs) {
+			return len(clusters[i].TandaIDs) > len(clusters[j].TandaIDs)
+		}
+		return clusters[i].Signature < clusters[j].Signature
+	})
+	return clusters
+}
@@ -0,0 +1,43 @@
+package cluster_test
+
+import (
+	"testing"
+
+	"github.com/tandas/daemon/internal/cluster"
+	"github.com/tandas/daemon/internal/db"
+)
+
+func TestSignatureStripsVolatileParts(t *testing.T) {
+	a := cluster.Signature("2024-05-01T10:00:00Z dial tcp 10.0.0.1:5432: connection refused at db.go:42 (0xc000123abc)")
+	b := cluster.Signature("2024-05-02T11:30:12Z dial tcp 10.0.0.1:5432: connection refused at db.go:57 (0xc000999fff)")
+	if a != b {
+		t.Fatalf("expected equal signatures:\n%s\n%s", a, b)
+	}
+	if c := cluster.Signature("expected 200, got 500"); c == a {
+		t.Fatalf("expected different failures to differ, got %q", c)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	fail := func(id, msg string) *db.Tanda {
+		return &db.Tanda{ID: id, RunHistory: []db.RunResult{{Result: "fail", Error: msg}}}
+	}
+	tandas := []*db.Tanda{
+		fail("td-b", "ECONNREFUSED 127.0.0.1:5432 after 3012ms"),
+		fail("td-a", "ECONNREFUSED 127.0.0.1:5432 after 2999ms"),
+		fail("td-c", "assertion failed: want 3 items"),
+		{ID: "td-d", RunHistory: []db.RunResult{{Result: "fail", Error: "ECONNREFUSED 127.0.0.1:5432 after 1ms"}, {Result: "pass"}}},
+	}
+
+	clusters := cluster.Build(tandas, 1)
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %+v", clusters)
+	}
+	if got := clusters[0].TandaIDs; len(got) != 2 || got[0] != "td-a" || got[1] != "td-b" {
+		t.Fatalf("expected td-a and td-b clustered first, got %v", got)
+	}
+
+	if clusters := cluster.Build(tandas, 2); len(clusters) != 1 {
+		t.Fatalf("expected singleton cluster dropped, got %+v", clusters)
+	}
+}
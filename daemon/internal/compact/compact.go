@@ -0,0 +1,309 @@
+// Package compact does the periodic housekeeping of a .tandas directory:
+// the trace inbox, files left by interrupted writes, old snapshots, old
+// trace files, unreferenced attachments and the database file.
+package compact
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/blobs"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/snapshot"
+)
+
+const (
+	// DefaultTraceDays is how long unreferenced trace files are kept
+	DefaultTraceDays = 30
+	// DefaultKeepSnapshots is how many snapshots are kept
+	DefaultKeepSnapshots = 10
+
+	inboxFile = "trace_inbox.jsonl"
+	traceDir  = "test-results"
+	dbFile    = "db.sqlite"
+	// leftovers younger than this may belong to a write still in progress
+	leftoverAge = time.Hour
+)
+
+// Options bound what compaction removes; zero keeps everything of a kind
+type Options struct {
+	TraceDays     int  `json:"trace_days"`
+	KeepSnapshots int  `json:"keep_snapshots"`
+	DryRun        bool `json:"dry_run"`
+}
+
+// Result counts what compaction removed, or would remove on a dry run
+type Result struct {
+	Traces        int   `json:"traces"`
+	InboxEntries  int   `json:"inbox_entries"`
+	Leftovers     int   `json:"leftovers"`
+	Snapshots     int   `json:"snapshots"`
+	Blobs         int   `json:"blobs"`
+	BlobBytes     int64 `json:"blob_bytes"`
+	DBBytesBefore int64 `json:"db_bytes_before"`
+	DBBytesAfter  int64 `json:"db_bytes_after"`
+	DryRun        bool  `json:"dry_run"`
+}
+
+// Run compacts dir. store must be the registry in dir; callers serialize
+// it against other writers.
+func Run(dir string, store *db.Store, opts Options, now time.Time) (*Result, error) {
+	root, err := filepath.Abs(filepath.Dir(dir))
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{DryRun: opts.DryRun}
+
+	inbox, err := readInbox(filepath.Join(dir, inboxFile))
+	if err != nil {
+		return nil, err
+	}
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		return nil, err
+	}
+	if opts.TraceDays > 0 {
+		if result.Traces, err = pruneTraces(root, tandas, inbox, now.AddDate(0, 0, -opts.TraceDays), opts.DryRun); err != nil {
+			return nil, err
+		}
+	}
+	if result.InboxEntries, err = compactInbox(filepath.Join(dir, inboxFile), root, inbox, opts.DryRun); err != nil {
+		return nil, err
+	}
+	if result.Leftovers, err = removeLeftovers(dir, now.Add(-leftoverAge), opts.DryRun); err != nil {
+		return nil, err
+	}
+	if opts.KeepSnapshots > 0 {
+		if result.Snapshots, err = rotateSnapshots(dir, opts.KeepSnapshots, opts.DryRun); err != nil {
+			return nil, err
+		}
+	}
+	// Attachments written in the last hour may belong to a note not yet
+	// imported
+	gc, err := blobs.GC(dir, tandas, now.Add(-leftoverAge), opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	result.Blobs, result.BlobBytes = gc.Blobs, gc.Bytes
+
+	dbPath := filepath.Join(dir, dbFile)
+	result.DBBytesBefore = dbSize(dbPath)
+	result.DBBytesAfter = result.DBBytesBefore
+	if !opts.DryRun {
+		if err := store.Vacuum(); err != nil {
+			return nil, err
+		}
+		result.DBBytesAfter = dbSize(dbPath)
+	}
+	return result, nil
+}
+
+// inboxEntry is one trace inbox line; raw keeps the fields compaction does
+// not look at
+type inboxEntry struct {
+	raw    []byte
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+func readInbox(path string) ([]inboxEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read trace inbox: %w", err)
+	}
+	defer f.Close()
+
+	var entries []inboxEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var e inboxEntry
+		json.Unmarshal(line, &e)
+		e.raw = append([]byte(nil), line...)
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trace inbox: %w", err)
+	}
+	return entries, nil
+}
+
+// compactInbox keeps one entry per trace, preferring a linked one, and
+// drops entries whose file is gone. Lines it cannot parse are kept.
+func compactInbox(path, root string, entries []inboxEntry, dryRun bool) (int, error) {
+	best := make(map[string]int)
+	for i, e := range entries {
+		if e.Path == "" {
+			continue
+		}
+		j, seen := best[e.Path]
+		if !seen || e.Status == "linked" || entries[j].Status != "linked" {
+			best[e.Path] = i
+		}
+	}
+
+	var kept [][]byte
+	for i, e := range entries {
+		if e.Path != "" {
+			if best[e.Path] != i {
+				continue
+			}
+			if _, err := os.Stat(resolve(root, e.Path)); os.IsNotExist(err) {
+				continue
+			}
+		}
+		kept = append(kept, e.raw)
+	}
+	removed := len(entries) - len(kept)
+	if dryRun || removed == 0 {
+		return removed, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "trace_inbox-*.jsonl.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to write trace inbox: %w", err)
+	}
+	w := bufio.NewWriter(tmp)
+	for _, line := range kept {
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return 0, fmt.Errorf("failed to write trace inbox: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return 0, fmt.Errorf("failed to write trace inbox: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return 0, fmt.Errorf("failed to replace trace inbox: %w", err)
+	}
+	return removed, nil
+}
+
+// pruneTraces deletes files under test-results last modified before cutoff
+// that no run links to and no pending inbox entry waits on
+func pruneTraces(root string, tandas []*db.Tanda, inbox []inboxEntry, cutoff time.Time, dryRun bool) (int, error) {
+	dir := filepath.Join(root, traceDir)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return 0, nil
+	}
+	keep := make(map[string]bool)
+	for _, t := range tandas {
+		for _, r := range t.RunHistory {
+			if r.Trace != "" {
+				keep[resolve(root, r.Trace)] = true
+			}
+		}
+	}
+	for _, e := range inbox {
+		if e.Path != "" && e.Status == "pending" {
+			keep[resolve(root, e.Path)] = true
+		}
+	}
+
+	removed := 0
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || keep[path] {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			return err
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove trace: %w", err)
+			}
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// removeLeftovers deletes the temp files and staging dirs that interrupted
+// exports and snapshots leave behind
+func removeLeftovers(dir string, cutoff time.Time, dryRun bool) (int, error) {
+	patterns := []string{
+		filepath.Join(dir, "issues-*.jsonl.tmp"),
+		filepath.Join(dir, "trace_inbox-*.jsonl.tmp"),
+		filepath.Join(dir, snapshot.Dir, ".staging-*"),
+		filepath.Join(dir, snapshot.Dir, ".restore-*"),
+		filepath.Join(dir, snapshot.Dir, ".snapshot-*.tmp"),
+	}
+	removed := 0
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return removed, err
+		}
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err != nil || !info.ModTime().Before(cutoff) {
+				continue
+			}
+			if !dryRun {
+				if err := os.RemoveAll(path); err != nil {
+					return removed, fmt.Errorf("failed to remove %s: %w", filepath.Base(path), err)
+				}
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// rotateSnapshots deletes all but the newest keep snapshots
+func rotateSnapshots(dir string, keep int, dryRun bool) (int, error) {
+	manifests, err := snapshot.List(dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(manifests) <= keep {
+		return 0, nil
+	}
+	old := manifests[:len(manifests)-keep]
+	if dryRun {
+		return len(old), nil
+	}
+	for i, m := range old {
+		if err := os.Remove(snapshot.Path(dir, m.Name)); err != nil {
+			return i, fmt.Errorf("failed to remove snapshot %s: %w", m.Name, err)
+		}
+	}
+	return len(old), nil
+}
+
+func resolve(root, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(root, path)
+}
+
+// dbSize is the database file plus its WAL
+func dbSize(path string) int64 {
+	var n int64
+	for _, p := range []string{path, path + "-wal"} {
+		if info, err := os.Stat(p); err == nil {
+			n += info.Size()
+		}
+	}
+	return n
+}
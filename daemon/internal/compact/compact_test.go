@@ -0,0 +1,97 @@
+package compact_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/compact"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/snapshot"
+)
+
+func TestRun(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, ".tandas")
+	traces := filepath.Join(root, "test-results")
+	os.MkdirAll(dir, 0755)
+	os.MkdirAll(traces, 0755)
+
+	store, err := db.Open(filepath.Join(dir, "db.sqlite"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	store.UpsertTanda(&db.Tanda{ID: "td-1", Title: "Login", Status: "active",
+		RunHistory: []db.RunResult{{Timestamp: "2025-01-01T10:00:00Z", Result: "fail", Trace: "test-results/linked.zip"}}})
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -60)
+	for _, name := range []string{"linked.zip", "pending.zip", "orphan.zip", "fresh.zip"} {
+		path := filepath.Join(traces, name)
+		os.WriteFile(path, []byte("trace"), 0644)
+		if name != "fresh.zip" {
+			os.Chtimes(path, old, old)
+		}
+	}
+	inbox := strings.Join([]string{
+		`{"path":"test-results/linked.zip","status":"pending"}`,
+		`{"path":"test-results/linked.zip","status":"linked","tanda_id":"td-1"}`,
+		`{"path":"test-results/linked.zip","status":"pending"}`,
+		`{"path":"test-results/pending.zip","status":"pending"}`,
+		`{"path":"test-results/orphan.zip","status":"linked"}`,
+		`{"path":"test-results/gone.zip","status":"pending"}`,
+	}, "\n") + "\n"
+	os.WriteFile(filepath.Join(dir, "trace_inbox.jsonl"), []byte(inbox), 0644)
+
+	leftover := filepath.Join(dir, "issues-123.jsonl.tmp")
+	os.WriteFile(leftover, nil, 0644)
+	os.Chtimes(leftover, old, old)
+	os.WriteFile(filepath.Join(dir, "issues-456.jsonl.tmp"), nil, 0644)
+
+	for i, name := range []string{"first", "second", "third"} {
+		if _, err := snapshot.Create(dir, name, "", now.Add(time.Duration(i-3)*time.Hour)); err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+	}
+
+	opts := compact.Options{TraceDays: 30, KeepSnapshots: 1, DryRun: true}
+	dry, err := compact.Run(dir, store, opts, now)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if dry.Traces != 1 || dry.InboxEntries != 3 || dry.Leftovers != 1 || dry.Snapshots != 2 {
+		t.Fatalf("unexpected dry run %+v", dry)
+	}
+	if _, err := os.Stat(filepath.Join(traces, "orphan.zip")); err != nil {
+		t.Fatal("dry run removed a trace")
+	}
+
+	opts.DryRun = false
+	if _, err := compact.Run(dir, store, opts, now); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	for name, want := range map[string]bool{"linked.zip": true, "pending.zip": true, "orphan.zip": false, "fresh.zip": true} {
+		if _, err := os.Stat(filepath.Join(traces, name)); (err == nil) != want {
+			t.Errorf("%s: expected present=%v", name, want)
+		}
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "trace_inbox.jsonl"))
+	want := `{"path":"test-results/linked.zip","status":"linked","tanda_id":"td-1"}` + "\n" +
+		`{"path":"test-results/pending.zip","status":"pending"}` + "\n"
+	if string(data) != want {
+		t.Errorf("unexpected inbox:\n%s", data)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Error("expected the old temp file removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "issues-456.jsonl.tmp")); err != nil {
+		t.Error("expected the recent temp file kept")
+	}
+	manifests, _ := snapshot.List(dir)
+	if len(manifests) != 1 || manifests[0].Name != "third" {
+		t.Errorf("expected only the newest snapshot kept, got %d", len(manifests))
+	}
+}
@@ -0,0 +1,414 @@
+package config
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the config file inside the Tandas directory
+const FileName = "config.yaml"
+
+//go:embed template.yaml
+var template []byte
+
+// Template returns a config file with every setting commented out, which
+// init writes for new projects
+func Template() []byte {
+	return template
+}
+
+// Config holds daemon settings read from .tandas/config.yaml
+type Config struct {
+	// Author signs the notes added from this checkout; empty uses git
+	// config user.name
+	Author string       `yaml:"author"`
+	CI     CIConfig     `yaml:"ci"`
+	Jira   JiraConfig   `yaml:"jira"`
+	Notify NotifyConfig `yaml:"notify"`
+	// Webhooks receive signed JSON payloads for matching events
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Digest   DigestConfig    `yaml:"digest"`
+	SLOs     []SLOConfig     `yaml:"slos"`
+	Badges   BadgesConfig    `yaml:"badges"`
+	Gate     GateConfig      `yaml:"gate"`
+	// Anomalies tunes the detection of duration regressions
+	Anomalies AnomalyConfig `yaml:"anomalies"`
+	// Remotes names ssh:// registries for `td-daemon remote`
+	Remotes map[string]string `yaml:"remotes"`
+	Team    TeamConfig        `yaml:"team"`
+	// Peers names other machines' listeners for `td-daemon push/pull`
+	Peers  map[string]string `yaml:"peers"`
+	Mirror MirrorConfig      `yaml:"mirror"`
+	RPC    RPCConfig         `yaml:"rpc"`
+	Debug  DebugConfig       `yaml:"debug"`
+	// Storage tunes the SQLite cache
+	Storage StorageConfig `yaml:"storage"`
+	// IDs shapes the sequential IDs the create RPC allocates
+	IDs    IDConfig     `yaml:"ids"`
+	Import ImportConfig `yaml:"import"`
+	// Statuses extends the allowed statuses and restricts transitions
+	Statuses StatusConfig `yaml:"statuses"`
+	// Prune bounds run history and notes
+	Prune PruneConfig `yaml:"prune"`
+	Jobs  JobsConfig  `yaml:"jobs"`
+	// Runners names the test commands `td-daemon run` can start
+	Runners map[string]RunnerConfig `yaml:"runners"`
+}
+
+// CIConfig selects and configures the CI provider integration
+type CIConfig struct {
+	Provider string       `yaml:"provider"`
+	GitLab   GitLabConfig `yaml:"gitlab"`
+	GitHub   GitHubConfig `yaml:"github"`
+}
+
+// GitLabConfig configures the GitLab CI integration
+type GitLabConfig struct {
+	URL          string   `yaml:"url"`
+	Project      string   `yaml:"project"`
+	Token        string   `yaml:"token"`
+	CreateIssues bool     `yaml:"create_issues"`
+	Labels       []string `yaml:"labels"`
+}
+
+// GitHubConfig configures pull request comments on GitHub. Repo is
+// owner/name; Repo and Token default to GITHUB_REPOSITORY and GITHUB_TOKEN,
+// as GitHub Actions sets them.
+type GitHubConfig struct {
+	URL   string `yaml:"url"`
+	Repo  string `yaml:"repo"`
+	Token string `yaml:"token"`
+}
+
+// JiraConfig configures the Jira external-reference sync
+type JiraConfig struct {
+	URL   string `yaml:"url"`
+	User  string `yaml:"user"`
+	Token string `yaml:"token"`
+}
+
+// NotifyConfig configures outbound notifications
+type NotifyConfig struct {
+	Slack SlackConfig `yaml:"slack"`
+}
+
+// SlackConfig configures the Slack webhook notifier. On selects the
+// conditions that post (quarantine, pass_rate, import_errors, slo, duration); Templates
+// overrides the message for a condition using text/template syntax.
+// Owners limits tanda events to those owned by one of the listed owners.
+// Routes sends events about an owner's tandas to that owner's webhook
+// instead of WebhookURL, which then only gets the rest.
+type SlackConfig struct {
+	WebhookURL    string            `yaml:"webhook_url"`
+	On            []string          `yaml:"on"`
+	PassRateBelow float64           `yaml:"pass_rate_below"`
+	Templates     map[string]string `yaml:"templates"`
+	MaxPerHour    int               `yaml:"max_per_hour"`
+	Owners        []string          `yaml:"owners"`
+	Routes        map[string]string `yaml:"routes"`
+}
+
+// WebhookConfig registers an outbound webhook. Events filters by event
+// type and Owners by tanda owner; empty lists match every event.
+type WebhookConfig struct {
+	URL         string   `yaml:"url"`
+	Secret      string   `yaml:"secret"`
+	Events      []string `yaml:"events"`
+	Owners      []string `yaml:"owners"`
+	MaxAttempts int      `yaml:"max_attempts"`
+}
+
+// DigestConfig configures the periodic registry digest. Schedule is a
+// cron expression; the digest is delivered to every configured target.
+// Owners also sends each listed owner a digest of just their tandas.
+type DigestConfig struct {
+	Schedule   string                  `yaml:"schedule"`
+	Period     string                  `yaml:"period"` // daily or weekly
+	File       string                  `yaml:"file"`
+	WebhookURL string                  `yaml:"webhook_url"`
+	SMTP       SMTPConfig              `yaml:"smtp"`
+	Owners     map[string]DigestTarget `yaml:"owners"`
+}
+
+// BadgesConfig keeps SVG status badges up to date. Dir, relative to the
+// project root, is where the daemon rewrites them after each sync; empty
+// leaves them off.
+type BadgesConfig struct {
+	Dir string `yaml:"dir"`
+}
+
+// GateConfig sets the policies `td-daemon gate` enforces in CI. Tests
+// lists globs, matched against a file's path or its name, of the test
+// files that must each be some tanda's file once added; empty uses the
+// gate's defaults. The limits are off unless set, and Skip turns policies
+// off by name.
+type GateConfig struct {
+	Tests          []string `yaml:"tests"`
+	MaxQuarantined *int     `yaml:"max_quarantined"`
+	MaxFlaky       *int     `yaml:"max_flaky"`
+	MinPassRate    *float64 `yaml:"min_pass_rate"`
+	Skip           []string `yaml:"skip"`
+}
+
+// DigestTarget is where an owner's digest goes; To is emailed through the
+// digest's SMTP server
+type DigestTarget struct {
+	File       string   `yaml:"file"`
+	WebhookURL string   `yaml:"webhook_url"`
+	To         []string `yaml:"to"`
+}
+
+// SLOConfig defines an objective evaluated after each import. Metric is
+// pass_rate, flaky_count or failure_count; Min and Max bound it, and Window
+// (e.g. 7d) limits pass_rate and failure_count to recent runs.
+type SLOConfig struct {
+	Name   string   `yaml:"name"`
+	Metric string   `yaml:"metric"`
+	Min    *float64 `yaml:"min"`
+	Max    *float64 `yaml:"max"`
+	Window string   `yaml:"window"`
+}
+
+// AnomalyConfig tunes the duration anomaly detector, which checks each
+// run recorded against the timed runs before it. A run is anomalous when
+// its duration is ZScore standard deviations above their mean, MinRatio
+// times the mean and MinIncrease more than it. Baseline caps the runs
+// compared and MinRuns is how many are needed; zero fields take the
+// defaults. Disabled turns detection off.
+type AnomalyConfig struct {
+	Disabled    bool    `yaml:"disabled"`
+	ZScore      float64 `yaml:"z_score"`
+	MinRatio    float64 `yaml:"min_ratio"`
+	MinIncrease string  `yaml:"min_increase"`
+	Baseline    int     `yaml:"baseline"`
+	MinRuns     int     `yaml:"min_runs"`
+}
+
+// TeamConfig configures team server mode. Listen makes this daemon a team
+// server on a TCP address; Upstream makes it push its registry to one and
+// Follow makes it a read-only replica of one. Addresses of the form
+// tls://host:port are dialed over TLS.
+type TeamConfig struct {
+	Listen string    `yaml:"listen"`
+	TLS    TLSConfig `yaml:"tls"`
+	// Tokens and TokensFile list the bearer tokens the server accepts; with
+	// neither set the server is open to anyone who can reach it
+	Tokens     []TokenConfig `yaml:"tokens"`
+	TokensFile string        `yaml:"tokens_file"`
+
+	Upstream string `yaml:"upstream"`
+	// Follow replicates a leader's registry into a read-only local cache;
+	// it uses Token and UpstreamTLS like Upstream
+	Follow      string    `yaml:"follow"`
+	Token       string    `yaml:"token"`
+	UpstreamTLS TLSConfig `yaml:"upstream_tls"`
+}
+
+// TLSConfig holds certificate paths. On a server CA verifies client
+// certificates (mTLS); on a client it verifies the server, and Cert/Key
+// are presented as the client certificate.
+type TLSConfig struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	CA   string `yaml:"ca"`
+}
+
+// TokenConfig is a bearer token and its scope: read or write
+type TokenConfig struct {
+	Token string `yaml:"token"`
+	Scope string `yaml:"scope"`
+}
+
+// MirrorConfig configures replication sinks that receive a copy of the
+// registry after every import
+type MirrorConfig struct {
+	Postgres PostgresConfig `yaml:"postgres"`
+}
+
+// PostgresConfig mirrors tandas and run history into a Postgres schema.
+// Repo keys this registry's rows (default: the project directory name).
+type PostgresConfig struct {
+	DSN       string `yaml:"dsn"`
+	Schema    string `yaml:"schema"`
+	Repo      string `yaml:"repo"`
+	BatchSize int    `yaml:"batch_size"`
+}
+
+// RPCConfig limits the daemon's RPC connections, counted across the
+// socket and the team listener. IdleTimeout closes connections left
+// waiting between requests and ReadTimeout bounds reading one request;
+// both are durations such as 30s. MaxRequestBytes caps the size of one
+// request and RateLimits throttles methods per client. Timeouts sets
+// per-method deadlines such as export: 5m, with "default" for the rest.
+// AllowedGroups lets members of those groups, by name or gid, use the unix
+// socket alongside the daemon's own user. Socket moves td.sock, e.g. to
+// ${XDG_RUNTIME_DIR}/tandas.sock, and SocketMode sets its octal mode.
+// AbstractSocket binds @tandas/<hash> instead on Linux, leaving no file
+// behind after a crash; elsewhere, or if it can't be bound, the path
+// socket is used. Listen, e.g. tcp://127.0.0.1:0, adds a localhost TCP
+// listener for containers and WSL, which requires Token or, when that is
+// empty, a generated token written to daemon.token.
+type RPCConfig struct {
+	MaxConnections  int                        `yaml:"max_connections"`
+	IdleTimeout     string                     `yaml:"idle_timeout"`
+	ReadTimeout     string                     `yaml:"read_timeout"`
+	MaxRequestBytes int64                      `yaml:"max_request_bytes"`
+	RateLimits      map[string]RateLimitConfig `yaml:"rate_limits"`
+	Timeouts        map[string]string          `yaml:"timeouts"`
+	AllowedGroups   []string                   `yaml:"allowed_groups"`
+	Socket          string                     `yaml:"socket"`
+	SocketMode      string                     `yaml:"socket_mode"`
+	AbstractSocket  bool                       `yaml:"abstract_socket"`
+	Listen          string                     `yaml:"listen"`
+	Token           string                     `yaml:"token"`
+}
+
+// RateLimitConfig allows PerMinute calls on average with bursts of up to
+// Burst; PerMinute 0 leaves the method unlimited
+type RateLimitConfig struct {
+	PerMinute float64 `yaml:"per_minute"`
+	Burst     int     `yaml:"burst"`
+}
+
+// DebugConfig enables diagnostics. Listen is a localhost address serving
+// pprof profiles and runtime stats.
+type DebugConfig struct {
+	Listen string `yaml:"listen"`
+}
+
+// StorageConfig configures the SQLite cache. Compress stores notes and
+// run history zstd compressed, which shrinks registries with long run
+// histories considerably. MaxAttachmentBytes caps one note attachment
+// (default 1 MiB).
+type StorageConfig struct {
+	Compress           bool  `yaml:"compress"`
+	MaxAttachmentBytes int64 `yaml:"max_attachment_bytes"`
+}
+
+// ImportConfig tunes JSONL imports. Duplicates picks what happens when an
+// ID repeats: last (the default), error, newest or merge. Lines longer than
+// MaxLineBytes (default 64 MiB) are moved to .tandas/oversized.jsonl.
+type ImportConfig struct {
+	Duplicates   string `yaml:"duplicates"`
+	MaxLineBytes int    `yaml:"max_line_bytes"`
+}
+
+// StatusConfig adds statuses to the built-in set and lists the statuses
+// each one may move to. Statuses without transitions may move anywhere.
+// Retired names statuses that, like deprecated and archived, take a tanda
+// out of the suite for good.
+type StatusConfig struct {
+	Extra       []string            `yaml:"extra"`
+	Transitions map[string][]string `yaml:"transitions"`
+	Retired     []string            `yaml:"retired"`
+}
+
+// PruneConfig is the project's retention policy for run history and notes.
+// KeepRuns keeps each tanda's newest runs, KeepDays drops older runs and
+// NoteDays older notes; zero means no limit. KeepFailuresDays keeps failed
+// runs that recent regardless, and Downsample keeps a summary per day of
+// the runs dropped. Schedule is a cron expression for pruning in the daemon.
+type PruneConfig struct {
+	KeepRuns         int    `yaml:"keep_runs"`
+	KeepDays         int    `yaml:"keep_days"`
+	NoteDays         int    `yaml:"note_days"`
+	KeepFailuresDays int    `yaml:"keep_failures_days"`
+	Downsample       bool   `yaml:"downsample"`
+	Schedule         string `yaml:"schedule"`
+}
+
+// JobsConfig schedules the daemon's maintenance jobs, each with a cron
+// expression; empty leaves a job off. Prune and Digest default to
+// prune.schedule and digest.schedule. Compact removes stale traces and
+// vacuums the database, Snapshot takes a backup, and Push pushes the
+// registry to Remote, a name under remotes (default origin).
+type JobsConfig struct {
+	Prune    string `yaml:"prune"`
+	Compact  string `yaml:"compact"`
+	Snapshot string `yaml:"snapshot"`
+	Digest   string `yaml:"digest"`
+	Push     string `yaml:"push"`
+	Remote   string `yaml:"remote"`
+}
+
+// RunnerConfig is a test command the daemon runs for a set of tandas.
+// Command is split into arguments without a shell: an argument {files}
+// expands to the tandas' files and {dirs} to their directories as ./dir,
+// and {names} within an argument becomes a regular expression matching
+// their titles. Match lists file globs choosing this runner for a tanda.
+// Report is how results are read: junit from ReportPath (or stdout when
+// empty), go-json from go test -json output, or exit, the default, where
+// every tanda passes or fails with the exit code. Timeout defaults to 30m.
+type RunnerConfig struct {
+	Command    []string `yaml:"command"`
+	Match      []string `yaml:"match"`
+	Report     string   `yaml:"report"`
+	ReportPath string   `yaml:"report_path"`
+	Timeout    string   `yaml:"timeout"`
+}
+
+// IDConfig sets the prefix and zero-padded width of allocated IDs, e.g.
+// td- and 4 for td-0421
+type IDConfig struct {
+	Prefix string `yaml:"prefix"`
+	Width  int    `yaml:"width"`
+}
+
+// SMTPConfig configures email delivery
+type SMTPConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// Default returns the configuration used when no config file exists
+func Default() *Config {
+	return &Config{
+		CI: CIConfig{
+			GitLab: GitLabConfig{
+				URL:    "https://gitlab.com",
+				Labels: []string{"flaky-test"},
+			},
+			GitHub: GitHubConfig{URL: "https://api.github.com"},
+		},
+		Notify: NotifyConfig{
+			Slack: SlackConfig{
+				On:            []string{"quarantine", "pass_rate", "import_errors", "slo"},
+				PassRateBelow: 0.95,
+				MaxPerHour:    20,
+			},
+		},
+		Digest: DigestConfig{
+			Period: "weekly",
+			SMTP:   SMTPConfig{Port: 587},
+		},
+	}
+}
+
+// Load reads config.yaml from dir, expanding ${VAR} references from the
+// environment. A missing file yields the defaults.
+func Load(dir string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	expanded := os.ExpandEnv(string(data))
+	if err := yaml.Unmarshal([]byte(expanded), cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	return cfg, nil
+}
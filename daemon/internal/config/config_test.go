@@ -0,0 +1,78 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadMissingFileUsesDefaults(t *testing.T) {
+	cfg, err := config.Load(t.TempDir())
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.CI.GitLab.URL != "https://gitlab.com" {
+		t.Fatalf("expected default GitLab URL, got %q", cfg.CI.GitLab.URL)
+	}
+}
+
+func TestLoadExpandsEnv(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TD_TEST_GITLAB_TOKEN", "secret")
+	data := `
+ai:
+  default_provider: claude
+ci:
+  provider: gitlab
+  gitlab:
+    project: group/app
+    token: ${TD_TEST_GITLAB_TOKEN}
+`
+	if err := os.WriteFile(filepath.Join(dir, config.FileName), []byte(data), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	cfg, err := config.Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.CI.Provider != "gitlab" {
+		t.Fatalf("expected provider gitlab, got %q", cfg.CI.Provider)
+	}
+	if cfg.CI.GitLab.Token != "secret" {
+		t.Fatalf("expected expanded token, got %q", cfg.CI.GitLab.Token)
+	}
+	if cfg.CI.GitLab.URL != "https://gitlab.com" {
+		t.Fatalf("expected default URL to survive, got %q", cfg.CI.GitLab.URL)
+	}
+}
+
+func TestTemplateKeysExist(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, config.FileName), config.Template(), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := config.Load(dir); err != nil {
+		t.Fatalf("load commented template: %v", err)
+	}
+
+	// Uncomment the settings, leaving the prose, and decode strictly so a
+	// misspelled key fails
+	setting := regexp.MustCompile(`^# ( +|- |[a-z_]+:)`)
+	var lines []string
+	for _, line := range strings.Split(string(config.Template()), "\n") {
+		if setting.MatchString(line) {
+			lines = append(lines, strings.TrimPrefix(line, "# "))
+		}
+	}
+	dec := yaml.NewDecoder(strings.NewReader(strings.Join(lines, "\n")))
+	dec.KnownFields(true)
+	if err := dec.Decode(config.Default()); err != nil {
+		t.Fatalf("template settings do not match the config: %v", err)
+	}
+}
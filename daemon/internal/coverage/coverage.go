@@ -0,0 +1,264 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/paths"
+)
+
+// Files maps covered source files to the lines executed in them. A file
+// with no lines was covered, but the data did not say where.
+type Files map[string][]db.LineRange
+
+// Add merges o into f, which may be nil, and returns it
+func (f Files) Add(o Files) Files {
+	if f == nil {
+		f = make(Files, len(o))
+	}
+	for file, lines := range o {
+		f[file] = db.MergeLines(append(f[file], lines...))
+	}
+	return f
+}
+
+// Paths returns the covered files in order
+func (f Files) Paths() []string {
+	set := make(map[string]bool, len(f))
+	for file := range f {
+		set[file] = true
+	}
+	return sortedKeys(set)
+}
+
+// ParseGoProfile returns the source files with at least one executed block
+// in a `go test -coverprofile` file, with the lines of those blocks. Import
+// paths under modulePath are rewritten relative to the module root.
+func ParseGoProfile(r io.Reader, modulePath string) (Files, error) {
+	scanner := bufio.NewScanner(r)
+	covered := make(Files)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		// path/to/file.go:10.2,12.3 <statements> <count>
+		colon := strings.LastIndex(line, ":")
+		fields := strings.Fields(line)
+		if colon < 0 || len(fields) != 3 {
+			return nil, fmt.Errorf("invalid cover profile line %d: %q", lineNum, line)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid count on cover profile line %d: %w", lineNum, err)
+		}
+		if count == 0 {
+			continue
+		}
+
+		file := line[:colon]
+		if modulePath != "" && strings.HasPrefix(file, modulePath+"/") {
+			file = strings.TrimPrefix(file, modulePath+"/")
+		}
+		// The block's span is <line>.<column>,<line>.<column>
+		from, to, _ := strings.Cut(fields[0][strings.LastIndex(fields[0], ":")+1:], ",")
+		start, err1 := strconv.Atoi(strings.Split(from, ".")[0])
+		end, err2 := strconv.Atoi(strings.Split(to, ".")[0])
+		if err1 != nil || err2 != nil || start < 1 || end < start {
+			return nil, fmt.Errorf("invalid block on cover profile line %d: %q", lineNum, line)
+		}
+		covered[file] = append(covered[file], db.LineRange{Start: start, End: end})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for file, lines := range covered {
+		covered[file] = db.MergeLines(lines)
+	}
+	return covered, nil
+}
+
+// ParseLCOV returns covered source files per lcov test name (TN); records
+// without a test name are keyed by "". Absolute paths under root are made
+// relative to it. Lines come from DA records; a record with only an LH
+// count covers its file without them.
+func ParseLCOV(r io.Reader, root string) (map[string]Files, error) {
+	scanner := bufio.NewScanner(r)
+	byTest := make(map[string]Files)
+
+	test, file := "", ""
+	hit := false
+	var lines []db.LineRange
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, _ := strings.Cut(line, ":")
+		switch key {
+		case "TN":
+			test = value
+		case "SF":
+			file, hit, lines = paths.Normalize(root, value), false, nil
+		case "DA":
+			// DA:<line>,<hits>[,<checksum>]
+			parts := strings.Split(value, ",")
+			if len(parts) >= 2 {
+				if n, err := strconv.Atoi(parts[1]); err == nil && n > 0 {
+					hit = true
+					if l, err := strconv.Atoi(parts[0]); err == nil && l > 0 {
+						lines = append(lines, db.LineRange{Start: l, End: l})
+					}
+				}
+			}
+		case "LH":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				hit = true
+			}
+		case "end_of_record":
+			if file != "" && hit {
+				byTest[test] = byTest[test].Add(Files{file: lines})
+			}
+			file, hit, lines = "", false, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return byTest, nil
+}
+
+// ModulePath reads the module path from root/go.mod, or "" if absent
+func ModulePath(root string) string {
+	data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return strings.Trim(strings.TrimSpace(rest), `"`)
+		}
+	}
+	return ""
+}
+
+// ApplyResult reports which tandas Apply changed
+type ApplyResult struct {
+	Updated   []string `json:"updated"`
+	Unmatched []string `json:"unmatched"`
+}
+
+// Apply sets each tanda's covers to the files its tests covered, and its
+// cover lines to the lines executed in them. Keys are matched against tanda
+// ID, title, then file. With merge the files and lines are added to the
+// existing ones instead of replacing them.
+func Apply(store *db.Store, byTest map[string]Files, merge bool) (*ApplyResult, error) {
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tandas: %w", err)
+	}
+
+	result := &ApplyResult{Updated: []string{}, Unmatched: []string{}}
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	keys := make([]string, 0, len(byTest))
+	for k := range byTest {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		t := match(tandas, key)
+		if t == nil {
+			result.Unmatched = append(result.Unmatched, key)
+			continue
+		}
+
+		set := make(map[string]bool)
+		lines := make(map[string]string)
+		if merge {
+			for _, c := range t.Covers {
+				set[c] = true
+			}
+			for p, l := range t.CoverLines {
+				lines[p] = l
+			}
+		}
+		for f, ranges := range byTest[key] {
+			set[f] = true
+			if len(ranges) == 0 {
+				continue
+			}
+			if existing, err := db.ParseLines(lines[f]); err == nil {
+				ranges = append(ranges, existing...)
+			}
+			lines[f] = db.FormatLines(ranges)
+		}
+		covers := sortedKeys(set)
+		if strings.Join(covers, "\n") == strings.Join(t.Covers, "\n") && sameLines(lines, t.CoverLines) {
+			continue
+		}
+
+		t.Covers = covers
+		t.CoverLines = lines
+		if len(lines) == 0 {
+			t.CoverLines = nil
+		}
+		t.UpdatedAt = now
+		if err := store.UpsertTanda(t); err != nil {
+			return result, fmt.Errorf("failed to update tanda %s: %w", t.ID, err)
+		}
+		result.Updated = append(result.Updated, t.ID)
+	}
+	return result, nil
+}
+
+func match(tandas []*db.Tanda, key string) *db.Tanda {
+	for _, t := range tandas {
+		if t.ID == key {
+			return t
+		}
+	}
+	for _, t := range tandas {
+		if t.Title == key {
+			return t
+		}
+	}
+	for _, t := range tandas {
+		if t.File != "" && filepath.Clean(t.File) == filepath.Clean(key) {
+			return t
+		}
+	}
+	return nil
+}
+
+func sameLines(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, l := range a {
+		if b[p] != l {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,125 @@
+package coverage_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/coverage"
+	"github.com/tandas/daemon/internal/db"
+)
+
+func TestParseGoProfile(t *testing.T) {
+	profile := `mode: set
+github.com/acme/shop/cart/cart.go:10.2,12.3 2 1
+github.com/acme/shop/cart/cart.go:14.2,15.3 1 0
+github.com/acme/shop/cart/cart.go:13.1,13.9 1 1
+github.com/acme/shop/cart/cart.go:20.2,22.3 2 1
+github.com/acme/shop/pay/pay.go:3.1,4.2 1 0
+github.com/other/lib/lib.go:1.1,2.2 1 3
+`
+	files, err := coverage.ParseGoProfile(strings.NewReader(profile), "github.com/acme/shop")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := strings.Join(files.Paths(), ","); got != "cart/cart.go,github.com/other/lib/lib.go" {
+		t.Fatalf("unexpected covered files: %s", got)
+	}
+	if got := db.FormatLines(files["cart/cart.go"]); got != "10-13,20-22" {
+		t.Fatalf("unexpected covered lines: %s", got)
+	}
+}
+
+func TestParseLCOV(t *testing.T) {
+	lcov := `TN:td-login
+SF:/repo/src/auth.ts
+DA:1,1
+DA:2,0
+DA:3,2
+DA:4,1
+end_of_record
+SF:/repo/src/unused.ts
+DA:1,0
+end_of_record
+TN:Checkout
+SF:src/cart.ts
+LH:4
+end_of_record
+`
+	byTest, err := coverage.ParseLCOV(strings.NewReader(lcov), "/repo")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := strings.Join(byTest["td-login"].Paths(), ","); got != "src/auth.ts" {
+		t.Fatalf("unexpected td-login files: %s", got)
+	}
+	if got := db.FormatLines(byTest["td-login"]["src/auth.ts"]); got != "1,3-4" {
+		t.Fatalf("unexpected td-login lines: %s", got)
+	}
+	// LH alone covers the file without saying where
+	if got := strings.Join(byTest["Checkout"].Paths(), ","); got != "src/cart.ts" || byTest["Checkout"]["src/cart.ts"] != nil {
+		t.Fatalf("unexpected Checkout files: %v", byTest["Checkout"])
+	}
+}
+
+func TestApply(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, tanda := range []*db.Tanda{
+		{ID: "td-login", Title: "Login", Status: "active", Covers: []string{"auth"}, CreatedAt: now, UpdatedAt: now},
+		{ID: "td-cart", Title: "Checkout", Status: "active", Covers: []string{"cart"}, CreatedAt: now, UpdatedAt: now},
+	} {
+		if err := store.UpsertTanda(tanda); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+	}
+
+	result, err := coverage.Apply(store, map[string]coverage.Files{
+		"td-login": {"src/auth.ts": {{Start: 3, End: 9}}},
+		"Checkout": {"src/cart.ts": nil},
+		"Missing":  {"src/x.ts": nil},
+	}, false)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(result.Updated) != 2 || strings.Join(result.Unmatched, ",") != "Missing" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	login, _ := store.GetTanda("td-login")
+	if got := strings.Join(login.Covers, ","); got != "src/auth.ts" {
+		t.Fatalf("expected covers to be replaced, got %s", got)
+	}
+
+	if lines, ok := login.CoveredLines("src/auth.ts"); !ok || db.FormatLines(lines) != "3-9" {
+		t.Fatalf("expected cover lines 3-9, got %v", login.CoverLines)
+	}
+
+	merged := coverage.Files{"src/session.ts": nil, "src/auth.ts": {{Start: 20, End: 20}}}
+	if _, err := coverage.Apply(store, map[string]coverage.Files{"td-login": merged}, true); err != nil {
+		t.Fatalf("merge apply: %v", err)
+	}
+	login, _ = store.GetTanda("td-login")
+	if got := strings.Join(login.Covers, ","); got != "src/auth.ts,src/session.ts" {
+		t.Fatalf("expected merged covers, got %s", got)
+	}
+	if got := login.CoverLines["src/auth.ts"]; got != "3-9,20" {
+		t.Fatalf("expected merged lines, got %s", got)
+	}
+
+	// Dropping a file from covers drops its lines
+	login.Covers = []string{"src/session.ts"}
+	if err := store.UpsertTanda(login); err != nil {
+		t.Fatal(err)
+	}
+	login, _ = store.GetTanda("td-login")
+	if len(login.CoverLines) != 0 {
+		t.Fatalf("expected no cover lines, got %v", login.CoverLines)
+	}
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"bytes"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// minCompressSize skips values too small to shrink
+const minCompressSize = 256
+
+// zstdMagic starts every zstd frame; JSON text never does, so compressed
+// and plain values can share a column
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+var (
+	encoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	decoder, _ = zstd.NewReader(nil)
+)
+
+// SetCompression makes later writes store notes and run history zstd
+// compressed. Reads handle either form, so it can be switched at any time;
+// existing rows are rewritten on the next import. Call it before the
+// store is shared.
+func (s *Store) SetCompression(on bool) {
+	s.compress = on
+}
+
+// encodeBlob returns the value to store for a JSON column that may be
+// compressed
+func (s *Store) encodeBlob(data []byte) interface{} {
+	if !s.compress || len(data) < minCompressSize {
+		return string(data)
+	}
+	return encoder.EncodeAll(data, nil)
+}
+
+// decodeBlob returns the JSON stored in a column, decompressing it if needed
+func decodeBlob(data []byte) []byte {
+	if !bytes.HasPrefix(data, zstdMagic) {
+		return data
+	}
+	out, err := decoder.DecodeAll(data, nil)
+	if err != nil {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// DurationWindow is how many of the most recent timed runs the duration
+// percentiles cover
+const DurationWindow = 20
+
+// Durations are percentiles of a tanda's recent run durations. Runs counts
+// the timed runs they cover; with none, both are zero.
+type Durations struct {
+	P50  time.Duration `json:"p50"`
+	P95  time.Duration `json:"p95"`
+	Runs int           `json:"runs"`
+}
+
+// Durations returns the p50 and p95 of the last DurationWindow runs that
+// have a duration, by nearest rank
+func (t *Tanda) Durations() Durations {
+	return calculateDurations(t.RunHistory)
+}
+
+// nullMs returns the percentiles in milliseconds for the stored columns,
+// NULL without timed runs
+func (d Durations) nullMs() (p50, p95 sql.NullInt64) {
+	if d.Runs == 0 {
+		return p50, p95
+	}
+	return sql.NullInt64{Int64: d.P50.Milliseconds(), Valid: true}, sql.NullInt64{Int64: d.P95.Milliseconds(), Valid: true}
+}
+
+func calculateDurations(history []RunResult) Durations {
+	var ds []time.Duration
+	for i := len(history) - 1; i >= 0 && len(ds) < DurationWindow; i-- {
+		if d, ok := ParseDuration(history[i].Duration); ok {
+			ds = append(ds, d)
+		}
+	}
+	if len(ds) == 0 {
+		return Durations{}
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	rank := func(p int) time.Duration {
+		// Nearest rank: the smallest value with at least p% at or below it
+		return ds[(p*len(ds)+99)/100-1]
+	}
+	return Durations{P50: rank(50), P95: rank(95), Runs: len(ds)}
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LineRange is an inclusive span of source lines, counted from 1
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Overlaps reports whether the two spans share a line
+func (r LineRange) Overlaps(o LineRange) bool {
+	return r.Start <= o.End && o.Start <= r.End
+}
+
+// MergeLines sorts ranges and joins those that overlap or touch
+func MergeLines(ranges []LineRange) []LineRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sorted := append([]LineRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	out := []LineRange{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &out[len(out)-1]
+		if r.Start <= last.End+1 {
+			last.End = max(last.End, r.End)
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// FormatLines writes ranges compactly, as in 10-42,50
+func FormatLines(ranges []LineRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range MergeLines(ranges) {
+		if r.Start == r.End {
+			parts = append(parts, strconv.Itoa(r.Start))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", r.Start, r.End))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseLines reads ranges written by FormatLines
+func ParseLines(s string) ([]LineRange, error) {
+	var ranges []LineRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(from)
+		end := start
+		if err == nil && isRange {
+			end, err = strconv.Atoi(to)
+		}
+		if err != nil || start < 1 || end < start {
+			return nil, fmt.Errorf("invalid line range %q", part)
+		}
+		ranges = append(ranges, LineRange{Start: start, End: end})
+	}
+	return MergeLines(ranges), nil
+}
+
+// CoveredLines returns the lines the tanda's tests executed in path, and
+// whether they are known
+func (t *Tanda) CoveredLines(path string) ([]LineRange, bool) {
+	s, ok := t.CoverLines[path]
+	if !ok {
+		return nil, false
+	}
+	ranges, err := ParseLines(s)
+	return ranges, err == nil
+}
+
+// pruneCoverLines drops line data for files the tanda no longer covers
+func (t *Tanda) pruneCoverLines() {
+	if len(t.CoverLines) == 0 {
+		return
+	}
+	covered := make(map[string]bool, len(t.Covers))
+	for _, c := range t.Covers {
+		covered[c] = true
+	}
+	for path := range t.CoverLines {
+		if !covered[path] {
+			delete(t.CoverLines, path)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// NoteID derives a note's ID from its timestamp, type, author, parent and
+// text, so every replica holding a copy of the note agrees on it. td.py
+// derives the same ID.
+func NoteID(n Note) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{n.Timestamp, n.Type, n.Author, n.Parent, n.Text}, "\x00")))
+	return "n-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// Key returns the note's ID, derived when the note has none
+func (n Note) Key() string {
+	if n.ID != "" {
+		return n.ID
+	}
+	return NoteID(n)
+}
+
+// FindNote returns the index of the note with key, or -1
+func FindNote(notes []Note, key string) int {
+	for i, n := range notes {
+		if n.Key() == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// ThreadedNote is a note placed in its thread, Depth replies deep
+type ThreadedNote struct {
+	Note
+	Depth int
+}
+
+// Thread orders notes into discussion threads: each note is followed by
+// its replies in the order they are stored, oldest first. A note whose
+// parent is gone, such as pruned, starts a thread of its own.
+func Thread(notes []Note) []ThreadedNote {
+	index := make(map[string]int, len(notes))
+	for i, n := range notes {
+		index[n.Key()] = i
+	}
+	var roots []int
+	replies := make(map[int][]int)
+	for i, n := range notes {
+		if p, ok := index[n.Parent]; ok && n.Parent != "" && p != i {
+			replies[p] = append(replies[p], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	out := make([]ThreadedNote, 0, len(notes))
+	placed := make(map[int]bool, len(notes))
+	var walk func(i, depth int)
+	walk = func(i, depth int) {
+		if placed[i] {
+			return
+		}
+		placed[i] = true
+		out = append(out, ThreadedNote{Note: notes[i], Depth: depth})
+		for _, r := range replies[i] {
+			walk(r, depth+1)
+		}
+	}
+	for _, i := range roots {
+		walk(i, 0)
+	}
+	// Notes in a reply cycle have no root; keep them rather than drop them
+	for i := range notes {
+		walk(i, 0)
+	}
+	return out
+}
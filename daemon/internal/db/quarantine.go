@@ -0,0 +1,46 @@
+package db
+
+import "time"
+
+// Quarantine is a span a tanda spent quarantined. Left is empty while the
+// tanda is still quarantined.
+type Quarantine struct {
+	Entered string `json:"entered"`
+	Left    string `json:"left,omitempty"`
+}
+
+// Duration is how long the span lasted, up to now when still open; it is
+// zero when a timestamp does not parse
+func (q Quarantine) Duration(now time.Time) time.Duration {
+	entered, ok := ParseTimestamp(q.Entered)
+	if !ok {
+		return 0
+	}
+	left := now
+	if q.Left != "" {
+		if left, ok = ParseTimestamp(q.Left); !ok {
+			return 0
+		}
+	}
+	if left.Before(entered) {
+		return 0
+	}
+	return left.Sub(entered)
+}
+
+// TrackQuarantine opens a quarantine span at ts when the tanda's status
+// quarantines it and none is open, and closes the open one when it no
+// longer does. It reports whether the spans changed. The store calls it on
+// every write, so status changes from any writer are tracked.
+func (t *Tanda) TrackQuarantine(ts string) bool {
+	open := len(t.Quarantines) > 0 && t.Quarantines[len(t.Quarantines)-1].Left == ""
+	switch quarantined := IsQuarantined(t.Status); {
+	case quarantined && !open:
+		t.Quarantines = append(t.Quarantines, Quarantine{Entered: ts})
+	case !quarantined && open:
+		t.Quarantines[len(t.Quarantines)-1].Left = ts
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Reference types
+const (
+	RefIssue = "issue"
+	RefPR    = "pr"
+	RefDoc   = "doc"
+)
+
+// RefTypes are the valid values of Ref.Type
+var RefTypes = []string{RefIssue, RefPR, RefDoc}
+
+// Ref links a tanda to an issue, pull request or document. It needs a URL,
+// an ID such as JIRA-123 or #42, or both.
+type Ref struct {
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
+	ID   string `json:"id,omitempty"`
+}
+
+// String renders the ref as "pr #42 https://…", leaving out empty parts
+func (r Ref) String() string {
+	parts := []string{r.Type}
+	if r.ID != "" {
+		parts = append(parts, r.ID)
+	}
+	if r.URL != "" {
+		parts = append(parts, r.URL)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Check returns an error unless the ref has a known type, an ID or URL,
+// and any URL is absolute http or https
+func (r Ref) Check() error {
+	if err := checkOneOf("ref type", r.Type, RefTypes); err != nil {
+		return err
+	}
+	if r.Type == "" {
+		return fmt.Errorf("ref type is required: use %s", strings.Join(RefTypes, ", "))
+	}
+	if r.URL == "" && r.ID == "" {
+		return fmt.Errorf("%s ref needs a url or an id", r.Type)
+	}
+	if r.URL != "" {
+		u, err := url.Parse(r.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s ref url %q is not an http or https URL", r.Type, r.URL)
+		}
+	}
+	return nil
+}
+
+// CheckRefs checks each ref, naming the first bad one by position
+func CheckRefs(refs []Ref) error {
+	for i, r := range refs {
+		if err := r.Check(); err != nil {
+			return fmt.Errorf("ref %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -1,11 +1,16 @@
 package db
 
 import (
-    "database/sql"
-    "encoding/json"
-    "fmt"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
-    _ "modernc.org/sqlite"
+	_ "modernc.org/sqlite"
 )
 
 // Tanda represents a test in the registry
@@ -18,15 +23,72 @@ type Tanda struct {
 	DependsOn  []string    `json:"depends_on"`
 	Notes      []Note      `json:"notes"`
 	RunHistory []RunResult `json:"run_history"`
-	CreatedAt  string      `json:"created_at"`
-	UpdatedAt  string      `json:"updated_at"`
+	// ExternalRefs holds tracker keys such as JIRA-123
+	ExternalRefs []string `json:"external_refs,omitempty"`
+	// Refs links the issues, pull requests and docs about the tanda
+	Refs []Ref `json:"refs,omitempty"`
+	// Owners holds the users or teams responsible, e.g. @org/checkout-team
+	Owners []string `json:"owners,omitempty"`
+	// Priority is p0 (most urgent) to p3, or empty when unset
+	Priority string `json:"priority,omitempty"`
+	// Triage is where a failing tanda is in the triage workflow, one of
+	// TriageStates, or empty for a tanda nobody needs to look at
+	Triage string `json:"triage,omitempty"`
+	// SnoozedUntil keeps the tanda off the flaky leaderboard until then,
+	// as RFC 3339, or is empty
+	SnoozedUntil string `json:"snoozed_until,omitempty"`
+	// Quarantines records when the tanda entered and left quarantine,
+	// oldest first
+	Quarantines []Quarantine `json:"quarantines,omitempty"`
+	// CoverLines holds the lines the tests executed in covered files, as
+	// FormatLines writes them, for files imported from coverage data
+	CoverLines map[string]string `json:"cover_lines,omitempty"`
+	// Symbol is the test function the tanda runs, such as TestLogin, and
+	// Line where File defines it, for editors to decorate; both optional
+	Symbol    string `json:"symbol,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	// Clock records which replica last wrote each field, for merging
+	// copies that were edited offline
+	Clock *Clock `json:"clock,omitempty"`
+}
+
+// Clock is the merge metadata stored alongside a tanda: a vector clock
+// counting edits per replica and the stamp of the last write to each field
+type Clock struct {
+	Vector map[string]uint64 `json:"vector,omitempty"`
+	Fields map[string]Stamp  `json:"fields,omitempty"`
+}
+
+// Stamp identifies a single field write for last-writer-wins
+type Stamp struct {
+	Timestamp string `json:"ts"`
+	Replica   string `json:"replica"`
 }
 
 // Note represents a note entry
 type Note struct {
+	// ID is derived from the note's content by NoteID; notes written before
+	// IDs existed have none, and Key derives it for them
+	ID        string `json:"id,omitempty"`
 	Timestamp string `json:"ts"`
 	Type      string `json:"type"`
-	Text      string `json:"text"`
+	// Author is who wrote the note, from config author or git user.name
+	Author string `json:"author,omitempty"`
+	// Parent is the Key of the note this one replies to
+	Parent string `json:"parent,omitempty"`
+	Text   string `json:"text"`
+	// Attachments are files kept with the note, such as screenshots
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment references a file stored under .tandas/blobs by its hash
+type Attachment struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+	Type string `json:"type,omitempty"`
 }
 
 // RunResult represents a test run result
@@ -35,20 +97,129 @@ type RunResult struct {
 	Result    string `json:"result"`
 	Duration  string `json:"duration,omitempty"`
 	Trace     string `json:"trace,omitempty"`
+	// Error holds the failure message of a failed run
+	Error string `json:"error,omitempty"`
+	// Runner, OS, Browser and Shard describe the environment the run
+	// happened in, where known
+	Runner  string `json:"runner,omitempty"`
+	OS      string `json:"os,omitempty"`
+	Browser string `json:"browser,omitempty"`
+	Shard   string `json:"shard,omitempty"`
+	// Batch names the ingestion the run came in with, such as a CI
+	// pipeline, so results can be compared batch to batch
+	Batch string `json:"batch,omitempty"`
+	// Commit is the git SHA the run tested, where known
+	Commit string `json:"commit,omitempty"`
+	// Summary is set on a daily summary pruning left in place of a day's
+	// runs; Result is then fail when any of them failed
+	Summary *RunSummary `json:"summary,omitempty"`
+}
+
+// RunSummary counts the runs of one day that were downsampled
+type RunSummary struct {
+	Runs     int `json:"runs"`
+	Failures int `json:"failures"`
+	Skips    int `json:"skips,omitempty"`
 }
 
 // Store manages the SQLite database
 type Store struct {
 	db *sql.DB
+	// gen counts committed writes to tandas, so readers can tell when
+	// something they cached is stale
+	gen atomic.Uint64
+	// compress stores notes and run history zstd compressed
+	compress bool
 }
 
-// Open opens or creates the SQLite database
+// busyTimeout is how long a write waits for another connection's
+// transaction, such as the daemon's import, before failing
+const busyTimeout = 30 * time.Second
+
+// SchemaVersion is the database schema this binary reads and writes, kept
+// in PRAGMA user_version. It is len(migrations).
+const SchemaVersion = 2
+
+// migration moves the schema up one version
+type migration struct {
+	name string
+	up   func(tx *sql.Tx) error
+}
+
+// migrations[i] moves a database from version i to i+1, in its own
+// transaction so a failure leaves the database at version i
+var migrations = []migration{
+	{"index covers", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+            INSERT OR IGNORE INTO tanda_covers (tanda_id, target)
+            SELECT tandas.id, json_each.value FROM tandas, json_each(tandas.covers)
+            WHERE json_valid(tandas.covers) AND json_each.type = 'text'
+        `)
+		return err
+	}},
+	{"duration percentiles", func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT id, run_history FROM tandas")
+		if err != nil {
+			return err
+		}
+		durations := make(map[string]Durations)
+		for rows.Next() {
+			var id string
+			var runHistoryJSON []byte
+			if err := rows.Scan(&id, &runHistoryJSON); err != nil {
+				rows.Close()
+				return err
+			}
+			var history []RunResult
+			json.Unmarshal(decodeBlob(runHistoryJSON), &history)
+			durations[id] = calculateDurations(history)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for id, d := range durations {
+			p50, p95 := d.nullMs()
+			if _, err := tx.Exec("UPDATE tandas SET duration_p50_ms = ?, duration_p95_ms = ? WHERE id = ?", p50, p95, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+}
+
+// SchemaTooNewError is returned by Open for a database written by a newer
+// binary, which this one would misread
+type SchemaTooNewError struct {
+	Path    string
+	Version int
+}
+
+func (e *SchemaTooNewError) Error() string {
+	return fmt.Sprintf("database %s has schema v%d but this td-daemon supports up to v%d: upgrade td-daemon, "+
+		"restore the snapshot taken before the upgrade with td-daemon snapshot restore, "+
+		"or delete the database to rebuild it from issues.jsonl", e.Path, e.Version, SchemaVersion)
+}
+
+// Open opens or creates the SQLite database, migrating an older schema
 func Open(path string) (*Store, error) {
-	db, err := sql.Open("sqlite", path)
+	// The pragma runs on every pooled connection
+	db, err := sql.Open("sqlite", fmt.Sprintf("%s?_pragma=busy_timeout(%d)", path, busyTimeout.Milliseconds()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	// Refuse a newer schema before changing anything
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version > SchemaVersion {
+		db.Close()
+		return nil, &SchemaTooNewError{Path: path, Version: version}
+	}
+
 	// Enable WAL mode for better concurrency
 	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
 		db.Close()
@@ -60,10 +231,48 @@ func Open(path string) (*Store, error) {
 		db.Close()
 		return nil, err
 	}
+	if err := store.migrate(version); err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	return store, nil
 }
 
+// Version reads the schema version of the database at path without
+// creating or migrating it. exists is false when there is no database or
+// it has no tables yet, so there is nothing to migrate.
+func Version(path string) (version int, exists bool, err error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	db, err := sql.Open("sqlite", fmt.Sprintf("%s?_pragma=busy_timeout(%d)", path, busyTimeout.Milliseconds()))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	var tables int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table'").Scan(&tables); err != nil {
+		return 0, false, fmt.Errorf("failed to read schema: %w", err)
+	}
+	return version, tables > 0, nil
+}
+
+// Copy writes a consistent copy of the database at src, including pages
+// still in its WAL, to dst without migrating it
+func Copy(src, dst string) error {
+	db, err := sql.Open("sqlite", fmt.Sprintf("%s?_pragma=busy_timeout(%d)", src, busyTimeout.Milliseconds()))
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	_, err = db.Exec("VACUUM INTO ?", dst)
+	return err
+}
+
 func (s *Store) initSchema() error {
 	schema := `
         CREATE TABLE IF NOT EXISTS tandas (
@@ -85,8 +294,136 @@ func (s *Store) initSchema() error {
         CREATE INDEX IF NOT EXISTS idx_file ON tandas(file);
         CREATE INDEX IF NOT EXISTS idx_flakiness ON tandas(flakiness_score);
         CREATE INDEX IF NOT EXISTS idx_last_run ON tandas(last_run_at);
+
+        CREATE TABLE IF NOT EXISTS ci_issues (
+            tanda_id TEXT NOT NULL,
+            provider TEXT NOT NULL,
+            issue_id TEXT NOT NULL,
+            url TEXT,
+            PRIMARY KEY (tanda_id, provider)
+        );
+
+        CREATE TABLE IF NOT EXISTS flakiness_snapshots (
+            tanda_id TEXT NOT NULL,
+            ts TEXT NOT NULL,
+            score REAL NOT NULL,
+            PRIMARY KEY (tanda_id, ts)
+        );
+
+        CREATE TABLE IF NOT EXISTS tanda_covers (
+            tanda_id TEXT NOT NULL,
+            target TEXT NOT NULL,
+            PRIMARY KEY (tanda_id, target)
+        );
+        CREATE INDEX IF NOT EXISTS idx_covers_target ON tanda_covers(target);
+
+        CREATE TABLE IF NOT EXISTS external_sync (
+            tanda_id TEXT NOT NULL,
+            ref TEXT NOT NULL,
+            summary TEXT NOT NULL,
+            PRIMARY KEY (tanda_id, ref)
+        );
     `
-	_, err := s.db.Exec(schema)
+	if _, err := s.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// Columns added after the initial schema; existing caches need them too
+	if err := s.ensureColumn("tandas", "external_refs", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tandas", "owners", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tandas", "clock", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tandas", "priority", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tandas", "triage", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tandas", "refs", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tandas", "duration_p50_ms", "INTEGER"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tandas", "duration_p95_ms", "INTEGER"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tandas", "quarantines", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tandas", "cover_lines", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tandas", "snoozed_until", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tandas", "symbol", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tandas", "line", "INTEGER"); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`
+        CREATE INDEX IF NOT EXISTS idx_triage ON tandas(triage);
+        CREATE INDEX IF NOT EXISTS idx_duration_p95 ON tandas(duration_p95_ms);
+    `)
+	return err
+}
+
+// migrate runs the migrations from version up to SchemaVersion
+func (s *Store) migrate(version int) error {
+	for v := version; v < SchemaVersion; v++ {
+		m := migrations[v]
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration: %w", err)
+		}
+		if err := m.up(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate database to v%d (%s): %w", v+1, m.name, err)
+		}
+		// user_version is in the database header, so it commits with the
+		// migration
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", v+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate database to v%d: %w", v+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to migrate database to v%d: %w", v+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) ensureColumn(table, column, decl string) error {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl))
 	return err
 }
 
@@ -95,14 +432,63 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
+// execer is implemented by *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Generation returns a counter that changes whenever tandas are written
+// through this store. Writes by other processes are not counted; the
+// daemon sees them as a JSONL import.
+func (s *Store) Generation() uint64 {
+	return s.gen.Load()
+}
+
 // UpsertTanda inserts or updates a tanda
 func (s *Store) UpsertTanda(t *Tanda) error {
+	b, err := s.Begin()
+	if err != nil {
+		return err
+	}
+	defer b.Rollback()
+	if err := b.UpsertTanda(t); err != nil {
+		return err
+	}
+	return b.Commit()
+}
+
+func (s *Store) upsertTanda(db execer, t *Tanda) error {
+	stamp := t.UpdatedAt
+	if stamp == "" {
+		stamp = time.Now().UTC().Format(time.RFC3339)
+	}
+	t.TrackQuarantine(stamp)
+	var quarantinesJSON sql.NullString
+	if len(t.Quarantines) > 0 {
+		data, _ := json.Marshal(t.Quarantines)
+		quarantinesJSON = sql.NullString{String: string(data), Valid: true}
+	}
+	t.pruneCoverLines()
+	var coverLinesJSON sql.NullString
+	if len(t.CoverLines) > 0 {
+		data, _ := json.Marshal(t.CoverLines)
+		coverLinesJSON = sql.NullString{String: string(data), Valid: true}
+	}
 	coversJSON, _ := json.Marshal(t.Covers)
 	depsJSON, _ := json.Marshal(t.DependsOn)
 	notesJSON, _ := json.Marshal(t.Notes)
 	runHistoryJSON, _ := json.Marshal(t.RunHistory)
+	refsJSON, _ := json.Marshal(t.ExternalRefs)
+	ownersJSON, _ := json.Marshal(t.Owners)
+	linksJSON, _ := json.Marshal(t.Refs)
+	var clockJSON sql.NullString
+	if t.Clock != nil {
+		data, _ := json.Marshal(t.Clock)
+		clockJSON = sql.NullString{String: string(data), Valid: true}
+	}
 
 	flakiness := calculateFlakiness(t.RunHistory)
+	p50, p95 := calculateDurations(t.RunHistory).nullMs()
 	var lastRunAt, lastRunResult string
 	if len(t.RunHistory) > 0 {
 		last := t.RunHistory[len(t.RunHistory)-1]
@@ -110,10 +496,11 @@ func (s *Store) UpsertTanda(t *Tanda) error {
 		lastRunResult = last.Result
 	}
 
-	_, err := s.db.Exec(`
+	_, err := db.Exec(`
         INSERT INTO tandas (id, title, status, file, covers, depends_on, notes, run_history,
-                           flakiness_score, last_run_at, last_run_result, created_at, updated_at)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+                           flakiness_score, duration_p50_ms, duration_p95_ms, last_run_at, last_run_result,
+                           external_refs, refs, owners, priority, triage, snoozed_until, quarantines, cover_lines, symbol, line, clock, created_at, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
         ON CONFLICT(id) DO UPDATE SET
             title = excluded.title,
             status = excluded.status,
@@ -123,80 +510,671 @@ func (s *Store) UpsertTanda(t *Tanda) error {
             notes = excluded.notes,
             run_history = excluded.run_history,
             flakiness_score = excluded.flakiness_score,
+            duration_p50_ms = excluded.duration_p50_ms,
+            duration_p95_ms = excluded.duration_p95_ms,
             last_run_at = excluded.last_run_at,
             last_run_result = excluded.last_run_result,
+            external_refs = excluded.external_refs,
+            refs = excluded.refs,
+            owners = excluded.owners,
+            priority = excluded.priority,
+            triage = excluded.triage,
+            snoozed_until = excluded.snoozed_until,
+            quarantines = excluded.quarantines,
+            cover_lines = excluded.cover_lines,
+            symbol = excluded.symbol,
+            line = excluded.line,
+            clock = excluded.clock,
             updated_at = excluded.updated_at
     `, t.ID, t.Title, t.Status, t.File, string(coversJSON), string(depsJSON),
-		string(notesJSON), string(runHistoryJSON), flakiness, lastRunAt, lastRunResult,
-		t.CreatedAt, t.UpdatedAt)
+		s.encodeBlob(notesJSON), s.encodeBlob(runHistoryJSON), flakiness, p50, p95, lastRunAt, lastRunResult,
+		string(refsJSON), string(linksJSON), string(ownersJSON), t.Priority, t.Triage, t.SnoozedUntil, quarantinesJSON, coverLinesJSON, t.Symbol, t.Line, clockJSON, t.CreatedAt, t.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return setCovers(db, t.ID, t.Covers)
+}
 
+// setCovers replaces a tanda's rows in the covers index
+func setCovers(db execer, id string, covers []string) error {
+	if _, err := db.Exec("DELETE FROM tanda_covers WHERE tanda_id = ?", id); err != nil {
+		return err
+	}
+	if len(covers) == 0 {
+		return nil
+	}
+	query := "INSERT OR IGNORE INTO tanda_covers (tanda_id, target) VALUES "
+	args := make([]interface{}, 0, 2*len(covers))
+	for i, c := range covers {
+		if i > 0 {
+			query += ", "
+		}
+		query += "(?, ?)"
+		args = append(args, id, c)
+	}
+	_, err := db.Exec(query, args...)
 	return err
 }
 
 // GetAllTandas returns all tandas from the database
 func (s *Store) GetAllTandas() ([]*Tanda, error) {
-	rows, err := s.db.Query(`
-        SELECT id, title, status, file, covers, depends_on, notes, run_history, created_at, updated_at
-        FROM tandas
-        ORDER BY updated_at DESC
-    `)
+	return s.QueryTandas(Filter{})
+}
+
+// Filter narrows QueryTandas; zero-valued fields match everything
+type Filter struct {
+	Status string `json:"status,omitempty"`
+	Owner  string `json:"owner,omitempty"`
+	// Priority and Triage match those fields exactly
+	Priority string `json:"priority,omitempty"`
+	Triage   string `json:"triage,omitempty"`
+	// SlowerThan matches tandas whose p95 duration is at least this long
+	SlowerThan time.Duration `json:"slower_than,omitempty"`
+}
+
+// QueryTandas returns the tandas matching a filter, most recently updated first
+func (s *Store) QueryTandas(f Filter) ([]*Tanda, error) {
+	return s.QueryTandasContext(context.Background(), f)
+}
+
+// QueryTandasContext is QueryTandas, stopping early when ctx is done
+func (s *Store) QueryTandasContext(ctx context.Context, f Filter) ([]*Tanda, error) {
+	var tandas []*Tanda
+	err := s.ForEachTandaContext(ctx, f, func(t *Tanda) error {
+		tandas = append(tandas, t)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return tandas, nil
+}
+
+// ForEachTanda calls fn for each tanda matching a filter, most recently
+// updated first, reading one row at a time so large registries are never
+// held in memory whole. It stops at the first error fn returns. fn must
+// not write to the store while iterating.
+func (s *Store) ForEachTanda(f Filter, fn func(*Tanda) error) error {
+	return s.ForEachTandaContext(context.Background(), f, fn)
+}
+
+// ForEachTandaContext is ForEachTanda, stopping with ctx's error when ctx
+// is done
+func (s *Store) ForEachTandaContext(ctx context.Context, f Filter, fn func(*Tanda) error) error {
+	query := "SELECT " + tandaColumns + " FROM tandas WHERE 1=1"
+	var args []interface{}
+	if f.Status != "" {
+		query += " AND status = ?"
+		args = append(args, f.Status)
+	}
+	if f.Owner != "" {
+		query += " AND EXISTS (SELECT 1 FROM json_each(tandas.owners) WHERE value = ?)"
+		args = append(args, f.Owner)
+	}
+	if f.Priority != "" {
+		query += " AND priority = ?"
+		args = append(args, f.Priority)
+	}
+	if f.Triage != "" {
+		query += " AND triage = ?"
+		args = append(args, f.Triage)
+	}
+	if f.SlowerThan > 0 {
+		query += " AND duration_p95_ms >= ?"
+		args = append(args, f.SlowerThan.Milliseconds())
+	}
+	query += " ORDER BY updated_at DESC"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
 	defer rows.Close()
 
-	var tandas []*Tanda
 	for rows.Next() {
-		var t Tanda
-		var file sql.NullString
-		var coversJSON, depsJSON, notesJSON, runHistoryJSON string
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		t, err := scanTanda(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CoveredBy returns the tandas whose covers include target, by ID. With
+// prefix, entries under target as a directory match too. The lookup uses
+// the covers index, so it stays fast on large registries.
+func (s *Store) CoveredBy(target string, prefix bool) ([]*Tanda, error) {
+	query := "SELECT " + tandaColumns + " FROM tandas WHERE id IN (SELECT tanda_id FROM tanda_covers WHERE target = ?"
+	args := []interface{}{target}
+	if prefix {
+		// Everything under target/ sorts between "target/" and "target0"
+		dir := strings.TrimSuffix(target, "/")
+		query += " OR (target >= ? AND target < ?)"
+		args = append(args, dir+"/", dir+"0")
+	}
+	query += ") ORDER BY id"
 
-		err := rows.Scan(&t.ID, &t.Title, &t.Status, &file, &coversJSON, &depsJSON,
-			&notesJSON, &runHistoryJSON, &t.CreatedAt, &t.UpdatedAt)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tandas := []*Tanda{}
+	for rows.Next() {
+		t, err := scanTanda(rows)
 		if err != nil {
 			return nil, err
 		}
+		tandas = append(tandas, t)
+	}
+	return tandas, rows.Err()
+}
 
-		if file.Valid {
-			t.File = file.String
+// ForFile returns the tandas whose file is path or whose covers name it,
+// in ID order, using the file and covers indexes
+func (s *Store) ForFile(path string) ([]*Tanda, error) {
+	rows, err := s.db.Query("SELECT "+tandaColumns+" FROM tandas WHERE file = ? OR id IN (SELECT tanda_id FROM tanda_covers WHERE target = ?) ORDER BY id", path, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tandas := []*Tanda{}
+	for rows.Next() {
+		t, err := scanTanda(rows)
+		if err != nil {
+			return nil, err
 		}
+		tandas = append(tandas, t)
+	}
+	return tandas, rows.Err()
+}
 
-		json.Unmarshal([]byte(coversJSON), &t.Covers)
-		json.Unmarshal([]byte(depsJSON), &t.DependsOn)
-		json.Unmarshal([]byte(notesJSON), &t.Notes)
-		json.Unmarshal([]byte(runHistoryJSON), &t.RunHistory)
+// GetTanda returns a single tanda, or nil if it does not exist
+func (s *Store) GetTanda(id string) (*Tanda, error) {
+	row := s.db.QueryRow("SELECT "+tandaColumns+" FROM tandas WHERE id = ?", id)
+	t, err := scanTanda(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
 
-		if t.Covers == nil {
-			t.Covers = []string{}
-		}
-		if t.DependsOn == nil {
-			t.DependsOn = []string{}
-		}
-		if t.Notes == nil {
-			t.Notes = []Note{}
-		}
-		if t.RunHistory == nil {
-			t.RunHistory = []RunResult{}
-		}
+const tandaColumns = "id, title, status, file, covers, depends_on, notes, run_history, external_refs, refs, owners, priority, triage, snoozed_until, quarantines, cover_lines, symbol, line, clock, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTanda(row rowScanner) (*Tanda, error) {
+	var t Tanda
+	var file, refsJSON, linksJSON, ownersJSON, priority, triage, snoozedUntil, quarantinesJSON, coverLinesJSON, symbol, clockJSON sql.NullString
+	var line sql.NullInt64
+	var coversJSON, depsJSON string
+	// Notes and run history may be stored compressed
+	var notesJSON, runHistoryJSON []byte
 
-		tandas = append(tandas, &t)
+	err := row.Scan(&t.ID, &t.Title, &t.Status, &file, &coversJSON, &depsJSON,
+		&notesJSON, &runHistoryJSON, &refsJSON, &linksJSON, &ownersJSON, &priority, &triage, &snoozedUntil, &quarantinesJSON, &coverLinesJSON, &symbol, &line, &clockJSON, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
 	}
 
-	return tandas, rows.Err()
+	t.File, t.Priority, t.Triage, t.SnoozedUntil = file.String, priority.String, triage.String, snoozedUntil.String
+	t.Symbol, t.Line = symbol.String, int(line.Int64)
+
+	json.Unmarshal([]byte(coversJSON), &t.Covers)
+	json.Unmarshal([]byte(depsJSON), &t.DependsOn)
+	json.Unmarshal(decodeBlob(notesJSON), &t.Notes)
+	json.Unmarshal(decodeBlob(runHistoryJSON), &t.RunHistory)
+	if refsJSON.Valid {
+		json.Unmarshal([]byte(refsJSON.String), &t.ExternalRefs)
+	}
+	if linksJSON.Valid {
+		json.Unmarshal([]byte(linksJSON.String), &t.Refs)
+	}
+	if ownersJSON.Valid {
+		json.Unmarshal([]byte(ownersJSON.String), &t.Owners)
+	}
+	if quarantinesJSON.Valid {
+		json.Unmarshal([]byte(quarantinesJSON.String), &t.Quarantines)
+	}
+	if coverLinesJSON.Valid {
+		json.Unmarshal([]byte(coverLinesJSON.String), &t.CoverLines)
+	}
+	if clockJSON.Valid {
+		t.Clock = &Clock{}
+		json.Unmarshal([]byte(clockJSON.String), t.Clock)
+	}
+
+	if t.Covers == nil {
+		t.Covers = []string{}
+	}
+	if t.DependsOn == nil {
+		t.DependsOn = []string{}
+	}
+	if t.Notes == nil {
+		t.Notes = []Note{}
+	}
+	if t.RunHistory == nil {
+		t.RunHistory = []RunResult{}
+	}
+
+	return &t, nil
 }
 
 // DeleteTanda removes a tanda from the database
 func (s *Store) DeleteTanda(id string) error {
-	_, err := s.db.Exec("DELETE FROM tandas WHERE id = ?", id)
+	err := deleteTanda(s.db, id)
+	s.gen.Add(1)
+	return err
+}
+
+func deleteTanda(db execer, id string) error {
+	_, err := db.Exec("DELETE FROM tandas WHERE id = ?", id)
+	if err == nil {
+		_, err = db.Exec("DELETE FROM tanda_covers WHERE tanda_id = ?", id)
+	}
 	return err
 }
 
 // ClearAll removes all tandas
 func (s *Store) ClearAll() error {
-	_, err := s.db.Exec("DELETE FROM tandas")
+	_, err := s.db.Exec("DELETE FROM tandas; DELETE FROM tanda_covers")
+	s.gen.Add(1)
+	return err
+}
+
+// Batch groups writes into one transaction, which is far faster than
+// committing each row on its own
+type Batch struct {
+	store *Store
+	tx    *sql.Tx
+}
+
+// Begin starts a batch; it must be ended with Commit or Rollback
+func (s *Store) Begin() (*Batch, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return &Batch{store: s, tx: tx}, nil
+}
+
+// UpsertTanda inserts or updates a tanda within the batch
+func (b *Batch) UpsertTanda(t *Tanda) error {
+	return b.store.upsertTanda(b.tx, t)
+}
+
+// GetTanda retrieves a tanda by ID, seeing the batch's own writes
+func (b *Batch) GetTanda(id string) (*Tanda, error) {
+	row := b.tx.QueryRow("SELECT "+tandaColumns+" FROM tandas WHERE id = ?", id)
+	t, err := scanTanda(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+// DeleteTanda removes a tanda within the batch
+func (b *Batch) DeleteTanda(id string) error {
+	return deleteTanda(b.tx, id)
+}
+
+// ClearAll removes all tandas within the batch
+func (b *Batch) ClearAll() error {
+	_, err := b.tx.Exec("DELETE FROM tandas; DELETE FROM tanda_covers")
 	return err
 }
 
+// Commit writes the batch
+func (b *Batch) Commit() error {
+	err := b.tx.Commit()
+	b.store.gen.Add(1)
+	return err
+}
+
+// Rollback discards the batch; it is a no-op after Commit
+func (b *Batch) Rollback() error {
+	return b.tx.Rollback()
+}
+
+// Vacuum rebuilds the database file to return the space of deleted rows
+// and empties the WAL
+func (s *Store) Vacuum() error {
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	if _, err := s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("failed to checkpoint WAL: %w", err)
+	}
+	return nil
+}
+
+// IssueRef links a tanda to an issue in an external tracker
+type IssueRef struct {
+	TandaID  string
+	Provider string
+	IssueID  string
+	URL      string
+}
+
+// GetIssueRef returns the issue linked to a tanda for a provider, or nil
+func (s *Store) GetIssueRef(tandaID, provider string) (*IssueRef, error) {
+	ref := IssueRef{TandaID: tandaID, Provider: provider}
+	var url sql.NullString
+	err := s.db.QueryRow(
+		"SELECT issue_id, url FROM ci_issues WHERE tanda_id = ? AND provider = ?",
+		tandaID, provider,
+	).Scan(&ref.IssueID, &url)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ref.URL = url.String
+	return &ref, nil
+}
+
+// ListIssueRefs returns all issues linked for a provider
+func (s *Store) ListIssueRefs(provider string) ([]*IssueRef, error) {
+	rows, err := s.db.Query(
+		"SELECT tanda_id, issue_id, url FROM ci_issues WHERE provider = ? ORDER BY tanda_id",
+		provider,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refs []*IssueRef
+	for rows.Next() {
+		ref := IssueRef{Provider: provider}
+		var url sql.NullString
+		if err := rows.Scan(&ref.TandaID, &ref.IssueID, &url); err != nil {
+			return nil, err
+		}
+		ref.URL = url.String
+		refs = append(refs, &ref)
+	}
+	return refs, rows.Err()
+}
+
+// SaveIssueRef records the issue linked to a tanda
+func (s *Store) SaveIssueRef(ref *IssueRef) error {
+	_, err := s.db.Exec(`
+        INSERT INTO ci_issues (tanda_id, provider, issue_id, url)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT(tanda_id, provider) DO UPDATE SET
+            issue_id = excluded.issue_id,
+            url = excluded.url
+    `, ref.TandaID, ref.Provider, ref.IssueID, ref.URL)
+	return err
+}
+
+// DeleteIssueRef removes the issue link for a tanda
+func (s *Store) DeleteIssueRef(tandaID, provider string) error {
+	_, err := s.db.Exec("DELETE FROM ci_issues WHERE tanda_id = ? AND provider = ?", tandaID, provider)
+	return err
+}
+
+// GetSyncedSummary returns the summary last pushed to an external ref
+func (s *Store) GetSyncedSummary(tandaID, ref string) (string, error) {
+	var summary string
+	err := s.db.QueryRow(
+		"SELECT summary FROM external_sync WHERE tanda_id = ? AND ref = ?",
+		tandaID, ref,
+	).Scan(&summary)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return summary, err
+}
+
+// SaveSyncedSummary records the summary pushed to an external ref
+func (s *Store) SaveSyncedSummary(tandaID, ref, summary string) error {
+	_, err := s.db.Exec(`
+        INSERT INTO external_sync (tanda_id, ref, summary)
+        VALUES (?, ?, ?)
+        ON CONFLICT(tanda_id, ref) DO UPDATE SET summary = excluded.summary
+    `, tandaID, ref, summary)
+	return err
+}
+
+// Snapshot is a tanda's flakiness score at a point in time
+type Snapshot struct {
+	Time  time.Time `json:"ts"`
+	Score float64   `json:"score"`
+}
+
+// RecordFlakiness stores a snapshot for every tanda whose score differs
+// from its latest snapshot, returning how many were written. Unchanged
+// scores are skipped, so the score at any time is the latest snapshot at
+// or before it.
+func (s *Store) RecordFlakiness(now time.Time) (int, error) {
+	tandas, err := s.GetAllTandas()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := s.db.Query(`
+        SELECT tanda_id, score FROM flakiness_snapshots f
+        WHERE ts = (SELECT MAX(ts) FROM flakiness_snapshots WHERE tanda_id = f.tanda_id)
+    `)
+	if err != nil {
+		return 0, err
+	}
+	latest := make(map[string]float64)
+	for rows.Next() {
+		var id string
+		var score float64
+		if err := rows.Scan(&id, &score); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		latest[id] = score
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	ts := now.UTC().Format(time.RFC3339)
+	written := 0
+	for _, t := range tandas {
+		score := t.Flakiness()
+		if prev, ok := latest[t.ID]; ok && prev == score {
+			continue
+		}
+		if _, err := s.db.Exec(
+			"INSERT OR REPLACE INTO flakiness_snapshots (tanda_id, ts, score) VALUES (?, ?, ?)",
+			t.ID, ts, score,
+		); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
+
+// FlakinessSnapshots returns every tanda's snapshots in time order
+func (s *Store) FlakinessSnapshots() (map[string][]Snapshot, error) {
+	rows, err := s.db.Query("SELECT tanda_id, ts, score FROM flakiness_snapshots ORDER BY tanda_id, ts")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string][]Snapshot)
+	for rows.Next() {
+		var id, ts string
+		var snap Snapshot
+		if err := rows.Scan(&id, &ts, &snap.Score); err != nil {
+			return nil, err
+		}
+		snap.Time, _ = time.Parse(time.RFC3339, ts)
+		out[id] = append(out[id], snap)
+	}
+	return out, rows.Err()
+}
+
+// AddRun appends a run result and applies the same automatic status
+// changes as `td update --run-result`: active tandas become flaky at a
+// 20% failure rate, and flaky tandas recover after a clean window. A
+// tanda turning flaky enters triage as untriaged unless it is already in.
+func (t *Tanda) AddRun(run RunResult) {
+	t.RunHistory = append(t.RunHistory, run)
+	t.UpdatedAt = run.Timestamp
+
+	flakiness := calculateFlakiness(t.RunHistory)
+	if flakiness >= 0.2 && t.Status == "active" {
+		t.Status = "flaky"
+		if t.Triage == "" {
+			t.SetTriage(TriageUntriaged, run.Timestamp)
+		}
+	} else if flakiness == 0 && t.Status == "flaky" && len(t.RunHistory) >= 3 {
+		t.Status = "active"
+	}
+}
+
+// Triage states, in workflow order
+const (
+	TriageUntriaged    = "untriaged"
+	TriageAcknowledged = "acknowledged"
+	TriageFixing       = "fixing"
+	TriageWontfix      = "wontfix"
+)
+
+// TriageStates are the valid values of Tanda.Triage
+var TriageStates = []string{TriageUntriaged, TriageAcknowledged, TriageFixing, TriageWontfix}
+
+// Priorities are the valid values of Tanda.Priority, most urgent first
+var Priorities = []string{"p0", "p1", "p2", "p3"}
+
+// NoteTriage is the note type recording a triage or priority change
+const NoteTriage = "triage"
+
+// CheckTriage returns an error unless state is a triage state or empty
+func CheckTriage(state string) error {
+	return checkOneOf("triage state", state, TriageStates)
+}
+
+// CheckPriority returns an error unless p is a priority or empty
+func CheckPriority(p string) error {
+	return checkOneOf("priority", p, Priorities)
+}
+
+// CheckFields returns an error unless t's priority, triage state, snooze,
+// refs and line are valid
+func CheckFields(t *Tanda) error {
+	if err := CheckPriority(t.Priority); err != nil {
+		return fmt.Errorf("tanda %s: %w", t.ID, err)
+	}
+	if err := CheckTriage(t.Triage); err != nil {
+		return fmt.Errorf("tanda %s: %w", t.ID, err)
+	}
+	if _, ok := ParseTimestamp(t.SnoozedUntil); t.SnoozedUntil != "" && !ok {
+		return fmt.Errorf("tanda %s: invalid snoozed_until %q", t.ID, t.SnoozedUntil)
+	}
+	if err := CheckRefs(t.Refs); err != nil {
+		return fmt.Errorf("tanda %s: %w", t.ID, err)
+	}
+	if t.Line < 0 {
+		return fmt.Errorf("tanda %s: invalid line %d", t.ID, t.Line)
+	}
+	return nil
+}
+
+// PriorityRank orders priorities most urgent first, unset last
+func PriorityRank(p string) int {
+	for i, s := range Priorities {
+		if p == s {
+			return i
+		}
+	}
+	return len(Priorities)
+}
+
+func checkOneOf(what, v string, valid []string) error {
+	if v == "" {
+		return nil
+	}
+	for _, s := range valid {
+		if v == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid %s %q: use %s", what, v, strings.Join(valid, ", "))
+}
+
+// SetTriage moves the tanda to a triage state, keeping the transition as
+// a triage note so the history survives later changes. It reports whether
+// the state changed.
+func (t *Tanda) SetTriage(state, ts string) bool {
+	if state == t.Triage {
+		return false
+	}
+	t.Notes = append(t.Notes, Note{Timestamp: ts, Type: NoteTriage,
+		Text: fmt.Sprintf("triage: %s -> %s", orNone(t.Triage), orNone(state))})
+	t.Triage = state
+	return true
+}
+
+// SetPriority changes the tanda's priority, noting the change like SetTriage
+func (t *Tanda) SetPriority(p, ts string) bool {
+	if p == t.Priority {
+		return false
+	}
+	t.Notes = append(t.Notes, Note{Timestamp: ts, Type: NoteTriage,
+		Text: fmt.Sprintf("priority: %s -> %s", orNone(t.Priority), orNone(p))})
+	t.Priority = p
+	return true
+}
+
+// Snoozed reports whether the tanda is snoozed at now
+func (t *Tanda) Snoozed(now time.Time) bool {
+	until, ok := ParseTimestamp(t.SnoozedUntil)
+	return ok && now.Before(until)
+}
+
+// SetSnooze snoozes the tanda until the given RFC 3339 time, or wakes it
+// when until is empty, noting the change like SetTriage
+func (t *Tanda) SetSnooze(until, ts string) bool {
+	if until == t.SnoozedUntil {
+		return false
+	}
+	text := "snoozed until " + until
+	if until == "" {
+		text = "snooze cleared"
+	}
+	t.Notes = append(t.Notes, Note{Timestamp: ts, Type: NoteTriage, Text: text})
+	t.SnoozedUntil = until
+	return true
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// IsQuarantined reports whether a status keeps a tanda out of the main suite
+func IsQuarantined(status string) bool {
+	return status == "flaky" || status == "quarantined"
+}
+
+// Flakiness returns the failure rate over the last 10 runs
+func (t *Tanda) Flakiness() float64 {
+	return calculateFlakiness(t.RunHistory)
+}
+
 func calculateFlakiness(history []RunResult) float64 {
 	if len(history) == 0 {
 		return 0
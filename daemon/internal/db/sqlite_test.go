@@ -1,7 +1,11 @@
 package db_test
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -82,3 +86,479 @@ func TestClearAll(t *testing.T) {
 		t.Fatalf("expected 0 tandas after clear, got %d", len(tandas))
 	}
 }
+
+func TestExternalRefsRoundTrip(t *testing.T) {
+	store := newStore(t)
+
+	tanda := &db.Tanda{
+		ID:           "td-refs",
+		Title:        "Checkout",
+		Status:       "active",
+		ExternalRefs: []string{"JIRA-123"},
+		CreatedAt:    time.Now().Format(time.RFC3339),
+		UpdatedAt:    time.Now().Format(time.RFC3339),
+	}
+	if err := store.UpsertTanda(tanda); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	got, err := store.GetTanda("td-refs")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(got.ExternalRefs) != 1 || got.ExternalRefs[0] != "JIRA-123" {
+		t.Fatalf("expected external refs to round-trip, got %v", got.ExternalRefs)
+	}
+
+	missing, err := store.GetTanda("td-missing")
+	if err != nil {
+		t.Fatalf("get missing: %v", err)
+	}
+	if missing != nil {
+		t.Fatalf("expected nil for missing tanda, got %+v", missing)
+	}
+}
+
+func TestForEachTanda(t *testing.T) {
+	store := newStore(t)
+
+	for i, status := range []string{"active", "flaky", "active"} {
+		tanda := &db.Tanda{
+			ID:        "td-test-" + string(rune('a'+i)),
+			Title:     "Example",
+			Status:    status,
+			CreatedAt: "2025-01-01T00:00:00Z",
+			UpdatedAt: "2025-01-0" + string(rune('1'+i)) + "T00:00:00Z",
+		}
+		if err := store.UpsertTanda(tanda); err != nil {
+			t.Fatalf("upsert %d: %v", i, err)
+		}
+	}
+
+	var ids []string
+	err := store.ForEachTanda(db.Filter{Status: "active"}, func(t *db.Tanda) error {
+		ids = append(ids, t.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("for each: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != "td-test-c" || ids[1] != "td-test-a" {
+		t.Fatalf("expected active tandas newest first, got %v", ids)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = store.ForEachTanda(db.Filter{}, func(*db.Tanda) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fatalf("expected iteration to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestTriage(t *testing.T) {
+	store := newStore(t)
+
+	// Turning flaky puts a tanda into triage
+	tanda := &db.Tanda{ID: "td-triage", Title: "Checkout", Status: "active", CreatedAt: "2025-01-01T00:00:00Z"}
+	tanda.AddRun(db.RunResult{Timestamp: "2025-01-02T00:00:00Z", Result: "fail"})
+	if tanda.Status != "flaky" || tanda.Triage != db.TriageUntriaged {
+		t.Fatalf("expected a flaky, untriaged tanda, got %s/%s", tanda.Status, tanda.Triage)
+	}
+	if !tanda.SetTriage(db.TriageFixing, "2025-01-03T00:00:00Z") || tanda.SetTriage(db.TriageFixing, "2025-01-03T00:00:00Z") {
+		t.Fatal("expected only a change of state to be a transition")
+	}
+	tanda.SetPriority("p1", "2025-01-03T00:00:00Z")
+	var history []string
+	for _, n := range tanda.Notes {
+		if n.Type == db.NoteTriage {
+			history = append(history, n.Text)
+		}
+	}
+	want := []string{"triage: none -> untriaged", "triage: untriaged -> fixing", "priority: none -> p1"}
+	if fmt.Sprint(history) != fmt.Sprint(want) {
+		t.Fatalf("expected triage history %v, got %v", want, history)
+	}
+
+	if err := store.UpsertTanda(tanda); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	other := &db.Tanda{ID: "td-other", Title: "Search", Status: "flaky", Triage: db.TriageFixing, Priority: "p3"}
+	if err := store.UpsertTanda(other); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	got, err := store.QueryTandas(db.Filter{Triage: db.TriageFixing, Priority: "p1"})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "td-triage" || got[0].Priority != "p1" {
+		t.Fatalf("expected td-triage alone, got %+v", got)
+	}
+
+	// A snooze is stored and lapses at its time
+	if !other.SetSnooze("2025-01-10T00:00:00Z", "2025-01-03T00:00:00Z") {
+		t.Fatal("expected snoozing to change the tanda")
+	}
+	if err := store.UpsertTanda(other); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	snoozed, err := store.GetTanda("td-other")
+	if err != nil || snoozed.SnoozedUntil != "2025-01-10T00:00:00Z" {
+		t.Fatalf("expected the snooze stored, got %+v (%v)", snoozed, err)
+	}
+	if !snoozed.Snoozed(time.Date(2025, 1, 9, 0, 0, 0, 0, time.UTC)) || snoozed.Snoozed(time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Error("expected the snooze to last until 2025-01-10")
+	}
+
+	if err := db.CheckTriage("closed"); err == nil {
+		t.Error("expected an unknown triage state to be rejected")
+	}
+	if err := db.CheckPriority(""); err != nil {
+		t.Errorf("expected an empty priority to be allowed, got %v", err)
+	}
+}
+
+func TestRefs(t *testing.T) {
+	store := newStore(t)
+
+	refs := []db.Ref{
+		{Type: db.RefIssue, ID: "JIRA-123"},
+		{Type: db.RefPR, URL: "https://github.com/o/r/pull/42", ID: "#42"},
+		{Type: db.RefDoc, URL: "https://wiki.example.com/checkout"},
+	}
+	if err := db.CheckRefs(refs); err != nil {
+		t.Fatalf("expected valid refs, got %v", err)
+	}
+	if err := store.UpsertTanda(&db.Tanda{ID: "td-refs", Title: "Checkout", Status: "active", Refs: refs}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	got, err := store.GetTanda("td-refs")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if fmt.Sprint(got.Refs) != fmt.Sprint(refs) || got.Refs[1].String() != "pr #42 https://github.com/o/r/pull/42" {
+		t.Fatalf("expected refs to round-trip, got %v", got.Refs)
+	}
+
+	for _, bad := range []db.Ref{
+		{ID: "JIRA-1"},
+		{Type: "ticket", ID: "JIRA-1"},
+		{Type: db.RefDoc},
+		{Type: db.RefDoc, URL: "docs/checkout.md"},
+		{Type: db.RefPR, URL: "javascript:alert(1)"},
+	} {
+		if err := bad.Check(); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	store := newStore(t)
+	gen := store.Generation()
+
+	if err := store.UpsertTanda(&db.Tanda{ID: "td-a", Title: "A", Status: "active"}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if store.Generation() == gen {
+		t.Fatal("expected upsert to advance the generation")
+	}
+
+	gen = store.Generation()
+	batch, err := store.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := batch.UpsertTanda(&db.Tanda{ID: "td-b", Title: "B", Status: "active"}); err != nil {
+		t.Fatalf("batch upsert: %v", err)
+	}
+	if store.Generation() != gen {
+		t.Fatal("expected uncommitted writes to leave the generation alone")
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if store.Generation() == gen {
+		t.Fatal("expected commit to advance the generation")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	store := newStore(t)
+
+	runs := make([]db.RunResult, 200)
+	for i := range runs {
+		runs[i] = db.RunResult{Timestamp: "2025-01-01T00:00:00Z", Result: "pass", Duration: "1.2s"}
+	}
+	plain := &db.Tanda{ID: "td-plain", Title: "Plain", Status: "active", RunHistory: runs}
+	if err := store.UpsertTanda(plain); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	store.SetCompression(true)
+	packed := &db.Tanda{ID: "td-packed", Title: "Packed", Status: "active", RunHistory: runs,
+		Notes: []db.Note{{Timestamp: "2025-01-01T00:00:00Z", Type: "note", Text: "short"}}}
+	if err := store.UpsertTanda(packed); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	// Rows written either way read back the same
+	for _, id := range []string{"td-plain", "td-packed"} {
+		got, err := store.GetTanda(id)
+		if err != nil || got == nil {
+			t.Fatalf("get %s: %v", id, err)
+		}
+		if len(got.RunHistory) != len(runs) || got.RunHistory[0].Duration != "1.2s" {
+			t.Fatalf("%s: run history not restored: %d runs", id, len(got.RunHistory))
+		}
+	}
+	if got, _ := store.GetTanda("td-packed"); len(got.Notes) != 1 || got.Notes[0].Text != "short" {
+		t.Fatalf("notes not restored: %+v", got.Notes)
+	}
+}
+
+func TestCoveredBy(t *testing.T) {
+	store := newStore(t)
+
+	for _, tanda := range []*db.Tanda{
+		{ID: "td-a", Title: "A", Status: "active", Covers: []string{"pkg/auth/login.go", "pkg/auth/token.go"}},
+		{ID: "td-b", Title: "B", Status: "active", Covers: []string{"pkg/auth/login.go"}},
+		{ID: "td-c", Title: "C", Status: "active", Covers: []string{"pkg/authz/policy.go"}},
+	} {
+		if err := store.UpsertTanda(tanda); err != nil {
+			t.Fatalf("upsert %s: %v", tanda.ID, err)
+		}
+	}
+
+	ids := func(target string, prefix bool) []string {
+		t.Helper()
+		tandas, err := store.CoveredBy(target, prefix)
+		if err != nil {
+			t.Fatalf("covered by %s: %v", target, err)
+		}
+		var out []string
+		for _, tanda := range tandas {
+			out = append(out, tanda.ID)
+		}
+		return out
+	}
+
+	if got := ids("pkg/auth/login.go", false); len(got) != 2 || got[0] != "td-a" || got[1] != "td-b" {
+		t.Fatalf("expected td-a and td-b, got %v", got)
+	}
+	// pkg/authz is a sibling, not under pkg/auth
+	if got := ids("pkg/auth", true); len(got) != 2 {
+		t.Fatalf("expected td-a and td-b under pkg/auth, got %v", got)
+	}
+
+	if err := store.UpsertTanda(&db.Tanda{ID: "td-b", Title: "B", Status: "active", Covers: []string{"pkg/other.go"}}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if err := store.DeleteTanda("td-a"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := ids("pkg/auth/login.go", false); len(got) != 0 {
+		t.Fatalf("expected replaced and deleted covers to be gone, got %v", got)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+	if _, exists, err := db.Version(path); err != nil || exists {
+		t.Fatalf("missing database: exists %v, err %v", exists, err)
+	}
+	store, err := db.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if version, exists, err := db.Version(path); err != nil || !exists || version != db.SchemaVersion {
+		t.Fatalf("got version %d, exists %v, err %v", version, exists, err)
+	}
+
+	// A newer binary's database is refused untouched
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec(fmt.Sprintf("PRAGMA user_version = %d", db.SchemaVersion+1)); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+	var tooNew *db.SchemaTooNewError
+	if _, err := db.Open(path); !errors.As(err, &tooNew) || tooNew.Version != db.SchemaVersion+1 {
+		t.Fatalf("expected SchemaTooNewError, got %v", err)
+	}
+	if version, _, _ := db.Version(path); version != db.SchemaVersion+1 {
+		t.Fatalf("refused database changed to version %d", version)
+	}
+}
+
+func TestNoteThreads(t *testing.T) {
+	store := newStore(t)
+
+	root := db.Note{Timestamp: "2025-01-01T00:00:00Z", Type: "note", Author: "ana", Text: "fails after session refresh"}
+	root.ID = db.NoteID(root)
+	reply := db.Note{Timestamp: "2025-01-02T00:00:00Z", Type: "note", Author: "ben", Parent: root.ID, Text: "token expiry?"}
+	reply.ID = db.NoteID(reply)
+	legacy := db.Note{Timestamp: "2025-01-03T00:00:00Z", Type: "note", Text: "written before note IDs"}
+	answer := db.Note{Timestamp: "2025-01-04T00:00:00Z", Type: "note", Author: "ana", Parent: reply.ID, Text: "yes, fixed"}
+	orphan := db.Note{Timestamp: "2025-01-05T00:00:00Z", Type: "note", Parent: "n-00000000", Text: "parent pruned"}
+	tanda := &db.Tanda{ID: "td-thread", Title: "Login", Status: "active",
+		Notes: []db.Note{root, reply, legacy, answer, orphan}}
+	if err := store.UpsertTanda(tanda); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	got, _ := store.GetTanda("td-thread")
+	if got.Notes[1].Author != "ben" || got.Notes[1].Parent != root.ID || got.Notes[1].ID != reply.ID {
+		t.Fatalf("expected author and parent to round-trip, got %+v", got.Notes[1])
+	}
+	if legacy.Key() != db.NoteID(legacy) || db.FindNote(got.Notes, legacy.Key()) != 2 {
+		t.Fatalf("expected a note without an ID to be found by its derived key")
+	}
+
+	var order []string
+	for _, n := range db.Thread(got.Notes) {
+		order = append(order, fmt.Sprintf("%d:%s", n.Depth, n.Text))
+	}
+	want := []string{"0:fails after session refresh", "1:token expiry?", "2:yes, fixed", "0:written before note IDs", "0:parent pruned"}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Fatalf("expected threads %v, got %v", want, order)
+	}
+}
+
+func TestDurations(t *testing.T) {
+	tanda := &db.Tanda{ID: "td-slow", Title: "Export", Status: "active"}
+	// Only the last DurationWindow timed runs count
+	for i := 0; i < 5; i++ {
+		tanda.RunHistory = append(tanda.RunHistory, db.RunResult{Result: "pass", Duration: "1m"})
+	}
+	for i := 1; i <= db.DurationWindow; i++ {
+		tanda.RunHistory = append(tanda.RunHistory, db.RunResult{Result: "pass", Duration: fmt.Sprintf("%ds", i)})
+	}
+	tanda.RunHistory = append(tanda.RunHistory, db.RunResult{Result: "skip"})
+	if d := tanda.Durations(); d.P50 != 10*time.Second || d.P95 != 19*time.Second || d.Runs != db.DurationWindow {
+		t.Fatalf("unexpected durations %+v", d)
+	}
+	if d := (&db.Tanda{}).Durations(); d != (db.Durations{}) {
+		t.Fatalf("expected no durations without timed runs, got %+v", d)
+	}
+
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+	store, err := db.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast := &db.Tanda{ID: "td-fast", Title: "Login", Status: "active", RunHistory: []db.RunResult{{Result: "pass", Duration: "2s"}}}
+	for _, td := range []*db.Tanda{tanda, fast, {ID: "td-new", Title: "New", Status: "active"}} {
+		if err := store.UpsertTanda(td); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+	}
+	got, err := store.QueryTandas(db.Filter{SlowerThan: 15 * time.Second})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "td-slow" {
+		t.Fatalf("expected td-slow alone, got %+v", got)
+	}
+	store.Close()
+
+	// Opening a version 1 database backfills the stored percentiles
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec("UPDATE tandas SET duration_p50_ms = NULL, duration_p95_ms = NULL; PRAGMA user_version = 1"); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+	store, err = db.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if got, _ := store.QueryTandas(db.Filter{SlowerThan: time.Second}); len(got) != 2 {
+		t.Fatalf("expected the migration to backfill durations, got %d tandas", len(got))
+	}
+}
+
+func TestTrackQuarantine(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	tanda := &db.Tanda{ID: "td-cart", Title: "Cart", Status: "active", UpdatedAt: "2025-06-01T00:00:00Z"}
+	upsert := func(status, ts string) {
+		t.Helper()
+		tanda.Status, tanda.UpdatedAt = status, ts
+		if err := store.UpsertTanda(tanda); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+		if tanda, err = store.GetTanda("td-cart"); err != nil {
+			t.Fatalf("get: %v", err)
+		}
+	}
+	upsert("active", "2025-06-01T00:00:00Z")
+	if len(tanda.Quarantines) != 0 {
+		t.Fatalf("an active tanda should have no spans, got %+v", tanda.Quarantines)
+	}
+	upsert("flaky", "2025-06-02T00:00:00Z")
+	// Moving between quarantined statuses keeps the span open
+	upsert("quarantined", "2025-06-03T00:00:00Z")
+	upsert("active", "2025-06-06T00:00:00Z")
+	upsert("flaky", "2025-06-08T00:00:00Z")
+
+	want := []db.Quarantine{{Entered: "2025-06-02T00:00:00Z", Left: "2025-06-06T00:00:00Z"}, {Entered: "2025-06-08T00:00:00Z"}}
+	if !reflect.DeepEqual(tanda.Quarantines, want) {
+		t.Fatalf("spans = %+v, want %+v", tanda.Quarantines, want)
+	}
+	if d := tanda.Quarantines[0].Duration(time.Now()); d != 4*24*time.Hour {
+		t.Fatalf("closed span lasted %s", d)
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	ranges, err := db.ParseLines("50, 10-20,18-30,31,7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := db.FormatLines(ranges); got != "7,10-31,50" {
+		t.Errorf("FormatLines = %s, want 7,10-31,50", got)
+	}
+	for _, bad := range []string{"0", "9-3", "a-b", "4-"} {
+		if _, err := db.ParseLines(bad); err == nil {
+			t.Errorf("ParseLines(%q) should fail", bad)
+		}
+	}
+	if !(db.LineRange{Start: 3, End: 5}).Overlaps(db.LineRange{Start: 5, End: 9}) || (db.LineRange{Start: 3, End: 4}).Overlaps(db.LineRange{Start: 5, End: 9}) {
+		t.Error("Overlaps is wrong at the boundary")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	if since := db.RunsSince(0, now); !since.IsZero() {
+		t.Errorf("RunsSince(0) = %v, want every run", since)
+	}
+	since := db.RunsSince(7, now)
+	for _, c := range []struct {
+		ts string
+		in bool
+	}{
+		{"2025-06-09T12:00:00Z", true},
+		{"2025-06-03T12:00:00Z", true},
+		{"2025-06-01T12:00:00Z", false},
+		{"", true},
+	} {
+		if got := db.InWindow(db.RunResult{Timestamp: c.ts}, since); got != c.in {
+			t.Errorf("InWindow(%q) = %v, want %v", c.ts, got, c.in)
+		}
+		if !db.InWindow(db.RunResult{Timestamp: c.ts}, time.Time{}) {
+			t.Errorf("InWindow(%q) without a window = false", c.ts)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"strconv"
+	"time"
+)
+
+// ParseTimestamp parses run/note timestamps. Go writes RFC3339; td.py
+// writes naive local time (2006-01-02T15:04:05).
+func ParseTimestamp(s string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// RunsSince is the start of a window of the last days days, or the zero
+// time, meaning every run kept in run history, when days is not positive
+func RunsSince(days int, now time.Time) time.Time {
+	if days <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-time.Duration(days) * 24 * time.Hour)
+}
+
+// InWindow reports whether a run falls in the window starting at since.
+// Runs without a readable timestamp are counted.
+func InWindow(r RunResult, since time.Time) bool {
+	if since.IsZero() {
+		return true
+	}
+	ts, ok := ParseTimestamp(r.Timestamp)
+	return !ok || !ts.Before(since)
+}
+
+// ParseDuration parses a run duration such as "2.3s" or "450ms". Bare
+// numbers are taken as seconds.
+func ParseDuration(s string) (time.Duration, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(f * float64(time.Second)), true
+	}
+	return 0, false
+}
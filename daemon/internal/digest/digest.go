@@ -0,0 +1,383 @@
+package digest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// StateFileName records what the previous digest saw
+const StateFileName = "digest_state.json"
+
+const slowestLimit = 5
+
+// regressionRatio is how much slower a tanda's average run must be than in
+// the previous period to count as a regression
+const regressionRatio = 1.2
+
+// Entry identifies a tanda in a digest section
+type Entry struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// SlowEntry is a tanda ranked by average run duration over the period
+type SlowEntry struct {
+	Entry
+	Average time.Duration `json:"average_ns"`
+	Runs    int           `json:"runs"`
+}
+
+// Regression is a tanda whose average run got slower than in the previous
+// period
+type Regression struct {
+	Entry
+	Previous time.Duration `json:"previous_ns"`
+	Average  time.Duration `json:"average_ns"`
+}
+
+// Digest summarizes registry changes over a period, for the whole registry
+// or for the tandas of one owner. PassRate is the share of passing runs
+// among those that passed or failed, and PreviousPassRate the same for the
+// period of equal length before; either is nil without such runs.
+type Digest struct {
+	Owner            string       `json:"owner,omitempty"`
+	Since            time.Time    `json:"since"`
+	Until            time.Time    `json:"until"`
+	Runs             int          `json:"runs"`
+	Failures         int          `json:"failures"`
+	PassRate         *float64     `json:"pass_rate"`
+	PreviousPassRate *float64     `json:"previous_pass_rate"`
+	NewFlaky         []Entry      `json:"new_flaky"`
+	Fixed            []Entry      `json:"fixed"`
+	Added            []Entry      `json:"added"`
+	Archived         []Entry      `json:"archived"`
+	Uncovered        []Entry      `json:"uncovered"`
+	NotRun           []Entry      `json:"not_run"`
+	Slowest          []SlowEntry  `json:"slowest"`
+	Regressions      []Regression `json:"regressions"`
+}
+
+// State is the snapshot taken when a digest is sent, used as the baseline
+// for the next one
+type State struct {
+	LastSent    time.Time `json:"last_sent"`
+	Quarantined []string  `json:"quarantined"`
+	Archived    []string  `json:"archived,omitempty"`
+}
+
+// LoadState reads the previous digest state; a missing file yields nil
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read digest state: %w", err)
+	}
+
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("failed to parse digest state: %w", err)
+	}
+	return &st, nil
+}
+
+// Save writes the state
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Snapshot captures the state to store after sending a digest
+func Snapshot(tandas []*db.Tanda, statuses *workflow.Workflow, now time.Time) *State {
+	st := &State{LastSent: now, Quarantined: []string{}}
+	for _, t := range tandas {
+		if db.IsQuarantined(t.Status) {
+			st.Quarantined = append(st.Quarantined, t.ID)
+		}
+		if statuses.IsRetired(t.Status) {
+			st.Archived = append(st.Archived, t.ID)
+		}
+	}
+	sort.Strings(st.Quarantined)
+	sort.Strings(st.Archived)
+	return st
+}
+
+// Build composes a digest. The period starts at the previous digest, or
+// at now-period when there is none; in that case tandas quarantined or
+// archived and updated within the period count as newly so. The period of
+// equal length before it is the baseline for the pass rate and durations.
+// Tandas count as archived when statuses retires them, and are then left
+// out of Uncovered and NotRun; nil statuses retire deprecated and archived.
+func Build(tandas []*db.Tanda, statuses *workflow.Workflow, prev *State, period time.Duration, now time.Time) *Digest {
+	d := &Digest{
+		Since:       now.Add(-period),
+		Until:       now,
+		NewFlaky:    []Entry{},
+		Fixed:       []Entry{},
+		Added:       []Entry{},
+		Archived:    []Entry{},
+		Uncovered:   []Entry{},
+		NotRun:      []Entry{},
+		Slowest:     []SlowEntry{},
+		Regressions: []Regression{},
+	}
+
+	wasQuarantined := make(map[string]bool)
+	wasArchived := make(map[string]bool)
+	if prev != nil {
+		d.Since = prev.LastSent
+		for _, id := range prev.Quarantined {
+			wasQuarantined[id] = true
+		}
+		for _, id := range prev.Archived {
+			wasArchived[id] = true
+		}
+	}
+	before := d.Since.Add(-d.Until.Sub(d.Since))
+	var cur, last tally
+
+	for _, t := range tandas {
+		entry := Entry{ID: t.ID, Title: t.Title}
+		quarantined := db.IsQuarantined(t.Status)
+		retired := statuses.IsRetired(t.Status)
+
+		switch {
+		case quarantined && prev != nil && !wasQuarantined[t.ID]:
+			d.NewFlaky = append(d.NewFlaky, entry)
+		case quarantined && prev == nil && inPeriod(t.UpdatedAt, d.Since):
+			d.NewFlaky = append(d.NewFlaky, entry)
+		case !quarantined && wasQuarantined[t.ID]:
+			d.Fixed = append(d.Fixed, entry)
+		}
+
+		switch {
+		case retired && prev != nil && !wasArchived[t.ID]:
+			d.Archived = append(d.Archived, entry)
+		case retired && prev == nil && inPeriod(t.UpdatedAt, d.Since):
+			d.Archived = append(d.Archived, entry)
+		}
+		if inPeriod(t.CreatedAt, d.Since) {
+			d.Added = append(d.Added, entry)
+		}
+
+		if len(t.Covers) == 0 && !retired {
+			d.Uncovered = append(d.Uncovered, entry)
+		}
+
+		var runs int
+		var now, earlier timing
+		for _, run := range t.RunHistory {
+			ts, ok := db.ParseTimestamp(run.Timestamp)
+			switch {
+			case !ok || ts.Before(before):
+				continue
+			case ts.Before(d.Since):
+				last.add(run)
+				earlier.add(run)
+				continue
+			}
+			runs++
+			if run.Result == "fail" {
+				d.Failures++
+			}
+			cur.add(run)
+			now.add(run)
+		}
+		d.Runs += runs
+
+		if runs == 0 && !retired {
+			d.NotRun = append(d.NotRun, entry)
+		}
+		if now.timed > 0 {
+			d.Slowest = append(d.Slowest, SlowEntry{Entry: entry, Average: now.average(), Runs: runs})
+		}
+		if now.timed > 0 && earlier.timed > 0 && float64(now.average()) >= regressionRatio*float64(earlier.average()) {
+			d.Regressions = append(d.Regressions, Regression{Entry: entry, Previous: earlier.average(), Average: now.average()})
+		}
+	}
+	d.PassRate, d.PreviousPassRate = cur.passRate(), last.passRate()
+
+	sort.Slice(d.Slowest, func(i, j int) bool { return d.Slowest[i].Average > d.Slowest[j].Average })
+	if len(d.Slowest) > slowestLimit {
+		d.Slowest = d.Slowest[:slowestLimit]
+	}
+	sort.Slice(d.Regressions, func(i, j int) bool {
+		a, b := d.Regressions[i], d.Regressions[j]
+		return a.Average-a.Previous > b.Average-b.Previous
+	})
+	if len(d.Regressions) > slowestLimit {
+		d.Regressions = d.Regressions[:slowestLimit]
+	}
+	return d
+}
+
+// tally counts passes and failures across tandas
+type tally struct{ passed, failed int }
+
+func (t *tally) add(run db.RunResult) {
+	switch run.Result {
+	case "pass":
+		t.passed++
+	case "fail":
+		t.failed++
+	}
+}
+
+func (t tally) passRate() *float64 {
+	if t.passed+t.failed == 0 {
+		return nil
+	}
+	rate := float64(t.passed) / float64(t.passed+t.failed)
+	return &rate
+}
+
+// timing averages one tanda's timed runs
+type timing struct {
+	total time.Duration
+	timed int
+}
+
+func (t *timing) add(run db.RunResult) {
+	if dur, ok := db.ParseDuration(run.Duration); ok {
+		t.total += dur
+		t.timed++
+	}
+}
+
+func (t timing) average() time.Duration {
+	return t.total / time.Duration(t.timed)
+}
+
+// PassRateDelta is the change in pass rate since the previous period, in
+// points; ok is false unless both periods had runs
+func (d *Digest) PassRateDelta() (delta float64, ok bool) {
+	if d.PassRate == nil || d.PreviousPassRate == nil {
+		return 0, false
+	}
+	return *d.PassRate - *d.PreviousPassRate, true
+}
+
+// OwnedBy returns the tandas owner is among the owners of
+func OwnedBy(tandas []*db.Tanda, owner string) []*db.Tanda {
+	var owned []*db.Tanda
+	for _, t := range tandas {
+		for _, o := range t.Owners {
+			if o == owner {
+				owned = append(owned, t)
+				break
+			}
+		}
+	}
+	return owned
+}
+
+// Subject returns a one-line title for the digest
+func (d *Digest) Subject() string {
+	title := "Tandas digest"
+	if d.Owner != "" {
+		title += " for " + d.Owner
+	}
+	return fmt.Sprintf("%s %s – %s: %d new flaky, %d fixed",
+		title, d.Since.Format("2006-01-02"), d.Until.Format("2006-01-02"), len(d.NewFlaky), len(d.Fixed))
+}
+
+// Summary is the one-line run summary shown under the title, with the pass
+// rate and its change from the previous period when known
+func (d *Digest) Summary() string {
+	s := fmt.Sprintf("%d run(s) recorded, %d failure(s).", d.Runs, d.Failures)
+	if d.PassRate == nil {
+		return s
+	}
+	s += fmt.Sprintf(" Pass rate %.1f%%", *d.PassRate*100)
+	if delta, ok := d.PassRateDelta(); ok {
+		s += fmt.Sprintf(" (%+.1f points from %.1f%%)", delta*100, *d.PreviousPassRate*100)
+	}
+	return s + "."
+}
+
+// Markdown renders the digest for email, files and chat webhooks
+func (d *Digest) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", d.Subject())
+	fmt.Fprintf(&b, "%s\n", d.Summary())
+
+	section := func(title string, entries []Entry) {
+		fmt.Fprintf(&b, "\n## %s (%d)\n\n", title, len(entries))
+		if len(entries) == 0 {
+			b.WriteString("None.\n")
+		}
+		for _, e := range entries {
+			fmt.Fprintf(&b, "- %s: %s\n", e.ID, e.Title)
+		}
+	}
+	section("New flaky tests", d.NewFlaky)
+	section("Fixed tests", d.Fixed)
+	section("Added tests", d.Added)
+	section("Archived tests", d.Archived)
+	section("Coverage gaps (no covers)", d.Uncovered)
+	section("Not run this period", d.NotRun)
+
+	fmt.Fprintf(&b, "\n## Slowest tests\n\n")
+	if len(d.Slowest) == 0 {
+		b.WriteString("No timed runs.\n")
+	}
+	for _, s := range d.Slowest {
+		fmt.Fprintf(&b, "- %s: %s (avg %s over %d run(s))\n", s.ID, s.Title, s.Average.Round(time.Millisecond), s.Runs)
+	}
+
+	fmt.Fprintf(&b, "\n## Slowest regressions\n\n")
+	if len(d.Regressions) == 0 {
+		b.WriteString("None.\n")
+	}
+	for _, r := range d.Regressions {
+		fmt.Fprintf(&b, "- %s: %s (avg %s, was %s)\n", r.ID, r.Title, r.Average.Round(time.Millisecond), r.Previous.Round(time.Millisecond))
+	}
+	return b.String()
+}
+
+//go:embed digest.html.tmpl
+var htmlTemplate string
+
+var htmlTmpl = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"ms": func(d time.Duration) time.Duration { return d.Round(time.Millisecond) },
+}).Parse(htmlTemplate))
+
+// HTML renders the digest as a standalone page, for wikis and HTML mail
+func (d *Digest) HTML() (string, error) {
+	var b strings.Builder
+	if err := htmlTmpl.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Render renders the digest as "markdown" or "html"
+func (d *Digest) Render(format string) (string, error) {
+	switch format {
+	case "", "markdown", "md":
+		return d.Markdown(), nil
+	case "html":
+		return d.HTML()
+	default:
+		return "", fmt.Errorf("unknown digest format %q (want markdown or html)", format)
+	}
+}
+
+func inPeriod(ts string, since time.Time) bool {
+	t, ok := db.ParseTimestamp(ts)
+	return ok && !t.Before(since)
+}
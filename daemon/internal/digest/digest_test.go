@@ -0,0 +1,170 @@
+package digest_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/digest"
+)
+
+func TestBuildAgainstPreviousState(t *testing.T) {
+	now := time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)
+	recent := now.Add(-24 * time.Hour).Format(time.RFC3339)
+	old := now.Add(-30 * 24 * time.Hour).Format(time.RFC3339)
+
+	tandas := []*db.Tanda{
+		{ID: "td-new", Title: "Cart", Status: "flaky", Covers: []string{"cart"},
+			RunHistory: []db.RunResult{{Timestamp: recent, Result: "fail", Duration: "2s"}}},
+		{ID: "td-fixed", Title: "Login", Status: "active",
+			RunHistory: []db.RunResult{{Timestamp: recent, Result: "pass", Duration: "500ms"}}},
+		{ID: "td-idle", Title: "Search", Status: "active", Covers: []string{"search"},
+			RunHistory: []db.RunResult{{Timestamp: old, Result: "pass"}}},
+		// Retired, so neither a coverage gap nor a test that didn't run
+		{ID: "td-retired", Title: "Legacy", Status: "archived"},
+	}
+	prev := &digest.State{LastSent: now.Add(-7 * 24 * time.Hour), Quarantined: []string{"td-fixed"}}
+
+	d := digest.Build(tandas, nil, prev, 7*24*time.Hour, now)
+
+	if len(d.NewFlaky) != 1 || d.NewFlaky[0].ID != "td-new" {
+		t.Fatalf("unexpected new flaky: %+v", d.NewFlaky)
+	}
+	if len(d.Fixed) != 1 || d.Fixed[0].ID != "td-fixed" {
+		t.Fatalf("unexpected fixed: %+v", d.Fixed)
+	}
+	if len(d.Uncovered) != 1 || d.Uncovered[0].ID != "td-fixed" {
+		t.Fatalf("unexpected coverage gaps: %+v", d.Uncovered)
+	}
+	if len(d.NotRun) != 1 || d.NotRun[0].ID != "td-idle" {
+		t.Fatalf("unexpected not-run: %+v", d.NotRun)
+	}
+	if d.Runs != 2 || d.Failures != 1 {
+		t.Fatalf("expected 2 runs with 1 failure, got %d/%d", d.Runs, d.Failures)
+	}
+	if len(d.Slowest) != 2 || d.Slowest[0].ID != "td-new" {
+		t.Fatalf("unexpected slowest ranking: %+v", d.Slowest)
+	}
+	if !strings.Contains(d.Markdown(), "## New flaky tests (1)") {
+		t.Fatalf("markdown missing section:\n%s", d.Markdown())
+	}
+}
+
+func TestBuildComparesWithPreviousPeriod(t *testing.T) {
+	now := time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)
+	day := func(n int) string { return now.Add(-time.Duration(n) * 24 * time.Hour).Format(time.RFC3339) }
+
+	tandas := []*db.Tanda{
+		{ID: "td-slow", Title: "Checkout", Status: "active", CreatedAt: day(20), RunHistory: []db.RunResult{
+			{Timestamp: day(10), Result: "pass", Duration: "1s"},
+			{Timestamp: day(9), Result: "pass", Duration: "1s"},
+			{Timestamp: day(2), Result: "fail", Duration: "3s"},
+		}},
+		{ID: "td-steady", Title: "Login", Status: "active", CreatedAt: day(20), RunHistory: []db.RunResult{
+			{Timestamp: day(10), Result: "fail", Duration: "1s"},
+			{Timestamp: day(2), Result: "pass", Duration: "1.1s"},
+		}},
+		{ID: "td-added", Title: "Wishlist", Status: "active", CreatedAt: day(1)},
+		{ID: "td-gone", Title: "Legacy", Status: "archived", CreatedAt: day(40), UpdatedAt: day(3)},
+		{ID: "td-long-gone", Title: "Old", Status: "archived", CreatedAt: day(40), UpdatedAt: day(30)},
+	}
+
+	d := digest.Build(tandas, nil, nil, 7*24*time.Hour, now)
+	if len(d.Added) != 1 || d.Added[0].ID != "td-added" {
+		t.Fatalf("unexpected added: %+v", d.Added)
+	}
+	if len(d.Archived) != 1 || d.Archived[0].ID != "td-gone" {
+		t.Fatalf("unexpected archived: %+v", d.Archived)
+	}
+	if len(d.Regressions) != 1 || d.Regressions[0].ID != "td-slow" ||
+		d.Regressions[0].Previous != time.Second || d.Regressions[0].Average != 3*time.Second {
+		t.Fatalf("unexpected regressions: %+v", d.Regressions)
+	}
+	if d.PassRate == nil || *d.PassRate != 0.5 || d.PreviousPassRate == nil || *d.PreviousPassRate != 2.0/3 {
+		t.Fatalf("unexpected pass rates %v, %v", d.PassRate, d.PreviousPassRate)
+	}
+	if !strings.Contains(d.Markdown(), "(-16.7 points from 66.7%)") {
+		t.Fatalf("markdown missing pass rate delta:\n%s", d.Markdown())
+	}
+
+	// With a previous digest, archived means archived since then
+	st := digest.Snapshot(tandas, nil, now)
+	tandas[0].Status = "archived"
+	if d := digest.Build(tandas, nil, st, 7*24*time.Hour, now.Add(time.Hour)); len(d.Archived) != 1 || d.Archived[0].ID != "td-slow" {
+		t.Fatalf("unexpected archived against state: %+v", d.Archived)
+	}
+
+	html, err := d.Render("html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, "<h2>Archived tests (1)</h2>") || !strings.Contains(html, "<td class=\"num\">3s</td>") {
+		t.Fatalf("unexpected html:\n%s", html)
+	}
+	if _, err := d.Render("pdf"); err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+}
+
+func TestRunWritesFileAndState(t *testing.T) {
+	dir := t.TempDir()
+	store, err := db.Open(filepath.Join(dir, "db.sqlite"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+
+	out := filepath.Join(dir, "digest.md")
+	if _, err := digest.Run(dir, store, config.DigestConfig{File: out}, nil, false); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Fatalf("expected digest file: %v", err)
+	}
+
+	st, err := digest.LoadState(filepath.Join(dir, digest.StateFileName))
+	if err != nil || st == nil {
+		t.Fatalf("expected saved state, got %v, %v", st, err)
+	}
+}
+
+func TestSendRequiresTarget(t *testing.T) {
+	if err := digest.Send(config.DigestConfig{}, &digest.Digest{}); err == nil {
+		t.Fatalf("expected error without targets")
+	}
+}
+
+func TestSendOwners(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)
+	tandas := []*db.Tanda{
+		{ID: "td-cart", Title: "Cart", Status: "flaky", Owners: []string{"@org/checkout"}, UpdatedAt: now.Format(time.RFC3339)},
+		{ID: "td-login", Title: "Login", Status: "flaky", Owners: []string{"@org/auth"}, UpdatedAt: now.Format(time.RFC3339)},
+	}
+	out := filepath.Join(dir, "checkout.md")
+	cfg := config.DigestConfig{Owners: map[string]config.DigestTarget{"@org/checkout": {File: out}}}
+
+	if err := digest.Send(cfg, &digest.Digest{}); err != nil {
+		t.Fatalf("owner targets should be enough: %v", err)
+	}
+	if err := digest.SendOwners(cfg, tandas, nil, nil, now); err != nil {
+		t.Fatalf("send owners: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("expected owner digest: %v", err)
+	}
+	md := string(data)
+	if !strings.Contains(md, "digest for @org/checkout") || !strings.Contains(md, "td-cart") || strings.Contains(md, "td-login") {
+		t.Fatalf("unexpected owner digest:\n%s", md)
+	}
+
+	cfg.Owners["@org/auth"] = config.DigestTarget{}
+	if err := digest.SendOwners(cfg, tandas, nil, nil, now); err == nil {
+		t.Fatal("expected error for an owner without a target")
+	}
+}
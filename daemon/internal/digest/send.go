@@ -0,0 +1,178 @@
+package digest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// Period returns the digest period length for config
+func Period(cfg config.DigestConfig) time.Duration {
+	if cfg.Period == "daily" {
+		return 24 * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// Run builds a digest from the store, delivers it to every configured
+// target, sends each configured owner theirs and records the new baseline.
+// With dryRun nothing is delivered or recorded.
+func Run(dir string, store *db.Store, cfg config.DigestConfig, statuses *workflow.Workflow, dryRun bool) (*Digest, error) {
+	statePath := filepath.Join(dir, StateFileName)
+	prev, err := LoadState(statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tandas: %w", err)
+	}
+
+	now := time.Now().UTC()
+	d := Build(tandas, statuses, prev, Period(cfg), now)
+	if dryRun {
+		return d, nil
+	}
+
+	if err := Send(cfg, d); err != nil {
+		return d, err
+	}
+	if err := SendOwners(cfg, tandas, statuses, prev, now); err != nil {
+		return d, err
+	}
+	return d, Snapshot(tandas, statuses, now).Save(statePath)
+}
+
+// Send delivers the digest to the configured file, webhook and SMTP
+// targets, failing if neither they nor any owner target is configured
+func Send(cfg config.DigestConfig, d *Digest) error {
+	sent, err := deliver(d, cfg.File, cfg.WebhookURL, cfg.SMTP)
+	if err != nil {
+		return err
+	}
+	if !sent && len(cfg.Owners) == 0 {
+		return fmt.Errorf("no digest target configured (set digest.file, digest.webhook_url, digest.smtp or digest.owners)")
+	}
+	return nil
+}
+
+// SendOwners builds and delivers a digest of each configured owner's
+// tandas. Every owner is tried; the first failure is returned.
+func SendOwners(cfg config.DigestConfig, tandas []*db.Tanda, statuses *workflow.Workflow, prev *State, now time.Time) error {
+	owners := make([]string, 0, len(cfg.Owners))
+	for o := range cfg.Owners {
+		owners = append(owners, o)
+	}
+	sort.Strings(owners)
+
+	var first error
+	for _, o := range owners {
+		target := cfg.Owners[o]
+		d := Build(OwnedBy(tandas, o), statuses, prev, Period(cfg), now)
+		d.Owner = o
+		smtpCfg := cfg.SMTP
+		smtpCfg.To = target.To
+		if len(target.To) == 0 {
+			smtpCfg.Host = ""
+		}
+		sent, err := deliver(d, target.File, target.WebhookURL, smtpCfg)
+		if err == nil && !sent {
+			err = fmt.Errorf("no target configured")
+		}
+		if err != nil && first == nil {
+			first = fmt.Errorf("digest for %s: %w", o, err)
+		}
+	}
+	return first
+}
+
+// deliver sends d to each target that is set and reports whether there
+// was any
+func deliver(d *Digest, file, webhookURL string, smtpCfg config.SMTPConfig) (bool, error) {
+	sent := false
+
+	if file != "" {
+		format := "markdown"
+		if ext := strings.ToLower(filepath.Ext(file)); ext == ".html" || ext == ".htm" {
+			format = "html"
+		}
+		out, err := d.Render(format)
+		if err != nil {
+			return sent, err
+		}
+		if err := os.WriteFile(file, []byte(out), 0o644); err != nil {
+			return sent, fmt.Errorf("failed to write digest: %w", err)
+		}
+		sent = true
+	}
+
+	if webhookURL != "" {
+		if err := postWebhook(webhookURL, d); err != nil {
+			return sent, fmt.Errorf("failed to post digest: %w", err)
+		}
+		sent = true
+	}
+
+	if smtpCfg.Host != "" {
+		if err := sendMail(smtpCfg, d); err != nil {
+			return sent, fmt.Errorf("failed to email digest: %w", err)
+		}
+		sent = true
+	}
+	return sent, nil
+}
+
+func postWebhook(url string, d *Digest) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"text":   d.Markdown(),
+		"digest": d,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func sendMail(cfg config.SMTPConfig, d *Digest) error {
+	if cfg.From == "" || len(cfg.To) == 0 {
+		return fmt.Errorf("digest.smtp.from and digest.smtp.to are required")
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", d.Subject())
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(d.Markdown(), "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	return smtp.SendMail(addr, auth, cfg.From, cfg.To, []byte(msg.String()))
+}
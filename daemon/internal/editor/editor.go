@@ -0,0 +1,169 @@
+// Package editor answers the questions editor extensions ask about one
+// file as a user reads it: which tandas cover it, or the lines in view,
+// how healthy they are, and where to badge the tests it defines
+package editor
+
+import (
+	"sort"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// How a tanda relates to the file
+const (
+	// MatchFile is a tanda whose own test file it is
+	MatchFile = "file"
+	// MatchCovers is a tanda whose covers name the file
+	MatchCovers = "covers"
+)
+
+// Badges a lens shows
+const (
+	BadgePass  = "pass"
+	BadgeFail  = "fail"
+	BadgeFlaky = "flaky"
+	BadgeSkip  = "skip"
+	// BadgeNone is a test that has never run
+	BadgeNone = "none"
+)
+
+// Health is how a tanda's latest runs went
+type Health struct {
+	// LastResult is the latest pass, fail or skip, at LastRun
+	LastResult string `json:"last_result,omitempty"`
+	LastRun    string `json:"last_run,omitempty"`
+	// LastFailure is the message of the latest failing run, at LastFailed
+	LastFailure string `json:"last_failure,omitempty"`
+	LastFailed  string `json:"last_failed,omitempty"`
+}
+
+// Entry is a tanda covering the file, with what a hover needs
+type Entry struct {
+	ID        string  `json:"id"`
+	Title     string  `json:"title"`
+	Status    string  `json:"status"`
+	File      string  `json:"file,omitempty"`
+	Match     string  `json:"match"`
+	Flakiness float64 `json:"flakiness"`
+	// Lines are the lines the tanda's tests executed in the file, when
+	// coverage data recorded them
+	Lines []db.LineRange `json:"lines,omitempty"`
+	Health
+}
+
+// Lens is the decoration above a test function the file defines
+type Lens struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Symbol string `json:"symbol,omitempty"`
+	// Line is where the test function is defined, counted from 1
+	Line      int     `json:"line"`
+	Badge     string  `json:"badge"`
+	Status    string  `json:"status"`
+	Flakiness float64 `json:"flakiness"`
+	Health
+}
+
+// ForFile describes the tandas for path, which should be the ones whose
+// file is path or whose covers name it. With lines, a tanda covering the
+// file is kept only when it executed one of them, or when no line data
+// was recorded for it; its own test file always matches. Entries are
+// ordered failing first, then by flakiness.
+func ForFile(tandas []*db.Tanda, path string, lines []db.LineRange) []Entry {
+	entries := []Entry{}
+	for _, t := range tandas {
+		e := Entry{ID: t.ID, Title: t.Title, Status: t.Status, File: t.File, Match: MatchCovers, Flakiness: t.Flakiness()}
+		covered, known := t.CoveredLines(path)
+		switch {
+		case t.File == path:
+			e.Match = MatchFile
+		case !covers(t, path):
+			continue
+		case known && len(lines) > 0 && !overlaps(covered, lines):
+			continue
+		}
+		e.Lines = covered
+		e.Health = health(t)
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if (a.LastResult == "fail") != (b.LastResult == "fail") {
+			return a.LastResult == "fail"
+		}
+		if a.Flakiness != b.Flakiness {
+			return a.Flakiness > b.Flakiness
+		}
+		return a.ID < b.ID
+	})
+	return entries
+}
+
+// CodeLens returns the lenses for the tandas whose file is path and that
+// record a line, in line order. A flaky tanda is badged flaky whatever its
+// latest result; others show their latest result, or none before any run.
+func CodeLens(tandas []*db.Tanda, path string) []Lens {
+	lenses := []Lens{}
+	for _, t := range tandas {
+		if t.File != path || t.Line < 1 {
+			continue
+		}
+		l := Lens{ID: t.ID, Title: t.Title, Symbol: t.Symbol, Line: t.Line, Status: t.Status, Flakiness: t.Flakiness(), Health: health(t)}
+		switch {
+		case t.Status == "flaky":
+			l.Badge = BadgeFlaky
+		case l.LastResult == "":
+			l.Badge = BadgeNone
+		default:
+			l.Badge = l.LastResult
+		}
+		lenses = append(lenses, l)
+	}
+	sort.SliceStable(lenses, func(i, j int) bool {
+		if lenses[i].Line != lenses[j].Line {
+			return lenses[i].Line < lenses[j].Line
+		}
+		return lenses[i].ID < lenses[j].ID
+	})
+	return lenses
+}
+
+// health reads the latest result and failure from the run history,
+// skipping summaries left by pruning
+func health(t *db.Tanda) Health {
+	var h Health
+	for i := len(t.RunHistory) - 1; i >= 0; i-- {
+		r := t.RunHistory[i]
+		if r.Summary != nil {
+			continue
+		}
+		if h.LastResult == "" {
+			h.LastResult, h.LastRun = r.Result, r.Timestamp
+		}
+		if r.Result == "fail" {
+			h.LastFailure, h.LastFailed = r.Error, r.Timestamp
+			break
+		}
+	}
+	return h
+}
+
+func covers(t *db.Tanda, path string) bool {
+	for _, c := range t.Covers {
+		if c == path {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(a, b []db.LineRange) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Overlaps(y) {
+				return true
+			}
+		}
+	}
+	return false
+}
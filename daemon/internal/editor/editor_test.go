@@ -0,0 +1,99 @@
+package editor_test
+
+import (
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/editor"
+)
+
+func TestForFile(t *testing.T) {
+	tandas := []*db.Tanda{
+		{ID: "td-spec", Title: "Login spec", Status: "active", File: "src/auth.ts"},
+		{ID: "td-early", Title: "Session", Status: "active", Covers: []string{"src/auth.ts"},
+			CoverLines: map[string]string{"src/auth.ts": "1-20"},
+			RunHistory: []db.RunResult{{Timestamp: "2025-06-01T10:00:00Z", Result: "pass"}}},
+		{ID: "td-late", Title: "Logout", Status: "flaky", Covers: []string{"src/auth.ts", "src/cart.ts"},
+			CoverLines: map[string]string{"src/auth.ts": "40-60"},
+			RunHistory: []db.RunResult{
+				{Timestamp: "2025-06-01T10:00:00Z", Result: "fail", Error: "timeout"},
+				{Timestamp: "2025-06-02T10:00:00Z", Result: "pass"},
+				{Timestamp: "2025-06-03T10:00:00Z", Result: "fail", Error: "expected 200, got 500"},
+			}},
+		// Covered without line data
+		{ID: "td-any", Title: "Smoke", Status: "active", Covers: []string{"src/auth.ts"},
+			RunHistory: []db.RunResult{{Timestamp: "2025-06-01T10:00:00Z", Result: "fail", Error: "boom"},
+				{Timestamp: "2025-06-02T10:00:00Z", Result: "pass"}}},
+		{ID: "td-other", Title: "Cart", Status: "active", Covers: []string{"src/cart.ts"}},
+	}
+
+	all := editor.ForFile(tandas, "src/auth.ts", nil)
+	want := []string{"td-late", "td-any", "td-early", "td-spec"}
+	if len(all) != len(want) {
+		t.Fatalf("entries = %+v, want %v", all, want)
+	}
+	for i, id := range want {
+		if all[i].ID != id {
+			t.Errorf("entry %d = %s, want %s", i, all[i].ID, id)
+		}
+	}
+	late := all[0]
+	if late.LastResult != "fail" || late.LastFailure != "expected 200, got 500" || late.LastFailed != "2025-06-03T10:00:00Z" {
+		t.Errorf("td-late = %+v", late)
+	}
+	if len(late.Lines) != 1 || late.Lines[0] != (db.LineRange{Start: 40, End: 60}) || late.Match != editor.MatchCovers {
+		t.Errorf("td-late lines = %v, match %s", late.Lines, late.Match)
+	}
+	if any := all[1]; any.LastResult != "pass" || any.LastFailure != "boom" {
+		t.Errorf("td-any = %+v", any)
+	}
+	if all[3].Match != editor.MatchFile {
+		t.Errorf("td-spec match = %s", all[3].Match)
+	}
+
+	// Lines in view keep the tandas that ran them, those without line
+	// data and the file's own
+	viewed := editor.ForFile(tandas, "src/auth.ts", []db.LineRange{{Start: 15, End: 30}})
+	var ids []string
+	for _, e := range viewed {
+		ids = append(ids, e.ID)
+	}
+	if got := len(ids); got != 3 || ids[0] != "td-any" || ids[1] != "td-early" || ids[2] != "td-spec" {
+		t.Errorf("entries for lines 15-30 = %v", ids)
+	}
+}
+
+func TestCodeLens(t *testing.T) {
+	tandas := []*db.Tanda{
+		{ID: "td-logout", Title: "Logout", Status: "active", File: "tests/auth_test.go", Symbol: "TestLogout", Line: 40,
+			RunHistory: []db.RunResult{{Timestamp: "2025-06-01T10:00:00Z", Result: "fail", Error: "timeout"}}},
+		{ID: "td-login", Title: "Login", Status: "flaky", File: "tests/auth_test.go", Symbol: "TestLogin", Line: 12,
+			RunHistory: []db.RunResult{{Timestamp: "2025-06-01T10:00:00Z", Result: "pass"}}},
+		{ID: "td-new", Title: "Refresh", Status: "active", File: "tests/auth_test.go", Symbol: "TestRefresh", Line: 80},
+		// No position to decorate
+		{ID: "td-nowhere", Title: "Session", Status: "active", File: "tests/auth_test.go"},
+		{ID: "td-cart", Title: "Cart", Status: "active", File: "tests/cart_test.go", Line: 5},
+	}
+
+	lenses := editor.CodeLens(tandas, "tests/auth_test.go")
+	want := []struct {
+		id    string
+		line  int
+		badge string
+	}{
+		{"td-login", 12, editor.BadgeFlaky},
+		{"td-logout", 40, editor.BadgeFail},
+		{"td-new", 80, editor.BadgeNone},
+	}
+	if len(lenses) != len(want) {
+		t.Fatalf("lenses = %+v", lenses)
+	}
+	for i, w := range want {
+		if l := lenses[i]; l.ID != w.id || l.Line != w.line || l.Badge != w.badge {
+			t.Errorf("lens %d = %s line %d %s, want %s line %d %s", i, l.ID, l.Line, l.Badge, w.id, w.line, w.badge)
+		}
+	}
+	if l := lenses[1]; l.Symbol != "TestLogout" || l.LastFailure != "timeout" {
+		t.Errorf("td-logout lens = %+v", l)
+	}
+}
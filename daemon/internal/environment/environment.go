@@ -0,0 +1,340 @@
+// Package environment records the environment a run happened in and finds
+// tandas that fail disproportionately in one runner, OS, browser or shard,
+// telling environment-specific flakes apart from genuine test bugs
+package environment
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// Keys of a run's environment
+const (
+	Runner  = "runner"
+	OS      = "os"
+	Browser = "browser"
+	Shard   = "shard"
+)
+
+// Keys are compared in this order
+var Keys = []string{Runner, OS, Browser, Shard}
+
+// Verdicts on a failing tanda
+const (
+	// Environmental failures concentrate in one environment, pointing at
+	// the infrastructure rather than the test
+	Environmental = "environment"
+	// Test failures happen alike in every environment the tanda ran in,
+	// pointing at the test or the code under test
+	Test = "test"
+	// Unknown means the tanda has not run in enough environments to tell
+	Unknown = "unknown"
+)
+
+// DefaultMinRuns is how many runs an environment needs, on each side of a
+// comparison, before its failure rate counts
+const DefaultMinRuns = 3
+
+// An environment stands out when its failure rate is at least ratio times
+// the rate elsewhere and minGap above it
+const (
+	ratio  = 3.0
+	minGap = 0.25
+)
+
+// Value returns the run's value for key
+func Value(r db.RunResult, key string) string {
+	switch key {
+	case Runner:
+		return r.Runner
+	case OS:
+		return r.OS
+	case Browser:
+		return r.Browser
+	case Shard:
+		return r.Shard
+	}
+	return ""
+}
+
+// Stamp fills the run's empty environment fields from TD_RUNNER, TD_OS,
+// TD_BROWSER and TD_SHARD, then from what GitLab CI and GitHub Actions
+// set. The OS falls back to the one td-daemon runs on. An empty batch
+// comes from TD_BATCH or the CI pipeline or workflow run ID, and an empty
+// commit from TD_COMMIT or the SHA CI is building.
+func Stamp(r *db.RunResult, getenv func(string) string) {
+	first := func(names ...string) string {
+		for _, name := range names {
+			if v := getenv(name); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	if r.Runner == "" {
+		r.Runner = first("TD_RUNNER", "CI_RUNNER_DESCRIPTION", "RUNNER_NAME")
+	}
+	if r.OS == "" {
+		r.OS = first("TD_OS", "RUNNER_OS")
+	}
+	if r.OS == "" {
+		r.OS = runtime.GOOS
+	}
+	if r.Browser == "" {
+		r.Browser = getenv("TD_BROWSER")
+	}
+	if r.Batch == "" {
+		r.Batch = first("TD_BATCH", "CI_PIPELINE_ID", "GITHUB_RUN_ID")
+	}
+	if r.Commit == "" {
+		r.Commit = first("TD_COMMIT", "CI_COMMIT_SHA", "GITHUB_SHA")
+	}
+	if r.Shard == "" {
+		r.Shard = getenv("TD_SHARD")
+		if index, total := getenv("CI_NODE_INDEX"), getenv("CI_NODE_TOTAL"); r.Shard == "" && index != "" && total != "" {
+			r.Shard = index + "/" + total
+		}
+	}
+}
+
+// Options bound the runs compared
+type Options struct {
+	workflow.Filter
+	// MinRuns is DefaultMinRuns when zero
+	MinRuns int `json:"min_runs,omitempty"`
+}
+
+// Stat compares the runs in one environment with the runs that name
+// another value for the same key
+type Stat struct {
+	Key         string  `json:"key"`
+	Value       string  `json:"value"`
+	Runs        int     `json:"runs"`
+	Failures    int     `json:"failures"`
+	FailureRate float64 `json:"failure_rate"`
+	OtherRuns   int     `json:"other_runs"`
+	OtherRate   float64 `json:"other_rate"`
+	// Tandas counts the tandas that failed in the environment, in
+	// Report.Environments
+	Tandas int `json:"tandas,omitempty"`
+}
+
+// String renders the stat as "browser=webkit 80% (4/5) vs 0% elsewhere"
+func (s Stat) String() string {
+	return fmt.Sprintf("%s=%s %.0f%% (%d/%d) vs %.0f%% elsewhere",
+		s.Key, s.Value, s.FailureRate*100, s.Failures, s.Runs, s.OtherRate*100)
+}
+
+// Finding is the verdict on a tanda that failed
+type Finding struct {
+	TandaID     string  `json:"tanda_id"`
+	Title       string  `json:"title"`
+	Runs        int     `json:"runs"`
+	Failures    int     `json:"failures"`
+	FailureRate float64 `json:"failure_rate"`
+	Verdict     string  `json:"verdict"`
+	// Environment is where the failures concentrate, for Environmental
+	Environment *Stat `json:"environment,omitempty"`
+	// FailingIn lists the environments, as key=value, the tanda failed in
+	FailingIn []string `json:"failing_in"`
+}
+
+// Report lists the environments failing more than the rest across all
+// tandas, such as a broken runner, and a verdict for each failing tanda
+type Report struct {
+	Environments []Stat    `json:"environments"`
+	Tandas       []Finding `json:"tandas"`
+}
+
+// Analyze compares failure rates between environments. Runs without
+// environment metadata are left out, as are deprecated and archived
+// tandas.
+func Analyze(tandas []*db.Tanda, opts Options, now time.Time) *Report {
+	if opts.MinRuns <= 0 {
+		opts.MinRuns = DefaultMinRuns
+	}
+	since := db.RunsSince(opts.Days, now)
+
+	report := &Report{Environments: []Stat{}, Tandas: []Finding{}}
+	all := newTally()
+	failedIn := make(map[env]map[string]bool)
+	for _, t := range tandas {
+		if opts.Statuses.IsRetired(t.Status) {
+			continue
+		}
+		mine := newTally()
+		for _, r := range t.RunHistory {
+			if r.Result != "pass" && r.Result != "fail" {
+				continue
+			}
+			if !db.InWindow(r, since) {
+				continue
+			}
+			if mine.add(r) {
+				all.add(r)
+			}
+		}
+		if mine.failures == 0 {
+			continue
+		}
+
+		f := Finding{TandaID: t.ID, Title: t.Title, Runs: mine.runs, Failures: mine.failures,
+			FailureRate: rate(mine.failures, mine.runs), Verdict: Unknown, FailingIn: []string{}}
+		// The failures are spread when they happen in two environments
+		// with enough runs to compare
+		spread := false
+		for _, key := range Keys {
+			failing := 0
+			for _, e := range mine.values(key) {
+				c := mine.counts[e]
+				if c.failures == 0 {
+					continue
+				}
+				f.FailingIn = append(f.FailingIn, e.key+"="+e.value)
+				if failedIn[e] == nil {
+					failedIn[e] = make(map[string]bool)
+				}
+				failedIn[e][t.ID] = true
+				if c.runs >= opts.MinRuns {
+					failing++
+				}
+			}
+			if failing > 1 {
+				spread = true
+			}
+		}
+		if s := mine.worst(opts.MinRuns); s != nil {
+			f.Verdict, f.Environment = Environmental, s
+		} else if spread {
+			f.Verdict = Test
+		}
+		report.Tandas = append(report.Tandas, f)
+	}
+
+	for _, key := range Keys {
+		for _, e := range all.values(key) {
+			if s := all.stat(e); standsOut(s, opts.MinRuns) {
+				s.Tandas = len(failedIn[e])
+				report.Environments = append(report.Environments, s)
+			}
+		}
+	}
+	sort.SliceStable(report.Environments, func(i, j int) bool {
+		return gap(report.Environments[i]) > gap(report.Environments[j])
+	})
+	order := map[string]int{Environmental: 0, Test: 1, Unknown: 2}
+	sort.SliceStable(report.Tandas, func(i, j int) bool {
+		a, b := report.Tandas[i], report.Tandas[j]
+		if order[a.Verdict] != order[b.Verdict] {
+			return order[a.Verdict] < order[b.Verdict]
+		}
+		if a.FailureRate != b.FailureRate {
+			return a.FailureRate > b.FailureRate
+		}
+		return a.TandaID < b.TandaID
+	})
+	return report
+}
+
+// env is one value of one key
+type env struct{ key, value string }
+
+type count struct{ runs, failures int }
+
+// tally counts runs and failures overall and per environment
+type tally struct {
+	runs, failures int
+	counts         map[env]*count
+	byKey          map[string][]env
+}
+
+func newTally() *tally {
+	return &tally{counts: make(map[env]*count), byKey: make(map[string][]env)}
+}
+
+// add counts a run that names at least one environment, and reports
+// whether it did
+func (t *tally) add(r db.RunResult) bool {
+	failed := r.Result == "fail"
+	named := false
+	for _, key := range Keys {
+		v := Value(r, key)
+		if v == "" {
+			continue
+		}
+		named = true
+		e := env{key, v}
+		c := t.counts[e]
+		if c == nil {
+			c = &count{}
+			t.counts[e] = c
+			t.byKey[key] = append(t.byKey[key], e)
+		}
+		c.runs++
+		if failed {
+			c.failures++
+		}
+	}
+	if named {
+		t.runs++
+		if failed {
+			t.failures++
+		}
+	}
+	return named
+}
+
+// values returns the environments seen for key, sorted by value
+func (t *tally) values(key string) []env {
+	es := t.byKey[key]
+	sort.Slice(es, func(i, j int) bool { return es[i].value < es[j].value })
+	return es
+}
+
+// stat compares e with the other values of its key
+func (t *tally) stat(e env) Stat {
+	c := t.counts[e]
+	var other count
+	for _, o := range t.byKey[e.key] {
+		if o != e {
+			other.runs += t.counts[o].runs
+			other.failures += t.counts[o].failures
+		}
+	}
+	return Stat{Key: e.key, Value: e.value, Runs: c.runs, Failures: c.failures,
+		FailureRate: rate(c.failures, c.runs), OtherRuns: other.runs, OtherRate: rate(other.failures, other.runs)}
+}
+
+// worst returns the environment standing out the most, or nil
+func (t *tally) worst(minRuns int) *Stat {
+	var best *Stat
+	for _, key := range Keys {
+		for _, e := range t.values(key) {
+			if s := t.stat(e); standsOut(s, minRuns) && (best == nil || gap(s) > gap(*best)) {
+				best = &s
+			}
+		}
+	}
+	return best
+}
+
+func standsOut(s Stat, minRuns int) bool {
+	return s.Runs >= minRuns && s.OtherRuns >= minRuns &&
+		s.FailureRate >= ratio*s.OtherRate && gap(s) >= minGap
+}
+
+func gap(s Stat) float64 {
+	return s.FailureRate - s.OtherRate
+}
+
+func rate(failures, runs int) float64 {
+	if runs == 0 {
+		return 0
+	}
+	return float64(failures) / float64(runs)
+}
@@ -0,0 +1,89 @@
+package environment_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/environment"
+)
+
+// runs builds one run per result, alternating browsers chromium and webkit
+// on runners ci-1 and ci-2
+func runs(results string) []db.RunResult {
+	var out []db.RunResult
+	for i, r := range strings.Split(results, ",") {
+		browser, runner := "chromium", "ci-1"
+		if i%2 == 1 {
+			browser = "webkit"
+		}
+		if i%4 >= 2 {
+			runner = "ci-2"
+		}
+		out = append(out, db.RunResult{Timestamp: "2025-06-01T10:00:00Z", Result: r, Browser: browser, Runner: runner, OS: "linux"})
+	}
+	return out
+}
+
+func TestAnalyze(t *testing.T) {
+	tandas := []*db.Tanda{
+		// Fails only on webkit
+		{ID: "td-webkit", Title: "Upload", Status: "flaky", RunHistory: runs("pass,fail,pass,fail,pass,fail,pass,fail")},
+		// Fails everywhere
+		{ID: "td-bug", Title: "Cart", Status: "active", RunHistory: runs("fail,fail,pass,fail,fail,pass,fail,fail")},
+		// Ran on one browser and runner only
+		{ID: "td-once", Title: "Search", Status: "active", RunHistory: []db.RunResult{{Timestamp: "2025-06-01T10:00:00Z", Result: "fail", OS: "linux"}}},
+		{ID: "td-green", Title: "Login", Status: "active", RunHistory: runs("pass,pass,pass,pass,pass,pass")},
+		// Runs without environment metadata are left out
+		{ID: "td-bare", Title: "Old", Status: "active", RunHistory: []db.RunResult{{Timestamp: "2025-06-01T10:00:00Z", Result: "fail"}}},
+	}
+	r := environment.Analyze(tandas, environment.Options{}, time.Now())
+
+	if len(r.Tandas) != 3 {
+		t.Fatalf("expected 3 failing tandas, got %+v", r.Tandas)
+	}
+	webkit := r.Tandas[0]
+	if webkit.TandaID != "td-webkit" || webkit.Verdict != environment.Environmental || webkit.Environment == nil ||
+		webkit.Environment.Key != environment.Browser || webkit.Environment.Value != "webkit" || webkit.Environment.FailureRate != 1 {
+		t.Fatalf("expected td-webkit blamed on webkit, got %+v", webkit)
+	}
+	if got := webkit.Environment.String(); got != "browser=webkit 100% (4/4) vs 0% elsewhere" {
+		t.Errorf("stat = %s", got)
+	}
+	if bug := r.Tandas[1]; bug.TandaID != "td-bug" || bug.Verdict != environment.Test || bug.Environment != nil {
+		t.Fatalf("expected td-bug to be a test bug, got %+v", bug)
+	}
+	if once := r.Tandas[2]; once.TandaID != "td-once" || once.Verdict != environment.Unknown {
+		t.Fatalf("expected td-once unknown, got %+v", once)
+	}
+
+	// Across all tandas webkit fails 7 of 11 runs against 3 of 11 elsewhere,
+	// not enough to stand out
+	if len(r.Environments) != 0 {
+		t.Fatalf("expected no environment to stand out, got %+v", r.Environments)
+	}
+	r = environment.Analyze(tandas[:1], environment.Options{}, time.Now())
+	if len(r.Environments) != 1 || r.Environments[0].Value != "webkit" || r.Environments[0].Tandas != 1 {
+		t.Fatalf("expected webkit to stand out, got %+v", r.Environments)
+	}
+	r = environment.Analyze(tandas[:1], environment.Options{MinRuns: 5}, time.Now())
+	if r.Tandas[0].Verdict != environment.Unknown {
+		t.Fatalf("expected too few runs to leave td-webkit unknown, got %+v", r.Tandas[0])
+	}
+}
+
+func TestStamp(t *testing.T) {
+	env := map[string]string{"CI_RUNNER_DESCRIPTION": "gitlab-7", "TD_BROWSER": "firefox", "CI_NODE_INDEX": "2", "CI_NODE_TOTAL": "4", "TD_OS": "macos",
+		"CI_PIPELINE_ID": "9120", "GITHUB_SHA": "4f2c1e0"}
+	run := db.RunResult{Result: "pass", Runner: "mine"}
+	environment.Stamp(&run, func(k string) string { return env[k] })
+	if run.Runner != "mine" || run.OS != "macos" || run.Browser != "firefox" || run.Shard != "2/4" || run.Batch != "9120" || run.Commit != "4f2c1e0" {
+		t.Fatalf("unexpected stamp %+v", run)
+	}
+	run = db.RunResult{}
+	environment.Stamp(&run, func(string) string { return "" })
+	if run.OS == "" || run.Runner != "" {
+		t.Fatalf("expected only the OS to default, got %+v", run)
+	}
+}
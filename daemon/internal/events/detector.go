@@ -0,0 +1,70 @@
+package events
+
+import (
+	"github.com/tandas/daemon/internal/db"
+)
+
+// Detector derives events by diffing successive registry snapshots
+type Detector struct {
+	seeded   bool
+	statuses map[string]string
+	passRate float64
+}
+
+// NewDetector creates a detector; the first snapshot only sets a baseline
+func NewDetector() *Detector {
+	return &Detector{statuses: make(map[string]string)}
+}
+
+// Observe compares a snapshot against the previous one and returns the
+// resulting quarantine and pass-rate events
+func (d *Detector) Observe(tandas []*db.Tanda) []Event {
+	var out []Event
+	statuses := make(map[string]string, len(tandas))
+	rate := PassRate(tandas)
+
+	for _, t := range tandas {
+		statuses[t.ID] = t.Status
+		if !d.seeded {
+			continue
+		}
+
+		was, now := db.IsQuarantined(d.statuses[t.ID]), db.IsQuarantined(t.Status)
+		data := map[string]interface{}{"title": t.Title, "status": t.Status, "owners": t.Owners}
+		switch {
+		case now && !was:
+			out = append(out, Event{Type: Quarantined, TandaID: t.ID, Data: data})
+		case was && !now:
+			out = append(out, Event{Type: Unquarantined, TandaID: t.ID, Data: data})
+		}
+	}
+
+	if d.seeded && rate != d.passRate {
+		out = append(out, Event{Type: PassRateChanged, Data: map[string]interface{}{
+			"previous": d.passRate,
+			"current":  rate,
+		}})
+	}
+
+	d.seeded = true
+	d.statuses = statuses
+	d.passRate = rate
+	return out
+}
+
+// PassRate is the share of tandas with runs whose latest run passed
+func PassRate(tandas []*db.Tanda) float64 {
+	ran, passed := 0, 0
+	for _, t := range tandas {
+		if n := len(t.RunHistory); n > 0 {
+			ran++
+			if t.RunHistory[n-1].Result == "pass" {
+				passed++
+			}
+		}
+	}
+	if ran == 0 {
+		return 1
+	}
+	return float64(passed) / float64(ran)
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published by the daemon
+const (
+	Quarantined     = "quarantined"
+	Unquarantined   = "unquarantined"
+	PassRateChanged = "pass_rate_changed"
+	ImportErrors    = "import_errors"
+	SLOBreached     = "slo_breached"
+	SLORecovered    = "slo_recovered"
+	// DurationAnomaly is a run much slower than the tanda's baseline
+	DurationAnomaly = "duration_anomaly"
+)
+
+// Activity types are recorded for td-daemon tail but not published on the
+// bus, so notifiers and webhooks do not fire on every sync
+const (
+	Synced      = "synced"
+	RunRecorded = "run_recorded"
+	Progress    = "progress"
+)
+
+// Event is a notable change in the registry
+type Event struct {
+	Type    string                 `json:"type"`
+	Time    time.Time              `json:"ts"`
+	TandaID string                 `json:"tanda_id,omitempty"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// Owners returns the owners attached to a tanda event, if any
+func (e Event) Owners() []string {
+	owners, _ := e.Data["owners"].([]string)
+	return owners
+}
+
+// MatchesOwners reports whether an event passes an owner filter. Events
+// not tied to a tanda, and empty filters, always match.
+func (e Event) MatchesOwners(filter []string) bool {
+	if len(filter) == 0 || e.TandaID == "" {
+		return true
+	}
+	for _, want := range filter {
+		for _, o := range e.Owners() {
+			if o == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Bus fans events out to subscribers. Handlers run synchronously on the
+// publishing goroutine, so slow handlers must queue work themselves.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []func(Event)
+}
+
+// NewBus creates an empty event bus
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers a handler for all events
+func (b *Bus) Subscribe(handler func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish delivers an event to every handler
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		h(e)
+	}
+}
@@ -0,0 +1,67 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/events"
+)
+
+func TestDetectorQuarantineAndPassRate(t *testing.T) {
+	d := events.NewDetector()
+
+	login := &db.Tanda{ID: "td-1", Title: "Login", Status: "active",
+		RunHistory: []db.RunResult{{Result: "pass"}}}
+	cart := &db.Tanda{ID: "td-2", Title: "Cart", Status: "active",
+		RunHistory: []db.RunResult{{Result: "pass"}}}
+
+	if got := d.Observe([]*db.Tanda{login, cart}); len(got) != 0 {
+		t.Fatalf("expected baseline snapshot to emit nothing, got %+v", got)
+	}
+
+	cart.Status = "flaky"
+	cart.RunHistory = append(cart.RunHistory, db.RunResult{Result: "fail"})
+	got := d.Observe([]*db.Tanda{login, cart})
+	if len(got) != 2 {
+		t.Fatalf("expected quarantine and pass-rate events, got %+v", got)
+	}
+	if got[0].Type != events.Quarantined || got[0].TandaID != "td-2" {
+		t.Fatalf("unexpected first event: %+v", got[0])
+	}
+	if got[1].Type != events.PassRateChanged || got[1].Data["current"] != 0.5 {
+		t.Fatalf("unexpected pass-rate event: %+v", got[1])
+	}
+
+	cart.Status = "active"
+	got = d.Observe([]*db.Tanda{login, cart})
+	if len(got) != 1 || got[0].Type != events.Unquarantined {
+		t.Fatalf("expected unquarantine event, got %+v", got)
+	}
+}
+
+func TestBusPublish(t *testing.T) {
+	bus := events.NewBus()
+	var seen []events.Event
+	bus.Subscribe(func(e events.Event) { seen = append(seen, e) })
+
+	bus.Publish(events.Event{Type: events.ImportErrors})
+	if len(seen) != 1 || seen[0].Time.IsZero() {
+		t.Fatalf("expected one timestamped event, got %+v", seen)
+	}
+}
+
+func TestMatchesOwners(t *testing.T) {
+	owned := events.Event{Type: events.Quarantined, TandaID: "td-1",
+		Data: map[string]interface{}{"owners": []string{"@org/qa"}}}
+	global := events.Event{Type: events.PassRateChanged}
+
+	if !owned.MatchesOwners(nil) || !owned.MatchesOwners([]string{"@org/qa"}) {
+		t.Fatalf("expected owned event to match its owner and an empty filter")
+	}
+	if owned.MatchesOwners([]string{"@org/web"}) {
+		t.Fatalf("expected owned event not to match another owner")
+	}
+	if !global.MatchesOwners([]string{"@org/web"}) {
+		t.Fatalf("expected events without a tanda to pass owner filters")
+	}
+}
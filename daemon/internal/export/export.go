@@ -0,0 +1,66 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// Formats accepted by Write
+const (
+	FormatJUnit = "junit"
+	FormatCSV   = "csv"
+	FormatTSV   = "tsv"
+	// FormatJSONL writes one tanda per line, as issues.jsonl does
+	FormatJSONL = "jsonl"
+	// FormatJSON writes one indented array
+	FormatJSON = "json"
+	// FormatParquet writes two files and is handled by ParquetFiles
+	FormatParquet = "parquet"
+	// FormatMarkdown writes a catalog of pages and is handled by
+	// MarkdownFiles
+	FormatMarkdown = "markdown"
+)
+
+// Options tune the tabular formats and JUnit
+type Options struct {
+	// Columns selects and orders CSV/TSV columns; empty means DefaultColumns
+	Columns []string `json:"columns,omitempty"`
+	// Statuses decides which tandas JUnit reports as retired; nil means
+	// the default statuses
+	Statuses *workflow.Workflow `json:"-"`
+}
+
+// Write renders tandas in the given format
+func Write(w io.Writer, tandas []*db.Tanda, format string, opts Options) error {
+	switch format {
+	case FormatJUnit:
+		return JUnit(w, tandas, opts.Statuses)
+	case FormatCSV:
+		return Table(w, tandas, ',', opts.Columns)
+	case FormatTSV:
+		return Table(w, tandas, '\t', opts.Columns)
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, t := range tandas {
+			if err := enc.Encode(t); err != nil {
+				return fmt.Errorf("failed to write tanda %s: %w", t.ID, err)
+			}
+		}
+		return nil
+	case FormatJSON:
+		if tandas == nil {
+			tandas = []*db.Tanda{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(tandas)
+	case FormatParquet, FormatMarkdown:
+		return fmt.Errorf("%s export writes a directory, not a stream", format)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
@@ -0,0 +1,228 @@
+package export_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/export"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+func registry() []*db.Tanda {
+	return []*db.Tanda{
+		{ID: "td-1", Title: "Login", Status: "flaky", File: "tests/login.spec.ts", RunHistory: []db.RunResult{
+			{Timestamp: "2025-06-01T10:00:00", Result: "pass", Duration: "2s"},
+			{Timestamp: "2025-06-02T10:00:00", Result: "fail", Duration: "1.5s", Error: "timeout\nat login.spec.ts:12"},
+		}},
+		{ID: "td-2", Title: "Search", Status: "active", RunHistory: []db.RunResult{
+			{Timestamp: "2025-06-03T10:00:00", Result: "pass", Duration: "500ms"},
+		}},
+		{ID: "td-3", Title: "Export", Status: "active"},
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.Write(&buf, registry(), export.FormatJUnit, export.Options{}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	var doc struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Skipped  int `xml:"skipped,attr"`
+		Suites   []struct {
+			Cases []struct {
+				Name      string `xml:"name,attr"`
+				Classname string `xml:"classname,attr"`
+				Time      string `xml:"time,attr"`
+				Failure   *struct {
+					Message string `xml:"message,attr"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not valid XML: %v\n%s", err, buf.String())
+	}
+	if doc.Tests != 3 || doc.Failures != 1 || doc.Skipped != 1 {
+		t.Fatalf("unexpected totals: %+v", doc)
+	}
+	login := doc.Suites[0].Cases[0]
+	if login.Classname != "tests/login.spec.ts" || login.Time != "1.500" || login.Failure == nil || login.Failure.Message != "timeout" {
+		t.Fatalf("unexpected login case: %+v", login)
+	}
+
+	if err := export.Write(&buf, registry(), "yaml", export.Options{}); err == nil || !strings.Contains(err.Error(), "yaml") {
+		t.Fatalf("expected unknown format error, got %v", err)
+	}
+}
+
+func TestJUnitRetired(t *testing.T) {
+	statuses, err := workflow.New(config.StatusConfig{Extra: []string{"obsolete"}, Retired: []string{"obsolete"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	passed := []db.RunResult{{Timestamp: "2025-06-01T10:00:00", Result: "pass"}}
+	tandas := []*db.Tanda{
+		{ID: "td-1", Title: "Login", Status: "active", RunHistory: passed},
+		{ID: "td-2", Title: "Cart", Status: "archived", RunHistory: passed},
+		{ID: "td-3", Title: "Coupons", Status: "obsolete", RunHistory: passed},
+	}
+	var buf bytes.Buffer
+	if err := export.Write(&buf, tandas, export.FormatJUnit, export.Options{Statuses: statuses}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `skipped="2"`) || !strings.Contains(out, `<skipped message="archived">`) || !strings.Contains(out, `<skipped message="obsolete">`) {
+		t.Fatalf("expected the retired tandas skipped:\n%s", out)
+	}
+}
+
+func TestTable(t *testing.T) {
+	var buf bytes.Buffer
+	opts := export.Options{Columns: []string{"id", "last_result", "last_error", "flakiness"}}
+	if err := export.Write(&buf, registry(), export.FormatTSV, opts); err != nil {
+		t.Fatalf("export tsv: %v", err)
+	}
+	want := "id\tlast_result\tlast_error\tflakiness\n" +
+		"td-1\tfail\ttimeout at login.spec.ts:12\t0.50\n" +
+		"td-2\tpass\t\t0.00\n" +
+		"td-3\t\t\t0.00\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected TSV:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := export.Write(&buf, registry()[:1], export.FormatCSV, export.Options{}); err != nil {
+		t.Fatalf("export csv: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if lines[0] != strings.Join(export.DefaultColumns, ",") || !strings.HasPrefix(lines[1], "td-1,Login,flaky,tests/login.spec.ts,") {
+		t.Fatalf("unexpected CSV:\n%s", buf.String())
+	}
+
+	opts.Columns = []string{"id", "nope"}
+	if err := export.Write(&buf, registry(), export.FormatCSV, opts); err == nil {
+		t.Fatal("expected error for unknown column")
+	}
+}
+
+func TestParquetFiles(t *testing.T) {
+	paths, err := export.ParquetFiles(t.TempDir(), registry())
+	if err != nil {
+		t.Fatalf("export parquet: %v", err)
+	}
+
+	tandas, err := parquet.ReadFile[export.TandaRow](paths[0])
+	if err != nil {
+		t.Fatalf("read tandas: %v", err)
+	}
+	if len(tandas) != 3 || tandas[0].ID != "td-1" || tandas[0].Runs != 2 || tandas[0].Flakiness != 0.5 {
+		t.Fatalf("unexpected tandas rows: %+v", tandas)
+	}
+
+	runs, err := parquet.ReadFile[export.RunRow](paths[1])
+	if err != nil {
+		t.Fatalf("read runs: %v", err)
+	}
+	if len(runs) != 3 {
+		t.Fatalf("expected 3 runs, got %d", len(runs))
+	}
+	if runs[1].TandaID != "td-1" || runs[1].Result != "fail" || runs[1].DurationMs == nil || *runs[1].DurationMs != 1500 {
+		t.Fatalf("unexpected run row: %+v", runs[1])
+	}
+	if runs[1].Timestamp.Format("2006-01-02") != "2025-06-02" {
+		t.Fatalf("unexpected run timestamp: %v", runs[1].Timestamp)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.Write(&buf, registry(), export.FormatJSONL, export.Options{}); err != nil {
+		t.Fatalf("export jsonl: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected one line per tanda, got %d", len(lines))
+	}
+	var first db.Tanda
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.ID != "td-1" || len(first.RunHistory) != 2 {
+		t.Fatalf("unexpected first line %q: %v", lines[0], err)
+	}
+
+	buf.Reset()
+	if err := export.Write(&buf, registry(), export.FormatJSON, export.Options{}); err != nil {
+		t.Fatalf("export json: %v", err)
+	}
+	var all []db.Tanda
+	if err := json.Unmarshal(buf.Bytes(), &all); err != nil || len(all) != 3 {
+		t.Fatalf("expected a JSON array of 3 tandas, got %d: %v", len(all), err)
+	}
+
+	buf.Reset()
+	export.Write(&buf, nil, export.FormatJSON, export.Options{})
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("expected an empty array, got %q", buf.String())
+	}
+}
+
+func TestMarkdownFiles(t *testing.T) {
+	tandas := registry()
+	tandas[1].File = "tests/e2e/search.spec.ts"
+	tandas[1].DependsOn = []string{"td-1", "td-gone"}
+	tandas[1].Refs = []db.Ref{{Type: "pr", ID: "#42", URL: "https://github.com/o/r/pull/42"}}
+	tandas[1].Title = "Search | filters"
+
+	dir := t.TempDir()
+	paths, err := export.MarkdownFiles(dir, tandas)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	want := []string{"index.md", "td-3.md", "tests/e2e/index.md", "tests/e2e/td-2.md", "tests/index.md", "tests/td-1.md"}
+	if len(paths) != len(want) {
+		t.Fatalf("paths = %v, want %v", paths, want)
+	}
+	for i, name := range want {
+		if paths[i] != filepath.Join(dir, filepath.FromSlash(name)) {
+			t.Errorf("path %d = %s, want %s", i, paths[i], name)
+		}
+	}
+
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	for name, parts := range map[string][]string{
+		"index.md": {"3 tandas: 2 active, 1 flaky.", "| [tests](tests/index.md) | 1 | 1 | 1 |",
+			"| [tests/e2e](tests/e2e/index.md) | 1 | 0 | 0 |", "| [Export](td-3.md) | active |"},
+		"tests/index.md": {"[Catalog](../index.md)", "| [Login](td-1.md) | flaky | `login.spec.ts` | fail 2025-06-02T10:00:00 | 50% |"},
+		"tests/td-1.md": {"[Catalog](../index.md) / [tests](index.md)", "- **Flakiness:** 50%",
+			"| 2025-06-02T10:00:00 | fail | 1.5s |  | timeout |"},
+		"tests/e2e/td-2.md": {"# Search \\| filters", "[Catalog](../../index.md)",
+			"- **Depends on:** [Login](../../tests/td-1.md), `td-gone`", "- [pr \\#42](<https://github.com/o/r/pull/42>)"},
+		"td-3.md": {"Never run."},
+	} {
+		page := read(name)
+		for _, part := range parts {
+			if !strings.Contains(page, part) {
+				t.Errorf("%s lacks %q:\n%s", name, part, page)
+			}
+		}
+	}
+
+	if err := export.Write(&bytes.Buffer{}, tandas, export.FormatMarkdown, export.Options{}); err == nil {
+		t.Error("markdown should not export to a stream")
+	}
+}
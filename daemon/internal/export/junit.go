@@ -0,0 +1,152 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr,omitempty"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name       string          `xml:"name,attr"`
+	Classname  string          `xml:"classname,attr"`
+	File       string          `xml:"file,attr,omitempty"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitMessage   `xml:"failure,omitempty"`
+	Skipped    *junitMessage   `xml:"skipped,omitempty"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnit renders the most recent run of every tanda as a JUnit XML report.
+// Tandas that never ran, whose last run was skipped, or in a status
+// statuses retires are reported as skipped.
+func JUnit(w io.Writer, tandas []*db.Tanda, statuses *workflow.Workflow) error {
+	suite := junitSuite{Name: "tandas", Cases: []junitCase{}}
+	var total time.Duration
+	var latest time.Time
+
+	for _, t := range tandas {
+		c := junitCase{
+			Name:      t.Title,
+			Classname: t.ID,
+			File:      t.File,
+			Time:      "0",
+			Properties: []junitProperty{
+				{Name: "tanda.id", Value: t.ID},
+				{Name: "tanda.status", Value: t.Status},
+			},
+		}
+		if t.File != "" {
+			c.Classname = t.File
+		}
+
+		var last *db.RunResult
+		if n := len(t.RunHistory); n > 0 {
+			last = &t.RunHistory[n-1]
+			if d, ok := db.ParseDuration(last.Duration); ok {
+				c.Time = seconds(d)
+				total += d
+			}
+			if ts, ok := db.ParseTimestamp(last.Timestamp); ok && ts.After(latest) {
+				latest = ts
+			}
+			if last.Trace != "" {
+				c.SystemOut = "[[ATTACHMENT|" + last.Trace + "]]"
+			}
+		}
+
+		switch {
+		case statuses.IsRetired(t.Status):
+			c.Skipped = &junitMessage{Message: t.Status}
+		case last == nil:
+			c.Skipped = &junitMessage{Message: "never run"}
+		case last.Result == "fail":
+			c.Failure = &junitMessage{Message: firstLine(last.Error), Text: last.Error}
+			if c.Failure.Message == "" {
+				c.Failure.Message = "failed"
+			}
+		case last.Result != "pass":
+			c.Skipped = &junitMessage{Message: last.Result}
+		}
+
+		if c.Failure != nil {
+			suite.Failures++
+		}
+		if c.Skipped != nil {
+			suite.Skipped++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	suite.Time = seconds(total)
+	if !latest.IsZero() {
+		suite.Timestamp = latest.Format("2006-01-02T15:04:05")
+	}
+	doc := junitSuites{
+		Name:     "tandas",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode JUnit report: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func firstLine(s string) string {
+	for i, r := range s {
+		if r == '\n' {
+			return s[:i]
+		}
+	}
+	return s
+}
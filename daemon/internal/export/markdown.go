@@ -0,0 +1,300 @@
+package export
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// MarkdownIndex is the name of the catalog's index pages
+const MarkdownIndex = "index.md"
+
+// MarkdownRuns is how many runs, newest first, a tanda's page lists
+const MarkdownRuns = 20
+
+// MarkdownPages renders the registry as a browsable catalog, keyed by
+// slash-separated path: index.md at the top lists the directories holding
+// test files, each directory's index.md lists its tandas, and every tanda
+// has a page, <id>.md, beside its directory's index. Tandas without a file,
+// or with one outside the project, are listed on the top index.
+func MarkdownPages(tandas []*db.Tanda) map[string][]byte {
+	byID := make(map[string]*db.Tanda, len(tandas))
+	dirs := make(map[string][]*db.Tanda)
+	for _, t := range tandas {
+		byID[t.ID] = t
+		dir := catalogDir(t)
+		dirs[dir] = append(dirs[dir], t)
+	}
+	for _, list := range dirs {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].File != list[j].File {
+				return list[i].File < list[j].File
+			}
+			return list[i].ID < list[j].ID
+		})
+	}
+
+	pages := make(map[string][]byte, len(tandas)+len(dirs)+1)
+	pages[MarkdownIndex] = markdownIndex(tandas, dirs)
+	for dir, list := range dirs {
+		if dir != "." {
+			pages[path.Join(dir, MarkdownIndex)] = markdownDir(dir, list)
+		}
+		for _, t := range list {
+			pages[path.Join(dir, t.ID+".md")] = markdownTanda(t, dir, byID)
+		}
+	}
+	return pages
+}
+
+// MarkdownFiles writes the catalog MarkdownPages renders into dir and
+// returns the paths written, index first
+func MarkdownFiles(dir string, tandas []*db.Tanda) ([]string, error) {
+	pages := MarkdownPages(tandas)
+	names := make([]string, 0, len(pages))
+	for name := range pages {
+		if name != MarkdownIndex {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = append([]string{MarkdownIndex}, names...)
+
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create export directory: %w", err)
+		}
+		if err := os.WriteFile(p, pages[name], 0o644); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// catalogDir is the directory of the tanda's test file, or . for the top
+func catalogDir(t *db.Tanda) string {
+	if t.File == "" {
+		return "."
+	}
+	dir := path.Dir(path.Clean(t.File))
+	if !fs.ValidPath(dir) {
+		return "."
+	}
+	return dir
+}
+
+// relLink is the link from a page in dir to the page at target
+func relLink(dir, target string) string {
+	if dir == "." {
+		return target
+	}
+	return strings.Repeat("../", strings.Count(dir, "/")+1) + target
+}
+
+func markdownIndex(tandas []*db.Tanda, dirs map[string][]*db.Tanda) []byte {
+	var b strings.Builder
+	b.WriteString("# Test catalog\n\n")
+	counts := make(map[string]int)
+	for _, t := range tandas {
+		counts[t.Status]++
+	}
+	statuses := make([]string, 0, len(counts))
+	for s := range counts {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	parts := make([]string, 0, len(statuses))
+	for _, s := range statuses {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+	}
+	fmt.Fprintf(&b, "%d tandas", len(tandas))
+	if len(parts) > 0 {
+		fmt.Fprintf(&b, ": %s", strings.Join(parts, ", "))
+	}
+	b.WriteString(".\n")
+
+	names := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		if dir != "." {
+			names = append(names, dir)
+		}
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		b.WriteString("\n## Directories\n\n| Directory | Tandas | Flaky | Failing |\n|---|---|---|---|\n")
+		for _, dir := range names {
+			var flaky, failing int
+			for _, t := range dirs[dir] {
+				if t.Status == "flaky" {
+					flaky++
+				}
+				if lastRun(t).Result == "fail" {
+					failing++
+				}
+			}
+			fmt.Fprintf(&b, "| [%s](%s) | %d | %d | %d |\n", mdEscape(dir), path.Join(dir, MarkdownIndex), len(dirs[dir]), flaky, failing)
+		}
+	}
+	if top := dirs["."]; len(top) > 0 {
+		b.WriteString("\n## Tandas outside a directory\n\n")
+		tandaTable(&b, top, ".")
+	}
+	return []byte(b.String())
+}
+
+func markdownDir(dir string, tandas []*db.Tanda) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n[Catalog](%s)\n\n", mdEscape(dir), relLink(dir, MarkdownIndex))
+	tandaTable(&b, tandas, dir)
+	return []byte(b.String())
+}
+
+// tandaTable lists tandas whose pages sit in dir
+func tandaTable(b *strings.Builder, tandas []*db.Tanda, dir string) {
+	b.WriteString("| Tanda | Status | File | Last result | Flakiness |\n|---|---|---|---|---|\n")
+	for _, t := range tandas {
+		file := ""
+		if t.File != "" {
+			file = "`" + path.Base(t.File) + "`"
+			if dir == "." {
+				file = "`" + t.File + "`"
+			}
+		}
+		result := ""
+		if last := lastRun(t); last.Result != "" {
+			result = last.Result + " " + mdEscape(last.Timestamp)
+		}
+		fmt.Fprintf(b, "| [%s](%s.md) | %s | %s | %s | %s |\n",
+			mdEscape(t.Title), t.ID, mdEscape(t.Status), file, result, percent(t.Flakiness()))
+	}
+}
+
+func markdownTanda(t *db.Tanda, dir string, byID map[string]*db.Tanda) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n[Catalog](%s)", mdEscape(t.Title), relLink(dir, MarkdownIndex))
+	if dir != "." {
+		fmt.Fprintf(&b, " / [%s](%s)", mdEscape(dir), MarkdownIndex)
+	}
+	b.WriteString("\n\n")
+
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "- **%s:** %s\n", name, value)
+		}
+	}
+	field("ID", "`"+t.ID+"`")
+	field("Status", mdEscape(t.Status))
+	if t.File != "" {
+		file := "`" + t.File + "`"
+		if t.Line > 0 {
+			file += fmt.Sprintf(", line %d", t.Line)
+		}
+		if t.Symbol != "" {
+			file += " (`" + t.Symbol + "`)"
+		}
+		field("File", file)
+	}
+	field("Priority", mdEscape(t.Priority))
+	field("Triage", mdEscape(t.Triage))
+	field("Owners", mdEscape(strings.Join(t.Owners, ", ")))
+	field("Covers", mdEscape(strings.Join(t.Covers, ", ")))
+	if len(t.RunHistory) > 0 {
+		field("Flakiness", percent(t.Flakiness()))
+	}
+	deps := make([]string, 0, len(t.DependsOn))
+	for _, id := range t.DependsOn {
+		if dep, ok := byID[id]; ok {
+			deps = append(deps, fmt.Sprintf("[%s](%s)", mdEscape(dep.Title), relLink(dir, path.Join(catalogDir(dep), id+".md"))))
+		} else {
+			deps = append(deps, "`"+id+"`")
+		}
+	}
+	field("Depends on", strings.Join(deps, ", "))
+
+	if len(t.Refs) > 0 || len(t.ExternalRefs) > 0 {
+		b.WriteString("\n## Links\n\n")
+		for _, r := range t.Refs {
+			label := r.Type
+			if r.ID != "" {
+				label += " " + r.ID
+			}
+			if r.URL != "" {
+				fmt.Fprintf(&b, "- [%s](<%s>)\n", mdEscape(label), r.URL)
+			} else {
+				fmt.Fprintf(&b, "- %s\n", mdEscape(label))
+			}
+		}
+		for _, ref := range t.ExternalRefs {
+			fmt.Fprintf(&b, "- %s\n", mdEscape(ref))
+		}
+	}
+
+	b.WriteString("\n## Run history\n\n")
+	if len(t.RunHistory) == 0 {
+		b.WriteString("Never run.\n")
+	} else {
+		shown := min(len(t.RunHistory), MarkdownRuns)
+		if shown < len(t.RunHistory) {
+			fmt.Fprintf(&b, "Latest %d of %d runs.\n\n", shown, len(t.RunHistory))
+		}
+		b.WriteString("| When | Result | Duration | Environment | Error |\n|---|---|---|---|---|\n")
+		for i := len(t.RunHistory) - 1; i >= len(t.RunHistory)-shown; i-- {
+			r := t.RunHistory[i]
+			result := r.Result
+			if r.Summary != nil {
+				result += fmt.Sprintf(" (%d runs, %d failed)", r.Summary.Runs, r.Summary.Failures)
+			}
+			var env []string
+			for _, v := range []string{r.Runner, r.OS, r.Browser, r.Shard} {
+				if v != "" {
+					env = append(env, v)
+				}
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", mdEscape(r.Timestamp), mdEscape(result),
+				mdEscape(r.Duration), mdEscape(strings.Join(env, ", ")), mdEscape(clip(firstLine(strings.TrimSpace(r.Error)), 120)))
+		}
+	}
+
+	if len(t.Notes) > 0 {
+		b.WriteString("\n## Notes\n\n")
+		for _, n := range t.Notes {
+			by := ""
+			if n.Author != "" {
+				by = " " + mdEscape(n.Author)
+			}
+			fmt.Fprintf(&b, "- **%s**%s (%s): %s\n", mdEscape(n.Timestamp), by, mdEscape(n.Type), mdEscape(strings.Join(strings.Fields(n.Text), " ")))
+		}
+	}
+	return []byte(b.String())
+}
+
+func percent(f float64) string {
+	return fmt.Sprintf("%.0f%%", f*100)
+}
+
+// clip cuts s to n runes
+func clip(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
+
+var mdReplacer = strings.NewReplacer(
+	`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", "&lt;", ">", "&gt;", "#", `\#`,
+	"\r\n", " ", "\n", " ",
+)
+
+// mdEscape keeps s literal in Markdown text and table cells
+func mdEscape(s string) string {
+	return mdReplacer.Replace(s)
+}
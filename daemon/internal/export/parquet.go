@@ -0,0 +1,145 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/tandas/daemon/internal/db"
+)
+
+// Files written by ParquetFiles
+const (
+	TandasParquet = "tandas.parquet"
+	RunsParquet   = "runs.parquet"
+)
+
+// TandaRow is one row of tandas.parquet
+type TandaRow struct {
+	ID           string    `parquet:"id"`
+	Title        string    `parquet:"title"`
+	Status       string    `parquet:"status"`
+	File         string    `parquet:"file,optional"`
+	Covers       []string  `parquet:"covers,list"`
+	DependsOn    []string  `parquet:"depends_on,list"`
+	Owners       []string  `parquet:"owners,list"`
+	ExternalRefs []string  `parquet:"external_refs,list"`
+	Priority     string    `parquet:"priority,optional"`
+	Triage       string    `parquet:"triage,optional"`
+	Runs         int64     `parquet:"runs"`
+	Flakiness    float64   `parquet:"flakiness"`
+	CreatedAt    time.Time `parquet:"created_at,optional,timestamp(millisecond)"`
+	UpdatedAt    time.Time `parquet:"updated_at,optional,timestamp(millisecond)"`
+}
+
+// RunRow is one row of runs.parquet, one per entry of a tanda's run history
+type RunRow struct {
+	TandaID    string    `parquet:"tanda_id"`
+	Seq        int64     `parquet:"seq"`
+	Timestamp  time.Time `parquet:"ts,optional,timestamp(millisecond)"`
+	Result     string    `parquet:"result"`
+	DurationMs *int64    `parquet:"duration_ms,optional"`
+	Error      string    `parquet:"error,optional"`
+	Trace      string    `parquet:"trace,optional"`
+	Runner     string    `parquet:"runner,optional"`
+	OS         string    `parquet:"os,optional"`
+	Browser    string    `parquet:"browser,optional"`
+	Shard      string    `parquet:"shard,optional"`
+}
+
+// ParquetRows flattens tandas and their run history into rows
+func ParquetRows(tandas []*db.Tanda) ([]TandaRow, []RunRow) {
+	tandaRows := make([]TandaRow, 0, len(tandas))
+	runRows := []RunRow{}
+	for _, t := range tandas {
+		tandaRows = append(tandaRows, TandaRow{
+			ID:           t.ID,
+			Title:        t.Title,
+			Status:       t.Status,
+			File:         t.File,
+			Covers:       t.Covers,
+			DependsOn:    t.DependsOn,
+			Owners:       t.Owners,
+			ExternalRefs: t.ExternalRefs,
+			Priority:     t.Priority,
+			Triage:       t.Triage,
+			Runs:         int64(len(t.RunHistory)),
+			Flakiness:    t.Flakiness(),
+			CreatedAt:    timestamp(t.CreatedAt),
+			UpdatedAt:    timestamp(t.UpdatedAt),
+		})
+		for i, run := range t.RunHistory {
+			row := RunRow{
+				TandaID:   t.ID,
+				Seq:       int64(i),
+				Timestamp: timestamp(run.Timestamp),
+				Result:    run.Result,
+				Error:     run.Error,
+				Trace:     run.Trace,
+				Runner:    run.Runner,
+				OS:        run.OS,
+				Browser:   run.Browser,
+				Shard:     run.Shard,
+			}
+			if d, ok := db.ParseDuration(run.Duration); ok {
+				ms := d.Milliseconds()
+				row.DurationMs = &ms
+			}
+			runRows = append(runRows, row)
+		}
+	}
+	return tandaRows, runRows
+}
+
+// WriteParquet writes the tandas and runs tables to separate writers
+func WriteParquet(tandasW, runsW io.Writer, tandas []*db.Tanda) error {
+	tandaRows, runRows := ParquetRows(tandas)
+	if err := parquet.Write(tandasW, tandaRows); err != nil {
+		return fmt.Errorf("failed to write tandas table: %w", err)
+	}
+	if err := parquet.Write(runsW, runRows); err != nil {
+		return fmt.Errorf("failed to write runs table: %w", err)
+	}
+	return nil
+}
+
+// ParquetFiles writes tandas.parquet and runs.parquet into dir and returns
+// their paths
+func ParquetFiles(dir string, tandas []*db.Tanda) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	paths := []string{filepath.Join(dir, TandasParquet), filepath.Join(dir, RunsParquet)}
+
+	tandasFile, err := os.Create(paths[0])
+	if err != nil {
+		return nil, err
+	}
+	defer tandasFile.Close()
+	runsFile, err := os.Create(paths[1])
+	if err != nil {
+		return nil, err
+	}
+	defer runsFile.Close()
+
+	if err := WriteParquet(tandasFile, runsFile, tandas); err != nil {
+		return nil, err
+	}
+	if err := tandasFile.Close(); err != nil {
+		return nil, err
+	}
+	if err := runsFile.Close(); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// timestamp parses a registry timestamp; unparseable values become the zero
+// time, which optional columns store as null
+func timestamp(s string) time.Time {
+	t, _ := db.ParseTimestamp(s)
+	return t
+}
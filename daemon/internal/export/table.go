@@ -0,0 +1,113 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// DefaultColumns are exported when no columns are selected
+var DefaultColumns = []string{"id", "title", "status", "file", "owners", "last_result", "last_run", "flakiness"}
+
+// columns maps each exportable column to its value. List values are joined
+// with "; " so they survive spreadsheet imports.
+var columns = map[string]func(t *db.Tanda) string{
+	"id":            func(t *db.Tanda) string { return t.ID },
+	"title":         func(t *db.Tanda) string { return t.Title },
+	"status":        func(t *db.Tanda) string { return t.Status },
+	"file":          func(t *db.Tanda) string { return t.File },
+	"covers":        func(t *db.Tanda) string { return strings.Join(t.Covers, "; ") },
+	"depends_on":    func(t *db.Tanda) string { return strings.Join(t.DependsOn, "; ") },
+	"owners":        func(t *db.Tanda) string { return strings.Join(t.Owners, "; ") },
+	"external_refs": func(t *db.Tanda) string { return strings.Join(t.ExternalRefs, "; ") },
+	"refs":          func(t *db.Tanda) string { return joinRefs(t.Refs) },
+	"priority":      func(t *db.Tanda) string { return t.Priority },
+	"triage":        func(t *db.Tanda) string { return t.Triage },
+	"runs":          func(t *db.Tanda) string { return strconv.Itoa(len(t.RunHistory)) },
+	"last_result":   func(t *db.Tanda) string { return lastRun(t).Result },
+	"last_run":      func(t *db.Tanda) string { return lastRun(t).Timestamp },
+	"last_duration": func(t *db.Tanda) string { return lastRun(t).Duration },
+	"last_error":    func(t *db.Tanda) string { return lastRun(t).Error },
+	"flakiness":     func(t *db.Tanda) string { return strconv.FormatFloat(t.Flakiness(), 'f', 2, 64) },
+	"p50":           func(t *db.Tanda) string { return formatDuration(t.Durations().P50) },
+	"p95":           func(t *db.Tanda) string { return formatDuration(t.Durations().P95) },
+	"created_at":    func(t *db.Tanda) string { return t.CreatedAt },
+	"updated_at":    func(t *db.Tanda) string { return t.UpdatedAt },
+}
+
+// formatDuration leaves tandas without timed runs empty
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// joinRefs renders refs like the other list columns
+func joinRefs(refs []db.Ref) string {
+	parts := make([]string, len(refs))
+	for i, r := range refs {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Columns returns the names of all exportable columns
+func Columns() []string {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Table writes one row per tanda with a header row, separated by comma for
+// CSV or tab for TSV
+func Table(w io.Writer, tandas []*db.Tanda, sep rune, selected []string) error {
+	if len(selected) == 0 {
+		selected = DefaultColumns
+	}
+	values := make([]func(t *db.Tanda) string, len(selected))
+	for i, name := range selected {
+		fn, ok := columns[name]
+		if !ok {
+			return fmt.Errorf("unknown column %q (available: %s)", name, strings.Join(Columns(), ", "))
+		}
+		values[i] = fn
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = sep
+	if err := cw.Write(selected); err != nil {
+		return err
+	}
+	row := make([]string, len(selected))
+	for _, t := range tandas {
+		for i, fn := range values {
+			row[i] = fn(t)
+			if sep == '\t' {
+				// TSV has no quoting, keep each record on one line
+				row[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(row[i])
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func lastRun(t *db.Tanda) db.RunResult {
+	if n := len(t.RunHistory); n > 0 {
+		return t.RunHistory[n-1]
+	}
+	return db.RunResult{}
+}
@@ -0,0 +1,175 @@
+// Package gate checks the registry against the project's policies, for a
+// required CI check that fails while any is violated
+package gate
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/events"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+// Policies, as gate.skip names them
+const (
+	// Registry fails on validation errors in issues.jsonl
+	Registry = "registry"
+	// UntrackedTests fails on added test files no tanda names as its file
+	UntrackedTests = "untracked_tests"
+	// MaxQuarantined bounds the tandas in quarantine
+	MaxQuarantined = "max_quarantined"
+	// MaxFlaky bounds the tandas with status flaky
+	MaxFlaky = "max_flaky"
+	// MinPassRate bounds the share of tandas whose latest run passed
+	MinPassRate = "min_pass_rate"
+)
+
+// Policies lists every policy in the order they are checked
+var Policies = []string{Registry, UntrackedTests, MaxQuarantined, MaxFlaky, MinPassRate}
+
+// DefaultTests are the test file globs used when gate.tests is empty
+var DefaultTests = []string{
+	"*_test.go", "test_*.py", "*_test.py", "*_spec.rb", "*Test.java",
+	"*.test.[jt]s", "*.test.[jt]sx", "*.spec.[jt]s", "*.spec.[jt]sx",
+}
+
+// Input is what the policies are checked against. Added lists the files
+// added by the change, relative to the project root; nil skips
+// UntrackedTests, as there is no change to check.
+type Input struct {
+	Tandas   []*db.Tanda
+	Problems []sync.ValidationError
+	Added    []string
+}
+
+// Violation is one way the registry breaks a policy
+type Violation struct {
+	Policy  string `json:"policy"`
+	Message string `json:"message"`
+	TandaID string `json:"tanda_id,omitempty"`
+	Path    string `json:"path,omitempty"`
+}
+
+// Result lists the policies checked and what violated them
+type Result struct {
+	Checked    []string    `json:"checked"`
+	Violations []Violation `json:"violations"`
+}
+
+// Failed reports whether any policy was violated
+func (r *Result) Failed() bool {
+	return len(r.Violations) > 0
+}
+
+// Check enforces the configured policies. Limits that are not set are
+// not checked. An invalid configuration is an error rather than a pass.
+func Check(cfg config.GateConfig, in Input) (*Result, error) {
+	skip := make(map[string]bool)
+	for _, name := range cfg.Skip {
+		if !known(name) {
+			return nil, fmt.Errorf("gate: unknown policy %q in skip", name)
+		}
+		skip[name] = true
+	}
+	tests := cfg.Tests
+	if len(tests) == 0 {
+		tests = DefaultTests
+	}
+	for _, g := range tests {
+		if _, err := path.Match(g, ""); err != nil {
+			return nil, fmt.Errorf("gate: invalid test glob %q: %w", g, err)
+		}
+	}
+	for name, limit := range map[string]*int{MaxQuarantined: cfg.MaxQuarantined, MaxFlaky: cfg.MaxFlaky} {
+		if limit != nil && *limit < 0 {
+			return nil, fmt.Errorf("gate: %s must not be negative", name)
+		}
+	}
+	if r := cfg.MinPassRate; r != nil && (*r < 0 || *r > 1) {
+		return nil, fmt.Errorf("gate: min_pass_rate must be between 0 and 1")
+	}
+
+	res := &Result{Checked: []string{}, Violations: []Violation{}}
+	enabled := func(name string, set bool) bool {
+		if !set || skip[name] {
+			return false
+		}
+		res.Checked = append(res.Checked, name)
+		return true
+	}
+
+	if enabled(Registry, true) {
+		for _, p := range in.Problems {
+			res.Violations = append(res.Violations, Violation{Policy: Registry, Message: p.Error(), TandaID: p.ID})
+		}
+	}
+
+	if enabled(UntrackedTests, in.Added != nil) {
+		files := make(map[string]bool, len(in.Tandas))
+		for _, t := range in.Tandas {
+			if t.File != "" {
+				files[path.Clean(t.File)] = true
+			}
+		}
+		added := append([]string(nil), in.Added...)
+		sort.Strings(added)
+		for _, p := range added {
+			p = path.Clean(p)
+			if isTest(tests, p) && !files[p] {
+				res.Violations = append(res.Violations, Violation{Policy: UntrackedTests,
+					Message: fmt.Sprintf("%s is a new test file no tanda names as its file", p), Path: p})
+			}
+		}
+	}
+
+	count := func(name string, limit *int, what string, match func(*db.Tanda) bool) {
+		if !enabled(name, limit != nil) {
+			return
+		}
+		n := 0
+		for _, t := range in.Tandas {
+			if match(t) {
+				n++
+			}
+		}
+		if n > *limit {
+			res.Violations = append(res.Violations, Violation{Policy: name,
+				Message: fmt.Sprintf("%d tandas %s, above the limit of %d", n, what, *limit)})
+		}
+	}
+	count(MaxQuarantined, cfg.MaxQuarantined, "quarantined", func(t *db.Tanda) bool { return db.IsQuarantined(t.Status) })
+	count(MaxFlaky, cfg.MaxFlaky, "flaky", func(t *db.Tanda) bool { return t.Status == "flaky" })
+
+	if enabled(MinPassRate, cfg.MinPassRate != nil) {
+		if rate := events.PassRate(in.Tandas); rate < *cfg.MinPassRate {
+			res.Violations = append(res.Violations, Violation{Policy: MinPassRate,
+				Message: fmt.Sprintf("pass rate %.1f%% is below the minimum of %.1f%%", rate*100, *cfg.MinPassRate*100)})
+		}
+	}
+	return res, nil
+}
+
+func known(name string) bool {
+	for _, p := range Policies {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isTest reports whether a glob matches the file's path or its name
+func isTest(globs []string, file string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, file); ok {
+			return true
+		}
+		if ok, _ := path.Match(g, path.Base(file)); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package gate_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/gate"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+func TestCheck(t *testing.T) {
+	tandas := []*db.Tanda{
+		{ID: "td-1", Status: "active", File: "e2e/login.spec.ts", RunHistory: []db.RunResult{{Result: "pass"}}},
+		{ID: "td-2", Status: "flaky", File: "./e2e/cart.spec.ts", RunHistory: []db.RunResult{{Result: "fail"}}},
+		{ID: "td-3", Status: "quarantined", RunHistory: []db.RunResult{{Result: "pass"}}},
+	}
+	in := gate.Input{
+		Tandas:   tandas,
+		Problems: []sync.ValidationError{{Line: 4, ID: "td-9", Message: "missing title"}},
+		Added:    []string{"src/cart.ts", "pkg/cart/cart_test.go", "e2e/cart.spec.ts", "tests/test_api.py"},
+	}
+
+	// Without limits, only the registry and new test files are checked
+	res, err := gate.Check(config.GateConfig{}, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{gate.Registry, gate.UntrackedTests}; !reflect.DeepEqual(res.Checked, want) {
+		t.Errorf("checked %v, want %v", res.Checked, want)
+	}
+	var paths []string
+	for _, v := range res.Violations {
+		if v.Policy == gate.UntrackedTests {
+			paths = append(paths, v.Path)
+		}
+	}
+	if want := []string{"pkg/cart/cart_test.go", "tests/test_api.py"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("untracked tests %v, want %v", paths, want)
+	}
+	if !res.Failed() || res.Violations[0].Policy != gate.Registry || res.Violations[0].TandaID != "td-9" {
+		t.Errorf("violations = %+v", res.Violations)
+	}
+
+	one, half := 1, 0.5
+	cfg := config.GateConfig{Tests: []string{"*.spec.ts"}, MaxQuarantined: &one, MaxFlaky: &one, MinPassRate: &half,
+		Skip: []string{gate.Registry}}
+	res, err = gate.Check(cfg, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Violations) != 1 || res.Violations[0].Policy != gate.MaxQuarantined ||
+		!strings.Contains(res.Violations[0].Message, "2 tandas quarantined") {
+		t.Errorf("violations = %+v", res.Violations)
+	}
+
+	// Without a change, new test files are not checked
+	in.Added = nil
+	res, err = gate.Check(config.GateConfig{Skip: []string{gate.Registry}}, in)
+	if err != nil || res.Failed() || len(res.Checked) != 0 {
+		t.Errorf("result = %+v, %v", res, err)
+	}
+
+	for _, bad := range []config.GateConfig{
+		{Skip: []string{"coverage"}},
+		{Tests: []string{"[*.go"}},
+		{MinPassRate: new(float64)},
+	} {
+		if bad.MinPassRate != nil {
+			*bad.MinPassRate = 95
+		}
+		if _, err := gate.Check(bad, in); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
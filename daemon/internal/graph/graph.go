@@ -0,0 +1,258 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// Formats accepted by Render
+const (
+	FormatDOT     = "dot"
+	FormatMermaid = "mermaid"
+)
+
+// Node is a tanda in the graph. Missing is set for depends_on targets that
+// are not in the registry, and Retired for tandas in a retired status.
+type Node struct {
+	ID      string `json:"id"`
+	Title   string `json:"title,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Missing bool   `json:"missing,omitempty"`
+	Retired bool   `json:"retired,omitempty"`
+}
+
+// Edge points from a tanda to one of its dependencies
+type Edge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Cycle bool   `json:"cycle,omitempty"`
+}
+
+// Graph is the depends_on graph of the registry or of one subtree
+type Graph struct {
+	Nodes  []Node     `json:"nodes"`
+	Edges  []Edge     `json:"edges"`
+	Cycles [][]string `json:"cycles"`
+}
+
+// Build returns the depends_on graph. When root is set only root and its
+// transitive dependencies are included. Nodes are marked retired when
+// statuses retires their status.
+func Build(tandas []*db.Tanda, statuses *workflow.Workflow, root string) (*Graph, error) {
+	byID := make(map[string]*db.Tanda, len(tandas))
+	for _, t := range tandas {
+		byID[t.ID] = t
+	}
+
+	include := make(map[string]bool)
+	if root == "" {
+		for id := range byID {
+			include[id] = true
+		}
+		for _, t := range tandas {
+			for _, dep := range t.DependsOn {
+				include[dep] = true
+			}
+		}
+	} else {
+		if byID[root] == nil {
+			return nil, fmt.Errorf("tanda %s not found", root)
+		}
+		stack := []string{root}
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if include[id] {
+				continue
+			}
+			include[id] = true
+			if t := byID[id]; t != nil {
+				stack = append(stack, t.DependsOn...)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(include))
+	for id := range include {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	g := &Graph{Nodes: []Node{}, Edges: []Edge{}, Cycles: [][]string{}}
+	adj := make(map[string][]string)
+	for _, id := range ids {
+		t := byID[id]
+		if t == nil {
+			g.Nodes = append(g.Nodes, Node{ID: id, Missing: true})
+			continue
+		}
+		g.Nodes = append(g.Nodes, Node{ID: id, Title: t.Title, Status: t.Status, Retired: statuses.IsRetired(t.Status)})
+		for _, dep := range t.DependsOn {
+			adj[id] = append(adj[id], dep)
+		}
+	}
+
+	g.Cycles = cycles(ids, adj)
+	component := make(map[string]int)
+	for i, c := range g.Cycles {
+		for _, id := range c {
+			component[id] = i + 1
+		}
+	}
+	for _, id := range ids {
+		for _, dep := range adj[id] {
+			inCycle := component[id] != 0 && component[id] == component[dep]
+			g.Edges = append(g.Edges, Edge{From: id, To: dep, Cycle: inCycle})
+		}
+	}
+	return g, nil
+}
+
+// cycles returns the strongly connected components that contain a cycle,
+// using Tarjan's algorithm
+func cycles(ids []string, adj map[string][]string) [][]string {
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var result [][]string
+	next := 1
+
+	var visit func(id string)
+	visit = func(id string) {
+		index[id], low[id] = next, next
+		next++
+		stack = append(stack, id)
+		onStack[id] = true
+
+		selfLoop := false
+		for _, dep := range adj[id] {
+			if dep == id {
+				selfLoop = true
+			}
+			if index[dep] == 0 {
+				visit(dep)
+				low[id] = min(low[id], low[dep])
+			} else if onStack[dep] {
+				low[id] = min(low[id], index[dep])
+			}
+		}
+
+		if low[id] != index[id] {
+			return
+		}
+		var scc []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			scc = append(scc, top)
+			if top == id {
+				break
+			}
+		}
+		if len(scc) > 1 || selfLoop {
+			sort.Strings(scc)
+			result = append(result, scc)
+		}
+	}
+
+	for _, id := range ids {
+		if index[id] == 0 {
+			visit(id)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	return result
+}
+
+// Render writes the graph in the given format
+func Render(g *Graph, format string) (string, error) {
+	switch format {
+	case FormatDOT, "":
+		return DOT(g), nil
+	case FormatMermaid:
+		return Mermaid(g), nil
+	default:
+		return "", fmt.Errorf("unknown graph format %q (want dot or mermaid)", format)
+	}
+}
+
+// DOT renders the graph for Graphviz. Flaky tandas are orange, retired
+// ones grey, missing ones dashed, and edges on a cycle red.
+func DOT(g *Graph) string {
+	var b strings.Builder
+	b.WriteString("digraph tandas {\n")
+	b.WriteString("  rankdir=LR;\n  node [shape=box];\n")
+	for _, n := range g.Nodes {
+		attrs := []string{"label=" + quote(label(n, `\n`))}
+		switch {
+		case n.Missing:
+			attrs = append(attrs, "style=dashed")
+		case n.Status == "flaky":
+			attrs = append(attrs, "style=filled", `fillcolor="orange"`)
+		case n.Retired:
+			attrs = append(attrs, "style=filled", `fillcolor="lightgrey"`)
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", quote(n.ID), strings.Join(attrs, ", "))
+	}
+	for _, e := range g.Edges {
+		attr := ""
+		if e.Cycle {
+			attr = ` [color="red", penwidth=2]`
+		}
+		fmt.Fprintf(&b, "  %s -> %s%s;\n", quote(e.From), quote(e.To), attr)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart using the same styling
+// as DOT
+func Mermaid(g *Graph) string {
+	ids := make(map[string]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[n.ID], strings.ReplaceAll(label(n, "<br/>"), `"`, "#quot;"))
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s --> %s\n", ids[e.From], ids[e.To])
+		if e.Cycle {
+			fmt.Fprintf(&b, "  linkStyle %d stroke:red,stroke-width:2px\n", i)
+		}
+	}
+	for _, n := range g.Nodes {
+		switch {
+		case n.Missing:
+			fmt.Fprintf(&b, "  style %s stroke-dasharray: 5 5\n", ids[n.ID])
+		case n.Status == "flaky":
+			fmt.Fprintf(&b, "  style %s fill:orange\n", ids[n.ID])
+		case n.Retired:
+			fmt.Fprintf(&b, "  style %s fill:lightgrey\n", ids[n.ID])
+		}
+	}
+	return b.String()
+}
+
+func label(n Node, newline string) string {
+	if n.Missing {
+		return n.ID + " (missing)"
+	}
+	if n.Title == "" {
+		return n.ID
+	}
+	return n.ID + newline + n.Title
+}
+
+func quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
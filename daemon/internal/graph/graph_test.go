@@ -0,0 +1,164 @@
+package graph_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/graph"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+func registry() []*db.Tanda {
+	return []*db.Tanda{
+		{ID: "td-a", Title: "Checkout", Status: "active", DependsOn: []string{"td-b"}},
+		{ID: "td-b", Title: "Cart", Status: "flaky", DependsOn: []string{"td-c"}},
+		{ID: "td-c", Title: "Login", Status: "active", DependsOn: []string{"td-b", "td-gone"}},
+		{ID: "td-d", Title: "Search", Status: "active"},
+	}
+}
+
+func TestBuildDetectsCycles(t *testing.T) {
+	g, err := graph.Build(registry(), nil, "")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if len(g.Nodes) != 5 {
+		t.Fatalf("expected 5 nodes including the missing one, got %+v", g.Nodes)
+	}
+	if len(g.Cycles) != 1 || strings.Join(g.Cycles[0], ",") != "td-b,td-c" {
+		t.Fatalf("expected cycle td-b,td-c, got %v", g.Cycles)
+	}
+	for _, e := range g.Edges {
+		want := (e.From == "td-b" && e.To == "td-c") || (e.From == "td-c" && e.To == "td-b")
+		if e.Cycle != want {
+			t.Errorf("edge %s -> %s: cycle = %v, want %v", e.From, e.To, e.Cycle, want)
+		}
+	}
+}
+
+func TestBuildSubtree(t *testing.T) {
+	g, err := graph.Build(registry(), nil, "td-b")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	var ids []string
+	for _, n := range g.Nodes {
+		ids = append(ids, n.ID)
+	}
+	if got := strings.Join(ids, ","); got != "td-b,td-c,td-gone" {
+		t.Fatalf("unexpected subtree %s", got)
+	}
+	if _, err := graph.Build(registry(), nil, "td-nope"); err == nil {
+		t.Fatal("expected error for unknown root")
+	}
+}
+
+func TestRender(t *testing.T) {
+	g, _ := graph.Build(registry(), nil, "")
+	dot, err := graph.Render(g, graph.FormatDOT)
+	if err != nil {
+		t.Fatalf("render dot: %v", err)
+	}
+	if !strings.Contains(dot, `"td-b" -> "td-c" [color="red", penwidth=2];`) || !strings.Contains(dot, `"td-gone" [label="td-gone (missing)", style=dashed]`) {
+		t.Fatalf("unexpected DOT output:\n%s", dot)
+	}
+
+	mermaid, err := graph.Render(g, graph.FormatMermaid)
+	if err != nil {
+		t.Fatalf("render mermaid: %v", err)
+	}
+	if !strings.HasPrefix(mermaid, "flowchart LR\n") || !strings.Contains(mermaid, "linkStyle 1 stroke:red") {
+		t.Fatalf("unexpected Mermaid output:\n%s", mermaid)
+	}
+
+	if _, err := graph.Render(g, "svg"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestRenderRetired(t *testing.T) {
+	statuses, err := workflow.New(config.StatusConfig{Extra: []string{"obsolete"}, Retired: []string{"obsolete"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := graph.Build([]*db.Tanda{
+		{ID: "td-a", Title: "Checkout", Status: "active", DependsOn: []string{"td-b", "td-c"}},
+		{ID: "td-b", Title: "Cart", Status: "archived"},
+		{ID: "td-c", Title: "Coupons", Status: "obsolete"},
+	}, statuses, "")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	for _, n := range g.Nodes {
+		if n.Retired != (n.ID != "td-a") {
+			t.Errorf("%s: retired = %v", n.ID, n.Retired)
+		}
+	}
+	if dot := graph.DOT(g); strings.Count(dot, `fillcolor="lightgrey"`) != 2 || strings.Contains(dot, `Checkout", style=filled`) {
+		t.Errorf("expected only the retired tandas greyed out:\n%s", dot)
+	}
+	if mermaid := graph.Mermaid(g); !strings.Contains(mermaid, "style n1 fill:lightgrey\n  style n2 fill:lightgrey\n") {
+		t.Errorf("expected the retired tandas greyed out:\n%s", mermaid)
+	}
+}
+
+func TestWaves(t *testing.T) {
+	tandas := append(registry(),
+		&db.Tanda{ID: "td-e", Title: "Signup", Status: "active"},
+		&db.Tanda{ID: "td-f", Title: "Profile", Status: "active", DependsOn: []string{"td-e", "td-d"}},
+		&db.Tanda{ID: "td-g", Title: "Settings", Status: "active", DependsOn: []string{"td-f"}},
+		&db.Tanda{ID: "td-h", Title: "Logout", Status: "deprecated"},
+		&db.Tanda{ID: "td-i", Title: "Wishlist", Status: "archived"},
+		&db.Tanda{ID: "td-j", Title: "Coupons", Status: "obsolete"},
+	)
+	statuses, err := workflow.New(config.StatusConfig{Extra: []string{"obsolete"}, Retired: []string{"obsolete"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := graph.Waves(tandas, statuses, nil, false)
+	if err != nil {
+		t.Fatalf("waves: %v", err)
+	}
+	var waves []string
+	for _, w := range s.Waves {
+		waves = append(waves, strings.Join(w, ","))
+	}
+	if got := strings.Join(waves, " | "); got != "td-d,td-e | td-f | td-g" {
+		t.Errorf("waves = %s", got)
+	}
+	if got := strings.Join(s.Order, ","); got != "td-d,td-e,td-f,td-g" {
+		t.Errorf("order = %s", got)
+	}
+	if got := strings.Join(s.Blocked, ","); got != "td-a,td-b,td-c" {
+		t.Errorf("blocked = %s", got)
+	}
+	if len(s.Cycles) != 1 || strings.Join(s.Cycles[0], ",") != "td-b,td-c" {
+		t.Errorf("cycles = %v", s.Cycles)
+	}
+	if got := strings.Join(s.Missing, ","); got != "td-gone" {
+		t.Errorf("missing = %s", got)
+	}
+
+	s, err = graph.Waves(tandas, statuses, []string{"td-g"}, false)
+	if err != nil {
+		t.Fatalf("waves: %v", err)
+	}
+	if got := strings.Join(s.Order, ","); got != "td-g" || strings.Join(s.External, ",") != "td-f" {
+		t.Errorf("order = %s, external = %v", got, s.External)
+	}
+
+	s, err = graph.Waves(tandas, statuses, []string{"td-g"}, true)
+	if err != nil {
+		t.Fatalf("waves: %v", err)
+	}
+	if got := strings.Join(s.Order, ","); got != "td-d,td-e,td-f,td-g" || len(s.External) != 0 {
+		t.Errorf("order with deps = %s, external = %v", got, s.External)
+	}
+
+	if _, err := graph.Waves(tandas, statuses, []string{"td-nope"}, false); err == nil {
+		t.Error("expected error for unknown tanda")
+	}
+}
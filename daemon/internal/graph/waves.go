@@ -0,0 +1,140 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// Schedule orders a set of tandas for a runner. Each wave depends only on
+// earlier waves, so its tandas can run in parallel; Order is the waves one
+// after another. Tandas in a cycle, or depending on one, can't be ordered
+// and are Blocked instead.
+type Schedule struct {
+	Waves   [][]string `json:"waves"`
+	Order   []string   `json:"order"`
+	Blocked []string   `json:"blocked"`
+	Cycles  [][]string `json:"cycles"`
+	// External lists dependencies in the registry left out of the set,
+	// which the schedule assumes already ran
+	External []string `json:"external"`
+	// Missing lists dependencies not in the registry
+	Missing []string `json:"missing"`
+}
+
+// Waves schedules the tandas ids by depends_on. With includeDeps their
+// transitive dependencies join the set. An empty ids schedules every tanda
+// whose status statuses does not retire.
+func Waves(tandas []*db.Tanda, statuses *workflow.Workflow, ids []string, includeDeps bool) (*Schedule, error) {
+	byID := make(map[string]*db.Tanda, len(tandas))
+	for _, t := range tandas {
+		byID[t.ID] = t
+	}
+
+	set := make(map[string]bool)
+	if len(ids) == 0 {
+		for _, t := range tandas {
+			if !statuses.IsRetired(t.Status) {
+				set[t.ID] = true
+			}
+		}
+	}
+	for _, id := range ids {
+		if byID[id] == nil {
+			return nil, fmt.Errorf("tanda %s not found", id)
+		}
+		set[id] = true
+	}
+	if includeDeps {
+		var stack []string
+		for id := range set {
+			stack = append(stack, id)
+		}
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, dep := range byID[id].DependsOn {
+				if byID[dep] != nil && !set[dep] {
+					set[dep] = true
+					stack = append(stack, dep)
+				}
+			}
+		}
+	}
+
+	s := &Schedule{Waves: [][]string{}, Order: []string{}, Blocked: []string{}, Cycles: [][]string{}, External: []string{}, Missing: []string{}}
+	members := make([]string, 0, len(set))
+	for id := range set {
+		members = append(members, id)
+	}
+	sort.Strings(members)
+
+	// Only edges within the set order it; the rest are reported
+	adj := make(map[string][]string)
+	external, missing := make(map[string]bool), make(map[string]bool)
+	for _, id := range members {
+		for _, dep := range byID[id].DependsOn {
+			switch {
+			case set[dep]:
+				adj[id] = append(adj[id], dep)
+			case byID[dep] != nil:
+				external[dep] = true
+			default:
+				missing[dep] = true
+			}
+		}
+	}
+	s.External, s.Missing = sortedKeys(external), sortedKeys(missing)
+	s.Cycles = cycles(members, adj)
+
+	// Kahn's algorithm, one wave at a time: a tanda is ready once all its
+	// dependencies are in earlier waves. Cycle members never become ready,
+	// and neither does anything depending on them.
+	waiting := make(map[string]int, len(members))
+	dependents := make(map[string][]string)
+	for _, id := range members {
+		waiting[id] = len(adj[id])
+		for _, dep := range adj[id] {
+			dependents[dep] = append(dependents[dep], id)
+		}
+	}
+	var ready []string
+	for _, id := range members {
+		if waiting[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+	placed := make(map[string]bool)
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		s.Waves = append(s.Waves, ready)
+		s.Order = append(s.Order, ready...)
+		var next []string
+		for _, id := range ready {
+			placed[id] = true
+			for _, d := range dependents[id] {
+				if waiting[d]--; waiting[d] == 0 {
+					next = append(next, d)
+				}
+			}
+		}
+		ready = next
+	}
+	for _, id := range members {
+		if !placed[id] {
+			s.Blocked = append(s.Blocked, id)
+		}
+	}
+	return s, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,191 @@
+// Package heatmap rolls failure and flakiness rates up the directory tree
+// of tandas' files or covered paths, as a hierarchy a treemap can draw
+package heatmap
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/paths"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// Sources of the paths tandas are placed by
+const (
+	ByFile   = "file"
+	ByCovers = "covers"
+)
+
+// Options choose the paths and runs the heatmap is built from
+type Options struct {
+	// By is ByFile, the default, or ByCovers, which uses the covers entries
+	// that are paths
+	By string `json:"by,omitempty"`
+	workflow.Filter
+}
+
+// Node is a directory or file. Its counts cover every tanda at or under
+// it, each tanda once, so a directory is never less than its hottest
+// child. Value, the tanda count, sizes a treemap cell and FailureRate or
+// Flakiness colours it.
+type Node struct {
+	Name        string  `json:"name"`
+	Path        string  `json:"path"`
+	Value       int     `json:"value"`
+	Runs        int     `json:"runs"`
+	Failures    int     `json:"failures"`
+	FailureRate float64 `json:"failure_rate"`
+	// Flaky counts quarantined tandas; Flakiness is the mean score of the
+	// tandas that have run
+	Flaky     int     `json:"flaky"`
+	Flakiness float64 `json:"flakiness"`
+	// Tandas are the IDs placed at this path itself
+	Tandas   []string `json:"tandas,omitempty"`
+	Children []*Node  `json:"children,omitempty"`
+
+	under map[*db.Tanda]bool
+}
+
+// Build places each tanda that is not deprecated or archived at its path
+// and returns the root, named ".". Tandas without a path are left out.
+func Build(tandas []*db.Tanda, opts Options, now time.Time) (*Node, error) {
+	by := opts.By
+	if by == "" {
+		by = ByFile
+	}
+	if by != ByFile && by != ByCovers {
+		return nil, fmt.Errorf("invalid heatmap source %q: use %s or %s", by, ByFile, ByCovers)
+	}
+	since := db.RunsSince(opts.Days, now)
+
+	root := &Node{Name: ".", Path: ".", under: make(map[*db.Tanda]bool)}
+	for _, t := range tandas {
+		if opts.Statuses.IsRetired(t.Status) {
+			continue
+		}
+		var places []string
+		if by == ByFile {
+			if t.File != "" {
+				places = []string{t.File}
+			}
+		} else {
+			for _, c := range t.Covers {
+				if paths.IsPath(c) {
+					places = append(places, c)
+				}
+			}
+		}
+		for _, p := range places {
+			root.add(t, path.Clean(strings.ReplaceAll(p, `\`, "/")))
+		}
+	}
+	root.finish(since)
+	return root, nil
+}
+
+// add places t at p, counting it at every directory on the way
+func (n *Node) add(t *db.Tanda, p string) {
+	n.under[t] = true
+	if p == "." || p == "/" || p == "" {
+		n.addID(t.ID)
+		return
+	}
+	node := n
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for i, part := range parts {
+		var child *Node
+		for _, c := range node.Children {
+			if c.Name == part {
+				child = c
+				break
+			}
+		}
+		if child == nil {
+			child = &Node{Name: part, Path: strings.Join(parts[:i+1], "/"), under: make(map[*db.Tanda]bool)}
+			node.Children = append(node.Children, child)
+		}
+		child.under[t] = true
+		node = child
+	}
+	node.addID(t.ID)
+}
+
+func (n *Node) addID(id string) {
+	for _, have := range n.Tandas {
+		if have == id {
+			return
+		}
+	}
+	n.Tandas = append(n.Tandas, id)
+}
+
+// finish computes the counts from the tandas under each node and sorts
+// children by path
+func (n *Node) finish(since time.Time) {
+	ran, flakiness := 0, 0.0
+	for t := range n.under {
+		n.Value++
+		if db.IsQuarantined(t.Status) {
+			n.Flaky++
+		}
+		for _, r := range t.RunHistory {
+			if !db.InWindow(r, since) {
+				continue
+			}
+			n.Runs++
+			if r.Result == "fail" {
+				n.Failures++
+			}
+		}
+		if len(t.RunHistory) > 0 {
+			ran++
+			flakiness += t.Flakiness()
+		}
+	}
+	if n.Runs > 0 {
+		n.FailureRate = float64(n.Failures) / float64(n.Runs)
+	}
+	if ran > 0 {
+		n.Flakiness = flakiness / float64(ran)
+	}
+	n.under = nil
+	sort.Strings(n.Tandas)
+	sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Name < n.Children[j].Name })
+	for _, c := range n.Children {
+		c.finish(since)
+	}
+}
+
+// Hotspots returns the nodes with at least minRuns runs, highest failure
+// rate first and then most failures, down to depth levels below the root
+// (every level when depth is 0)
+func Hotspots(root *Node, minRuns, depth int) []*Node {
+	var out []*Node
+	var walk func(n *Node, level int)
+	walk = func(n *Node, level int) {
+		if depth > 0 && level > depth {
+			return
+		}
+		if level > 0 && n.Runs >= minRuns && n.Failures > 0 {
+			out = append(out, n)
+		}
+		for _, c := range n.Children {
+			walk(c, level+1)
+		}
+	}
+	walk(root, 0)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].FailureRate != out[j].FailureRate {
+			return out[i].FailureRate > out[j].FailureRate
+		}
+		if out[i].Failures != out[j].Failures {
+			return out[i].Failures > out[j].Failures
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
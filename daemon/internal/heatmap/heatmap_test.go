@@ -0,0 +1,96 @@
+package heatmap_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/heatmap"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+func runs(results ...string) []db.RunResult {
+	out := make([]db.RunResult, len(results))
+	for i, r := range results {
+		out[i] = db.RunResult{Timestamp: "2025-06-0" + string(rune('1'+i)) + "T10:00:00Z", Result: r}
+	}
+	return out
+}
+
+func find(n *heatmap.Node, path string) *heatmap.Node {
+	if n.Path == path {
+		return n
+	}
+	for _, c := range n.Children {
+		if f := find(c, path); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+func TestBuild(t *testing.T) {
+	tandas := []*db.Tanda{
+		{ID: "td-login", Status: "flaky", File: "tests/auth/login.spec.ts", Covers: []string{"src/auth/", "src/auth/login.ts", "auth"},
+			RunHistory: runs("pass", "fail", "fail", "pass")},
+		{ID: "td-logout", Status: "active", File: "tests/auth/logout.spec.ts", Covers: []string{"src/auth/logout.ts"},
+			RunHistory: runs("pass", "pass")},
+		{ID: "td-cart", Status: "active", File: "tests/cart.spec.ts", RunHistory: runs("fail", "pass")},
+		{ID: "td-old", Status: "deprecated", File: "tests/auth/old.spec.ts", RunHistory: runs("fail")},
+		{ID: "td-none", Status: "active"},
+	}
+	now := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	root, err := heatmap.Build(tandas, heatmap.Options{}, now)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if root.Value != 3 || root.Runs != 8 || root.Failures != 3 || root.Flaky != 1 {
+		t.Fatalf("unexpected root %+v", root)
+	}
+	auth := find(root, "tests/auth")
+	if auth == nil || auth.Value != 2 || auth.Runs != 6 || auth.Failures != 2 || len(auth.Children) != 2 {
+		t.Fatalf("unexpected tests/auth %+v", auth)
+	}
+	if leaf := find(root, "tests/auth/login.spec.ts"); leaf == nil || leaf.FailureRate != 0.5 || strings.Join(leaf.Tandas, ",") != "td-login" {
+		t.Fatalf("unexpected login leaf %+v", leaf)
+	}
+
+	// A tanda covering a directory and a file in it counts once there
+	byCovers, _ := heatmap.Build(tandas, heatmap.Options{By: heatmap.ByCovers}, now)
+	src := find(byCovers, "src/auth")
+	if src == nil || src.Value != 2 || src.Runs != 6 || strings.Join(src.Tandas, ",") != "td-login" {
+		t.Fatalf("unexpected src/auth %+v", src)
+	}
+	if find(byCovers, "auth") != nil {
+		t.Error("expected covers entries that are not paths left out")
+	}
+
+	// Only runs from June 4 on count
+	recent, _ := heatmap.Build(tandas, heatmap.Options{Filter: workflow.Filter{Days: 6}}, now)
+	if recent.Runs != 1 || recent.Failures != 0 {
+		t.Fatalf("expected one recent run, got %+v", recent)
+	}
+
+	hot := heatmap.Hotspots(root, 2, 0)
+	var order []string
+	for _, n := range hot {
+		order = append(order, n.Path)
+	}
+	if got := strings.Join(order, ","); got != "tests/auth/login.spec.ts,tests/cart.spec.ts,tests,tests/auth" {
+		t.Fatalf("hotspots = %s", got)
+	}
+	if len(heatmap.Hotspots(root, 2, 1)) != 1 {
+		t.Error("expected depth 1 to list only tests")
+	}
+
+	data, _ := json.Marshal(root)
+	if !strings.Contains(string(data), `"name":".","path":".","value":3`) {
+		t.Errorf("unexpected JSON %s", data)
+	}
+	if _, err := heatmap.Build(tandas, heatmap.Options{By: "owners"}, now); err == nil {
+		t.Error("expected an unknown source to fail")
+	}
+}
@@ -0,0 +1,101 @@
+package hooks
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/tandas/daemon/internal/shell"
+)
+
+// marker identifies hook scripts written by Install
+const marker = "# Installed by td-daemon hooks install"
+
+// Names lists the git hooks td-daemon manages
+var Names = []string{"post-merge", "post-checkout", "pre-commit"}
+
+// Dir returns the hooks directory of the git repository containing
+// projectRoot, honoring core.hooksPath and worktrees
+func Dir(projectRoot string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--git-path", "hooks")
+	cmd.Dir = projectRoot
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %s", projectRoot)
+	}
+
+	dir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(projectRoot, dir)
+	}
+	return dir, nil
+}
+
+// Script renders the hook that runs `td-daemon hooks run <name>`. The
+// pre-commit hook fails the commit on validation errors; the others
+// never block git.
+func Script(name, binary, tandasDir string) string {
+	run := fmt.Sprintf("%s hooks run %s --dir %s", shell.Quote(binary), name, shell.Quote(tandasDir))
+	if name != "pre-commit" {
+		run += " || true"
+	}
+	return fmt.Sprintf("#!/bin/sh\n%s\n%s\n", marker, run)
+}
+
+// Install writes all managed hooks. Existing hooks not written by td-daemon
+// are left alone unless force is set; the names installed are returned.
+func Install(projectRoot, binary, tandasDir string, force bool) ([]string, error) {
+	dir, err := Dir(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+
+	var installed []string
+	for _, name := range Names {
+		path := filepath.Join(dir, name)
+		if !force && isForeign(path) {
+			fmt.Printf("Skipping %s: existing hook not managed by td-daemon (use --force)\n", name)
+			continue
+		}
+		if err := os.WriteFile(path, []byte(Script(name, binary, tandasDir)), 0o755); err != nil {
+			return installed, fmt.Errorf("failed to write %s hook: %w", name, err)
+		}
+		installed = append(installed, name)
+	}
+	return installed, nil
+}
+
+// Uninstall removes the hooks written by Install
+func Uninstall(projectRoot string) ([]string, error) {
+	dir, err := Dir(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, name := range Names {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil || !strings.Contains(string(data), marker) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return removed, fmt.Errorf("failed to remove %s hook: %w", name, err)
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+func isForeign(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return !strings.Contains(string(data), marker)
+}
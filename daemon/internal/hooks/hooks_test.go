@@ -0,0 +1,89 @@
+package hooks_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/hooks"
+)
+
+func TestScriptQuoting(t *testing.T) {
+	// Paths the shell must not expand or split
+	dir := filepath.Join(t.TempDir(), `it's $HOME`)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	argsFile := filepath.Join(dir, "args")
+	binary := filepath.Join(dir, "td-daemon $(touch pwned)")
+	fake := "#!/bin/sh\nprintf '%s\\n' \"$@\" > \"$(dirname \"$0\")/args\"\n"
+	if err := os.WriteFile(binary, []byte(fake), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	hook := filepath.Join(dir, "pre-commit")
+	if err := os.WriteFile(hook, []byte(hooks.Script("pre-commit", binary, "my `tandas`")), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(hook)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("hook: %v: %s", err, out)
+	}
+	data, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "hooks\nrun\npre-commit\n--dir\nmy `tandas`\n" {
+		t.Errorf("hook passed args %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+		t.Error("the hook ran a command substitution from the binary path")
+	}
+}
+
+func TestInstallAndUninstall(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	root := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+
+	hookDir := filepath.Join(root, ".git", "hooks")
+	os.MkdirAll(hookDir, 0o755)
+	custom := filepath.Join(hookDir, "post-checkout")
+	if err := os.WriteFile(custom, []byte("#!/bin/sh\necho mine\n"), 0o755); err != nil {
+		t.Fatalf("write custom hook: %v", err)
+	}
+
+	installed, err := hooks.Install(root, "/usr/local/bin/td-daemon", ".tandas", false)
+	if err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if strings.Join(installed, ",") != "post-merge,pre-commit" {
+		t.Fatalf("expected custom post-checkout to be kept, installed %v", installed)
+	}
+
+	data, err := os.ReadFile(filepath.Join(hookDir, "pre-commit"))
+	if err != nil {
+		t.Fatalf("read pre-commit: %v", err)
+	}
+	if !strings.Contains(string(data), `hooks run pre-commit --dir '.tandas'`) || strings.Contains(string(data), "|| true") {
+		t.Fatalf("unexpected pre-commit hook:\n%s", data)
+	}
+
+	removed, err := hooks.Uninstall(root)
+	if err != nil {
+		t.Fatalf("uninstall: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 hooks removed, got %v", removed)
+	}
+	if _, err := os.Stat(custom); err != nil {
+		t.Fatalf("custom hook should survive uninstall: %v", err)
+	}
+}
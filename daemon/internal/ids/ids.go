@@ -0,0 +1,113 @@
+// Package ids allocates sequential tanda IDs such as td-0421
+package ids
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+)
+
+const (
+	// DefaultPrefix starts every allocated ID
+	DefaultPrefix = "td-"
+	// DefaultWidth zero-pads the sequence number
+	DefaultWidth = 4
+	// ReserveFor is how long an allocated ID stays reserved for its creator
+	ReserveFor = 2 * time.Minute
+)
+
+// Allocator hands out IDs one past the highest in use with its prefix.
+// Allocated IDs are reserved for ReserveFor so concurrent creators never
+// receive the same ID before either has written its tanda.
+type Allocator struct {
+	prefix string
+	width  int
+
+	mu       gosync.Mutex
+	reserved map[string]time.Time
+}
+
+// New returns an allocator; an empty prefix or non-positive width uses the
+// default
+func New(prefix string, width int) *Allocator {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	return &Allocator{
+		prefix:   prefix,
+		width:    width,
+		reserved: make(map[string]time.Time),
+	}
+}
+
+// Next reserves and returns the next free ID. used holds the IDs already
+// taken, from the database and the JSONL.
+func (a *Allocator) Next(used map[string]bool, now time.Time) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expire(now)
+
+	next := 1
+	for id := range used {
+		if n, ok := a.sequence(id); ok && n >= next {
+			next = n + 1
+		}
+	}
+	for id := range a.reserved {
+		if n, ok := a.sequence(id); ok && n >= next {
+			next = n + 1
+		}
+	}
+	id := a.format(next)
+	a.reserved[id] = now.Add(ReserveFor)
+	return id
+}
+
+// Reserved reports whether id is held by an unexpired reservation
+func (a *Allocator) Reserved(id string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expire(now)
+	_, ok := a.reserved[id]
+	return ok
+}
+
+// Release drops the reservation on id once its tanda is written
+func (a *Allocator) Release(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.reserved, id)
+}
+
+func (a *Allocator) expire(now time.Time) {
+	for id, until := range a.reserved {
+		if !now.Before(until) {
+			delete(a.reserved, id)
+		}
+	}
+}
+
+// sequence parses the number after the prefix; IDs from other schemes,
+// such as hashed td-a1b2c3d4, do not count
+func (a *Allocator) sequence(id string) (int, bool) {
+	digits, ok := strings.CutPrefix(id, a.prefix)
+	if !ok || digits == "" {
+		return 0, false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(digits)
+	return n, err == nil
+}
+
+func (a *Allocator) format(n int) string {
+	return fmt.Sprintf("%s%0*d", a.prefix, a.width, n)
+}
@@ -0,0 +1,42 @@
+package ids_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/ids"
+)
+
+func TestNext(t *testing.T) {
+	now := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	a := ids.New("td-", 4)
+
+	used := map[string]bool{"td-0007": true, "td-a1b2c3d4": true, "td-0420": true, "qa-9999": true}
+	if got := a.Next(used, now); got != "td-0421" {
+		t.Fatalf("Next = %q, want td-0421", got)
+	}
+	// The reservation keeps a concurrent creator off td-0421
+	if got := a.Next(used, now); got != "td-0422" {
+		t.Fatalf("second Next = %q, want td-0422", got)
+	}
+	if !a.Reserved("td-0421", now) {
+		t.Error("td-0421 should be reserved")
+	}
+
+	a.Release("td-0422")
+	if got := a.Next(used, now); got != "td-0422" {
+		t.Errorf("Next after release = %q, want td-0422", got)
+	}
+
+	later := now.Add(ids.ReserveFor)
+	if a.Reserved("td-0421", later) {
+		t.Error("reservation should expire")
+	}
+	if got := a.Next(used, later); got != "td-0421" {
+		t.Errorf("Next after expiry = %q, want td-0421", got)
+	}
+
+	if got := ids.New("", 0).Next(nil, now); got != "td-0001" {
+		t.Errorf("default Next = %q, want td-0001", got)
+	}
+}
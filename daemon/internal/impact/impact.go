@@ -0,0 +1,231 @@
+// Package impact finds the tandas affected by a set of changed files
+package impact
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/paths"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// Reasons a tanda is affected
+const (
+	// ChangedFile is a change to the tanda's own test file
+	ChangedFile = "file"
+	// Covers is a change to a path the tanda covers
+	Covers = "covers"
+	// DependsOn is an affected tanda the tanda depends on
+	DependsOn = "depends_on"
+)
+
+// Reason is why a tanda is affected: the changed path it covers or owns,
+// or the affected tanda it depends on
+type Reason struct {
+	Kind string `json:"kind"`
+	// Path is the changed file, for file and covers
+	Path string `json:"path,omitempty"`
+	// Cover is the covers entry that matched Path
+	Cover string `json:"cover,omitempty"`
+	// TandaID is the dependency, for depends_on
+	TandaID string `json:"tanda_id,omitempty"`
+}
+
+// String renders the reason as "file tests/a.spec.ts", "covers src/auth/
+// (src/auth/login.ts)" or "depends on td-0003"
+func (r Reason) String() string {
+	switch r.Kind {
+	case ChangedFile:
+		return "file " + r.Path
+	case Covers:
+		if r.Cover == r.Path {
+			return "covers " + r.Path
+		}
+		return fmt.Sprintf("covers %s (%s)", r.Cover, r.Path)
+	case DependsOn:
+		return "depends on " + r.TandaID
+	}
+	return r.Kind
+}
+
+// Affected is a tanda to run. Depth is 0 for tandas hit by a change
+// directly and counts the depends_on hops otherwise.
+type Affected struct {
+	TandaID string   `json:"tanda_id"`
+	Title   string   `json:"title"`
+	Status  string   `json:"status"`
+	File    string   `json:"file,omitempty"`
+	Depth   int      `json:"depth"`
+	Reasons []Reason `json:"reasons"`
+}
+
+// Result lists the affected tandas, nearest first and then by ID, and the
+// changed paths no tanda covers
+type Result struct {
+	Changed   []string   `json:"changed"`
+	Tandas    []Affected `json:"tandas"`
+	Uncovered []string   `json:"uncovered"`
+}
+
+// IDs returns the affected tandas' IDs in order
+func (r *Result) IDs() []string {
+	ids := make([]string, len(r.Tandas))
+	for i, a := range r.Tandas {
+		ids[i] = a.TandaID
+	}
+	return ids
+}
+
+// Analyze returns the tandas affected by changed, which are paths relative
+// to root. A tanda is hit when its file changed or a path it covers did,
+// a covered directory taking in everything under it; the tandas depending
+// on a hit tanda, transitively, are affected too. Tandas in a status
+// statuses retires are skipped.
+func Analyze(tandas []*db.Tanda, root string, statuses *workflow.Workflow, changed []string) *Result {
+	r := &Result{Changed: []string{}, Tandas: []Affected{}, Uncovered: []string{}}
+	seen := make(map[string]bool)
+	for _, p := range changed {
+		if p = paths.Normalize(root, p); p != "" && p != "." && !seen[p] {
+			seen[p] = true
+			r.Changed = append(r.Changed, p)
+		}
+	}
+	sort.Strings(r.Changed)
+
+	live := make([]*db.Tanda, 0, len(tandas))
+	for _, t := range tandas {
+		if !statuses.IsRetired(t.Status) {
+			live = append(live, t)
+		}
+	}
+
+	hit := make(map[string]*Affected)
+	var order []string
+	add := func(t *db.Tanda, depth int, reason Reason) {
+		a, ok := hit[t.ID]
+		if !ok {
+			a = &Affected{TandaID: t.ID, Title: t.Title, Status: t.Status, File: t.File, Depth: depth}
+			hit[t.ID] = a
+			order = append(order, t.ID)
+		}
+		a.Reasons = append(a.Reasons, reason)
+	}
+
+	for _, p := range r.Changed {
+		covered := false
+		for _, t := range live {
+			if t.File == p {
+				add(t, 0, Reason{Kind: ChangedFile, Path: p})
+				covered = true
+			}
+			for _, c := range t.Covers {
+				if paths.IsPath(c) && within(p, c) {
+					add(t, 0, Reason{Kind: Covers, Path: p, Cover: c})
+					covered = true
+				}
+			}
+		}
+		if !covered {
+			r.Uncovered = append(r.Uncovered, p)
+		}
+	}
+
+	// Walk depends_on backwards, breadth first, so each tanda gets the
+	// shortest chain to a change
+	dependents := make(map[string][]*db.Tanda)
+	for _, t := range live {
+		for _, dep := range t.DependsOn {
+			dependents[dep] = append(dependents[dep], t)
+		}
+	}
+	queue := append([]string(nil), order...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, t := range dependents[id] {
+			if a, ok := hit[t.ID]; ok {
+				if a.Depth == hit[id].Depth+1 {
+					a.Reasons = append(a.Reasons, Reason{Kind: DependsOn, TandaID: id})
+				}
+				continue
+			}
+			add(t, hit[id].Depth+1, Reason{Kind: DependsOn, TandaID: id})
+			queue = append(queue, t.ID)
+		}
+	}
+
+	for _, id := range order {
+		r.Tandas = append(r.Tandas, *hit[id])
+	}
+	sort.SliceStable(r.Tandas, func(i, j int) bool {
+		if r.Tandas[i].Depth != r.Tandas[j].Depth {
+			return r.Tandas[i].Depth < r.Tandas[j].Depth
+		}
+		return r.Tandas[i].TandaID < r.Tandas[j].TandaID
+	})
+	return r
+}
+
+// within reports whether path p is the covered path c or lies under it
+func within(p, c string) bool {
+	c = strings.TrimSuffix(c, "/")
+	return p == c || strings.HasPrefix(p, c+"/")
+}
+
+// GitChanged lists the files under root that differ from base, as `git
+// diff --name-only` reports them, plus untracked files. An empty base is
+// HEAD, so uncommitted changes are the ones listed.
+func GitChanged(root, base string) ([]string, error) {
+	return gitDiff(root, base)
+}
+
+// GitAdded lists the files under root added since base, plus untracked
+// files, the way GitChanged does
+func GitAdded(root, base string) ([]string, error) {
+	return gitDiff(root, base, "--diff-filter=A")
+}
+
+func gitDiff(root, base string, flags ...string) ([]string, error) {
+	if base == "" {
+		base = "HEAD"
+	}
+	// --relative keeps paths relative to root when it is below the
+	// repository's top level
+	args := append(append([]string{"diff", "--name-only", "--relative"}, flags...), base, "--")
+	changed, err := gitLines(root, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff against %s: %w", base, err)
+	}
+	untracked, err := gitLines(root, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list untracked files: %w", err)
+	}
+	return append(changed, untracked...), nil
+}
+
+// gitLines runs git in dir and returns the non-empty lines it prints
+func gitLines(dir string, args ...string) ([]string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+			return nil, errors.New(strings.TrimSpace(string(ee.Stderr)))
+		}
+		return nil, err
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,131 @@
+package impact_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/impact"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+func registry() []*db.Tanda {
+	return []*db.Tanda{
+		{ID: "td-login", Title: "Login", Status: "active", File: "tests/login.spec.ts", Covers: []string{"src/auth/"}},
+		{ID: "td-cart", Title: "Cart", Status: "active", File: "tests/cart.spec.ts", Covers: []string{"src/cart.ts", "checkout"}, DependsOn: []string{"td-login"}},
+		{ID: "td-pay", Title: "Pay", Status: "flaky", File: "tests/pay.spec.ts", DependsOn: []string{"td-cart", "td-login"}},
+		{ID: "td-old", Title: "Old login", Status: "deprecated", Covers: []string{"src/auth/login.ts"}},
+		{ID: "td-search", Title: "Search", Status: "active", File: "tests/search.spec.ts"},
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	r := impact.Analyze(registry(), "/repo", nil, []string{"/repo/src/auth/login.ts", "./README.md", "src/auth/login.ts"})
+
+	if got := strings.Join(r.Changed, ","); got != "README.md,src/auth/login.ts" {
+		t.Errorf("changed = %s", got)
+	}
+	if got := strings.Join(r.IDs(), ","); got != "td-login,td-cart,td-pay" {
+		t.Fatalf("affected = %s", got)
+	}
+	for i, depth := range []int{0, 1, 1} {
+		if r.Tandas[i].Depth != depth {
+			t.Errorf("%s: depth = %d, want %d", r.Tandas[i].TandaID, r.Tandas[i].Depth, depth)
+		}
+	}
+	if reason := r.Tandas[0].Reasons[0]; reason.Kind != impact.Covers || reason.Cover != "src/auth/" {
+		t.Errorf("login reason = %+v", reason)
+	}
+	// td-pay depends on td-login directly, not only through td-cart
+	if reasons := r.Tandas[2].Reasons; len(reasons) != 1 || reasons[0].TandaID != "td-login" {
+		t.Errorf("pay reasons = %+v", reasons)
+	}
+	if got := strings.Join(r.Uncovered, ","); got != "README.md" {
+		t.Errorf("uncovered = %s", got)
+	}
+}
+
+func TestAnalyzeChangedTestFile(t *testing.T) {
+	r := impact.Analyze(registry(), "/repo", nil, []string{"tests/cart.spec.ts", "src/cart.ts"})
+	if got := strings.Join(r.IDs(), ","); got != "td-cart,td-pay" {
+		t.Fatalf("affected = %s", got)
+	}
+	if n := len(r.Tandas[0].Reasons); n != 2 {
+		t.Errorf("expected file and covers reasons, got %+v", r.Tandas[0].Reasons)
+	}
+	if len(r.Uncovered) != 0 {
+		t.Errorf("uncovered = %v", r.Uncovered)
+	}
+}
+
+func TestGitChanged(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		cmd.Dir = root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	write("src/a.ts", "a")
+	write("src/b.ts", "b")
+	git("add", ".")
+	git("commit", "-qm", "init")
+
+	write("src/a.ts", "changed")
+	write("src/new.ts", "new")
+	changed, err := impact.GitChanged(root, "")
+	if err != nil {
+		t.Fatalf("git changed: %v", err)
+	}
+	if got := strings.Join(changed, ","); got != "src/a.ts,src/new.ts" {
+		t.Errorf("changed = %s", got)
+	}
+	if _, err := impact.GitChanged(root, "no-such-ref"); err == nil {
+		t.Error("expected an error for an unknown base")
+	}
+
+	git("add", "src/new.ts")
+	git("commit", "-qm", "add new")
+	write("src/later.ts", "later")
+	added, err := impact.GitAdded(root, "HEAD~1")
+	if err != nil {
+		t.Fatalf("git added: %v", err)
+	}
+	if got := strings.Join(added, ","); got != "src/new.ts,src/later.ts" {
+		t.Errorf("added = %s", got)
+	}
+}
+
+func TestAnalyzeSkipsRetired(t *testing.T) {
+	statuses, err := workflow.New(config.StatusConfig{Extra: []string{"obsolete"}, Retired: []string{"obsolete"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tandas := append(registry(),
+		&db.Tanda{ID: "td-archived", Title: "Archived", Status: "archived", File: "tests/archived.spec.ts", Covers: []string{"src/auth/"}},
+		&db.Tanda{ID: "td-obsolete", Title: "Obsolete", Status: "obsolete", Covers: []string{"src/auth/"}})
+
+	r := impact.Analyze(tandas, "/repo", statuses, []string{"src/auth/login.ts", "tests/archived.spec.ts"})
+	if got := strings.Join(r.IDs(), ","); got != "td-login,td-cart,td-pay" {
+		t.Errorf("affected = %s", got)
+	}
+	if got := strings.Join(r.Uncovered, ","); got != "tests/archived.spec.ts" {
+		t.Errorf("uncovered = %s", got)
+	}
+}
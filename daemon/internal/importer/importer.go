@@ -0,0 +1,280 @@
+package importer
+
+import (
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// Supported input formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// NoteType marks notes written by an import
+const NoteType = "import"
+
+// Case is a test case read from a test-management export
+type Case struct {
+	// Key is the tool's case ID, e.g. C123 or PROJ-T12
+	Key    string
+	Title  string
+	Status string
+	// Links are requirement or story keys the case tests
+	Links []string
+	// Section is the folder or suite the case lives in
+	Section string
+}
+
+// parser reads one tool's export in the given format
+type parser func(r io.Reader, format string) ([]Case, error)
+
+var sources = map[string]parser{
+	"testrail": parseTestRail,
+	"xray":     parseXray,
+	"zephyr":   parseZephyr,
+}
+
+// Sources lists the supported tools
+func Sources() []string {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FormatOf guesses the export format from a file name
+func FormatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	}
+	return FormatCSV
+}
+
+// Parse reads an export from source in format
+func Parse(source, format string, r io.Reader) ([]Case, error) {
+	p, ok := sources[strings.ToLower(source)]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q (supported: %s)", source, strings.Join(Sources(), ", "))
+	}
+	if format != FormatCSV && format != FormatJSON {
+		return nil, fmt.Errorf("unknown format %q (supported: csv, json)", format)
+	}
+	cases, err := p(r, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s export: %w", source, err)
+	}
+	var out []Case
+	for _, c := range cases {
+		c.Key = strings.TrimSpace(c.Key)
+		c.Title = strings.TrimSpace(c.Title)
+		if c.Key == "" || c.Title == "" {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// Result lists what Apply changed
+type Result struct {
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// Apply creates a tanda for each case, or updates the tanda that already
+// carries the case key in its external refs, so re-running an import is
+// safe. Case keys go to external refs and linked requirements to covers.
+// With dryRun nothing is written.
+func Apply(store *db.Store, source string, cases []Case, now string, dryRun bool) (*Result, error) {
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tandas: %w", err)
+	}
+	byRef := make(map[string]*db.Tanda)
+	for _, t := range tandas {
+		for _, ref := range t.ExternalRefs {
+			byRef[ref] = t
+		}
+	}
+
+	result := &Result{Created: []string{}, Updated: []string{}}
+	for _, c := range cases {
+		t, exists := byRef[c.Key]
+		if !exists {
+			t = &db.Tanda{
+				ID:           NewID(source, c.Key),
+				Title:        c.Title,
+				Status:       c.Status,
+				Covers:       uniq(c.Links),
+				DependsOn:    []string{},
+				RunHistory:   []db.RunResult{},
+				ExternalRefs: []string{c.Key},
+				Notes: []db.Note{{Timestamp: now, Type: NoteType,
+					Text: importNote(source, c)}},
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			byRef[c.Key] = t
+			result.Created = append(result.Created, t.ID)
+		} else if !update(t, c) {
+			result.Unchanged++
+			continue
+		} else {
+			t.UpdatedAt = now
+			result.Updated = append(result.Updated, t.ID)
+		}
+		if dryRun {
+			continue
+		}
+		if err := store.UpsertTanda(t); err != nil {
+			return result, fmt.Errorf("failed to save tanda %s: %w", t.ID, err)
+		}
+	}
+	return result, nil
+}
+
+// NewID derives a stable tanda ID from the source and case key
+func NewID(source, key string) string {
+	sum := sha1.Sum([]byte(source + ":" + key))
+	return "td-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// update applies the case's title, deprecation and links to an existing
+// tanda and reports whether anything changed. Other statuses are owned by
+// the registry (a tool never knows a test is flaky), and covers only grow
+// so links added in the registry are kept.
+func update(t *db.Tanda, c Case) bool {
+	changed := false
+	if t.Title != c.Title {
+		t.Title = c.Title
+		changed = true
+	}
+	if c.Status == "deprecated" && t.Status != c.Status {
+		t.Status = c.Status
+		changed = true
+	}
+	covers := uniq(append(append([]string{}, t.Covers...), c.Links...))
+	if len(covers) != len(t.Covers) {
+		t.Covers = covers
+		changed = true
+	}
+	return changed
+}
+
+func importNote(source string, c Case) string {
+	text := fmt.Sprintf("Imported from %s %s", source, c.Key)
+	if c.Section != "" {
+		text += " (" + c.Section + ")"
+	}
+	return text
+}
+
+// Status maps a tool's case status onto tanda statuses
+func Status(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "deprecated", "obsolete", "retired", "archived", "rejected", "closed", "won't do":
+		return "deprecated"
+	case "flaky", "unstable", "quarantined":
+		return "flaky"
+	}
+	return "active"
+}
+
+// splitList splits a comma, semicolon or newline separated cell
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == '\n' }) {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func uniq(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	out := []string{}
+	for _, s := range items {
+		if s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// readCSV returns rows keyed by lower-cased header name
+func readCSV(r io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	header := make([]string, len(records[0]))
+	for i, h := range records[0] {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+	}
+	var rows []map[string]string
+	for _, rec := range records[1:] {
+		row := make(map[string]string, len(header))
+		for i, v := range rec {
+			if i < len(header) {
+				row[header[i]] = strings.TrimSpace(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// first returns the first non-empty value among the named columns
+func first(row map[string]string, names ...string) string {
+	for _, n := range names {
+		if v := row[n]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// decodeList decodes a JSON array, or an object wrapping the array under
+// one of the given keys (as paginated APIs return)
+func decodeList(r io.Reader, v interface{}, keys ...string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		return json.Unmarshal(data, v)
+	}
+	var wrapper map[string]json.RawMessage
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if raw, ok := wrapper[k]; ok {
+			return json.Unmarshal(raw, v)
+		}
+	}
+	return fmt.Errorf("expected a list or an object with one of: %s", strings.Join(keys, ", "))
+}
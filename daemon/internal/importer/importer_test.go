@@ -0,0 +1,92 @@
+package importer_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/importer"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		source, format, input string
+		want                  importer.Case
+	}{
+		{"testrail", "csv",
+			"\ufeffID,Title,Section,References\nC12,Login works,Auth,\"REQ-1, REQ-2\"\n",
+			importer.Case{Key: "C12", Title: "Login works", Status: "active", Links: []string{"REQ-1", "REQ-2"}, Section: "Auth"}},
+		{"testrail", "json",
+			`{"cases":[{"id":12,"title":"Login works","refs":"REQ-1","is_deleted":1}]}`,
+			importer.Case{Key: "C12", Title: "Login works", Status: "deprecated", Links: []string{"REQ-1"}}},
+		{"xray", "json",
+			`{"issues":[{"key":"APP-7","fields":{"summary":"Login works","status":{"name":"Obsolete"},
+			  "issuelinks":[{"type":{"outward":"tests"},"outwardIssue":{"key":"APP-1"}},
+			                {"type":{"outward":"blocks"},"outwardIssue":{"key":"APP-2"}}]}}]}`,
+			importer.Case{Key: "APP-7", Title: "Login works", Status: "deprecated", Links: []string{"APP-1"}}},
+		{"xray", "csv",
+			"Issue key,Summary,Status,Outward issue link (Tests)\nAPP-7,Login works,To Do,APP-1\n",
+			importer.Case{Key: "APP-7", Title: "Login works", Status: "active", Links: []string{"APP-1"}}},
+		{"zephyr", "json",
+			`{"values":[{"key":"APP-T3","name":"Login works","status":{"name":"Approved"},"folder":"/Auth",
+			  "links":{"issues":[{"issueKey":"APP-1"}]}}]}`,
+			importer.Case{Key: "APP-T3", Title: "Login works", Status: "active", Links: []string{"APP-1"}, Section: "/Auth"}},
+		{"zephyr", "csv",
+			"Key,Name,Status,Folder,Coverage (Issues)\nAPP-T3,Login works,Deprecated,/Auth,APP-1\n",
+			importer.Case{Key: "APP-T3", Title: "Login works", Status: "deprecated", Links: []string{"APP-1"}, Section: "/Auth"}},
+	}
+	for _, tt := range tests {
+		cases, err := importer.Parse(tt.source, tt.format, strings.NewReader(tt.input))
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.source, tt.format, err)
+		}
+		if len(cases) != 1 {
+			t.Fatalf("%s %s: expected 1 case, got %+v", tt.source, tt.format, cases)
+		}
+		got := cases[0]
+		if got.Key != tt.want.Key || got.Title != tt.want.Title || got.Status != tt.want.Status ||
+			got.Section != tt.want.Section || strings.Join(got.Links, ",") != strings.Join(tt.want.Links, ",") {
+			t.Errorf("%s %s: got %+v, want %+v", tt.source, tt.format, got, tt.want)
+		}
+	}
+
+	if _, err := importer.Parse("qtest", "csv", strings.NewReader("")); err == nil {
+		t.Error("expected unknown source to fail")
+	}
+}
+
+func TestApply(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	cases := []importer.Case{{Key: "C12", Title: "Login works", Status: "active", Links: []string{"REQ-1"}}}
+	result, err := importer.Apply(store, "testrail", cases, "2025-06-01T10:00:00Z", false)
+	if err != nil || len(result.Created) != 1 {
+		t.Fatalf("unexpected result %+v %v", result, err)
+	}
+	id := result.Created[0]
+
+	// Flaky is owned by the registry and survives a re-import
+	tanda, _ := store.GetTanda(id)
+	tanda.Status = "flaky"
+	store.UpsertTanda(tanda)
+
+	result, err = importer.Apply(store, "testrail", cases, "2025-06-02T10:00:00Z", false)
+	if err != nil || len(result.Created) != 0 || result.Unchanged != 1 {
+		t.Fatalf("expected re-import to be a no-op, got %+v %v", result, err)
+	}
+
+	cases[0].Title = "Login with SSO"
+	cases[0].Links = []string{"REQ-2"}
+	if result, err = importer.Apply(store, "testrail", cases, "2025-06-03T10:00:00Z", false); err != nil || len(result.Updated) != 1 {
+		t.Fatalf("expected an update, got %+v %v", result, err)
+	}
+	tanda, _ = store.GetTanda(id)
+	if tanda.Title != "Login with SSO" || tanda.Status != "flaky" || len(tanda.Covers) != 2 || tanda.ExternalRefs[0] != "C12" {
+		t.Fatalf("unexpected tanda %+v", tanda)
+	}
+}
@@ -0,0 +1,67 @@
+package importer
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+type testRailCase struct {
+	ID        int64  `json:"id"`
+	Title     string `json:"title"`
+	Refs      string `json:"refs"`
+	IsDeleted int    `json:"is_deleted"`
+}
+
+// parseTestRail reads the TestRail case CSV export or the JSON returned
+// by the get_cases API
+func parseTestRail(r io.Reader, format string) ([]Case, error) {
+	if format == FormatJSON {
+		var raw []testRailCase
+		if err := decodeList(r, &raw, "cases"); err != nil {
+			return nil, err
+		}
+		var cases []Case
+		for _, c := range raw {
+			status := "active"
+			if c.IsDeleted != 0 {
+				status = "deprecated"
+			}
+			cases = append(cases, Case{
+				Key:    testRailKey(strconv.FormatInt(c.ID, 10)),
+				Title:  c.Title,
+				Status: status,
+				Links:  splitList(c.Refs),
+			})
+		}
+		return cases, nil
+	}
+
+	rows, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	for _, row := range rows {
+		cases = append(cases, Case{
+			Key:     testRailKey(first(row, "id", "case id")),
+			Title:   first(row, "title"),
+			Status:  Status(first(row, "status", "case status")),
+			Links:   splitList(first(row, "references", "refs")),
+			Section: first(row, "section", "section hierarchy"),
+		})
+	}
+	return cases, nil
+}
+
+// testRailKey writes case IDs the way TestRail displays them, e.g. C123
+func testRailKey(id string) string {
+	id = strings.TrimSpace(id)
+	if id == "" || id == "0" {
+		return ""
+	}
+	if strings.HasPrefix(strings.ToUpper(id), "C") {
+		return "C" + id[1:]
+	}
+	return "C" + id
+}
@@ -0,0 +1,89 @@
+package importer
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// named decodes a field that is either a plain string or an object with
+// a name, as Jira and Zephyr both use
+type named string
+
+func (n *named) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*n = named(s)
+		return nil
+	}
+	var obj struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*n = named(obj.Name)
+	return nil
+}
+
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary    string `json:"summary"`
+		Status     named  `json:"status"`
+		IssueLinks []struct {
+			Type struct {
+				Outward string `json:"outward"`
+			} `json:"type"`
+			OutwardIssue *struct {
+				Key string `json:"key"`
+			} `json:"outwardIssue"`
+		} `json:"issuelinks"`
+	} `json:"fields"`
+}
+
+// parseXray reads Xray tests exported from Jira, either as the issue
+// search JSON or as a Jira CSV export. Requirements are the issues a test
+// links to with the "tests" link type.
+func parseXray(r io.Reader, format string) ([]Case, error) {
+	if format == FormatJSON {
+		var raw []jiraIssue
+		if err := decodeList(r, &raw, "issues"); err != nil {
+			return nil, err
+		}
+		var cases []Case
+		for _, issue := range raw {
+			c := Case{Key: issue.Key, Title: issue.Fields.Summary, Status: Status(string(issue.Fields.Status))}
+			for _, link := range issue.Fields.IssueLinks {
+				if link.OutwardIssue != nil && strings.EqualFold(link.Type.Outward, "tests") {
+					c.Links = append(c.Links, link.OutwardIssue.Key)
+				}
+			}
+			cases = append(cases, c)
+		}
+		return cases, nil
+	}
+
+	rows, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	for _, row := range rows {
+		c := Case{
+			Key:     first(row, "issue key", "key"),
+			Title:   first(row, "summary"),
+			Status:  Status(first(row, "status")),
+			Links:   splitList(first(row, "requirements", "requirement")),
+			Section: first(row, "test repository path", "test set"),
+		}
+		// Jira names link columns after the link type, one per link
+		for col, v := range row {
+			if strings.HasPrefix(col, "outward issue link (test") && v != "" {
+				c.Links = append(c.Links, splitList(v)...)
+			}
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
@@ -0,0 +1,53 @@
+package importer
+
+import "io"
+
+type zephyrCase struct {
+	Key    string `json:"key"`
+	Name   string `json:"name"`
+	Status named  `json:"status"`
+	Folder named  `json:"folder"`
+	Links  struct {
+		Issues []struct {
+			IssueKey string `json:"issueKey"`
+		} `json:"issues"`
+	} `json:"links"`
+}
+
+// parseZephyr reads Zephyr Scale test cases from the testcases API JSON
+// or the CSV export. Covered issues become links.
+func parseZephyr(r io.Reader, format string) ([]Case, error) {
+	if format == FormatJSON {
+		var raw []zephyrCase
+		if err := decodeList(r, &raw, "values", "testCases"); err != nil {
+			return nil, err
+		}
+		var cases []Case
+		for _, z := range raw {
+			c := Case{Key: z.Key, Title: z.Name, Status: Status(string(z.Status)), Section: string(z.Folder)}
+			for _, issue := range z.Links.Issues {
+				if issue.IssueKey != "" {
+					c.Links = append(c.Links, issue.IssueKey)
+				}
+			}
+			cases = append(cases, c)
+		}
+		return cases, nil
+	}
+
+	rows, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	for _, row := range rows {
+		cases = append(cases, Case{
+			Key:     first(row, "key", "issue key"),
+			Title:   first(row, "name", "summary"),
+			Status:  Status(first(row, "status")),
+			Links:   splitList(first(row, "coverage (issues)", "issues", "coverage")),
+			Section: first(row, "folder"),
+		})
+	}
+	return cases, nil
+}
@@ -0,0 +1,119 @@
+package jira
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+)
+
+// NoteType marks notes that record a linked ticket's status
+const NoteType = "jira"
+
+var keyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]+-[0-9]+$`)
+
+// IsKey reports whether an external ref looks like a Jira issue key
+func IsKey(ref string) bool {
+	return keyPattern.MatchString(ref)
+}
+
+// Client talks to the Jira REST API (v2)
+type Client struct {
+	baseURL string
+	user    string
+	token   string
+	client  *http.Client
+}
+
+// New creates a Jira client. With a user set it authenticates with basic
+// auth (Jira Cloud API tokens); otherwise the token is sent as a bearer
+// personal access token (Jira Server/Data Center).
+func New(cfg config.JiraConfig) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("jira: jira.url is required")
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("jira: jira.token is required")
+	}
+
+	return &Client{
+		baseURL: strings.TrimRight(cfg.URL, "/"),
+		user:    cfg.User,
+		token:   cfg.Token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// IssueStatus returns the workflow status name of an issue
+func (c *Client) IssueStatus(ctx context.Context, key string) (string, error) {
+	var issue struct {
+		Fields struct {
+			Status struct {
+				Name string `json:"name"`
+			} `json:"status"`
+		} `json:"fields"`
+	}
+	path := "/rest/api/2/issue/" + url.PathEscape(key) + "?fields=status"
+	if err := c.do(ctx, http.MethodGet, path, nil, &issue); err != nil {
+		return "", err
+	}
+	return issue.Fields.Status.Name, nil
+}
+
+// AddComment posts a comment on an issue
+func (c *Client) AddComment(ctx context.Context, key, body string) error {
+	path := "/rest/api/2/issue/" + url.PathEscape(key) + "/comment"
+	return c.do(ctx, http.MethodPost, path, map[string]string{"body": body}, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("jira: failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("jira: failed to build request: %w", err)
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("jira: %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("jira: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("jira: failed to decode response: %w", err)
+	}
+	return nil
+}
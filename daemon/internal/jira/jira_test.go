@@ -0,0 +1,101 @@
+package jira_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/jira"
+)
+
+func TestSyncCommentsAndRecordsStatus(t *testing.T) {
+	comments := 0
+	status := "To Do"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/issue/QA-12", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bot" || pass != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"fields":{"status":{"name":"` + status + `"}}}`))
+	})
+	mux.HandleFunc("/rest/api/2/issue/QA-12/comment", func(w http.ResponseWriter, r *http.Request) {
+		comments++
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := jira.New(config.JiraConfig{URL: server.URL, User: "bot", Token: "token"})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	store, err := db.Open(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	tanda := &db.Tanda{
+		ID: "td-1", Title: "Login", Status: "flaky",
+		ExternalRefs: []string{"QA-12", "https://example.com/not-a-key"},
+		CreatedAt:    now, UpdatedAt: now,
+	}
+	if err := store.UpsertTanda(tanda); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	ctx := context.Background()
+	result, err := jira.Sync(ctx, store, client)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if comments != 1 || len(result.Updated) != 1 {
+		t.Fatalf("expected one comment and one update, got %d comments, %+v", comments, result)
+	}
+
+	// Nothing changed on either side: no new comment, no new note
+	result, err = jira.Sync(ctx, store, client)
+	if err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if comments != 1 || len(result.Updated) != 0 {
+		t.Fatalf("expected idempotent sync, got %d comments, %+v", comments, result)
+	}
+
+	status = "Done"
+	if _, err := jira.Sync(ctx, store, client); err != nil {
+		t.Fatalf("third sync: %v", err)
+	}
+	got, err := store.GetTanda("td-1")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	last := got.Notes[len(got.Notes)-1]
+	if last.Type != jira.NoteType || last.Text != "QA-12 status: Done" {
+		t.Fatalf("unexpected status note: %+v", last)
+	}
+}
+
+func TestIsKey(t *testing.T) {
+	for ref, want := range map[string]bool{
+		"JIRA-123":   true,
+		"QA2-7":      true,
+		"jira-123":   false,
+		"#42":        false,
+		"JIRA-":      false,
+		"https://x/": false,
+	} {
+		if got := jira.IsKey(ref); got != want {
+			t.Errorf("IsKey(%q) = %v, want %v", ref, got, want)
+		}
+	}
+}
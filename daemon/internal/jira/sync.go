@@ -0,0 +1,96 @@
+package jira
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// SyncResult lists what Sync changed on each side
+type SyncResult struct {
+	Commented []string `json:"commented"`
+	Updated   []string `json:"updated"`
+}
+
+// Sync pushes each linked tanda's status and flakiness to its Jira tickets
+// as a comment (only when the summary changed since the last push) and
+// records ticket status changes back onto the tanda as notes. Tandas in
+// Updated were modified and need exporting to JSONL.
+func Sync(ctx context.Context, store *db.Store, c *Client) (*SyncResult, error) {
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tandas: %w", err)
+	}
+
+	result := &SyncResult{Commented: []string{}, Updated: []string{}}
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	for _, t := range tandas {
+		changed := false
+		summary := Summary(t)
+
+		for _, key := range t.ExternalRefs {
+			if !IsKey(key) {
+				continue
+			}
+
+			pushed, err := store.GetSyncedSummary(t.ID, key)
+			if err != nil {
+				return result, err
+			}
+			if pushed != summary {
+				if err := c.AddComment(ctx, key, summary); err != nil {
+					return result, err
+				}
+				if err := store.SaveSyncedSummary(t.ID, key, summary); err != nil {
+					return result, err
+				}
+				result.Commented = append(result.Commented, key)
+			}
+
+			status, err := c.IssueStatus(ctx, key)
+			if err != nil {
+				return result, err
+			}
+			if text := key + " status: " + status; lastStatusNote(t, key) != text {
+				t.Notes = append(t.Notes, db.Note{Timestamp: now, Type: NoteType, Text: text})
+				changed = true
+			}
+		}
+
+		if changed {
+			t.UpdatedAt = now
+			if err := store.UpsertTanda(t); err != nil {
+				return result, fmt.Errorf("failed to update tanda %s: %w", t.ID, err)
+			}
+			result.Updated = append(result.Updated, t.ID)
+		}
+	}
+
+	return result, nil
+}
+
+// Summary renders the status line pushed to linked tickets
+func Summary(t *db.Tanda) string {
+	line := fmt.Sprintf("Tanda %s (%s): status %s, flakiness %.0f%%",
+		t.ID, t.Title, t.Status, t.Flakiness()*100)
+	if n := len(t.RunHistory); n > 0 {
+		last := t.RunHistory[n-1]
+		line += fmt.Sprintf(", last run %s at %s", last.Result, last.Timestamp)
+	}
+	return line
+}
+
+func lastStatusNote(t *db.Tanda, key string) string {
+	prefix := key + " status: "
+	for i := len(t.Notes) - 1; i >= 0; i-- {
+		n := t.Notes[i]
+		if n.Type == NoteType && strings.HasPrefix(n.Text, prefix) {
+			return n.Text
+		}
+	}
+	return ""
+}
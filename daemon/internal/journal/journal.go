@@ -0,0 +1,213 @@
+// Package journal records registry writes before they are applied, so a
+// daemon that crashes part way through one can finish it on the next start
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// FileName is the journal's name inside the .tandas directory
+const FileName = "journal.jsonl"
+
+// Op is the kind of write an entry records
+type Op string
+
+const (
+	// Import reloads the registry from issues.jsonl
+	Import Op = "import"
+	// Write stores the entry's tandas, for a push, create or run record
+	Write Op = "write"
+)
+
+// Entry is one line of the journal: an operation begun, or the end of the
+// operation numbered Seq
+type Entry struct {
+	Seq    int64       `json:"seq"`
+	Op     Op          `json:"op,omitempty"`
+	At     string      `json:"at,omitempty"`
+	Tandas []*db.Tanda `json:"tandas,omitempty"`
+	Done   bool        `json:"done,omitempty"`
+}
+
+// Journal is an append-only log of operations in flight. Each operation is
+// synced to disk before it is applied and marked done after; the file is
+// emptied whenever nothing is in flight. A nil Journal records nothing.
+type Journal struct {
+	mu      sync.Mutex
+	f       *os.File
+	seq     int64
+	open    int
+	pending []Entry
+}
+
+// Open opens the journal in dir, reading operations a previous process
+// left unfinished
+func Open(dir string) (*Journal, error) {
+	path := filepath.Join(dir, FileName)
+	pending, last, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	return &Journal{f: f, seq: last, open: len(pending), pending: pending}, nil
+}
+
+// read returns the unfinished entries in path and the highest sequence
+// number seen. A torn last line, from a crash mid-write, is ignored: its
+// operation was never applied.
+func read(path string) ([]Entry, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, nil
+		}
+		return nil, 0, fmt.Errorf("failed to read journal: %w", err)
+	}
+	defer f.Close()
+
+	var order []int64
+	begun := make(map[int64]Entry)
+	var last int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, 0, fmt.Errorf("failed to read journal: %w", err)
+		}
+		if len(line) == 0 && err == io.EOF {
+			break
+		}
+		var e Entry
+		if json.Unmarshal(line, &e) != nil {
+			continue
+		}
+		if e.Seq > last {
+			last = e.Seq
+		}
+		if e.Done {
+			delete(begun, e.Seq)
+			continue
+		}
+		begun[e.Seq] = e
+		order = append(order, e.Seq)
+	}
+
+	var pending []Entry
+	for _, seq := range order {
+		if e, ok := begun[seq]; ok {
+			pending = append(pending, e)
+		}
+	}
+	return pending, last, nil
+}
+
+// Pending returns the operations a previous process began but did not
+// finish, oldest first
+func (j *Journal) Pending() []Entry {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.pending
+}
+
+// Begin records an operation and syncs it to disk, returning its sequence
+// number for Done
+func (j *Journal) Begin(op Op, tandas []*db.Tanda) (int64, error) {
+	if j == nil {
+		return 0, nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.seq++
+	e := Entry{Seq: j.seq, Op: op, At: time.Now().UTC().Format(time.RFC3339), Tandas: tandas}
+	if err := j.write(e); err != nil {
+		return 0, err
+	}
+	if err := j.f.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync journal: %w", err)
+	}
+	j.open++
+	return e.Seq, nil
+}
+
+// Done marks an operation finished, emptying the journal when nothing else
+// is in flight
+func (j *Journal) Done(seq int64) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.open--
+	if j.open <= 0 {
+		return j.truncate()
+	}
+	return j.write(Entry{Seq: seq, Done: true})
+}
+
+// Resolve drops the operations left by a previous process once they have
+// been recovered
+func (j *Journal) Resolve() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.open -= len(j.pending)
+	for _, e := range j.pending {
+		if j.open > 0 {
+			if err := j.write(Entry{Seq: e.Seq, Done: true}); err != nil {
+				return err
+			}
+		}
+	}
+	j.pending = nil
+	if j.open <= 0 {
+		return j.truncate()
+	}
+	return nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.f.Close()
+}
+
+func (j *Journal) write(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %w", err)
+	}
+	if _, err := j.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+func (j *Journal) truncate() error {
+	j.open = 0
+	if err := j.f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to empty journal: %w", err)
+	}
+	return nil
+}
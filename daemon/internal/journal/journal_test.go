@@ -0,0 +1,79 @@
+package journal_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/journal"
+)
+
+func TestPendingAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	j, err := journal.Open(dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	done, err := j.Begin(journal.Import, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := j.Begin(journal.Write, []*db.Tanda{{ID: "td-1", Title: "Login"}}); err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := j.Done(done); err != nil {
+		t.Fatalf("done: %v", err)
+	}
+	// The process dies mid-write of a third entry
+	j.Close()
+	f, _ := os.OpenFile(filepath.Join(dir, journal.FileName), os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"seq":3,"op":"wri`)
+	f.Close()
+
+	j, err = journal.Open(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer j.Close()
+	pending := j.Pending()
+	if len(pending) != 1 || pending[0].Op != journal.Write || pending[0].Tandas[0].ID != "td-1" {
+		t.Fatalf("expected the unfinished write pending, got %+v", pending)
+	}
+
+	if err := j.Resolve(); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(j.Pending()) != 0 {
+		t.Error("expected nothing pending after resolve")
+	}
+	if info, _ := os.Stat(filepath.Join(dir, journal.FileName)); info.Size() != 0 {
+		t.Errorf("expected an empty journal, got %d bytes", info.Size())
+	}
+}
+
+func TestDoneEmptiesJournal(t *testing.T) {
+	dir := t.TempDir()
+	j, err := journal.Open(dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer j.Close()
+
+	seq, err := j.Begin(journal.Write, []*db.Tanda{{ID: "td-1"}})
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := j.Done(seq); err != nil {
+		t.Fatalf("done: %v", err)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, journal.FileName)); info.Size() != 0 {
+		t.Errorf("expected an empty journal, got %d bytes", info.Size())
+	}
+
+	var nilJournal *journal.Journal
+	if _, err := nilJournal.Begin(journal.Import, nil); err != nil {
+		t.Errorf("nil journal Begin: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Package leaderboard ranks the tandas failing the most, leaving out the
+// ones already acknowledged, marked wontfix or snoozed so the list surfaces
+// new problems instead of the same known offenders
+package leaderboard
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// DefaultLimit is how many tandas the leaderboard lists by default
+const DefaultLimit = 20
+
+// Options bound the runs counted and the tandas listed
+type Options struct {
+	workflow.Filter
+	// Limit is DefaultLimit when zero; a negative limit lists every tanda
+	Limit int `json:"limit,omitempty"`
+	// All keeps acknowledged, wontfix and snoozed tandas on the board
+	All bool `json:"all,omitempty"`
+}
+
+// Entry is a tanda on the leaderboard
+type Entry struct {
+	Rank        int      `json:"rank"`
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Status      string   `json:"status"`
+	Owners      []string `json:"owners,omitempty"`
+	Priority    string   `json:"priority,omitempty"`
+	Triage      string   `json:"triage,omitempty"`
+	Runs        int      `json:"runs"`
+	Failures    int      `json:"failures"`
+	FailureRate float64  `json:"failure_rate"`
+	LastFailure string   `json:"last_failure"`
+	// SnoozedUntil is set for snoozed tandas listed with Options.All
+	SnoozedUntil string `json:"snoozed_until,omitempty"`
+}
+
+// Hidden counts the failing tandas left off the board, each under the
+// first reason that applies
+type Hidden struct {
+	Acknowledged int `json:"acknowledged"`
+	Wontfix      int `json:"wontfix"`
+	Snoozed      int `json:"snoozed"`
+}
+
+// Board is the leaderboard, highest failure rate first
+type Board struct {
+	Entries []Entry `json:"entries"`
+	Hidden  Hidden  `json:"hidden"`
+}
+
+// Build ranks the tandas that failed in the window by failure rate, then
+// failures, then most recent failure. Deprecated and archived tandas are
+// left out.
+func Build(tandas []*db.Tanda, opts Options, now time.Time) *Board {
+	if opts.Limit == 0 {
+		opts.Limit = DefaultLimit
+	}
+	since := db.RunsSince(opts.Days, now)
+
+	board := &Board{Entries: []Entry{}}
+	for _, t := range tandas {
+		if opts.Statuses.IsRetired(t.Status) {
+			continue
+		}
+		e := Entry{ID: t.ID, Title: t.Title, Status: t.Status, Owners: t.Owners, Priority: t.Priority, Triage: t.Triage}
+		for _, r := range t.RunHistory {
+			if r.Result != "pass" && r.Result != "fail" {
+				continue
+			}
+			if !db.InWindow(r, since) {
+				continue
+			}
+			e.Runs++
+			if r.Result == "fail" {
+				e.Failures++
+				e.LastFailure = r.Timestamp
+			}
+		}
+		if e.Failures == 0 {
+			continue
+		}
+		e.FailureRate = float64(e.Failures) / float64(e.Runs)
+
+		hidden := true
+		switch {
+		case t.Triage == db.TriageWontfix:
+			board.Hidden.Wontfix++
+		case t.Triage == db.TriageAcknowledged:
+			board.Hidden.Acknowledged++
+		case t.Snoozed(now):
+			board.Hidden.Snoozed++
+			e.SnoozedUntil = t.SnoozedUntil
+		default:
+			hidden = false
+		}
+		if hidden && !opts.All {
+			continue
+		}
+		board.Entries = append(board.Entries, e)
+	}
+
+	sort.Slice(board.Entries, func(i, j int) bool {
+		a, b := board.Entries[i], board.Entries[j]
+		if a.FailureRate != b.FailureRate {
+			return a.FailureRate > b.FailureRate
+		}
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		if ta, tb := failureTime(a), failureTime(b); !ta.Equal(tb) {
+			return ta.After(tb)
+		}
+		return a.ID < b.ID
+	})
+	if opts.Limit > 0 && len(board.Entries) > opts.Limit {
+		board.Entries = board.Entries[:opts.Limit]
+	}
+	for i := range board.Entries {
+		board.Entries[i].Rank = i + 1
+	}
+	return board
+}
+
+func failureTime(e Entry) time.Time {
+	t, _ := db.ParseTimestamp(e.LastFailure)
+	return t
+}
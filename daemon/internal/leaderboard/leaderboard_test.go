@@ -0,0 +1,65 @@
+package leaderboard_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/leaderboard"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+func runs(results ...string) []db.RunResult {
+	out := make([]db.RunResult, len(results))
+	for i, r := range results {
+		out[i] = db.RunResult{Timestamp: "2025-06-0" + string(rune('1'+i)) + "T10:00:00Z", Result: r}
+	}
+	return out
+}
+
+func ids(b *leaderboard.Board) string {
+	var out []string
+	for _, e := range b.Entries {
+		out = append(out, e.ID)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestBuild(t *testing.T) {
+	now := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+	tandas := []*db.Tanda{
+		{ID: "td-new", Title: "Upload", Status: "flaky", Triage: db.TriageUntriaged, RunHistory: runs("pass", "fail", "fail", "pass")},
+		{ID: "td-known", Title: "Cart", Status: "flaky", Triage: db.TriageAcknowledged, RunHistory: runs("fail", "fail")},
+		{ID: "td-wontfix", Title: "Legacy", Status: "flaky", Triage: db.TriageWontfix, RunHistory: runs("fail")},
+		{ID: "td-snoozed", Title: "Search", Status: "flaky", SnoozedUntil: "2025-06-12T00:00:00Z", RunHistory: runs("fail")},
+		{ID: "td-woke", Title: "Login", Status: "flaky", SnoozedUntil: "2025-06-09T00:00:00Z", RunHistory: runs("pass", "fail", "pass", "pass")},
+		{ID: "td-green", Title: "Home", Status: "active", RunHistory: runs("pass", "pass")},
+		{ID: "td-old", Title: "Export", Status: "deprecated", RunHistory: runs("fail")},
+	}
+
+	b := leaderboard.Build(tandas, leaderboard.Options{}, now)
+	if got := ids(b); got != "td-new,td-woke" {
+		t.Fatalf("leaderboard = %s", got)
+	}
+	if e := b.Entries[0]; e.Rank != 1 || e.Runs != 4 || e.Failures != 2 || e.FailureRate != 0.5 || e.LastFailure != "2025-06-03T10:00:00Z" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if b.Hidden != (leaderboard.Hidden{Acknowledged: 1, Wontfix: 1, Snoozed: 1}) {
+		t.Fatalf("unexpected hidden counts %+v", b.Hidden)
+	}
+
+	all := leaderboard.Build(tandas, leaderboard.Options{All: true, Limit: 3}, now)
+	if got := ids(all); got != "td-known,td-snoozed,td-wontfix" {
+		t.Fatalf("leaderboard with all = %s", got)
+	}
+	if all.Entries[1].SnoozedUntil == "" {
+		t.Error("expected a listed snoozed tanda to say until when")
+	}
+
+	// Only runs from June 3 on count
+	recent := leaderboard.Build(tandas, leaderboard.Options{Filter: workflow.Filter{Days: 7}}, now)
+	if got := ids(recent); got != "td-new" || recent.Entries[0].FailureRate != 0.5 {
+		t.Fatalf("recent leaderboard = %s %+v", got, recent.Entries)
+	}
+}
@@ -0,0 +1,38 @@
+// Package logging configures the process-wide logger from the --log-level
+// and --log-format flags. Packages log through log/slog's default logger.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Log formats
+const (
+	Text = "text"
+	JSON = "json"
+)
+
+// Setup sends slog's default logger to w, dropping records below level
+// (debug, info, warn or error) and writing them as text or json. Records
+// at info or above also go to Recent.
+func Setup(w io.Writer, level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q (want debug, info, warn or error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+
+	var h slog.Handler
+	switch format {
+	case Text:
+		h = slog.NewTextHandler(w, opts)
+	case JSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q (want text or json)", format)
+	}
+	slog.SetDefault(slog.New(teeHandler{h, Recent.Handler(min(l, slog.LevelInfo))}))
+	return nil
+}
@@ -0,0 +1,69 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/logging"
+)
+
+func TestSetup(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	var buf bytes.Buffer
+	if err := logging.Setup(&buf, "warn", logging.JSON); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	slog.Info("Imported", "rows", 3)
+	slog.Warn("Webhook disabled", "err", "bad url")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected only the warning, got %q", buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("expected a JSON record: %v", err)
+	}
+	if record["level"] != "WARN" || record["msg"] != "Webhook disabled" || record["err"] != "bad url" {
+		t.Errorf("unexpected record %v", record)
+	}
+
+	if err := logging.Setup(&buf, "loud", logging.Text); err == nil {
+		t.Error("expected an invalid level to fail")
+	}
+	if err := logging.Setup(&buf, "info", "xml"); err == nil {
+		t.Error("expected an invalid format to fail")
+	}
+}
+
+func TestRing(t *testing.T) {
+	ring := logging.NewRing(3)
+	logger := slog.New(ring.Handler(slog.LevelInfo))
+	logger.Debug("Dropped")
+	logger.Info("Imported", "rows", 3)
+	logger.With("job", "prune").WithGroup("result").Warn("Job slow", "took", 2*time.Second)
+	logger.Error("Sync failed", "err", errors.New("disk full"))
+	logger.Info("Synced")
+
+	all := ring.Records(slog.LevelDebug, 0)
+	if len(all) != 3 || all[0].Message != "Job slow" || all[2].Message != "Synced" {
+		t.Fatalf("expected the last three records oldest first, got %+v", all)
+	}
+	if all[0].Attrs["job"] != "prune" || all[0].Attrs["result.took"] != "2s" {
+		t.Errorf("unexpected attrs %v", all[0].Attrs)
+	}
+	if all[1].Attrs["err"] != "disk full" {
+		t.Errorf("expected the error as text, got %v", all[1].Attrs)
+	}
+
+	warn := ring.Records(slog.LevelWarn, 1)
+	if len(warn) != 1 || warn[0].Message != "Sync failed" {
+		t.Fatalf("expected the newest warning or worse, got %+v", warn)
+	}
+}
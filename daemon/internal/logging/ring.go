@@ -0,0 +1,185 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// RingSize is how many records Recent keeps
+const RingSize = 1000
+
+// Recent keeps the latest records logged through the default logger at
+// info or above, whatever the output level, so the daemon can serve them
+// after the log file is gone
+var Recent = NewRing(RingSize)
+
+// Record is one log record as kept by a Ring
+type Record struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"msg"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// Ring is a slog destination keeping the last size records in memory
+type Ring struct {
+	mu      sync.Mutex
+	records []Record
+	next    int
+	size    int
+}
+
+// NewRing returns a ring keeping size records
+func NewRing(size int) *Ring {
+	return &Ring{size: size}
+}
+
+func (r *Ring) add(rec Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.records) < r.size {
+		r.records = append(r.records, rec)
+		return
+	}
+	r.records[r.next] = rec
+	r.next = (r.next + 1) % r.size
+}
+
+// Records returns up to limit of the newest records at or above min,
+// oldest first. A limit of zero returns them all.
+func (r *Ring) Records(min slog.Level, limit int) []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []Record{}
+	for i := range r.records {
+		rec := r.records[(r.next+i)%len(r.records)]
+		var l slog.Level
+		if l.UnmarshalText([]byte(rec.Level)) == nil && l < min {
+			continue
+		}
+		out = append(out, rec)
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// Handler returns a handler adding records at or above level to r
+func (r *Ring) Handler(level slog.Leveler) slog.Handler {
+	return &ringHandler{ring: r, level: level}
+}
+
+// ringHandler flattens attributes, including those from With and
+// WithGroup, into dotted keys
+type ringHandler struct {
+	ring   *Ring
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string
+}
+
+func (h *ringHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *ringHandler) Handle(_ context.Context, rec slog.Record) error {
+	out := Record{Time: rec.Time, Level: rec.Level.String(), Message: rec.Message}
+	if len(h.attrs) > 0 || rec.NumAttrs() > 0 {
+		out.Attrs = make(map[string]interface{})
+	}
+	for _, a := range h.attrs {
+		addAttr(out.Attrs, "", a)
+	}
+	rec.Attrs(func(a slog.Attr) bool {
+		addAttr(out.Attrs, h.prefix, a)
+		return true
+	})
+	h.ring.add(out)
+	return nil
+}
+
+func (h *ringHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		if h.prefix != "" {
+			a.Key = h.prefix + a.Key
+		}
+		c.attrs = append(c.attrs, a)
+	}
+	return &c
+}
+
+func (h *ringHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix = h.prefix + name + "."
+	return &c
+}
+
+// addAttr stores a under prefix+key, keeping values JSON can encode: errors
+// and other arbitrary values become their text
+func addAttr(m map[string]interface{}, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		for _, g := range v.Group() {
+			addAttr(m, prefix+a.Key+".", g)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	switch v.Kind() {
+	case slog.KindString, slog.KindInt64, slog.KindUint64, slog.KindFloat64, slog.KindBool, slog.KindTime:
+		m[prefix+a.Key] = v.Any()
+	default:
+		m[prefix+a.Key] = v.String()
+	}
+}
+
+// teeHandler sends each record to every handler that wants it
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, rec slog.Record) error {
+	var first error
+	for _, h := range t {
+		if !h.Enabled(ctx, rec.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, rec.Clone()); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
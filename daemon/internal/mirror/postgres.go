@@ -0,0 +1,330 @@
+package mirror
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+)
+
+// Defaults for PostgresConfig
+const (
+	DefaultSchema    = "tandas"
+	DefaultBatchSize = 500
+)
+
+// Statement is one SQL statement with its arguments
+type Statement struct {
+	SQL  string
+	Args []interface{}
+}
+
+// Stats reports what a Sync wrote
+type Stats struct {
+	Tandas  int `json:"tandas"`
+	Runs    int `json:"runs"`
+	Deleted int `json:"deleted"`
+}
+
+// Postgres mirrors one repository's registry into a shared Postgres schema.
+// Rows are keyed by repo so many registries can share the tables.
+type Postgres struct {
+	db     *sql.DB
+	schema string
+	repo   string
+	batch  int
+
+	mu   gosync.Mutex
+	sent map[string][20]byte
+}
+
+// OpenPostgres connects to cfg.DSN and creates the schema if needed
+func OpenPostgres(ctx context.Context, cfg config.PostgresConfig, repo string) (*Postgres, error) {
+	conn, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres: %w", err)
+	}
+	p := &Postgres{db: conn, schema: cfg.Schema, repo: repo, batch: cfg.BatchSize}
+	if p.schema == "" {
+		p.schema = DefaultSchema
+	}
+	if p.batch <= 0 {
+		p.batch = DefaultBatchSize
+	}
+	for _, stmt := range Schema(p.schema) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to create mirror schema: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// Close closes the connection
+func (p *Postgres) Close() error {
+	return p.db.Close()
+}
+
+// Sync upserts the tandas that changed since the last Sync, with their
+// runs, and deletes this repo's rows for tandas no longer in the registry.
+// Everything is written in one transaction.
+func (p *Postgres) Sync(ctx context.Context, tandas []*db.Tanda) (*Stats, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sums := make(map[string][20]byte, len(tandas))
+	var changed []*db.Tanda
+	ids := make([]string, 0, len(tandas))
+	for _, t := range tandas {
+		data, _ := json.Marshal(t)
+		sum := sha1.Sum(data)
+		sums[t.ID] = sum
+		ids = append(ids, t.ID)
+		if prev, ok := p.sent[t.ID]; !ok || prev != sum {
+			changed = append(changed, t)
+		}
+	}
+
+	stats := &Stats{}
+	stmts := UpsertStatements(p.schema, p.repo, changed, p.batch)
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin mirror transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, s := range stmts {
+		if _, err := tx.ExecContext(ctx, s.SQL, s.Args...); err != nil {
+			return nil, fmt.Errorf("failed to mirror tandas: %w", err)
+		}
+	}
+	if p.sent == nil || len(p.sent) != len(sums) || len(changed) > 0 {
+		res, err := tx.ExecContext(ctx, fmt.Sprintf(
+			"DELETE FROM %s.tandas WHERE repo = $1 AND NOT (id = ANY($2))", pq.QuoteIdentifier(p.schema)),
+			p.repo, pq.Array(ids))
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete removed tandas: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		stats.Deleted = int(n)
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+			"DELETE FROM %s.runs WHERE repo = $1 AND NOT (tanda_id = ANY($2))", pq.QuoteIdentifier(p.schema)),
+			p.repo, pq.Array(ids)); err != nil {
+			return nil, fmt.Errorf("failed to delete removed runs: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit mirror transaction: %w", err)
+	}
+
+	p.sent = sums
+	stats.Tandas = len(changed)
+	for _, t := range changed {
+		stats.Runs += len(t.RunHistory)
+	}
+	return stats, nil
+}
+
+// Schema returns the DDL for the mirror tables
+func Schema(schema string) []string {
+	s := pq.QuoteIdentifier(schema)
+	return []string{
+		"CREATE SCHEMA IF NOT EXISTS " + s,
+		`CREATE TABLE IF NOT EXISTS ` + s + `.tandas (
+            repo TEXT NOT NULL,
+            id TEXT NOT NULL,
+            title TEXT NOT NULL,
+            status TEXT NOT NULL,
+            file TEXT,
+            covers JSONB,
+            depends_on JSONB,
+            owners JSONB,
+            external_refs JSONB,
+            refs JSONB,
+            priority TEXT,
+            triage TEXT,
+            flakiness DOUBLE PRECISION NOT NULL,
+            last_run_at TIMESTAMPTZ,
+            last_result TEXT,
+            created_at TIMESTAMPTZ,
+            updated_at TIMESTAMPTZ,
+            mirrored_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            PRIMARY KEY (repo, id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS ` + s + `.runs (
+            repo TEXT NOT NULL,
+            tanda_id TEXT NOT NULL,
+            ts TIMESTAMPTZ NOT NULL,
+            result TEXT NOT NULL,
+            duration_ms BIGINT,
+            error TEXT,
+            trace TEXT,
+            runner TEXT,
+            os TEXT,
+            browser TEXT,
+            shard TEXT,
+            PRIMARY KEY (repo, tanda_id, ts)
+        )`,
+		"CREATE INDEX IF NOT EXISTS runs_ts ON " + s + ".runs (ts)",
+		"CREATE INDEX IF NOT EXISTS tandas_status ON " + s + ".tandas (status)",
+		// Columns added after the first release, for mirrors created before
+		"ALTER TABLE " + s + ".tandas ADD COLUMN IF NOT EXISTS priority TEXT",
+		"ALTER TABLE " + s + ".tandas ADD COLUMN IF NOT EXISTS triage TEXT",
+		"ALTER TABLE " + s + ".tandas ADD COLUMN IF NOT EXISTS refs JSONB",
+		"ALTER TABLE " + s + ".runs ADD COLUMN IF NOT EXISTS runner TEXT",
+		"ALTER TABLE " + s + ".runs ADD COLUMN IF NOT EXISTS os TEXT",
+		"ALTER TABLE " + s + ".runs ADD COLUMN IF NOT EXISTS browser TEXT",
+		"ALTER TABLE " + s + ".runs ADD COLUMN IF NOT EXISTS shard TEXT",
+	}
+}
+
+var tandaColumns = []string{"repo", "id", "title", "status", "file", "covers", "depends_on", "owners",
+	"external_refs", "refs", "priority", "triage", "flakiness", "last_run_at", "last_result", "created_at", "updated_at"}
+
+var runColumns = []string{"repo", "tanda_id", "ts", "result", "duration_ms", "error", "trace",
+	"runner", "os", "browser", "shard"}
+
+// UpsertStatements builds multi-row upserts for tandas and their runs, at
+// most batch rows per statement. Runs whose timestamp does not parse are
+// skipped.
+func UpsertStatements(schema, repo string, tandas []*db.Tanda, batch int) []Statement {
+	if batch <= 0 {
+		batch = DefaultBatchSize
+	}
+	s := pq.QuoteIdentifier(schema)
+
+	var tandaRows, runRows [][]interface{}
+	for _, t := range tandas {
+		var lastAt interface{}
+		var lastResult interface{}
+		if n := len(t.RunHistory); n > 0 {
+			lastAt = timestamp(t.RunHistory[n-1].Timestamp)
+			lastResult = t.RunHistory[n-1].Result
+		}
+		tandaRows = append(tandaRows, []interface{}{
+			repo, t.ID, t.Title, t.Status, nullString(t.File),
+			jsonb(t.Covers), jsonb(t.DependsOn), jsonb(t.Owners), jsonb(t.ExternalRefs),
+			jsonb(t.Refs), nullString(t.Priority), nullString(t.Triage), t.Flakiness(), lastAt, lastResult, timestamp(t.CreatedAt), timestamp(t.UpdatedAt),
+		})
+		for _, r := range t.RunHistory {
+			ts := timestamp(r.Timestamp)
+			if ts == nil {
+				continue
+			}
+			var ms interface{}
+			if d, ok := db.ParseDuration(r.Duration); ok {
+				ms = d.Milliseconds()
+			}
+			runRows = append(runRows, []interface{}{
+				repo, t.ID, ts, r.Result, ms, nullString(r.Error), nullString(r.Trace),
+				nullString(r.Runner), nullString(r.OS), nullString(r.Browser), nullString(r.Shard),
+			})
+		}
+	}
+
+	var updates []string
+	for _, c := range tandaColumns[2:] {
+		updates = append(updates, c+" = EXCLUDED."+c)
+	}
+	updates = append(updates, "mirrored_at = now()")
+	tandaSuffix := " ON CONFLICT (repo, id) DO UPDATE SET " + strings.Join(updates, ", ")
+	var runUpdates []string
+	for _, c := range runColumns[3:] {
+		runUpdates = append(runUpdates, c+" = EXCLUDED."+c)
+	}
+	runSuffix := " ON CONFLICT (repo, tanda_id, ts) DO UPDATE SET " + strings.Join(runUpdates, ", ")
+
+	var stmts []Statement
+	stmts = append(stmts, batchInsert(s+".tandas", tandaColumns, tandaRows, batch, tandaSuffix)...)
+	stmts = append(stmts, batchInsert(s+".runs", runColumns, dedupeRuns(runRows), batch, runSuffix)...)
+	return stmts
+}
+
+func batchInsert(table string, columns []string, rows [][]interface{}, batch int, suffix string) []Statement {
+	var stmts []Statement
+	for start := 0; start < len(rows); start += batch {
+		end := min(start+batch, len(rows))
+		var b strings.Builder
+		fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", table, strings.Join(columns, ", "))
+		var args []interface{}
+		for i, row := range rows[start:end] {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString("(")
+			for j, v := range row {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				args = append(args, v)
+				fmt.Fprintf(&b, "$%d", len(args))
+			}
+			b.WriteString(")")
+		}
+		b.WriteString(suffix)
+		stmts = append(stmts, Statement{SQL: b.String(), Args: args})
+	}
+	return stmts
+}
+
+// dedupeRuns keeps the last run per (tanda, ts); Postgres rejects an upsert
+// that touches the same row twice
+func dedupeRuns(rows [][]interface{}) [][]interface{} {
+	index := make(map[string]int, len(rows))
+	var out [][]interface{}
+	for _, row := range rows {
+		key := fmt.Sprint(row[1], row[2])
+		if i, ok := index[key]; ok {
+			out[i] = row
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, row)
+	}
+	return out
+}
+
+func timestamp(s string) interface{} {
+	t, ok := db.ParseTimestamp(s)
+	if !ok {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func jsonb[T any](v []T) interface{} {
+	if v == nil {
+		v = []T{}
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// RepoName returns the repo key for a .tandas dir: the configured name, or
+// the name of the project directory that contains it
+func RepoName(dir string, cfg config.PostgresConfig) string {
+	if cfg.Repo != "" {
+		return cfg.Repo
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	return filepath.Base(filepath.Dir(abs))
+}
@@ -0,0 +1,44 @@
+package mirror_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/mirror"
+)
+
+func TestUpsertStatements(t *testing.T) {
+	tandas := []*db.Tanda{
+		{ID: "td-1", Title: "Login", Status: "active", CreatedAt: "2025-06-01T10:00:00Z", UpdatedAt: "2025-06-01T10:00:00Z",
+			RunHistory: []db.RunResult{
+				{Timestamp: "2025-06-01T10:00:00Z", Result: "fail", Duration: "1.5s"},
+				{Timestamp: "2025-06-01T10:00:00Z", Result: "pass"},
+				{Timestamp: "not a time", Result: "pass"},
+			}},
+		{ID: "td-2", Title: "Search", Status: "flaky"},
+		{ID: "td-3", Title: "Export", Status: "active"},
+	}
+
+	stmts := mirror.UpsertStatements("ci data", "app", tandas, 2)
+	if len(stmts) != 3 {
+		t.Fatalf("expected 2 tanda batches and 1 run batch, got %d", len(stmts))
+	}
+	if !strings.HasPrefix(stmts[0].SQL, `INSERT INTO "ci data".tandas (repo, id, title`) ||
+		!strings.Contains(stmts[0].SQL, "($18, $19") || strings.Contains(stmts[0].SQL, "$35") ||
+		!strings.Contains(stmts[0].SQL, "ON CONFLICT (repo, id) DO UPDATE") {
+		t.Fatalf("unexpected tanda statement: %s", stmts[0].SQL)
+	}
+	if len(stmts[0].Args) != 34 || stmts[0].Args[0] != "app" || stmts[0].Args[5] != "[]" {
+		t.Fatalf("unexpected tanda args: %v", stmts[0].Args)
+	}
+
+	// Unparseable and duplicate timestamps collapse to a single run row
+	runs := stmts[2]
+	if !strings.HasPrefix(runs.SQL, `INSERT INTO "ci data".runs`) || len(runs.Args) != 11 {
+		t.Fatalf("unexpected run statement: %s %v", runs.SQL, runs.Args)
+	}
+	if runs.Args[3] != "pass" || runs.Args[4] != nil {
+		t.Fatalf("expected the last run at a timestamp to win, got %v", runs.Args)
+	}
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"sync"
+	"time"
+)
+
+// limiter allows at most max sends within any sliding window
+type limiter struct {
+	mu     sync.Mutex
+	max    int
+	window time.Duration
+	sent   []time.Time
+}
+
+func newLimiter(max int, window time.Duration) *limiter {
+	return &limiter{max: max, window: window}
+}
+
+// Allow records a send at now and reports whether it is within the limit.
+// A non-positive max disables limiting.
+func (l *limiter) Allow(now time.Time) bool {
+	if l.max <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-l.window)
+	kept := l.sent[:0]
+	for _, ts := range l.sent {
+		if ts.After(cutoff) {
+			kept = append(kept, ts)
+		}
+	}
+	l.sent = kept
+
+	if len(l.sent) >= l.max {
+		return false
+	}
+	l.sent = append(l.sent, now)
+	return true
+}
@@ -0,0 +1,117 @@
+package notify_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/events"
+	"github.com/tandas/daemon/internal/notify"
+)
+
+func TestSlackConditionsTemplatesAndRateLimit(t *testing.T) {
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- body["text"]
+	}))
+	defer server.Close()
+
+	cfg := config.Default().Notify.Slack
+	cfg.WebhookURL = server.URL
+	cfg.MaxPerHour = 2
+	cfg.Templates = map[string]string{"quarantine": "quarantined {{.TandaID}}"}
+
+	slack, err := notify.NewSlack(cfg)
+	if err != nil {
+		t.Fatalf("new slack: %v", err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go slack.Run(done)
+
+	// Pass rate stays above the threshold: no message
+	slack.Handle(events.Event{Type: events.PassRateChanged,
+		Data: map[string]interface{}{"previous": 1.0, "current": 0.98}})
+	slack.Handle(events.Event{Type: events.Quarantined, TandaID: "td-1"})
+	slack.Handle(events.Event{Type: events.PassRateChanged,
+		Data: map[string]interface{}{"previous": 0.98, "current": 0.9}})
+	// Over the limit of 2 per hour
+	slack.Handle(events.Event{Type: events.Quarantined, TandaID: "td-2"})
+
+	want := []string{
+		"quarantined td-1",
+		":chart_with_downwards_trend: Suite pass rate dropped to 90.0% (was 98.0%)",
+	}
+	for _, w := range want {
+		select {
+		case got := <-received:
+			if got != w {
+				t.Fatalf("expected %q, got %q", w, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+
+	select {
+	case got := <-received:
+		t.Fatalf("expected rate-limited message to be dropped, got %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSlackRejectsUnknownCondition(t *testing.T) {
+	cfg := config.Default().Notify.Slack
+	cfg.WebhookURL = "http://localhost"
+	cfg.On = []string{"sunrise"}
+	if _, err := notify.NewSlack(cfg); err == nil {
+		t.Fatalf("expected error for unknown condition")
+	}
+}
+
+func TestSlackRoutesByOwner(t *testing.T) {
+	received := make(chan string, 10)
+	hook := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			received <- name + ": " + body["text"]
+		}))
+	}
+	shared, checkout := hook("shared"), hook("checkout")
+	defer shared.Close()
+	defer checkout.Close()
+
+	cfg := config.Default().Notify.Slack
+	cfg.WebhookURL = shared.URL
+	cfg.Routes = map[string]string{"@org/checkout": checkout.URL}
+	cfg.Templates = map[string]string{"quarantine": "quarantined {{.TandaID}}"}
+	slack, err := notify.NewSlack(cfg)
+	if err != nil {
+		t.Fatalf("new slack: %v", err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go slack.Run(done)
+
+	slack.Handle(events.Event{Type: events.Quarantined, TandaID: "td-1",
+		Data: map[string]interface{}{"owners": []string{"@alice", "@org/checkout"}}})
+	slack.Handle(events.Event{Type: events.Quarantined, TandaID: "td-2",
+		Data: map[string]interface{}{"owners": []string{"@bob"}}})
+
+	for _, want := range []string{"checkout: quarantined td-1", "shared: quarantined td-2"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("expected %q, got %q", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/events"
+)
+
+// Conditions a Slack notifier can be configured to post on
+const (
+	CondQuarantine   = "quarantine"
+	CondPassRate     = "pass_rate"
+	CondImportErrors = "import_errors"
+	CondSLO          = "slo"
+	CondDuration     = "duration"
+)
+
+var defaultTemplates = map[string]string{
+	CondQuarantine:   `:warning: *{{.TandaID}}* ({{index .Data "title"}}) was quarantined (status: {{index .Data "status"}})`,
+	CondPassRate:     `:chart_with_downwards_trend: Suite pass rate dropped to {{percent (index .Data "current")}} (was {{percent (index .Data "previous")}})`,
+	CondImportErrors: `:x: issues.jsonl import reported {{len (index .Data "errors")}} error(s); first: {{index (index .Data "errors") 0}}`,
+	CondSLO:          `:rotating_light: SLO *{{index .Data "name"}}* breached: {{index .Data "metric"}} is {{index .Data "value"}}`,
+	CondDuration:     `:snail: *{{.TandaID}}* ({{index .Data "title"}}) took {{index .Data "duration"}}, {{index .Data "ratio"}}x its baseline of {{index .Data "baseline"}}`,
+}
+
+var templateFuncs = template.FuncMap{
+	"percent": func(v interface{}) string {
+		f, _ := v.(float64)
+		return fmt.Sprintf("%.1f%%", f*100)
+	},
+}
+
+// Slack posts registry events to an incoming webhook, or to the webhooks
+// routed to the owners of the tanda an event is about
+type Slack struct {
+	webhookURL    string
+	routes        map[string]string
+	on            map[string]bool
+	passRateBelow float64
+	templates     map[string]*template.Template
+	owners        []string
+	limiter       *limiter
+	client        *http.Client
+	queue         chan message
+}
+
+// message is a rendered notification and the webhook it goes to
+type message struct {
+	url  string
+	text string
+}
+
+// NewSlack builds a notifier from config, compiling message templates
+func NewSlack(cfg config.SlackConfig) (*Slack, error) {
+	if cfg.WebhookURL == "" && len(cfg.Routes) == 0 {
+		return nil, fmt.Errorf("slack: notify.slack.webhook_url or routes is required")
+	}
+	for owner, url := range cfg.Routes {
+		if url == "" {
+			return nil, fmt.Errorf("slack: route for %s has no webhook", owner)
+		}
+	}
+
+	s := &Slack{
+		webhookURL:    cfg.WebhookURL,
+		routes:        cfg.Routes,
+		on:            make(map[string]bool),
+		passRateBelow: cfg.PassRateBelow,
+		templates:     make(map[string]*template.Template),
+		owners:        cfg.Owners,
+		limiter:       newLimiter(cfg.MaxPerHour, time.Hour),
+		client:        &http.Client{Timeout: 10 * time.Second},
+		queue:         make(chan message, 100),
+	}
+
+	for _, cond := range cfg.On {
+		if _, ok := defaultTemplates[cond]; !ok {
+			return nil, fmt.Errorf("slack: unknown condition %q", cond)
+		}
+		s.on[cond] = true
+	}
+
+	for cond, text := range defaultTemplates {
+		if custom, ok := cfg.Templates[cond]; ok {
+			text = custom
+		}
+		tmpl, err := template.New(cond).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("slack: invalid %s template: %w", cond, err)
+		}
+		s.templates[cond] = tmpl
+	}
+
+	return s, nil
+}
+
+// Handle renders matching events and queues them for delivery. It never
+// blocks; messages beyond the rate limit or a full queue are dropped.
+func (s *Slack) Handle(e events.Event) {
+	cond := s.condition(e)
+	if cond == "" || !s.on[cond] || !e.MatchesOwners(s.owners) {
+		return
+	}
+	urls := s.targets(e)
+	if len(urls) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := s.templates[cond].Execute(&buf, e); err != nil {
+		slog.Error("Slack template failed", "condition", cond, "err", err)
+		return
+	}
+
+	if !s.limiter.Allow(time.Now()) {
+		slog.Warn("Slack rate limit reached, dropping notification", "condition", cond)
+		return
+	}
+
+	for _, url := range urls {
+		select {
+		case s.queue <- message{url: url, text: buf.String()}:
+		default:
+			slog.Warn("Slack queue full, dropping notification", "condition", cond)
+		}
+	}
+}
+
+// targets returns the webhooks routed to the event's owners, once each,
+// or the default webhook when none of them has a route
+func (s *Slack) targets(e events.Event) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, o := range e.Owners() {
+		if url, ok := s.routes[o]; ok && !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+	if len(urls) == 0 && s.webhookURL != "" {
+		urls = append(urls, s.webhookURL)
+	}
+	return urls
+}
+
+// Run delivers queued messages until done is closed
+func (s *Slack) Run(done <-chan struct{}) {
+	for {
+		select {
+		case m := <-s.queue:
+			if err := s.post(m.url, m.text); err != nil {
+				slog.Error("Slack notify failed", "err", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func (s *Slack) condition(e events.Event) string {
+	switch e.Type {
+	case events.Quarantined:
+		return CondQuarantine
+	case events.ImportErrors:
+		return CondImportErrors
+	case events.SLOBreached:
+		return CondSLO
+	case events.DurationAnomaly:
+		return CondDuration
+	case events.PassRateChanged:
+		prev, _ := e.Data["previous"].(float64)
+		cur, _ := e.Data["current"].(float64)
+		if prev >= s.passRateBelow && cur < s.passRateBelow {
+			return CondPassRate
+		}
+	}
+	return ""
+}
+
+func (s *Slack) post(url, text string) error {
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", strings.TrimSpace(resp.Status))
+	}
+	return nil
+}
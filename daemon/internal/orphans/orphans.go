@@ -0,0 +1,147 @@
+// Package orphans finds tanda file and covers paths that no longer exist
+// in the working tree
+package orphans
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/paths"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// renameWindow bounds how many commits are searched for renames
+const renameWindow = 2000
+
+// Fields a missing path was found in
+const (
+	File   = "file"
+	Covers = "covers"
+)
+
+// Finding is one path a tanda references that does not exist
+type Finding struct {
+	TandaID string `json:"tanda_id"`
+	Title   string `json:"title"`
+	Field   string `json:"field"`
+	Path    string `json:"path"`
+	// RenamedTo is where git last moved the path, when it still exists
+	RenamedTo string `json:"renamed_to,omitempty"`
+}
+
+// Detect reports missing file and covers paths under root, skipping the
+// tandas statuses retires (deprecated and archived when nil). Covers
+// entries count only when they look like paths, so feature names such as
+// "auth" are left alone. With renames, git history is searched for where
+// each missing path moved.
+func Detect(tandas []*db.Tanda, root string, statuses *workflow.Workflow, renames bool) ([]Finding, error) {
+	findings := []Finding{}
+	for _, t := range tandas {
+		if statuses.IsRetired(t.Status) {
+			continue
+		}
+		if t.File != "" && missing(root, t.File) {
+			findings = append(findings, Finding{TandaID: t.ID, Title: t.Title, Field: File, Path: t.File})
+		}
+		for _, c := range t.Covers {
+			if paths.IsPath(c) && missing(root, c) {
+				findings = append(findings, Finding{TandaID: t.ID, Title: t.Title, Field: Covers, Path: c})
+			}
+		}
+	}
+	if len(findings) == 0 || !renames {
+		return findings, nil
+	}
+
+	moved, err := GitRenames(root)
+	if err != nil {
+		return nil, err
+	}
+	for i := range findings {
+		if to := follow(moved, findings[i].Path); to != "" && !missing(root, to) {
+			findings[i].RenamedTo = to
+		}
+	}
+	return findings, nil
+}
+
+func missing(root, p string) bool {
+	_, err := os.Stat(filepath.Join(root, filepath.FromSlash(p)))
+	return os.IsNotExist(err)
+}
+
+// GitRenames maps each renamed path to its newer name, most recent rename
+// first, from the last renameWindow commits under root
+func GitRenames(root string) (map[string]string, error) {
+	// --relative keeps paths relative to root when it is below the
+	// repository's top level
+	cmd := exec.Command("git", "log", "-M", "--relative", "--diff-filter=R", "--name-status", "--format=",
+		fmt.Sprintf("--max-count=%d", renameWindow))
+	cmd.Dir = root
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read renames from git: %w", err)
+	}
+
+	moved := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// R095<TAB>old<TAB>new
+		parts := strings.Split(scanner.Text(), "\t")
+		if len(parts) != 3 || !strings.HasPrefix(parts[0], "R") {
+			continue
+		}
+		if _, ok := moved[parts[1]]; !ok {
+			moved[parts[1]] = parts[2]
+		}
+	}
+	return moved, nil
+}
+
+// follow resolves a path through successive renames. A directory follows
+// the renames of the files under it when they agree on a new directory.
+func follow(moved map[string]string, p string) string {
+	if to, ok := moved[p]; ok {
+		seen := map[string]bool{p: true}
+		for {
+			next, more := moved[to]
+			if !more || seen[to] {
+				return to
+			}
+			seen[to] = true
+			to = next
+		}
+	}
+
+	dirs := map[string]int{}
+	prefix := strings.TrimSuffix(p, "/") + "/"
+	for from, to := range moved {
+		rest, under := strings.CutPrefix(from, prefix)
+		if !under || !strings.HasSuffix(to, "/"+rest) {
+			continue
+		}
+		dirs[path.Clean(strings.TrimSuffix(to, rest))]++
+	}
+	if len(dirs) == 0 {
+		return ""
+	}
+	candidates := make([]string, 0, len(dirs))
+	for d := range dirs {
+		candidates = append(candidates, d)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if dirs[candidates[i]] != dirs[candidates[j]] {
+			return dirs[candidates[i]] > dirs[candidates[j]]
+		}
+		return candidates[i] < candidates[j]
+	})
+	return candidates[0]
+}
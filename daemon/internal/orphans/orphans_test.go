@@ -0,0 +1,68 @@
+package orphans_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/orphans"
+)
+
+func TestDetect(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	root := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		cmd.Dir = root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	write := func(p, body string) {
+		full := filepath.Join(root, p)
+		os.MkdirAll(filepath.Dir(full), 0o755)
+		if err := os.WriteFile(full, []byte(body), 0o644); err != nil {
+			t.Fatalf("write %s: %v", p, err)
+		}
+	}
+
+	git("init", "-q")
+	write("tests/login.spec.ts", "test('login', () => { expect(1).toBe(1) })\n")
+	write("src/auth/session.go", "package auth\n\nfunc Session() string { return \"session\" }\n")
+	write("src/auth/token.go", "package auth\n\nfunc Token() string { return \"token\" }\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	os.MkdirAll(filepath.Join(root, "e2e"), 0o755)
+	os.MkdirAll(filepath.Join(root, "internal"), 0o755)
+	git("mv", "tests/login.spec.ts", "e2e/login.spec.ts")
+	git("mv", "src/auth", "internal/auth")
+	git("commit", "-q", "-m", "move")
+
+	tandas := []*db.Tanda{
+		{ID: "td-1", Title: "Login", Status: "active", File: "tests/login.spec.ts",
+			Covers: []string{"auth", "src/auth", "internal/auth/token.go", "src/gone.go"}},
+		{ID: "td-2", Title: "Old", Status: "deprecated", File: "tests/old.spec.ts"},
+	}
+	findings, err := orphans.Detect(tandas, root, nil, true)
+	if err != nil {
+		t.Fatalf("detect: %v", err)
+	}
+
+	want := []orphans.Finding{
+		{TandaID: "td-1", Title: "Login", Field: orphans.File, Path: "tests/login.spec.ts", RenamedTo: "e2e/login.spec.ts"},
+		{TandaID: "td-1", Title: "Login", Field: orphans.Covers, Path: "src/auth", RenamedTo: "internal/auth"},
+		{TandaID: "td-1", Title: "Login", Field: orphans.Covers, Path: "src/gone.go"},
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("expected %d findings, got %+v", len(want), findings)
+	}
+	for i, w := range want {
+		if findings[i] != w {
+			t.Errorf("finding %d = %+v, want %+v", i, findings[i], w)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package owners
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// codeownersLocations are checked in the order GitHub and GitLab use
+var codeownersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+type rule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// Codeowners is a parsed CODEOWNERS file; the last matching rule wins
+type Codeowners struct {
+	rules []rule
+}
+
+// LoadCodeowners reads the first CODEOWNERS file found under root. It
+// returns an empty ruleset when the project has none.
+func LoadCodeowners(root string) (*Codeowners, error) {
+	for _, loc := range codeownersLocations {
+		file, err := os.Open(filepath.Join(root, loc))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to open %s: %w", loc, err)
+		}
+		defer file.Close()
+		return parseCodeowners(bufio.NewScanner(file))
+	}
+	return &Codeowners{}, nil
+}
+
+// ParseCodeowners parses CODEOWNERS content
+func ParseCodeowners(content string) (*Codeowners, error) {
+	return parseCodeowners(bufio.NewScanner(strings.NewReader(content)))
+}
+
+func parseCodeowners(scanner *bufio.Scanner) (*Codeowners, error) {
+	c := &Codeowners{}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// GitLab section headers ([Section]) carry no pattern
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		re, err := compilePattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid CODEOWNERS pattern %q: %w", fields[0], err)
+		}
+
+		var owners []string
+		for _, f := range fields[1:] {
+			if strings.HasPrefix(f, "#") {
+				break
+			}
+			owners = append(owners, f)
+		}
+		c.rules = append(c.rules, rule{pattern: re, owners: owners})
+	}
+	return c, scanner.Err()
+}
+
+// Owners returns the owners of a slash-separated path relative to the
+// project root, or nil when no rule matches
+func (c *Codeowners) Owners(path string) []string {
+	path = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "./")
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].pattern.MatchString(path) {
+			return c.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// compilePattern translates gitignore-style CODEOWNERS patterns: a leading
+// or inner slash anchors to the root, otherwise the pattern matches at any
+// depth; a match on a directory covers everything beneath it.
+func compilePattern(p string) (*regexp.Regexp, error) {
+	anchored := strings.HasPrefix(p, "/") || strings.Contains(strings.TrimSuffix(p, "/"), "/")
+	p = strings.TrimPrefix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case p[i] == '*':
+			b.WriteString("[^/]*")
+		case p[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(p[i])))
+		}
+	}
+	b.WriteString("(?:/.*)?$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,154 @@
+package owners
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+const (
+	// blameWindow limits blame attribution to recent changes
+	blameWindow = "6.months"
+	// blameShare is the minimum share of recent lines an author needs
+	blameShare = 0.25
+	maxBlame   = 2
+)
+
+// Resolver attributes tandas to owners from CODEOWNERS, falling back to
+// the most active recent authors of the tanda's file
+type Resolver struct {
+	root       string
+	codeowners *Codeowners
+	blame      bool
+}
+
+// NewResolver loads CODEOWNERS from the project root
+func NewResolver(root string, blame bool) (*Resolver, error) {
+	co, err := LoadCodeowners(root)
+	if err != nil {
+		return nil, err
+	}
+	return &Resolver{root: root, codeowners: co, blame: blame}, nil
+}
+
+// Resolve returns the sorted owners for a tanda. Covers entries count only
+// when they name an existing path.
+func (r *Resolver) Resolve(t *db.Tanda) []string {
+	set := make(map[string]bool)
+	paths := []string{}
+	if t.File != "" {
+		paths = append(paths, t.File)
+	}
+	for _, c := range t.Covers {
+		if _, err := os.Stat(filepath.Join(r.root, c)); err == nil {
+			paths = append(paths, c)
+		}
+	}
+
+	for _, p := range paths {
+		for _, o := range r.codeowners.Owners(p) {
+			set[o] = true
+		}
+	}
+
+	if len(set) == 0 && r.blame && t.File != "" {
+		authors, err := BlameAuthors(r.root, t.File)
+		if err != nil {
+			slog.Warn("Blame failed", "file", t.File, "err", err)
+		}
+		for _, a := range authors {
+			set[a] = true
+		}
+	}
+
+	out := make([]string, 0, len(set))
+	for o := range set {
+		out = append(out, o)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// BlameAuthors returns the authors of recent lines in a file that hold at
+// least a quarter of them, by descending share
+func BlameAuthors(root, path string) ([]string, error) {
+	cmd := exec.Command("git", "blame", "--line-porcelain", "-w", "--since="+blameWindow, "--", path)
+	cmd.Dir = root
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	total := 0
+	var author string
+	boundary := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "author-mail "):
+			author = strings.Trim(strings.TrimPrefix(line, "author-mail "), "<>")
+		case line == "boundary":
+			boundary = true
+		case strings.HasPrefix(line, "\t"):
+			// Content line ends a record; boundary lines predate the window
+			if !boundary && author != "" {
+				counts[author]++
+				total++
+			}
+			author, boundary = "", false
+		}
+	}
+
+	authors := make([]string, 0, len(counts))
+	for a, n := range counts {
+		if float64(n)/float64(total) >= blameShare {
+			authors = append(authors, a)
+		}
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		if counts[authors[i]] != counts[authors[j]] {
+			return counts[authors[i]] > counts[authors[j]]
+		}
+		return authors[i] < authors[j]
+	})
+	if len(authors) > maxBlame {
+		authors = authors[:maxBlame]
+	}
+	return authors, scanner.Err()
+}
+
+// Enrich resolves owners for every tanda and stores those that changed,
+// returning their IDs. Tandas nothing resolves for keep their owners.
+func Enrich(store *db.Store, r *Resolver) ([]string, error) {
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tandas: %w", err)
+	}
+
+	updated := []string{}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, t := range tandas {
+		owners := r.Resolve(t)
+		if len(owners) == 0 || strings.Join(owners, ",") == strings.Join(t.Owners, ",") {
+			continue
+		}
+		t.Owners = owners
+		t.UpdatedAt = now
+		if err := store.UpsertTanda(t); err != nil {
+			return updated, fmt.Errorf("failed to update tanda %s: %w", t.ID, err)
+		}
+		updated = append(updated, t.ID)
+	}
+	return updated, nil
+}
@@ -0,0 +1,103 @@
+package owners_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/owners"
+)
+
+func TestCodeownersMatching(t *testing.T) {
+	co, err := owners.ParseCodeowners(`
+# default
+*                       @org/qa
+*.spec.ts               @org/frontend
+/tests/checkout/        @org/payments @alice   # trailing comment
+docs/**/*.md            @org/docs
+[Section]
+build/                  @org/infra
+`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	cases := map[string]string{
+		"README.md":                   "@org/qa",
+		"tests/login.spec.ts":         "@org/frontend",
+		"./web/tests/cart.spec.ts":    "@org/frontend",
+		"tests/checkout/pay.spec.ts":  "@org/payments,@alice",
+		"tests/checkout/nested/x.go":  "@org/payments,@alice",
+		"docs/guide/setup.md":         "@org/docs",
+		"docs/setup.md":               "@org/docs",
+		"app/build/output.txt":        "@org/infra",
+		"other/tests/checkout/pay.go": "@org/qa",
+	}
+	for path, want := range cases {
+		if got := strings.Join(co.Owners(path), ","); got != want {
+			t.Errorf("Owners(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestEnrichUsesCodeowners(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".github", "CODEOWNERS"), "/tests/ @org/qa\n")
+
+	store, err := db.Open(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, tanda := range []*db.Tanda{
+		{ID: "td-1", Title: "Login", Status: "active", File: "tests/login.spec.ts", CreatedAt: now, UpdatedAt: now},
+		{ID: "td-2", Title: "Manual", Status: "active", File: "e2e/x.spec.ts", Owners: []string{"@bob"}, CreatedAt: now, UpdatedAt: now},
+	} {
+		if err := store.UpsertTanda(tanda); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+	}
+
+	resolver, err := owners.NewResolver(root, false)
+	if err != nil {
+		t.Fatalf("resolver: %v", err)
+	}
+	updated, err := owners.Enrich(store, resolver)
+	if err != nil {
+		t.Fatalf("enrich: %v", err)
+	}
+	if strings.Join(updated, ",") != "td-1" {
+		t.Fatalf("expected only td-1 updated, got %v", updated)
+	}
+
+	owned, err := store.QueryTandas(db.Filter{Owner: "@org/qa"})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(owned) != 1 || owned[0].ID != "td-1" {
+		t.Fatalf("expected owner query to find td-1, got %+v", owned)
+	}
+
+	manual, err := store.GetTanda("td-2")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if strings.Join(manual.Owners, ",") != "@bob" {
+		t.Fatalf("expected unresolved tanda to keep its owners, got %v", manual.Owners)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
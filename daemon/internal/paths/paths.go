@@ -0,0 +1,83 @@
+// Package paths spells tanda file and covers paths one canonical way:
+// relative to the project root, cleaned, with forward slashes
+package paths
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// Root returns the project root for a .tandas directory: its parent
+func Root(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(abs), nil
+}
+
+// Normalize rewrites p relative to root when it is an absolute path inside
+// it, converts backslashes to slashes and drops ./ prefixes and redundant
+// separators. Paths outside root stay absolute.
+func Normalize(root, p string) string {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return p
+	}
+	p = strings.ReplaceAll(p, `\`, "/")
+	if root != "" && filepath.IsAbs(filepath.FromSlash(p)) {
+		if rel, err := filepath.Rel(root, filepath.FromSlash(p)); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			p = filepath.ToSlash(rel)
+		}
+	}
+	return path.Clean(p)
+}
+
+// IsPath reports whether a covers entry names a file or directory rather
+// than a feature or requirement: it has a separator or a file extension
+func IsPath(entry string) bool {
+	if strings.ContainsAny(entry, `/\`) {
+		return true
+	}
+	ext := strings.TrimPrefix(filepath.Ext(entry), ".")
+	return ext != "" && strings.IndexFunc(ext, func(r rune) bool {
+		return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+	}) >= 0
+}
+
+// NormalizeTanda normalizes t's file and path-like covers in place,
+// dropping covers that become duplicates, and reports whether anything
+// changed
+func NormalizeTanda(root string, t *db.Tanda) bool {
+	changed := false
+	if t.File != "" {
+		if f := Normalize(root, t.File); f != t.File {
+			t.File, changed = f, true
+		}
+	}
+
+	seen := make(map[string]bool, len(t.Covers))
+	covers := t.Covers[:0:0]
+	for _, c := range t.Covers {
+		n := c
+		if IsPath(c) {
+			n = Normalize(root, c)
+		}
+		if n != c {
+			changed = true
+		}
+		if seen[n] {
+			changed = true
+			continue
+		}
+		seen[n] = true
+		covers = append(covers, n)
+	}
+	if changed {
+		t.Covers = covers
+	}
+	return changed
+}
@@ -0,0 +1,64 @@
+package paths_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/paths"
+)
+
+func TestNormalize(t *testing.T) {
+	root := filepath.FromSlash("/work/app")
+	cases := map[string]string{
+		"tests/login.spec.ts":           "tests/login.spec.ts",
+		"./tests/login.spec.ts":         "tests/login.spec.ts",
+		`tests\e2e\login.spec.ts`:       "tests/e2e/login.spec.ts",
+		"tests//e2e/../login.spec.ts":   "tests/login.spec.ts",
+		"/work/app/tests/login.spec.ts": "tests/login.spec.ts",
+		"/work/application/x.go":        "/work/application/x.go",
+		"/elsewhere/x.go":               "/elsewhere/x.go",
+		" src/auth/ ":                   "src/auth",
+	}
+	for in, want := range cases {
+		if got := paths.Normalize(root, in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeTanda(t *testing.T) {
+	tanda := &db.Tanda{
+		File:   "./tests/login.spec.ts",
+		Covers: []string{"auth", "src/auth/login.go", "./src/auth/login.go", "/work/app/src/auth/session.go", "session-management"},
+	}
+	if !paths.NormalizeTanda("/work/app", tanda) {
+		t.Fatal("expected a change")
+	}
+	if tanda.File != "tests/login.spec.ts" {
+		t.Errorf("file = %q", tanda.File)
+	}
+	want := []string{"auth", "src/auth/login.go", "src/auth/session.go", "session-management"}
+	if !reflect.DeepEqual(tanda.Covers, want) {
+		t.Errorf("covers = %v, want %v", tanda.Covers, want)
+	}
+	if paths.NormalizeTanda("/work/app", tanda) {
+		t.Error("normalized tanda should not change again")
+	}
+}
+
+func TestIsPath(t *testing.T) {
+	for entry, want := range map[string]bool{
+		"login.spec.ts":      true,
+		"src/auth":           true,
+		`src\auth`:           true,
+		"session-management": false,
+		"v1.2":               false,
+		"REQ-12":             false,
+	} {
+		if got := paths.IsPath(entry); got != want {
+			t.Errorf("IsPath(%q) = %v, want %v", entry, got, want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+// StateFile holds the sync points with each peer inside the .tandas dir
+const StateFile = "peers.json"
+
+// Mark is the common sync point with one peer. PulledAsOf is in the
+// peer's clock and PushedAsOf in ours, so clock skew between the two
+// machines never drops a change.
+type Mark struct {
+	PulledAsOf string `json:"pulled_as_of,omitempty"`
+	PushedAsOf string `json:"pushed_as_of,omitempty"`
+}
+
+// State maps peer addresses to their sync points
+type State map[string]Mark
+
+// Load reads the sync points in dir; a missing file means none yet
+func Load(dir string) (State, error) {
+	data, err := os.ReadFile(filepath.Join(dir, StateFile))
+	if os.IsNotExist(err) {
+		return State{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", StateFile, err)
+	}
+	state := State{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", StateFile, err)
+	}
+	return state, nil
+}
+
+// Save writes the sync points to dir, keeping the file out of git since
+// it is specific to this machine
+func (s State) Save(dir string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, StateFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", StateFile, err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, StateFile)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", StateFile, err)
+	}
+	return sync.IgnoreEntry(dir, StateFile)
+}
+
+// ChangedSince returns the tandas updated at or after since; an empty
+// since returns them all. Including the boundary may resend a tanda,
+// which merging makes harmless, but never skips one.
+func ChangedSince(tandas []*db.Tanda, since string) []*db.Tanda {
+	if since == "" {
+		return tandas
+	}
+	cutoff, ok := db.ParseTimestamp(since)
+	if !ok {
+		return tandas
+	}
+	var out []*db.Tanda
+	for _, t := range tandas {
+		updated, ok := db.ParseTimestamp(t.UpdatedAt)
+		if !ok || !updated.Before(cutoff) {
+			out = append(out, t)
+			continue
+		}
+		// Runs are appended without always touching updated_at
+		if n := len(t.RunHistory); n > 0 {
+			if ran, ok := db.ParseTimestamp(t.RunHistory[n-1].Timestamp); ok && !ran.Before(cutoff) {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+// Now formats the current time as a sync point
+func Now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
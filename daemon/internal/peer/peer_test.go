@@ -0,0 +1,49 @@
+package peer_test
+
+import (
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/peer"
+)
+
+func TestChangedSince(t *testing.T) {
+	tandas := []*db.Tanda{
+		{ID: "td-old", UpdatedAt: "2025-06-01T10:00:00Z"},
+		{ID: "td-new", UpdatedAt: "2025-06-03T10:00:00Z"},
+		{ID: "td-ran", UpdatedAt: "2025-06-01T10:00:00Z",
+			RunHistory: []db.RunResult{{Timestamp: "2025-06-02T10:00:00Z", Result: "pass"}}},
+		{ID: "td-boundary", UpdatedAt: "2025-06-02T10:00:00Z"},
+	}
+	got := peer.ChangedSince(tandas, "2025-06-02T10:00:00Z")
+	if len(got) != 3 || got[0].ID != "td-new" || got[1].ID != "td-ran" || got[2].ID != "td-boundary" {
+		t.Fatalf("unexpected delta %v", ids(got))
+	}
+	if all := peer.ChangedSince(tandas, ""); len(all) != 4 {
+		t.Fatalf("expected everything without a sync point, got %v", ids(all))
+	}
+}
+
+func TestState(t *testing.T) {
+	dir := t.TempDir()
+	state, err := peer.Load(dir)
+	if err != nil || len(state) != 0 {
+		t.Fatalf("expected empty state, got %v %v", state, err)
+	}
+	state["alice:7420"] = peer.Mark{PulledAsOf: "2025-06-01T10:00:00Z"}
+	if err := state.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	state, err = peer.Load(dir)
+	if err != nil || state["alice:7420"].PulledAsOf != "2025-06-01T10:00:00Z" {
+		t.Fatalf("state not persisted: %v %v", state, err)
+	}
+}
+
+func ids(tandas []*db.Tanda) []string {
+	var out []string
+	for _, t := range tandas {
+		out = append(out, t.ID)
+	}
+	return out
+}
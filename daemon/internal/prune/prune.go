@@ -0,0 +1,317 @@
+// Package prune trims run history and old notes so the registry does not
+// grow without bound. What it removes is archived to a side file first.
+package prune
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+)
+
+// ArchiveFile holds pruned runs and notes, next to issues.jsonl
+const ArchiveFile = "archive.jsonl"
+
+// Options bound what each tanda keeps; zero fields mean no limit.
+// FailureDays keeps failed runs that recent whatever KeepRuns and KeepDays
+// say, and Downsample keeps a summary per day of the runs pruned.
+type Options struct {
+	KeepRuns    int  `json:"keep_runs"`
+	KeepDays    int  `json:"keep_days"`
+	NoteDays    int  `json:"note_days"`
+	FailureDays int  `json:"failure_days,omitempty"`
+	Downsample  bool `json:"downsample,omitempty"`
+}
+
+// FromConfig reads the limits from the prune config
+func FromConfig(c config.PruneConfig) Options {
+	return Options{KeepRuns: c.KeepRuns, KeepDays: c.KeepDays, NoteDays: c.NoteDays,
+		FailureDays: c.KeepFailuresDays, Downsample: c.Downsample}
+}
+
+// String describes the policy, e.g. "newest 200 runs, runs of the last 180
+// days, failures of the last 365 days, older runs as daily summaries"
+func (o Options) String() string {
+	if o.Empty() {
+		return "no limits"
+	}
+	var parts []string
+	if o.KeepRuns > 0 {
+		parts = append(parts, fmt.Sprintf("newest %d runs", o.KeepRuns))
+	}
+	if o.KeepDays > 0 {
+		parts = append(parts, fmt.Sprintf("runs of the last %d days", o.KeepDays))
+	}
+	if o.FailureDays > 0 {
+		parts = append(parts, fmt.Sprintf("failures of the last %d days", o.FailureDays))
+	}
+	if o.Downsample {
+		parts = append(parts, "older runs as daily summaries")
+	}
+	if o.NoteDays > 0 {
+		parts = append(parts, fmt.Sprintf("notes of the last %d days", o.NoteDays))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Empty reports whether no limit is set
+func (o Options) Empty() bool {
+	return o.KeepRuns <= 0 && o.KeepDays <= 0 && o.NoteDays <= 0
+}
+
+// Entry is one archived run or note
+type Entry struct {
+	TandaID  string        `json:"tanda_id"`
+	PrunedAt string        `json:"pruned_at"`
+	Run      *db.RunResult `json:"run,omitempty"`
+	Note     *db.Note      `json:"note,omitempty"`
+}
+
+// Result counts what a prune removed, or would remove on a dry run.
+// Downsampled counts the removed runs kept in daily summaries.
+type Result struct {
+	Tandas      int  `json:"tandas"`
+	Runs        int  `json:"runs"`
+	Downsampled int  `json:"downsampled,omitempty"`
+	Notes       int  `json:"notes"`
+	DryRun      bool `json:"dry_run"`
+}
+
+// Run prunes every tanda in store, appending what it removes to archive
+// before the store is changed, so a failure never loses history. With
+// dryRun nothing is written. Callers export afterwards.
+func Run(store *db.Store, archive string, opts Options, now time.Time, dryRun bool) (*Result, error) {
+	if opts.Empty() {
+		return nil, fmt.Errorf("no prune limits set (keep_runs, keep_days or note_days)")
+	}
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{DryRun: dryRun}
+	stamp := now.UTC().Format(time.RFC3339)
+	var entries []Entry
+	var changed []*db.Tanda
+	for _, t := range tandas {
+		runs, prunedRuns, downsampled := splitRuns(t.RunHistory, opts, now)
+		notes, prunedNotes := splitNotes(t.Notes, opts, now)
+		if len(prunedRuns)+len(prunedNotes) == 0 {
+			continue
+		}
+		for i := range prunedRuns {
+			entries = append(entries, Entry{TandaID: t.ID, PrunedAt: stamp, Run: &prunedRuns[i]})
+		}
+		for i := range prunedNotes {
+			entries = append(entries, Entry{TandaID: t.ID, PrunedAt: stamp, Note: &prunedNotes[i]})
+		}
+		result.Tandas++
+		result.Runs += len(prunedRuns)
+		result.Downsampled += downsampled
+		result.Notes += len(prunedNotes)
+		t.RunHistory, t.Notes = runs, notes
+		changed = append(changed, t)
+	}
+	if dryRun || len(changed) == 0 {
+		return result, nil
+	}
+
+	if err := appendArchive(archive, entries); err != nil {
+		return nil, err
+	}
+	batch, err := store.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer batch.Rollback()
+	for _, t := range changed {
+		if err := batch.UpsertTanda(t); err != nil {
+			return nil, fmt.Errorf("failed to update tanda %s: %w", t.ID, err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit prune: %w", err)
+	}
+	return result, nil
+}
+
+// splitRuns keeps the newest KeepRuns runs that are under KeepDays old,
+// and the failures under FailureDays old. Runs with unreadable timestamps
+// are only limited by count. Daily summaries are always kept and do not
+// count as runs; with Downsample the pruned runs are added to them, and
+// downsampled says how many were.
+func splitRuns(runs []db.RunResult, opts Options, now time.Time) (kept, pruned []db.RunResult, downsampled int) {
+	raw := 0
+	for _, r := range runs {
+		if r.Summary == nil {
+			raw++
+		}
+	}
+	first := 0
+	if opts.KeepRuns > 0 && raw > opts.KeepRuns {
+		first = raw - opts.KeepRuns
+	}
+
+	kept = []db.RunResult{}
+	i := 0
+	for _, r := range runs {
+		if r.Summary != nil {
+			kept = append(kept, r)
+			continue
+		}
+		old := i < first || expired(r.Timestamp, opts.KeepDays, now)
+		i++
+		if old && r.Result == "fail" && recent(r.Timestamp, opts.FailureDays, now) {
+			old = false
+		}
+		if old {
+			pruned = append(pruned, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	if opts.Downsample && len(pruned) > 0 {
+		kept, downsampled = summarize(kept, pruned)
+	}
+	return kept, pruned, downsampled
+}
+
+// summarize adds the pruned runs to the daily summaries among kept, making
+// one for each new day, and returns the history in order with how many
+// runs were added. Runs with unreadable timestamps are left out.
+func summarize(kept, pruned []db.RunResult) ([]db.RunResult, int) {
+	days := make(map[string]*db.RunResult)
+	var rest []db.RunResult
+	for _, r := range kept {
+		if r.Summary != nil {
+			s := r
+			summary := *r.Summary
+			s.Summary = &summary
+			days[s.Timestamp] = &s
+		} else {
+			rest = append(rest, r)
+		}
+	}
+
+	added := 0
+	type timing struct {
+		total time.Duration
+		runs  time.Duration
+	}
+	timed := make(map[string]timing)
+	for _, r := range pruned {
+		ts, ok := db.ParseTimestamp(r.Timestamp)
+		if !ok {
+			continue
+		}
+		day := ts.UTC().Truncate(24 * time.Hour).Format(time.RFC3339)
+		s := days[day]
+		if s == nil {
+			s = &db.RunResult{Timestamp: day, Summary: &db.RunSummary{}}
+			days[day] = s
+		}
+		s.Summary.Runs++
+		switch r.Result {
+		case "fail":
+			s.Summary.Failures++
+		case "skip":
+			s.Summary.Skips++
+		}
+		if d, ok := db.ParseDuration(r.Duration); ok {
+			t := timed[day]
+			t.total += d
+			t.runs++
+			timed[day] = t
+		}
+		added++
+	}
+
+	summaries := make([]db.RunResult, 0, len(days))
+	for day, s := range days {
+		switch {
+		case s.Summary.Failures > 0:
+			s.Result = "fail"
+		case s.Summary.Skips == s.Summary.Runs:
+			s.Result = "skip"
+		default:
+			s.Result = "pass"
+		}
+		// A new summary's duration is the mean of its timed runs
+		if t := timed[day]; t.runs > 0 && s.Duration == "" {
+			s.Duration = (t.total / t.runs).String()
+		}
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Timestamp < summaries[j].Timestamp })
+
+	// Each summary goes before the first kept run of a later day
+	out := make([]db.RunResult, 0, len(summaries)+len(rest))
+	for _, r := range rest {
+		if ts, ok := db.ParseTimestamp(r.Timestamp); ok {
+			for len(summaries) > 0 {
+				day, _ := db.ParseTimestamp(summaries[0].Timestamp)
+				if day.After(ts) {
+					break
+				}
+				out = append(out, summaries[0])
+				summaries = summaries[1:]
+			}
+		}
+		out = append(out, r)
+	}
+	return append(out, summaries...), added
+}
+
+// splitNotes keeps the notes under NoteDays old
+func splitNotes(notes []db.Note, opts Options, now time.Time) (kept, pruned []db.Note) {
+	kept = []db.Note{}
+	for _, n := range notes {
+		if expired(n.Timestamp, opts.NoteDays, now) {
+			pruned = append(pruned, n)
+		} else {
+			kept = append(kept, n)
+		}
+	}
+	return kept, pruned
+}
+
+// recent reports whether ts is under days old; never when days is zero
+func recent(ts string, days int, now time.Time) bool {
+	if days <= 0 {
+		return false
+	}
+	t, ok := db.ParseTimestamp(ts)
+	return ok && !t.Before(now.AddDate(0, 0, -days))
+}
+
+func expired(ts string, days int, now time.Time) bool {
+	if days <= 0 {
+		return false
+	}
+	t, ok := db.ParseTimestamp(ts)
+	return ok && t.Before(now.AddDate(0, 0, -days))
+}
+
+func appendArchive(path string, entries []Entry) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync archive: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,144 @@
+package prune_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/prune"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	store, err := db.Open(filepath.Join(dir, "db.sqlite"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	store.UpsertTanda(&db.Tanda{ID: "td-1", Title: "Login", Status: "active",
+		RunHistory: []db.RunResult{
+			{Timestamp: "2025-01-01T10:00:00Z", Result: "fail"},
+			{Timestamp: "2025-05-29T10:00:00Z", Result: "pass"},
+			{Timestamp: "2025-05-30T10:00:00Z", Result: "pass"},
+			{Timestamp: "2025-05-31T10:00:00Z", Result: "pass"},
+		},
+		Notes: []db.Note{
+			{Timestamp: "2024-01-01T10:00:00Z", Type: "comment", Text: "old"},
+			{Timestamp: "2025-05-01T10:00:00Z", Type: "comment", Text: "recent"},
+		}})
+	store.UpsertTanda(&db.Tanda{ID: "td-2", Title: "Search", Status: "active",
+		RunHistory: []db.RunResult{{Timestamp: "2025-05-31T10:00:00Z", Result: "pass"}}})
+
+	archive := filepath.Join(dir, prune.ArchiveFile)
+	opts := prune.Options{KeepRuns: 2, KeepDays: 90, NoteDays: 365}
+
+	dry, err := prune.Run(store, archive, opts, now, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if dry.Tandas != 1 || dry.Runs != 2 || dry.Notes != 1 {
+		t.Fatalf("unexpected dry run %+v", dry)
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Fatal("dry run wrote the archive")
+	}
+
+	if _, err := prune.Run(store, archive, opts, now, false); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	got, _ := store.GetTanda("td-1")
+	if len(got.RunHistory) != 2 || got.RunHistory[0].Timestamp != "2025-05-30T10:00:00Z" {
+		t.Errorf("expected the 2 newest runs kept, got %+v", got.RunHistory)
+	}
+	if len(got.Notes) != 1 || got.Notes[0].Text != "recent" {
+		t.Errorf("expected the recent note kept, got %+v", got.Notes)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer f.Close()
+	var runs, notes int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e prune.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.TandaID != "td-1" {
+			t.Fatalf("unexpected archive line %q: %v", scanner.Text(), err)
+		}
+		if e.Run != nil {
+			runs++
+		}
+		if e.Note != nil {
+			notes++
+		}
+	}
+	if runs != 2 || notes != 1 {
+		t.Errorf("expected 2 runs and 1 note archived, got %d and %d", runs, notes)
+	}
+
+	if _, err := prune.Run(store, archive, prune.Options{}, now, false); err == nil {
+		t.Error("expected an error with no limits")
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	store, err := db.Open(filepath.Join(dir, "db.sqlite"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	store.UpsertTanda(&db.Tanda{ID: "td-1", Title: "Login", Status: "active",
+		RunHistory: []db.RunResult{
+			{Timestamp: "2025-03-01T00:00:00Z", Result: "pass", Summary: &db.RunSummary{Runs: 4}},
+			{Timestamp: "2025-04-01T10:00:00Z", Result: "pass", Duration: "2s"},
+			{Timestamp: "2025-04-01T15:00:00Z", Result: "fail", Duration: "4s"},
+			{Timestamp: "2025-05-20T10:00:00Z", Result: "fail"},
+			{Timestamp: "2025-05-30T10:00:00Z", Result: "pass"},
+			{Timestamp: "2025-05-31T10:00:00Z", Result: "pass"},
+		}})
+
+	opts := prune.Options{KeepRuns: 2, FailureDays: 30, Downsample: true}
+	if got := opts.String(); got != "newest 2 runs, failures of the last 30 days, older runs as daily summaries" {
+		t.Errorf("policy = %s", got)
+	}
+	result, err := prune.Run(store, filepath.Join(dir, prune.ArchiveFile), opts, now, false)
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if result.Runs != 2 || result.Downsampled != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// The recent failure stays, the April runs become one summary and the
+	// older summary is kept as it is
+	got, _ := store.GetTanda("td-1")
+	var history []string
+	for _, r := range got.RunHistory {
+		history = append(history, r.Timestamp+" "+r.Result)
+	}
+	want := []string{"2025-03-01T00:00:00Z pass", "2025-04-01T00:00:00Z fail", "2025-05-20T10:00:00Z fail",
+		"2025-05-30T10:00:00Z pass", "2025-05-31T10:00:00Z pass"}
+	if fmt.Sprint(history) != fmt.Sprint(want) {
+		t.Fatalf("history = %v, want %v", history, want)
+	}
+	if s := got.RunHistory[1]; s.Summary == nil || *s.Summary != (db.RunSummary{Runs: 2, Failures: 1}) || s.Duration != "3s" {
+		t.Fatalf("unexpected summary %+v", s)
+	}
+
+	// Summaries do not count against keep_runs
+	again, err := prune.Run(store, filepath.Join(dir, prune.ArchiveFile), opts, now, true)
+	if err != nil || again.Tandas != 0 {
+		t.Fatalf("expected nothing left to prune, got %+v (%v)", again, err)
+	}
+}
@@ -0,0 +1,128 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/tandas/daemon/internal/shell"
+)
+
+// SSHEnv overrides the ssh command, e.g. "ssh -i ~/.ssh/tandas"
+const SSHEnv = "TANDAS_SSH"
+
+// jsonlName is the registry file inside a remote Tandas directory
+const jsonlName = "issues.jsonl"
+
+// Target is a registry reachable over SSH
+type Target struct {
+	User string
+	Host string
+	Port string
+	// Path is the remote issues.jsonl
+	Path string
+}
+
+// Parse parses ssh://[user@]host[:port]/path. The path names the remote
+// Tandas directory, or the JSONL file itself when it ends in .jsonl.
+func Parse(raw string) (*Target, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote %q: %w", raw, err)
+	}
+	if u.Scheme != "ssh" || u.Host == "" {
+		return nil, fmt.Errorf("invalid remote %q: want ssh://host/path", raw)
+	}
+	if u.Path == "" || u.Path == "/" {
+		return nil, fmt.Errorf("invalid remote %q: missing path", raw)
+	}
+
+	t := &Target{Host: u.Hostname(), Port: u.Port(), Path: u.Path}
+	if u.User != nil {
+		t.User = u.User.Username()
+	}
+	// ssh would read either as an option
+	if strings.HasPrefix(t.Host, "-") || strings.HasPrefix(t.User, "-") {
+		return nil, fmt.Errorf("invalid remote %q: user and host must not start with -", raw)
+	}
+	// ssh://host/~/proj/.tandas is relative to the remote home directory
+	if strings.HasPrefix(t.Path, "/~/") {
+		t.Path = strings.TrimPrefix(t.Path, "/~/")
+	}
+	if !strings.HasSuffix(t.Path, ".jsonl") {
+		t.Path = path.Join(t.Path, jsonlName)
+	}
+	return t, nil
+}
+
+// String returns the target in URL form
+func (t *Target) String() string {
+	host := t.Host
+	if t.User != "" {
+		host = t.User + "@" + host
+	}
+	if t.Port != "" {
+		host += ":" + t.Port
+	}
+	p := t.Path
+	if !strings.HasPrefix(p, "/") {
+		p = "/~/" + p
+	}
+	return "ssh://" + host + p
+}
+
+// Fetch returns the remote JSONL, or nil when the remote has none yet
+func (t *Target) Fetch(ctx context.Context) ([]byte, error) {
+	q := shell.Quote(t.Path)
+	out, err := t.run(ctx, nil, fmt.Sprintf("if [ -f %s ]; then cat %s; fi", q, q))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", t, err)
+	}
+	return out, nil
+}
+
+// Upload atomically replaces the remote JSONL, creating its directory
+func (t *Target) Upload(ctx context.Context, data []byte) error {
+	q, tmp := shell.Quote(t.Path), shell.Quote(t.Path+".tmp")
+	cmd := fmt.Sprintf("mkdir -p %s && cat > %s && mv %s %s", shell.Quote(path.Dir(t.Path)), tmp, tmp, q)
+	if _, err := t.run(ctx, data, cmd); err != nil {
+		return fmt.Errorf("failed to upload to %s: %w", t, err)
+	}
+	return nil
+}
+
+func (t *Target) run(ctx context.Context, stdin []byte, command string) ([]byte, error) {
+	sshCmd := strings.Fields(os.Getenv(SSHEnv))
+	if len(sshCmd) == 0 {
+		sshCmd = []string{"ssh"}
+	}
+	args := append([]string{}, sshCmd[1:]...)
+	if t.Port != "" {
+		args = append(args, "-p", t.Port)
+	}
+	dest := t.Host
+	if t.User != "" {
+		dest = t.User + "@" + dest
+	}
+	args = append(args, "--", dest, command)
+
+	cmd := exec.CommandContext(ctx, sshCmd[0], args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
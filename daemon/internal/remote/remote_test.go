@@ -0,0 +1,133 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/remote"
+	syncpkg "github.com/tandas/daemon/internal/sync"
+)
+
+func TestParse(t *testing.T) {
+	cases := map[string]string{
+		"ssh://ci@build.local:2222/srv/app/.tandas": "/srv/app/.tandas/issues.jsonl",
+		"ssh://build.local/~/app/.tandas":           "app/.tandas/issues.jsonl",
+		"ssh://build.local/data/registry.jsonl":     "/data/registry.jsonl",
+	}
+	for raw, want := range cases {
+		target, err := remote.Parse(raw)
+		if err != nil {
+			t.Fatalf("parse %s: %v", raw, err)
+		}
+		if target.Path != want {
+			t.Errorf("%s: path %q, want %q", raw, target.Path, want)
+		}
+	}
+	for _, raw := range []string{"https://host/x", "ssh:///x", "ssh://host",
+		"ssh://-oProxyCommand=touch%20pwned@host/x", "ssh://-oProxyCommand=sh/x"} {
+		if _, err := remote.Parse(raw); err == nil {
+			t.Errorf("expected error for %s", raw)
+		}
+	}
+}
+
+// fakeSSH runs the remote command locally
+func fakeSSH(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "ssh")
+	body := "#!/bin/sh\nwhile [ $# -gt 1 ]; do shift; done\nexec sh -c \"$1\"\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(remote.SSHEnv, script)
+}
+
+func TestSSHArgs(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "ssh")
+	body := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + argsFile + "\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(remote.SSHEnv, script+" -i key")
+
+	target, err := remote.Parse("ssh://ci@build.local:2222/srv/.tandas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The destination follows --, so ssh never reads it as an option
+	args := strings.Split(string(data), "\n")
+	if got := strings.Join(args[:6], " "); got != "-i key -p 2222 -- ci@build.local" {
+		t.Errorf("ssh args = %q", got)
+	}
+}
+
+func TestPushPull(t *testing.T) {
+	fakeSSH(t)
+	ctx := context.Background()
+	target, err := remote.Parse("ssh://server" + filepath.Join(t.TempDir(), "shared", ".tandas"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Machine A pushes its registry to an empty remote
+	dirA := t.TempDir()
+	jsonlA := filepath.Join(dirA, "issues.jsonl")
+	os.WriteFile(jsonlA, []byte(`{"id":"td-1","title":"Login","status":"active","updated_at":"2025-06-01T10:00:00","run_history":[{"ts":"2025-06-01T10:00:00","result":"pass"}]}`+"\n"), 0o644)
+	if pushed, err := remote.Push(ctx, target, jsonlA, false); err != nil || !pushed {
+		t.Fatalf("push: %v, %v", pushed, err)
+	}
+	if pushed, err := remote.Push(ctx, target, jsonlA, false); err != nil || pushed {
+		t.Fatalf("expected unchanged push to be skipped: %v, %v", pushed, err)
+	}
+
+	// Machine B recorded a different run offline
+	store, err := db.Open(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	jsonlB := filepath.Join(t.TempDir(), "issues.jsonl")
+	os.WriteFile(jsonlB, []byte(`{"id":"td-1","title":"Login","status":"flaky","updated_at":"2025-06-02T10:00:00","run_history":[{"ts":"2025-06-02T10:00:00","result":"fail"}]}`+"\n"+
+		`{"id":"td-2","title":"Search","status":"active","updated_at":"2025-06-02T10:00:00"}`+"\n"), 0o644)
+	syncer := syncpkg.New(store, jsonlB)
+	if err := syncer.ImportFromJSONL(); err != nil {
+		t.Fatal(err)
+	}
+
+	var diverged *remote.DivergedError
+	if _, err := remote.Push(ctx, target, jsonlB, false); !errors.As(err, &diverged) {
+		t.Fatalf("expected diverged push to fail, got %v", err)
+	}
+
+	changed, err := remote.Pull(ctx, target, store)
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if len(changed) != 1 || changed[0] != "td-1" {
+		t.Fatalf("expected td-1 to change, got %v", changed)
+	}
+	got, _ := store.GetTanda("td-1")
+	if got.Status != "flaky" || len(got.RunHistory) != 2 || got.RunHistory[0].Result != "pass" {
+		t.Fatalf("expected newer status and both runs, got %+v", got)
+	}
+
+	if err := syncer.ExportToJSONL(); err != nil {
+		t.Fatal(err)
+	}
+	if pushed, err := remote.Push(ctx, target, jsonlB, false); err != nil || !pushed {
+		t.Fatalf("push after pull: %v, %v", pushed, err)
+	}
+}
@@ -0,0 +1,72 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+// DivergedError is returned by Push when the remote holds changes that are
+// not in the local registry
+type DivergedError struct {
+	IDs []string
+}
+
+func (e *DivergedError) Error() string {
+	return fmt.Sprintf("remote has changes to %s not present locally; pull first or push with --force",
+		strings.Join(e.IDs, ", "))
+}
+
+// Pull merges the remote registry into the store and returns the IDs of
+// the tandas that changed locally. Callers export the store afterwards.
+func Pull(ctx context.Context, t *Target, store *db.Store) ([]string, error) {
+	data, err := t.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := sync.ParseJSONL(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("remote %s: %w", t, err)
+	}
+	return sync.MergeInto(store, remote)
+}
+
+// Push uploads the local JSONL unless the remote already has the same
+// content. Without force it refuses to overwrite remote changes.
+func Push(ctx context.Context, t *Target, jsonlPath string, force bool) (bool, error) {
+	local, err := os.ReadFile(jsonlPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read JSONL: %w", err)
+	}
+	remote, err := t.Fetch(ctx)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(local, remote) {
+		return false, nil
+	}
+
+	if !force && len(bytes.TrimSpace(remote)) > 0 {
+		remoteTandas, err := sync.ParseJSONL(bytes.NewReader(remote))
+		if err != nil {
+			return false, fmt.Errorf("remote %s: %w", t, err)
+		}
+		localTandas, err := sync.ParseJSONL(bytes.NewReader(local))
+		if err != nil {
+			return false, err
+		}
+		if _, changed := sync.Merge(localTandas, remoteTandas); len(changed) > 0 {
+			return false, &DivergedError{IDs: changed}
+		}
+	}
+
+	if err := t.Upload(ctx, local); err != nil {
+		return false, err
+	}
+	return true, nil
+}
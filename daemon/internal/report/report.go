@@ -0,0 +1,244 @@
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/events"
+)
+
+// IndexFile is the page written into the output directory
+const IndexFile = "index.html"
+
+const (
+	slowestLimit  = 10
+	failuresLimit = 25
+	// targetShare is the share of suite wall time the optimization targets
+	// add up to
+	targetShare = 0.5
+)
+
+//go:embed report.html.tmpl
+var pageTemplate string
+
+// Entry is a tanda listed in the report
+type Entry struct {
+	ID        string   `json:"id"`
+	Title     string   `json:"title"`
+	Status    string   `json:"status"`
+	Flakiness float64  `json:"flakiness"`
+	Owners    []string `json:"owners,omitempty"`
+	Priority  string   `json:"priority,omitempty"`
+	Triage    string   `json:"triage,omitempty"`
+	Refs      []db.Ref `json:"refs,omitempty"`
+}
+
+// Slow is a tanda's timed runs. Share is its p50 over the sum of every
+// tanda's p50, its part of a suite run's wall time; Target marks the
+// slowest tandas that together make up half of it, where optimizing pays
+// off most.
+type Slow struct {
+	Entry
+	Average time.Duration `json:"average"`
+	P50     time.Duration `json:"p50"`
+	P95     time.Duration `json:"p95"`
+	Share   float64       `json:"share"`
+	Target  bool          `json:"target,omitempty"`
+	Runs    int           `json:"runs"`
+}
+
+// Failure is one failed run
+type Failure struct {
+	Entry
+	Time  string `json:"ts"`
+	Error string `json:"error,omitempty"`
+	Trace string `json:"trace,omitempty"`
+}
+
+// Report is the registry summary rendered to HTML
+type Report struct {
+	Generated time.Time      `json:"generated"`
+	Total     int            `json:"total"`
+	ByStatus  map[string]int `json:"by_status"`
+	PassRate  float64        `json:"pass_rate"`
+	Flaky     []Entry        `json:"flaky"`
+	Slowest   []Slow         `json:"slowest"`
+	Failures  []Failure      `json:"failures"`
+	// ByTriage counts tandas per triage state and Triage lists the ones
+	// still open, most urgent first
+	ByTriage map[string]int `json:"by_triage"`
+	Triage   []Entry        `json:"triage"`
+}
+
+// Build summarizes the registry
+func Build(tandas []*db.Tanda, now time.Time) *Report {
+	r := &Report{
+		Generated: now,
+		Total:     len(tandas),
+		ByStatus:  make(map[string]int),
+		PassRate:  events.PassRate(tandas),
+		Flaky:     []Entry{},
+		ByTriage:  make(map[string]int),
+		Triage:    []Entry{},
+		Slowest:   []Slow{},
+		Failures:  []Failure{},
+	}
+
+	for _, t := range tandas {
+		r.ByStatus[t.Status]++
+		entry := Entry{ID: t.ID, Title: t.Title, Status: t.Status, Flakiness: t.Flakiness(), Owners: t.Owners,
+			Priority: t.Priority, Triage: t.Triage, Refs: t.Refs}
+		if db.IsQuarantined(t.Status) {
+			r.Flaky = append(r.Flaky, entry)
+		}
+		if t.Triage != "" {
+			r.ByTriage[t.Triage]++
+			if t.Triage != db.TriageWontfix {
+				r.Triage = append(r.Triage, entry)
+			}
+		}
+
+		var total time.Duration
+		var timed int
+		for _, run := range t.RunHistory {
+			if d, ok := db.ParseDuration(run.Duration); ok {
+				total += d
+				timed++
+			}
+			if run.Result == "fail" {
+				r.Failures = append(r.Failures, Failure{Entry: entry, Time: run.Timestamp, Error: run.Error, Trace: run.Trace})
+			}
+		}
+		if timed > 0 {
+			d := t.Durations()
+			r.Slowest = append(r.Slowest, Slow{Entry: entry, Average: total / time.Duration(timed), P50: d.P50, P95: d.P95, Runs: timed})
+		}
+	}
+
+	sort.Slice(r.Flaky, func(i, j int) bool {
+		if r.Flaky[i].Flakiness != r.Flaky[j].Flakiness {
+			return r.Flaky[i].Flakiness > r.Flaky[j].Flakiness
+		}
+		return r.Flaky[i].ID < r.Flaky[j].ID
+	})
+	sort.Slice(r.Triage, func(i, j int) bool {
+		a, b := r.Triage[i], r.Triage[j]
+		if pa, pb := db.PriorityRank(a.Priority), db.PriorityRank(b.Priority); pa != pb {
+			return pa < pb
+		}
+		if a.Triage != b.Triage {
+			return triageRank(a.Triage) < triageRank(b.Triage)
+		}
+		return a.ID < b.ID
+	})
+	sort.Slice(r.Slowest, func(i, j int) bool {
+		a, b := r.Slowest[i], r.Slowest[j]
+		if a.P50 != b.P50 {
+			return a.P50 > b.P50
+		}
+		if a.Average != b.Average {
+			return a.Average > b.Average
+		}
+		return a.ID < b.ID
+	})
+	markTargets(r.Slowest)
+	if len(r.Slowest) > slowestLimit {
+		r.Slowest = r.Slowest[:slowestLimit]
+	}
+	sort.SliceStable(r.Failures, func(i, j int) bool { return failureTime(r.Failures[i]).After(failureTime(r.Failures[j])) })
+	if len(r.Failures) > failuresLimit {
+		r.Failures = r.Failures[:failuresLimit]
+	}
+	return r
+}
+
+// markTargets sets each tanda's share of the suite wall time and marks the
+// slowest ones until they cover targetShare. slow is sorted by p50.
+func markTargets(slow []Slow) {
+	var suite time.Duration
+	for _, s := range slow {
+		suite += s.P50
+	}
+	if suite == 0 {
+		return
+	}
+	covered := 0.0
+	for i := range slow {
+		slow[i].Share = float64(slow[i].P50) / float64(suite)
+		if covered < targetShare {
+			slow[i].Target = true
+			covered += slow[i].Share
+		}
+	}
+}
+
+// triageRank puts untriaged tandas before those already being handled
+func triageRank(state string) int {
+	for i, s := range db.TriageStates {
+		if state == s {
+			return i
+		}
+	}
+	return len(db.TriageStates)
+}
+
+func failureTime(f Failure) time.Time {
+	t, _ := db.ParseTimestamp(f.Time)
+	return t
+}
+
+// WriteHTML writes a self-contained index.html into dir. Trace links are
+// made relative to dir; root is the project root trace paths are relative to.
+func WriteHTML(r *Report, dir, root string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create report directory: %w", err)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"percent": func(v float64) string { return fmt.Sprintf("%.0f%%", v*100) },
+		"join":    strings.Join,
+		"round":   func(d time.Duration) time.Duration { return d.Round(time.Millisecond) },
+		"trace":   func(p string) string { return traceHref(p, absDir, root) },
+	}).Parse(pageTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse report template: %w", err)
+	}
+
+	path := filepath.Join(dir, IndexFile)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create report: %w", err)
+	}
+	defer f.Close()
+	if err := tmpl.Execute(f, r); err != nil {
+		return "", fmt.Errorf("failed to render report: %w", err)
+	}
+	return path, nil
+}
+
+// traceHref links a trace path from the report directory. URLs are kept.
+func traceHref(trace, dir, root string) string {
+	if strings.Contains(trace, "://") {
+		return trace
+	}
+	abs := trace
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(root, trace)
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return filepath.ToSlash(abs)
+	}
+	return filepath.ToSlash(rel)
+}
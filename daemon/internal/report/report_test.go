@@ -0,0 +1,83 @@
+package report_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/report"
+)
+
+func TestBuildAndWriteHTML(t *testing.T) {
+	tandas := []*db.Tanda{
+		{ID: "td-1", Title: "Login", Status: "flaky", Refs: []db.Ref{{Type: db.RefIssue, URL: "https://jira.example.com/browse/QA-7", ID: "QA-7"}}, RunHistory: []db.RunResult{
+			{Timestamp: "2025-06-01T10:00:00", Result: "pass", Duration: "2s"},
+			{Timestamp: "2025-06-02T10:00:00", Result: "fail", Duration: "4s", Error: "timeout <#login>", Trace: "traces/login.zip"},
+		}},
+		{ID: "td-2", Title: "Search", Status: "active", RunHistory: []db.RunResult{
+			{Timestamp: "2025-06-03T10:00:00", Result: "fail", Duration: "1s"},
+		}},
+		{ID: "td-3", Title: "Export", Status: "deprecated"},
+	}
+
+	r := report.Build(tandas, time.Date(2025, 6, 4, 0, 0, 0, 0, time.Local))
+	if r.Total != 3 || r.ByStatus["flaky"] != 1 || len(r.Flaky) != 1 {
+		t.Fatalf("unexpected summary: %+v", r)
+	}
+	if len(r.Failures) != 2 || r.Failures[0].ID != "td-2" {
+		t.Fatalf("expected most recent failure first, got %+v", r.Failures)
+	}
+	if r.Slowest[0].ID != "td-1" || r.Slowest[0].Average != 3*time.Second {
+		t.Fatalf("unexpected slowest: %+v", r.Slowest)
+	}
+	// td-1's p50 of 2s is two thirds of the suite's wall time
+	if s := r.Slowest; s[0].P50 != 2*time.Second || s[0].P95 != 4*time.Second || !s[0].Target || s[1].Target || s[0].Share < 0.66 {
+		t.Fatalf("unexpected optimization targets: %+v", s)
+	}
+
+	if len(r.Triage) != 0 {
+		t.Fatalf("expected nothing to triage, got %+v", r.Triage)
+	}
+
+	root := t.TempDir()
+	path, err := report.WriteHTML(r, filepath.Join(root, "out"), root)
+	if err != nil {
+		t.Fatalf("write html: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, want := range []string{`href="../traces/login.zip"`, "timeout &lt;#login&gt;", "50%",
+		`<a href="https://jira.example.com/browse/QA-7">issue QA-7</a>`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected report to contain %q", want)
+		}
+	}
+}
+
+func TestBuildTriage(t *testing.T) {
+	tandas := []*db.Tanda{
+		{ID: "td-1", Title: "Login", Status: "flaky", Triage: db.TriageFixing, Priority: "p2"},
+		{ID: "td-2", Title: "Search", Status: "flaky", Triage: db.TriageUntriaged},
+		{ID: "td-3", Title: "Export", Status: "flaky", Triage: db.TriageAcknowledged, Priority: "p0"},
+		{ID: "td-4", Title: "Cart", Status: "flaky", Triage: db.TriageUntriaged, Priority: "p2"},
+		{ID: "td-5", Title: "Upload", Status: "quarantined", Triage: db.TriageWontfix, Priority: "p0"},
+	}
+
+	r := report.Build(tandas, time.Now())
+	var order []string
+	for _, e := range r.Triage {
+		order = append(order, e.ID)
+	}
+	if strings.Join(order, " ") != "td-3 td-4 td-1 td-2" {
+		t.Fatalf("expected open tandas by priority then state, got %v", order)
+	}
+	if r.ByTriage[db.TriageUntriaged] != 2 || r.ByTriage[db.TriageWontfix] != 1 {
+		t.Fatalf("unexpected triage counts: %v", r.ByTriage)
+	}
+}
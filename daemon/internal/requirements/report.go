@@ -0,0 +1,133 @@
+package requirements
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// Coverage states, from worst to best
+const (
+	Uncovered = "uncovered"
+	// DeprecatedOnly means every covering tanda is retired
+	DeprecatedOnly = "deprecated_only"
+	// QuarantinedOnly means no covering tanda is healthy and at least one is
+	// quarantined
+	QuarantinedOnly = "quarantined_only"
+	Covered         = "covered"
+)
+
+// Status is the coverage of one requirement
+type Status struct {
+	Requirement
+	State    string   `json:"state"`
+	TandaIDs []string `json:"tanda_ids"`
+}
+
+// Report is the coverage of a whole manifest
+type Report struct {
+	Requirements []Status `json:"requirements"`
+	// Unlisted are covers values that no requirement declares, usually typos
+	// or requirements missing from the manifest
+	Unlisted []string `json:"unlisted"`
+}
+
+// Check reports how each requirement is covered by the registry. Tandas in
+// a status statuses retires don't count as coverage.
+func Check(reqs []Requirement, tandas []*db.Tanda, statuses *workflow.Workflow) *Report {
+	byCover := make(map[string][]*db.Tanda)
+	for _, t := range tandas {
+		for _, c := range t.Covers {
+			byCover[c] = append(byCover[c], t)
+		}
+	}
+
+	report := &Report{Requirements: []Status{}, Unlisted: []string{}}
+	listed := make(map[string]bool)
+	for _, r := range reqs {
+		listed[r.ID] = true
+		st := Status{Requirement: r, State: Uncovered, TandaIDs: []string{}}
+		quarantined := false
+		for _, t := range byCover[r.ID] {
+			st.TandaIDs = append(st.TandaIDs, t.ID)
+			switch {
+			case db.IsQuarantined(t.Status):
+				quarantined = true
+			case !statuses.IsRetired(t.Status):
+				st.State = Covered
+			}
+		}
+		if st.State != Covered && len(st.TandaIDs) > 0 {
+			st.State = DeprecatedOnly
+			if quarantined {
+				st.State = QuarantinedOnly
+			}
+		}
+		sort.Strings(st.TandaIDs)
+		report.Requirements = append(report.Requirements, st)
+	}
+
+	for c := range byCover {
+		if !listed[c] {
+			report.Unlisted = append(report.Unlisted, c)
+		}
+	}
+	sort.Strings(report.Unlisted)
+	return report
+}
+
+// Gaps returns the requirements that are not covered by a healthy tanda
+func (r *Report) Gaps() []Status {
+	var gaps []Status
+	for _, s := range r.Requirements {
+		if s.State != Covered {
+			gaps = append(gaps, s)
+		}
+	}
+	return gaps
+}
+
+// Markdown renders the report as a release checklist
+func (r *Report) Markdown() string {
+	var b strings.Builder
+	gaps := r.Gaps()
+	fmt.Fprintf(&b, "# Coverage gaps\n\n%d of %d requirement(s) covered by a healthy tanda.\n",
+		len(r.Requirements)-len(gaps), len(r.Requirements))
+
+	section := func(title, state string) {
+		var rows []Status
+		for _, s := range gaps {
+			if s.State == state {
+				rows = append(rows, s)
+			}
+		}
+		fmt.Fprintf(&b, "\n## %s (%d)\n\n", title, len(rows))
+		if len(rows) == 0 {
+			b.WriteString("None.\n")
+		}
+		for _, s := range rows {
+			line := "- [ ] " + s.ID
+			if s.Title != "" {
+				line += ": " + s.Title
+			}
+			if len(s.TandaIDs) > 0 {
+				line += " (" + strings.Join(s.TandaIDs, ", ") + ")"
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	section("Uncovered", Uncovered)
+	section("Covered only by quarantined tests", QuarantinedOnly)
+	section("Covered only by retired tests", DeprecatedOnly)
+
+	if len(r.Unlisted) > 0 {
+		fmt.Fprintf(&b, "\n## Covers not in the manifest (%d)\n\n", len(r.Unlisted))
+		for _, c := range r.Unlisted {
+			fmt.Fprintf(&b, "- %s\n", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package requirements
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Requirement is a feature or spec identifier that must be covered by at
+// least one tanda
+type Requirement struct {
+	ID    string `json:"id" yaml:"id"`
+	Title string `json:"title,omitempty" yaml:"title"`
+}
+
+// UnmarshalYAML accepts either a bare identifier or an {id, title} mapping
+func (r *Requirement) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		r.ID = node.Value
+		return nil
+	}
+	type plain Requirement
+	return node.Decode((*plain)(r))
+}
+
+// Load reads a manifest, choosing the parser from the file extension
+func Load(path string) ([]Requirement, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseYAML(f)
+	case ".csv":
+		return ParseCSV(f)
+	default:
+		return nil, fmt.Errorf("unsupported manifest %s (want .yaml, .yml or .csv)", path)
+	}
+}
+
+// ParseYAML reads either a list of requirements or a mapping with a
+// `requirements` list
+func ParseYAML(r io.Reader) ([]Requirement, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var list []Requirement
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		var doc struct {
+			Requirements []Requirement `yaml:"requirements"`
+		}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		list = doc.Requirements
+	}
+	return validate(list)
+}
+
+// ParseCSV reads rows of id[,title]. A header row starting with "id" is
+// skipped.
+func ParseCSV(r io.Reader) ([]Requirement, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	var list []Requirement
+	for i, row := range rows {
+		if i == 0 && strings.EqualFold(strings.TrimSpace(row[0]), "id") {
+			continue
+		}
+		req := Requirement{ID: row[0]}
+		if len(row) > 1 {
+			req.Title = row[1]
+		}
+		list = append(list, req)
+	}
+	return validate(list)
+}
+
+func validate(list []Requirement) ([]Requirement, error) {
+	seen := make(map[string]bool)
+	var out []Requirement
+	for _, r := range list {
+		r.ID = strings.TrimSpace(r.ID)
+		r.Title = strings.TrimSpace(r.Title)
+		if r.ID == "" {
+			continue
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("duplicate requirement %s", r.ID)
+		}
+		seen[r.ID] = true
+		out = append(out, r)
+	}
+	return out, nil
+}
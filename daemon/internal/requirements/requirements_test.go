@@ -0,0 +1,84 @@
+package requirements_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/requirements"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+func TestParseManifests(t *testing.T) {
+	yamlReqs, err := requirements.ParseYAML(strings.NewReader(`
+requirements:
+  - auth
+  - id: checkout
+    title: Checkout flow
+`))
+	if err != nil {
+		t.Fatalf("parse yaml: %v", err)
+	}
+	if len(yamlReqs) != 2 || yamlReqs[0].ID != "auth" || yamlReqs[1].Title != "Checkout flow" {
+		t.Fatalf("unexpected yaml requirements: %+v", yamlReqs)
+	}
+
+	listReqs, err := requirements.ParseYAML(strings.NewReader("- auth\n- search\n"))
+	if err != nil || len(listReqs) != 2 {
+		t.Fatalf("parse yaml list: %+v, %v", listReqs, err)
+	}
+
+	csvReqs, err := requirements.ParseCSV(strings.NewReader("id,title\nauth,Login\nsearch\n"))
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(csvReqs) != 2 || csvReqs[0].Title != "Login" || csvReqs[1].ID != "search" {
+		t.Fatalf("unexpected csv requirements: %+v", csvReqs)
+	}
+
+	if _, err := requirements.ParseCSV(strings.NewReader("auth\nauth\n")); err == nil {
+		t.Fatal("expected error for duplicate requirement")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	reqs := []requirements.Requirement{{ID: "auth"}, {ID: "checkout"}, {ID: "search"}, {ID: "export"}, {ID: "billing"}}
+	tandas := []*db.Tanda{
+		{ID: "td-1", Status: "active", Covers: []string{"auth"}},
+		{ID: "td-2", Status: "flaky", Covers: []string{"auth", "checkout"}},
+		{ID: "td-3", Status: "deprecated", Covers: []string{"checkout", "search"}},
+		{ID: "td-4", Status: "active", Covers: []string{"serach"}},
+		{ID: "td-5", Status: "archived", Covers: []string{"billing"}},
+		{ID: "td-6", Status: "obsolete", Covers: []string{"billing"}},
+	}
+	statuses, err := workflow.New(config.StatusConfig{Extra: []string{"obsolete"}, Retired: []string{"obsolete"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := requirements.Check(reqs, tandas, statuses)
+	want := map[string]string{
+		"auth":     requirements.Covered,
+		"checkout": requirements.QuarantinedOnly,
+		"search":   requirements.DeprecatedOnly,
+		"export":   requirements.Uncovered,
+		"billing":  requirements.DeprecatedOnly,
+	}
+	for _, s := range report.Requirements {
+		if s.State != want[s.ID] {
+			t.Errorf("%s: state %s, want %s", s.ID, s.State, want[s.ID])
+		}
+	}
+	if len(report.Gaps()) != 4 {
+		t.Fatalf("expected 4 gaps, got %+v", report.Gaps())
+	}
+	if len(report.Unlisted) != 1 || report.Unlisted[0] != "serach" {
+		t.Fatalf("expected unlisted cover to be reported, got %v", report.Unlisted)
+	}
+
+	md := report.Markdown()
+	if !strings.Contains(md, "1 of 5 requirement(s)") || !strings.Contains(md, "- [ ] checkout (td-2, td-3)") {
+		t.Fatalf("unexpected markdown:\n%s", md)
+	}
+}
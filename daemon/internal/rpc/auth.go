@@ -0,0 +1,206 @@
+package rpc
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+)
+
+// Token scopes. Write implies read.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// authenticator checks bearer tokens against the static list from config
+// and a tokens file, which is re-read when it changes
+type authenticator struct {
+	static []config.TokenConfig
+	path   string
+
+	mu      gosync.Mutex
+	modTime time.Time
+	file    []config.TokenConfig
+}
+
+func newAuthenticator(cfg config.TeamConfig) (*authenticator, error) {
+	a := &authenticator{path: cfg.TokensFile}
+	for _, t := range cfg.Tokens {
+		if err := validToken(t); err != nil {
+			return nil, err
+		}
+		a.static = append(a.static, t)
+	}
+	if a.path != "" {
+		if err := a.reload(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// enabled reports whether any tokens are configured
+func (a *authenticator) enabled() bool {
+	return len(a.static) > 0 || a.path != ""
+}
+
+// authorize returns an error unless token grants the scope a method needs
+func (a *authenticator) authorize(token, method string) error {
+	need, ok := teamMethods[method]
+	if !ok {
+		return fmt.Errorf("method %s is not available over TCP", method)
+	}
+	if !a.enabled() {
+		return nil
+	}
+	if token == "" {
+		return fmt.Errorf("unauthorized: missing token")
+	}
+
+	if a.path != "" {
+		if err := a.reload(); err != nil {
+			slog.Warn("Token reload failed", "err", err)
+		}
+	}
+	a.mu.Lock()
+	tokens := append(append([]config.TokenConfig{}, a.static...), a.file...)
+	a.mu.Unlock()
+
+	scope := ""
+	for _, t := range tokens {
+		// Compare every token so timing does not reveal which one matched
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			scope = t.Scope
+		}
+	}
+	switch {
+	case scope == "":
+		return fmt.Errorf("unauthorized: invalid token")
+	case need == ScopeWrite && scope != ScopeWrite:
+		return fmt.Errorf("forbidden: %s requires a write token", method)
+	}
+	return nil
+}
+
+// reload re-reads the tokens file when its modification time changed. The
+// file holds one "<token> [read|write]" per line; scope defaults to read.
+func (a *authenticator) reload() error {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return fmt.Errorf("failed to read tokens file: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if info.ModTime().Equal(a.modTime) {
+		return nil
+	}
+
+	f, err := os.Open(a.path)
+	if err != nil {
+		return fmt.Errorf("failed to read tokens file: %w", err)
+	}
+	defer f.Close()
+
+	var tokens []config.TokenConfig
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		t := config.TokenConfig{Token: fields[0], Scope: ScopeRead}
+		if len(fields) > 1 {
+			t.Scope = fields[1]
+		}
+		if err := validToken(t); err != nil {
+			return fmt.Errorf("tokens file line %d: %w", lineNum, err)
+		}
+		tokens = append(tokens, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read tokens file: %w", err)
+	}
+
+	a.file = tokens
+	a.modTime = info.ModTime()
+	return nil
+}
+
+func validToken(t config.TokenConfig) error {
+	if t.Token == "" {
+		return fmt.Errorf("empty token")
+	}
+	if t.Scope != ScopeRead && t.Scope != ScopeWrite {
+		return fmt.Errorf("invalid token scope %q (want read or write)", t.Scope)
+	}
+	return nil
+}
+
+// serverTLS builds the listener TLS config, or nil when no certificate is
+// configured. A CA enables mutual TLS.
+func serverTLS(cfg config.TLSConfig) (*tls.Config, error) {
+	if cfg.Cert == "" && cfg.Key == "" {
+		if cfg.CA != "" {
+			return nil, fmt.Errorf("tls: ca requires cert and key")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+	if err != nil {
+		return nil, fmt.Errorf("tls: failed to load certificate: %w", err)
+	}
+	tc := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.CA != "" {
+		pool, err := loadPool(cfg.CA)
+		if err != nil {
+			return nil, err
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tc, nil
+}
+
+// clientTLS builds the TLS config used to dial a team server
+func clientTLS(cfg config.TLSConfig) (*tls.Config, error) {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CA != "" {
+		pool, err := loadPool(cfg.CA)
+		if err != nil {
+			return nil, err
+		}
+		tc.RootCAs = pool
+	}
+	if cfg.Cert != "" || cfg.Key != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("tls: failed to load client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("tls: failed to read CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tls: no certificates in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,241 @@
+package rpc_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestAuthorize(t *testing.T) {
+	authorize, err := rpc.Authorizer(config.TeamConfig{Tokens: []config.TokenConfig{
+		{Token: "reader", Scope: rpc.ScopeRead},
+		{Token: "writer", Scope: rpc.ScopeWrite},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		method  string
+		wantErr string
+	}{
+		{"read token reads", "reader", "query", ""},
+		{"read token cannot push", "reader", "push", "forbidden"},
+		{"read token cannot create", "reader", "create", "forbidden"},
+		{"read token cannot record runs", "reader", "record_run", "forbidden"},
+		{"write token reads", "writer", "query", ""},
+		{"write token pushes", "writer", "push", ""},
+		{"read token cannot cancel", "reader", "cancel", "forbidden"},
+		{"write token cancels", "writer", "cancel", ""},
+		{"missing token", "", "query", "missing token"},
+		{"wrong token", "writer2", "query", "invalid token"},
+		{"socket-only method", "writer", "shutdown", "not available over TCP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorize(tt.token, tt.method)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("authorize(%q, %s) = %v, want nil", tt.token, tt.method, err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("authorize(%q, %s) = %v, want %q", tt.token, tt.method, err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := rpc.Authorizer(config.TeamConfig{Tokens: []config.TokenConfig{{Token: "x", Scope: "admin"}}}); err == nil {
+		t.Error("an unknown scope should be rejected")
+	}
+}
+
+func TestAuthorizeTokensFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(path, []byte("# ci\nold write\nviewer\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	authorize, err := rpc.Authorizer(config.TeamConfig{TokensFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := authorize("old", "push"); err != nil {
+		t.Fatalf("old token: %v", err)
+	}
+	if err := authorize("viewer", "push"); err == nil || !strings.Contains(err.Error(), "forbidden") {
+		t.Fatalf("a token without a scope should be read-only, got %v", err)
+	}
+
+	// Rotate: the old token is revoked and a new one issued
+	if err := os.WriteFile(path, []byte("new write\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := authorize("old", "push"); err == nil || !strings.Contains(err.Error(), "invalid token") {
+		t.Errorf("rotated-out token = %v, want invalid token", err)
+	}
+	if err := authorize("new", "push"); err != nil {
+		t.Errorf("rotated-in token: %v", err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := newCA(t, "tandas CA")
+	rogue, rogueKey := newCA(t, "rogue CA")
+	caPath := writeCert(t, dir, "ca", ca, nil)
+	serverCert, serverKey := writeLeaf(t, dir, "server", ca, caKey, true)
+	clientCert, clientKey := writeLeaf(t, dir, "client", ca, caKey, false)
+	rogueCert, rogueKeyPath := writeLeaf(t, dir, "rogue", rogue, rogueKey, false)
+
+	srv, err := rpc.ServerTLS(config.TLSConfig{Cert: serverCert, Key: serverKey, CA: caPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if conn.(*tls.Conn).Handshake() == nil {
+					conn.Write([]byte("ok"))
+				}
+			}()
+		}
+	}()
+
+	tests := []struct {
+		name      string
+		cert, key string
+		wantOK    bool
+	}{
+		{"client signed by the CA", clientCert, clientKey, true},
+		{"client signed by another CA", rogueCert, rogueKeyPath, false},
+		{"no client certificate", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := rpc.ClientTLS(config.TLSConfig{CA: caPath, Cert: tt.cert, Key: tt.key})
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := tls.Dial("tcp", l.Addr().String(), cfg)
+			if err == nil {
+				defer conn.Close()
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				// With TLS 1.3 the server's verdict arrives after the
+				// client's handshake, on the first read
+				_, err = io.ReadAll(conn)
+			}
+			if tt.wantOK && err != nil {
+				t.Fatalf("handshake: %v", err)
+			}
+			if !tt.wantOK && err == nil {
+				t.Fatal("the server accepted the client")
+			}
+		})
+	}
+}
+
+func newCA(t *testing.T, name string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// writeLeaf issues a certificate signed by ca and returns the cert and key
+// paths
+func writeLeaf(t *testing.T, dir, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, server bool) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeCert(t, dir, name, cert, key), filepath.Join(dir, name+"-key.pem")
+}
+
+// writeCert writes cert, and key when given, as PEM files in dir
+func writeCert(t *testing.T, dir, name string, cert *x509.Certificate, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	path := filepath.Join(dir, name+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if key != nil {
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+		if err := os.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
@@ -0,0 +1,44 @@
+package rpc
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/tandas/daemon/internal/badge"
+	"github.com/tandas/daemon/internal/db"
+)
+
+// BadgeParams names the badge to render: pass-rate, flaky or quarantined
+type BadgeParams struct {
+	Kind string `json:"kind"`
+}
+
+// BadgeResult is the badge and its SVG
+type BadgeResult struct {
+	badge.Badge
+	SVG string `json:"svg"`
+}
+
+// badge handles the badge RPC
+func (d *Daemon) badge(ctx context.Context, params BadgeParams) (*BadgeResult, error) {
+	tandas, err := d.cache.all(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b, err := badge.Build(tandas, params.Kind)
+	if err != nil {
+		return nil, err
+	}
+	return &BadgeResult{Badge: b, SVG: string(b.SVG())}, nil
+}
+
+// writeBadges regenerates the badges in badges.dir, when set. Failures
+// only warn; the next sync tries again.
+func (d *Daemon) writeBadges(tandas []*db.Tanda) {
+	if d.badgeDir == "" {
+		return
+	}
+	if _, err := badge.WriteFiles(d.badgeDir, tandas); err != nil {
+		slog.Warn("Failed to write badges", "dir", d.badgeDir, "err", err)
+	}
+}
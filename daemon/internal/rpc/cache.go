@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"context"
+	gosync "sync"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// maxCacheEntries bounds the distinct filters cached at once
+const maxCacheEntries = 64
+
+// readCache memoizes registry reads for the read-only RPCs, keyed by
+// filter and dropped whenever the store's generation moves. Cached slices
+// are shared between requests and must not be modified.
+type readCache struct {
+	store *db.Store
+
+	mu      gosync.Mutex
+	gen     uint64
+	entries map[db.Filter][]*db.Tanda
+	hits    int64
+	misses  int64
+}
+
+func newReadCache(store *db.Store) *readCache {
+	return &readCache{store: store, entries: make(map[db.Filter][]*db.Tanda)}
+}
+
+// query returns the tandas matching f, reading the store only when the
+// registry changed since the last read of f
+func (c *readCache) query(ctx context.Context, f db.Filter) ([]*db.Tanda, error) {
+	gen := c.store.Generation()
+	c.mu.Lock()
+	if gen != c.gen {
+		c.entries = make(map[db.Filter][]*db.Tanda)
+		c.gen = gen
+	}
+	if tandas, ok := c.entries[f]; ok {
+		c.hits++
+		c.mu.Unlock()
+		return tandas, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	tandas, err := c.store.QueryTandasContext(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if tandas == nil {
+		tandas = []*db.Tanda{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// A write during the read may or may not be in the result, so it is
+	// only kept when the generation did not move
+	if c.store.Generation() == gen && c.gen == gen {
+		if len(c.entries) >= maxCacheEntries {
+			c.entries = make(map[db.Filter][]*db.Tanda)
+		}
+		c.entries[f] = tandas
+	}
+	return tandas, nil
+}
+
+// all returns every tanda
+func (c *readCache) all(ctx context.Context) ([]*db.Tanda, error) {
+	return c.query(ctx, db.Filter{})
+}
+
+func (c *readCache) status() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return map[string]interface{}{
+		"generation": c.gen,
+		"entries":    len(c.entries),
+		"hits":       c.hits,
+		"misses":     c.misses,
+	}
+}
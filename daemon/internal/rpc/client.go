@@ -0,0 +1,186 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+)
+
+// ErrNotRunning is returned by Call when no daemon is listening
+var ErrNotRunning = fmt.Errorf("daemon not running")
+
+// ErrIncompatible is returned, wrapped, when the daemon and this client
+// cannot understand each other's protocol
+var ErrIncompatible = errors.New("incompatible daemon")
+
+// staleWarning makes checkDaemonVersion warn once per process
+var staleWarning gosync.Once
+
+// Call sends one request to the daemon in dir and decodes the result into
+// out (which may be nil). It returns ErrNotRunning when the socket is
+// missing or refuses connections.
+func Call(dir, method string, params, out interface{}) error {
+	conn, token, err := dialDaemon(dir)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	checkDaemonVersion(dir)
+	err = call(conn, method, token, params, out)
+	if errors.Is(err, ErrIncompatible) {
+		return fmt.Errorf("%w; restart the daemon (td-daemon stop && td-daemon start) to run td-daemon %s", err, Version)
+	}
+	return err
+}
+
+// checkDaemonVersion warns when the daemon in dir was started from another
+// release than this client, as a long-running daemon is after an upgrade:
+// it may lack or mis-handle newer commands
+func checkDaemonVersion(dir string) {
+	staleWarning.Do(func() {
+		lock, err := ReadLockFile(dir)
+		if err != nil || lock.Version == Version {
+			return
+		}
+		slog.Warn("Daemon is running another td-daemon release; restart it to pick up this one",
+			"daemon", lock.Version, "client", Version, "started", lock.StartedAt.Local().Format(time.DateTime))
+	})
+}
+
+// dialDaemon connects to the daemon in dir over its socket, or over the
+// localhost TCP listener in its lock file when the socket can't be reached,
+// as across a container or WSL boundary. It returns the token TCP needs.
+func dialDaemon(dir string) (net.Conn, string, error) {
+	conn, err := net.DialTimeout("unix", SocketPath(dir), 2*time.Second)
+	if err == nil {
+		return conn, "", nil
+	}
+	lock, err := ReadLockFile(dir)
+	if err != nil || lock.TCP == "" {
+		return nil, "", ErrNotRunning
+	}
+	conn, err = net.DialTimeout("tcp", lock.TCP, 2*time.Second)
+	if err != nil {
+		return nil, "", ErrNotRunning
+	}
+	return conn, localToken(dir), nil
+}
+
+// TeamClient calls a team server over TCP, optionally with TLS and a
+// bearer token
+type TeamClient struct {
+	Addr  string
+	Token string
+	TLS   *tls.Config
+}
+
+// NewTeamClient builds a client for addr, which may be host:port or
+// tls://host:port
+func NewTeamClient(addr, token string, tlsCfg config.TLSConfig) (*TeamClient, error) {
+	c := &TeamClient{Addr: addr, Token: token}
+	if rest, ok := strings.CutPrefix(addr, "tls://"); ok {
+		tc, err := clientTLS(tlsCfg)
+		if err != nil {
+			return nil, err
+		}
+		c.Addr, c.TLS = rest, tc
+	}
+	return c, nil
+}
+
+// Call sends one request to the team server
+func (c *TeamClient) Call(method string, params, out interface{}) error {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	var conn net.Conn
+	var err error
+	if c.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.Addr, c.TLS)
+	} else {
+		conn, err = dialer.Dial("tcp", c.Addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", c.Addr, err)
+	}
+	defer conn.Close()
+	return call(conn, method, c.Token, params, out)
+}
+
+// Notify sends method to the daemon in dir as a notification: the daemon
+// acts on it without replying, so failures on its side go unreported. It
+// suits frequent messages such as runner progress.
+func Notify(dir, method string, params interface{}) error {
+	conn, token, err := dialDaemon(dir)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	checkDaemonVersion(dir)
+
+	req, err := newRequest(method, token, params)
+	if err != nil {
+		return err
+	}
+	req.ID = nil
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	return nil
+}
+
+func newRequest(method, token string, params interface{}) (RPCRequest, error) {
+	req := RPCRequest{JSONRPC: jsonrpcVersion, Method: method, ID: json.RawMessage("1"), Token: token, Protocol: ProtocolVersion}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return req, fmt.Errorf("failed to encode params: %w", err)
+		}
+		req.Params = raw
+	}
+	return req, nil
+}
+
+func call(conn net.Conn, method, token string, params, out interface{}) error {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	req, err := newRequest(method, token, params)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	// Older daemons send error as a string, newer ones as an object, and
+	// only those newer still send their protocol
+	var resp struct {
+		Result   json.RawMessage `json:"result"`
+		Error    json.RawMessage `json:"error"`
+		Protocol int             `json:"protocol"`
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.Protocol != 0 && resp.Protocol < MinProtocolVersion {
+		return fmt.Errorf("%s: %w: it speaks protocol %d, this client needs %d or later", method, ErrIncompatible, resp.Protocol, MinProtocolVersion)
+	}
+	if err := responseError(resp.Error); err != nil {
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) && rpcErr.Code == CodeProtocol {
+			return fmt.Errorf("%s: %w: %w", method, ErrIncompatible, err)
+		}
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if out != nil && len(resp.Result) > 0 {
+		return json.Unmarshal(resp.Result, out)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package rpc_test
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+// fakeDaemon answers every request on dir's socket with reply, standing
+// in for a daemon from another release
+func fakeDaemon(t *testing.T, reply string) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "td")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	l, err := net.Listen("unix", filepath.Join(dir, "td.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+					conn.Write([]byte(reply + "\n"))
+				}
+			}()
+		}
+	}()
+	return dir
+}
+
+func TestVersionMismatch(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{})
+	lock, err := rpc.ReadLockFile(d.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Version != rpc.Version || lock.Protocol != rpc.ProtocolVersion {
+		t.Errorf("lock file version = %s, protocol %d", lock.Version, lock.Protocol)
+	}
+	// Every 2.0 response carries the daemon's protocol
+	var resp struct {
+		Protocol int `json:"protocol"`
+	}
+	decode(t, d.dial(t).roundTrip(t, `{"jsonrpc":"2.0","id":1,"method":"no_such_method"}`), &resp)
+	if resp.Protocol != rpc.ProtocolVersion {
+		t.Errorf("error response protocol = %d, want %d", resp.Protocol, rpc.ProtocolVersion)
+	}
+
+	tests := []struct {
+		name         string
+		reply        string
+		incompatible bool
+	}{
+		{"daemon before protocols", `{"result":"pong","id":1}`, false},
+		{"daemon before protocols failing", `{"error":"unknown method: ping","id":1}`, false},
+		{"daemon below the minimum", `{"jsonrpc":"2.0","result":"pong","id":1,"protocol":-1}`, true},
+		{"daemon refusing this client", `{"jsonrpc":"2.0","error":{"code":-32004,"message":"client protocol 2 is newer than this daemon supports"},"id":1,"protocol":1}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rpc.Call(fakeDaemon(t, tt.reply), "ping", nil, nil)
+			if got := errors.Is(err, rpc.ErrIncompatible); got != tt.incompatible {
+				t.Fatalf("Call = %v, incompatible %v; want %v", err, got, tt.incompatible)
+			}
+			if tt.incompatible && !strings.Contains(err.Error(), "restart the daemon") {
+				t.Errorf("error %q should say to restart the daemon", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+)
+
+// Defaults for config.RPCConfig
+const (
+	DefaultMaxConnections = 128
+	DefaultIdleTimeout    = 5 * time.Minute
+	DefaultReadTimeout    = 10 * time.Second
+	// DefaultMaxRequestBytes leaves room for pushing a large registry
+	DefaultMaxRequestBytes = 32 << 20
+	// writeTimeout bounds sending a response to a client that stopped
+	// reading
+	writeTimeout = 30 * time.Second
+)
+
+// connLimits bounds the RPC connections served on the socket and the team
+// listener together, and counts how connections ended
+type connLimits struct {
+	max        int
+	idle       time.Duration
+	read       time.Duration
+	maxRequest int64
+	// slots holds a token per open connection
+	slots chan struct{}
+
+	accepted   atomic.Int64
+	rejected   atomic.Int64
+	idleClosed atomic.Int64
+	timedOut   atomic.Int64
+	tooLarge   atomic.Int64
+}
+
+// errRequestTooLarge stops reading a request over the size cap
+var errRequestTooLarge = errors.New("request too large")
+
+// newConnLimits applies cfg over the defaults. An invalid setting is
+// reported and left at its default.
+func newConnLimits(cfg config.RPCConfig) (*connLimits, error) {
+	c := &connLimits{max: DefaultMaxConnections, idle: DefaultIdleTimeout, read: DefaultReadTimeout,
+		maxRequest: DefaultMaxRequestBytes}
+	var errs []error
+	if cfg.MaxConnections > 0 {
+		c.max = cfg.MaxConnections
+	}
+	if cfg.MaxRequestBytes > 0 {
+		c.maxRequest = cfg.MaxRequestBytes
+	}
+	if cfg.IdleTimeout != "" {
+		if d, err := time.ParseDuration(cfg.IdleTimeout); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("invalid rpc.idle_timeout %q", cfg.IdleTimeout))
+		} else {
+			c.idle = d
+		}
+	}
+	if cfg.ReadTimeout != "" {
+		if d, err := time.ParseDuration(cfg.ReadTimeout); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("invalid rpc.read_timeout %q", cfg.ReadTimeout))
+		} else {
+			c.read = d
+		}
+	}
+	c.slots = make(chan struct{}, c.max)
+	return c, errors.Join(errs...)
+}
+
+// acquire takes a connection slot, or reports false when all are in use
+func (c *connLimits) acquire() bool {
+	select {
+	case c.slots <- struct{}{}:
+		c.accepted.Add(1)
+		return true
+	default:
+		c.rejected.Add(1)
+		return false
+	}
+}
+
+func (c *connLimits) release() {
+	<-c.slots
+}
+
+func (c *connLimits) status() map[string]interface{} {
+	return map[string]interface{}{
+		"active":       len(c.slots),
+		"max":          c.max,
+		"accepted":     c.accepted.Load(),
+		"rejected":     c.rejected.Load(),
+		"idle_closed":  c.idleClosed.Load(),
+		"timed_out":    c.timedOut.Load(),
+		"too_large":    c.tooLarge.Load(),
+		"idle_timeout": c.idle.String(),
+		"read_timeout": c.read.String(),
+		"max_request":  c.maxRequest,
+	}
+}
+
+// connReader reads requests from a connection under the idle and read
+// timeouts and the request size cap
+type connReader struct {
+	conn    net.Conn
+	limits  *connLimits
+	buf     *bufio.Reader
+	budget  *budgetReader
+	decoder *json.Decoder
+}
+
+func newConnReader(conn net.Conn, limits *connLimits) *connReader {
+	buf := bufio.NewReader(conn)
+	budget := &budgetReader{r: buf}
+	return &connReader{conn: conn, limits: limits, buf: buf, budget: budget, decoder: json.NewDecoder(budget)}
+}
+
+// budgetReader fails reads once a request has used up its bytes
+type budgetReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, errRequestTooLarge
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// next reads the next request. It waits up to the idle timeout for the
+// request to start and then allows the read timeout for the rest of it, so
+// a client that stalls mid-request is dropped quickly while one that is
+// merely quiet keeps its connection for a while. It returns io.EOF once
+// the connection is done, and errRequestTooLarge for a request over the
+// size cap, after which the stream cannot be resynchronized.
+func (r *connReader) next(req *json.RawMessage) error {
+	if !r.pending() {
+		r.conn.SetReadDeadline(time.Now().Add(r.limits.idle))
+		if _, err := r.buf.Peek(1); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				r.limits.idleClosed.Add(1)
+				return io.EOF
+			}
+			return err
+		}
+	}
+	r.conn.SetReadDeadline(time.Now().Add(r.limits.read))
+	r.budget.remaining = r.limits.maxRequest
+	err := r.decoder.Decode(req)
+	if errors.Is(err, errRequestTooLarge) {
+		r.limits.tooLarge.Add(1)
+		return fmt.Errorf("%w: limit is %d bytes", errRequestTooLarge, r.limits.maxRequest)
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		r.limits.timedOut.Add(1)
+		return fmt.Errorf("request not received within %s", r.limits.read)
+	}
+	r.conn.SetReadDeadline(time.Time{})
+	return err
+}
+
+// pending reports whether the decoder already holds the start of the next
+// request, read along with the previous one
+func (r *connReader) pending() bool {
+	data, _ := io.ReadAll(r.decoder.Buffered())
+	return len(bytes.TrimSpace(data)) > 0
+}
@@ -0,0 +1,87 @@
+package rpc_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestConnectionLimit(t *testing.T) {
+	d := startDaemon(t, "rpc:\n  max_connections: 2\n", rpc.StartOptions{})
+
+	// Wait for the startup ping's connection to close; the status call
+	// holds the only slot in use
+	eventually(t, "startup connections to close", func() bool {
+		var status struct {
+			Connections struct {
+				Active int `json:"active"`
+			} `json:"connections"`
+		}
+		return rpc.Call(d.dir, "status", nil, &status) == nil && status.Connections.Active == 1
+	})
+
+	var open []*conn
+	for i := 0; i < 2; i++ {
+		c := d.dial(t)
+		// A round trip shows the connection holds a slot
+		if resp := c.roundTrip(t, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"ping"}`, i)); !strings.Contains(resp, "pong") {
+			t.Fatalf("connection %d = %s, want pong", i+1, resp)
+		}
+		open = append(open, c)
+	}
+
+	var resp response
+	decode(t, d.dial(t).recv(t), &resp)
+	if errorCode(t, resp.Error) != rpc.CodeBusy || !strings.Contains(string(resp.Error), "too many connections (max 2)") {
+		t.Fatalf("third connection = %s, want busy", resp.Error)
+	}
+
+	open[0].Close()
+	eventually(t, "a closed connection's slot to be freed", func() bool {
+		return rpc.Call(d.dir, "ping", nil, nil) == nil
+	})
+}
+
+func TestRequestTimeout(t *testing.T) {
+	d := startDaemon(t, "rpc:\n  timeouts:\n    changes: 200ms\n", rpc.StartOptions{})
+
+	var head rpc.ChangesResult
+	d.call(t, "changes", rpc.ChangesParams{}, &head)
+	// Nothing changes, so this would wait 10s without the deadline
+	start := time.Now()
+	err := rpc.Call(d.dir, "changes", rpc.ChangesParams{Epoch: head.Epoch, Since: head.Seq, Wait: 10}, nil)
+	if rpcCode(err) != rpc.CodeTimeout || !strings.Contains(err.Error(), "exceeded its 200ms deadline") {
+		t.Fatalf("changes = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timed out after %s, want about 200ms", elapsed)
+	}
+	d.call(t, "ping", nil, nil)
+}
+
+func TestRequestTimeoutsConfig(t *testing.T) {
+	timeout, err := rpc.RequestTimeouts(map[string]string{"default": "30s", "export": "0", "query": "5s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for method, want := range map[string]time.Duration{
+		"ping": 30 * time.Second, "export": 0, "query": 5 * time.Second, "import": rpc.DefaultTimeouts["import"],
+	} {
+		if got := timeout(method); got != want {
+			t.Errorf("timeout(%s) = %s, want %s", method, got, want)
+		}
+	}
+
+	if _, err := rpc.RequestTimeouts(map[string]string{"query": "soon", "sync": "-1s"}); err == nil ||
+		!strings.Contains(err.Error(), "rpc.timeouts.query") || !strings.Contains(err.Error(), "rpc.timeouts.sync") {
+		t.Errorf("invalid timeouts = %v, want both reported", err)
+	}
+	if err := rpc.ConnLimits(config.RPCConfig{IdleTimeout: "forever", ReadTimeout: "0s"}); err == nil ||
+		!strings.Contains(err.Error(), "rpc.idle_timeout") || !strings.Contains(err.Error(), "rpc.read_timeout") {
+		t.Errorf("invalid connection timeouts = %v, want both reported", err)
+	}
+}
@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/tandas/daemon/internal/sync"
+)
+
+// crashDirName is the directory under the Tandas dir holding crash reports
+const crashDirName = "crashes"
+
+// maxCrashReports is how many crash reports are kept; older ones are removed
+const maxCrashReports = 50
+
+// CrashStatus is the crash counter status reports
+type CrashStatus struct {
+	Count  int        `json:"count"`
+	Last   string     `json:"last,omitempty"`
+	LastAt *time.Time `json:"last_at,omitempty"`
+}
+
+// crashLog counts recovered panics and writes a report for each
+type crashLog struct {
+	dir string
+	mu  gosync.Mutex
+	st  CrashStatus
+}
+
+func newCrashLog(dir string) *crashLog {
+	return &crashLog{dir: filepath.Join(dir, crashDirName)}
+}
+
+// record writes a report for a panic recovered in where and returns its
+// path
+func (c *crashLog) record(where string, v interface{}, stack []byte, at time.Time) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.st.Count++
+	c.st.LastAt = &at
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create crash directory: %w", err)
+	}
+	if err := sync.IgnoreEntry(filepath.Dir(c.dir), crashDirName+"/"); err != nil {
+		slog.Warn("Failed to ignore crash reports", "err", err)
+	}
+	name := fmt.Sprintf("%s-%s.txt", at.UTC().Format("20060102T150405.000000000Z"), crashSlug(where))
+	path := filepath.Join(c.dir, name)
+	report := fmt.Sprintf("time: %s\nin: %s\nversion: %s\ngo: %s\npid: %d\npanic: %v\n\n%s",
+		at.UTC().Format(time.RFC3339Nano), where, Version, runtime.Version(), os.Getpid(), v, stack)
+	if err := os.WriteFile(path, []byte(report), 0644); err != nil {
+		return "", fmt.Errorf("failed to write crash report: %w", err)
+	}
+	c.st.Last = path
+	c.trim()
+	return path, nil
+}
+
+// trim removes the oldest reports beyond maxCrashReports; names sort by time
+func (c *crashLog) trim() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".txt") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	for len(names) > maxCrashReports {
+		os.Remove(filepath.Join(c.dir, names[0]))
+		names = names[1:]
+	}
+}
+
+func (c *crashLog) status() CrashStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.st
+}
+
+// crashSlug makes where safe for a file name: "rpc list" becomes "rpc-list"
+func crashSlug(where string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '-'
+	}, where)
+}
+
+// crashed logs a recovered panic with its stack, writes a crash report and
+// adds it to the recent errors. It returns the report's path, or "" when
+// the report could not be written.
+func (d *Daemon) crashed(where string, v interface{}) string {
+	stack := debug.Stack()
+	now := time.Now()
+	slog.Error("Recovered panic", "in", where, "panic", v, "stack", string(stack))
+	path, err := d.crashes.record(where, v, stack, now)
+	if err != nil {
+		slog.Error("Failed to write crash report", "err", err)
+	}
+	d.errors.add(fmt.Sprintf("panic in %s: %v", where, v), now)
+	return path
+}
+
+// recoverPanic keeps a panicking goroutine from taking the daemon down. It
+// must be deferred directly: defer d.recoverPanic("watcher").
+func (d *Daemon) recoverPanic(where string) {
+	if v := recover(); v != nil {
+		d.crashed(where, v)
+	}
+}
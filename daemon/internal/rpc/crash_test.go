@@ -0,0 +1,57 @@
+package rpc_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestCrashRecovery(t *testing.T) {
+	dir := t.TempDir()
+	guard, call, status := rpc.Crashes(dir)
+
+	// The handler panics on the daemon's missing state; the request fails
+	// and the daemon carries on
+	err := call("status")
+	if err == nil || err.Code != rpc.CodeInternalError || !strings.Contains(err.Message, "crash report") {
+		t.Fatalf("panicking request = %+v, want an internal error naming the crash report", err)
+	}
+	st := status()
+	if st.Count != 1 || st.Last == "" || st.LastAt == nil {
+		t.Fatalf("crash status = %+v, want one crash", st)
+	}
+	report, readErr := os.ReadFile(st.Last)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if !strings.Contains(string(report), "in: rpc status") || !strings.Contains(string(report), "goroutine") {
+		t.Errorf("crash report lacks where and the stack:\n%s", report)
+	}
+	if filepath.Dir(st.Last) != filepath.Join(dir, "crashes") {
+		t.Errorf("crash report at %s, want under crashes/", st.Last)
+	}
+
+	guard("watcher", func() { panic("boom") })
+	if st := status(); st.Count != 2 || !strings.HasSuffix(st.Last, "-watcher.txt") {
+		t.Errorf("crash status after a watcher panic = %+v", st)
+	}
+	// Crash reports are kept out of git
+	ignore, _ := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if !strings.Contains(string(ignore), "crashes/") {
+		t.Errorf(".gitignore = %q, want crashes/", ignore)
+	}
+}
+
+func TestCrashStatus(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{})
+	var status struct {
+		Crashes rpc.CrashStatus `json:"crashes"`
+	}
+	d.call(t, "status", nil, &status)
+	if status.Crashes.Count != 0 || status.Crashes.Last != "" {
+		t.Errorf("crashes on a fresh daemon = %+v", status.Crashes)
+	}
+}
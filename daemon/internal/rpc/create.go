@@ -0,0 +1,91 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/ids"
+	"github.com/tandas/daemon/internal/paths"
+)
+
+// NewIDResult is an allocated ID and when its reservation lapses
+type NewIDResult struct {
+	ID         string    `json:"id"`
+	ReservedTo time.Time `json:"reserved_until"`
+}
+
+// newID reserves the next sequential ID for a creator
+func (d *Daemon) newID() (*NewIDResult, error) {
+	used, err := d.usedIDs()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &NewIDResult{ID: d.ids.Next(used, now), ReservedTo: now.Add(ids.ReserveFor).UTC()}, nil
+}
+
+// usedIDs collects the IDs in the database and in the JSONL, which may
+// hold edits not yet imported
+func (d *Daemon) usedIDs() (map[string]bool, error) {
+	used, err := d.syncer.FileIDs()
+	if err != nil {
+		return nil, err
+	}
+	// Allocation is part of a write, which is never cut short
+	tandas, err := d.cache.all(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tandas {
+		used[t.ID] = true
+	}
+	return used, nil
+}
+
+// handleCreate writes a new tanda, allocating its ID when none is given.
+// An explicit ID must be free or reserved through new_id.
+func (d *Daemon) handleCreate(ctx context.Context, t *db.Tanda) (*db.Tanda, error) {
+	if t.Title == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+
+	if err := d.writes.acquire(ctx, "create"); err != nil {
+		return nil, err
+	}
+	defer d.writes.release()
+
+	used, err := d.usedIDs()
+	if err != nil {
+		return nil, err
+	}
+	if t.ID == "" {
+		t.ID = d.ids.Next(used, time.Now())
+	} else if used[t.ID] {
+		return nil, fmt.Errorf("tanda %s already exists", t.ID)
+	}
+	defer d.ids.Release(t.ID)
+
+	if t.Status == "" {
+		t.Status = "active"
+	}
+	paths.NormalizeTanda(d.root(), t)
+	if err := d.workflow.CheckStatus(t.Status); err != nil {
+		return nil, err
+	}
+	if err := db.CheckFields(t); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	t.CreatedAt, t.UpdatedAt = now, now
+	if err := d.journaled([]*db.Tanda{t}, func() error {
+		if err := d.db.UpsertTanda(t); err != nil {
+			return err
+		}
+		return d.commit()
+	}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
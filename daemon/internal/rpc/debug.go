@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/tandas/daemon/internal/burndown"
+)
+
+// listenDebug serves pprof profiles, runtime stats and Prometheus metrics
+// on addr, which must be a loopback address: profiles expose internals and
+// cost CPU
+func (d *Daemon) listenDebug(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid debug address %q: %w", addr, err)
+	}
+	if !isLoopback(host) {
+		return fmt.Errorf("debug address %q must be on localhost", addr)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		d.metrics.writePrometheus(w)
+		d.resources().writePrometheus(w)
+		if tandas, err := d.cache.all(r.Context()); err == nil {
+			writeQuarantinePrometheus(w, burndown.Build(tandas, burndown.Options{}, time.Now()))
+		}
+	})
+	mux.HandleFunc("/debug/runtime", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(runtimeStats(d.started))
+	})
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	d.debugServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	d.debugAddr = l.Addr().String()
+	slog.Info("Debug server listening", "url", "http://"+l.Addr().String()+"/debug/pprof/")
+	go d.debugServer.Serve(l)
+	return nil
+}
+
+// writeQuarantinePrometheus writes the quarantine burn-down over the
+// default window as Prometheus gauges, for charting flaky-test debt
+func writeQuarantinePrometheus(w io.Writer, r *burndown.Report) {
+	gauge := func(name, help string, v interface{}) { writeGauge(w, name, help, v) }
+	gauge("quarantined", "Tandas in quarantine.", r.Quarantined)
+	gauge("quarantine_entered", fmt.Sprintf("Tandas that entered quarantine in the last %d days.", burndown.DefaultDays), r.Entered)
+	gauge("quarantine_left", fmt.Sprintf("Tandas that left quarantine in the last %d days.", burndown.DefaultDays), r.Left)
+	gauge("quarantine_average_days", fmt.Sprintf("Mean days in quarantine of the tandas that left it in the last %d days.", burndown.DefaultDays), r.AverageDays)
+	gauge("quarantine_open_average_days", "Mean days in quarantine so far of the tandas still in it.", r.OpenAverageDays)
+}
+
+// runtimeStats summarizes the Go runtime for diagnosing a long-running
+// daemon
+func runtimeStats(started time.Time) map[string]interface{} {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	stats := map[string]interface{}{
+		"goroutines":     runtime.NumGoroutine(),
+		"heap_alloc":     m.HeapAlloc,
+		"heap_sys":       m.HeapSys,
+		"heap_objects":   m.HeapObjects,
+		"total_alloc":    m.TotalAlloc,
+		"sys":            m.Sys,
+		"num_gc":         m.NumGC,
+		"gc_pause_total": time.Duration(m.PauseTotalNs).String(),
+		"go_version":     runtime.Version(),
+		"gomaxprocs":     runtime.GOMAXPROCS(0),
+	}
+	if !started.IsZero() {
+		stats["uptime"] = time.Since(started).Round(time.Second).String()
+	}
+	if m.LastGC > 0 {
+		stats["last_gc"] = time.Unix(0, int64(m.LastGC)).UTC().Format(time.RFC3339)
+	}
+	return stats
+}
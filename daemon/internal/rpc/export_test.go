@@ -0,0 +1,121 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/schedule"
+)
+
+// ListenTeam starts a team listener on a daemon with no registry, for
+// tests of the listener's own checks. stop closes it.
+func ListenTeam(addr string, cfg config.TeamConfig) (stop func(), err error) {
+	d := &Daemon{done: make(chan struct{})}
+	if err := d.listenTCP(addr, cfg); err != nil {
+		return nil, err
+	}
+	return func() {
+		close(d.done)
+		d.tcpListener.Close()
+	}, nil
+}
+
+// Authorizer builds the team server's token check from cfg
+func Authorizer(cfg config.TeamConfig) (func(token, method string) error, error) {
+	a, err := newAuthenticator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return a.authorize, nil
+}
+
+var (
+	ServerTLS = serverTLS
+	ClientTLS = clientTLS
+)
+
+// PeerPolicy builds the socket policy for the allowed groups as if the
+// daemon ran as uid. allow checks a peer with the given uid and gids, and
+// check a real connection.
+func PeerPolicy(uid uint32, allowed []string) (allow func(uid uint32, gids ...uint32) error, check func(net.Conn) error, err error) {
+	p, err := newPeerPolicy(allowed)
+	p.uid = uid
+	allow = func(uid uint32, gids ...uint32) error {
+		return p.allow(peerCred{uid: uid, gids: gids})
+	}
+	return allow, p.check, err
+}
+
+// RateLimiter builds the limiter for cfg; allow takes the time so tests
+// can drive its clock
+func RateLimiter(cfg map[string]config.RateLimitConfig) (allow func(client, method string, now time.Time) (bool, time.Duration)) {
+	return newRateLimiter(cfg).allow
+}
+
+// ConnLimits checks the connection settings in cfg
+func ConnLimits(cfg config.RPCConfig) error {
+	_, err := newConnLimits(cfg)
+	return err
+}
+
+// RequestTimeouts builds the per-method deadlines from cfg
+func RequestTimeouts(cfg map[string]string) (timeout func(method string) time.Duration, err error) {
+	t, err := newRequestTracker(cfg)
+	return t.timeout, err
+}
+
+// WriteQueue exposes the write queue to tests
+type WriteQueue struct{ q *writeQueue }
+
+func NewWriteQueue() *WriteQueue { return &WriteQueue{newWriteQueue()} }
+
+func (w *WriteQueue) Acquire(ctx context.Context, job string) error { return w.q.acquire(ctx, job) }
+func (w *WriteQueue) Release()                                      { w.q.release() }
+func (w *WriteQueue) Status() WriteQueueStatus                      { return w.q.status() }
+
+// Requests builds a request tracker. start begins a request with a JSON id
+// and returns its context and the func that ends it; cancel cancels the
+// client's requests with that id.
+func Requests() (start func(client, method, id string) (context.Context, func()), cancel func(client, id string) int) {
+	t, _ := newRequestTracker(nil)
+	start = func(client, method, id string) (context.Context, func()) {
+		return t.start(client, &RPCRequest{Method: method, ID: json.RawMessage(id)})
+	}
+	return start, t.cancel
+}
+
+// RunJob registers run as a job on schedule expr, runs it once and returns
+// the job's status as the jobs RPC reports it
+func RunJob(expr string, run func() (string, error), now time.Time) (JobStatus, error) {
+	s, err := schedule.Parse(expr)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	r := newJobRunner()
+	r.add("test", s, run)
+	r.runJob(r.jobs[0])
+	return r.list(now)[0], nil
+}
+
+// Crashes builds a daemon with nothing but its crash log under dir. guard
+// runs fn, recovering a panic in where as the watchers and loops do; call
+// answers a request, and handlers that touch the missing registry panic.
+func Crashes(dir string) (guard func(where string, fn func()), call func(method string) *RPCError, status func() CrashStatus) {
+	t, _ := newRequestTracker(nil)
+	d := &Daemon{dir: dir, crashes: newCrashLog(dir), errors: &errorLog{}, requests: t}
+	guard = func(where string, fn func()) {
+		defer d.recoverPanic(where)
+		fn()
+	}
+	call = func(method string) *RPCError {
+		resp := d.run(&RPCRequest{JSONRPC: jsonrpcVersion, Method: method, ID: json.RawMessage("1")}, "local")
+		if resp.Error == "" {
+			return nil
+		}
+		return &RPCError{Code: resp.Code, Message: resp.Error}
+	}
+	return guard, call, d.crashes.status
+}
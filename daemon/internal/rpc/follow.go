@@ -0,0 +1,280 @@
+package rpc
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	gosync "sync"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// Change operations in the change log
+const (
+	OpUpsert = "upsert"
+	OpDelete = "delete"
+)
+
+const (
+	// changeLogSize bounds the changes kept for followers; one that falls
+	// further behind is sent a full snapshot
+	changeLogSize = 1000
+	// maxChangesWait caps how long a changes call blocks, under the
+	// client's 30s deadline
+	maxChangesWait = 20 * time.Second
+	followRetry    = 5 * time.Second
+)
+
+// Change is one entry in the leader's change log
+type Change struct {
+	Seq     uint64    `json:"seq"`
+	Op      string    `json:"op"`
+	TandaID string    `json:"tanda_id"`
+	Tanda   *db.Tanda `json:"tanda,omitempty"`
+}
+
+// ChangesParams asks for changes after Since in Epoch, waiting up to Wait
+// seconds for new ones
+type ChangesParams struct {
+	Epoch string `json:"epoch"`
+	Since uint64 `json:"since"`
+	Wait  int    `json:"wait,omitempty"`
+}
+
+// ChangesResult carries changes after the requested sequence. Reset means
+// the follower's position is unknown to the leader (it restarted or the
+// log was trimmed): the follower must drop its replica and apply Changes,
+// which then hold every tanda.
+type ChangesResult struct {
+	Epoch   string   `json:"epoch"`
+	Seq     uint64   `json:"seq"`
+	Reset   bool     `json:"reset,omitempty"`
+	Changes []Change `json:"changes"`
+}
+
+// changeLog records registry changes by sequence number for followers
+type changeLog struct {
+	mu      gosync.Mutex
+	epoch   string
+	seq     uint64
+	entries []Change
+	current map[string]*db.Tanda
+	sums    map[string][20]byte
+	// wake is closed and replaced whenever changes are appended
+	wake chan struct{}
+}
+
+func newChangeLog() *changeLog {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return &changeLog{
+		epoch:   hex.EncodeToString(buf),
+		current: make(map[string]*db.Tanda),
+		sums:    make(map[string][20]byte),
+		wake:    make(chan struct{}),
+	}
+}
+
+// record diffs the registry against the last snapshot and appends a
+// change for each tanda that was added, modified or removed
+func (l *changeLog) record(tandas []*db.Tanda) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seen := make(map[string]bool, len(tandas))
+	var added []Change
+	for _, t := range tandas {
+		seen[t.ID] = true
+		data, _ := json.Marshal(t)
+		sum := sha1.Sum(data)
+		if prev, ok := l.sums[t.ID]; ok && prev == sum {
+			continue
+		}
+		l.sums[t.ID] = sum
+		l.current[t.ID] = t
+		added = append(added, Change{Op: OpUpsert, TandaID: t.ID, Tanda: t})
+	}
+	for id := range l.current {
+		if !seen[id] {
+			delete(l.current, id)
+			delete(l.sums, id)
+			added = append(added, Change{Op: OpDelete, TandaID: id})
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	for i := range added {
+		l.seq++
+		added[i].Seq = l.seq
+	}
+	l.entries = append(l.entries, added...)
+	if over := len(l.entries) - changeLogSize; over > 0 {
+		l.entries = append([]Change(nil), l.entries[over:]...)
+	}
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// since returns the changes after seq, or a snapshot when seq is not in
+// this epoch's log. It blocks up to wait for changes when there are none.
+func (l *changeLog) since(epoch string, seq uint64, wait time.Duration, done <-chan struct{}) ChangesResult {
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	for {
+		l.mu.Lock()
+		result, wake := l.sinceLocked(epoch, seq)
+		l.mu.Unlock()
+		if result.Reset || len(result.Changes) > 0 || wait <= 0 {
+			return result
+		}
+		select {
+		case <-wake:
+		case <-deadline.C:
+			return result
+		case <-done:
+			return result
+		}
+	}
+}
+
+func (l *changeLog) sinceLocked(epoch string, seq uint64) (ChangesResult, chan struct{}) {
+	result := ChangesResult{Epoch: l.epoch, Seq: l.seq, Changes: []Change{}}
+	oldest := l.seq + 1
+	if len(l.entries) > 0 {
+		oldest = l.entries[0].Seq
+	}
+	if epoch != l.epoch || seq > l.seq || seq+1 < oldest {
+		result.Reset = true
+		for _, t := range l.current {
+			result.Changes = append(result.Changes, Change{Seq: l.seq, Op: OpUpsert, TandaID: t.ID, Tanda: t})
+		}
+		return result, l.wake
+	}
+	for _, c := range l.entries {
+		if c.Seq > seq {
+			result.Changes = append(result.Changes, c)
+		}
+	}
+	return result, l.wake
+}
+
+// followState is a follower's position in the leader's change log
+type followState struct {
+	mu       gosync.Mutex
+	leader   string
+	epoch    string
+	seq      uint64
+	lastSync time.Time
+	lastErr  string
+}
+
+func (f *followState) status() map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := map[string]interface{}{
+		"leader": f.leader,
+		"epoch":  f.epoch,
+		"seq":    f.seq,
+	}
+	if !f.lastSync.IsZero() {
+		status["last_sync"] = f.lastSync.UTC().Format(time.RFC3339)
+	}
+	if f.lastErr != "" {
+		status["error"] = f.lastErr
+	}
+	return status
+}
+
+// follow tails the leader's change log into the local database until the
+// daemon shuts down
+func (d *Daemon) follow(leader *TeamClient) {
+	for {
+		d.following.mu.Lock()
+		params := ChangesParams{Epoch: d.following.epoch, Since: d.following.seq, Wait: int(maxChangesWait / time.Second)}
+		d.following.mu.Unlock()
+
+		var result ChangesResult
+		err := leader.Call("changes", params, &result)
+		if err == nil {
+			err = d.applyChanges(result)
+		}
+
+		d.following.mu.Lock()
+		if err != nil {
+			if d.following.lastErr == "" {
+				slog.Warn("Following leader failed", "leader", leader.Addr, "err", err)
+			}
+			d.following.lastErr = err.Error()
+		} else {
+			if d.following.lastErr != "" {
+				slog.Info("Following leader again", "leader", leader.Addr)
+			}
+			d.following.lastErr = ""
+			d.following.epoch, d.following.seq = result.Epoch, result.Seq
+			d.following.lastSync = time.Now()
+		}
+		d.following.mu.Unlock()
+
+		if err != nil {
+			select {
+			case <-time.After(followRetry):
+			case <-d.done:
+				return
+			}
+		}
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+	}
+}
+
+// applyChanges writes a batch from the leader into the replica and into
+// this daemon's own change log, so followers can be chained
+func (d *Daemon) applyChanges(result ChangesResult) error {
+	d.writes.lock("replicate")
+	defer d.writes.release()
+
+	// One transaction, so reads never see a reset replica half replayed
+	batch, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer batch.Rollback()
+	if result.Reset {
+		if err := batch.ClearAll(); err != nil {
+			return fmt.Errorf("failed to reset replica: %w", err)
+		}
+	}
+	for _, c := range result.Changes {
+		switch c.Op {
+		case OpUpsert:
+			if c.Tanda == nil {
+				continue
+			}
+			if err := batch.UpsertTanda(c.Tanda); err != nil {
+				return fmt.Errorf("failed to apply %s: %w", c.TandaID, err)
+			}
+		case OpDelete:
+			if err := batch.DeleteTanda(c.TandaID); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", c.TandaID, err)
+			}
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+	tandas, err := d.db.GetAllTandas()
+	if err != nil {
+		return err
+	}
+	d.changes.record(tandas)
+	return nil
+}
@@ -0,0 +1,65 @@
+package rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	gosync "sync"
+	"time"
+)
+
+// recentErrorCount is how many sync errors status reports
+const recentErrorCount = 10
+
+// RecentError is one sync or import failure, as status reports it
+type RecentError struct {
+	At      time.Time `json:"at"`
+	Message string    `json:"message"`
+}
+
+// errorLog keeps the most recent sync and import errors for status
+type errorLog struct {
+	mu      gosync.Mutex
+	entries []RecentError
+}
+
+func (l *errorLog) add(msg string, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, RecentError{At: at, Message: msg})
+	if n := len(l.entries); n > recentErrorCount {
+		l.entries = append([]RecentError(nil), l.entries[n-recentErrorCount:]...)
+	}
+}
+
+// list returns the errors newest first
+func (l *errorLog) list() []RecentError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]RecentError, len(l.entries))
+	for i, e := range l.entries {
+		out[len(out)-1-i] = e
+	}
+	return out
+}
+
+// inboxPending counts the trace inbox entries still waiting to be triaged
+func inboxPending(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry struct {
+			Status string `json:"status"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Status == "pending" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,32 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/tandas/daemon/internal/impact"
+)
+
+// ImpactedParams names the changed paths, relative to the project root or
+// absolute. Without paths the daemon asks git for the files changed since
+// Base, HEAD by default.
+type ImpactedParams struct {
+	Paths []string `json:"paths,omitempty"`
+	Base  string   `json:"base,omitempty"`
+}
+
+// impacted handles the impacted RPC
+func (d *Daemon) impacted(ctx context.Context, params ImpactedParams) (*impact.Result, error) {
+	root := d.root()
+	changed := params.Paths
+	if len(changed) == 0 {
+		var err error
+		if changed, err = impact.GitChanged(root, params.Base); err != nil {
+			return nil, err
+		}
+	}
+	tandas, err := d.cache.all(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return impact.Analyze(tandas, root, d.workflow, changed), nil
+}
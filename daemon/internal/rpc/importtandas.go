@@ -0,0 +1,48 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/paths"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+// ImportTandasParams carries tandas read from another JSONL file and how
+// to combine them with the registry. Mode is merge or replace, merge by
+// default.
+type ImportTandasParams struct {
+	Tandas []*db.Tanda     `json:"tandas"`
+	Mode   sync.ImportMode `json:"mode,omitempty"`
+	DryRun bool            `json:"dry_run,omitempty"`
+}
+
+// importTandas handles the import_tandas RPC. The tandas are checked as a
+// push checks them and repeated IDs follow import.duplicates.
+func (d *Daemon) importTandas(ctx context.Context, params ImportTandasParams) (*sync.ImportPlan, error) {
+	if err := d.writes.acquire(ctx, "import_tandas"); err != nil {
+		return nil, err
+	}
+	defer d.writes.release()
+
+	root := d.root()
+	for _, t := range params.Tandas {
+		paths.NormalizeTanda(root, t)
+	}
+	opts := sync.ImportOptions{Mode: params.Mode, DryRun: params.DryRun, Duplicates: d.syncer.Duplicates(), Statuses: d.workflow}
+	if params.DryRun {
+		return sync.Import(d.db, params.Tandas, opts)
+	}
+	var plan *sync.ImportPlan
+	err := d.journaled(params.Tandas, func() error {
+		var err error
+		if plan, err = sync.Import(d.db, params.Tandas, opts); err != nil || plan.Empty() {
+			return err
+		}
+		return d.commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
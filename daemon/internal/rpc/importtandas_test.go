@@ -0,0 +1,51 @@
+package rpc_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rpc"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+func TestImportTandas(t *testing.T) {
+	d := startDaemon(t, "import:\n  duplicates: error\n", rpc.StartOptions{},
+		&db.Tanda{ID: "td-0001", Title: "Login", Status: "active"},
+		&db.Tanda{ID: "td-0002", Title: "Checkout", Status: "active"},
+	)
+	incoming := []*db.Tanda{
+		{ID: "td-0002", Title: "Checkout v2", Status: "active"},
+		{ID: "td-0003", Title: "Search", Status: "active"},
+	}
+
+	var plan sync.ImportPlan
+	d.call(t, "import_tandas", rpc.ImportTandasParams{Tandas: incoming, Mode: sync.ImportReplace, DryRun: true}, &plan)
+	if strings.Join(plan.Removed, ",") != "td-0001" || d.registry(t)["td-0001"] == nil {
+		t.Fatalf("dry run plan = %+v, want td-0001 removed and the registry untouched", plan)
+	}
+
+	d.call(t, "import_tandas", rpc.ImportTandasParams{Tandas: incoming, Mode: sync.ImportReplace}, &plan)
+	reg := d.registry(t)
+	if len(reg) != 2 || reg["td-0002"].Title != "Checkout v2" || reg["td-0003"] == nil {
+		t.Fatalf("issues.jsonl after replace = %v, want td-0002 updated and td-0003 added", reg)
+	}
+
+	for name, tandas := range map[string][]*db.Tanda{
+		"unknown status": {{ID: "td-0004", Title: "Export", Status: "retired"}},
+		"dangling ref":   {{ID: "td-0004", Title: "Export", Refs: []db.Ref{{Type: db.RefIssue}}}},
+		"duplicate id":   {{ID: "td-0004", Title: "Export"}, {ID: "td-0004", Title: "Export v2"}},
+	} {
+		if err := rpc.Call(d.dir, "import_tandas", rpc.ImportTandasParams{Tandas: tandas}, nil); err == nil {
+			t.Errorf("%s: import succeeded", name)
+		}
+	}
+	if d.registry(t)["td-0004"] != nil {
+		t.Error("a rejected import reached issues.jsonl")
+	}
+
+	err := rpc.Call(d.dir, "import_tandas", rpc.ImportTandasParams{Tandas: incoming, Mode: "overwrite"}, nil)
+	if rpcCode(err) != rpc.CodeInvalidParams {
+		t.Errorf("unknown mode = %v, want invalid params", err)
+	}
+}
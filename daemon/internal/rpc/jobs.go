@@ -0,0 +1,221 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	gosync "sync"
+	"time"
+
+	"github.com/tandas/daemon/internal/compact"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/digest"
+	"github.com/tandas/daemon/internal/remote"
+	"github.com/tandas/daemon/internal/schedule"
+	"github.com/tandas/daemon/internal/snapshot"
+)
+
+// pushJobTimeout bounds a scheduled push over ssh
+const pushJobTimeout = 10 * time.Minute
+
+// JobStatus is a scheduled job as reported by the jobs RPC
+type JobStatus struct {
+	Name     string     `json:"name"`
+	Schedule string     `json:"schedule"`
+	Next     time.Time  `json:"next"`
+	Running  bool       `json:"running"`
+	LastRun  *time.Time `json:"last_run,omitempty"`
+	Duration string     `json:"duration,omitempty"`
+	// Result summarizes the last successful run; Error is set instead
+	// when it failed
+	Result   string `json:"result,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Runs     int    `json:"runs"`
+	Failures int    `json:"failures"`
+}
+
+type job struct {
+	name     string
+	schedule *schedule.Schedule
+	run      func() (string, error)
+}
+
+// jobRunner runs maintenance jobs on their schedules. A job never overlaps
+// itself; different jobs may run at once, their writes ordered by the
+// write queue.
+type jobRunner struct {
+	jobs []*job
+
+	mu     gosync.Mutex
+	status map[string]*JobStatus
+}
+
+func newJobRunner() *jobRunner {
+	return &jobRunner{status: make(map[string]*JobStatus)}
+}
+
+func (r *jobRunner) add(name string, s *schedule.Schedule, run func() (string, error)) {
+	r.jobs = append(r.jobs, &job{name: name, schedule: s, run: run})
+	r.status[name] = &JobStatus{Name: name, Schedule: s.String()}
+}
+
+// start runs every job on its schedule until done is closed
+func (r *jobRunner) start(done <-chan struct{}) {
+	for _, j := range r.jobs {
+		j := j
+		go j.schedule.Run(done, func() { r.runJob(j) })
+	}
+}
+
+func (r *jobRunner) runJob(j *job) {
+	r.mu.Lock()
+	r.status[j.name].Running = true
+	r.mu.Unlock()
+
+	start := time.Now()
+	result, err := j.run()
+	elapsed := time.Since(start)
+	if err != nil {
+		slog.Error("Scheduled job failed", "job", j.name, "err", err)
+	} else {
+		slog.Info("Scheduled job finished", "job", j.name, "result", result, "duration", elapsed.Round(time.Millisecond))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.status[j.name]
+	st.Running = false
+	st.LastRun = &start
+	st.Duration = elapsed.Round(time.Millisecond).String()
+	st.Runs++
+	st.Result, st.Error = result, ""
+	if err != nil {
+		st.Result, st.Error = "", err.Error()
+		st.Failures++
+	}
+}
+
+// list returns every job, by name, with its next run after now
+func (r *jobRunner) list(now time.Time) []JobStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := make([]JobStatus, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		st := *r.status[j.name]
+		st.Next = j.schedule.Next(now)
+		jobs = append(jobs, st)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].Name < jobs[b].Name })
+	return jobs
+}
+
+// scheduleJobs registers the jobs config asks for. Prune and digest fall
+// back to their own schedule settings; a follower skips the jobs that
+// would write its leader's registry.
+func (d *Daemon) scheduleJobs(cfg *config.Config, follower bool, startup *StartupReport) {
+	jobs := cfg.Jobs
+	if jobs.Prune == "" {
+		jobs.Prune = cfg.Prune.Schedule
+	}
+	if jobs.Digest == "" {
+		jobs.Digest = cfg.Digest.Schedule
+	}
+	if follower {
+		jobs.Prune, jobs.Push = "", ""
+	}
+
+	add := func(name, expr string, check func() error, run func() (string, error)) {
+		if expr == "" {
+			return
+		}
+		s, err := schedule.Parse(expr)
+		if err == nil && check != nil {
+			err = check()
+		}
+		if err != nil {
+			slog.Warn("Scheduled job disabled", "job", name, "err", err)
+			startup.degrade(name, err)
+			return
+		}
+		d.jobs.add(name, s, func() (result string, err error) {
+			// A panicking job fails this run; its schedule carries on
+			defer func() {
+				if v := recover(); v != nil {
+					err = fmt.Errorf("panic: %v (crash report: %s)", v, d.crashed("job "+name, v))
+				}
+			}()
+			return run()
+		})
+	}
+
+	add("prune", jobs.Prune, func() error {
+		if d.prune.Empty() {
+			return fmt.Errorf("prune schedule set without keep_runs, keep_days or note_days")
+		}
+		return nil
+	}, func() (string, error) {
+		result, err := d.runPrune(context.Background(), d.prune, false)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d run(s) and %d note(s) from %d tanda(s)", result.Runs, result.Notes, result.Tandas), nil
+	})
+
+	add("compact", jobs.Compact, nil, func() (string, error) {
+		d.writes.lock("compact")
+		defer d.writes.release()
+		result, err := compact.Run(d.dir, d.db, compact.Options{}, time.Now())
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d trace(s), %d snapshot(s); database %d to %d bytes",
+			result.Traces, result.Snapshots, result.DBBytesBefore, result.DBBytesAfter), nil
+	})
+
+	add("snapshot", jobs.Snapshot, nil, func() (string, error) {
+		// Not mid-export, so issues.jsonl matches the database
+		d.writes.lock("snapshot")
+		defer d.writes.release()
+		m, err := snapshot.Create(d.dir, "", "scheduled", time.Now())
+		if err != nil {
+			return "", err
+		}
+		return "created " + m.Name, nil
+	})
+
+	add("digest", jobs.Digest, nil, func() (string, error) {
+		dg, err := digest.Run(d.dir, d.db, cfg.Digest, d.workflow, false)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d run(s), %d failure(s)", dg.Runs, dg.Failures), nil
+	})
+
+	var target *remote.Target
+	add("push", jobs.Push, func() error {
+		name := jobs.Remote
+		if name == "" {
+			name = "origin"
+		}
+		raw, ok := cfg.Remotes[name]
+		if !ok {
+			return fmt.Errorf("unknown remote %q for the push job (add it under remotes)", name)
+		}
+		var err error
+		target, err = remote.Parse(raw)
+		return err
+	}, func() (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), pushJobTimeout)
+		defer cancel()
+		pushed, err := remote.Push(ctx, target, filepath.Join(d.dir, "issues.jsonl"), false)
+		if err != nil {
+			return "", err
+		}
+		if !pushed {
+			return target.String() + " is up to date", nil
+		}
+		return "pushed to " + target.String(), nil
+	})
+}
@@ -0,0 +1,59 @@
+package rpc_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestJobs(t *testing.T) {
+	d := startDaemon(t, "jobs:\n  snapshot: \"@daily\"\n  compact: \"0 3 * * 0\"\n  prune: \"*/5 * * * *\"\n", rpc.StartOptions{})
+
+	var jobs []rpc.JobStatus
+	d.call(t, "jobs", nil, &jobs)
+	if len(jobs) != 2 || jobs[0].Name != "compact" || jobs[1].Name != "snapshot" {
+		t.Fatalf("jobs = %+v, want compact and snapshot", jobs)
+	}
+	for _, j := range jobs {
+		if !j.Next.After(time.Now()) || j.Runs != 0 || j.LastRun != nil {
+			t.Errorf("job %s before its first run = %+v", j.Name, j)
+		}
+	}
+
+	// prune without keep_* settings is disabled, and startup says why
+	var status struct {
+		Startup rpc.StartupReport `json:"startup"`
+	}
+	d.call(t, "status", nil, &status)
+	found := false
+	for _, deg := range status.Startup.Degraded {
+		found = found || deg.Subsystem == "prune"
+	}
+	if !found {
+		t.Errorf("startup = %+v, want prune reported disabled", status.Startup)
+	}
+}
+
+func TestJobStatus(t *testing.T) {
+	now := time.Now()
+	st, err := rpc.RunJob("@hourly", func() (string, error) { return "3 run(s) pruned", nil }, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Runs != 1 || st.Failures != 0 || st.Result != "3 run(s) pruned" || st.LastRun == nil || st.Running {
+		t.Errorf("status after a run = %+v", st)
+	}
+	if st.Schedule != "@hourly" {
+		t.Errorf("schedule = %q", st.Schedule)
+	}
+
+	st, err = rpc.RunJob("@hourly", func() (string, error) { return "", errors.New("disk full") }, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Failures != 1 || st.Error != "disk full" || st.Result != "" {
+		t.Errorf("status after a failure = %+v", st)
+	}
+}
@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"log/slog"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/journal"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+// openJournal opens the write journal in dir, keeping it out of git
+func openJournal(dir string) (*journal.Journal, error) {
+	if err := sync.IgnoreEntry(dir, journal.FileName); err != nil {
+		return nil, err
+	}
+	return journal.Open(dir)
+}
+
+// journaled records tandas in the journal before apply stores them, and
+// marks the write done once apply returns. Only a crash leaves it pending.
+// Callers hold the write queue.
+func (d *Daemon) journaled(tandas []*db.Tanda, apply func() error) error {
+	seq, err := d.journal.Begin(journal.Write, tandas)
+	if err != nil {
+		return err
+	}
+	err = apply()
+	if derr := d.journal.Done(seq); derr != nil {
+		slog.Warn("Failed to mark write done", "err", derr)
+	}
+	return err
+}
+
+// recoverJournal finishes the writes a crashed daemon left in the journal.
+// An interrupted import needs nothing more: its transaction rolled back
+// and the startup import has reloaded issues.jsonl. Interrupted writes are
+// merged in again, which changes nothing if they had already landed, and
+// exported. A follower drops them; its registry comes from the leader.
+func (d *Daemon) recoverJournal() error {
+	pending := d.journal.Pending()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	d.writes.lock("recover")
+	defer d.writes.release()
+	var writes []*db.Tanda
+	interrupted := 0
+	for _, e := range pending {
+		switch e.Op {
+		case journal.Import:
+			slog.Info("Recovered interrupted import", "started", e.At)
+		case journal.Write:
+			writes = append(writes, e.Tandas...)
+			interrupted++
+		}
+	}
+	if interrupted > 0 && d.following == nil {
+		changed, err := sync.MergeInto(d.db, writes)
+		if err != nil {
+			return err
+		}
+		if len(changed) > 0 {
+			if err := d.commit(); err != nil {
+				return err
+			}
+		}
+		slog.Info("Recovered interrupted writes", "writes", interrupted, "changed", len(changed))
+	}
+	return d.journal.Resolve()
+}
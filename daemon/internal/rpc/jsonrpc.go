@@ -0,0 +1,141 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonrpcVersion marks JSON-RPC 2.0 requests and responses. Requests
+// without it are answered in the daemon's original format, where error is
+// a plain string.
+const jsonrpcVersion = "2.0"
+
+// JSON-RPC 2.0 error codes; the -32000 range is the daemon's own
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// CodeServerError is a method that failed
+	CodeServerError  = -32000
+	CodeUnauthorized = -32001
+	CodeRateLimited  = -32002
+	CodeReadOnly     = -32003
+	CodeProtocol     = -32004
+	CodeBusy         = -32005
+	CodeNotFound     = -32006
+	CodeTimeout      = -32007
+	CodeCancelled    = -32008
+)
+
+// RPCError is a JSON-RPC 2.0 error object. Call returns one, wrapped, when
+// the daemon reports a failure.
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// errorResponse answers req with err under a JSON-RPC error code
+func errorResponse(req *RPCRequest, code int, err error) *RPCResponse {
+	return &RPCResponse{Error: err.Error(), Code: code, ID: req.ID}
+}
+
+// MarshalJSON encodes the response for the request's protocol: a JSON-RPC
+// 2.0 response with an error object, or the original format
+func (r RPCResponse) MarshalJSON() ([]byte, error) {
+	id := r.ID
+	if r.JSONRPC != jsonrpcVersion {
+		if len(id) == 0 {
+			id = json.RawMessage("0")
+		}
+		return json.Marshal(struct {
+			Result interface{}     `json:"result,omitempty"`
+			Error  string          `json:"error,omitempty"`
+			ID     json.RawMessage `json:"id"`
+		}{r.Result, r.Error, id})
+	}
+
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	// protocol tells clients which ProtocolVersion answered
+	if r.Error == "" {
+		return json.Marshal(struct {
+			JSONRPC  string          `json:"jsonrpc"`
+			Result   interface{}     `json:"result"`
+			ID       json.RawMessage `json:"id"`
+			Protocol int             `json:"protocol"`
+		}{jsonrpcVersion, r.Result, id, ProtocolVersion})
+	}
+	code := r.Code
+	if code == 0 {
+		code = CodeServerError
+	}
+	return json.Marshal(struct {
+		JSONRPC  string          `json:"jsonrpc"`
+		Error    RPCError        `json:"error"`
+		ID       json.RawMessage `json:"id"`
+		Protocol int             `json:"protocol"`
+	}{jsonrpcVersion, RPCError{Code: code, Message: r.Error, Data: r.Data}, id, ProtocolVersion})
+}
+
+// parseRequest decodes one request, or returns the invalid request error
+// to send back
+func parseRequest(raw json.RawMessage) (*RPCRequest, *RPCResponse) {
+	var req RPCRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		var probe struct {
+			JSONRPC string          `json:"jsonrpc"`
+			ID      json.RawMessage `json:"id"`
+		}
+		if json.Unmarshal(raw, &probe) != nil {
+			probe.JSONRPC = jsonrpcVersion
+		}
+		return nil, &RPCResponse{JSONRPC: probe.JSONRPC, Error: fmt.Sprintf("invalid request: %v", err), Code: CodeInvalidRequest, ID: probe.ID}
+	}
+	if req.JSONRPC != "" && req.JSONRPC != jsonrpcVersion {
+		return nil, &RPCResponse{JSONRPC: jsonrpcVersion, Error: fmt.Sprintf("invalid request: unsupported jsonrpc version %q", req.JSONRPC), Code: CodeInvalidRequest, ID: req.ID}
+	}
+	if req.Method == "" {
+		return nil, &RPCResponse{JSONRPC: req.JSONRPC, Error: "invalid request: method is required", Code: CodeInvalidRequest, ID: req.ID}
+	}
+	return &req, nil
+}
+
+// notification reports whether req expects no response: a JSON-RPC 2.0
+// request without an id
+func (req *RPCRequest) notification() bool {
+	return req.JSONRPC == jsonrpcVersion && len(req.ID) == 0
+}
+
+// isBatch reports whether raw is a JSON-RPC 2.0 batch array
+func isBatch(raw json.RawMessage) bool {
+	trimmed := bytes.TrimLeft(raw, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// responseError reads the error of a response in either format
+func responseError(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var message string
+	if json.Unmarshal(raw, &message) == nil {
+		if message == "" {
+			return nil
+		}
+		return &RPCError{Code: CodeServerError, Message: message}
+	}
+	var rpcErr RPCError
+	if err := json.Unmarshal(raw, &rpcErr); err != nil {
+		return fmt.Errorf("malformed error in response: %w", err)
+	}
+	return &rpcErr
+}
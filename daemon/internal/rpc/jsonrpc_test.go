@@ -0,0 +1,131 @@
+package rpc_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+// response is either wire format, decoded loosely
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   json.RawMessage `json:"error"`
+	ID      json.RawMessage `json:"id"`
+}
+
+func decode(t *testing.T, line string, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(line), v); err != nil {
+		t.Fatalf("response %s: %v", line, err)
+	}
+}
+
+// errorCode returns the code of a JSON-RPC 2.0 error object
+func errorCode(t *testing.T, raw json.RawMessage) int {
+	t.Helper()
+	var e rpc.RPCError
+	if err := json.Unmarshal(raw, &e); err != nil {
+		t.Fatalf("error %s is not an object: %v", raw, err)
+	}
+	return e.Code
+}
+
+func TestJSONRPC(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{})
+	c := d.dial(t)
+
+	t.Run("id is echoed", func(t *testing.T) {
+		for _, id := range []string{`"abc"`, `7`, `null`} {
+			var resp response
+			decode(t, c.roundTrip(t, `{"jsonrpc":"2.0","id":`+id+`,"method":"ping"}`), &resp)
+			if resp.JSONRPC != "2.0" || string(resp.ID) != id || string(resp.Result) != `"pong"` {
+				t.Errorf("ping with id %s = %+v", id, resp)
+			}
+		}
+	})
+
+	t.Run("notifications get no response", func(t *testing.T) {
+		c.send(t, `{"jsonrpc":"2.0","method":"ping"}`)
+		c.send(t, `{"jsonrpc":"2.0","method":"no_such_method"}`)
+		var resp response
+		decode(t, c.roundTrip(t, `{"jsonrpc":"2.0","id":2,"method":"ping"}`), &resp)
+		if string(resp.ID) != "2" {
+			t.Fatalf("first response after notifications = %+v, want id 2", resp)
+		}
+		// A batch of notifications is not answered either
+		c.send(t, `[{"jsonrpc":"2.0","method":"ping"},{"jsonrpc":"2.0","method":"ping"}]`)
+		decode(t, c.roundTrip(t, `{"jsonrpc":"2.0","id":3,"method":"ping"}`), &resp)
+		if string(resp.ID) != "3" {
+			t.Fatalf("response after a notification batch = %+v, want id 3", resp)
+		}
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		var resp response
+		decode(t, c.roundTrip(t, `[]`), &resp)
+		if code := errorCode(t, resp.Error); code != rpc.CodeInvalidRequest {
+			t.Errorf("empty batch code = %d, want %d", code, rpc.CodeInvalidRequest)
+		}
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		var resps []response
+		decode(t, c.roundTrip(t, `[{"jsonrpc":"2.0","id":1,"method":"ping"},`+
+			`{"jsonrpc":"2.0","method":"ping"},`+
+			`{"method":"ping","id":2},`+
+			`{"jsonrpc":"2.0","id":3,"method":"no_such_method"}]`), &resps)
+		if len(resps) != 3 {
+			t.Fatalf("batch answered %d requests, want 3 (the notification is skipped)", len(resps))
+		}
+		if string(resps[0].Result) != `"pong"` {
+			t.Errorf("batched ping = %+v", resps[0])
+		}
+		// Batches are 2.0 only, so the legacy request inside is invalid
+		if resps[1].JSONRPC != "2.0" || errorCode(t, resps[1].Error) != rpc.CodeInvalidRequest {
+			t.Errorf("legacy request in a batch = %+v, want an invalid request error", resps[1])
+		}
+		if errorCode(t, resps[2].Error) != rpc.CodeMethodNotFound || string(resps[2].ID) != "3" {
+			t.Errorf("unknown method in a batch = %+v", resps[2])
+		}
+	})
+
+	t.Run("legacy requests", func(t *testing.T) {
+		var resp response
+		decode(t, c.roundTrip(t, `{"method":"ping","id":4}`), &resp)
+		if resp.JSONRPC != "" || string(resp.Result) != `"pong"` || string(resp.ID) != "4" {
+			t.Errorf("legacy ping = %+v", resp)
+		}
+		// The original format's error is a plain string
+		decode(t, c.roundTrip(t, `{"method":"no_such_method","id":5}`), &resp)
+		var message string
+		if err := json.Unmarshal(resp.Error, &message); err != nil || message == "" {
+			t.Errorf("legacy error = %s, want a string", resp.Error)
+		}
+		// A 2.0 request after legacy ones on the same connection is answered as 2.0
+		decode(t, c.roundTrip(t, `{"jsonrpc":"2.0","id":6,"method":"ping"}`), &resp)
+		if resp.JSONRPC != "2.0" {
+			t.Errorf("2.0 ping after legacy = %+v", resp)
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for _, req := range []string{`{"jsonrpc":"1.0","id":1,"method":"ping"}`, `{"jsonrpc":"2.0","id":1}`} {
+			var resp response
+			decode(t, c.roundTrip(t, req), &resp)
+			if errorCode(t, resp.Error) != rpc.CodeInvalidRequest {
+				t.Errorf("%s = %+v, want an invalid request error", req, resp)
+			}
+		}
+	})
+
+	t.Run("parse error", func(t *testing.T) {
+		c := d.dial(t)
+		var resp response
+		decode(t, c.roundTrip(t, `{"jsonrpc":"2.0","id":1,"method":}`), &resp)
+		if resp.JSONRPC != "2.0" || errorCode(t, resp.Error) != rpc.CodeParseError || string(resp.ID) != "null" {
+			t.Errorf("parse error = %+v, want code %d and a null id", resp, rpc.CodeParseError)
+		}
+	})
+}
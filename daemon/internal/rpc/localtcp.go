@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tandas/daemon/internal/config"
+)
+
+// tokenFileName holds the generated token for the localhost TCP listener,
+// readable only by the daemon's user
+const tokenFileName = "daemon.token"
+
+// transport is how a connection reached the daemon
+type transport int
+
+const (
+	// transportSocket is the unix socket, guarded by peer credentials
+	transportSocket transport = iota
+	// transportLocalTCP is the localhost TCP listener, for containers and
+	// WSL; it serves every method but each request needs the daemon token
+	transportLocalTCP
+	// transportTeam is the team listener, limited to teamMethods
+	transportTeam
+)
+
+// listenLocalTCP serves the local RPCs on a loopback address such as
+// tcp://127.0.0.1:0. Requests must carry token, or a generated one that is
+// written to daemon.token when token is empty.
+func (d *Daemon) listenLocalTCP(addr, token string) error {
+	addr = strings.TrimPrefix(addr, "tcp://")
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	if !isLoopback(host) {
+		return fmt.Errorf("listen address %q must be on localhost; use team mode to serve other hosts", addr)
+	}
+
+	if token == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return fmt.Errorf("failed to generate token: %w", err)
+		}
+		token = hex.EncodeToString(buf)
+		// WriteFile keeps an existing file's mode, which may be wider
+		path := filepath.Join(d.dir, tokenFileName)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to replace token file: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+			return fmt.Errorf("failed to write token file: %w", err)
+		}
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	d.localListener = l
+	d.localToken = token
+	slog.Info("Local TCP listening", "addr", l.Addr().String())
+	go d.acceptLoop(l, transportLocalTCP)
+	return nil
+}
+
+// isLoopback reports whether a listen host only accepts connections from
+// this machine. An empty host listens on every interface.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkLocalToken authorizes a request on the localhost TCP listener
+func (d *Daemon) checkLocalToken(token string) error {
+	if token == "" {
+		return errors.New("unauthorized: a token is required over TCP")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(d.localToken)) != 1 {
+		return errors.New("unauthorized: invalid token")
+	}
+	return nil
+}
+
+// localToken returns the token for dir's localhost TCP listener: the
+// generated one in daemon.token, else rpc.token from config
+func localToken(dir string) string {
+	if data, err := os.ReadFile(filepath.Join(dir, tokenFileName)); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	if cfg, err := config.Load(dir); err == nil {
+		return cfg.RPC.Token
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package rpc_test
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestLocalTCPRequiresLoopback(t *testing.T) {
+	for _, addr := range []string{"tcp://0.0.0.0:0", "tcp://:0", "tcp://192.0.2.1:0"} {
+		root, err := os.MkdirTemp("", "td")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+		err = rpc.StartDaemon(root, "1h", rpc.StartOptions{Listen: addr})
+		if err == nil || !strings.Contains(err.Error(), "must be on localhost") {
+			t.Errorf("StartDaemon on %s = %v, want a localhost error", addr, err)
+		}
+	}
+}
+
+func TestLocalTCPToken(t *testing.T) {
+	root, err := os.MkdirTemp("", "td")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, ".tandas")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A token file left readable by a crashed daemon is replaced
+	tokenPath := filepath.Join(dir, "daemon.token")
+	if err := os.WriteFile(tokenPath, []byte("stale\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := startIn(t, dir, rpc.StartOptions{Listen: "tcp://127.0.0.1:0"})
+
+	info, err := os.Stat(tokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("daemon.token mode = %o, want 600", mode)
+	}
+	token, err := os.ReadFile(tokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := rpc.ReadLockFile(d.dir)
+	if err != nil || lock.TCP == "" {
+		t.Fatalf("lock file has no TCP address: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"missing token", "", "a token is required"},
+		{"wrong token", "stale", "invalid token"},
+		{"token from the file", strings.TrimSpace(string(token)), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := net.Dial("tcp", lock.TCP)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			c.SetDeadline(time.Now().Add(10 * time.Second))
+			req, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "ping", "token": tt.token})
+			c.Write(append(req, '\n'))
+			var resp struct {
+				Result string        `json:"result"`
+				Error  *rpc.RPCError `json:"error"`
+			}
+			if err := json.NewDecoder(c).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if resp.Error != nil || resp.Result != "pong" {
+					t.Fatalf("ping = %+v, %v; want pong", resp.Result, resp.Error)
+				}
+				return
+			}
+			if resp.Error == nil || resp.Error.Code != rpc.CodeUnauthorized || !strings.Contains(resp.Error.Message, tt.want) {
+				t.Fatalf("ping error = %+v, want unauthorized: %s", resp.Error, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package rpc
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/tandas/daemon/internal/logging"
+)
+
+// defaultLogLimit is how many records the logs RPC returns by default
+const defaultLogLimit = 100
+
+// LogsParams asks for the newest Limit records at or above Level (debug,
+// info, warn or error; default info). A Limit of zero means 100.
+type LogsParams struct {
+	Level string `json:"level,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// logs handles the logs RPC from the daemon's in-memory log ring
+func logs(params LogsParams) ([]logging.Record, error) {
+	level := slog.LevelInfo
+	if params.Level != "" {
+		if err := level.UnmarshalText([]byte(params.Level)); err != nil {
+			return nil, fmt.Errorf("invalid level %q (want debug, info, warn or error)", params.Level)
+		}
+	}
+	if params.Limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative")
+	}
+	limit := params.Limit
+	if limit == 0 {
+		limit = defaultLogLimit
+	}
+	return logging.Recent.Records(level, limit), nil
+}
@@ -0,0 +1,264 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tandas/daemon/internal/bisect"
+	"github.com/tandas/daemon/internal/burndown"
+	"github.com/tandas/daemon/internal/cluster"
+	"github.com/tandas/daemon/internal/compact"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/editor"
+	"github.com/tandas/daemon/internal/environment"
+	"github.com/tandas/daemon/internal/export"
+	"github.com/tandas/daemon/internal/graph"
+	"github.com/tandas/daemon/internal/heatmap"
+	"github.com/tandas/daemon/internal/impact"
+	"github.com/tandas/daemon/internal/leaderboard"
+	"github.com/tandas/daemon/internal/logging"
+	"github.com/tandas/daemon/internal/orphans"
+	"github.com/tandas/daemon/internal/prune"
+	"github.com/tandas/daemon/internal/requirements"
+	"github.com/tandas/daemon/internal/rundiff"
+	"github.com/tandas/daemon/internal/schema"
+	"github.com/tandas/daemon/internal/slo"
+	"github.com/tandas/daemon/internal/stale"
+	"github.com/tandas/daemon/internal/sync"
+	"github.com/tandas/daemon/internal/trend"
+	"github.com/tandas/daemon/internal/webhook"
+)
+
+// SchemaFile and TandaSchemaFile are the names the published schemas are
+// exported under; the RPC schema refers to the tanda schema by its name
+const (
+	SchemaFile      = "rpc.schema.json"
+	TandaSchemaFile = "tanda.schema.json"
+)
+
+// GetParams names the tanda get returns
+type GetParams struct {
+	ID string `json:"id"`
+}
+
+// FlakinessTrendParams names the tanda and the windows, such as 7d, to
+// compute its flakiness over
+type FlakinessTrendParams struct {
+	TandaID string   `json:"tanda_id"`
+	Windows []string `json:"windows"`
+}
+
+// ClustersParams sets the smallest failure cluster reported, 2 by default
+type ClustersParams struct {
+	MinSize int `json:"min_size"`
+}
+
+// GraphParams picks the tanda the graph starts from and, for a rendered
+// graph rather than the structured one, its format
+type GraphParams struct {
+	Root   string `json:"root"`
+	Format string `json:"format"`
+}
+
+// ExecutionOrderParams limits the schedule to some tandas
+type ExecutionOrderParams struct {
+	IDs []string `json:"ids"`
+	// IncludeDeps adds the tandas' transitive dependencies
+	IncludeDeps bool `json:"include_deps"`
+}
+
+// CoverageGapsParams names the requirements manifest to check
+type CoverageGapsParams struct {
+	Manifest string `json:"manifest"`
+}
+
+// StaleParams sets how many days without a run make a tanda stale
+type StaleParams struct {
+	Days int `json:"days"`
+}
+
+// BisectParams names the tanda to bisect
+type BisectParams struct {
+	TandaID string `json:"tanda_id"`
+}
+
+// OrphanedPathsParams asks for renames along with the missing paths
+type OrphanedPathsParams struct {
+	// Renames suggests where git moved each missing path
+	Renames bool `json:"renames"`
+}
+
+// ExportParams selects the tandas to export and the format
+type ExportParams struct {
+	db.Filter
+	export.Options
+	Format string `json:"format"`
+	// Output is the directory parquet and markdown files are written to
+	Output string `json:"output"`
+}
+
+// CoveredByParams names the source path to find covering tandas for
+type CoveredByParams struct {
+	Path string `json:"path"`
+	// Prefix also matches covers under Path as a directory
+	Prefix bool `json:"prefix"`
+}
+
+// TandasForFileParams names a file, relative to the project root or
+// absolute, and optionally the lines of it in view
+type TandasForFileParams struct {
+	Path  string         `json:"path"`
+	Lines []db.LineRange `json:"lines,omitempty"`
+}
+
+// CodeLensParams names the test file to decorate, relative to the project
+// root or absolute
+type CodeLensParams struct {
+	Path string `json:"path"`
+}
+
+// SchemaParams names the schema to return: tanda, the default, or rpc
+type SchemaParams struct {
+	Name string `json:"name"`
+}
+
+// ValidateParams carries the document to check against the tanda schema
+type ValidateParams struct {
+	Document json.RawMessage `json:"document"`
+}
+
+// WebhookDeliveriesParams filters the recent webhook deliveries
+type WebhookDeliveriesParams struct {
+	Limit  int    `json:"limit"`
+	Status string `json:"status"`
+}
+
+// CancelParams names the request to cancel by its JSON-RPC id
+type CancelParams struct {
+	ID json.RawMessage `json:"id"`
+}
+
+// Message is the Go shape of a method's params and result, from which the
+// published RPC schema is derived; nil leaves either unconstrained, as for
+// results whose shape depends on the params
+type Message struct {
+	Params interface{}
+	Result interface{}
+}
+
+// Messages gives each method in Methods its message shapes
+var Messages = map[string]Message{
+	"ping":                 {nil, ""},
+	"capabilities":         {nil, Capabilities{}},
+	"cancel":               {CancelParams{}, map[string]int{}},
+	"heartbeat":            {ProgressParams{}, ""},
+	"progress":             {ProgressParams{}, ""},
+	"sync":                 {nil, ""},
+	"import":               {nil, ""},
+	"import_tandas":        {ImportTandasParams{}, sync.ImportPlan{}},
+	"status":               {nil, map[string]interface{}{}},
+	"query":                {db.Filter{}, []*db.Tanda{}},
+	"get":                  {GetParams{}, db.Tanda{}},
+	"flakiness_trend":      {FlakinessTrendParams{}, []trend.Trend{}},
+	"failure_clusters":     {ClustersParams{}, []cluster.Cluster{}},
+	"graph":                {GraphParams{}, nil},
+	"execution_order":      {ExecutionOrderParams{}, graph.Schedule{}},
+	"coverage_gaps":        {CoverageGapsParams{}, requirements.Report{}},
+	"stale":                {StaleParams{}, []stale.Finding{}},
+	"heatmap":              {heatmap.Options{}, heatmap.Node{}},
+	"environment_failures": {environment.Options{}, environment.Report{}},
+	"leaderboard":          {leaderboard.Options{}, leaderboard.Board{}},
+	"quarantine_burndown":  {burndown.Options{}, burndown.Report{}},
+	"run_diff":             {rundiff.Options{}, rundiff.Diff{}},
+	"bisect":               {BisectParams{}, bisect.Result{}},
+	"compact":              {compact.Options{}, compact.Result{}},
+	"prune":                {PruneParams{}, prune.Result{}},
+	"orphaned_paths":       {OrphanedPathsParams{}, []orphans.Finding{}},
+	"export":               {ExportParams{}, nil},
+	"slo_status":           {nil, []slo.Status{}},
+	"push":                 {PushParams{}, PushResult{}},
+	"record_run":           {RecordRunParams{}, db.Tanda{}},
+	"new_id":               {nil, NewIDResult{}},
+	"create":               {db.Tanda{}, db.Tanda{}},
+	"transaction":          {TransactionParams{}, TransactionResult{}},
+	"triage":               {TriageParams{}, db.Tanda{}},
+	"add_note":             {AddNoteParams{}, db.Tanda{}},
+	"jobs":                 {nil, []JobStatus{}},
+	"stats":                {nil, map[string]interface{}{}},
+	"logs":                 {LogsParams{}, []logging.Record{}},
+	"run":                  {RunParams{}, RunStatus{}},
+	"run_output":           {RunOutputParams{}, RunOutputResult{}},
+	"run_cancel":           {RunCancelParams{}, RunStatus{}},
+	"tail":                 {TailParams{}, TailResult{}},
+	"changes":              {ChangesParams{}, ChangesResult{}},
+	"delta":                {DeltaParams{}, DeltaResult{}},
+	"covered_by":           {CoveredByParams{}, []*db.Tanda{}},
+	"tandas_for_file":      {TandasForFileParams{}, []editor.Entry{}},
+	"code_lens":            {CodeLensParams{}, []editor.Lens{}},
+	"impacted":             {ImpactedParams{}, impact.Result{}},
+	"badge":                {BadgeParams{}, BadgeResult{}},
+	"schema":               {SchemaParams{}, map[string]interface{}{}},
+	"validate":             {ValidateParams{}, ValidateResult{}},
+	"webhook_deliveries":   {WebhookDeliveriesParams{}, []webhook.Delivery{}},
+}
+
+// Schema returns the JSON Schema of the RPC messages: the JSON-RPC 2.0
+// request, response and error, and the params and result of each method
+// as <method>.params and <method>.result under $defs. Tandas refer to the
+// tanda schema in TandaSchemaFile beside it.
+func Schema() ([]byte, error) {
+	g := schema.NewGenerator()
+	g.Ref(db.Tanda{}, TandaSchemaFile)
+	defs := g.Defs()
+	for _, m := range Methods {
+		msg, ok := Messages[m]
+		if !ok {
+			return nil, fmt.Errorf("method %s has no message shapes", m)
+		}
+		defs[m+".params"] = g.Schema(msg.Params)
+		defs[m+".result"] = g.Schema(msg.Result)
+	}
+
+	id := map[string]interface{}{"type": []string{"string", "integer", "null"}}
+	defs["Request"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"method"},
+		"properties": map[string]interface{}{
+			"jsonrpc":  map[string]interface{}{"const": jsonrpcVersion},
+			"method":   map[string]interface{}{"enum": Methods},
+			"params":   map[string]interface{}{"description": "The method's <method>.params"},
+			"id":       id,
+			"token":    map[string]interface{}{"type": "string", "description": "Authenticates requests on TCP listeners"},
+			"protocol": map[string]interface{}{"type": "integer", "description": "The client's protocol; omitted skips the check"},
+		},
+	}
+	defs["Error"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"code", "message"},
+		"properties": map[string]interface{}{
+			"code":    map[string]interface{}{"type": "integer"},
+			"message": map[string]interface{}{"type": "string"},
+			"data":    map[string]interface{}{},
+		},
+	}
+	defs["Response"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"jsonrpc", "id"},
+		"properties": map[string]interface{}{
+			"jsonrpc":  map[string]interface{}{"const": jsonrpcVersion},
+			"result":   map[string]interface{}{"description": "The method's <method>.result"},
+			"error":    map[string]interface{}{"$ref": "#/$defs/Error"},
+			"id":       id,
+			"protocol": map[string]interface{}{"type": "integer"},
+		},
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         SchemaFile,
+		"title":       "Tandas RPC",
+		"description": fmt.Sprintf("JSON-RPC 2.0 messages of td-daemon %s, protocol %d", Version, ProtocolVersion),
+		"$ref":        "#/$defs/Request",
+		"$defs":       defs,
+	}, "", "  ")
+}
@@ -0,0 +1,158 @@
+package rpc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	gosync "sync"
+	"time"
+)
+
+// latencyWindow is how many recent calls of a method its percentiles are
+// taken over
+const latencyWindow = 1024
+
+// otherMethod counts calls to methods the daemon doesn't have, so made-up
+// names can't grow the metrics without bound
+const otherMethod = "other"
+
+// quantiles are the latency percentiles reported per method
+var quantiles = []float64{0.5, 0.9, 0.99}
+
+// MethodStats is one method's calls as reported by the stats RPC
+type MethodStats struct {
+	Method string  `json:"method"`
+	Calls  uint64  `json:"calls"`
+	Errors uint64  `json:"errors"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+type methodMetrics struct {
+	calls  uint64
+	errors uint64
+	total  time.Duration
+	max    time.Duration
+	// recent is a ring of the latest latencies
+	recent []time.Duration
+	next   int
+}
+
+// rpcMetrics counts calls, errors and latency per RPC method
+type rpcMetrics struct {
+	known map[string]bool
+
+	mu      gosync.Mutex
+	methods map[string]*methodMetrics
+}
+
+func newRPCMetrics() *rpcMetrics {
+	known := make(map[string]bool, len(Methods))
+	for _, m := range Methods {
+		known[m] = true
+	}
+	return &rpcMetrics{known: known, methods: make(map[string]*methodMetrics)}
+}
+
+// observe records one call of method that took d
+func (m *rpcMetrics) observe(method string, d time.Duration, failed bool) {
+	if !m.known[method] {
+		method = otherMethod
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mm := m.methods[method]
+	if mm == nil {
+		mm = &methodMetrics{}
+		m.methods[method] = mm
+	}
+	mm.calls++
+	if failed {
+		mm.errors++
+	}
+	mm.total += d
+	if d > mm.max {
+		mm.max = d
+	}
+	if len(mm.recent) < latencyWindow {
+		mm.recent = append(mm.recent, d)
+	} else {
+		mm.recent[mm.next] = d
+		mm.next = (mm.next + 1) % latencyWindow
+	}
+}
+
+// stats returns every called method's metrics, by name
+func (m *rpcMetrics) stats() []MethodStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := make([]MethodStats, 0, len(m.methods))
+	for name, mm := range m.methods {
+		q := mm.quantiles()
+		stats = append(stats, MethodStats{
+			Method: name,
+			Calls:  mm.calls,
+			Errors: mm.errors,
+			MeanMs: ms(mm.total / time.Duration(mm.calls)),
+			P50Ms:  ms(q[0]),
+			P90Ms:  ms(q[1]),
+			P99Ms:  ms(q[2]),
+			MaxMs:  ms(mm.max),
+		})
+	}
+	sort.Slice(stats, func(a, b int) bool { return stats[a].Method < stats[b].Method })
+	return stats
+}
+
+// writePrometheus writes the metrics in the Prometheus text format
+func (m *rpcMetrics) writePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.methods))
+	for name := range m.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP tandas_rpc_calls_total RPC calls by method.")
+	fmt.Fprintln(w, "# TYPE tandas_rpc_calls_total counter")
+	for _, name := range names {
+		fmt.Fprintf(w, "tandas_rpc_calls_total{method=%q} %d\n", name, m.methods[name].calls)
+	}
+	fmt.Fprintln(w, "# HELP tandas_rpc_errors_total RPC calls answered with an error, by method.")
+	fmt.Fprintln(w, "# TYPE tandas_rpc_errors_total counter")
+	for _, name := range names {
+		fmt.Fprintf(w, "tandas_rpc_errors_total{method=%q} %d\n", name, m.methods[name].errors)
+	}
+	fmt.Fprintf(w, "# HELP tandas_rpc_duration_seconds RPC latency by method, quantiles over the last %d calls.\n", latencyWindow)
+	fmt.Fprintln(w, "# TYPE tandas_rpc_duration_seconds summary")
+	for _, name := range names {
+		mm := m.methods[name]
+		for i, v := range mm.quantiles() {
+			fmt.Fprintf(w, "tandas_rpc_duration_seconds{method=%q,quantile=\"%g\"} %g\n", name, quantiles[i], v.Seconds())
+		}
+		fmt.Fprintf(w, "tandas_rpc_duration_seconds_sum{method=%q} %g\n", name, mm.total.Seconds())
+		fmt.Fprintf(w, "tandas_rpc_duration_seconds_count{method=%q} %d\n", name, mm.calls)
+	}
+}
+
+// quantiles returns the latency at each of quantiles over recent calls
+func (mm *methodMetrics) quantiles() []time.Duration {
+	sorted := append([]time.Duration(nil), mm.recent...)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+	out := make([]time.Duration, len(quantiles))
+	if len(sorted) == 0 {
+		return out
+	}
+	for i, q := range quantiles {
+		out[i] = sorted[int(q*float64(len(sorted)-1))]
+	}
+	return out
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
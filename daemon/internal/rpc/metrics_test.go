@@ -0,0 +1,79 @@
+package rpc_test
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestDebugRequiresLoopback(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:0", ":0", "192.0.2.1:0", "localhost.example.com:0"} {
+		root, err := os.MkdirTemp("", "td")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+		err = rpc.StartDaemon(root, "1h", rpc.StartOptions{Debug: addr})
+		if err == nil || !strings.Contains(err.Error(), "must be on localhost") {
+			t.Errorf("StartDaemon with debug on %s = %v, want a localhost error", addr, err)
+		}
+	}
+}
+
+func TestMethodMetrics(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{Debug: "127.0.0.1:0"})
+	for i := 0; i < 3; i++ {
+		d.call(t, "capabilities", nil, nil)
+	}
+	rpc.Call(d.dir, "get", rpc.GetParams{ID: "td-9999"}, nil)
+	rpc.Call(d.dir, "no_such_method", nil, nil)
+	rpc.Call(d.dir, "another_made_up_method", nil, nil)
+
+	var stats struct {
+		Methods []rpc.MethodStats `json:"methods"`
+	}
+	d.call(t, "stats", nil, &stats)
+	byMethod := make(map[string]rpc.MethodStats)
+	for _, m := range stats.Methods {
+		byMethod[m.Method] = m
+	}
+	if m := byMethod["capabilities"]; m.Calls != 3 || m.Errors != 0 || m.MaxMs < m.P50Ms {
+		t.Errorf("capabilities stats = %+v, want 3 calls", m)
+	}
+	if m := byMethod["get"]; m.Calls != 1 || m.Errors != 1 {
+		t.Errorf("get stats = %+v, want 1 failed call", m)
+	}
+	// Unknown methods share one entry
+	if m := byMethod["other"]; m.Calls != 2 || m.Errors != 2 {
+		t.Errorf("other stats = %+v, want 2 failed calls", m)
+	}
+	if _, ok := byMethod["no_such_method"]; ok {
+		t.Error("an unknown method got its own metrics")
+	}
+
+	var status struct {
+		Debug string `json:"debug"`
+	}
+	d.call(t, "status", nil, &status)
+	url := strings.TrimSuffix(status.Debug, "debug/pprof/") + "metrics"
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`tandas_rpc_calls_total{method="capabilities"} 3`,
+		`tandas_rpc_errors_total{method="get"} 1`,
+		`tandas_rpc_duration_seconds{method="capabilities",quantile="0.99"}`,
+		`tandas_rpc_duration_seconds_count{method="other"} 2`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("%s lacks %s:\n%s", url, want, body)
+		}
+	}
+}
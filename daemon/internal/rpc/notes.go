@@ -0,0 +1,76 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tandas/daemon/internal/blobs"
+	"github.com/tandas/daemon/internal/db"
+)
+
+// AddNoteParams is the payload of the add_note RPC. Parent is the key of
+// the note replied to. Attachments must already be stored under
+// .tandas/blobs, as blobs.Put leaves them.
+type AddNoteParams struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type,omitempty"`
+	Author      string          `json:"author,omitempty"`
+	Parent      string          `json:"parent,omitempty"`
+	Text        string          `json:"text"`
+	Attachments []db.Attachment `json:"attachments,omitempty"`
+}
+
+// handleAddNote appends a note to a tanda, checking that the note replied
+// to exists and every attachment is stored and within the size limit
+func (d *Daemon) handleAddNote(ctx context.Context, params AddNoteParams) (*db.Tanda, error) {
+	if params.ID == "" {
+		return nil, errors.New("id is required")
+	}
+	if params.Text == "" && len(params.Attachments) == 0 {
+		return nil, errors.New("text or an attachment is required")
+	}
+	if params.Type == "" {
+		params.Type = "note"
+	}
+	for _, a := range params.Attachments {
+		if a.Size > d.maxAttachment {
+			return nil, fmt.Errorf("attachment %s is %d bytes, over the %d byte limit", a.Name, a.Size, d.maxAttachment)
+		}
+		if err := blobs.Check(d.dir, a); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.writes.acquire(ctx, "add_note"); err != nil {
+		return nil, err
+	}
+	defer d.writes.release()
+
+	t, err := d.db.GetTanda(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, fmt.Errorf("tanda %s not found", params.ID)
+	}
+	if params.Parent != "" && db.FindNote(t.Notes, params.Parent) < 0 {
+		return nil, fmt.Errorf("tanda %s has no note %s", params.ID, params.Parent)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	n := db.Note{Timestamp: now, Type: params.Type, Author: params.Author, Parent: params.Parent,
+		Text: params.Text, Attachments: params.Attachments}
+	n.ID = db.NoteID(n)
+	t.Notes = append(t.Notes, n)
+	t.UpdatedAt = now
+	if err := d.journaled([]*db.Tanda{t}, func() error {
+		if err := d.db.UpsertTanda(t); err != nil {
+			return err
+		}
+		return d.commit()
+	}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,117 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// errPeerCredUnsupported is returned where the OS can't report who is on
+// the other end of a unix socket; such peers are let through
+var errPeerCredUnsupported = errors.New("peer credentials are not supported on this platform")
+
+// peerCred is the user behind a unix socket connection
+type peerCred struct {
+	uid  uint32
+	gids []uint32
+}
+
+// peerPolicy decides which local users may use the socket: the daemon's
+// own user, root, which can read the registry files anyway, and members
+// of the groups allowed in config
+type peerPolicy struct {
+	uid    uint32
+	groups map[uint32]bool
+	// group owns the socket, the first allowed group; -1 leaves it alone
+	group int
+}
+
+// newPeerPolicy resolves the allowed groups, by name or gid. Unknown
+// groups are skipped and reported.
+func newPeerPolicy(allowed []string) (*peerPolicy, error) {
+	p := &peerPolicy{uid: uint32(os.Getuid()), groups: make(map[uint32]bool), group: -1}
+	var errs []error
+	for _, name := range allowed {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			g, err = user.LookupGroupId(name)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unknown group %q in rpc.allowed_groups", name))
+			continue
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unusable gid %q for group %q", g.Gid, name))
+			continue
+		}
+		p.groups[uint32(gid)] = true
+		if p.group < 0 {
+			p.group = int(gid)
+		}
+	}
+	return p, errors.Join(errs...)
+}
+
+// socketMode is the permission td.sock is given: the daemon's user only,
+// or its group too when other groups are allowed
+func (p *peerPolicy) socketMode() os.FileMode {
+	if len(p.groups) > 0 {
+		return 0660
+	}
+	return 0600
+}
+
+// check returns an error naming the peer when it may not use the socket
+func (p *peerPolicy) check(conn net.Conn) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+	cred, err := peerCredentials(uc)
+	if errors.Is(err, errPeerCredUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read peer credentials: %w", err)
+	}
+	return p.allow(cred)
+}
+
+// allow returns an error naming the peer unless the policy admits it
+func (p *peerPolicy) allow(cred peerCred) error {
+	if cred.uid == p.uid || cred.uid == 0 {
+		return nil
+	}
+	if len(p.groups) > 0 {
+		for _, gid := range append(cred.gids, supplementaryGroups(cred.uid)...) {
+			if p.groups[gid] {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("uid %d is not allowed to use this socket", cred.uid)
+}
+
+// supplementaryGroups returns the groups uid belongs to besides the ones
+// the kernel reported for the connection
+func supplementaryGroups(uid uint32) []uint32 {
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return nil
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil
+	}
+	var gids []uint32
+	for _, id := range ids {
+		if gid, err := strconv.ParseUint(id, 10, 32); err == nil {
+			gids = append(gids, uint32(gid))
+		}
+	}
+	return gids
+}
@@ -0,0 +1,32 @@
+//go:build darwin || freebsd
+
+package rpc
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredentials reads LOCAL_PEERCRED, which carries the peer's groups
+func peerCredentials(conn *net.UnixConn) (peerCred, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return peerCred{}, err
+	}
+	var xucred *unix.Xucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		xucred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	}); err != nil {
+		return peerCred{}, err
+	}
+	if credErr != nil {
+		return peerCred{}, credErr
+	}
+	cred := peerCred{uid: xucred.Uid}
+	for _, gid := range xucred.Groups[:xucred.Ngroups] {
+		cred.gids = append(cred.gids, gid)
+	}
+	return cred, nil
+}
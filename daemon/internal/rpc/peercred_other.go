@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+
+package rpc
+
+import "net"
+
+func peerCredentials(conn *net.UnixConn) (peerCred, error) {
+	return peerCred{}, errPeerCredUnsupported
+}
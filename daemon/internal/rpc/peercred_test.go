@@ -0,0 +1,102 @@
+package rpc_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+// stranger is a uid with no account, so it belongs to no groups
+const stranger = 4000000
+
+func TestPeerPolicy(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("group lookups by gid are tested on Linux")
+	}
+	daemonUID := uint32(os.Getuid()) + 1
+
+	_, _, err := rpc.PeerPolicy(daemonUID, []string{"no-such-group-td"})
+	if err == nil || !strings.Contains(err.Error(), `unknown group "no-such-group-td"`) {
+		t.Errorf("unknown group = %v, want an error naming it", err)
+	}
+
+	allow, _, err := rpc.PeerPolicy(daemonUID, []string{"0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		uid  uint32
+		gids []uint32
+		ok   bool
+	}{
+		{"daemon's own user", daemonUID, nil, true},
+		{"root", 0, nil, true},
+		{"member of an allowed group", stranger, []uint32{0}, true},
+		{"other user", stranger, []uint32{stranger}, false},
+		{"other user without groups", stranger, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := allow(tt.uid, tt.gids...)
+			if tt.ok && err != nil {
+				t.Fatalf("allow = %v, want nil", err)
+			}
+			if !tt.ok && (err == nil || !strings.Contains(err.Error(), "is not allowed")) {
+				t.Fatalf("allow = %v, want a refusal", err)
+			}
+		})
+	}
+
+	closed, _, err := rpc.PeerPolicy(daemonUID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := closed(stranger, 0); err == nil {
+		t.Error("groups should not admit anyone when none are allowed")
+	}
+}
+
+func TestPeerPolicyConnection(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_PEERCRED is Linux only")
+	}
+	root, err := os.MkdirTemp("", "td")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	l, err := net.Listen("unix", filepath.Join(root, "s.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		if c, err := net.Dial("unix", l.Addr().String()); err == nil {
+			defer c.Close()
+			c.Read(make([]byte, 1))
+		}
+	}()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, check, _ := rpc.PeerPolicy(uint32(os.Getuid()), nil)
+	if err := check(conn); err != nil {
+		t.Errorf("the daemon's own user was refused: %v", err)
+	}
+	// Root is always let in, so a refusal is only seen running as another user
+	if os.Getuid() != 0 {
+		_, check, _ = rpc.PeerPolicy(uint32(os.Getuid())+1, nil)
+		if err := check(conn); err == nil {
+			t.Error("a peer running as another user was let in")
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package rpc
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/tandas/daemon/internal/prune"
+)
+
+// PruneParams are the prune RPC's limits; when none is set the configured
+// ones apply
+type PruneParams struct {
+	prune.Options
+	DryRun bool `json:"dry_run"`
+}
+
+// runPrune trims run history and notes, archiving what it removes, and
+// exports the registry when anything changed
+func (d *Daemon) runPrune(ctx context.Context, opts prune.Options, dryRun bool) (*prune.Result, error) {
+	if opts.Empty() {
+		opts = d.prune
+	}
+	if err := d.writes.acquire(ctx, "prune"); err != nil {
+		return nil, err
+	}
+	defer d.writes.release()
+
+	result, err := prune.Run(d.db, filepath.Join(d.dir, prune.ArchiveFile), opts, time.Now(), dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || result.Tandas == 0 {
+		return result, nil
+	}
+	return result, d.commit()
+}
@@ -0,0 +1,136 @@
+package rpc
+
+import (
+	"context"
+	gosync "sync"
+	"time"
+)
+
+// writeQueue runs registry mutations one at a time, in the order they
+// arrive, while reads go to the cache and SQLite in parallel. Imports and
+// replication apply in one transaction, so reads see the registry before
+// or after them and need no lock of their own.
+type writeQueue struct {
+	mu gosync.Mutex
+	// busy is set while a job holds the queue; waiting are the turns of
+	// the jobs behind it, oldest first
+	busy      bool
+	waiting   []chan struct{}
+	depth     int
+	maxDepth  int
+	job       string
+	since     time.Time
+	completed uint64
+	abandoned uint64
+}
+
+// WriteQueueStatus is the write queue as reported by status
+type WriteQueueStatus struct {
+	Depth     int        `json:"depth"`
+	MaxDepth  int        `json:"max_depth"`
+	Running   string     `json:"running,omitempty"`
+	Since     *time.Time `json:"since,omitempty"`
+	Completed uint64     `json:"completed"`
+	Abandoned uint64     `json:"abandoned"`
+}
+
+func newWriteQueue() *writeQueue {
+	return &writeQueue{}
+}
+
+// acquire waits for job's turn. It gives up if ctx is done first, so a
+// write whose caller already timed out or cancelled is never applied.
+func (q *writeQueue) acquire(ctx context.Context, job string) error {
+	q.mu.Lock()
+	q.depth++
+	if q.depth > q.maxDepth {
+		q.maxDepth = q.depth
+	}
+	turn := make(chan struct{})
+	if q.busy {
+		q.waiting = append(q.waiting, turn)
+	} else {
+		q.busy = true
+		close(turn)
+	}
+	q.mu.Unlock()
+
+	var err error
+	select {
+	case <-turn:
+		// Both may be ready at once; a done ctx still wins
+		err = ctx.Err()
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.depth--
+	if err != nil {
+		q.abandoned++
+		if !q.leave(turn) {
+			// The turn came anyway; hand it on
+			q.next()
+		}
+		return err
+	}
+	q.job = job
+	q.since = time.Now()
+	return nil
+}
+
+// lock waits for job's turn without a deadline, for the daemon's own
+// writes
+func (q *writeQueue) lock(job string) {
+	q.acquire(context.Background(), job)
+}
+
+// release ends the running job and lets the next one start
+func (q *writeQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.job = ""
+	q.since = time.Time{}
+	q.completed++
+	q.next()
+}
+
+// next gives the queue to the oldest waiting job, or frees it
+func (q *writeQueue) next() {
+	if len(q.waiting) == 0 {
+		q.busy = false
+		return
+	}
+	close(q.waiting[0])
+	q.waiting = q.waiting[1:]
+}
+
+// leave drops a turn that was never given, reporting whether it was
+// still waiting
+func (q *writeQueue) leave(turn chan struct{}) bool {
+	for i, w := range q.waiting {
+		if w == turn {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (q *writeQueue) status() WriteQueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st := WriteQueueStatus{
+		Depth:     q.depth,
+		MaxDepth:  q.maxDepth,
+		Running:   q.job,
+		Completed: q.completed,
+		Abandoned: q.abandoned,
+	}
+	if q.job != "" {
+		since := q.since
+		st.Since = &since
+	}
+	return st
+}
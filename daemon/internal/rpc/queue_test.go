@@ -0,0 +1,59 @@
+package rpc_test
+
+import (
+	"context"
+	"fmt"
+	gosync "sync"
+	"testing"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestWriteQueueOrder(t *testing.T) {
+	const writers = 20
+	q := rpc.NewWriteQueue()
+	if err := q.Acquire(context.Background(), "holder"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The registry the writers mutate; the queue is its only lock
+	var order []int
+	running := 0
+	var wg gosync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := q.Acquire(context.Background(), fmt.Sprintf("write %d", i)); err != nil {
+				t.Error(err)
+				return
+			}
+			running++
+			if running != 1 {
+				t.Errorf("%d writes ran at once", running)
+			}
+			order = append(order, i)
+			running--
+			q.Release()
+		}(i)
+		// Queue each writer behind the last, so arrival order is known
+		eventually(t, fmt.Sprintf("write %d to queue", i), func() bool { return q.Status().Depth == i+1 })
+	}
+	if st := q.Status(); st.MaxDepth != writers || st.Running != "holder" {
+		t.Errorf("status with writers queued = %+v", st)
+	}
+	q.Release()
+	wg.Wait()
+
+	if len(order) != writers {
+		t.Fatalf("%d writes ran, want %d", len(order), writers)
+	}
+	for i, w := range order {
+		if w != i {
+			t.Fatalf("writes ran in order %v, want arrival order", order)
+		}
+	}
+	if st := q.Status(); st.Depth != 0 || st.Completed != writers+1 || st.Running != "" {
+		t.Errorf("status after the writes = %+v", st)
+	}
+}
@@ -0,0 +1,129 @@
+package rpc
+
+import (
+	"fmt"
+	"math"
+	gosync "sync"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+)
+
+// DefaultRateLimits throttle the methods that read or rewrite the whole
+// registry. Other methods are unlimited unless configured.
+var DefaultRateLimits = map[string]config.RateLimitConfig{
+	"export": {PerMinute: 60, Burst: 10},
+	"import": {PerMinute: 60, Burst: 10},
+	"sync":   {PerMinute: 60, Burst: 10},
+	"delta":  {PerMinute: 60, Burst: 10},
+	"push":   {PerMinute: 60, Burst: 10},
+}
+
+// maxBuckets bounds the buckets kept before full ones are pruned
+const maxBuckets = 4096
+
+// bucketKey identifies a client's allowance for one method
+type bucketKey struct {
+	client string
+	method string
+}
+
+// bucket is a token bucket; tokens refill continuously up to burst
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter throttles methods per client, so one busy client does not
+// use up another's allowance
+type rateLimiter struct {
+	limits map[string]config.RateLimitConfig
+
+	mu      gosync.Mutex
+	buckets map[bucketKey]*bucket
+	limited map[string]int64
+}
+
+// newRateLimiter applies configured limits over DefaultRateLimits. A limit
+// of 0 per minute removes the default for that method.
+func newRateLimiter(cfg map[string]config.RateLimitConfig) *rateLimiter {
+	limits := make(map[string]config.RateLimitConfig)
+	for method, l := range DefaultRateLimits {
+		limits[method] = l
+	}
+	for method, l := range cfg {
+		if l.PerMinute <= 0 {
+			delete(limits, method)
+			continue
+		}
+		if l.Burst <= 0 {
+			l.Burst = 1
+		}
+		limits[method] = l
+	}
+	return &rateLimiter{
+		limits:  limits,
+		buckets: make(map[bucketKey]*bucket),
+		limited: make(map[string]int64),
+	}
+}
+
+// allow takes a token for client calling method at now. When none is left
+// it returns how long until one is.
+func (r *rateLimiter) allow(client, method string, now time.Time) (bool, time.Duration) {
+	l, ok := r.limits[method]
+	if !ok {
+		return true, 0
+	}
+	rate := l.PerMinute / 60
+	burst := float64(l.Burst)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := bucketKey{client, method}
+	b, ok := r.buckets[key]
+	if !ok {
+		if len(r.buckets) >= maxBuckets {
+			r.prune(now)
+		}
+		b = &bucket{tokens: burst, last: now}
+		r.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	r.limited[method]++
+	return false, time.Duration(math.Ceil((1-b.tokens)/rate)) * time.Second
+}
+
+// prune drops buckets that have refilled, which behave like new ones
+func (r *rateLimiter) prune(now time.Time) {
+	for key, b := range r.buckets {
+		l := r.limits[key.method]
+		if b.tokens+now.Sub(b.last).Seconds()*l.PerMinute/60 >= float64(l.Burst) {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// status returns the configured limits and how many calls each rejected
+func (r *rateLimiter) status() map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]interface{}, len(r.limits))
+	for method, l := range r.limits {
+		out[method] = map[string]interface{}{
+			"per_minute": l.PerMinute,
+			"burst":      l.Burst,
+			"limited":    r.limited[method],
+		}
+	}
+	return out
+}
+
+func rateLimitError(method string, wait time.Duration) string {
+	return fmt.Sprintf("rate limit exceeded for %s; retry in %s", method, wait)
+}
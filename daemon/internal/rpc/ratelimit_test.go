@@ -0,0 +1,89 @@
+package rpc_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestRateLimiter(t *testing.T) {
+	allow := rpc.RateLimiter(map[string]config.RateLimitConfig{
+		"query":  {PerMinute: 6, Burst: 2},
+		"export": {PerMinute: 0},
+		"get":    {PerMinute: 60},
+	})
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := allow("a", "query", now); !ok {
+			t.Fatalf("call %d within the burst was limited", i+1)
+		}
+	}
+	ok, wait := allow("a", "query", now)
+	if ok || wait != 10*time.Second {
+		t.Fatalf("call over the burst = %v, retry in %s; want limited for 10s", ok, wait)
+	}
+	if ok, _ := allow("b", "query", now); !ok {
+		t.Error("another client's allowance was used up")
+	}
+
+	// 6 a minute refills one call every 10s
+	if ok, wait := allow("a", "query", now.Add(4*time.Second)); ok || wait != 6*time.Second {
+		t.Errorf("after 4s = %v, retry in %s; want limited for 6s", ok, wait)
+	}
+	if ok, _ := allow("a", "query", now.Add(10*time.Second)); !ok {
+		t.Error("a refilled call was limited")
+	}
+	if ok, _ := allow("a", "query", now.Add(10*time.Second)); ok {
+		t.Error("only one call should have refilled")
+	}
+
+	for i := 0; i < 100; i++ {
+		if ok, _ := allow("a", "export", now); !ok {
+			t.Fatal("per_minute 0 should remove the default export limit")
+		}
+		if ok, _ := allow("a", "ping", now); !ok {
+			t.Fatal("methods without a limit should not be limited")
+		}
+	}
+	// A burst of 0 still allows one call
+	if ok, _ := allow("a", "get", now); !ok {
+		t.Error("first get was limited")
+	}
+	if ok, _ := allow("a", "get", now); ok {
+		t.Error("burst 0 should allow a single call")
+	}
+	// Methods not configured keep their default limit
+	for i := 0; i < rpc.DefaultRateLimits["push"].Burst; i++ {
+		allow("a", "push", now)
+	}
+	if ok, _ := allow("a", "push", now); ok {
+		t.Error("the default push limit was not applied")
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	d := startDaemon(t, "rpc:\n  max_request_bytes: 1024\n  rate_limits:\n    status: {per_minute: 1, burst: 1}\n", rpc.StartOptions{})
+
+	d.call(t, "status", nil, nil)
+	err := rpc.Call(d.dir, "status", nil, nil)
+	var rpcErr *rpc.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != rpc.CodeRateLimited {
+		t.Fatalf("second status = %v, want rate limited", err)
+	}
+	if data, _ := rpcErr.Data.(map[string]interface{}); data["retry_after"] == nil {
+		t.Errorf("rate limit error data = %v, want retry_after", rpcErr.Data)
+	}
+
+	// An oversize request is answered, not dropped
+	c := d.dial(t)
+	var resp response
+	decode(t, c.roundTrip(t, `{"jsonrpc":"2.0","id":1,"method":"query","params":{"title":"`+strings.Repeat("x", 4096)+`"}}`), &resp)
+	if errorCode(t, resp.Error) != rpc.CodeInvalidRequest || !strings.Contains(string(resp.Error), "request too large") {
+		t.Errorf("oversize request = %s, want request too large", resp.Error)
+	}
+}
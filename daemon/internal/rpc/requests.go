@@ -0,0 +1,192 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	gosync "sync"
+	"time"
+)
+
+// DefaultRequestTimeout bounds methods with no deadline of their own
+const DefaultRequestTimeout = time.Minute
+
+// DefaultTimeouts give the methods that read or rewrite the whole registry
+// longer. The rpc.timeouts config overrides them; its "default" key
+// replaces DefaultRequestTimeout and 0 removes a deadline.
+var DefaultTimeouts = map[string]time.Duration{
+	"import":  10 * time.Minute,
+	"sync":    10 * time.Minute,
+	"export":  10 * time.Minute,
+	"compact": 10 * time.Minute,
+	"prune":   10 * time.Minute,
+}
+
+// inflightKey identifies a request for cancel: a client's request ID
+type inflightKey struct {
+	client string
+	id     string
+}
+
+// requestTracker applies per-method deadlines and cancels in-flight
+// requests by ID
+type requestTracker struct {
+	timeouts map[string]time.Duration
+	fallback time.Duration
+
+	mu       gosync.Mutex
+	seq      uint64
+	inflight map[inflightKey]map[uint64]context.CancelFunc
+}
+
+func newRequestTracker(cfg map[string]string) (*requestTracker, error) {
+	t := &requestTracker{
+		timeouts: make(map[string]time.Duration),
+		fallback: DefaultRequestTimeout,
+		inflight: make(map[inflightKey]map[uint64]context.CancelFunc),
+	}
+	for method, d := range DefaultTimeouts {
+		t.timeouts[method] = d
+	}
+	var errs []error
+	for method, s := range cfg {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			errs = append(errs, fmt.Errorf("invalid rpc.timeouts.%s %q", method, s))
+			continue
+		}
+		if method == "default" {
+			t.fallback = d
+			continue
+		}
+		t.timeouts[method] = d
+	}
+	return t, errors.Join(errs...)
+}
+
+// timeout returns method's deadline; zero means none
+func (t *requestTracker) timeout(method string) time.Duration {
+	if d, ok := t.timeouts[method]; ok {
+		return d
+	}
+	return t.fallback
+}
+
+// start returns the context req runs under and a func to call once it is
+// answered
+func (t *requestTracker) start(client string, req *RPCRequest) (context.Context, func()) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if d := t.timeout(req.Method); d > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), d)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	id := requestID(req.ID)
+	if id == "" {
+		return ctx, cancel
+	}
+
+	key := inflightKey{client, id}
+	t.mu.Lock()
+	t.seq++
+	seq := t.seq
+	if t.inflight[key] == nil {
+		t.inflight[key] = make(map[uint64]context.CancelFunc)
+	}
+	t.inflight[key][seq] = cancel
+	t.mu.Unlock()
+
+	return ctx, func() {
+		t.mu.Lock()
+		delete(t.inflight[key], seq)
+		if len(t.inflight[key]) == 0 {
+			delete(t.inflight, key)
+		}
+		t.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel cancels client's in-flight requests with id, returning how many
+func (t *requestTracker) cancel(client, id string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cancels := t.inflight[inflightKey{client, id}]
+	for _, cancel := range cancels {
+		cancel()
+	}
+	return len(cancels)
+}
+
+func (t *requestTracker) status() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, cancels := range t.inflight {
+		n += len(cancels)
+	}
+	return map[string]interface{}{
+		"in_flight":       n,
+		"default_timeout": t.fallback.String(),
+	}
+}
+
+// requestID normalizes a request ID for matching; JSON null and a missing
+// ID are both empty
+func requestID(raw []byte) string {
+	id := strings.TrimSpace(string(raw))
+	if id == "null" {
+		return ""
+	}
+	return id
+}
+
+// run answers req under its method's deadline. A handler still busy when
+// the deadline passes or the request is cancelled carries on in the
+// background, but the client is answered at once and its connection is
+// free for the next request.
+func (d *Daemon) run(req *RPCRequest, client string) *RPCResponse {
+	ctx, done := d.requests.start(client, req)
+	defer done()
+
+	result := make(chan *RPCResponse, 1)
+	go func() {
+		// A panicking handler fails its request rather than the daemon
+		defer func() {
+			if v := recover(); v != nil {
+				report := d.crashed("rpc "+req.Method, v)
+				result <- errorResponse(req, CodeInternalError, fmt.Errorf("internal error in %s (crash report: %s)", req.Method, report))
+			}
+		}()
+		result <- d.handleRequest(ctx, req)
+	}()
+	var resp *RPCResponse
+	select {
+	case resp = <-result:
+		if resp.Error == "" || ctx.Err() == nil {
+			return resp
+		}
+	case <-ctx.Done():
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errorResponse(req, CodeTimeout, fmt.Errorf("%s exceeded its %s deadline", req.Method, d.requests.timeout(req.Method)))
+	}
+	return errorResponse(req, CodeCancelled, fmt.Errorf("%s was cancelled", req.Method))
+}
+
+// cancelRequest handles the cancel method: params {"id": ...} name a
+// request the same client has in flight
+func (d *Daemon) cancelRequest(req *RPCRequest, client string) *RPCResponse {
+	var params CancelParams
+	if err := decodeParams(req, &params); err != nil {
+		return errorResponse(req, CodeInvalidParams, err)
+	}
+	id := requestID(params.ID)
+	if id == "" {
+		return errorResponse(req, CodeInvalidParams, errors.New("id is required"))
+	}
+	n := d.requests.cancel(client, id)
+	return &RPCResponse{Result: map[string]int{"cancelled": n}, ID: req.ID}
+}
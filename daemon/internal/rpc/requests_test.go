@@ -0,0 +1,94 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestCancel(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{})
+	var head rpc.ChangesResult
+	d.call(t, "changes", rpc.ChangesParams{}, &head)
+
+	// changes blocks for up to 10s while nothing changes
+	c := d.dial(t)
+	c.send(t, fmt.Sprintf(`{"jsonrpc":"2.0","id":42,"method":"changes","params":{"epoch":%q,"since":%d,"wait":10}}`, head.Epoch, head.Seq))
+	eventually(t, "the request to be in flight", func() bool {
+		var status struct {
+			Requests struct {
+				InFlight int `json:"in_flight"`
+			} `json:"requests"`
+		}
+		// status itself is in flight while it runs
+		return rpc.Call(d.dir, "status", nil, &status) == nil && status.Requests.InFlight == 2
+	})
+
+	start := time.Now()
+	var result map[string]int
+	d.call(t, "cancel", map[string]int{"id": 42}, &result)
+	if result["cancelled"] != 1 {
+		t.Fatalf("cancel = %v, want 1 cancelled", result)
+	}
+	var resp response
+	decode(t, c.recv(t), &resp)
+	if errorCode(t, resp.Error) != rpc.CodeCancelled || string(resp.ID) != "42" {
+		t.Fatalf("cancelled request = %+v, want a cancelled error for id 42", resp)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("answered %s after cancel", elapsed)
+	}
+	// The connection is free for the next request
+	if got := c.roundTrip(t, `{"jsonrpc":"2.0","id":43,"method":"ping"}`); got == "" {
+		t.Error("no response after the cancelled request")
+	}
+
+	d.call(t, "cancel", map[string]int{"id": 42}, &result)
+	if result["cancelled"] != 0 {
+		t.Errorf("cancel of a finished request = %v, want 0", result)
+	}
+	if err := rpc.Call(d.dir, "cancel", map[string]int{}, nil); rpcCode(err) != rpc.CodeInvalidParams {
+		t.Errorf("cancel without an id = %v, want invalid params", err)
+	}
+}
+
+func TestCancelFreesWriteSlot(t *testing.T) {
+	q := rpc.NewWriteQueue()
+	if err := q.Acquire(context.Background(), "import"); err != nil {
+		t.Fatal(err)
+	}
+	start, cancel := rpc.Requests()
+	ctx, done := start("local", "push", "7")
+	defer done()
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- q.Acquire(ctx, "push") }()
+	eventually(t, "the push to queue", func() bool { return q.Status().Depth == 1 })
+
+	if n := cancel("other", "7"); n != 0 {
+		t.Errorf("another client cancelled %d requests", n)
+	}
+	if n := cancel("local", "7"); n != 1 {
+		t.Fatalf("cancel = %d, want 1", n)
+	}
+	if err := <-acquired; !errors.Is(err, context.Canceled) {
+		t.Fatalf("queued write = %v, want cancelled", err)
+	}
+	if st := q.Status(); st.Depth != 0 || st.Abandoned != 1 || st.Running != "import" {
+		t.Errorf("status after cancel = %+v", st)
+	}
+
+	// The cancelled push never holds the slot, so the next write follows
+	// the import directly
+	q.Release()
+	next, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	if err := q.Acquire(next, "sync"); err != nil {
+		t.Fatalf("write after the cancelled one: %v", err)
+	}
+	q.Release()
+}
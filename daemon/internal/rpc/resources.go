@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	gosync "sync"
+	"time"
+)
+
+// traceUsageTTL is how long a walk of test-results is reused; status
+// --watch asks every second and the directory may hold thousands of files
+const traceUsageTTL = time.Minute
+
+// ResourceStats is what the daemon holds on to, as reported under
+// resources by the status and stats RPCs. Sizes are in bytes; OpenFiles is
+// -1 where the platform can't count them.
+type ResourceStats struct {
+	Goroutines  int    `json:"goroutines"`
+	HeapInUse   uint64 `json:"heap_in_use"`
+	HeapObjects uint64 `json:"heap_objects"`
+	Sys         uint64 `json:"sys"`
+	OpenFiles   int    `json:"open_files"`
+	DBSize      int64  `json:"db_size"`
+	WALSize     int64  `json:"wal_size"`
+	TraceFiles  int    `json:"trace_files"`
+	TraceSize   int64  `json:"trace_size"`
+}
+
+// traceUsage caches the file count and size of the trace directory
+type traceUsage struct {
+	dir string
+
+	mu    gosync.Mutex
+	at    time.Time
+	files int
+	size  int64
+}
+
+func newTraceUsage(dir string) *traceUsage {
+	return &traceUsage{dir: dir}
+}
+
+// get returns the trace directory's file count and size, walking it at most
+// once per traceUsageTTL. A missing directory is empty.
+func (t *traceUsage) get(now time.Time) (int, int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.at.IsZero() && now.Sub(t.at) < traceUsageTTL {
+		return t.files, t.size
+	}
+	t.files, t.size = 0, 0
+	filepath.WalkDir(t.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			t.files++
+			t.size += info.Size()
+		}
+		return nil
+	})
+	t.at = now
+	return t.files, t.size
+}
+
+// resources measures the runtime, the database files and trace storage
+func (d *Daemon) resources() ResourceStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	dbPath := filepath.Join(d.dir, "db.sqlite")
+	st := ResourceStats{
+		Goroutines:  runtime.NumGoroutine(),
+		HeapInUse:   m.HeapInuse,
+		HeapObjects: m.HeapObjects,
+		Sys:         m.Sys,
+		OpenFiles:   openFiles(),
+		DBSize:      fileSize(dbPath),
+		WALSize:     fileSize(dbPath + "-wal"),
+	}
+	st.TraceFiles, st.TraceSize = d.traces.get(time.Now())
+	return st
+}
+
+// openFiles counts the process's open descriptors from /proc/self/fd on
+// Linux or /dev/fd on macOS and the BSDs, not counting the one used to read
+// it; -1 elsewhere
+func openFiles() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		if entries, err := os.ReadDir(dir); err == nil {
+			return len(entries) - 1
+		}
+	}
+	return -1
+}
+
+// fileSize is path's size, or 0 when it doesn't exist
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// writePrometheus writes the resource stats as Prometheus gauges
+func (st ResourceStats) writePrometheus(w io.Writer) {
+	gauge := func(name, help string, v interface{}) { writeGauge(w, name, help, v) }
+	gauge("goroutines", "Goroutines in the daemon.", st.Goroutines)
+	gauge("heap_in_use_bytes", "Heap bytes in use.", st.HeapInUse)
+	gauge("sys_bytes", "Bytes obtained from the OS.", st.Sys)
+	if st.OpenFiles >= 0 {
+		gauge("open_files", "Open file descriptors.", st.OpenFiles)
+	}
+	gauge("db_size_bytes", "Size of db.sqlite.", st.DBSize)
+	gauge("wal_size_bytes", "Size of the SQLite write-ahead log.", st.WALSize)
+	gauge("trace_files", "Files under test-results.", st.TraceFiles)
+	gauge("trace_size_bytes", "Bytes under test-results.", st.TraceSize)
+}
+
+// writeGauge writes one Prometheus gauge named tandas_<name>
+func writeGauge(w io.Writer, name, help string, v interface{}) {
+	fmt.Fprintf(w, "# HELP tandas_%s %s\n# TYPE tandas_%s gauge\ntandas_%s %v\n", name, help, name, name, v)
+}
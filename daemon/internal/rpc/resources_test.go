@@ -0,0 +1,57 @@
+package rpc_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestResources(t *testing.T) {
+	root, err := os.MkdirTemp("", "td")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, ".tandas")
+	traces := filepath.Join(root, "test-results", "login")
+	for _, p := range []string{dir, traces} {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, size := range map[string]int{"trace.zip": 300, "video.webm": 700} {
+		if err := os.WriteFile(filepath.Join(traces, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := startIn(t, dir, rpc.StartOptions{})
+
+	var status struct {
+		Resources rpc.ResourceStats `json:"resources"`
+	}
+	d.call(t, "status", nil, &status)
+	r := status.Resources
+	if r.Goroutines <= 0 || r.HeapInUse == 0 || r.Sys == 0 {
+		t.Errorf("runtime stats = %+v", r)
+	}
+	if r.DBSize <= 0 {
+		t.Errorf("db_size = %d, want the size of db.sqlite", r.DBSize)
+	}
+	if r.TraceFiles != 2 || r.TraceSize != 1000 {
+		t.Errorf("trace usage = %d files, %d bytes; want 2 files, 1000 bytes", r.TraceFiles, r.TraceSize)
+	}
+	if runtime.GOOS == "linux" && r.OpenFiles <= 0 {
+		t.Errorf("open_files = %d, want a count", r.OpenFiles)
+	}
+
+	var stats struct {
+		Resources rpc.ResourceStats `json:"resources"`
+	}
+	d.call(t, "stats", nil, &stats)
+	if stats.Resources.TraceFiles != 2 {
+		t.Errorf("stats resources = %+v, want the same trace usage", stats.Resources)
+	}
+}
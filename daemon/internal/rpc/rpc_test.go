@@ -0,0 +1,261 @@
+package rpc_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+// daemonEnv tells a re-executed test binary to run a daemon in the named
+// state directory instead of the tests, as StartDaemon blocks and exits
+// the process on shutdown
+const daemonEnv = "TD_TEST_DAEMON"
+
+func TestMain(m *testing.M) {
+	if dir := os.Getenv(daemonEnv); dir != "" {
+		var opts rpc.StartOptions
+		json.Unmarshal([]byte(os.Getenv(daemonEnv+"_OPTS")), &opts)
+		if err := rpc.StartDaemon(dir, "1h", opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// daemon is a daemon started for a test
+type daemon struct {
+	dir string
+	cmd *exec.Cmd
+	log *bytes.Buffer
+}
+
+// startDaemon runs a daemon on a fresh .tandas directory with config.yaml
+// set to config and issues.jsonl holding tandas, and waits until it answers.
+// It is stopped when the test ends, and its log shown if the test failed.
+func startDaemon(t *testing.T, config string, opts rpc.StartOptions, tandas ...*db.Tanda) *daemon {
+	t.Helper()
+	// A short path keeps the socket under the unix path length limit
+	root, err := os.MkdirTemp("", "td")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	dir := filepath.Join(root, ".tandas")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if config != "" {
+		if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var jsonl bytes.Buffer
+	for _, td := range tandas {
+		line, err := json.Marshal(td)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jsonl.Write(append(line, '\n'))
+	}
+	if err := os.WriteFile(filepath.Join(dir, "issues.jsonl"), jsonl.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return startIn(t, dir, opts)
+}
+
+// startIn runs a daemon on an existing state directory
+func startIn(t *testing.T, dir string, opts rpc.StartOptions) *daemon {
+	t.Helper()
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &daemon{dir: dir, log: &bytes.Buffer{}}
+	d.cmd = exec.Command(os.Args[0], "-test.run=^$")
+	d.cmd.Env = append(os.Environ(), daemonEnv+"="+dir, daemonEnv+"_OPTS="+string(encoded))
+	d.cmd.Stdout, d.cmd.Stderr = d.log, d.log
+	if err := d.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		d.cmd.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() {
+		d.cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-exited:
+		case <-time.After(10 * time.Second):
+			d.cmd.Process.Kill()
+			<-exited
+		}
+		if t.Failed() {
+			t.Logf("daemon log:\n%s", d.log)
+		}
+	})
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if rpc.Call(dir, "ping", nil, nil) == nil {
+			return d
+		}
+		select {
+		case <-exited:
+			t.Fatalf("daemon exited during startup:\n%s", d.log)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("daemon did not start:\n%s", d.log)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// call sends one request to the daemon and decodes its result into out
+func (d *daemon) call(t *testing.T, method string, params, out interface{}) {
+	t.Helper()
+	if err := rpc.Call(d.dir, method, params, out); err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+}
+
+// dial opens a raw connection to the daemon's socket
+func (d *daemon) dial(t *testing.T) *conn {
+	t.Helper()
+	c, err := net.Dial("unix", rpc.SocketPath(d.dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	return &conn{Conn: c, r: bufio.NewReader(c)}
+}
+
+// conn is a raw connection that exchanges one JSON document per line
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// send writes line as one request
+func (c *conn) send(t *testing.T, line string) {
+	t.Helper()
+	if _, err := c.Write([]byte(line + "\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recv reads one response line
+func (c *conn) recv(t *testing.T) string {
+	t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	return strings.TrimSpace(line)
+}
+
+// roundTrip sends line and returns the response
+func (c *conn) roundTrip(t *testing.T, line string) string {
+	t.Helper()
+	c.send(t, line)
+	return c.recv(t)
+}
+
+// rpcCode returns the JSON-RPC error code Call reported, or 0
+func rpcCode(err error) int {
+	var rpcErr *rpc.RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code
+	}
+	return 0
+}
+
+// registry reads the tandas in the daemon's issues.jsonl by ID
+func (d *daemon) registry(t *testing.T) map[string]*db.Tanda {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(d.dir, "issues.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tandas := make(map[string]*db.Tanda)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var td db.Tanda
+		if err := json.Unmarshal(line, &td); err != nil {
+			t.Fatalf("issues.jsonl: %v", err)
+		}
+		tandas[td.ID] = &td
+	}
+	return tandas
+}
+
+// freeAddr returns a loopback address nothing is listening on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// eventually retries check until it returns true or ten seconds pass
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFollower(t *testing.T) {
+	addr := freeAddr(t)
+	leader := startDaemon(t, "", rpc.StartOptions{Listen: addr},
+		&db.Tanda{ID: "td-0001", Title: "Login", Status: "active"})
+	follower := startDaemon(t, "", rpc.StartOptions{Follow: addr})
+
+	eventually(t, "the follower to copy the registry", func() bool {
+		var got db.Tanda
+		return rpc.Call(follower.dir, "get", map[string]string{"id": "td-0001"}, &got) == nil && got.Title == "Login"
+	})
+
+	var created db.Tanda
+	leader.call(t, "create", db.Tanda{Title: "Checkout"}, &created)
+	eventually(t, "the follower to see a new tanda", func() bool {
+		var got db.Tanda
+		return rpc.Call(follower.dir, "get", map[string]string{"id": created.ID}, &got) == nil && got.Title == "Checkout"
+	})
+
+	err := rpc.Call(follower.dir, "create", db.Tanda{Title: "Refund"}, nil)
+	if rpcCode(err) != rpc.CodeReadOnly {
+		t.Fatalf("create on a follower = %v, want a read-only error", err)
+	}
+	var caps rpc.Capabilities
+	follower.call(t, "capabilities", nil, &caps)
+	if !caps.ReadOnly {
+		t.Error("follower capabilities should be read-only")
+	}
+}
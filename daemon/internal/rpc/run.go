@@ -0,0 +1,557 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/tandas/daemon/internal/bisect"
+	"github.com/tandas/daemon/internal/ci"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/environment"
+	"github.com/tandas/daemon/internal/runner"
+)
+
+// runOutputLines bounds the output kept per run; a client further behind
+// misses the oldest lines
+const runOutputLines = 5000
+
+// keptRuns is how many finished runs run_output can still be asked about
+const keptRuns = 10
+
+// runTailLines is how much of an exit runner's output becomes the failure
+// recorded for its tandas
+const runTailLines = 20
+
+// Run states
+const (
+	RunRunning   = "running"
+	RunPassed    = "passed"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+	RunError     = "error"
+)
+
+// errRunActive rejects a run while another is still going
+var errRunActive = errors.New("a run is already in progress; cancel it with run_cancel")
+
+// RunParams selects the tandas to run: the given IDs, or else those with
+// Status, or whose last run failed. Runner picks the runner for all of
+// them instead of matching each tanda's file.
+type RunParams struct {
+	IDs     []string `json:"ids,omitempty"`
+	Status  string   `json:"status,omitempty"`
+	Failing bool     `json:"failing,omitempty"`
+	Runner  string   `json:"runner,omitempty"`
+}
+
+// RunCommand is one runner command of a run; ExitCode is set once it
+// finished
+type RunCommand struct {
+	Runner   string   `json:"runner"`
+	Args     []string `json:"args"`
+	Tandas   []string `json:"tandas"`
+	ExitCode *int     `json:"exit_code,omitempty"`
+}
+
+// RunStatus is a run as reported by the run RPCs. NotRun lists selected
+// tandas no runner ran or whose report left them out; Unmatched lists
+// reported tests that matched no tanda.
+type RunStatus struct {
+	ID        int          `json:"id"`
+	State     string       `json:"state"`
+	Started   time.Time    `json:"started"`
+	Finished  *time.Time   `json:"finished,omitempty"`
+	Commands  []RunCommand `json:"commands"`
+	Passed    []string     `json:"passed"`
+	Failed    []string     `json:"failed"`
+	Skipped   []string     `json:"skipped"`
+	NotRun    []string     `json:"not_run"`
+	Unmatched []string     `json:"unmatched"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// RunOutputParams asks for a run's output from line Since, waiting up to
+// Wait seconds for more. An ID of 0 is the latest run.
+type RunOutputParams struct {
+	ID    int `json:"id,omitempty"`
+	Since int `json:"since"`
+	Wait  int `json:"wait,omitempty"`
+}
+
+// RunOutputResult carries the output lines after the requested one, the
+// line to ask from next and the run's status
+type RunOutputResult struct {
+	Lines []string  `json:"lines"`
+	Next  int       `json:"next"`
+	Run   RunStatus `json:"run"`
+}
+
+// RunCancelParams names the run to cancel; 0 is the active one
+type RunCancelParams struct {
+	ID int `json:"id,omitempty"`
+}
+
+// testRun is one run: its status and output while it goes and after
+type testRun struct {
+	mu     gosync.Mutex
+	st     RunStatus
+	lines  []string
+	first  int
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (r *testRun) status() RunStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.copyLocked()
+}
+
+// copyLocked copies the status so it can be encoded while the run goes on
+func (r *testRun) copyLocked() RunStatus {
+	st := r.st
+	st.Commands = append([]RunCommand(nil), r.st.Commands...)
+	return st
+}
+
+// update changes the status under the lock and wakes output readers
+func (r *testRun) update(f func(st *RunStatus)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(&r.st)
+	close(r.wake)
+	r.wake = make(chan struct{})
+}
+
+// print appends an output line, dropping the oldest beyond runOutputLines
+func (r *testRun) print(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, line)
+	if over := len(r.lines) - runOutputLines; over > 0 {
+		r.lines = append([]string(nil), r.lines[over:]...)
+		r.first += over
+	}
+	close(r.wake)
+	r.wake = make(chan struct{})
+}
+
+// output returns the lines from since, blocking up to wait while there
+// are none and the run is still going
+func (r *testRun) output(since int, wait time.Duration, done <-chan struct{}) RunOutputResult {
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	for {
+		r.mu.Lock()
+		end := r.first + len(r.lines)
+		if since > end {
+			since = end
+		}
+		from := max(since, r.first)
+		result := RunOutputResult{Lines: append([]string{}, r.lines[from-r.first:]...), Next: end, Run: r.copyLocked()}
+		wake := r.wake
+		r.mu.Unlock()
+		if len(result.Lines) > 0 || result.Run.State != RunRunning || wait <= 0 {
+			return result
+		}
+		select {
+		case <-wake:
+		case <-deadline.C:
+			return result
+		case <-done:
+			return result
+		}
+	}
+}
+
+// runManager keeps the active run and the last few finished ones
+type runManager struct {
+	mu   gosync.Mutex
+	seq  int
+	runs []*testRun
+}
+
+func newRunManager() *runManager {
+	return &runManager{}
+}
+
+// start adds a run unless another is still going
+func (m *runManager) start(st RunStatus, cancel context.CancelFunc) (*testRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r := m.activeLocked(); r != nil {
+		return nil, errRunActive
+	}
+	m.seq++
+	st.ID = m.seq
+	r := &testRun{st: st, wake: make(chan struct{}), cancel: cancel, done: make(chan struct{})}
+	m.runs = append(m.runs, r)
+	if over := len(m.runs) - keptRuns; over > 0 {
+		m.runs = append([]*testRun(nil), m.runs[over:]...)
+	}
+	return r, nil
+}
+
+func (m *runManager) activeLocked() *testRun {
+	if n := len(m.runs); n > 0 {
+		select {
+		case <-m.runs[n-1].done:
+		default:
+			return m.runs[n-1]
+		}
+	}
+	return nil
+}
+
+// get returns run id, or the latest run for 0
+func (m *runManager) get(id int) *testRun {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.runs) - 1; i >= 0; i-- {
+		if id == 0 || m.runs[i].st.ID == id {
+			return m.runs[i]
+		}
+	}
+	return nil
+}
+
+// stop cancels the active run and waits up to timeout for its commands to
+// be killed
+func (m *runManager) stop(timeout time.Duration) {
+	m.mu.Lock()
+	r := m.activeLocked()
+	m.mu.Unlock()
+	if r == nil {
+		return
+	}
+	r.cancel()
+	select {
+	case <-r.done:
+	case <-time.After(timeout):
+	}
+}
+
+// startRun plans a run for the selected tandas and starts it in the
+// background
+func (d *Daemon) startRun(params RunParams) (*RunStatus, error) {
+	cfg, err := config.Load(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Runners) == 0 {
+		return nil, errors.New("no runners in config.yaml")
+	}
+	tandas, err := d.runSelection(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(tandas) == 0 {
+		return nil, errors.New("no tandas selected")
+	}
+	plans, skipped, err := runner.Plans(cfg.Runners, params.Runner, tandas)
+	if err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return nil, errors.New("no runner matches the selected tandas")
+	}
+
+	st := RunStatus{
+		State:     RunRunning,
+		Started:   time.Now().UTC(),
+		Passed:    []string{},
+		Failed:    []string{},
+		Skipped:   []string{},
+		NotRun:    append([]string{}, skipped...),
+		Unmatched: []string{},
+	}
+	for _, p := range plans {
+		cmd := RunCommand{Runner: p.Runner, Args: p.Args}
+		for _, t := range p.Tandas {
+			cmd.Tandas = append(cmd.Tandas, t.ID)
+		}
+		st.Commands = append(st.Commands, cmd)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := d.runs.start(st, cancel)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	slog.Info("Starting run", "run", r.st.ID, "tandas", len(tandas), "commands", len(plans))
+	go d.executeRun(ctx, r, plans)
+	st = r.status()
+	return &st, nil
+}
+
+// runSelection loads the tandas a run asks for
+func (d *Daemon) runSelection(params RunParams) ([]*db.Tanda, error) {
+	if len(params.IDs) > 0 {
+		var tandas []*db.Tanda
+		for _, id := range params.IDs {
+			t, err := d.db.GetTanda(id)
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				return nil, fmt.Errorf("tanda %s not found", id)
+			}
+			tandas = append(tandas, t)
+		}
+		return tandas, nil
+	}
+	if params.Status == "" && !params.Failing {
+		return nil, errors.New("ids, status or failing is required")
+	}
+	all, err := d.db.QueryTandas(db.Filter{Status: params.Status})
+	if err != nil {
+		return nil, err
+	}
+	if !params.Failing {
+		return all, nil
+	}
+	var failing []*db.Tanda
+	for _, t := range all {
+		if n := len(t.RunHistory); n > 0 && t.RunHistory[n-1].Result == "fail" {
+			failing = append(failing, t)
+		}
+	}
+	return failing, nil
+}
+
+// executeRun runs each plan's command in turn, recording the results of
+// those that finish. A cancelled run records nothing further.
+func (d *Daemon) executeRun(ctx context.Context, r *testRun, plans []runner.Plan) {
+	defer close(r.done)
+	defer r.cancel()
+	defer func() {
+		if v := recover(); v != nil {
+			path := d.crashed("run", v)
+			r.update(func(st *RunStatus) {
+				st.State = RunError
+				st.Error = fmt.Sprintf("panic: %v (report: %s)", v, path)
+			})
+		}
+	}()
+
+	root := d.root()
+	state := RunPassed
+	// Outside CI, the results of one run form their own batch
+	batch := "run-" + time.Now().UTC().Format("20060102T150405Z")
+	// Runs outside git or CI record no commit
+	head, _ := bisect.Head(root)
+	for i, p := range plans {
+		if ctx.Err() != nil {
+			break
+		}
+		o, err := d.runCommand(ctx, r, p, root)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			r.print(fmt.Sprintf("td-daemon: %s: %v", p.Runner, err))
+			r.update(func(st *RunStatus) { st.Error = fmt.Sprintf("%s: %v", p.Runner, err) })
+			state = RunError
+			continue
+		}
+		code := o.ExitCode
+		r.update(func(st *RunStatus) { st.Commands[i].ExitCode = &code })
+
+		runs, unmatched, err := runner.Results(p, root, o, time.Now())
+		if err != nil {
+			r.update(func(st *RunStatus) { st.Error = fmt.Sprintf("%s: %v", p.Runner, err) })
+			state = RunError
+			continue
+		}
+		if err := d.recordRuns(runs, batch, head); err != nil {
+			r.update(func(st *RunStatus) { st.Error = fmt.Sprintf("failed to record runs: %v", err) })
+			state = RunError
+			continue
+		}
+		failed := o.ExitCode != 0
+		r.update(func(st *RunStatus) {
+			ran := make(map[string]bool, len(runs))
+			for _, run := range runs {
+				ran[run.Tanda.ID] = true
+				switch run.Run.Result {
+				case "pass":
+					st.Passed = append(st.Passed, run.Tanda.ID)
+				case "fail":
+					st.Failed = append(st.Failed, run.Tanda.ID)
+					failed = true
+				default:
+					st.Skipped = append(st.Skipped, run.Tanda.ID)
+				}
+			}
+			for _, t := range p.Tandas {
+				if !ran[t.ID] {
+					st.NotRun = append(st.NotRun, t.ID)
+				}
+			}
+			st.Unmatched = append(st.Unmatched, unmatched...)
+		})
+		if failed && state == RunPassed {
+			state = RunFailed
+		}
+	}
+
+	if ctx.Err() != nil {
+		state = RunCancelled
+	}
+	now := time.Now().UTC()
+	r.update(func(st *RunStatus) {
+		st.State = state
+		st.Finished = &now
+	})
+	slog.Info("Run finished", "run", r.st.ID, "state", state)
+}
+
+// runCommand runs one plan's command from the project root, printing its
+// output to the run as it goes. A command that can't be started, or that
+// is killed for its timeout, is an error; a non-zero exit is not.
+func (d *Daemon) runCommand(ctx context.Context, r *testRun, p runner.Plan, root string) (runner.Outcome, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.Args[0], p.Args[1:]...)
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "TANDAS_DIR="+d.dir, "TANDAS_RUN="+strconv.Itoa(r.st.ID))
+	cmd.WaitDelay = 5 * time.Second
+	killProcessGroup(cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return runner.Outcome{}, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return runner.Outcome{}, err
+	}
+	if path := p.ReportFile(root); path != "" {
+		os.Remove(path)
+	}
+
+	r.print("$ " + strings.Join(p.Args, " "))
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		return runner.Outcome{}, fmt.Errorf("failed to start %s: %w", p.Args[0], err)
+	}
+	d.runners.heartbeat(p.Runner, started)
+
+	var (
+		mu   gosync.Mutex
+		raw  strings.Builder
+		tail []string
+		wg   gosync.WaitGroup
+	)
+	read := func(rd io.Reader, keep bool) {
+		defer wg.Done()
+		br := bufio.NewReader(rd)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				line = strings.TrimRight(line, "\r\n")
+				mu.Lock()
+				if keep {
+					raw.WriteString(line)
+					raw.WriteByte('\n')
+				}
+				text, show := runner.Display(p.Config.Report, line)
+				if show {
+					tail = append(tail, text)
+					if len(tail) > runTailLines {
+						tail = tail[1:]
+					}
+				}
+				mu.Unlock()
+				if show {
+					r.print(text)
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+	wg.Add(2)
+	go read(stdout, true)
+	go read(stderr, false)
+	wg.Wait()
+	err = cmd.Wait()
+	d.runners.progress(ProgressParams{Runner: p.Runner, Done: len(p.Tandas), Total: len(p.Tandas), Message: "finished"}, time.Now())
+
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return runner.Outcome{}, fmt.Errorf("timed out after %s", p.Timeout)
+	case context.Canceled:
+		r.print(fmt.Sprintf("td-daemon: %s cancelled", p.Runner))
+		return runner.Outcome{}, ctx.Err()
+	}
+	o := runner.Outcome{Stdout: []byte(raw.String()), Tail: strings.Join(tail, "\n"), Elapsed: time.Since(started)}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		o.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		return runner.Outcome{}, err
+	}
+	r.print(fmt.Sprintf("td-daemon: %s exited with status %d", p.Runner, o.ExitCode))
+	return o, nil
+}
+
+// recordRuns adds a run's results to their tandas in one batch, reloading
+// each so writes made while the command ran are kept. Runs are stamped
+// with the daemon's environment, falling back to batch and commit.
+func (d *Daemon) recordRuns(runs []ci.Run, batch, commit string) error {
+	if len(runs) == 0 {
+		return nil
+	}
+	d.writes.lock("run")
+	defer d.writes.release()
+
+	var written []*db.Tanda
+	for _, run := range runs {
+		t, err := d.db.GetTanda(run.Tanda.ID)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			continue
+		}
+		environment.Stamp(&run.Run, os.Getenv)
+		if run.Run.Batch == "" {
+			run.Run.Batch = batch
+		}
+		if run.Run.Commit == "" {
+			run.Run.Commit = commit
+		}
+		t.AddRun(run.Run)
+		written = append(written, t)
+	}
+	b, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer b.Rollback()
+	for _, t := range written {
+		if err := b.UpsertTanda(t); err != nil {
+			return err
+		}
+	}
+	return d.journaled(written, func() error {
+		if err := b.Commit(); err != nil {
+			return fmt.Errorf("failed to commit runs: %w", err)
+		}
+		return d.commit()
+	})
+}
@@ -0,0 +1,148 @@
+package rpc_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+const runners = `runners:
+  bad:
+    command: [sh, -c, "echo broken; exit 3"]
+    match: ["*_bad.go"]
+  ok:
+    command: [sh, -c, "echo running"]
+    match: ["*_ok.go"]
+  slow:
+    command: [sleep, "30"]
+    match: ["*_slow.go"]
+`
+
+// waitRun follows a run's output until it finishes and returns the lines
+// and final status
+func waitRun(t *testing.T, d *daemon, id int) ([]string, rpc.RunStatus) {
+	t.Helper()
+	var lines []string
+	deadline := time.Now().Add(20 * time.Second)
+	params := rpc.RunOutputParams{ID: id, Wait: 5}
+	for {
+		var out rpc.RunOutputResult
+		d.call(t, "run_output", params, &out)
+		lines = append(lines, out.Lines...)
+		params.Since = out.Next
+		if out.Run.State != rpc.RunRunning {
+			return lines, out.Run
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %d still running: %+v", id, out.Run)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	d := startDaemon(t, runners, rpc.StartOptions{},
+		&db.Tanda{ID: "td-0001", Title: "Login", Status: "active", File: "login_ok.go"},
+		&db.Tanda{ID: "td-0002", Title: "Cart", Status: "active", File: "cart_bad.go"},
+		&db.Tanda{ID: "td-0003", Title: "Search", Status: "active"},
+	)
+
+	var st rpc.RunStatus
+	d.call(t, "run", rpc.RunParams{IDs: []string{"td-0001", "td-0002", "td-0003"}}, &st)
+	if st.ID == 0 || len(st.Commands) != 2 || st.Commands[0].Runner != "bad" || st.Commands[1].Runner != "ok" {
+		t.Fatalf("run = %+v, want one command each for bad and ok", st)
+	}
+	lines, st := waitRun(t, d, st.ID)
+	if st.State != rpc.RunFailed || st.Finished == nil {
+		t.Errorf("state = %s, want failed", st.State)
+	}
+	if strings.Join(st.Passed, ",") != "td-0001" || strings.Join(st.Failed, ",") != "td-0002" || strings.Join(st.NotRun, ",") != "td-0003" {
+		t.Errorf("passed %v, failed %v, not run %v", st.Passed, st.Failed, st.NotRun)
+	}
+	if code := st.Commands[0].ExitCode; code == nil || *code != 3 {
+		t.Errorf("bad exit code = %v, want 3", code)
+	}
+	if out := strings.Join(lines, "\n"); !strings.Contains(out, "broken") || !strings.Contains(out, "running") {
+		t.Errorf("output = %q, want both commands' lines", out)
+	}
+
+	reg := d.registry(t)
+	if runs := reg["td-0001"].RunHistory; len(runs) != 1 || runs[0].Result != "pass" {
+		t.Errorf("td-0001 runs = %+v, want one pass", runs)
+	}
+	if runs := reg["td-0002"].RunHistory; len(runs) != 1 || runs[0].Result != "fail" || !strings.Contains(runs[0].Error, "exit status 3") {
+		t.Errorf("td-0002 runs = %+v, want one failure with the exit status", runs)
+	}
+	if runs := reg["td-0003"].RunHistory; len(runs) != 0 {
+		t.Errorf("td-0003 runs = %+v, want none", runs)
+	}
+}
+
+func TestRunBusyAndCancel(t *testing.T) {
+	d := startDaemon(t, runners, rpc.StartOptions{},
+		&db.Tanda{ID: "td-0001", Title: "Login", Status: "active", File: "login_slow.go"},
+		&db.Tanda{ID: "td-0002", Title: "Cart", Status: "active", File: "cart_ok.go"},
+	)
+
+	var st rpc.RunStatus
+	d.call(t, "run", rpc.RunParams{IDs: []string{"td-0001"}}, &st)
+	err := rpc.Call(d.dir, "run", rpc.RunParams{IDs: []string{"td-0002"}}, nil)
+	if rpcCode(err) != rpc.CodeBusy {
+		t.Fatalf("second run = %v, want busy", err)
+	}
+
+	start := time.Now()
+	d.call(t, "run_cancel", rpc.RunCancelParams{}, nil)
+	if _, st = waitRun(t, d, st.ID); st.State != rpc.RunCancelled {
+		t.Errorf("state = %s, want cancelled", st.State)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("cancel took %s", elapsed)
+	}
+	if runs := d.registry(t)["td-0001"].RunHistory; len(runs) != 0 {
+		t.Errorf("cancelled run recorded %+v", runs)
+	}
+
+	// The next run starts once the cancelled one is done
+	d.call(t, "run", rpc.RunParams{IDs: []string{"td-0002"}}, &st)
+	if _, st = waitRun(t, d, st.ID); st.State != rpc.RunPassed {
+		t.Errorf("state after cancel = %s, want passed", st.State)
+	}
+	if err := rpc.Call(d.dir, "run_output", rpc.RunOutputParams{ID: 99}, nil); rpcCode(err) != rpc.CodeNotFound {
+		t.Errorf("output of an unknown run = %v, want not found", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	d := startDaemon(t, runners, rpc.StartOptions{},
+		&db.Tanda{ID: "td-0001", Title: "Login", Status: "active", File: "login_ok.go"},
+		&db.Tanda{ID: "td-0002", Title: "Search", Status: "active"},
+	)
+	tests := []struct {
+		name    string
+		params  interface{}
+		wantErr string
+	}{
+		{"nothing selected", rpc.RunParams{}, "ids, status or failing is required"},
+		{"unknown tanda", rpc.RunParams{IDs: []string{"td-9999"}}, "tanda td-9999 not found"},
+		{"unknown runner", rpc.RunParams{IDs: []string{"td-0001"}, Runner: "nope"}, `no runner named "nope"`},
+		{"no matching runner", rpc.RunParams{IDs: []string{"td-0002"}}, "no runner matches"},
+		{"empty selection", rpc.RunParams{Status: "flaky"}, "no tandas selected"},
+		{"bad params", map[string]int{"ids": 1}, "invalid params"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rpc.Call(d.dir, "run", tt.params, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("run = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	bare := startDaemon(t, "", rpc.StartOptions{}, &db.Tanda{ID: "td-0001", Title: "Login", Status: "active"})
+	if err := rpc.Call(bare.dir, "run", rpc.RunParams{IDs: []string{"td-0001"}}, nil); err == nil || !strings.Contains(err.Error(), "no runners") {
+		t.Errorf("run without runners = %v, want no runners", err)
+	}
+}
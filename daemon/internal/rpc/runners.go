@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"sort"
+	gosync "sync"
+	"time"
+)
+
+// runnerTTL is how long a runner that stopped reporting stays in status
+const runnerTTL = 2 * time.Minute
+
+// ProgressParams is a test runner's heartbeat or progress report. Runners
+// send them as notifications, which get no response.
+type ProgressParams struct {
+	Runner  string `json:"runner"`
+	TandaID string `json:"tanda_id,omitempty"`
+	Done    int    `json:"done,omitempty"`
+	Total   int    `json:"total,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// RunnerStatus is the last progress a runner reported and when it was
+// last heard from
+type RunnerStatus struct {
+	ProgressParams
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// runnerTracker keeps the runners that reported recently
+type runnerTracker struct {
+	mu      gosync.Mutex
+	runners map[string]*RunnerStatus
+}
+
+func newRunnerTracker() *runnerTracker {
+	return &runnerTracker{runners: make(map[string]*RunnerStatus)}
+}
+
+// heartbeat marks a runner alive, keeping its last progress
+func (t *runnerTracker) heartbeat(runner string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.runners[runner]
+	if !ok {
+		r = &RunnerStatus{ProgressParams: ProgressParams{Runner: runner}}
+		t.runners[runner] = r
+	}
+	r.LastSeen = now
+}
+
+// progress records a runner's latest report
+func (t *runnerTracker) progress(p ProgressParams, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.runners[p.Runner] = &RunnerStatus{ProgressParams: p, LastSeen: now}
+}
+
+// active returns the runners heard from within runnerTTL, by name,
+// forgetting the rest
+func (t *runnerTracker) active(now time.Time) []RunnerStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := []RunnerStatus{}
+	for name, r := range t.runners {
+		if now.Sub(r.LastSeen) > runnerTTL {
+			delete(t.runners, name)
+			continue
+		}
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Runner < out[j].Runner })
+	return out
+}
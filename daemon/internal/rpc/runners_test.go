@@ -0,0 +1,42 @@
+package rpc_test
+
+import (
+	"testing"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestNotify(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{})
+
+	if err := rpc.Notify(d.dir, "heartbeat", rpc.ProgressParams{Runner: "ci-7"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rpc.Notify(d.dir, "progress", rpc.ProgressParams{Runner: "ci-8", Done: 2, Total: 5, Message: "login"}); err != nil {
+		t.Fatal(err)
+	}
+	// A failed notification is dropped without a reply
+	if err := rpc.Notify(d.dir, "progress", rpc.ProgressParams{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var status struct {
+		Runners []rpc.RunnerStatus `json:"runners"`
+	}
+	eventually(t, "both runners to report", func() bool {
+		return rpc.Call(d.dir, "status", nil, &status) == nil && len(status.Runners) == 2
+	})
+	for _, r := range status.Runners {
+		if r.Runner == "ci-8" && (r.Done != 2 || r.Total != 5 || r.Message != "login") {
+			t.Errorf("ci-8 progress = %+v", r)
+		}
+		if r.LastSeen.IsZero() {
+			t.Errorf("%s has no last_seen", r.Runner)
+		}
+	}
+
+	// Notifications to a missing daemon fail like calls
+	if err := rpc.Notify(t.TempDir(), "heartbeat", rpc.ProgressParams{Runner: "ci-7"}); err != rpc.ErrNotRunning {
+		t.Errorf("notify without a daemon = %v, want ErrNotRunning", err)
+	}
+}
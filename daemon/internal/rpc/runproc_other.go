@@ -0,0 +1,8 @@
+//go:build !unix
+
+package rpc
+
+import "os/exec"
+
+// killProcessGroup leaves cmd as is; cancelling kills only the command
+func killProcessGroup(cmd *exec.Cmd) {}
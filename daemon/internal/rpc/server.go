@@ -1,20 +1,58 @@
 package rpc
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/tandas/daemon/internal/anomaly"
+	"github.com/tandas/daemon/internal/badge"
+	"github.com/tandas/daemon/internal/bisect"
+	"github.com/tandas/daemon/internal/blobs"
+	"github.com/tandas/daemon/internal/burndown"
+	"github.com/tandas/daemon/internal/cluster"
+	"github.com/tandas/daemon/internal/compact"
+	"github.com/tandas/daemon/internal/config"
 	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/editor"
+	"github.com/tandas/daemon/internal/environment"
+	"github.com/tandas/daemon/internal/events"
+	"github.com/tandas/daemon/internal/export"
+	"github.com/tandas/daemon/internal/graph"
+	"github.com/tandas/daemon/internal/heatmap"
+	"github.com/tandas/daemon/internal/ids"
+	"github.com/tandas/daemon/internal/journal"
+	"github.com/tandas/daemon/internal/leaderboard"
+	"github.com/tandas/daemon/internal/mirror"
+	"github.com/tandas/daemon/internal/notify"
+	"github.com/tandas/daemon/internal/orphans"
+	"github.com/tandas/daemon/internal/paths"
+	"github.com/tandas/daemon/internal/peer"
+	"github.com/tandas/daemon/internal/prune"
+	"github.com/tandas/daemon/internal/requirements"
+	"github.com/tandas/daemon/internal/rundiff"
+	"github.com/tandas/daemon/internal/schema"
+	"github.com/tandas/daemon/internal/slo"
+	"github.com/tandas/daemon/internal/snapshot"
+	"github.com/tandas/daemon/internal/stale"
 	"github.com/tandas/daemon/internal/sync"
+	"github.com/tandas/daemon/internal/trend"
 	"github.com/tandas/daemon/internal/watch"
+	"github.com/tandas/daemon/internal/webhook"
+	"github.com/tandas/daemon/internal/workflow"
 )
 
 const (
@@ -26,77 +64,338 @@ const (
 
 // LockFile contains daemon metadata
 type LockFile struct {
-	PID       int       `json:"pid"`
-	ParentPID int       `json:"parent_pid"`
-	Database  string    `json:"database"`
-	Version   string    `json:"version"`
+	PID       int `json:"pid"`
+	ParentPID int `json:"parent_pid"`
+	// Socket is where clients connect, absolute so any working directory
+	// can use it
+	Socket string `json:"socket"`
+	// TCP is the localhost listener's address, for clients that can't
+	// reach the socket
+	TCP      string `json:"tcp,omitempty"`
+	Database string `json:"database"`
+	Version  string `json:"version"`
+	// Protocol is the daemon's ProtocolVersion, so clients can tell a
+	// stale daemon before calling it
+	Protocol  int       `json:"protocol"`
 	StartedAt time.Time `json:"started_at"`
+	// Startup lists the subsystems that failed to start
+	Startup StartupReport `json:"startup"`
 }
 
-// RPCRequest is a JSON-RPC style request
+// RPCRequest is a JSON-RPC 2.0 request. Requests without the jsonrpc
+// member are from older clients and are answered in their format.
 type RPCRequest struct {
-	Method string          `json:"method"`
-	Params json.RawMessage `json:"params,omitempty"`
-	ID     int             `json:"id"`
+	JSONRPC string          `json:"jsonrpc,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// ID is echoed in the response; a JSON-RPC 2.0 request without one is
+	// a notification and gets no response
+	ID json.RawMessage `json:"id,omitempty"`
+	// Token authenticates requests on network listeners
+	Token string `json:"token,omitempty"`
+	// Protocol is the client's ProtocolVersion; zero skips the check
+	Protocol int `json:"protocol,omitempty"`
 }
 
-// RPCResponse is a JSON-RPC style response
+// RPCResponse is a response to one request, encoded by MarshalJSON for the
+// protocol the request used
 type RPCResponse struct {
-	Result interface{} `json:"result,omitempty"`
-	Error  string      `json:"error,omitempty"`
-	ID     int         `json:"id"`
+	Result interface{}
+	Error  string
+	// Code and Data qualify Error; a zero Code is CodeServerError
+	Code int
+	Data interface{}
+	ID   json.RawMessage
+	// JSONRPC is set when answering a JSON-RPC 2.0 request
+	JSONRPC string
+}
+
+// ValidateResult reports whether a document conforms to the tanda schema
+type ValidateResult struct {
+	Valid    bool             `json:"valid"`
+	Problems []schema.Problem `json:"problems"`
 }
 
 // Daemon manages the background sync process
 type Daemon struct {
 	dir          string
+	socketPath   string
 	interval     time.Duration
 	db           *db.Store
 	syncer       *sync.Syncer
 	watcher      *watch.Watcher
 	traceWatcher *watch.TraceWatcher
 	listener     net.Listener
-	done         chan struct{}
+	events       *events.Bus
+	detector     *events.Detector
+	webhooks     *webhook.Dispatcher
+	slos         *slo.Tracker
+	anomalies    *anomaly.Detector
+	mirror       *mirror.Postgres
+	tcpListener  net.Listener
+	// localListener serves the local RPCs over localhost TCP to clients
+	// holding localToken
+	localListener net.Listener
+	localToken    string
+	// upstream is the team server this daemon pushes to; pushed holds the
+	// updated_at of each tanda at its last successful push
+	upstream *TeamClient
+	pushed   map[string]string
+	auth     *authenticator
+	// changes logs registry changes for followers; following is set when
+	// this daemon is itself a read-only follower
+	changes   *changeLog
+	following *followState
+	conns     *connLimits
+	limiter   *rateLimiter
+	// peers decides which local users may use the unix socket
+	peers *peerPolicy
+	// cache serves the read-only RPCs until the registry changes
+	cache *readCache
+	// debugServer serves pprof when enabled
+	debugServer *http.Server
+	debugAddr   string
+	started     time.Time
+	startup     StartupReport
+	// ids allocates sequential IDs for the create RPC
+	ids *ids.Allocator
+	// workflow limits the statuses mutation RPCs may set
+	workflow *workflow.Workflow
+	// journal records writes in flight for recovery after a crash
+	journal *journal.Journal
+	// errors keeps recent sync and import failures for status
+	errors *errorLog
+	// feed keeps recent events and activity for tail
+	feed *eventFeed
+	// runners tracks the test runners sending heartbeats and progress
+	runners *runnerTracker
+	// requests applies deadlines and cancels requests in flight
+	requests *requestTracker
+	// jobs runs scheduled maintenance
+	jobs *jobRunner
+	// metrics counts calls, errors and latency per method
+	metrics *rpcMetrics
+	// crashes counts recovered panics and writes their reports
+	crashes *crashLog
+	// traces measures trace storage for the resource stats
+	traces *traceUsage
+	// runs holds the test runs started by the run RPC
+	runs *runManager
+	// maxAttachment caps the size of one note attachment
+	maxAttachment int64
+	// prune holds the configured run and note limits
+	prune prune.Options
+	// badgeDir is where badges are rewritten after each sync, or empty
+	badgeDir string
+	// writes serializes registry mutations from imports, team pushes and
+	// the write RPCs
+	writes *writeQueue
+	done   chan struct{}
 }
 
 // StartDaemon starts the background daemon
-func StartDaemon(dir string, intervalStr string) error {
+func StartDaemon(dir string, intervalStr string, opts StartOptions) error {
 	interval, err := time.ParseDuration(intervalStr)
 	if err != nil {
 		return fmt.Errorf("invalid interval: %w", err)
 	}
 
-	socketPath := filepath.Join(dir, socketName)
 	pidPath := filepath.Join(dir, pidFileName)
 	lockPath := filepath.Join(dir, lockFileName)
 	dbPath := filepath.Join(dir, "db.sqlite")
 	jsonlPath := filepath.Join(dir, "issues.jsonl")
 
+	cfg, cfgErr := config.Load(dir)
+	if cfgErr != nil {
+		slog.Warn("Invalid config; using defaults", "err", cfgErr)
+		cfg = config.Default()
+	}
+	socketPath := configuredSocket(dir, cfg.RPC)
+	if cfg.RPC.AbstractSocket && !isAbstract(socketPath) {
+		slog.Info("Abstract sockets need Linux; using a socket file", "socket", socketPath)
+	}
+	if err := checkSocketPath(socketPath); err != nil {
+		return err
+	}
+
 	// Check if already running
-	if _, err := os.Stat(socketPath); err == nil {
-		return fmt.Errorf("daemon already running (socket exists: %s)", socketPath)
+	if socketInUse(socketPath) {
+		return fmt.Errorf("daemon already running (socket in use: %s)", socketPath)
 	}
 
-	// Initialize database
-	store, err := db.Open(dbPath)
+	// Initialize database, snapshotting it first if it needs migrating
+	store, _, err := snapshot.OpenDB(dir, time.Now())
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
+	store.SetCompression(cfg.Storage.Compress)
+	startup := StartupReport{Degraded: []Degradation{}}
+	if cfgErr != nil {
+		startup.degrade("config", cfgErr)
+	}
+
+	daemon := &Daemon{
+		dir:        dir,
+		socketPath: socketPath,
+		interval:   interval,
+		db:         store,
+		syncer:     sync.New(store, jsonlPath),
+		events:     events.NewBus(),
+		detector:   events.NewDetector(),
+		pushed:     make(map[string]string),
+		changes:    newChangeLog(),
+		errors:     &errorLog{},
+		feed:       newEventFeed(),
+		runners:    newRunnerTracker(),
+		jobs:       newJobRunner(),
+		metrics:    newRPCMetrics(),
+		crashes:    newCrashLog(dir),
+		traces:     newTraceUsage(filepath.Join(dir, "..", "test-results")),
+		runs:       newRunManager(),
+		cache:      newReadCache(store),
+		writes:     newWriteQueue(),
+		ids:        ids.New(cfg.IDs.Prefix, cfg.IDs.Width),
+		prune:      prune.FromConfig(cfg.Prune),
+		started:    time.Now(),
+		done:       make(chan struct{}),
+	}
+	daemon.events.Subscribe(daemon.feed.add)
+	if daemon.badgeDir = cfg.Badges.Dir; daemon.badgeDir != "" && !filepath.IsAbs(daemon.badgeDir) {
+		daemon.badgeDir = filepath.Join(daemon.root(), daemon.badgeDir)
+	}
+	if policy, err := sync.ParseDuplicatePolicy(cfg.Import.Duplicates); err != nil {
+		slog.Warn("Invalid duplicate policy; keeping the later line", "err", err)
+		startup.degrade("import", err)
+	} else {
+		daemon.syncer.SetDuplicatePolicy(policy)
+	}
+	daemon.syncer.SetMaxLineBytes(cfg.Import.MaxLineBytes)
+	daemon.maxAttachment = blobs.Limit(cfg.Storage.MaxAttachmentBytes)
+	if daemon.journal, err = openJournal(dir); err != nil {
+		slog.Warn("Journal unavailable; writes are not journaled", "err", err)
+		startup.degrade("journal", err)
+	}
+	daemon.syncer.SetJournal(daemon.journal)
+	daemon.workflow, err = workflow.New(cfg.Statuses)
+	if err != nil {
+		slog.Warn("Invalid statuses; using the defaults", "err", err)
+		startup.degrade("statuses", err)
+		daemon.workflow = workflow.Default()
+	}
+	daemon.syncer.SetWorkflow(daemon.workflow)
+	daemon.conns, err = newConnLimits(cfg.RPC)
+	if err != nil {
+		slog.Warn("Invalid connection limit; using the default", "err", err)
+		startup.degrade("rpc", err)
+	}
+	daemon.limiter = newRateLimiter(cfg.RPC.RateLimits)
+	daemon.peers, err = newPeerPolicy(cfg.RPC.AllowedGroups)
+	if err != nil {
+		slog.Warn("Invalid allowed group", "err", err)
+		startup.degrade("rpc", err)
+	}
+	daemon.requests, err = newRequestTracker(cfg.RPC.Timeouts)
+	if err != nil {
+		slog.Warn("Invalid request timeout; using the default", "err", err)
+		startup.degrade("rpc", err)
+	}
+
+	if opts.Follow == "" {
+		opts.Follow = cfg.Team.Follow
+	}
+	var leader *TeamClient
+	if opts.Follow != "" {
+		leader, err = NewTeamClient(opts.Follow, cfg.Team.Token, cfg.Team.UpstreamTLS)
+		if err != nil {
+			store.Close()
+			return fmt.Errorf("invalid leader: %w", err)
+		}
+		daemon.following = &followState{leader: opts.Follow}
+	}
+
+	if cfg.Notify.Slack.WebhookURL != "" || len(cfg.Notify.Slack.Routes) > 0 {
+		slack, err := notify.NewSlack(cfg.Notify.Slack)
+		if err != nil {
+			slog.Warn("Slack notifier disabled", "err", err)
+			startup.degrade("slack", err)
+		} else {
+			daemon.events.Subscribe(slack.Handle)
+			go slack.Run(daemon.done)
+		}
+	}
+
+	if len(cfg.Webhooks) > 0 {
+		webhooks, err := webhook.NewDispatcher(cfg.Webhooks)
+		if err != nil {
+			slog.Warn("Webhooks disabled", "err", err)
+			startup.degrade("webhooks", err)
+		} else {
+			daemon.webhooks = webhooks
+			daemon.events.Subscribe(webhooks.Handle)
+		}
+	}
+
+	if cfg.Team.Upstream != "" {
+		upstream, err := NewTeamClient(cfg.Team.Upstream, cfg.Team.Token, cfg.Team.UpstreamTLS)
+		if err != nil {
+			slog.Warn("Team upstream disabled", "err", err)
+			startup.degrade("team_upstream", err)
+		} else {
+			daemon.upstream = upstream
+		}
+	}
+
+	if len(cfg.SLOs) > 0 {
+		slos, err := slo.New(cfg.SLOs)
+		if err != nil {
+			slog.Warn("SLO tracking disabled", "err", err)
+			startup.degrade("slo", err)
+		} else {
+			daemon.slos = slos
+		}
+	}
 
-	// Initialize syncer
-	syncer := sync.New(store, jsonlPath)
+	if !cfg.Anomalies.Disabled {
+		anomalies, err := anomaly.New(cfg.Anomalies)
+		if err != nil {
+			slog.Warn("Duration anomaly detection disabled", "err", err)
+			startup.degrade("anomalies", err)
+		} else {
+			daemon.anomalies = anomalies
+		}
+	}
+
+	if cfg.Mirror.Postgres.DSN != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		pg, err := mirror.OpenPostgres(ctx, cfg.Mirror.Postgres, mirror.RepoName(dir, cfg.Mirror.Postgres))
+		cancel()
+		if err != nil {
+			slog.Warn("Postgres mirror disabled", "err", err)
+			startup.degrade("mirror", err)
+		} else {
+			daemon.mirror = pg
+		}
+	}
 
-	// Do initial sync
-	if err := syncer.ImportFromJSONL(); err != nil {
-		fmt.Printf("Warning: initial import failed: %v\n", err)
+	// Do initial sync; a follower's registry comes from its leader instead
+	if daemon.following == nil {
+		if err := daemon.importJSONL(context.Background()); err != nil {
+			slog.Warn("Initial import failed", "err", err)
+			startup.degrade("import", err)
+		}
+	}
+	if err := daemon.recoverJournal(); err != nil {
+		slog.Warn("Failed to recover interrupted writes", "err", err)
+		startup.degrade("journal", err)
 	}
 
 	// Create Unix socket
-	listener, err := net.Listen("unix", socketPath)
+	listener, err := daemon.listen(cfg.RPC, &startup)
 	if err != nil {
 		store.Close()
-		return fmt.Errorf("failed to create socket: %w", err)
+		return err
 	}
+	socketPath = daemon.socketPath
 
 	// Write PID file
 	pid := os.Getpid()
@@ -106,28 +405,17 @@ func StartDaemon(dir string, intervalStr string) error {
 		return fmt.Errorf("failed to write PID file: %w", err)
 	}
 
-	// Write lock file
-	lockData := LockFile{
-		PID:       pid,
-		ParentPID: os.Getppid(),
-		Database:  dbPath,
-		Version:   "0.2.0",
-		StartedAt: time.Now().UTC(),
-	}
-	lockBytes, _ := json.MarshalIndent(lockData, "", "  ")
-	if err := os.WriteFile(lockPath, lockBytes, 0644); err != nil {
-		os.Remove(pidPath)
-		listener.Close()
-		store.Close()
-		return fmt.Errorf("failed to write lock file: %w", err)
-	}
-
 	// Initialize file watcher
-	watcher, err := watch.New(jsonlPath, func() {
-		syncer.ImportFromJSONL()
-	})
-	if err != nil {
-		fmt.Printf("Warning: file watcher failed: %v\n", err)
+	var watcher *watch.Watcher
+	if daemon.following == nil {
+		watcher, err = watch.New(jsonlPath, func() {
+			defer daemon.recoverPanic("watcher")
+			daemon.importJSONL(context.Background())
+		})
+		if err != nil {
+			slog.Warn("File watcher failed", "err", err)
+			startup.degrade("watcher", err)
+		}
 	}
 
 	var traceWatcher *watch.TraceWatcher
@@ -135,22 +423,104 @@ func StartDaemon(dir string, intervalStr string) error {
 	traceDir := filepath.Join(projectRoot, "test-results")
 	if info, err := os.Stat(traceDir); err == nil && info.IsDir() {
 		traceWatcher, err = watch.NewTraceWatcher(traceDir, func(path string) {
+			defer daemon.recoverPanic("trace watcher")
 			appendTraceInbox(filepath.Join(dir, traceInboxName), projectRoot, path)
 		})
 		if err != nil {
-			fmt.Printf("Warning: trace watcher failed: %v\n", err)
+			slog.Warn("Trace watcher failed", "err", err)
+			startup.degrade("trace_watcher", err)
 		}
 	}
 
-	daemon := &Daemon{
-		dir:          dir,
-		interval:     interval,
-		db:           store,
-		syncer:       syncer,
-		watcher:      watcher,
-		traceWatcher: traceWatcher,
-		listener:     listener,
-		done:         make(chan struct{}),
+	daemon.watcher = watcher
+	daemon.traceWatcher = traceWatcher
+	daemon.listener = listener
+
+	// A tcp:// address is the localhost listener, not the team server
+	localAddr := cfg.RPC.Listen
+	if strings.HasPrefix(opts.Listen, "tcp://") {
+		localAddr, opts.Listen = opts.Listen, ""
+	}
+	if opts.Listen == "" {
+		opts.Listen = cfg.Team.Listen
+	}
+	if opts.Server && opts.Listen == "" {
+		opts.Listen = DefaultTeamAddr
+	}
+	if opts.Listen != "" {
+		if err := daemon.listenTCP(opts.Listen, cfg.Team); err != nil {
+			os.Remove(pidPath)
+			listener.Close()
+			store.Close()
+			return err
+		}
+	}
+	if localAddr != "" {
+		if err := daemon.listenLocalTCP(localAddr, cfg.RPC.Token); err != nil {
+			os.Remove(pidPath)
+			listener.Close()
+			if daemon.tcpListener != nil {
+				daemon.tcpListener.Close()
+			}
+			store.Close()
+			return err
+		}
+	}
+	if opts.Debug == "" {
+		opts.Debug = cfg.Debug.Listen
+	}
+	if opts.Debug != "" {
+		if err := daemon.listenDebug(opts.Debug); err != nil {
+			os.Remove(pidPath)
+			listener.Close()
+			if daemon.tcpListener != nil {
+				daemon.tcpListener.Close()
+			}
+			if daemon.localListener != nil {
+				daemon.localListener.Close()
+			}
+			store.Close()
+			return err
+		}
+	}
+
+	daemon.scheduleJobs(cfg, leader != nil, &startup)
+
+	// Write lock file once every subsystem has started or failed
+	daemon.startup = startup
+	var tcpAddr string
+	if daemon.localListener != nil {
+		tcpAddr = daemon.localListener.Addr().String()
+	}
+	absSocket := socketPath
+	if !isAbstract(socketPath) {
+		if abs, err := filepath.Abs(socketPath); err == nil {
+			absSocket = abs
+		}
+	}
+	lockData := LockFile{
+		PID:       pid,
+		ParentPID: os.Getppid(),
+		Socket:    absSocket,
+		TCP:       tcpAddr,
+		Database:  dbPath,
+		Version:   Version,
+		Protocol:  ProtocolVersion,
+		StartedAt: time.Now().UTC(),
+		Startup:   startup,
+	}
+	lockBytes, _ := json.MarshalIndent(lockData, "", "  ")
+	if err := os.WriteFile(lockPath, lockBytes, 0644); err != nil {
+		os.Remove(pidPath)
+		listener.Close()
+		if daemon.tcpListener != nil {
+			daemon.tcpListener.Close()
+		}
+		if daemon.debugServer != nil {
+			daemon.debugServer.Close()
+		}
+		store.Close()
+		return fmt.Errorf("failed to write lock file: %w", err)
 	}
 
 	// Handle signals
@@ -161,12 +531,24 @@ func StartDaemon(dir string, intervalStr string) error {
 		<-sigChan
 		daemon.Shutdown()
 	}()
+	if opts.ExitWithParent {
+		go daemon.watchParent(lockData.ParentPID, sigChan)
+	}
 
-	fmt.Printf("Tandas daemon started (PID: %d, interval: %s)\n", pid, interval)
-	fmt.Printf("Socket: %s\n", socketPath)
+	slog.Info("Tandas daemon started", "pid", pid, "interval", interval.String(), "socket", socketPath)
+	if !startup.OK() {
+		slog.Warn("Started degraded", "unavailable", len(startup.Degraded))
+	}
 
 	// Start sync loop
-	go daemon.syncLoop()
+	if leader != nil {
+		slog.Info("Following leader (read-only)", "leader", leader.Addr)
+		go daemon.follow(leader)
+	} else {
+		go daemon.syncLoop()
+	}
+
+	daemon.jobs.start(daemon.done)
 
 	// Start watcher
 	if watcher != nil {
@@ -177,9 +559,10 @@ func StartDaemon(dir string, intervalStr string) error {
 	}
 
 	// Accept connections
-	daemon.acceptConnections()
+	daemon.acceptLoop(listener, transportSocket)
 
-	return nil
+	// Shutdown closed the listener; it exits once the files are cleaned up
+	select {}
 }
 
 func (d *Daemon) syncLoop() {
@@ -189,67 +572,245 @@ func (d *Daemon) syncLoop() {
 	for {
 		select {
 		case <-ticker.C:
-			if err := d.syncer.ExportToJSONL(); err != nil {
-				fmt.Printf("Sync error: %v\n", err)
-			}
+			d.syncOnce()
 		case <-d.done:
 			return
 		}
 	}
 }
 
-func (d *Daemon) acceptConnections() {
+// syncOnce exports the registry. A panic is recovered after the write queue
+// is released, so the next tick still runs.
+func (d *Daemon) syncOnce() {
+	defer d.recoverPanic("sync")
+	// Exporting takes a turn like any write, so it never rewrites
+	// issues.jsonl while an import is reading it
+	d.writes.lock("sync")
+	defer d.writes.release()
+	writes := d.syncer.Writes()
+	if err := d.syncer.ExportToJSONL(); err != nil {
+		slog.Error("Sync failed", "err", err)
+		d.errors.add("export: "+err.Error(), time.Now())
+	} else if d.syncer.Writes() != writes {
+		d.feed.add(events.Event{Type: events.Synced, Data: map[string]interface{}{"direction": "export"}})
+		if d.badgeDir != "" {
+			if tandas, err := d.db.GetAllTandas(); err == nil {
+				d.writeBadges(tandas)
+			}
+		}
+	}
+}
+
+// acceptLoop serves connections from l, which arrive over t
+func (d *Daemon) acceptLoop(l net.Listener, t transport) {
 	for {
-		conn, err := d.listener.Accept()
+		conn, err := l.Accept()
 		if err != nil {
 			select {
 			case <-d.done:
 				return
 			default:
-				fmt.Printf("Accept error: %v\n", err)
+				slog.Error("Accept failed", "err", err)
 				continue
 			}
 		}
-		go d.handleConnection(conn)
+		go d.handleConnection(conn, t)
 	}
 }
 
-func (d *Daemon) handleConnection(conn net.Conn) {
+func (d *Daemon) handleConnection(conn net.Conn, t transport) {
+	defer d.recoverPanic("connection")
 	defer conn.Close()
 
-	decoder := json.NewDecoder(conn)
 	encoder := json.NewEncoder(conn)
+	write := func(v interface{}) error {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return encoder.Encode(v)
+	}
+	// Errors before a request is read are sent as JSON-RPC 2.0, since the
+	// client's format is not known yet
+	if !d.conns.acquire() {
+		write(&RPCResponse{JSONRPC: jsonrpcVersion, Error: fmt.Sprintf("too many connections (max %d)", d.conns.max), Code: CodeBusy})
+		return
+	}
+	defer d.conns.release()
 
+	client := "local"
+	if t == transportTeam {
+		client, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+	} else if err := d.peers.check(conn); err != nil {
+		slog.Warn("Refused socket connection", "err", err)
+		write(&RPCResponse{JSONRPC: jsonrpcVersion, Error: err.Error(), Code: CodeUnauthorized})
+		return
+	}
+	reader := newConnReader(conn, d.conns)
 	for {
-		var req RPCRequest
-		if err := decoder.Decode(&req); err != nil {
-			if err != io.EOF {
-				fmt.Printf("Decode error: %v\n", err)
+		var raw json.RawMessage
+		if err := reader.next(&raw); err != nil {
+			var syntax *json.SyntaxError
+			switch {
+			case errors.Is(err, errRequestTooLarge):
+				write(&RPCResponse{JSONRPC: jsonrpcVersion, Error: err.Error(), Code: CodeInvalidRequest})
+			case errors.As(err, &syntax):
+				write(&RPCResponse{JSONRPC: jsonrpcVersion, Error: "parse error: " + err.Error(), Code: CodeParseError})
+			case err != io.EOF:
+				slog.Debug("Decode failed", "err", err)
 			}
 			return
 		}
 
-		resp := d.handleRequest(&req)
-		if err := encoder.Encode(resp); err != nil {
-			fmt.Printf("Encode error: %v\n", err)
+		var out interface{}
+		if isBatch(raw) {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(raw, &batch); err != nil || len(batch) == 0 {
+				out = &RPCResponse{JSONRPC: jsonrpcVersion, Error: "invalid request: empty or malformed batch", Code: CodeInvalidRequest}
+			} else {
+				var resps []*RPCResponse
+				for _, item := range batch {
+					if resp := d.serve(item, client, t, true); resp != nil {
+						resps = append(resps, resp)
+					}
+				}
+				// A batch of notifications gets no response at all
+				if len(resps) > 0 {
+					out = resps
+				}
+			}
+		} else if resp := d.serve(raw, client, t, false); resp != nil {
+			out = resp
+		}
+		if out == nil {
+			continue
+		}
+		if err := write(out); err != nil {
+			slog.Debug("Encode failed", "err", err)
 			return
 		}
 	}
 }
 
-func (d *Daemon) handleRequest(req *RPCRequest) *RPCResponse {
+// serve answers one request after the protocol, token and rate limit
+// checks. It returns nil for a notification. Batches are JSON-RPC 2.0 only.
+func (d *Daemon) serve(raw json.RawMessage, client string, t transport, inBatch bool) *RPCResponse {
+	start := time.Now()
+	req, resp := parseRequest(raw)
+	if resp == nil && inBatch && req.JSONRPC != jsonrpcVersion {
+		resp = errorResponse(req, CodeInvalidRequest, errors.New(`invalid request: batched requests need "jsonrpc": "2.0"`))
+	}
+	if resp != nil {
+		if inBatch {
+			resp.JSONRPC = jsonrpcVersion
+		}
+		return resp
+	}
+	if err := checkProtocol(req.Protocol); err != nil {
+		resp = errorResponse(req, CodeProtocol, err)
+	}
+	if resp == nil && t == transportTeam {
+		if err := d.auth.authorize(req.Token, req.Method); err != nil {
+			resp = errorResponse(req, CodeUnauthorized, err)
+		}
+	}
+	if resp == nil && t == transportLocalTCP {
+		if err := d.checkLocalToken(req.Token); err != nil {
+			resp = errorResponse(req, CodeUnauthorized, err)
+		}
+	}
+	if resp == nil {
+		if ok, wait := d.limiter.allow(client, req.Method, time.Now()); !ok {
+			resp = &RPCResponse{Error: rateLimitError(req.Method, wait), Code: CodeRateLimited,
+				Data: map[string]interface{}{"retry_after": wait.Seconds()}, ID: req.ID}
+		}
+	}
+	if resp == nil && req.Method == "cancel" {
+		resp = d.cancelRequest(req, client)
+	}
+	if resp == nil {
+		slog.Debug("RPC request", "method", req.Method, "client", client)
+		resp = d.run(req, client)
+	}
+	d.metrics.observe(req.Method, time.Since(start), resp.Error != "")
+	if req.notification() {
+		return nil
+	}
+	resp.JSONRPC = req.JSONRPC
+	resp.ID = req.ID
+	return resp
+}
+
+// followerReadOnly are the methods a follower refuses because they would
+// write a registry that belongs to its leader
+var followerReadOnly = map[string]bool{
+	"sync":          true,
+	"import":        true,
+	"import_tandas": true,
+	"push":          true,
+	"record_run":    true,
+	"new_id":        true,
+	"create":        true,
+	"prune":         true,
+	"transaction":   true,
+	"run":           true,
+	"triage":        true,
+	"add_note":      true,
+}
+
+// handleRequest answers one request. Reads stop early once ctx is done;
+// writes to the registry, once begun, run to completion.
+func (d *Daemon) handleRequest(ctx context.Context, req *RPCRequest) *RPCResponse {
+	if d.following != nil && followerReadOnly[req.Method] {
+		return &RPCResponse{Error: fmt.Sprintf("read-only follower of %s", d.following.leader), Code: CodeReadOnly,
+			Data: map[string]interface{}{"leader": d.following.leader}, ID: req.ID}
+	}
+
 	switch req.Method {
 	case "ping":
 		return &RPCResponse{Result: "pong", ID: req.ID}
 
+	case "capabilities":
+		return &RPCResponse{Result: d.capabilities(), ID: req.ID}
+
+	case "heartbeat":
+		var params ProgressParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if params.Runner == "" {
+			return errorResponse(req, CodeInvalidParams, errors.New("runner is required"))
+		}
+		d.runners.heartbeat(params.Runner, time.Now())
+		return &RPCResponse{Result: "ok", ID: req.ID}
+
+	case "progress":
+		var params ProgressParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if params.Runner == "" {
+			return errorResponse(req, CodeInvalidParams, errors.New("runner is required"))
+		}
+		d.runners.progress(params, time.Now())
+		d.feed.add(events.Event{Type: events.Progress, TandaID: params.TandaID, Data: map[string]interface{}{
+			"runner":  params.Runner,
+			"done":    params.Done,
+			"total":   params.Total,
+			"message": params.Message,
+		}})
+		return &RPCResponse{Result: "ok", ID: req.ID}
+
 	case "sync":
-		if err := d.syncer.ExportToJSONL(); err != nil {
+		if err := d.writes.acquire(ctx, "sync"); err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		err := d.syncer.ExportToJSONLContext(ctx)
+		d.writes.release()
+		if err != nil {
 			return &RPCResponse{Error: err.Error(), ID: req.ID}
 		}
 		return &RPCResponse{Result: "synced", ID: req.ID}
 
 	case "import":
-		if err := d.syncer.ImportFromJSONL(); err != nil {
+		if err := d.importJSONL(ctx); err != nil {
 			return &RPCResponse{Error: err.Error(), ID: req.ID}
 		}
 		return &RPCResponse{Result: "imported", ID: req.ID}
@@ -260,16 +821,729 @@ func (d *Daemon) handleRequest(req *RPCRequest) *RPCResponse {
 			"pid":      os.Getpid(),
 			"interval": d.interval.String(),
 		}
+		if d.following != nil {
+			status["following"] = d.following.status()
+		}
+		status["connections"] = d.conns.status()
+		status["rate_limits"] = d.limiter.status()
+		status["cache"] = d.cache.status()
+		status["startup"] = d.startup
+		if d.debugServer != nil {
+			status["debug"] = "http://" + d.debugAddr + "/debug/pprof/"
+		}
+		if p := d.syncer.Progress(); !p.StartedAt.IsZero() {
+			status["import"] = p
+		}
+		if last := d.syncer.LastSyncTime(); !last.IsZero() {
+			status["last_sync"] = last
+		}
+		status["inbox_pending"] = inboxPending(filepath.Join(d.dir, traceInboxName))
+		status["runners"] = d.runners.active(time.Now())
+		status["writes"] = d.writes.status()
+		status["requests"] = d.requests.status()
+		status["recent_errors"] = d.errors.list()
+		status["crashes"] = d.crashes.status()
+		status["resources"] = d.resources()
+		return &RPCResponse{Result: status, ID: req.ID}
+
+	case "query":
+		var filter db.Filter
+		if err := decodeParams(req, &filter); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		tandas, err := d.cache.query(ctx, filter)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: tandas, ID: req.ID}
+
+	case "get":
+		var params GetParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		t, err := d.db.GetTanda(params.ID)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		if t == nil {
+			return errorResponse(req, CodeNotFound, fmt.Errorf("tanda %s not found", params.ID))
+		}
+		return &RPCResponse{Result: t, ID: req.ID}
+
+	case "flakiness_trend":
+		var params FlakinessTrendParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		trends, err := trend.Compute(d.db, params.TandaID, params.Windows, time.Now())
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: trends, ID: req.ID}
+
+	case "failure_clusters":
+		params := ClustersParams{MinSize: 2}
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		tandas, err := d.cache.all(ctx)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: cluster.Build(tandas, params.MinSize), ID: req.ID}
+
+	case "graph":
+		var params GraphParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		tandas, err := d.cache.all(ctx)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		g, err := graph.Build(tandas, d.workflow, params.Root)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		// Without a format the structured graph is returned
+		if params.Format == "" {
+			return &RPCResponse{Result: g, ID: req.ID}
+		}
+		out, err := graph.Render(g, params.Format)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: out, ID: req.ID}
+
+	case "execution_order":
+		var params ExecutionOrderParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		tandas, err := d.cache.all(ctx)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		s, err := graph.Waves(tandas, d.workflow, params.IDs, params.IncludeDeps)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: s, ID: req.ID}
+
+	case "coverage_gaps":
+		var params CoverageGapsParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if params.Manifest == "" {
+			return errorResponse(req, CodeInvalidParams, errors.New("manifest is required"))
+		}
+		// Relative manifests are resolved against the project root
+		path := params.Manifest
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(d.dir), path)
+		}
+		reqs, err := requirements.Load(path)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		tandas, err := d.cache.all(ctx)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: requirements.Check(reqs, tandas, d.workflow), ID: req.ID}
+
+	case "stale":
+		var params StaleParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		tandas, err := d.cache.all(ctx)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		root, err := filepath.Abs(filepath.Dir(d.dir))
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		findings, err := stale.Detect(tandas, root, d.workflow, params.Days, time.Now())
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: findings, ID: req.ID}
+
+	case "heatmap":
+		var opts heatmap.Options
+		if err := decodeParams(req, &opts); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		tandas, err := d.cache.all(ctx)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		opts.Statuses = d.workflow
+		root, err := heatmap.Build(tandas, opts, time.Now())
+		if err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		return &RPCResponse{Result: root, ID: req.ID}
+
+	case "environment_failures":
+		var opts environment.Options
+		if err := decodeParams(req, &opts); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		tandas, err := d.cache.all(ctx)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		opts.Statuses = d.workflow
+		return &RPCResponse{Result: environment.Analyze(tandas, opts, time.Now()), ID: req.ID}
+
+	case "leaderboard":
+		var opts leaderboard.Options
+		if err := decodeParams(req, &opts); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		tandas, err := d.cache.all(ctx)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		opts.Statuses = d.workflow
+		return &RPCResponse{Result: leaderboard.Build(tandas, opts, time.Now()), ID: req.ID}
+
+	case "quarantine_burndown":
+		var opts burndown.Options
+		if err := decodeParams(req, &opts); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if err := opts.Check(); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		tandas, err := d.cache.all(ctx)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: burndown.Build(tandas, opts, time.Now()), ID: req.ID}
+
+	case "bisect":
+		var params BisectParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		t, err := d.db.GetTanda(params.TandaID)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		if t == nil {
+			return errorResponse(req, CodeNotFound, fmt.Errorf("tanda %s not found", params.TandaID))
+		}
+		r := bisect.Locate(t)
+		r.Log(d.root())
+		return &RPCResponse{Result: r, ID: req.ID}
+
+	case "run_diff":
+		var opts rundiff.Options
+		if err := decodeParams(req, &opts); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if err := opts.Check(); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		tandas, err := d.cache.all(ctx)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		diff, err := rundiff.Build(tandas, opts, time.Now())
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: diff, ID: req.ID}
+
+	case "compact":
+		var opts compact.Options
+		if err := decodeParams(req, &opts); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if err := d.writes.acquire(ctx, "compact"); err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		result, err := compact.Run(d.dir, d.db, opts, time.Now())
+		d.writes.release()
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: result, ID: req.ID}
+
+	case "prune":
+		var params PruneParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		result, err := d.runPrune(ctx, params.Options, params.DryRun)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: result, ID: req.ID}
+
+	case "orphaned_paths":
+		var params OrphanedPathsParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		tandas, err := d.cache.all(ctx)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		root, err := filepath.Abs(filepath.Dir(d.dir))
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		findings, err := orphans.Detect(tandas, root, d.workflow, params.Renames)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: findings, ID: req.ID}
+
+	case "export":
+		var params ExportParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		tandas, err := d.cache.query(ctx, params.Filter)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		if params.Format == export.FormatParquet || params.Format == export.FormatMarkdown {
+			if params.Output == "" {
+				return errorResponse(req, CodeInvalidParams, fmt.Errorf("output directory is required for %s", params.Format))
+			}
+			files := export.ParquetFiles
+			if params.Format == export.FormatMarkdown {
+				files = export.MarkdownFiles
+			}
+			paths, err := files(params.Output, tandas)
+			if err != nil {
+				return &RPCResponse{Error: err.Error(), ID: req.ID}
+			}
+			return &RPCResponse{Result: paths, ID: req.ID}
+		}
+		var buf bytes.Buffer
+		params.Options.Statuses = d.workflow
+		if err := export.Write(&buf, tandas, params.Format, params.Options); err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: buf.String(), ID: req.ID}
+
+	case "slo_status":
+		status := []slo.Status{}
+		if d.slos != nil {
+			status = d.slos.Status()
+		}
 		return &RPCResponse{Result: status, ID: req.ID}
 
+	case "push":
+		var params PushParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		result, err := d.handlePush(ctx, params)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: result, ID: req.ID}
+
+	case "record_run":
+		var params RecordRunParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		t, err := d.handleRecordRun(ctx, params)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: t, ID: req.ID}
+
+	case "new_id":
+		result, err := d.newID()
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: result, ID: req.ID}
+
+	case "create":
+		var t db.Tanda
+		if err := decodeParams(req, &t); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		created, err := d.handleCreate(ctx, &t)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: created, ID: req.ID}
+
+	case "transaction":
+		var params TransactionParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		result, err := d.handleTransaction(ctx, params)
+		var txErr *txError
+		if errors.As(err, &txErr) {
+			return &RPCResponse{Error: err.Error(), Code: CodeServerError, Data: map[string]interface{}{"op": txErr.index}, ID: req.ID}
+		}
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: result, ID: req.ID}
+
+	case "add_note":
+		var params AddNoteParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		t, err := d.handleAddNote(ctx, params)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: t, ID: req.ID}
+
+	case "triage":
+		var params TriageParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		t, err := d.handleTriage(ctx, params)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: t, ID: req.ID}
+
+	case "jobs":
+		return &RPCResponse{Result: d.jobs.list(time.Now()), ID: req.ID}
+
+	case "stats":
+		return &RPCResponse{Result: map[string]interface{}{
+			"uptime":    time.Since(d.started).Round(time.Second).String(),
+			"methods":   d.metrics.stats(),
+			"resources": d.resources(),
+		}, ID: req.ID}
+
+	case "badge":
+		var params BadgeParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if params.Kind == "" {
+			params.Kind = badge.PassRate
+		}
+		if err := badge.CheckKind(params.Kind); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		result, err := d.badge(ctx, params)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: result, ID: req.ID}
+
+	case "import_tandas":
+		params := ImportTandasParams{Mode: sync.ImportMerge}
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if _, err := sync.ParseImportMode(string(params.Mode)); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		plan, err := d.importTandas(ctx, params)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: plan, ID: req.ID}
+
+	case "impacted":
+		var params ImpactedParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		result, err := d.impacted(ctx, params)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: result, ID: req.ID}
+
+	case "logs":
+		var params LogsParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		records, err := logs(params)
+		if err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		return &RPCResponse{Result: records, ID: req.ID}
+
+	case "run":
+		var params RunParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		st, err := d.startRun(params)
+		if errors.Is(err, errRunActive) {
+			return errorResponse(req, CodeBusy, err)
+		} else if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: st, ID: req.ID}
+
+	case "run_output":
+		var params RunOutputParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		r := d.runs.get(params.ID)
+		if r == nil {
+			return errorResponse(req, CodeNotFound, fmt.Errorf("run %d not found", params.ID))
+		}
+		wait := min(time.Duration(params.Wait)*time.Second, maxChangesWait)
+		return &RPCResponse{Result: r.output(params.Since, wait, d.done), ID: req.ID}
+
+	case "run_cancel":
+		var params RunCancelParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		r := d.runs.get(params.ID)
+		if r == nil {
+			return errorResponse(req, CodeNotFound, fmt.Errorf("run %d not found", params.ID))
+		}
+		r.cancel()
+		st := r.status()
+		return &RPCResponse{Result: st, ID: req.ID}
+
+	case "tail":
+		var params TailParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		wait := min(time.Duration(params.Wait)*time.Second, maxChangesWait)
+		return &RPCResponse{Result: d.feed.since(params.Since, wait, d.done), ID: req.ID}
+
+	case "changes":
+		var params ChangesParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		wait := min(time.Duration(params.Wait)*time.Second, maxChangesWait)
+		return &RPCResponse{Result: d.changes.since(params.Epoch, params.Since, wait, d.done), ID: req.ID}
+
+	case "delta":
+		var params DeltaParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		// Take the sync point before reading so concurrent edits are resent
+		// rather than missed
+		asOf := peer.Now()
+		tandas, err := d.cache.all(ctx)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		changed := peer.ChangedSince(tandas, params.Since)
+		if changed == nil {
+			changed = []*db.Tanda{}
+		}
+		return &RPCResponse{Result: DeltaResult{AsOf: asOf, Tandas: changed}, ID: req.ID}
+
+	case "covered_by":
+		var params CoveredByParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if params.Path == "" {
+			return errorResponse(req, CodeInvalidParams, errors.New("path is required"))
+		}
+		root, err := filepath.Abs(filepath.Dir(d.dir))
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		tandas, err := d.db.CoveredBy(paths.Normalize(root, params.Path), params.Prefix)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: tandas, ID: req.ID}
+
+	case "tandas_for_file":
+		var params TandasForFileParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if params.Path == "" {
+			return errorResponse(req, CodeInvalidParams, errors.New("path is required"))
+		}
+		for _, r := range params.Lines {
+			if r.Start < 1 || r.End < r.Start {
+				return errorResponse(req, CodeInvalidParams, fmt.Errorf("invalid line range %d-%d", r.Start, r.End))
+			}
+		}
+		path := paths.Normalize(d.root(), params.Path)
+		tandas, err := d.db.ForFile(path)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: editor.ForFile(tandas, path, params.Lines), ID: req.ID}
+
+	case "code_lens":
+		var params CodeLensParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if params.Path == "" {
+			return errorResponse(req, CodeInvalidParams, errors.New("path is required"))
+		}
+		path := paths.Normalize(d.root(), params.Path)
+		tandas, err := d.db.ForFile(path)
+		if err != nil {
+			return &RPCResponse{Error: err.Error(), ID: req.ID}
+		}
+		return &RPCResponse{Result: editor.CodeLens(tandas, path), ID: req.ID}
+
+	case "schema":
+		var params SchemaParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		switch params.Name {
+		case "", "tanda":
+			return &RPCResponse{Result: json.RawMessage(schema.JSON()), ID: req.ID}
+		case "rpc":
+			doc, err := Schema()
+			if err != nil {
+				return &RPCResponse{Error: err.Error(), ID: req.ID}
+			}
+			return &RPCResponse{Result: json.RawMessage(doc), ID: req.ID}
+		}
+		return errorResponse(req, CodeInvalidParams, fmt.Errorf("unknown schema %q: use tanda or rpc", params.Name))
+
+	case "validate":
+		var params ValidateParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if len(params.Document) == 0 {
+			return errorResponse(req, CodeInvalidParams, errors.New("document is required"))
+		}
+		problems := schema.Validate(params.Document)
+		if problems == nil {
+			problems = []schema.Problem{}
+		}
+		return &RPCResponse{Result: ValidateResult{Valid: len(problems) == 0, Problems: problems}, ID: req.ID}
+
+	case "webhook_deliveries":
+		var params WebhookDeliveriesParams
+		if err := decodeParams(req, &params); err != nil {
+			return errorResponse(req, CodeInvalidParams, err)
+		}
+		if d.webhooks == nil {
+			return &RPCResponse{Result: []webhook.Delivery{}, ID: req.ID}
+		}
+		return &RPCResponse{Result: d.webhooks.Deliveries(params.Limit, params.Status), ID: req.ID}
+
 	default:
-		return &RPCResponse{Error: fmt.Sprintf("unknown method: %s", req.Method), ID: req.ID}
+		return errorResponse(req, CodeMethodNotFound, fmt.Errorf("unknown method: %s (td-daemon %s; see capabilities)", req.Method, Version))
+	}
+}
+
+// decodeParams unmarshals request params into v; absent params leave v as is
+func decodeParams(req *RPCRequest, v interface{}) error {
+	if len(req.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(req.Params, v); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	return nil
+}
+
+// importJSONL reloads the database from JSONL and publishes the events
+// implied by the change
+func (d *Daemon) importJSONL(ctx context.Context) error {
+	if err := d.writes.acquire(ctx, "import"); err != nil {
+		return err
+	}
+	defer d.writes.release()
+	return d.importLocked(ctx)
+}
+
+// importLocked imports with the write queue already held
+func (d *Daemon) importLocked(ctx context.Context) error {
+	if err := d.syncer.ImportFromJSONLContext(ctx); err != nil {
+		d.errors.add("import: "+err.Error(), time.Now())
+		return err
+	}
+
+	if errs := d.syncer.ImportErrors(); len(errs) > 0 {
+		for _, e := range errs {
+			d.errors.add("import: "+e, time.Now())
+		}
+		d.events.Publish(events.Event{
+			Type: events.ImportErrors,
+			Data: map[string]interface{}{"errors": errs},
+		})
+	}
+
+	tandas, err := d.db.GetAllTandas()
+	if err != nil {
+		return err
+	}
+	d.feed.add(events.Event{Type: events.Synced, Data: map[string]interface{}{"direction": "import", "tandas": len(tandas)}})
+	d.feed.observeRuns(tandas, time.Now())
+	d.changes.record(tandas)
+	for _, e := range d.detector.Observe(tandas) {
+		d.events.Publish(e)
+	}
+	if d.slos != nil {
+		for _, e := range d.slos.Observe(tandas, time.Now()) {
+			d.events.Publish(e)
+		}
+	}
+	if d.anomalies != nil {
+		for _, e := range d.anomalies.Observe(tandas) {
+			d.events.Publish(e)
+		}
+	}
+
+	if _, err := d.db.RecordFlakiness(time.Now()); err != nil {
+		slog.Warn("Failed to record flakiness snapshot", "err", err)
+	}
+
+	if d.upstream != nil {
+		if pending := d.pendingPush(tandas); len(pending) > 0 {
+			go d.pushUpstream(pending)
+		}
+	}
+	if d.mirror != nil {
+		go d.mirrorSync(tandas)
+	}
+	d.writeBadges(tandas)
+	return nil
+}
+
+// mirrorSync copies the registry to the Postgres mirror. Failures only
+// warn; the next import retries everything not yet mirrored.
+func (d *Daemon) mirrorSync(tandas []*db.Tanda) {
+	defer d.recoverPanic("mirror")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := d.mirror.Sync(ctx, tandas); err != nil {
+		slog.Warn("Postgres mirror failed", "err", err)
 	}
 }
 
 func (d *Daemon) Shutdown() {
-	fmt.Println("\nShutting down daemon...")
+	slog.Info("Shutting down daemon")
 	close(d.done)
+	d.runs.stop(5 * time.Second)
 
 	if d.watcher != nil {
 		d.watcher.Stop()
@@ -277,16 +1551,35 @@ func (d *Daemon) Shutdown() {
 	if d.traceWatcher != nil {
 		d.traceWatcher.Stop()
 	}
+	if d.webhooks != nil {
+		d.webhooks.Stop()
+	}
 
 	d.listener.Close()
+	if d.tcpListener != nil {
+		d.tcpListener.Close()
+	}
+	if d.localListener != nil {
+		d.localListener.Close()
+	}
+	if d.debugServer != nil {
+		d.debugServer.Close()
+	}
+	if d.mirror != nil {
+		d.mirror.Close()
+	}
 	d.db.Close()
+	d.journal.Close()
 
 	// Cleanup files
-	os.Remove(filepath.Join(d.dir, socketName))
+	if !isAbstract(d.socketPath) {
+		os.Remove(d.socketPath)
+	}
 	os.Remove(filepath.Join(d.dir, pidFileName))
 	os.Remove(filepath.Join(d.dir, lockFileName))
+	os.Remove(filepath.Join(d.dir, tokenFileName))
 
-	fmt.Println("Daemon stopped")
+	slog.Info("Daemon stopped")
 	os.Exit(0)
 }
 
@@ -360,18 +1653,18 @@ func appendTraceInbox(inboxPath, projectRoot, filePath string) {
 
 	data, err := json.Marshal(entry)
 	if err != nil {
-		fmt.Printf("Trace inbox marshal error: %v\n", err)
+		slog.Error("Trace inbox marshal failed", "err", err)
 		return
 	}
 
 	f, err := os.OpenFile(inboxPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
 	if err != nil {
-		fmt.Printf("Trace inbox write error: %v\n", err)
+		slog.Error("Trace inbox write failed", "err", err)
 		return
 	}
 	defer f.Close()
 
 	if _, err := f.Write(append(data, '\n')); err != nil {
-		fmt.Printf("Trace inbox write error: %v\n", err)
+		slog.Error("Trace inbox write failed", "err", err)
 	}
 }
@@ -0,0 +1,57 @@
+package rpc_test
+
+import (
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestQueryAndGet(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{},
+		&db.Tanda{ID: "td-0001", Title: "Login", Status: "active", Owners: []string{"@auth"},
+			Notes:      []db.Note{{Timestamp: "2026-10-16T08:00:00Z", Type: "comment", Text: "Retries on 502"}},
+			RunHistory: []db.RunResult{{Result: "pass", Timestamp: "2026-10-16T09:00:00Z"}}},
+		&db.Tanda{ID: "td-0002", Title: "Checkout", Status: "flaky", Owners: []string{"@payments"}},
+		&db.Tanda{ID: "td-0003", Title: "Refund", Status: "flaky", Owners: []string{"@auth"}},
+	)
+
+	tests := []struct {
+		filter db.Filter
+		want   []string
+	}{
+		{db.Filter{}, []string{"td-0001", "td-0002", "td-0003"}},
+		{db.Filter{Status: "flaky"}, []string{"td-0002", "td-0003"}},
+		{db.Filter{Owner: "@auth", Status: "flaky"}, []string{"td-0003"}},
+		{db.Filter{Status: "retired"}, nil},
+	}
+	for _, tt := range tests {
+		var got []*db.Tanda
+		d.call(t, "query", tt.filter, &got)
+		ids := make(map[string]bool)
+		for _, td := range got {
+			ids[td.ID] = true
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("query %+v returned %d tandas, want %v", tt.filter, len(got), tt.want)
+			continue
+		}
+		for _, id := range tt.want {
+			if !ids[id] {
+				t.Errorf("query %+v lacks %s", tt.filter, id)
+			}
+		}
+	}
+
+	var got db.Tanda
+	d.call(t, "get", rpc.GetParams{ID: "td-0001"}, &got)
+	if got.Title != "Login" || len(got.Notes) != 1 || got.Notes[0].Text != "Retries on 502" || len(got.RunHistory) != 1 {
+		t.Errorf("get td-0001 = %+v, want its notes and runs", got)
+	}
+	if err := rpc.Call(d.dir, "get", rpc.GetParams{ID: "td-9999"}, nil); rpcCode(err) != rpc.CodeNotFound {
+		t.Errorf("get of a missing tanda = %v, want not found", err)
+	}
+	if err := rpc.Call(d.dir, "query", map[string]int{"status": 1}, nil); rpcCode(err) != rpc.CodeInvalidParams {
+		t.Errorf("query with a numeric status = %v, want invalid params", err)
+	}
+}
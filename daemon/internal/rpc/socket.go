@@ -0,0 +1,163 @@
+package rpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+)
+
+// maxSocketPath is the longest socket path every supported platform
+// accepts: Linux allows 107 bytes, macOS and the BSDs 103
+const maxSocketPath = 103
+
+// SocketPath returns the socket of the daemon in dir: the one its lock
+// file points to while it runs, else rpc.socket from config, else td.sock
+// in dir
+func SocketPath(dir string) string {
+	if lock, err := ReadLockFile(dir); err == nil && lock.Socket != "" {
+		return lock.Socket
+	}
+	cfg, err := config.Load(dir)
+	if err != nil {
+		return filepath.Join(dir, socketName)
+	}
+	return configuredSocket(dir, cfg.RPC)
+}
+
+// configuredSocket returns the socket config asks for: an abstract one
+// when rpc.abstract_socket is set on Linux, else a path
+func configuredSocket(dir string, cfg config.RPCConfig) string {
+	if cfg.AbstractSocket && runtime.GOOS == "linux" {
+		return abstractSocket(dir)
+	}
+	return pathSocket(dir, cfg)
+}
+
+// abstractSocket names dir's abstract socket, @tandas/ and a hash of the
+// resolved directory
+func abstractSocket(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+	sum := sha256.Sum256([]byte(dir))
+	return "@tandas/" + hex.EncodeToString(sum[:8])
+}
+
+// isAbstract reports whether socket is in the abstract namespace, which
+// has no file to stat, chmod or remove
+func isAbstract(socket string) bool {
+	return strings.HasPrefix(socket, "@")
+}
+
+// socketInUse reports whether the daemon can't take socket: an abstract
+// socket someone answers on, or a socket file that exists
+func socketInUse(socket string) bool {
+	if isAbstract(socket) {
+		conn, err := net.DialTimeout("unix", socket, time.Second)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	_, err := os.Stat(socket)
+	return err == nil
+}
+
+// pathSocket resolves rpc.socket, relative to dir unless absolute
+func pathSocket(dir string, cfg config.RPCConfig) string {
+	switch {
+	case cfg.Socket == "":
+		return filepath.Join(dir, socketName)
+	case filepath.IsAbs(cfg.Socket):
+		return cfg.Socket
+	default:
+		return filepath.Join(dir, cfg.Socket)
+	}
+}
+
+// parseSocketMode reads rpc.socket_mode, an octal mode such as 0660
+func parseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid rpc.socket_mode %q", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// checkSocketPath rejects paths the OS would refuse to bind, with a hint
+// for deep checkouts
+func checkSocketPath(path string) error {
+	if len(path) > maxSocketPath {
+		return fmt.Errorf("socket path %s is %d bytes, over the %d-byte limit; set rpc.socket to a shorter path such as ${XDG_RUNTIME_DIR}/tandas.sock", path, len(path), maxSocketPath)
+	}
+	return nil
+}
+
+// listen binds d.socketPath. An abstract socket that can't be bound,
+// other than because a daemon holds it, falls back to the path socket.
+func (d *Daemon) listen(cfg config.RPCConfig, startup *StartupReport) (net.Listener, error) {
+	if isAbstract(d.socketPath) {
+		l, err := net.Listen("unix", d.socketPath)
+		if err == nil {
+			return l, nil
+		}
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return nil, fmt.Errorf("daemon already running (socket in use: %s)", d.socketPath)
+		}
+		slog.Warn("Abstract socket unavailable; using a socket file", "socket", d.socketPath, "err", err)
+		startup.degrade("rpc", err)
+		d.socketPath = pathSocket(d.dir, cfg)
+		if err := checkSocketPath(d.socketPath); err != nil {
+			return nil, err
+		}
+		if socketInUse(d.socketPath) {
+			return nil, fmt.Errorf("daemon already running (socket exists: %s)", d.socketPath)
+		}
+	}
+
+	// The socket file may live outside dir when rpc.socket says so
+	if err := os.MkdirAll(filepath.Dir(d.socketPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	l, err := net.Listen("unix", d.socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket: %w", err)
+	}
+	mode := d.peers.socketMode()
+	if cfg.SocketMode != "" {
+		if m, err := parseSocketMode(cfg.SocketMode); err != nil {
+			slog.Warn("Invalid socket mode; using the default", "err", err)
+			startup.degrade("rpc", err)
+		} else {
+			mode = m
+		}
+	}
+	if err := os.Chmod(d.socketPath, mode); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	if d.peers.group >= 0 {
+		// Only groups the daemon's user belongs to can be given the socket
+		if err := os.Chown(d.socketPath, -1, d.peers.group); err != nil {
+			slog.Warn("Failed to give the socket to the allowed group", "gid", d.peers.group, "err", err)
+			startup.degrade("rpc", err)
+		}
+	}
+	return l, nil
+}
@@ -0,0 +1,78 @@
+package rpc_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestConfiguredSocket(t *testing.T) {
+	xdg, err := os.MkdirTemp("", "tdrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(xdg)
+	socket := filepath.Join(xdg, "nested", "tandas.sock")
+	d := startDaemon(t, "rpc:\n  socket: "+socket+"\n  socket_mode: \"0640\"\n", rpc.StartOptions{})
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("socket not at rpc.socket: %v", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0640 {
+		t.Errorf("socket mode = %s, want a socket with 0640", info.Mode())
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, "td.sock")); !os.IsNotExist(err) {
+		t.Errorf("td.sock was also created in the state directory: %v", err)
+	}
+	lock, err := rpc.ReadLockFile(d.dir)
+	if err != nil || lock.Socket != socket {
+		t.Fatalf("lock file socket = %q (%v), want %s", lock.Socket, err, socket)
+	}
+	if got := rpc.SocketPath(d.dir); got != socket {
+		t.Errorf("SocketPath = %s, want %s", got, socket)
+	}
+	d.call(t, "ping", nil, nil)
+}
+
+func TestAbstractSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract sockets are Linux only")
+	}
+	d := startDaemon(t, "rpc:\n  abstract_socket: true\n", rpc.StartOptions{})
+
+	lock, err := rpc.ReadLockFile(d.dir)
+	if err != nil || !strings.HasPrefix(lock.Socket, "@tandas/") {
+		t.Fatalf("lock file socket = %q (%v), want @tandas/<hash>", lock.Socket, err)
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, "td.sock")); !os.IsNotExist(err) {
+		t.Errorf("an abstract socket left a file: %v", err)
+	}
+	d.call(t, "ping", nil, nil)
+
+	// A second daemon on the same directory finds the socket taken
+	err = rpc.StartDaemon(d.dir, "1h", rpc.StartOptions{})
+	if err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("second daemon = %v, want already running", err)
+	}
+}
+
+func TestSocketPathTooLong(t *testing.T) {
+	root, err := os.MkdirTemp("", "td")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, strings.Repeat("deep/", 25), ".tandas")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err = rpc.StartDaemon(dir, "1h", rpc.StartOptions{})
+	if err == nil || !strings.Contains(err.Error(), "set rpc.socket to a shorter path") {
+		t.Fatalf("StartDaemon in a deep checkout = %v, want the rpc.socket hint", err)
+	}
+}
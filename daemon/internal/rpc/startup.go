@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// StartupReport records the subsystems that failed to start; the daemon
+// keeps running without them
+type StartupReport struct {
+	Degraded []Degradation `json:"degraded"`
+}
+
+// Degradation is one subsystem that started disabled or on defaults
+type Degradation struct {
+	Subsystem string `json:"subsystem"`
+	Reason    string `json:"reason"`
+}
+
+// OK reports whether every subsystem started
+func (r *StartupReport) OK() bool {
+	return len(r.Degraded) == 0
+}
+
+// degrade records a subsystem that failed to start
+func (r *StartupReport) degrade(subsystem string, err error) {
+	r.Degraded = append(r.Degraded, Degradation{Subsystem: subsystem, Reason: err.Error()})
+}
+
+// ReadLockFile returns the metadata of the daemon running in dir
+func ReadLockFile(dir string) (*LockFile, error) {
+	data, err := os.ReadFile(filepath.Join(dir, lockFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	var lock LockFile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lock file: %w", err)
+	}
+	return &lock, nil
+}
@@ -0,0 +1,53 @@
+package rpc_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestStartupReport(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{})
+	lock, err := rpc.ReadLockFile(d.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lock.Startup.OK() || lock.Startup.Degraded == nil {
+		t.Errorf("healthy startup = %+v, want an empty degraded list", lock.Startup)
+	}
+
+	d = startDaemon(t, "import:\n  duplicates: sometimes\nstatuses:\n  retired: [gone]\n", rpc.StartOptions{})
+	lock, err = rpc.ReadLockFile(d.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.PID != d.cmd.Process.Pid || lock.Protocol != rpc.ProtocolVersion || lock.StartedAt.IsZero() {
+		t.Errorf("lock file = %+v", lock)
+	}
+	if !filepath.IsAbs(lock.Socket) {
+		t.Errorf("lock socket = %q, want an absolute path", lock.Socket)
+	}
+	reasons := make(map[string]string)
+	for _, deg := range lock.Startup.Degraded {
+		reasons[deg.Subsystem] = deg.Reason
+	}
+	if !strings.Contains(reasons["import"], "sometimes") || !strings.Contains(reasons["statuses"], "gone") {
+		t.Errorf("degraded = %+v, want import and statuses with their reasons", lock.Startup.Degraded)
+	}
+
+	// status reports the same degradations as the lock file
+	var status struct {
+		Startup rpc.StartupReport `json:"startup"`
+	}
+	d.call(t, "status", nil, &status)
+	if len(status.Startup.Degraded) != len(lock.Startup.Degraded) {
+		t.Fatalf("status startup = %+v, lock file %+v", status.Startup, lock.Startup)
+	}
+	for i, deg := range status.Startup.Degraded {
+		if deg != lock.Startup.Degraded[i] {
+			t.Errorf("status degradation %d = %+v, lock file %+v", i, deg, lock.Startup.Degraded[i])
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	gosync "sync"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/events"
+)
+
+// feedSize bounds the events kept for tail; a client further behind
+// misses the oldest
+const feedSize = 1000
+
+// TailParams asks for the events after Since, waiting up to Wait seconds
+// for new ones
+type TailParams struct {
+	Since uint64 `json:"since"`
+	Wait  int    `json:"wait,omitempty"`
+}
+
+// TailEvent is an event numbered in the daemon's feed
+type TailEvent struct {
+	Seq uint64 `json:"seq"`
+	events.Event
+}
+
+// TailResult carries the events after the requested sequence and the
+// sequence to ask from next
+type TailResult struct {
+	Seq    uint64      `json:"seq"`
+	Events []TailEvent `json:"events"`
+}
+
+// eventFeed keeps recent daemon activity for tail: everything published on
+// the event bus plus syncs and recorded runs
+type eventFeed struct {
+	mu      gosync.Mutex
+	seq     uint64
+	entries []TailEvent
+	// runs holds each tanda's run count at the last import; nil until the
+	// first one sets a baseline
+	runs map[string]int
+	// wake is closed and replaced whenever events are appended
+	wake chan struct{}
+}
+
+func newEventFeed() *eventFeed {
+	return &eventFeed{wake: make(chan struct{})}
+}
+
+// add appends an event; it is the feed's event bus handler
+func (f *eventFeed) add(e events.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addLocked(e)
+}
+
+func (f *eventFeed) addLocked(e events.Event) {
+	f.seq++
+	f.entries = append(f.entries, TailEvent{Seq: f.seq, Event: e})
+	if over := len(f.entries) - feedSize; over > 0 {
+		f.entries = append([]TailEvent(nil), f.entries[over:]...)
+	}
+	close(f.wake)
+	f.wake = make(chan struct{})
+}
+
+// observeRuns adds a run_recorded event for each tanda with more runs than
+// at the last call
+func (f *eventFeed) observeRuns(tandas []*db.Tanda, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	seeded := f.runs != nil
+	runs := make(map[string]int, len(tandas))
+	for _, t := range tandas {
+		n := len(t.RunHistory)
+		runs[t.ID] = n
+		if !seeded || n <= f.runs[t.ID] {
+			continue
+		}
+		last := t.RunHistory[n-1]
+		f.addLocked(events.Event{Type: events.RunRecorded, Time: now.UTC(), TandaID: t.ID, Data: map[string]interface{}{
+			"title":    t.Title,
+			"result":   last.Result,
+			"duration": last.Duration,
+			"new_runs": n - f.runs[t.ID],
+		}})
+	}
+	f.runs = runs
+}
+
+// since returns the events after seq, blocking up to wait when there are
+// none. A seq ahead of the feed, from before a daemon restart, starts over.
+func (f *eventFeed) since(seq uint64, wait time.Duration, done <-chan struct{}) TailResult {
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	for {
+		f.mu.Lock()
+		if seq > f.seq {
+			seq = 0
+		}
+		result := TailResult{Seq: f.seq, Events: []TailEvent{}}
+		for _, e := range f.entries {
+			if e.Seq > seq {
+				result.Events = append(result.Events, e)
+			}
+		}
+		wake := f.wake
+		f.mu.Unlock()
+		if len(result.Events) > 0 || wait <= 0 {
+			return result
+		}
+		select {
+		case <-wake:
+		case <-deadline.C:
+			return result
+		case <-done:
+			return result
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package rpc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/events"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestTail(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{},
+		&db.Tanda{ID: "td-0001", Title: "Login", Status: "active"})
+
+	var head rpc.TailResult
+	d.call(t, "tail", rpc.TailParams{}, &head)
+
+	// A waiting tail returns as soon as something happens
+	tailed := make(chan rpc.TailResult, 1)
+	errs := make(chan error, 1)
+	go func() {
+		var result rpc.TailResult
+		errs <- rpc.Call(d.dir, "tail", rpc.TailParams{Since: head.Seq, Wait: 10}, &result)
+		tailed <- result
+	}()
+	time.Sleep(100 * time.Millisecond)
+	d.call(t, "record_run", rpc.RecordRunParams{TandaID: "td-0001",
+		Run: db.RunResult{Result: "fail", Timestamp: "2026-10-17T09:00:00Z"}}, nil)
+
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	result := <-tailed
+	if len(result.Events) == 0 || result.Seq <= head.Seq {
+		t.Fatalf("tail after a run = %+v, want new events", result)
+	}
+	var run *rpc.TailEvent
+	for i, e := range result.Events {
+		if e.Seq <= head.Seq {
+			t.Errorf("event %d was already seen at %d", e.Seq, head.Seq)
+		}
+		if e.Type == events.RunRecorded {
+			run = &result.Events[i]
+		}
+	}
+	if run == nil {
+		// The run may land in the import after the first events
+		d.call(t, "tail", rpc.TailParams{Since: result.Seq, Wait: 5}, &result)
+		for i, e := range result.Events {
+			if e.Type == events.RunRecorded {
+				run = &result.Events[i]
+			}
+		}
+	}
+	if run == nil || run.TandaID != "td-0001" || run.Data["result"] != "fail" {
+		t.Fatalf("tail events lack the recorded run: %+v", result.Events)
+	}
+
+	d.call(t, "progress", rpc.ProgressParams{Runner: "ci-1", TandaID: "td-0001", Done: 1, Total: 3}, nil)
+	d.call(t, "tail", rpc.TailParams{Since: result.Seq}, &result)
+	if len(result.Events) != 1 || result.Events[0].Type != events.Progress || result.Events[0].Data["runner"] != "ci-1" {
+		t.Errorf("tail after progress = %+v, want one progress event", result.Events)
+	}
+}
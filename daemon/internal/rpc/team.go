@@ -0,0 +1,272 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/paths"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+// DefaultTeamAddr is the TCP address used by `start --server`
+const DefaultTeamAddr = "127.0.0.1:7420"
+
+// StartOptions configures optional listeners
+type StartOptions struct {
+	// Server enables team server mode on Listen, or DefaultTeamAddr
+	Server bool
+	// Listen is a TCP address to serve the team RPCs on
+	Listen string
+	// Follow is a leader address to replicate from read-only
+	Follow string
+	// Debug is a localhost address to serve pprof profiles on
+	Debug string
+	// ExitWithParent shuts the daemon down when the process that launched
+	// it exits
+	ExitWithParent bool
+}
+
+// teamMethods are the RPCs served over TCP with the token scope each one
+// needs. Methods that touch local files or the daemon process stay on the
+// unix socket.
+var teamMethods = map[string]string{
+	"ping":                 ScopeRead,
+	"capabilities":         ScopeRead,
+	"jobs":                 ScopeRead,
+	"stats":                ScopeRead,
+	"status":               ScopeRead,
+	"query":                ScopeRead,
+	"get":                  ScopeRead,
+	"flakiness_trend":      ScopeRead,
+	"failure_clusters":     ScopeRead,
+	"graph":                ScopeRead,
+	"execution_order":      ScopeRead,
+	"slo_status":           ScopeRead,
+	"changes":              ScopeRead,
+	"delta":                ScopeRead,
+	"covered_by":           ScopeRead,
+	"tandas_for_file":      ScopeRead,
+	"code_lens":            ScopeRead,
+	"badge":                ScopeRead,
+	"impacted":             ScopeRead,
+	"heatmap":              ScopeRead,
+	"environment_failures": ScopeRead,
+	"leaderboard":          ScopeRead,
+	"quarantine_burndown":  ScopeRead,
+	"run_diff":             ScopeRead,
+	"bisect":               ScopeRead,
+	"schema":               ScopeRead,
+	"validate":             ScopeRead,
+	"push":                 ScopeWrite,
+	"cancel":               ScopeWrite,
+	"record_run":           ScopeWrite,
+	"new_id":               ScopeWrite,
+	"create":               ScopeWrite,
+	"transaction":          ScopeWrite,
+	"triage":               ScopeWrite,
+	"add_note":             ScopeWrite,
+}
+
+// PushParams is the payload of the push RPC
+type PushParams struct {
+	// Source identifies the pushing machine in logs
+	Source string      `json:"source,omitempty"`
+	Tandas []*db.Tanda `json:"tandas"`
+}
+
+// PushResult lists the tandas a push changed on the server
+type PushResult struct {
+	Changed []string `json:"changed"`
+}
+
+// DeltaParams asks for the tandas changed at or after Since, a sync point
+// previously returned as AsOf
+type DeltaParams struct {
+	Since string `json:"since,omitempty"`
+}
+
+// DeltaResult holds the changed tandas and the sync point to ask from next
+type DeltaResult struct {
+	AsOf   string      `json:"as_of"`
+	Tandas []*db.Tanda `json:"tandas"`
+}
+
+// RecordRunParams is the payload of the record_run RPC
+type RecordRunParams struct {
+	TandaID string       `json:"tanda_id"`
+	Run     db.RunResult `json:"run"`
+}
+
+func (d *Daemon) listenTCP(addr string, cfg config.TeamConfig) error {
+	auth, err := newAuthenticator(cfg)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := serverTLS(cfg.TLS)
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	if !auth.enabled() && (tlsConfig == nil || tlsConfig.ClientCAs == nil) && !isLoopback(host) {
+		return fmt.Errorf("team server on %s needs team.tokens, team.tokens_file or team.tls.ca; listen on 127.0.0.1 to serve only this machine", addr)
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+	d.tcpListener = l
+	d.auth = auth
+
+	slog.Info("Team server listening", "addr", l.Addr().String(), "tls", tlsConfig != nil, "tokens", auth.enabled())
+	if !auth.enabled() {
+		slog.Warn("Team server has no tokens; anyone who can reach it can push", "addr", addr)
+	}
+	go d.acceptLoop(l, transportTeam)
+	return nil
+}
+
+// handlePush merges pushed tandas into the registry
+func (d *Daemon) handlePush(ctx context.Context, params PushParams) (*PushResult, error) {
+	if err := d.writes.acquire(ctx, "push"); err != nil {
+		return nil, err
+	}
+	defer d.writes.release()
+
+	for _, t := range params.Tandas {
+		if t.ID == "" || t.Title == "" {
+			return nil, fmt.Errorf("tanda %q is missing an id or title", t.ID)
+		}
+		if err := d.checkStatus(t); err != nil {
+			return nil, err
+		}
+		if err := db.CheckFields(t); err != nil {
+			return nil, err
+		}
+		paths.NormalizeTanda(d.root(), t)
+	}
+	result := &PushResult{Changed: []string{}}
+	err := d.journaled(params.Tandas, func() error {
+		changed, err := sync.MergeInto(d.db, params.Tandas)
+		if err != nil || len(changed) == 0 {
+			return err
+		}
+		if params.Source != "" {
+			slog.Info("Merged pushed tandas", "count", len(changed), "source", params.Source)
+		}
+		result.Changed = changed
+		return d.commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// handleRecordRun appends one run to a tanda
+func (d *Daemon) handleRecordRun(ctx context.Context, params RecordRunParams) (*db.Tanda, error) {
+	if err := d.writes.acquire(ctx, "record_run"); err != nil {
+		return nil, err
+	}
+	defer d.writes.release()
+
+	t, err := d.db.GetTanda(params.TandaID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, fmt.Errorf("tanda %s not found", params.TandaID)
+	}
+	switch params.Run.Result {
+	case "pass", "fail", "skip":
+	default:
+		return nil, fmt.Errorf("invalid result %q", params.Run.Result)
+	}
+	t.AddRun(params.Run)
+	if err := d.journaled([]*db.Tanda{t}, func() error {
+		if err := d.db.UpsertTanda(t); err != nil {
+			return err
+		}
+		return d.commit()
+	}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// root is the project root tanda paths are relative to
+func (d *Daemon) root() string {
+	root, _ := paths.Root(d.dir)
+	return root
+}
+
+// checkStatus rejects a tanda whose status is not allowed, or not allowed
+// to follow the stored tanda's status. Callers hold the write queue.
+func (d *Daemon) checkStatus(t *db.Tanda) error {
+	if t.Status == "" {
+		return nil
+	}
+	existing, err := d.db.GetTanda(t.ID)
+	if err != nil {
+		return err
+	}
+	from := ""
+	if existing != nil {
+		from = existing.Status
+	}
+	if err := d.workflow.CheckTransition(from, t.Status); err != nil {
+		return fmt.Errorf("tanda %s: %w", t.ID, err)
+	}
+	return nil
+}
+
+// commit writes the registry back to JSONL and re-imports it so events,
+// snapshots and SLOs see the change. Callers hold the write queue.
+func (d *Daemon) commit() error {
+	if err := d.syncer.ExportToJSONL(); err != nil {
+		return err
+	}
+	return d.importLocked(context.Background())
+}
+
+// pendingPush returns the tandas changed since their last push to the
+// upstream team server. Callers hold the write queue.
+func (d *Daemon) pendingPush(tandas []*db.Tanda) []*db.Tanda {
+	var pending []*db.Tanda
+	for _, t := range tandas {
+		if d.pushed[t.ID] != t.UpdatedAt {
+			pending = append(pending, t)
+		}
+	}
+	return pending
+}
+
+// pushUpstream sends tandas to the team server, recording them as pushed
+// on success. Failures are retried with the next import.
+func (d *Daemon) pushUpstream(tandas []*db.Tanda) {
+	defer d.recoverPanic("upstream push")
+	host, _ := os.Hostname()
+	var result PushResult
+	if err := d.upstream.Call("push", PushParams{Source: host, Tandas: tandas}, &result); err != nil {
+		slog.Warn("Push to team server failed", "addr", d.upstream.Addr, "err", err)
+		return
+	}
+
+	d.writes.lock("mark_pushed")
+	defer d.writes.release()
+	for _, t := range tandas {
+		d.pushed[t.ID] = t.UpdatedAt
+	}
+}
@@ -0,0 +1,165 @@
+package rpc_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+const teamTokens = `team:
+  tokens:
+    - token: reader
+      scope: read
+    - token: writer
+      scope: write
+`
+
+// startTeam runs a daemon serving the team RPCs on loopback TCP with a
+// read and a write token, and returns a client for each
+func startTeam(t *testing.T, tandas ...*db.Tanda) (d *daemon, reader, writer *rpc.TeamClient) {
+	t.Helper()
+	addr := freeAddr(t)
+	d = startDaemon(t, teamTokens, rpc.StartOptions{Listen: addr}, tandas...)
+	client := func(token string) *rpc.TeamClient {
+		c, err := rpc.NewTeamClient(addr, token, config.TLSConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	return d, client("reader"), client("writer")
+}
+
+func TestTeamPush(t *testing.T) {
+	d, _, writer := startTeam(t,
+		&db.Tanda{ID: "td-0001", Title: "Login", Status: "active", RunHistory: []db.RunResult{{Timestamp: "2026-10-16T09:00:00Z", Result: "pass"}}})
+
+	var result rpc.PushResult
+	err := writer.Call("push", rpc.PushParams{Source: "ci", Tandas: []*db.Tanda{
+		{ID: "td-0001", Title: "Login", Status: "active", RunHistory: []db.RunResult{{Timestamp: "2026-10-17T09:00:00Z", Result: "pass"}}},
+		{ID: "td-0002", Title: "Checkout", Status: "active"},
+	}}, &result)
+	if err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if got := strings.Join(result.Changed, ","); got != "td-0001,td-0002" {
+		t.Errorf("changed = %s, want td-0001,td-0002", got)
+	}
+	reg := d.registry(t)
+	if reg["td-0002"] == nil {
+		t.Fatal("pushed tanda td-0002 missing from issues.jsonl")
+	}
+	// A push merges with the server's copy rather than overwriting it
+	if runs := reg["td-0001"].RunHistory; len(runs) != 2 {
+		t.Errorf("td-0001 runs = %+v, want the server's and the pushed run", runs)
+	}
+
+	// The server checks pushed tandas as it checks local writes
+	err = writer.Call("push", rpc.PushParams{Tandas: []*db.Tanda{{ID: "td-0003", Title: "Search", Status: "nonsense"}}}, nil)
+	if err == nil {
+		t.Error("push of an unknown status succeeded")
+	}
+	if d.registry(t)["td-0003"] != nil {
+		t.Error("a rejected push reached issues.jsonl")
+	}
+}
+
+func TestTeamRecordRun(t *testing.T) {
+	d, _, writer := startTeam(t, &db.Tanda{ID: "td-0001", Title: "Login", Status: "active"})
+
+	var got db.Tanda
+	run := db.RunResult{Timestamp: "2026-10-17T09:00:00Z", Result: "fail", Error: "timeout", Runner: "ci-3"}
+	if err := writer.Call("record_run", rpc.RecordRunParams{TandaID: "td-0001", Run: run}, &got); err != nil {
+		t.Fatalf("record_run: %v", err)
+	}
+	if len(got.RunHistory) != 1 || got.RunHistory[0].Result != "fail" {
+		t.Errorf("record_run returned runs %+v", got.RunHistory)
+	}
+	runs := d.registry(t)["td-0001"].RunHistory
+	if len(runs) != 1 || runs[0].Error != "timeout" || runs[0].Runner != "ci-3" {
+		t.Errorf("recorded runs = %+v", runs)
+	}
+
+	if err := writer.Call("record_run", rpc.RecordRunParams{TandaID: "td-9999", Run: run}, nil); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("record_run on an unknown tanda = %v, want not found", err)
+	}
+	run.Result = "maybe"
+	if err := writer.Call("record_run", rpc.RecordRunParams{TandaID: "td-0001", Run: run}, nil); err == nil || !strings.Contains(err.Error(), "invalid result") {
+		t.Errorf("record_run with result maybe = %v, want invalid result", err)
+	}
+}
+
+func TestTeamReadToken(t *testing.T) {
+	d, reader, _ := startTeam(t, &db.Tanda{ID: "td-0001", Title: "Login", Status: "active"})
+
+	var got db.Tanda
+	if err := reader.Call("get", rpc.GetParams{ID: "td-0001"}, &got); err != nil || got.Title != "Login" {
+		t.Fatalf("get with a read token = %+v, %v", got, err)
+	}
+	writes := map[string]interface{}{
+		"push":       rpc.PushParams{Tandas: []*db.Tanda{{ID: "td-0002", Title: "Checkout", Status: "active"}}},
+		"record_run": rpc.RecordRunParams{TandaID: "td-0001", Run: db.RunResult{Timestamp: "2026-10-17T09:00:00Z", Result: "pass"}},
+		"create":     db.Tanda{Title: "Refund"},
+		"cancel":     map[string]int{"id": 1},
+	}
+	for method, params := range writes {
+		err := reader.Call(method, params, nil)
+		if rpcCode(err) != rpc.CodeUnauthorized || !strings.Contains(err.Error(), "forbidden") {
+			t.Errorf("%s with a read token = %v, want forbidden", method, err)
+		}
+	}
+	reg := d.registry(t)
+	if len(reg) != 1 || len(reg["td-0001"].RunHistory) != 0 {
+		t.Errorf("read-token writes changed the registry: %+v", reg)
+	}
+
+	anonymous, err := rpc.NewTeamClient(reader.Addr, "", config.TLSConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := anonymous.Call("get", rpc.GetParams{ID: "td-0001"}, nil); rpcCode(err) != rpc.CodeUnauthorized {
+		t.Errorf("get without a token = %v, want unauthorized", err)
+	}
+}
+
+func TestTeamListenRequiresAuth(t *testing.T) {
+	tokens := config.TeamConfig{Tokens: []config.TokenConfig{{Token: "s3cret", Scope: "write"}}}
+	tests := []struct {
+		name    string
+		addr    string
+		cfg     config.TeamConfig
+		wantErr bool
+	}{
+		{"all interfaces without auth", "0.0.0.0:0", config.TeamConfig{}, true},
+		{"empty host without auth", ":0", config.TeamConfig{}, true},
+		{"all interfaces with tokens", "0.0.0.0:0", tokens, false},
+		{"loopback without auth", "127.0.0.1:0", config.TeamConfig{}, false},
+		{"localhost without auth", "localhost:0", config.TeamConfig{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stop, err := rpc.ListenTeam(tt.addr, tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					stop()
+					t.Fatal("listen succeeded, want an error")
+				}
+				if !strings.Contains(err.Error(), "team.tokens") {
+					t.Errorf("error %q should name the settings that secure the server", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("listen: %v", err)
+			}
+			stop()
+		})
+	}
+
+	if rpc.DefaultTeamAddr != "127.0.0.1:7420" {
+		t.Errorf("DefaultTeamAddr = %q, want a loopback address", rpc.DefaultTeamAddr)
+	}
+}
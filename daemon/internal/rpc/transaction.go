@@ -0,0 +1,213 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/paths"
+)
+
+// Transaction operations
+const (
+	OpCreate    = "create"
+	OpUpdate    = "update"
+	OpRecordRun = "record_run"
+)
+
+// TxOp is one operation of a transaction. Create and update carry the
+// whole tanda; update replaces the stored one, failing when IfUpdatedAt
+// is set and no longer matches, so a read-modify-write can't overwrite a
+// change made in between, and notes a priority or triage change. Record run appends Run to TandaID.
+type TxOp struct {
+	Op          string        `json:"op"`
+	Tanda       *db.Tanda     `json:"tanda,omitempty"`
+	TandaID     string        `json:"tanda_id,omitempty"`
+	Run         *db.RunResult `json:"run,omitempty"`
+	IfUpdatedAt string        `json:"if_updated_at,omitempty"`
+}
+
+// TransactionParams is the payload of the transaction RPC
+type TransactionParams struct {
+	Ops []TxOp `json:"ops"`
+}
+
+// TransactionResult lists the tandas as written, in the order first touched
+type TransactionResult struct {
+	Tandas []*db.Tanda `json:"tandas"`
+}
+
+// txError is a failed operation; the transaction wrote nothing
+type txError struct {
+	index int
+	op    string
+	err   error
+}
+
+func (e *txError) Error() string {
+	return fmt.Sprintf("operation %d (%s) failed, nothing was written: %v", e.index, e.op, e.err)
+}
+
+func (e *txError) Unwrap() error { return e.err }
+
+// txState is a transaction in progress
+type txState struct {
+	batch *db.Batch
+	// used holds the IDs taken, including ones created earlier in the
+	// transaction, and created the IDs whose reservations to release
+	used    map[string]bool
+	created []string
+	now     time.Time
+}
+
+// handleTransaction applies ops in order in one database transaction and
+// one journal entry, so either every operation lands or none does
+func (d *Daemon) handleTransaction(ctx context.Context, params TransactionParams) (*TransactionResult, error) {
+	if len(params.Ops) == 0 {
+		return nil, errors.New("no operations")
+	}
+	if err := d.writes.acquire(ctx, "transaction"); err != nil {
+		return nil, err
+	}
+	defer d.writes.release()
+
+	used, err := d.usedIDs()
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer b.Rollback()
+	tx := &txState{batch: b, used: used, now: time.Now()}
+	defer func() {
+		for _, id := range tx.created {
+			d.ids.Release(id)
+		}
+	}()
+
+	var written []*db.Tanda
+	index := make(map[string]int)
+	for i, op := range params.Ops {
+		t, err := d.applyTxOp(tx, op)
+		if err != nil {
+			return nil, &txError{index: i, op: op.Op, err: err}
+		}
+		if j, ok := index[t.ID]; ok {
+			written[j] = t
+		} else {
+			index[t.ID] = len(written)
+			written = append(written, t)
+		}
+	}
+	if err := d.journaled(written, func() error {
+		if err := b.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return d.commit()
+	}); err != nil {
+		return nil, err
+	}
+	return &TransactionResult{Tandas: written}, nil
+}
+
+// applyTxOp writes one operation into the transaction, which sees the
+// earlier ones
+func (d *Daemon) applyTxOp(tx *txState, op TxOp) (*db.Tanda, error) {
+	b := tx.batch
+	stamp := tx.now.UTC().Format(time.RFC3339)
+	switch op.Op {
+	case OpCreate:
+		if op.Tanda == nil || op.Tanda.Title == "" {
+			return nil, errors.New("title is required")
+		}
+		t := *op.Tanda
+		if t.ID == "" {
+			t.ID = d.ids.Next(tx.used, tx.now)
+		} else if tx.used[t.ID] {
+			return nil, fmt.Errorf("tanda %s already exists", t.ID)
+		}
+		tx.used[t.ID] = true
+		tx.created = append(tx.created, t.ID)
+		if t.Status == "" {
+			t.Status = "active"
+		}
+		if err := d.workflow.CheckStatus(t.Status); err != nil {
+			return nil, err
+		}
+		if err := db.CheckFields(&t); err != nil {
+			return nil, err
+		}
+		paths.NormalizeTanda(d.root(), &t)
+		t.CreatedAt, t.UpdatedAt = stamp, stamp
+		return &t, b.UpsertTanda(&t)
+
+	case OpUpdate:
+		if op.Tanda == nil || op.Tanda.ID == "" {
+			return nil, errors.New("tanda with an id is required")
+		}
+		existing, err := d.txExisting(b, op.Tanda.ID, op.IfUpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		t := *op.Tanda
+		if t.Title == "" {
+			return nil, errors.New("title is required")
+		}
+		if t.Status == "" {
+			t.Status = existing.Status
+		}
+		if err := d.workflow.CheckTransition(existing.Status, t.Status); err != nil {
+			return nil, fmt.Errorf("tanda %s: %w", t.ID, err)
+		}
+		if err := db.CheckFields(&t); err != nil {
+			return nil, err
+		}
+		// Note priority, triage and snooze changes, as the triage RPC does
+		priority, state, snooze := t.Priority, t.Triage, t.SnoozedUntil
+		t.Priority, t.Triage, t.SnoozedUntil = existing.Priority, existing.Triage, existing.SnoozedUntil
+		t.SetTriage(state, stamp)
+		t.SetPriority(priority, stamp)
+		t.SetSnooze(snooze, stamp)
+		// Quarantine spans follow the status rather than the caller
+		t.Quarantines = existing.Quarantines
+		paths.NormalizeTanda(d.root(), &t)
+		t.CreatedAt, t.UpdatedAt = existing.CreatedAt, stamp
+		return &t, b.UpsertTanda(&t)
+
+	case OpRecordRun:
+		if op.Run == nil {
+			return nil, errors.New("run is required")
+		}
+		switch op.Run.Result {
+		case "pass", "fail", "skip":
+		default:
+			return nil, fmt.Errorf("invalid result %q", op.Run.Result)
+		}
+		t, err := d.txExisting(b, op.TandaID, op.IfUpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		t.AddRun(*op.Run)
+		return t, b.UpsertTanda(t)
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// txExisting loads id as b sees it, checking ifUpdatedAt when set
+func (d *Daemon) txExisting(b *db.Batch, id, ifUpdatedAt string) (*db.Tanda, error) {
+	t, err := b.GetTanda(id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, fmt.Errorf("tanda %s not found", id)
+	}
+	if ifUpdatedAt != "" && t.UpdatedAt != ifUpdatedAt {
+		return nil, fmt.Errorf("tanda %s changed at %s, after %s", id, t.UpdatedAt, ifUpdatedAt)
+	}
+	return t, nil
+}
@@ -0,0 +1,106 @@
+package rpc_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestTransaction(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{},
+		&db.Tanda{ID: "td-0001", Title: "Login", Status: "active"},
+		&db.Tanda{ID: "td-0002", Title: "Checkout", Status: "active", DependsOn: []string{"td-0001"}},
+	)
+
+	var result rpc.TransactionResult
+	d.call(t, "transaction", rpc.TransactionParams{Ops: []rpc.TxOp{
+		{Op: "create", Tanda: &db.Tanda{ID: "td-0003", Title: "Auth"}},
+		{Op: "update", Tanda: &db.Tanda{ID: "td-0002", Title: "Checkout", DependsOn: []string{"td-0003"}}},
+		{Op: "record_run", TandaID: "td-0002", Run: &db.RunResult{Result: "pass", Timestamp: "2026-10-17T09:00:00Z"}},
+	}}, &result)
+	if len(result.Tandas) != 2 {
+		t.Fatalf("transaction wrote %d tandas, want 2 (td-0003 and td-0002 once)", len(result.Tandas))
+	}
+	reg := d.registry(t)
+	if reg["td-0003"] == nil {
+		t.Fatal("created tanda missing from issues.jsonl")
+	}
+	if got := reg["td-0002"]; len(got.DependsOn) != 1 || got.DependsOn[0] != "td-0003" || len(got.RunHistory) != 1 {
+		t.Errorf("td-0002 in issues.jsonl = %+v, want the update and the run", got)
+	}
+}
+
+func TestTransactionRollsBack(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{},
+		&db.Tanda{ID: "td-0001", Title: "Login", Status: "active"},
+	)
+	// Export first, so the comparison below is of the daemon's own output
+	d.call(t, "sync", nil, nil)
+	jsonl := filepath.Join(d.dir, "issues.jsonl")
+	before, err := os.ReadFile(jsonl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = rpc.Call(d.dir, "transaction", rpc.TransactionParams{Ops: []rpc.TxOp{
+		{Op: "update", Tanda: &db.Tanda{ID: "td-0001", Title: "Sign in"}},
+		{Op: "create", Tanda: &db.Tanda{ID: "td-0002", Title: "Checkout"}},
+		{Op: "record_run", TandaID: "td-9999", Run: &db.RunResult{Result: "pass"}},
+	}}, nil)
+	var rpcErr *rpc.RPCError
+	if !errors.As(err, &rpcErr) || !strings.Contains(rpcErr.Message, "td-9999 not found") {
+		t.Fatalf("transaction = %v, want td-9999 not found", err)
+	}
+	if data, _ := rpcErr.Data.(map[string]interface{}); data["op"] != float64(2) {
+		t.Errorf("error data = %v, want op 2", rpcErr.Data)
+	}
+
+	// Neither SQLite nor issues.jsonl holds the first two operations
+	var got db.Tanda
+	d.call(t, "get", map[string]string{"id": "td-0001"}, &got)
+	if got.Title != "Login" {
+		t.Errorf("td-0001 title = %q after rollback, want Login", got.Title)
+	}
+	if err := rpc.Call(d.dir, "get", map[string]string{"id": "td-0002"}, &got); err == nil {
+		t.Error("td-0002 was created by a failed transaction")
+	}
+	d.call(t, "sync", nil, nil)
+	after, err := os.ReadFile(jsonl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Errorf("issues.jsonl changed by a failed transaction:\n%s", after)
+	}
+}
+
+func TestTransactionInvalidParams(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{})
+	tests := []struct {
+		name   string
+		params interface{}
+		code   int
+	}{
+		{"ops not a list", map[string]string{"ops": "create"}, rpc.CodeInvalidParams},
+		{"no ops", rpc.TransactionParams{}, rpc.CodeServerError},
+		{"unknown op", rpc.TransactionParams{Ops: []rpc.TxOp{{Op: "delete", TandaID: "td-0001"}}}, rpc.CodeServerError},
+		{"create without title", rpc.TransactionParams{Ops: []rpc.TxOp{{Op: "create", Tanda: &db.Tanda{}}}}, rpc.CodeServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rpc.Call(d.dir, "transaction", tt.params, nil)
+			if rpcCode(err) != tt.code {
+				t.Fatalf("transaction = %v (code %d), want code %d", err, rpcCode(err), tt.code)
+			}
+		})
+	}
+	if got := d.registry(t); len(got) != 0 {
+		t.Errorf("invalid transactions wrote %d tandas", len(got))
+	}
+}
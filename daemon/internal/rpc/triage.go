@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// clearField is the triage param value that clears a field
+const clearField = "none"
+
+// TriageParams is the payload of the triage RPC. Empty fields are left as
+// they are and "none" clears one. Snooze is a number of days to keep the
+// tanda off the flaky leaderboard. Note is added after the transitions.
+type TriageParams struct {
+	ID       string `json:"id"`
+	State    string `json:"state,omitempty"`
+	Priority string `json:"priority,omitempty"`
+	Snooze   string `json:"snooze,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+// handleTriage moves a tanda through the triage workflow, noting each
+// change so the tanda keeps its triage history
+func (d *Daemon) handleTriage(ctx context.Context, params TriageParams) (*db.Tanda, error) {
+	if params.ID == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+	state, priority := params.State, params.Priority
+	if state == clearField {
+		state = ""
+	} else if err := db.CheckTriage(state); err != nil {
+		return nil, err
+	}
+	if priority == clearField {
+		priority = ""
+	} else if err := db.CheckPriority(priority); err != nil {
+		return nil, err
+	}
+	snoozeDays := 0
+	if params.Snooze != "" && params.Snooze != clearField {
+		days, err := strconv.Atoi(params.Snooze)
+		if err != nil || days <= 0 {
+			return nil, fmt.Errorf("invalid snooze %q: use a number of days or none", params.Snooze)
+		}
+		snoozeDays = days
+	}
+
+	if err := d.writes.acquire(ctx, "triage"); err != nil {
+		return nil, err
+	}
+	defer d.writes.release()
+
+	t, err := d.db.GetTanda(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, fmt.Errorf("tanda %s not found", params.ID)
+	}
+	at := time.Now().UTC()
+	now := at.Format(time.RFC3339)
+	changed := false
+	if params.State != "" && t.SetTriage(state, now) {
+		changed = true
+	}
+	if params.Priority != "" && t.SetPriority(priority, now) {
+		changed = true
+	}
+	if params.Snooze != "" {
+		until := ""
+		if snoozeDays > 0 {
+			until = at.AddDate(0, 0, snoozeDays).Format(time.RFC3339)
+		}
+		if t.SetSnooze(until, now) {
+			changed = true
+		}
+	}
+	if params.Note != "" {
+		t.Notes = append(t.Notes, db.Note{Timestamp: now, Type: db.NoteTriage, Text: params.Note})
+		changed = true
+	}
+	if !changed {
+		return t, nil
+	}
+	t.UpdatedAt = now
+	if err := d.journaled([]*db.Tanda{t}, func() error {
+		if err := d.db.UpsertTanda(t); err != nil {
+			return err
+		}
+		return d.commit()
+	}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tandas/daemon/internal/schema"
+)
+
+// Version is the daemon release
+const Version = "0.2.0"
+
+// ProtocolVersion is the RPC protocol this daemon speaks. It is bumped when
+// a method's params or result change incompatibly; clients declaring a
+// protocol below MinProtocolVersion are refused.
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+// Methods lists every RPC the daemon serves
+var Methods = []string{
+	"ping", "capabilities", "cancel", "heartbeat", "progress", "sync", "import", "import_tandas", "status", "query", "get",
+	"flakiness_trend", "failure_clusters", "graph", "execution_order", "coverage_gaps", "stale", "heatmap",
+	"environment_failures", "leaderboard", "quarantine_burndown", "run_diff", "bisect", "compact", "prune", "orphaned_paths", "export", "slo_status", "push",
+	"record_run", "new_id", "create", "transaction", "triage", "add_note", "jobs", "stats", "logs", "run", "run_output", "run_cancel", "tail", "changes", "delta", "covered_by", "tandas_for_file", "code_lens", "impacted", "badge",
+	"schema", "validate", "webhook_deliveries",
+}
+
+// Capabilities describes what a daemon supports, so clients can check
+// before relying on a method
+type Capabilities struct {
+	Version       string `json:"version"`
+	Protocol      int    `json:"protocol"`
+	MinProtocol   int    `json:"min_protocol"`
+	SchemaVersion int    `json:"schema_version"`
+	// Methods are those this daemon serves on its socket; a follower leaves
+	// out the writes it refuses
+	Methods []string `json:"methods"`
+	// TeamMethods are the subset served on the team listener
+	TeamMethods []string `json:"team_methods"`
+	ReadOnly    bool     `json:"read_only,omitempty"`
+}
+
+func (d *Daemon) capabilities() Capabilities {
+	c := Capabilities{
+		Version:       Version,
+		Protocol:      ProtocolVersion,
+		MinProtocol:   MinProtocolVersion,
+		SchemaVersion: schema.Version,
+		Methods:       []string{},
+		TeamMethods:   []string{},
+		ReadOnly:      d.following != nil,
+	}
+	for _, m := range Methods {
+		if c.ReadOnly && followerReadOnly[m] {
+			continue
+		}
+		c.Methods = append(c.Methods, m)
+		if _, ok := teamMethods[m]; ok {
+			c.TeamMethods = append(c.TeamMethods, m)
+		}
+	}
+	sort.Strings(c.Methods)
+	sort.Strings(c.TeamMethods)
+	return c
+}
+
+// checkProtocol refuses a client whose declared protocol this daemon cannot
+// serve. Clients that declare none are served as before.
+func checkProtocol(protocol int) error {
+	switch {
+	case protocol == 0:
+		return nil
+	case protocol > ProtocolVersion:
+		return fmt.Errorf("client protocol %d is newer than this daemon supports (td-daemon %s speaks %d); upgrade the daemon", protocol, Version, ProtocolVersion)
+	case protocol < MinProtocolVersion:
+		return fmt.Errorf("client protocol %d is no longer supported (td-daemon %s needs %d or later); upgrade the client", protocol, Version, MinProtocolVersion)
+	}
+	return nil
+}
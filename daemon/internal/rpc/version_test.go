@@ -0,0 +1,55 @@
+package rpc_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestProtocolHandshake(t *testing.T) {
+	d := startDaemon(t, "", rpc.StartOptions{})
+	c := d.dial(t)
+
+	tests := []struct {
+		name     string
+		protocol string
+		want     string
+	}{
+		{"compatible client", fmt.Sprintf(`,"protocol":%d`, rpc.ProtocolVersion), ""},
+		{"client without a version", "", ""},
+		{"newer client", fmt.Sprintf(`,"protocol":%d`, rpc.ProtocolVersion+1), "upgrade the daemon"},
+		{"retired client", `,"protocol":-1`, "upgrade the client"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp response
+			decode(t, c.roundTrip(t, `{"jsonrpc":"2.0","id":1,"method":"ping"`+tt.protocol+`}`), &resp)
+			if tt.want == "" {
+				if string(resp.Result) != `"pong"` {
+					t.Fatalf("ping = %+v, want pong", resp)
+				}
+				return
+			}
+			if errorCode(t, resp.Error) != rpc.CodeProtocol || !strings.Contains(string(resp.Error), tt.want) {
+				t.Fatalf("ping = %s, want a protocol error saying %q", resp.Error, tt.want)
+			}
+		})
+	}
+
+	var caps rpc.Capabilities
+	d.call(t, "capabilities", nil, &caps)
+	if caps.Version != rpc.Version || caps.Protocol != rpc.ProtocolVersion || caps.MinProtocol != rpc.MinProtocolVersion {
+		t.Errorf("capabilities = %+v", caps)
+	}
+	served := make(map[string]bool)
+	for _, m := range caps.Methods {
+		served[m] = true
+	}
+	for _, m := range []string{"ping", "capabilities", "transaction"} {
+		if !served[m] {
+			t.Errorf("capabilities methods %v lack %s", caps.Methods, m)
+		}
+	}
+}
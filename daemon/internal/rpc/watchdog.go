@@ -0,0 +1,41 @@
+package rpc
+
+import (
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+)
+
+// parentCheckInterval is how often --exit-with-parent looks for the parent
+const parentCheckInterval = 2 * time.Second
+
+// watchParent asks for a shutdown on stop once parent, the process that
+// launched the daemon, has exited. An orphan is re-parented to init or a
+// subreaper, so a changed parent PID means the launcher is gone even if its
+// PID has since been reused.
+func (d *Daemon) watchParent(parent int, stop chan<- os.Signal) {
+	if parent <= 1 {
+		slog.Warn("Launched without a parent process to watch; ignoring --exit-with-parent", "parent_pid", parent)
+		return
+	}
+	ticker := time.NewTicker(parentCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if os.Getppid() == parent {
+				continue
+			}
+			slog.Info("Parent process exited; shutting down", "parent_pid", parent)
+			select {
+			case stop <- syscall.SIGTERM:
+			default:
+				// A signal is already pending
+			}
+			return
+		case <-d.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package rpc_test
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/tandas/daemon/internal/rpc"
+)
+
+func TestExitWithParent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell to launch the daemon")
+	}
+	root, err := os.MkdirTemp("", "td")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, ".tandas")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// Don't leave the daemon behind if it outlived its parent
+		if pid, err := os.ReadFile(filepath.Join(dir, "daemon.pid")); err == nil {
+			if n, err := strconv.Atoi(string(pid)); err == nil {
+				if p, err := os.FindProcess(n); err == nil {
+					p.Kill()
+				}
+			}
+		}
+	})
+
+	// The shell stands in for an editor that launches the daemon and exits
+	opts, _ := json.Marshal(rpc.StartOptions{ExitWithParent: true})
+	launcher := exec.Command("sh", "-c", `"$0" "$1" >/dev/null 2>&1 & read line`, os.Args[0], "-test.run=^$")
+	launcher.Env = append(os.Environ(), daemonEnv+"="+dir, daemonEnv+"_OPTS="+string(opts))
+	stdin, err := launcher.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := launcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "the daemon to start", func() bool { return rpc.Call(dir, "ping", nil, nil) == nil })
+	lock, err := rpc.ReadLockFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.ParentPID != launcher.Process.Pid {
+		t.Errorf("lock file parent_pid = %d, want the launcher's %d", lock.ParentPID, launcher.Process.Pid)
+	}
+
+	stdin.Close()
+	launcher.Wait()
+	eventually(t, "the daemon to exit after its parent", func() bool {
+		_, err := os.Stat(filepath.Join(dir, "daemon.lock"))
+		return os.IsNotExist(err) && rpc.Call(dir, "ping", nil, nil) == rpc.ErrNotRunning
+	})
+}
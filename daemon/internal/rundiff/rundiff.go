@@ -0,0 +1,285 @@
+// Package rundiff compares test health at two points, two ingestion
+// batches or two times, listing the tests that newly failed, were fixed or
+// moved in or out of quarantine, for summarizing what a change did to the
+// suite in a CI comment
+package rundiff
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// Options pick the two points compared: From and To batches, or From and
+// To times. With only ToBatch, it is compared with the batch before it;
+// an empty To time means now.
+type Options struct {
+	FromBatch string `json:"from_batch,omitempty"`
+	ToBatch   string `json:"to_batch,omitempty"`
+	// From and To are RFC 3339 times; each tanda's latest result at or
+	// before them counts
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// Check returns an error unless the options name two batches or a time
+func (o Options) Check() error {
+	batches, times := o.FromBatch != "" || o.ToBatch != "", o.From != "" || o.To != ""
+	switch {
+	case batches && times:
+		return errors.New("compare either batches or times, not both")
+	case batches && o.ToBatch == "":
+		return errors.New("to_batch is required with from_batch")
+	case !batches && o.From == "":
+		return errors.New("name a to_batch, or a from time")
+	}
+	for _, ts := range []string{o.From, o.To} {
+		if _, ok := db.ParseTimestamp(ts); ts != "" && !ok {
+			return fmt.Errorf("invalid time %q: use RFC 3339", ts)
+		}
+	}
+	return nil
+}
+
+// Entry is a tanda whose result or status differs between the two points.
+// Before and After are pass or fail, or empty without a result.
+type Entry struct {
+	ID     string   `json:"id"`
+	Title  string   `json:"title"`
+	Owners []string `json:"owners,omitempty"`
+	Before string   `json:"before,omitempty"`
+	After  string   `json:"after,omitempty"`
+	// Error is the failure message of the failing run at To
+	Error string `json:"error,omitempty"`
+}
+
+// Diff is what changed between From and To. Quarantined and Released
+// list the tandas that entered or left quarantine between the two times.
+type Diff struct {
+	From         string    `json:"from"`
+	To           string    `json:"to"`
+	FromTime     time.Time `json:"from_time"`
+	ToTime       time.Time `json:"to_time"`
+	NewlyFailing []Entry   `json:"newly_failing"`
+	NewlyPassing []Entry   `json:"newly_passing"`
+	StillFailing []Entry   `json:"still_failing"`
+	New          []Entry   `json:"new"`
+	Quarantined  []Entry   `json:"quarantined"`
+	Released     []Entry   `json:"released"`
+	// Unchanged counts the tandas that passed at both points
+	Unchanged int `json:"unchanged"`
+}
+
+// outcome is a tanda's result at one point
+type outcome struct {
+	result, err string
+}
+
+// Build compares the tandas at the two points of opts, which must pass
+// Check. It fails when a batch has no runs.
+func Build(tandas []*db.Tanda, opts Options, now time.Time) (*Diff, error) {
+	if err := opts.Check(); err != nil {
+		return nil, err
+	}
+	d := &Diff{}
+	var before, after func(t *db.Tanda) outcome
+	if opts.ToBatch != "" {
+		from, to, err := resolveBatches(tandas, opts.FromBatch, opts.ToBatch)
+		if err != nil {
+			return nil, err
+		}
+		d.From, d.To = from.name, to.name
+		d.FromTime, d.ToTime = from.last, to.last
+		before = func(t *db.Tanda) outcome { return inBatch(t, from.name) }
+		after = func(t *db.Tanda) outcome { return inBatch(t, to.name) }
+	} else {
+		d.From, d.FromTime = opts.From, mustParse(opts.From)
+		d.To, d.ToTime = opts.To, now
+		if opts.To == "" {
+			d.To = now.UTC().Format(time.RFC3339)
+		} else {
+			d.ToTime = mustParse(opts.To)
+		}
+		before = func(t *db.Tanda) outcome { return latest(t, d.FromTime) }
+		after = func(t *db.Tanda) outcome { return latest(t, d.ToTime) }
+	}
+
+	d.NewlyFailing, d.NewlyPassing, d.StillFailing, d.New = []Entry{}, []Entry{}, []Entry{}, []Entry{}
+	d.Quarantined, d.Released = []Entry{}, []Entry{}
+	for _, t := range tandas {
+		was, is := before(t), after(t)
+		e := Entry{ID: t.ID, Title: t.Title, Owners: t.Owners, Before: was.result, After: is.result}
+		if is.result == "fail" {
+			e.Error = is.err
+		}
+		switch {
+		case is.result == "":
+		case was.result == "":
+			d.New = append(d.New, e)
+		case was.result == "pass" && is.result == "fail":
+			d.NewlyFailing = append(d.NewlyFailing, e)
+		case was.result == "fail" && is.result == "pass":
+			d.NewlyPassing = append(d.NewlyPassing, e)
+		case is.result == "fail":
+			d.StillFailing = append(d.StillFailing, e)
+		default:
+			d.Unchanged++
+		}
+
+		switch was, is := quarantinedAt(t, d.FromTime), quarantinedAt(t, d.ToTime); {
+		case !was && is:
+			d.Quarantined = append(d.Quarantined, e)
+		case was && !is:
+			d.Released = append(d.Released, e)
+		}
+	}
+	for _, list := range [][]Entry{d.NewlyFailing, d.NewlyPassing, d.StillFailing, d.New, d.Quarantined, d.Released} {
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	}
+	return d, nil
+}
+
+// batch is a batch's name and the span of its run timestamps
+type batch struct {
+	name        string
+	first, last time.Time
+}
+
+// resolveBatches finds both batches, taking the batch that started last
+// before to when from is empty
+func resolveBatches(tandas []*db.Tanda, from, to string) (batch, batch, error) {
+	spans := make(map[string]*batch)
+	for _, t := range tandas {
+		for _, r := range t.RunHistory {
+			ts, ok := db.ParseTimestamp(r.Timestamp)
+			if r.Batch == "" || !ok {
+				continue
+			}
+			b := spans[r.Batch]
+			if b == nil {
+				b = &batch{name: r.Batch, first: ts, last: ts}
+				spans[r.Batch] = b
+			}
+			if ts.Before(b.first) {
+				b.first = ts
+			}
+			if ts.After(b.last) {
+				b.last = ts
+			}
+		}
+	}
+	end := spans[to]
+	if end == nil {
+		return batch{}, batch{}, fmt.Errorf("no runs in batch %q", to)
+	}
+	if from != "" {
+		start := spans[from]
+		if start == nil {
+			return batch{}, batch{}, fmt.Errorf("no runs in batch %q", from)
+		}
+		return *start, *end, nil
+	}
+	var prev *batch
+	for _, b := range spans {
+		if b.name != to && b.first.Before(end.first) && (prev == nil || b.first.After(prev.first)) {
+			prev = b
+		}
+	}
+	if prev == nil {
+		return batch{}, batch{}, fmt.Errorf("no batch before %q to compare with", to)
+	}
+	return *prev, *end, nil
+}
+
+// inBatch is the tanda's result in a batch: fail when any of its runs in
+// the batch failed, else pass when one passed
+func inBatch(t *db.Tanda, name string) outcome {
+	var o outcome
+	for _, r := range t.RunHistory {
+		if r.Batch != name || r.Summary != nil {
+			continue
+		}
+		switch {
+		case r.Result == "fail":
+			o = outcome{result: "fail", err: r.Error}
+		case r.Result == "pass" && o.result == "":
+			o.result = "pass"
+		}
+	}
+	return o
+}
+
+// latest is the tanda's last pass or fail at or before at
+func latest(t *db.Tanda, at time.Time) outcome {
+	var o outcome
+	var when time.Time
+	for _, r := range t.RunHistory {
+		ts, ok := db.ParseTimestamp(r.Timestamp)
+		if !ok || ts.After(at) || ts.Before(when) || (r.Result != "pass" && r.Result != "fail") {
+			continue
+		}
+		o, when = outcome{result: r.Result, err: r.Error}, ts
+	}
+	return o
+}
+
+func quarantinedAt(t *db.Tanda, at time.Time) bool {
+	for _, q := range t.Quarantines {
+		entered, ok := db.ParseTimestamp(q.Entered)
+		if !ok || entered.After(at) {
+			continue
+		}
+		if left, ok := db.ParseTimestamp(q.Left); q.Left == "" || (ok && left.After(at)) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParse(ts string) time.Time {
+	t, _ := db.ParseTimestamp(ts)
+	return t
+}
+
+// Markdown renders the diff as a CI or pull request comment
+func (d *Diff) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Test health: %s → %s\n\n", d.From, d.To)
+	fmt.Fprintf(&b, "%d newly failing, %d fixed, %d still failing, %d new, %d quarantined, %d released, %d unchanged\n",
+		len(d.NewlyFailing), len(d.NewlyPassing), len(d.StillFailing), len(d.New), len(d.Quarantined), len(d.Released), d.Unchanged)
+
+	section := func(title string, entries []Entry, withResult bool) {
+		if len(entries) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n#### %s (%d)\n\n", title, len(entries))
+		for _, e := range entries {
+			line := fmt.Sprintf("- `%s` %s", e.ID, e.Title)
+			if withResult {
+				line += " (" + e.After + ")"
+			}
+			if e.Error != "" {
+				line += ": " + firstLine(e.Error)
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	section("Newly failing", d.NewlyFailing, false)
+	section("Fixed", d.NewlyPassing, false)
+	section("Still failing", d.StillFailing, false)
+	section("New", d.New, true)
+	section("Quarantined", d.Quarantined, false)
+	section("Released from quarantine", d.Released, false)
+	return b.String()
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
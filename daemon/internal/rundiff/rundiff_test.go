@@ -0,0 +1,80 @@
+package rundiff_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rundiff"
+)
+
+func run(batch, ts, result string) db.RunResult {
+	r := db.RunResult{Batch: batch, Timestamp: "2025-06-0" + ts, Result: result}
+	if result == "fail" {
+		r.Error = "expected 200, got 500\n  at checkout.spec.ts:12"
+	}
+	return r
+}
+
+func ids(entries []rundiff.Entry) string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.ID)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestBuild(t *testing.T) {
+	tandas := []*db.Tanda{
+		{ID: "td-broke", Title: "Checkout", RunHistory: []db.RunResult{
+			run("101", "1T10:00:00Z", "pass"), run("102", "2T10:00:00Z", "pass"), run("103", "3T10:00:00Z", "fail")}},
+		{ID: "td-fixed", Title: "Login", RunHistory: []db.RunResult{
+			run("102", "2T10:00:00Z", "fail"), run("103", "3T10:00:00Z", "pass")},
+			Quarantines: []db.Quarantine{{Entered: "2025-06-01T00:00:00Z", Left: "2025-06-03T10:00:00Z"}}},
+		// A retry that failed once makes the batch fail
+		{ID: "td-still", Title: "Search", RunHistory: []db.RunResult{
+			run("102", "2T10:00:00Z", "fail"), run("103", "3T10:00:00Z", "pass"), run("103", "3T10:05:00Z", "fail")},
+			Quarantines: []db.Quarantine{{Entered: "2025-06-02T12:00:00Z"}}},
+		{ID: "td-added", Title: "Wishlist", RunHistory: []db.RunResult{run("103", "3T10:00:00Z", "pass")}},
+		{ID: "td-green", Title: "Home", RunHistory: []db.RunResult{run("102", "2T10:00:00Z", "pass"), run("103", "3T10:00:00Z", "pass")}},
+		{ID: "td-skipped", Title: "Export", RunHistory: []db.RunResult{run("102", "2T10:00:00Z", "pass")}},
+	}
+	now := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	// Without from_batch, 103 is compared with the batch before it
+	d, err := rundiff.Build(tandas, rundiff.Options{ToBatch: "103"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.From != "102" || ids(d.NewlyFailing) != "td-broke" || ids(d.NewlyPassing) != "td-fixed" ||
+		ids(d.StillFailing) != "td-still" || ids(d.New) != "td-added" || d.Unchanged != 1 {
+		t.Fatalf("unexpected diff %+v", d)
+	}
+	if ids(d.Quarantined) != "td-still" || ids(d.Released) != "td-fixed" {
+		t.Fatalf("unexpected status changes %+v / %+v", d.Quarantined, d.Released)
+	}
+	md := d.Markdown()
+	if !strings.Contains(md, "1 newly failing, 1 fixed") || !strings.Contains(md, "- `td-broke` Checkout: expected 200, got 500\n") {
+		t.Fatalf("unexpected markdown:\n%s", md)
+	}
+
+	// Between two times each tanda's latest result counts
+	d, err = rundiff.Build(tandas, rundiff.Options{From: "2025-06-01T12:00:00Z", To: "2025-06-02T12:00:00Z"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(d.New) != "td-fixed,td-green,td-skipped,td-still" || d.Unchanged != 1 || len(d.NewlyFailing) != 0 {
+		t.Fatalf("unexpected diff between times %+v", d)
+	}
+
+	if _, err := rundiff.Build(tandas, rundiff.Options{ToBatch: "101"}, now); err == nil {
+		t.Error("expected the first batch to have nothing to compare with")
+	}
+	if _, err := rundiff.Build(tandas, rundiff.Options{FromBatch: "100", ToBatch: "103"}, now); err == nil {
+		t.Error("expected an unknown batch to be rejected")
+	}
+	if err := (rundiff.Options{ToBatch: "103", From: "2025-06-01T00:00:00Z"}).Check(); err == nil {
+		t.Error("expected batches and times together to be rejected")
+	}
+}
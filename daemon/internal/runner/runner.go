@@ -0,0 +1,270 @@
+// Package runner plans the test commands the daemon runs for selected
+// tandas and reads their results back as runs
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/ci"
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+)
+
+// Report formats
+const (
+	JUnit  = "junit"
+	GoJSON = "go-json"
+	Exit   = "exit"
+)
+
+// Placeholders expanded in a runner's command
+const (
+	filesArg = "{files}"
+	dirsArg  = "{dirs}"
+	namesArg = "{names}"
+)
+
+// DefaultTimeout bounds a runner's command when it sets no timeout
+const DefaultTimeout = 30 * time.Minute
+
+// Plan is one runner command and the tandas it runs
+type Plan struct {
+	Runner  string
+	Config  config.RunnerConfig
+	Tandas  []*db.Tanda
+	Args    []string
+	Timeout time.Duration
+}
+
+// Check reports a runner config that can't be run
+func Check(name string, c config.RunnerConfig) error {
+	if len(c.Command) == 0 {
+		return fmt.Errorf("runner %s has no command", name)
+	}
+	switch c.Report {
+	case "", Exit, GoJSON, JUnit:
+	default:
+		return fmt.Errorf("runner %s: invalid report %q (want junit, go-json or exit)", name, c.Report)
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("runner %s: invalid timeout %q", name, c.Timeout)
+		}
+	}
+	for _, g := range c.Match {
+		if _, err := filepath.Match(g, ""); err != nil {
+			return fmt.Errorf("runner %s: invalid match %q: %w", name, g, err)
+		}
+	}
+	return nil
+}
+
+// Plans groups tandas into one plan per runner, ordered by runner name: the
+// runner called name for all of them, or else the first runner whose match
+// globs a tanda's file. The IDs of tandas no runner can run are returned
+// too, including those without a file for a command that runs files.
+func Plans(runners map[string]config.RunnerConfig, name string, tandas []*db.Tanda) ([]Plan, []string, error) {
+	if name != "" {
+		if _, ok := runners[name]; !ok {
+			return nil, nil, fmt.Errorf("no runner named %q in config.yaml", name)
+		}
+	}
+	names := make([]string, 0, len(runners))
+	for n, c := range runners {
+		if err := Check(n, c); err != nil {
+			return nil, nil, err
+		}
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	groups := make(map[string][]*db.Tanda)
+	var skipped []string
+	for _, t := range tandas {
+		picked := name
+		if picked == "" {
+			for _, n := range names {
+				if matches(runners[n].Match, t.File) {
+					picked = n
+					break
+				}
+			}
+		}
+		if picked == "" || (t.File == "" && runsFiles(runners[picked].Command)) {
+			skipped = append(skipped, t.ID)
+			continue
+		}
+		groups[picked] = append(groups[picked], t)
+	}
+
+	var plans []Plan
+	for _, n := range names {
+		if len(groups[n]) == 0 {
+			continue
+		}
+		c := runners[n]
+		timeout := DefaultTimeout
+		if c.Timeout != "" {
+			timeout, _ = time.ParseDuration(c.Timeout)
+		}
+		plans = append(plans, Plan{Runner: n, Config: c, Tandas: groups[n], Args: Expand(c.Command, groups[n]), Timeout: timeout})
+	}
+	return plans, skipped, nil
+}
+
+// matches reports whether a glob matches file or its base name
+func matches(globs []string, file string) bool {
+	if file == "" {
+		return false
+	}
+	file = filepath.ToSlash(file)
+	for _, g := range globs {
+		if ok, _ := filepath.Match(g, file); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(g, filepath.Base(file)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// runsFiles reports whether a command selects tests by file or directory
+func runsFiles(command []string) bool {
+	for _, arg := range command {
+		if arg == filesArg || arg == dirsArg {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand fills a command's placeholders for tandas: {files} and {dirs}
+// become one argument per distinct file or ./dir, and {names} a regular
+// expression matching exactly their titles
+func Expand(command []string, tandas []*db.Tanda) []string {
+	var files, dirs, titles []string
+	seenFile, seenDir := make(map[string]bool), make(map[string]bool)
+	for _, t := range tandas {
+		titles = append(titles, regexp.QuoteMeta(t.Title))
+		if t.File == "" || seenFile[t.File] {
+			continue
+		}
+		seenFile[t.File] = true
+		files = append(files, t.File)
+		dir := filepath.ToSlash(filepath.Dir(t.File))
+		if dir != "." && !strings.HasPrefix(dir, "/") && !strings.HasPrefix(dir, "../") {
+			dir = "./" + dir
+		}
+		if !seenDir[dir] {
+			seenDir[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	names := "^(" + strings.Join(titles, "|") + ")$"
+
+	var args []string
+	for _, arg := range command {
+		switch arg {
+		case filesArg:
+			args = append(args, files...)
+		case dirsArg:
+			args = append(args, dirs...)
+		default:
+			args = append(args, strings.ReplaceAll(arg, namesArg, names))
+		}
+	}
+	return args
+}
+
+// ReportFile is where a junit runner writes its report, relative to root;
+// empty when the report is read from stdout
+func (p Plan) ReportFile(root string) string {
+	if p.Config.Report != JUnit || p.Config.ReportPath == "" {
+		return ""
+	}
+	if filepath.IsAbs(p.Config.ReportPath) {
+		return p.Config.ReportPath
+	}
+	return filepath.Join(root, p.Config.ReportPath)
+}
+
+// Outcome is how a plan's command finished
+type Outcome struct {
+	// Stdout is everything the command printed to stdout
+	Stdout   []byte
+	ExitCode int
+	// Tail is the end of the combined output, kept as the failure of an
+	// exit runner
+	Tail    string
+	Elapsed time.Duration
+}
+
+// Results reads a finished plan's report into runs for its tandas, and
+// returns the names of reported cases none of them matched
+func Results(p Plan, root string, o Outcome, now time.Time) ([]ci.Run, []string, error) {
+	var cases []ci.TestCase
+	var err error
+	switch p.Config.Report {
+	case "", Exit:
+		ts := now.UTC().Format(time.RFC3339)
+		runs := make([]ci.Run, 0, len(p.Tandas))
+		for _, t := range p.Tandas {
+			run := db.RunResult{Timestamp: ts, Result: "pass"}
+			if o.ExitCode != 0 {
+				run.Result = "fail"
+				run.Error = fmt.Sprintf("exit status %d: %s", o.ExitCode, o.Tail)
+			}
+			if len(p.Tandas) == 1 {
+				run.Duration = o.Elapsed.Round(time.Millisecond).String()
+			}
+			runs = append(runs, ci.Run{Tanda: t, Run: run})
+		}
+		return runs, []string{}, nil
+	case GoJSON:
+		cases, err = ci.ParseGoTestJSON(bytes.NewReader(o.Stdout))
+	case JUnit:
+		if path := p.ReportFile(root); path != "" {
+			f, openErr := os.Open(path)
+			if openErr != nil {
+				return nil, nil, fmt.Errorf("failed to read report: %w", openErr)
+			}
+			defer f.Close()
+			cases, err = ci.ParseJUnit(f)
+		} else {
+			cases, err = ci.ParseJUnit(bytes.NewReader(o.Stdout))
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	runs, unmatched := ci.Runs(p.Tandas, cases, now)
+	return runs, unmatched, nil
+}
+
+// Display returns the text to show for one line of a runner's output: go
+// test -json events show as the output they carry, and the rest as is
+func Display(report, line string) (string, bool) {
+	if report != GoJSON || !strings.HasPrefix(line, "{") {
+		return line, true
+	}
+	var e struct {
+		Action string `json:"Action"`
+		Output string `json:"Output"`
+	}
+	if err := json.Unmarshal([]byte(line), &e); err != nil {
+		return line, true
+	}
+	if e.Action != "output" {
+		return "", false
+	}
+	return strings.TrimRight(e.Output, "\n"), true
+}
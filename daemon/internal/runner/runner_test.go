@@ -0,0 +1,125 @@
+package runner_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/runner"
+)
+
+var runners = map[string]config.RunnerConfig{
+	"go":         {Command: []string{"go", "test", "-json", "{dirs}", "-run", "{names}"}, Match: []string{"*_test.go"}, Report: runner.GoJSON},
+	"playwright": {Command: []string{"npx", "playwright", "test", "--reporter=junit", "{files}"}, Match: []string{"*.spec.ts"}, Report: runner.JUnit},
+}
+
+func TestPlans(t *testing.T) {
+	tandas := []*db.Tanda{
+		{ID: "td-1", Title: "TestLogin", File: "auth/login_test.go"},
+		{ID: "td-2", Title: "logs in", File: "tests/login.spec.ts"},
+		{ID: "td-3", Title: "TestLogout", File: "auth/logout_test.go"},
+		{ID: "td-4", Title: "Manual check"},
+		{ID: "td-5", Title: "notes", File: "docs/notes.md"},
+	}
+	plans, skipped, err := runner.Plans(runners, "", tandas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plans) != 2 || plans[0].Runner != "go" || plans[1].Runner != "playwright" {
+		t.Fatalf("unexpected plans %+v", plans)
+	}
+	want := []string{"go", "test", "-json", "./auth", "-run", "^(TestLogin|TestLogout)$"}
+	if !reflect.DeepEqual(plans[0].Args, want) {
+		t.Errorf("got %q, want %q", plans[0].Args, want)
+	}
+	if want := []string{"npx", "playwright", "test", "--reporter=junit", "tests/login.spec.ts"}; !reflect.DeepEqual(plans[1].Args, want) {
+		t.Errorf("got %q, want %q", plans[1].Args, want)
+	}
+	if plans[0].Timeout != runner.DefaultTimeout {
+		t.Errorf("expected the default timeout, got %s", plans[0].Timeout)
+	}
+	if !reflect.DeepEqual(skipped, []string{"td-4", "td-5"}) {
+		t.Errorf("expected td-4 and td-5 skipped, got %v", skipped)
+	}
+
+	// A named runner takes every tanda that has a file
+	plans, skipped, err = runner.Plans(runners, "playwright", tandas)
+	if err != nil || len(plans) != 1 || len(plans[0].Tandas) != 4 || !reflect.DeepEqual(skipped, []string{"td-4"}) {
+		t.Fatalf("unexpected plans %+v, skipped %v, err %v", plans, skipped, err)
+	}
+	if _, _, err := runner.Plans(runners, "jest", tandas); err == nil {
+		t.Error("expected an unknown runner to fail")
+	}
+	bad := map[string]config.RunnerConfig{"x": {Command: []string{"x"}, Report: "tap"}}
+	if _, _, err := runner.Plans(bad, "", tandas); err == nil {
+		t.Error("expected an invalid report to fail")
+	}
+}
+
+func TestResults(t *testing.T) {
+	now := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	login := &db.Tanda{ID: "td-1", Title: "logs in", File: "tests/login.spec.ts"}
+	logout := &db.Tanda{ID: "td-2", Title: "logs out", File: "tests/logout.spec.ts"}
+
+	// Playwright's JUnit reporter names suites after files relative to its
+	// test dir, after whatever else it printed
+	stdout := []byte(`Running 3 tests using 1 worker
+<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="login.spec.ts">
+    <testcase name="logs in" classname="login.spec.ts" time="1.5"/>
+  </testsuite>
+  <testsuite name="logout.spec.ts">
+    <testcase name="logs out" classname="logout.spec.ts" time="0.5">
+      <failure message="timeout waiting for #logout">stack</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="signup.spec.ts">
+    <testcase name="signs up" classname="signup.spec.ts" time="0.1"/>
+  </testsuite>
+</testsuites>`)
+	p := runner.Plan{Runner: "playwright", Config: runners["playwright"], Tandas: []*db.Tanda{login, logout}}
+	runs, unmatched, err := runner.Results(p, t.TempDir(), runner.Outcome{Stdout: stdout, ExitCode: 1}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].Run.Result != "pass" || runs[0].Run.Duration != "1.5s" {
+		t.Fatalf("unexpected runs %+v", runs)
+	}
+	if runs[1].Run.Result != "fail" || runs[1].Run.Error != "timeout waiting for #logout" {
+		t.Fatalf("expected logout to fail with its message, got %+v", runs[1].Run)
+	}
+	if !reflect.DeepEqual(unmatched, []string{"signs up"}) {
+		t.Errorf("expected the unselected case unmatched, got %v", unmatched)
+	}
+
+	// An exit runner fails every tanda with the output's tail
+	p = runner.Plan{Runner: "make", Config: config.RunnerConfig{Command: []string{"make", "e2e"}}, Tandas: []*db.Tanda{login}}
+	runs, _, err = runner.Results(p, t.TempDir(), runner.Outcome{ExitCode: 2, Tail: "make: *** [e2e] Error 2", Elapsed: 3 * time.Second}, now)
+	if err != nil || len(runs) != 1 || runs[0].Run.Result != "fail" || runs[0].Run.Duration != "3s" {
+		t.Fatalf("unexpected runs %+v, err %v", runs, err)
+	}
+	if runs[0].Run.Error != "exit status 2: make: *** [e2e] Error 2" {
+		t.Errorf("unexpected error %q", runs[0].Run.Error)
+	}
+
+	// A missing report file is an error, not a pass
+	p = runner.Plan{Config: config.RunnerConfig{Command: []string{"pytest"}, Report: runner.JUnit, ReportPath: "test-results/pytest.xml"}, Tandas: []*db.Tanda{login}}
+	if _, _, err := runner.Results(p, t.TempDir(), runner.Outcome{}, now); err == nil {
+		t.Error("expected a missing report to fail")
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	if line, ok := runner.Display(runner.GoJSON, `{"Action":"output","Test":"TestLogin","Output":"--- PASS: TestLogin (0.01s)\n"}`); !ok || line != "--- PASS: TestLogin (0.01s)" {
+		t.Errorf("got %q %v", line, ok)
+	}
+	if _, ok := runner.Display(runner.GoJSON, `{"Action":"run","Test":"TestLogin"}`); ok {
+		t.Error("expected a run event to be hidden")
+	}
+	if line, ok := runner.Display(runner.JUnit, "Running 3 tests"); !ok || line != "Running 3 tests" {
+		t.Errorf("got %q %v", line, ok)
+	}
+}
@@ -0,0 +1,80 @@
+// Package scaffold lays out the Tandas directory for a new project
+package scaffold
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/journal"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+// RegistryFile is the registry committed with the project
+const RegistryFile = "issues.jsonl"
+
+// Ignored are the files in the Tandas directory that belong to one
+// checkout: the SQLite cache, the daemon's socket, PID and lock files,
+// crash reports, and local state
+var Ignored = []string{
+	"db.sqlite", "db.sqlite-wal", "db.sqlite-shm",
+	"td.sock", "daemon.pid", "daemon.lock", "daemon.token", "crashes/",
+	journal.FileName, sync.ReplicaFile, sync.OversizedFileName,
+}
+
+// Init creates dir with an empty registry, a commented config.yaml and a
+// .gitignore covering Ignored. Existing files are left alone, so Init is
+// safe to rerun; the names of the files it created are returned.
+func Init(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	var created []string
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{RegistryFile, nil},
+		{config.FileName, config.Template()},
+	}
+	for _, f := range files {
+		ok, err := create(filepath.Join(dir, f.name), f.data)
+		if err != nil {
+			return created, err
+		}
+		if ok {
+			created = append(created, f.name)
+		}
+	}
+
+	_, err := os.Stat(filepath.Join(dir, ".gitignore"))
+	fresh := os.IsNotExist(err)
+	for _, entry := range Ignored {
+		if err := sync.IgnoreEntry(dir, entry); err != nil {
+			return created, err
+		}
+	}
+	if fresh {
+		created = append(created, ".gitignore")
+	}
+	return created, nil
+}
+
+// create writes data to path unless it exists, reporting whether it did
+func create(path string, data []byte) (bool, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return true, f.Close()
+}
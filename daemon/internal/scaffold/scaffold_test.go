@@ -0,0 +1,51 @@
+package scaffold_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/scaffold"
+)
+
+func TestInit(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), ".tandas")
+
+	created, err := scaffold.Init(dir)
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	want := []string{scaffold.RegistryFile, config.FileName, ".gitignore"}
+	if !reflect.DeepEqual(created, want) {
+		t.Fatalf("created %v, want %v", created, want)
+	}
+	if info, err := os.Stat(filepath.Join(dir, scaffold.RegistryFile)); err != nil || info.Size() != 0 {
+		t.Errorf("expected an empty registry, got %v %v", info, err)
+	}
+	ignore, _ := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	for _, entry := range []string{"db.sqlite", "td.sock", "daemon.pid"} {
+		if !strings.Contains(string(ignore), entry+"\n") {
+			t.Errorf("expected %s ignored, got %q", entry, ignore)
+		}
+	}
+
+	// A rerun keeps edits
+	registry := filepath.Join(dir, scaffold.RegistryFile)
+	os.WriteFile(registry, []byte(`{"id":"td-1","title":"Login"}`+"\n"), 0o644)
+	created, err = scaffold.Init(dir)
+	if err != nil {
+		t.Fatalf("rerun: %v", err)
+	}
+	if len(created) != 0 {
+		t.Errorf("expected nothing created on rerun, got %v", created)
+	}
+	if data, _ := os.ReadFile(registry); !strings.Contains(string(data), "td-1") {
+		t.Error("rerun overwrote the registry")
+	}
+	if again, _ := os.ReadFile(filepath.Join(dir, ".gitignore")); string(again) != string(ignore) {
+		t.Errorf("rerun changed .gitignore: %q", again)
+	}
+}
@@ -0,0 +1,198 @@
+package schema
+
+import (
+	"encoding"
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Generator derives JSON Schemas from Go types the way encoding/json
+// encodes them, for messages without a hand-written schema. Named structs
+// are defined once under $defs, as package.Type, and referenced from
+// there. No property is required, since the daemon accepts messages with
+// any of them left out.
+type Generator struct {
+	defs map[string]interface{}
+	refs map[reflect.Type]string
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+	rawType       = reflect.TypeOf(json.RawMessage(nil))
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textType      = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// NewGenerator returns a generator with no definitions
+func NewGenerator() *Generator {
+	return &Generator{defs: make(map[string]interface{}), refs: make(map[reflect.Type]string)}
+}
+
+// Ref makes v's type refer to the schema at uri instead of being derived,
+// as for a type with a hand-written schema
+func (g *Generator) Ref(v interface{}, uri string) {
+	g.refs[reflect.TypeOf(v)] = uri
+}
+
+// Schema returns the schema of v's type, defining the named structs it
+// uses. A nil v allows any value.
+func (g *Generator) Schema(v interface{}) map[string]interface{} {
+	if v == nil {
+		return map[string]interface{}{}
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return g.of(t)
+}
+
+// Defs returns the struct definitions made so far, keyed as $defs
+func (g *Generator) Defs() map[string]interface{} {
+	return g.defs
+}
+
+// DefName is the $defs key of a named type: its package's name and its own
+func DefName(t reflect.Type) string {
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+func (g *Generator) of(t reflect.Type) map[string]interface{} {
+	if uri, ok := g.refs[t]; ok {
+		return map[string]interface{}{"$ref": uri}
+	}
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "description": "Nanoseconds"}
+	case rawType:
+		return map[string]interface{}{}
+	}
+	// Types that encode themselves are only known to be JSON
+	if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+		return map[string]interface{}{}
+	}
+	if t.Implements(textType) || reflect.PointerTo(t).Implements(textType) {
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Pointer:
+		// Only fields are written as null; see fields
+		return g.of(t.Elem())
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": []string{"string", "null"}, "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": g.of(t.Elem())}
+	case reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.of(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		return map[string]interface{}{"type": []string{"object", "null"}, "additionalProperties": g.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := DefName(t)
+		if _, ok := g.defs[name]; !ok {
+			// Set first so recursive types refer back rather than recurse
+			g.defs[name] = map[string]interface{}{}
+			g.defs[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	}
+	// Interfaces hold any value; channels and funcs are never encoded
+	return map[string]interface{}{}
+}
+
+// nullable lets s also be null
+func nullable(s map[string]interface{}) map[string]interface{} {
+	switch typ := s["type"].(type) {
+	case string:
+		s["type"] = []string{typ, "null"}
+		return s
+	case []string:
+		return s
+	}
+	if len(s) == 0 {
+		return s
+	}
+	return map[string]interface{}{"anyOf": []interface{}{s, map[string]interface{}{"type": "null"}}}
+}
+
+// object is the schema of a struct's encoded fields
+func (g *Generator) object(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	depths := make(map[string]int)
+	g.fields(t, 0, props, depths)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+// fields adds t's encoded fields to props, promoting those of embedded
+// structs as encoding/json does: the shallowest field of a name wins
+func (g *Generator) fields(t reflect.Type, depth int, props map[string]interface{}, depths map[string]int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, depth+1, props, depths)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if d, ok := depths[name]; ok && d <= depth {
+			continue
+		}
+		depths[name] = depth
+
+		var s map[string]interface{}
+		switch {
+		case strings.Contains(opts, "string") && isScalar(ft):
+			s = map[string]interface{}{"type": "string"}
+		case ft.Kind() == reflect.Pointer && !strings.Contains(opts, "omitempty"):
+			s = nullable(g.of(ft.Elem()))
+		default:
+			s = g.of(ft)
+		}
+		props[name] = s
+	}
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+// Package schema publishes the JSON Schema of a tanda document and checks
+// documents against it
+package schema
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Version is bumped whenever the tanda document changes incompatibly
+const Version = 1
+
+//go:embed tanda.schema.json
+var tandaSchema []byte
+
+// JSON returns the tanda JSON Schema
+func JSON() []byte {
+	return tandaSchema
+}
+
+// Problem is one place a document departs from the schema. Path is a JSON
+// Pointer to the offending value.
+type Problem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (p Problem) Error() string {
+	path := p.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("%s: %s", path, p.Message)
+}
+
+// node is the subset of JSON Schema the tanda schema uses
+type node struct {
+	Ref                  string           `json:"$ref"`
+	Type                 types            `json:"type"`
+	Required             []string         `json:"required"`
+	Properties           map[string]*node `json:"properties"`
+	AdditionalProperties json.RawMessage  `json:"additionalProperties"`
+	Items                *node            `json:"items"`
+	Enum                 []interface{}    `json:"enum"`
+	MinLength            *int             `json:"minLength"`
+	Minimum              *float64         `json:"minimum"`
+	Defs                 map[string]*node `json:"$defs"`
+}
+
+var root = func() *node {
+	var n node
+	if err := json.Unmarshal(tandaSchema, &n); err != nil {
+		panic(fmt.Sprintf("schema: invalid embedded schema: %v", err))
+	}
+	return &n
+}()
+
+// Validate checks one JSON document against the tanda schema
+func Validate(doc []byte) []Problem {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return []Problem{{Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	var problems []Problem
+	check(root, v, "", &problems)
+	return problems
+}
+
+func check(n *node, v interface{}, path string, problems *[]Problem) {
+	if n.Ref != "" {
+		n = resolve(n.Ref)
+	}
+	fail := func(format string, args ...interface{}) {
+		*problems = append(*problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(n.Enum) > 0 && !inEnum(n.Enum, v) {
+		fail("must be one of %s", enumList(n.Enum))
+		return
+	}
+	if len(n.Type) > 0 && !n.Type.allow(typeOf(v)) {
+		fail("must be %s, not %s", strings.Join(n.Type, " or "), typeOf(v))
+		return
+	}
+
+	switch v := v.(type) {
+	case string:
+		if n.MinLength != nil && len([]rune(v)) < *n.MinLength {
+			fail("must not be empty")
+		}
+	case json.Number:
+		if f, err := v.Float64(); err == nil && n.Minimum != nil && f < *n.Minimum {
+			fail("must be at least %v", *n.Minimum)
+		}
+	case []interface{}:
+		if n.Items != nil {
+			for i, item := range v {
+				check(n.Items, item, fmt.Sprintf("%s/%d", path, i), problems)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range n.Required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "/" + escape(k)
+			if prop, ok := n.Properties[k]; ok {
+				check(prop, v[k], child, problems)
+				continue
+			}
+			switch extra := strings.TrimSpace(string(n.AdditionalProperties)); {
+			case extra == "false":
+				*problems = append(*problems, Problem{Path: child, Message: "unknown property"})
+			case strings.HasPrefix(extra, "{"):
+				var sub node
+				if err := json.Unmarshal(n.AdditionalProperties, &sub); err == nil {
+					check(&sub, v[k], child, problems)
+				}
+			}
+		}
+	}
+}
+
+// types is a schema type: one name or a list of names
+type types []string
+
+func (t *types) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = types{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+func (t types) allow(name string) bool {
+	for _, want := range t {
+		if want == name || (want == "number" && name == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve follows a local reference such as #/$defs/note
+func resolve(ref string) *node {
+	name := strings.TrimPrefix(ref, "#/$defs/")
+	if n, ok := root.Defs[name]; ok {
+		return n
+	}
+	panic(fmt.Sprintf("schema: unresolved reference %q", ref))
+}
+
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// inEnum reports whether v is one of enum; the schema only enumerates
+// strings
+func inEnum(enum []interface{}, v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	for _, e := range enum {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []interface{}) string {
+	names := make([]string, len(enum))
+	for i, e := range enum {
+		names[i] = fmt.Sprint(e)
+	}
+	return strings.Join(names, ", ")
+}
+
+// escape encodes a property name for a JSON Pointer
+func escape(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
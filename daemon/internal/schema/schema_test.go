@@ -0,0 +1,150 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/rpc"
+	"github.com/tandas/daemon/internal/schema"
+)
+
+func TestValidate(t *testing.T) {
+	// Everything the daemon itself writes conforms
+	written, _ := json.Marshal(&db.Tanda{
+		ID: "td-1", Title: "Login", Status: "flaky", Priority: "p1", Triage: "acknowledged",
+		Notes:      []db.Note{{Timestamp: "2025-06-01T10:00:00Z", Type: "note", Text: "hi"}},
+		RunHistory: []db.RunResult{{Timestamp: "2025-06-01T10:00:00Z", Result: "fail", Error: "timeout"}},
+		Clock:      &db.Clock{Vector: map[string]uint64{"a1": 2}, Fields: map[string]db.Stamp{"title": {Timestamp: "2025-06-01T10:00:00Z", Replica: "a1"}}},
+	})
+	if problems := schema.Validate(written); len(problems) != 0 {
+		t.Fatalf("expected a daemon-written tanda to conform, got %v", problems)
+	}
+
+	doc := `{"id":"","covers":"auth","run_history":[{"ts":"2025-06-01T10:00:00Z","result":"passed"}],"clock":{"vector":{"a1":-1}},"severity":1,"triage":"done"}`
+	want := []string{
+		"/: missing required property \"title\"",
+		"/clock/vector/a1: must be at least 0",
+		"/covers: must be array or null, not string",
+		"/id: must not be empty",
+		"/run_history/0/result: must be one of pass, fail, skip",
+		"/severity: unknown property",
+		"/triage: must be one of untriaged, acknowledged, fixing, wontfix",
+	}
+	problems := schema.Validate([]byte(doc))
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %v", len(want), problems)
+	}
+	for i, w := range want {
+		if problems[i].Error() != w {
+			t.Errorf("problem %d = %q, want %q", i, problems[i].Error(), w)
+		}
+	}
+
+	if problems := schema.Validate([]byte("not json")); len(problems) != 1 || !strings.Contains(problems[0].Message, "invalid JSON") {
+		t.Errorf("expected an invalid JSON problem, got %v", problems)
+	}
+	if !json.Valid(schema.JSON()) {
+		t.Error("embedded schema is not valid JSON")
+	}
+}
+
+type node struct {
+	Name     string  `json:"name"`
+	Children []*node `json:"children,omitempty"`
+	Parent   *node   `json:"parent"`
+}
+
+type page struct {
+	db.Filter
+	// Status shadows the embedded filter's
+	Status  int             `json:"status"`
+	Items   []node          `json:"items"`
+	Counts  map[string]uint `json:"counts"`
+	At      time.Time       `json:"at"`
+	Raw     json.RawMessage `json:"raw,omitempty"`
+	Tanda   *db.Tanda       `json:"tanda,omitempty"`
+	Skipped string          `json:"-"`
+	Size    int64           `json:"size,string"`
+	hidden  bool
+}
+
+func TestGenerator(t *testing.T) {
+	g := schema.NewGenerator()
+	g.Ref(db.Tanda{}, "tanda.schema.json")
+	got, _ := json.Marshal(g.Schema(&page{}))
+	if string(got) != `{"$ref":"#/$defs/schema_test.page"}` {
+		t.Fatalf("schema = %s", got)
+	}
+
+	defs, _ := json.Marshal(g.Defs())
+	var decoded map[string]map[string]map[string]interface{}
+	json.Unmarshal(defs, &decoded)
+	props := decoded["schema_test.page"]["properties"]
+	want := map[string]string{
+		"owner":       `{"type":"string"}`,
+		"status":      `{"type":"integer"}`,
+		"items":       `{"items":{"$ref":"#/$defs/schema_test.node"},"type":["array","null"]}`,
+		"counts":      `{"additionalProperties":{"minimum":0,"type":"integer"},"type":["object","null"]}`,
+		"at":          `{"format":"date-time","type":"string"}`,
+		"raw":         `{}`,
+		"tanda":       `{"$ref":"tanda.schema.json"}`,
+		"size":        `{"type":"string"}`,
+		"slower_than": `{"description":"Nanoseconds","type":"integer"}`,
+	}
+	for name, w := range want {
+		if got, _ := json.Marshal(props[name]); string(got) != w {
+			t.Errorf("%s = %s, want %s", name, got, w)
+		}
+	}
+	for _, name := range []string{"Skipped", "hidden", "Filter"} {
+		if _, ok := props[name]; ok {
+			t.Errorf("%s should not be a property", name)
+		}
+	}
+
+	// Recursive types refer back to their definition
+	nodeProps, _ := json.Marshal(decoded["schema_test.node"]["properties"])
+	if w := `{"children":{"items":{"$ref":"#/$defs/schema_test.node"},"type":["array","null"]},"name":{"type":"string"},"parent":{"anyOf":[{"$ref":"#/$defs/schema_test.node"},{"type":"null"}]}}`; string(nodeProps) != w {
+		t.Errorf("node = %s, want %s", nodeProps, w)
+	}
+	if name := schema.DefName(reflect.TypeOf(db.Filter{})); name != "db.Filter" {
+		t.Errorf("DefName = %s", name)
+	}
+}
+
+func TestRPCSchema(t *testing.T) {
+	for _, m := range rpc.Methods {
+		if _, ok := rpc.Messages[m]; !ok {
+			t.Errorf("method %s has no message shapes", m)
+		}
+	}
+	doc, err := rpc.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		Defs map[string]json.RawMessage `json:"$defs"`
+	}
+	if err := json.Unmarshal(doc, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []string{"Request", "Response", "Error", "query.params", "record_run.result"} {
+		if _, ok := parsed.Defs[m]; !ok {
+			t.Errorf("missing definition %s", m)
+		}
+	}
+	for _, ref := range regexp.MustCompile(`"\$ref": "([^"]+)"`).FindAllStringSubmatch(string(doc), -1) {
+		name, local := strings.CutPrefix(ref[1], "#/$defs/")
+		if !local && ref[1] != rpc.TandaSchemaFile {
+			t.Errorf("unexpected reference %s", ref[1])
+		}
+		if _, ok := parsed.Defs[name]; local && !ok {
+			t.Errorf("reference to undefined %s", ref[1])
+		}
+	}
+}
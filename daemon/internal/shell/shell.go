@@ -0,0 +1,11 @@
+// Package shell quotes values for the POSIX shell scripts and remote
+// commands td-daemon writes
+package shell
+
+import "strings"
+
+// Quote single-quotes s so a POSIX shell reads it as one word, taking $,
+// backquotes and backslashes literally
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,20 @@
+package shell_test
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/tandas/daemon/internal/shell"
+)
+
+func TestQuote(t *testing.T) {
+	for _, s := range []string{"", "plain", "two words", "it's", `$HOME $(id) "x" \n`, "'''", "a\nb"} {
+		out, err := exec.Command("sh", "-c", "printf %s "+shell.Quote(s)).Output()
+		if err != nil {
+			t.Fatalf("sh: %v", err)
+		}
+		if string(out) != s {
+			t.Errorf("Quote(%q) read back as %q", s, out)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package slo
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/events"
+	"github.com/tandas/daemon/internal/trend"
+)
+
+// Metrics an objective can bound
+const (
+	// PassRate is the share of passing runs in the window
+	PassRate = "pass_rate"
+	// FlakyCount is the number of currently quarantined tandas
+	FlakyCount = "flaky_count"
+	// FailureCount is the number of failed runs in the window
+	FailureCount = "failure_count"
+)
+
+// Status is the latest evaluation of one objective. Known is false when
+// the metric has no data, e.g. no runs in the window.
+type Status struct {
+	Name      string     `json:"name"`
+	Metric    string     `json:"metric"`
+	Window    string     `json:"window,omitempty"`
+	Min       *float64   `json:"min,omitempty"`
+	Max       *float64   `json:"max,omitempty"`
+	Value     float64    `json:"value"`
+	Known     bool       `json:"known"`
+	Breached  bool       `json:"breached"`
+	Evaluated time.Time  `json:"evaluated"`
+	Since     *time.Time `json:"breached_since,omitempty"`
+}
+
+type objective struct {
+	config.SLOConfig
+	window time.Duration
+}
+
+// Tracker evaluates objectives and reports breaches and recoveries
+type Tracker struct {
+	objectives []objective
+
+	mu     sync.Mutex
+	seeded bool
+	status []Status
+}
+
+// New validates the configured objectives
+func New(cfgs []config.SLOConfig) (*Tracker, error) {
+	t := &Tracker{}
+	names := make(map[string]bool)
+	for _, c := range cfgs {
+		if c.Name == "" {
+			c.Name = c.Metric
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("slo: duplicate name %q", c.Name)
+		}
+		names[c.Name] = true
+
+		switch c.Metric {
+		case PassRate, FlakyCount, FailureCount:
+		default:
+			return nil, fmt.Errorf("slo %s: unknown metric %q", c.Name, c.Metric)
+		}
+		if c.Min == nil && c.Max == nil {
+			return nil, fmt.Errorf("slo %s: min or max is required", c.Name)
+		}
+
+		o := objective{SLOConfig: c}
+		if c.Window != "" {
+			w, err := trend.ParseWindow(c.Window)
+			if err != nil {
+				return nil, fmt.Errorf("slo %s: %w", c.Name, err)
+			}
+			o.window = w
+		}
+		t.objectives = append(t.objectives, o)
+	}
+	return t, nil
+}
+
+// Observe evaluates every objective and returns events for objectives that
+// started or stopped breaching since the previous call. The first call only
+// records the current state, like events.Detector.
+func (t *Tracker) Observe(tandas []*db.Tanda, now time.Time) []events.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var out []events.Event
+	next := make([]Status, len(t.objectives))
+	for i, o := range t.objectives {
+		st := evaluate(o, tandas, now)
+		var prev Status
+		if i < len(t.status) {
+			prev = t.status[i]
+		}
+
+		switch {
+		case st.Breached && prev.Breached:
+			st.Since = prev.Since
+		case st.Breached:
+			since := now
+			st.Since = &since
+			if t.seeded {
+				out = append(out, event(events.SLOBreached, st))
+			}
+		case prev.Breached && st.Known:
+			out = append(out, event(events.SLORecovered, st))
+		case prev.Breached:
+			// No data is not a recovery
+			st.Breached, st.Since = true, prev.Since
+		}
+		next[i] = st
+	}
+
+	t.status = next
+	t.seeded = true
+	return out
+}
+
+// Status returns the latest evaluation of every objective
+func (t *Tracker) Status() []Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Status, len(t.status))
+	copy(out, t.status)
+	return out
+}
+
+func evaluate(o objective, tandas []*db.Tanda, now time.Time) Status {
+	st := Status{Name: o.Name, Metric: o.Metric, Window: o.Window, Min: o.Min, Max: o.Max, Evaluated: now}
+
+	var passed, failed int
+	for _, t := range tandas {
+		if o.Metric == FlakyCount {
+			if db.IsQuarantined(t.Status) {
+				st.Value++
+			}
+			continue
+		}
+		for _, run := range t.RunHistory {
+			if o.window > 0 {
+				ts, ok := db.ParseTimestamp(run.Timestamp)
+				if !ok || ts.Before(now.Add(-o.window)) {
+					continue
+				}
+			}
+			switch run.Result {
+			case "pass":
+				passed++
+			case "fail":
+				failed++
+			}
+		}
+	}
+
+	switch o.Metric {
+	case FlakyCount:
+		st.Known = true
+	case FailureCount:
+		st.Value, st.Known = float64(failed), true
+	case PassRate:
+		if passed+failed > 0 {
+			st.Value, st.Known = float64(passed)/float64(passed+failed), true
+		}
+	}
+
+	if st.Known {
+		st.Breached = (o.Min != nil && st.Value < *o.Min) || (o.Max != nil && st.Value > *o.Max)
+	}
+	return st
+}
+
+func event(typ string, st Status) events.Event {
+	data := map[string]interface{}{
+		"name":   st.Name,
+		"metric": st.Metric,
+		"value":  st.Value,
+	}
+	if st.Window != "" {
+		data["window"] = st.Window
+	}
+	if st.Min != nil {
+		data["min"] = *st.Min
+	}
+	if st.Max != nil {
+		data["max"] = *st.Max
+	}
+	return events.Event{Type: typ, Data: data}
+}
@@ -0,0 +1,69 @@
+package slo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/events"
+	"github.com/tandas/daemon/internal/slo"
+)
+
+func float(v float64) *float64 { return &v }
+
+func TestTrackerBreachAndRecovery(t *testing.T) {
+	tracker, err := slo.New([]config.SLOConfig{
+		{Name: "suite", Metric: slo.PassRate, Min: float(0.9), Window: "7d"},
+		{Metric: slo.FlakyCount, Max: float(1)},
+	})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.Local)
+	tandas := []*db.Tanda{
+		{ID: "td-1", Status: "active", RunHistory: []db.RunResult{
+			{Timestamp: "2025-05-01T10:00:00", Result: "fail"}, // outside the window
+			{Timestamp: "2025-06-09T10:00:00", Result: "pass"},
+		}},
+		{ID: "td-2", Status: "flaky", RunHistory: []db.RunResult{{Timestamp: "2025-06-09T11:00:00", Result: "pass"}}},
+	}
+	if evs := tracker.Observe(tandas, now); len(evs) != 0 {
+		t.Fatalf("expected first observation to only seed, got %+v", evs)
+	}
+	if st := tracker.Status(); len(st) != 2 || st[0].Value != 1 || st[0].Breached || st[1].Name != slo.FlakyCount {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	tandas[0].RunHistory = append(tandas[0].RunHistory, db.RunResult{Timestamp: "2025-06-10T10:00:00", Result: "fail"})
+	tandas[0].Status = "flaky"
+	evs := tracker.Observe(tandas, now)
+	if len(evs) != 2 || evs[0].Type != events.SLOBreached || evs[0].Data["name"] != "suite" || evs[1].Data["name"] != slo.FlakyCount {
+		t.Fatalf("expected both objectives to breach, got %+v", evs)
+	}
+	if evs := tracker.Observe(tandas, now); len(evs) != 0 {
+		t.Fatalf("expected no repeat events while breached, got %+v", evs)
+	}
+
+	tandas[0].Status = "active"
+	evs = tracker.Observe(tandas, now)
+	if len(evs) != 1 || evs[0].Type != events.SLORecovered || evs[0].Data["name"] != slo.FlakyCount {
+		t.Fatalf("expected flaky_count to recover, got %+v", evs)
+	}
+	if st := tracker.Status(); !st[0].Breached || st[0].Since == nil {
+		t.Fatalf("expected suite to remain breached, got %+v", st[0])
+	}
+}
+
+func TestNewRejectsInvalidObjectives(t *testing.T) {
+	for _, cfg := range []config.SLOConfig{
+		{Metric: "uptime", Min: float(1)},
+		{Metric: slo.PassRate},
+		{Metric: slo.PassRate, Min: float(0.9), Window: "soon"},
+	} {
+		if _, err := slo.New([]config.SLOConfig{cfg}); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
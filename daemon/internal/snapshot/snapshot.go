@@ -0,0 +1,402 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/sync"
+)
+
+// Dir holds snapshots inside the .tandas dir
+const Dir = "snapshots"
+
+// ManifestName is the first entry of every snapshot archive
+const ManifestName = "manifest.json"
+
+const (
+	jsonlFile = "issues.jsonl"
+	dbFile    = "db.sqlite"
+	inboxFile = "trace_inbox.jsonl"
+)
+
+// Files lists the state captured by a snapshot, relative to the .tandas dir
+var Files = []string{jsonlFile, dbFile, inboxFile, config.FileName}
+
+// ErrNotFound is returned when no snapshot has the requested name
+var ErrNotFound = errors.New("snapshot not found")
+
+// Manifest describes a snapshot archive
+type Manifest struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Note      string    `json:"note,omitempty"`
+	Files     []File    `json:"files"`
+}
+
+// File is one captured file with its checksum
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Path returns the archive path for a snapshot name
+func Path(dir, name string) string {
+	return filepath.Join(dir, Dir, name+".tar.gz")
+}
+
+// Create bundles the current state of dir into a new snapshot. An empty
+// name defaults to the creation time.
+func Create(dir, name, note string, now time.Time) (*Manifest, error) {
+	if name == "" {
+		name = now.Format("20060102-150405")
+	}
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	path := Path(dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("snapshot %q already exists", name)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, Dir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+	if err := sync.IgnoreEntry(dir, Dir+"/"); err != nil {
+		return nil, err
+	}
+
+	staging, err := os.MkdirTemp(filepath.Join(dir, Dir), ".staging-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging dir: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	m := &Manifest{Name: name, CreatedAt: now.UTC(), Note: note}
+	sources := map[string]string{}
+	for _, f := range Files {
+		src := filepath.Join(dir, f)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", f, err)
+		}
+		if f == dbFile {
+			// Copying the file directly would miss pages still in the WAL
+			copyPath := filepath.Join(staging, dbFile)
+			if err := backupDB(src, copyPath); err != nil {
+				return nil, err
+			}
+			src = copyPath
+		}
+		entry, err := describe(f, src)
+		if err != nil {
+			return nil, err
+		}
+		m.Files = append(m.Files, entry)
+		sources[f] = src
+	}
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("nothing to snapshot in %s", dir)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(dir, Dir), ".snapshot-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := writeArchive(tmp, m, sources); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return m, nil
+}
+
+// List returns the manifests of all snapshots, oldest first
+func List(dir string) ([]*Manifest, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, Dir, "*.tar.gz"))
+	if err != nil {
+		return nil, err
+	}
+	var out []*Manifest
+	for _, path := range matches {
+		m, err := readManifest(path)
+		if err != nil {
+			slog.Warn("Skipping snapshot", "manifest", filepath.Base(path), "err", err)
+			continue
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+// Restore replaces the state in dir with the named snapshot. Every file is
+// checked against the manifest before anything is written. Captured files
+// missing from the snapshot did not exist when it was taken and are
+// removed. The daemon must not be running.
+func Restore(dir, name string) (*Manifest, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	path := Path(dir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	staging, err := os.MkdirTemp(filepath.Join(dir, Dir), ".restore-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging dir: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	m, err := extract(path, staging)
+	if err != nil {
+		return nil, err
+	}
+	restored := map[string]bool{}
+	for _, f := range m.Files {
+		got, err := describe(f.Path, filepath.Join(staging, f.Path))
+		if err != nil {
+			return nil, err
+		}
+		if got.SHA256 != f.SHA256 || got.Size != f.Size {
+			return nil, fmt.Errorf("snapshot %s is corrupt: %s does not match its checksum", name, f.Path)
+		}
+		restored[f.Path] = true
+	}
+
+	for _, f := range m.Files {
+		if err := os.Rename(filepath.Join(staging, f.Path), filepath.Join(dir, f.Path)); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", f.Path, err)
+		}
+		if f.Path == dbFile {
+			// A stale WAL would be replayed over the restored database
+			os.Remove(filepath.Join(dir, dbFile+"-wal"))
+			os.Remove(filepath.Join(dir, dbFile+"-shm"))
+		}
+	}
+	for _, f := range Files {
+		if restored[f] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f)); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove %s: %w", f, err)
+		}
+	}
+	return m, nil
+}
+
+// OpenDB opens the database in dir. A database from an older binary is
+// snapshotted before it is migrated, and the snapshot is returned; a
+// database from a newer one is refused with a *db.SchemaTooNewError.
+func OpenDB(dir string, now time.Time) (*db.Store, *Manifest, error) {
+	path := filepath.Join(dir, dbFile)
+	version, exists, err := db.Version(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version > db.SchemaVersion {
+		return nil, nil, &db.SchemaTooNewError{Path: path, Version: version}
+	}
+
+	var m *Manifest
+	if exists && version < db.SchemaVersion {
+		name := fmt.Sprintf("pre-migrate-v%d-%s", version, now.Format("20060102-150405"))
+		note := fmt.Sprintf("before migrating the database from schema v%d to v%d", version, db.SchemaVersion)
+		if m, err = Create(dir, name, note, now); err != nil {
+			return nil, nil, fmt.Errorf("failed to snapshot before migrating: %w", err)
+		}
+		slog.Info("Migrating database", "from", version, "to", db.SchemaVersion, "snapshot", name)
+	}
+
+	store, err := db.Open(path)
+	if err != nil {
+		if m != nil {
+			return nil, nil, fmt.Errorf("%w; to roll back, run td-daemon snapshot restore %s", err, m.Name)
+		}
+		return nil, nil, err
+	}
+	return store, m, nil
+}
+
+func validName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid snapshot name %q", name)
+	}
+	return nil
+}
+
+// backupDB copies the database as it is, so a snapshot taken before a
+// migration keeps the old schema
+func backupDB(src, dst string) error {
+	if err := db.Copy(src, dst); err != nil {
+		return fmt.Errorf("failed to copy database: %w", err)
+	}
+	return nil
+}
+
+func describe(name, path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return File{Path: name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func writeArchive(w io.Writer, m *Manifest, sources map[string]string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(data)), ModTime: m.CreatedAt}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	for _, f := range m.Files {
+		if err := addFile(tw, f, sources[f.Path], m.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return gz.Close()
+}
+
+func addFile(tw *tar.Writer, f File, src string, modTime time.Time) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", f.Path, err)
+	}
+	defer in.Close()
+	hdr := &tar.Header{Name: f.Path, Mode: 0644, Size: f.Size, ModTime: modTime}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to add %s: %w", f.Path, err)
+	}
+	if _, err := io.CopyN(tw, in, f.Size); err != nil {
+		return fmt.Errorf("failed to add %s: %w", f.Path, err)
+	}
+	return nil
+}
+
+func readManifest(path string) (*Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Name != ManifestName {
+		return nil, fmt.Errorf("missing %s", ManifestName)
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// extract unpacks the files named in the manifest into dst
+func extract(path, dst string) (*Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	var m *Manifest
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if hdr.Name == ManifestName {
+			m = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(m); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			continue
+		}
+		if !captured(hdr.Name) {
+			return nil, fmt.Errorf("unexpected file %q in snapshot", hdr.Name)
+		}
+		out, err := os.Create(filepath.Join(dst, hdr.Name))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return nil, fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+		}
+		if err := out.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if m == nil {
+		return nil, fmt.Errorf("missing %s", ManifestName)
+	}
+	for _, f := range m.Files {
+		if !captured(f.Path) {
+			return nil, fmt.Errorf("unexpected file %q in manifest", f.Path)
+		}
+	}
+	return m, nil
+}
+
+func captured(name string) bool {
+	for _, f := range Files {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
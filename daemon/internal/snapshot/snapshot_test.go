@@ -0,0 +1,112 @@
+package snapshot_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/snapshot"
+)
+
+func TestCreateAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	jsonl := filepath.Join(dir, "issues.jsonl")
+	inbox := filepath.Join(dir, "trace_inbox.jsonl")
+	os.WriteFile(jsonl, []byte(`{"id":"td-1","title":"Login"}`+"\n"), 0644)
+
+	store, err := db.Open(filepath.Join(dir, "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpsertTanda(&db.Tanda{ID: "td-1", Title: "Login"}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	now := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	m, err := snapshot.Create(dir, "", "before migration", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "20250601-100000" || len(m.Files) != 2 {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+
+	// Botch the registry and add an inbox that did not exist before
+	os.WriteFile(jsonl, []byte("garbage\n"), 0644)
+	os.WriteFile(inbox, []byte("{}\n"), 0644)
+
+	if _, err := snapshot.Restore(dir, m.Name); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(jsonl)
+	if string(data) != `{"id":"td-1","title":"Login"}`+"\n" {
+		t.Fatalf("registry not restored: %q", data)
+	}
+	if _, err := os.Stat(inbox); !os.IsNotExist(err) {
+		t.Fatal("expected the trace inbox to be removed")
+	}
+	store, err = db.Open(filepath.Join(dir, "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if got, err := store.GetTanda("td-1"); err != nil || got.Title != "Login" {
+		t.Fatalf("database not restored: %v %v", got, err)
+	}
+
+	list, err := snapshot.List(dir)
+	if err != nil || len(list) != 1 || list[0].Note != "before migration" {
+		t.Fatalf("unexpected list %+v %v", list, err)
+	}
+	if _, err := snapshot.Restore(dir, "missing"); !errors.Is(err, snapshot.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := snapshot.Create(dir, "../escape", "", now); err == nil {
+		t.Fatal("expected invalid name to be rejected")
+	}
+}
+
+func TestOpenDBSnapshotsBeforeMigrating(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	// A fresh database has nothing to snapshot
+	store, m, err := snapshot.OpenDB(dir, now)
+	if err != nil || m != nil {
+		t.Fatalf("fresh database: snapshot %+v, err %v", m, err)
+	}
+	if err := store.UpsertTanda(&db.Tanda{ID: "td-1", Title: "Login", Covers: []string{"src/login.ts"}}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Wind the schema back to before the covers index
+	raw, err := sql.Open("sqlite", filepath.Join(dir, "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec("DELETE FROM tanda_covers; PRAGMA user_version = 0"); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+
+	store, m, err = snapshot.OpenDB(dir, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if m == nil || m.Name != "pre-migrate-v0-20250601-100000" {
+		t.Fatalf("expected a pre-migration snapshot, got %+v", m)
+	}
+	if covered, err := store.CoveredBy("src/login.ts", false); err != nil || len(covered) != 1 {
+		t.Fatalf("covers not migrated: %v %v", covered, err)
+	}
+	if version, _, _ := db.Version(filepath.Join(dir, "db.sqlite")); version != db.SchemaVersion {
+		t.Fatalf("got version %d after migrating", version)
+	}
+}
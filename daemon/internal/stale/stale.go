@@ -0,0 +1,138 @@
+package stale
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// DefaultDays is how long a tanda may go without a run before it is stale
+const DefaultDays = 30
+
+// Reasons a tanda is reported
+const (
+	NotRun      = "not_run"
+	MissingFile = "missing_file"
+)
+
+// skipDirs are never searched for re-map candidates
+var skipDirs = map[string]bool{"node_modules": true, "vendor": true}
+
+// Finding is a stale tanda with the actions that would fix it
+type Finding struct {
+	TandaID string   `json:"tanda_id"`
+	Title   string   `json:"title"`
+	Reasons []string `json:"reasons"`
+	// LastRun is empty when the tanda has never run
+	LastRun string `json:"last_run,omitempty"`
+	File    string `json:"file,omitempty"`
+	// Candidates are existing files with the same name as a missing file
+	Candidates  []string `json:"candidates,omitempty"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// Detect reports tandas with no run in the last `days` days, and tandas
+// whose file no longer exists under root. Tandas in a status statuses
+// retires are skipped. Tandas that have never run are measured from their
+// creation time.
+func Detect(tandas []*db.Tanda, root string, statuses *workflow.Workflow, days int, now time.Time) ([]Finding, error) {
+	if days <= 0 {
+		days = DefaultDays
+	}
+	cutoff := now.Add(-time.Duration(days) * 24 * time.Hour)
+
+	var index map[string][]string
+	findings := []Finding{}
+	for _, t := range tandas {
+		if statuses.IsRetired(t.Status) {
+			continue
+		}
+		f := Finding{TandaID: t.ID, Title: t.Title, File: t.File, Suggestions: []string{}}
+
+		since := t.CreatedAt
+		if n := len(t.RunHistory); n > 0 {
+			f.LastRun = t.RunHistory[n-1].Timestamp
+			since = f.LastRun
+		}
+		if ts, ok := db.ParseTimestamp(since); ok && ts.Before(cutoff) {
+			f.Reasons = append(f.Reasons, NotRun)
+			f.Suggestions = append(f.Suggestions,
+				fmt.Sprintf("archive: td update %s --status deprecated", t.ID))
+		}
+
+		if t.File != "" {
+			if _, err := os.Stat(filepath.Join(root, t.File)); os.IsNotExist(err) {
+				if index == nil {
+					if index, err = indexFiles(root); err != nil {
+						return nil, err
+					}
+				}
+				f.Reasons = append(f.Reasons, MissingFile)
+				f.Candidates = index[filepath.Base(t.File)]
+				for _, c := range f.Candidates {
+					f.Suggestions = append(f.Suggestions,
+						fmt.Sprintf("re-map: td update %s --file %s", t.ID, c))
+				}
+				if len(f.Candidates) == 0 {
+					f.Suggestions = append(f.Suggestions,
+						fmt.Sprintf("archive: td update %s --status deprecated", t.ID))
+				}
+			}
+		}
+
+		if len(f.Reasons) > 0 {
+			f.Suggestions = dedupe(f.Suggestions)
+			findings = append(findings, f)
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].TandaID < findings[j].TandaID })
+	return findings, nil
+}
+
+// indexFiles maps file names to their slash-separated paths under root,
+// skipping hidden and dependency directories
+func indexFiles(root string) (map[string][]string, error) {
+	index := make(map[string][]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (strings.HasPrefix(name, ".") || skipDirs[name]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		index[d.Name()] = append(index[d.Name()], filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index %s: %w", root, err)
+	}
+	return index, nil
+}
+
+func dedupe(items []string) []string {
+	seen := make(map[string]bool)
+	out := items[:0]
+	for _, s := range items {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
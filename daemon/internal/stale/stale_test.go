@@ -0,0 +1,61 @@
+package stale_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/stale"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+func TestDetect(t *testing.T) {
+	root := t.TempDir()
+	for _, p := range []string{"tests/login.spec.ts", "e2e/auth/logout.spec.ts", "node_modules/x/logout.spec.ts"} {
+		full := filepath.Join(root, p)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.Local)
+	tandas := []*db.Tanda{
+		{ID: "td-fresh", Status: "active", File: "tests/login.spec.ts", CreatedAt: "2025-01-01T00:00:00",
+			RunHistory: []db.RunResult{{Timestamp: "2025-05-30T10:00:00", Result: "pass"}}},
+		{ID: "td-old", Status: "active", File: "tests/login.spec.ts", CreatedAt: "2025-01-01T00:00:00",
+			RunHistory: []db.RunResult{{Timestamp: "2025-03-01T10:00:00", Result: "pass"}}},
+		{ID: "td-moved", Status: "flaky", File: "tests/logout.spec.ts", CreatedAt: "2025-05-20T00:00:00"},
+		{ID: "td-retired", Status: "deprecated", File: "tests/gone.spec.ts", CreatedAt: "2024-01-01T00:00:00"},
+		{ID: "td-archived", Status: "archived", File: "tests/gone.spec.ts", CreatedAt: "2024-01-01T00:00:00"},
+		{ID: "td-obsolete", Status: "obsolete", File: "tests/gone.spec.ts", CreatedAt: "2024-01-01T00:00:00"},
+	}
+	statuses, err := workflow.New(config.StatusConfig{Extra: []string{"obsolete"}, Retired: []string{"obsolete"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings, err := stale.Detect(tandas, root, statuses, 30, now)
+	if err != nil {
+		t.Fatalf("detect: %v", err)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("expected 2 findings, got %+v", findings)
+	}
+
+	moved := findings[0]
+	if moved.TandaID != "td-moved" || len(moved.Reasons) != 1 || moved.Reasons[0] != stale.MissingFile {
+		t.Fatalf("unexpected finding for moved file: %+v", moved)
+	}
+	if len(moved.Candidates) != 1 || moved.Candidates[0] != "e2e/auth/logout.spec.ts" {
+		t.Fatalf("expected one re-map candidate outside node_modules, got %v", moved.Candidates)
+	}
+
+	old := findings[1]
+	if old.TandaID != "td-old" || old.Reasons[0] != stale.NotRun || old.LastRun != "2025-03-01T10:00:00" {
+		t.Fatalf("unexpected finding for old tanda: %+v", old)
+	}
+}
@@ -0,0 +1,230 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// ReplicaFile names the per-checkout replica ID inside the .tandas dir.
+// It must not be committed, or every clone would share one ID.
+const ReplicaFile = "replica-id"
+
+// field is a last-writer-wins register on a tanda
+type field struct {
+	name string
+	get  func(t *db.Tanda) interface{}
+	set  func(dst, src *db.Tanda)
+}
+
+var fields = []field{
+	{"title", func(t *db.Tanda) interface{} { return t.Title }, func(d, s *db.Tanda) { d.Title = s.Title }},
+	{"status", func(t *db.Tanda) interface{} { return t.Status }, func(d, s *db.Tanda) { d.Status = s.Status }},
+	{"file", func(t *db.Tanda) interface{} { return t.File }, func(d, s *db.Tanda) { d.File = s.File }},
+	{"symbol", func(t *db.Tanda) interface{} { return t.Symbol }, func(d, s *db.Tanda) { d.Symbol = s.Symbol }},
+	{"line", func(t *db.Tanda) interface{} { return t.Line }, func(d, s *db.Tanda) { d.Line = s.Line }},
+	{"covers", func(t *db.Tanda) interface{} { return t.Covers }, func(d, s *db.Tanda) { d.Covers = s.Covers }},
+	{"cover_lines", func(t *db.Tanda) interface{} { return t.CoverLines }, func(d, s *db.Tanda) { d.CoverLines = s.CoverLines }},
+	{"depends_on", func(t *db.Tanda) interface{} { return t.DependsOn }, func(d, s *db.Tanda) { d.DependsOn = s.DependsOn }},
+	{"external_refs", func(t *db.Tanda) interface{} { return t.ExternalRefs }, func(d, s *db.Tanda) { d.ExternalRefs = s.ExternalRefs }},
+	{"refs", func(t *db.Tanda) interface{} { return t.Refs }, func(d, s *db.Tanda) { d.Refs = s.Refs }},
+	{"owners", func(t *db.Tanda) interface{} { return t.Owners }, func(d, s *db.Tanda) { d.Owners = s.Owners }},
+	{"priority", func(t *db.Tanda) interface{} { return t.Priority }, func(d, s *db.Tanda) { d.Priority = s.Priority }},
+	{"triage", func(t *db.Tanda) interface{} { return t.Triage }, func(d, s *db.Tanda) { d.Triage = s.Triage }},
+	{"snoozed_until", func(t *db.Tanda) interface{} { return t.SnoozedUntil }, func(d, s *db.Tanda) { d.SnoozedUntil = s.SnoozedUntil }},
+}
+
+// ReplicaID returns the replica ID for a .tandas dir, creating it and
+// keeping it out of git on first use
+func ReplicaID(dir string) (string, error) {
+	path := filepath.Join(dir, ReplicaFile)
+	if data, err := os.ReadFile(path); err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read replica ID: %w", err)
+	}
+
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate replica ID: %w", err)
+	}
+	id := hex.EncodeToString(buf)
+	if err := os.WriteFile(path, []byte(id+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write replica ID: %w", err)
+	}
+	if err := IgnoreEntry(dir, ReplicaFile); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// IgnoreEntry adds entry to the .gitignore inside a .tandas dir, which is
+// otherwise committed whole
+func IgnoreEntry(dir, entry string) error {
+	gitignore := filepath.Join(dir, ".gitignore")
+	data, err := os.ReadFile(gitignore)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", gitignore, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == entry {
+			return nil
+		}
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	data = append(data, entry+"\n"...)
+	if err := os.WriteFile(gitignore, data, 0644); err != nil {
+		return fmt.Errorf("failed to update %s: %w", gitignore, err)
+	}
+	return nil
+}
+
+// Touch stamps the fields that changed between prev and next as written
+// by replica at ts and advances the replica's clock entry. A nil prev
+// means next is new. Fields whose stamp already differs from prev, and
+// new tandas that already carry a clock, came in through a merge and
+// keep their stamps. Touch reports whether it stamped anything.
+func Touch(prev, next *db.Tanda, replica, ts string) bool {
+	if prev == nil {
+		// New tandas only enter the vector clock; their fields date from
+		// updated_at until edited
+		if next.Clock != nil {
+			return false
+		}
+		next.Clock = cloneClock(nil)
+		next.Clock.Vector[replica]++
+		return true
+	}
+	var stamped []string
+	for _, f := range fields {
+		if sameValue(f.get(prev), f.get(next)) {
+			continue
+		}
+		if recorded(prev, f.name) != recorded(next, f.name) {
+			continue
+		}
+		stamped = append(stamped, f.name)
+	}
+	if len(stamped) == 0 {
+		return false
+	}
+
+	clock := cloneClock(next.Clock)
+	for _, name := range stamped {
+		clock.Fields[name] = db.Stamp{Timestamp: ts, Replica: replica}
+	}
+	clock.Vector[replica]++
+	next.Clock = clock
+	return true
+}
+
+// stampOf returns the field's recorded stamp. Every edit made since a
+// tanda gained a clock is stamped, so an unstamped field on a clocked
+// tanda predates all stamped writes. Tandas without a clock date each
+// field from their last update.
+func stampOf(t *db.Tanda, name string) db.Stamp {
+	if s := recorded(t, name); s != (db.Stamp{}) {
+		return s
+	}
+	if t.Clock != nil {
+		return db.Stamp{}
+	}
+	return db.Stamp{Timestamp: t.UpdatedAt}
+}
+
+func recorded(t *db.Tanda, name string) db.Stamp {
+	if t.Clock == nil {
+		return db.Stamp{}
+	}
+	return t.Clock.Fields[name]
+}
+
+// later orders stamps by time, breaking ties on replica ID so every
+// replica picks the same winner
+func later(a, b db.Stamp) bool {
+	if a.Timestamp != b.Timestamp {
+		return newer(a.Timestamp, b.Timestamp)
+	}
+	return a.Replica > b.Replica
+}
+
+type ordering int
+
+const (
+	clocksEqual ordering = iota
+	clockBefore
+	clockAfter
+	clocksConcurrent
+)
+
+// compareClocks reports how a's vector clock relates to b's
+func compareClocks(a, b *db.Clock) ordering {
+	var va, vb map[string]uint64
+	if a != nil {
+		va = a.Vector
+	}
+	if b != nil {
+		vb = b.Vector
+	}
+	less, greater := false, false
+	for k, n := range va {
+		if n > vb[k] {
+			greater = true
+		} else if n < vb[k] {
+			less = true
+		}
+	}
+	for k, n := range vb {
+		if _, ok := va[k]; !ok && n > 0 {
+			less = true
+		}
+	}
+	switch {
+	case less && greater:
+		return clocksConcurrent
+	case less:
+		return clockBefore
+	case greater:
+		return clockAfter
+	}
+	return clocksEqual
+}
+
+func cloneClock(c *db.Clock) *db.Clock {
+	out := &db.Clock{Vector: map[string]uint64{}, Fields: map[string]db.Stamp{}}
+	if c == nil {
+		return out
+	}
+	for k, v := range c.Vector {
+		out.Vector[k] = v
+	}
+	for k, v := range c.Fields {
+		out.Fields[k] = v
+	}
+	return out
+}
+
+// sameValue compares field values, treating nil and empty slices alike
+func sameValue(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(normalizeJSON(ja), normalizeJSON(jb))
+}
+
+func normalizeJSON(b []byte) []byte {
+	if string(b) == "null" {
+		return []byte("[]")
+	}
+	return b
+}
@@ -0,0 +1,59 @@
+package sync
+
+import (
+	"fmt"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// DuplicatePolicy decides what an import does when the JSONL repeats an ID
+type DuplicatePolicy string
+
+const (
+	// DuplicatesLast keeps the later line, as a plain upsert would
+	DuplicatesLast DuplicatePolicy = "last"
+	// DuplicatesError fails the import, leaving the registry untouched
+	DuplicatesError DuplicatePolicy = "error"
+	// DuplicatesNewest keeps the copy with the latest updated_at
+	DuplicatesNewest DuplicatePolicy = "newest"
+	// DuplicatesMerge merges the copies as `remote pull` does, keeping the
+	// notes and runs of both
+	DuplicatesMerge DuplicatePolicy = "merge"
+)
+
+// ParseDuplicatePolicy validates a policy name; empty means DuplicatesLast
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, error) {
+	switch p := DuplicatePolicy(name); p {
+	case "":
+		return DuplicatesLast, nil
+	case DuplicatesLast, DuplicatesError, DuplicatesNewest, DuplicatesMerge:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown duplicate policy %q (want last, error, newest or merge)", name)
+}
+
+// resolve returns the copy to keep when dup repeats the ID of earlier
+func (p DuplicatePolicy) resolve(earlier, dup *db.Tanda) *db.Tanda {
+	switch p {
+	case DuplicatesNewest:
+		if newer(earlier.UpdatedAt, dup.UpdatedAt) {
+			return earlier
+		}
+	case DuplicatesMerge:
+		return mergeTanda(earlier, dup)
+	}
+	return dup
+}
+
+// outcome describes what an import does with a duplicate, for reports
+func (p DuplicatePolicy) outcome() string {
+	switch p {
+	case DuplicatesError:
+		return "import fails"
+	case DuplicatesNewest:
+		return "import keeps the newest updated_at"
+	case DuplicatesMerge:
+		return "import merges the copies"
+	}
+	return "import keeps the later line"
+}
@@ -0,0 +1,199 @@
+package sync
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// ImportMode picks how Import combines tandas from another file with the
+// registry
+type ImportMode string
+
+const (
+	// ImportMerge merges each tanda as a team pull does; nothing is removed
+	ImportMerge ImportMode = "merge"
+	// ImportReplace makes the registry exactly the imported tandas
+	ImportReplace ImportMode = "replace"
+)
+
+// ParseImportMode reads an import mode name
+func ParseImportMode(s string) (ImportMode, error) {
+	switch m := ImportMode(s); m {
+	case ImportMerge, ImportReplace:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown import mode %q (want merge or replace)", s)
+}
+
+// ImportPlan lists the IDs an import adds, changes and removes
+type ImportPlan struct {
+	Added   []string `json:"added"`
+	Updated []string `json:"updated"`
+	Removed []string `json:"removed"`
+}
+
+// Empty reports whether the import changes nothing
+func (p *ImportPlan) Empty() bool {
+	return len(p.Added)+len(p.Updated)+len(p.Removed) == 0
+}
+
+// ImportOptions tune Import
+type ImportOptions struct {
+	Mode ImportMode
+	// DryRun leaves the store alone and only returns the plan
+	DryRun bool
+	// Duplicates resolves IDs repeated in the incoming tandas; empty means
+	// DuplicatesLast
+	Duplicates DuplicatePolicy
+	// Statuses checks each status and its move from the stored one, as a
+	// push does; nil means the defaults
+	Statuses *workflow.Workflow
+}
+
+// Import combines incoming tandas with the store in opts.Mode. Every
+// tanda is checked as a push checks it, and nothing is written unless all
+// pass. Callers export afterwards.
+func Import(store *db.Store, incoming []*db.Tanda, opts ImportOptions) (*ImportPlan, error) {
+	mode := opts.Mode
+	statuses := opts.Statuses
+	if statuses == nil {
+		statuses = workflow.Default()
+	}
+	local, err := store.GetAllTandas()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tandas: %w", err)
+	}
+	byID := make(map[string]*db.Tanda, len(local))
+	for _, t := range local {
+		byID[t.ID] = t
+	}
+	for _, t := range incoming {
+		if err := checkIncoming(t, byID[t.ID], statuses); err != nil {
+			return nil, err
+		}
+	}
+	if incoming, err = resolveDuplicates(incoming, opts.Duplicates); err != nil {
+		return nil, err
+	}
+
+	plan := &ImportPlan{Added: []string{}, Updated: []string{}, Removed: []string{}}
+	var writes []*db.Tanda
+	switch mode {
+	case ImportMerge:
+		merged, changed := Merge(local, incoming)
+		ids := make(map[string]bool, len(changed))
+		for _, id := range changed {
+			ids[id] = true
+		}
+		for _, t := range merged {
+			if ids[t.ID] {
+				writes = append(writes, t)
+			}
+		}
+	case ImportReplace:
+		seen := make(map[string]bool, len(incoming))
+		for _, t := range incoming {
+			seen[t.ID] = true
+			if l := byID[t.ID]; l == nil || !equal(l, withEmptySlices(t)) {
+				writes = append(writes, t)
+			}
+		}
+		for _, t := range local {
+			if !seen[t.ID] {
+				plan.Removed = append(plan.Removed, t.ID)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown import mode %q", mode)
+	}
+	for _, t := range writes {
+		if byID[t.ID] == nil {
+			plan.Added = append(plan.Added, t.ID)
+		} else {
+			plan.Updated = append(plan.Updated, t.ID)
+		}
+	}
+	sort.Strings(plan.Added)
+	sort.Strings(plan.Updated)
+	sort.Strings(plan.Removed)
+	if opts.DryRun || plan.Empty() {
+		return plan, nil
+	}
+
+	batch, err := store.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer batch.Rollback()
+	if mode == ImportReplace {
+		if err := batch.ClearAll(); err != nil {
+			return nil, fmt.Errorf("failed to clear database: %w", err)
+		}
+		writes = incoming
+	}
+	for _, t := range writes {
+		if err := batch.UpsertTanda(t); err != nil {
+			return nil, fmt.Errorf("failed to write tanda %s: %w", t.ID, err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return plan, nil
+}
+
+// withEmptySlices copies t with nil slices made empty, as the store
+// returns them, so a tanda read from a file compares equal to its stored
+// copy
+func withEmptySlices(t *db.Tanda) *db.Tanda {
+	c := *t
+	v := reflect.ValueOf(&c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Field(i); f.Kind() == reflect.Slice && f.IsNil() && f.CanSet() {
+			f.Set(reflect.MakeSlice(f.Type(), 0, 0))
+		}
+	}
+	return &c
+}
+
+// checkIncoming rejects a tanda without an id or title, with a status the
+// workflow does not allow after the stored one's, or with invalid fields
+func checkIncoming(t, stored *db.Tanda, statuses *workflow.Workflow) error {
+	if t.ID == "" || t.Title == "" {
+		return fmt.Errorf("tanda %q is missing an id or title", t.ID)
+	}
+	if t.Status != "" {
+		from := ""
+		if stored != nil {
+			from = stored.Status
+		}
+		if err := statuses.CheckTransition(from, t.Status); err != nil {
+			return fmt.Errorf("tanda %s: %w", t.ID, err)
+		}
+	}
+	return db.CheckFields(t)
+}
+
+// resolveDuplicates resolves each repeated ID by policy, keeping
+// first-seen order
+func resolveDuplicates(tandas []*db.Tanda, policy DuplicatePolicy) ([]*db.Tanda, error) {
+	index := make(map[string]int, len(tandas))
+	var out []*db.Tanda
+	for _, t := range tandas {
+		i, ok := index[t.ID]
+		if !ok {
+			index[t.ID] = len(out)
+			out = append(out, t)
+			continue
+		}
+		if policy == DuplicatesError {
+			return nil, fmt.Errorf("duplicate id %s; import.duplicates is %s", t.ID, policy)
+		}
+		out[i] = policy.resolve(out[i], t)
+	}
+	return out, nil
+}
@@ -2,32 +2,119 @@ package sync
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
+	gosync "sync"
 	"time"
 
 	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/journal"
+	"github.com/tandas/daemon/internal/paths"
+	"github.com/tandas/daemon/internal/workflow"
 )
 
 // Syncer manages synchronization between JSONL and SQLite
 type Syncer struct {
-	store     *db.Store
-	jsonlPath string
-	lastSync  time.Time
+	store        *db.Store
+	jsonlPath    string
+	importErrors []string
+	replica      string
+	duplicates   DuplicatePolicy
+	statuses     *workflow.Workflow
+	// root is the project root paths are stored relative to
+	root string
+	// maxLine caps a JSONL line; imports set longer lines aside
+	maxLine int
+	// journal records imports in flight; nil records nothing
+	journal *journal.Journal
+
+	// progressMu guards progress, lastSync and writes, which status reads
+	// while an import runs
+	progressMu gosync.Mutex
+	progress   ImportProgress
+	lastSync   time.Time
+	// writes counts exports that changed issues.jsonl
+	writes uint64
 }
 
-// New creates a new syncer
+// New creates a new syncer. The project root is the parent of the
+// directory holding jsonlPath.
 func New(store *db.Store, jsonlPath string) *Syncer {
+	root, _ := paths.Root(filepath.Dir(jsonlPath))
 	return &Syncer{
-		store:     store,
-		jsonlPath: jsonlPath,
+		store:      store,
+		jsonlPath:  jsonlPath,
+		duplicates: DuplicatesLast,
+		statuses:   workflow.Default(),
+		root:       root,
+		maxLine:    DefaultMaxLineBytes,
 	}
 }
 
-// ImportFromJSONL reads the JSONL file and imports into SQLite
+// SetMaxLineBytes sets the longest line imports accept; non-positive
+// values keep DefaultMaxLineBytes
+func (s *Syncer) SetMaxLineBytes(n int) {
+	if n > 0 {
+		s.maxLine = n
+	}
+}
+
+// SetJournal records each import in j while it runs
+func (s *Syncer) SetJournal(j *journal.Journal) {
+	s.journal = j
+}
+
+// SetWorkflow sets the allowed statuses; imports flag tandas outside them
+func (s *Syncer) SetWorkflow(w *workflow.Workflow) {
+	s.statuses = w
+}
+
+// SetDuplicatePolicy sets how imports treat IDs repeated in the JSONL
+func (s *Syncer) SetDuplicatePolicy(p DuplicatePolicy) {
+	s.duplicates = p
+}
+
+// Duplicates returns the policy for repeated IDs, which Import of another
+// file follows too
+func (s *Syncer) Duplicates() DuplicatePolicy {
+	return s.duplicates
+}
+
+const (
+	// ProgressInterval is the number of rows imported between progress
+	// updates
+	ProgressInterval = 1000
+	// logInterval spaces out progress lines for long imports
+	logInterval = 2 * time.Second
+)
+
+// ImportProgress describes the running or most recent import
+type ImportProgress struct {
+	Running    bool      `json:"running"`
+	Rows       int       `json:"rows"`
+	Percent    float64   `json:"percent"`
+	RowsPerSec float64   `json:"rows_per_sec"`
+	StartedAt  time.Time `json:"started_at"`
+	Elapsed    string    `json:"elapsed"`
+}
+
+// ImportFromJSONL reads the JSONL file and imports it into SQLite in a
+// single transaction, updating ImportProgress every ProgressInterval rows
 func (s *Syncer) ImportFromJSONL() error {
+	return s.ImportFromJSONLContext(context.Background())
+}
+
+// ImportFromJSONLContext is ImportFromJSONL, abandoning the import and
+// leaving the registry as it was when ctx is done
+func (s *Syncer) ImportFromJSONLContext(ctx context.Context) error {
 	file, err := os.Open(s.jsonlPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -37,64 +124,200 @@ func (s *Syncer) ImportFromJSONL() error {
 	}
 	defer file.Close()
 
-	// Clear existing data
-	if err := s.store.ClearAll(); err != nil {
-		return fmt.Errorf("failed to clear database: %w", err)
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
 	}
+	started := time.Now()
+	s.setProgress(ImportProgress{Running: true, StartedAt: started})
 
-	scanner := bufio.NewScanner(file)
-	// Increase buffer size for large lines
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
-
-	lineNum := 0
-	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
-		if line == "" {
-			continue
+	seq, err := s.journal.Begin(journal.Import, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := s.journal.Done(seq); err != nil {
+			slog.Warn("Failed to mark import done", "err", err)
 		}
+	}()
 
-		var tanda db.Tanda
-		if err := json.Unmarshal([]byte(line), &tanda); err != nil {
-			fmt.Printf("Warning: failed to parse line %d: %v\n", lineNum, err)
-			continue
-		}
+	// Clear and import in one transaction, so other connections, including
+	// one-shot commands in another process, never see a partial registry
+	batch, err := s.store.Begin()
+	if err != nil {
+		return err
+	}
+	defer batch.Rollback()
+	if err := batch.ClearAll(); err != nil {
+		return fmt.Errorf("failed to clear database: %w", err)
+	}
 
-		// Initialize empty slices if nil
-		if tanda.Covers == nil {
-			tanda.Covers = []string{}
-		}
-		if tanda.DependsOn == nil {
-			tanda.DependsOn = []string{}
-		}
-		if tanda.Notes == nil {
-			tanda.Notes = []db.Note{}
-		}
-		if tanda.RunHistory == nil {
-			tanda.RunHistory = []db.RunResult{}
+	// Lines are parsed in parallel and written here in file order
+	done := make(chan struct{})
+	defer close(done)
+	spill := &appendFile{path: filepath.Join(filepath.Dir(s.jsonlPath), OversizedFileName)}
+	defer spill.Close()
+	chunks, readErr := parseLines(file, s.maxLine, spill, done)
+
+	s.importErrors = nil
+	seen := make(map[string]int)
+	rows, sinceProgress := 0, 0
+	var read int64
+	lastLog := started
+	for chunk := range chunks {
+		if err := ctx.Err(); err != nil {
+			s.setProgress(progress(started, rows, read, size, false))
+			return fmt.Errorf("import abandoned: %w", err)
 		}
+		read += chunk.bytes
+		for _, l := range chunk.lines {
+			if l.oversized > 0 {
+				s.importError(fmt.Sprintf("line %d is %d bytes, over the %d byte limit; moved to %s",
+					l.num, l.oversized, s.maxLine, OversizedFileName))
+				continue
+			}
+			if l.err != nil {
+				s.importError(fmt.Sprintf("failed to parse line %d: %v", l.num, l.err))
+				continue
+			}
+			if l.tanda.Status != "" {
+				if err := s.statuses.CheckStatus(l.tanda.Status); err != nil {
+					s.importError(fmt.Sprintf("line %d (%s): %v", l.num, l.tanda.ID, err))
+				}
+			}
+			if err := db.CheckRefs(l.tanda.Refs); err != nil {
+				s.importError(fmt.Sprintf("line %d (%s): %v", l.num, l.tanda.ID, err))
+			}
+			// Stored paths are canonical; the next export rewrites the file
+			paths.NormalizeTanda(s.root, l.tanda)
+			t, err := s.dedupe(batch, seen, l)
+			if err != nil {
+				s.setProgress(progress(started, rows, read, size, false))
+				return err
+			}
+			if t == nil {
+				continue
+			}
+			if err := batch.UpsertTanda(t); err != nil {
+				s.importError(fmt.Sprintf("failed to upsert tanda %s: %v", l.tanda.ID, err))
+				continue
+			}
+			rows++
+			sinceProgress++
+			if sinceProgress < ProgressInterval {
+				continue
+			}
 
-		if err := s.store.UpsertTanda(&tanda); err != nil {
-			fmt.Printf("Warning: failed to upsert tanda %s: %v\n", tanda.ID, err)
-			continue
+			sinceProgress = 0
+			p := progress(started, rows, read, size, true)
+			s.setProgress(p)
+			if time.Since(lastLog) >= logInterval {
+				slog.Info("Importing", "file", filepath.Base(s.jsonlPath), "rows", p.Rows,
+					"percent", math.Round(p.Percent), "rows_per_sec", math.Round(p.RowsPerSec))
+				lastLog = time.Now()
+			}
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
+	if err := readErr(); err != nil {
+		s.setProgress(progress(started, rows, read, size, false))
 		return fmt.Errorf("error reading JSONL: %w", err)
 	}
+	if err := batch.Commit(); err != nil {
+		s.setProgress(progress(started, rows, read, size, false))
+		return fmt.Errorf("failed to commit import: %w", err)
+	}
 
-	s.lastSync = time.Now()
+	p := progress(started, rows, size, size, false)
+	s.setProgress(p)
+	if lastLog != started {
+		slog.Info("Imported", "rows", p.Rows, "elapsed", p.Elapsed, "rows_per_sec", math.Round(p.RowsPerSec))
+	}
+	s.synced()
 	return nil
 }
 
-// ExportToJSONL writes all tandas from SQLite to JSONL
+// dedupe applies the duplicate policy to a parsed line, returning the
+// tanda to write or nil when the earlier copy stands. seen maps each ID
+// to the line it first appeared on.
+func (s *Syncer) dedupe(batch *db.Batch, seen map[string]int, l parsedLine) (*db.Tanda, error) {
+	first, dup := seen[l.tanda.ID]
+	if !dup {
+		seen[l.tanda.ID] = l.num
+		return l.tanda, nil
+	}
+	if s.duplicates == DuplicatesError {
+		return nil, fmt.Errorf("duplicate id %s on line %d (first on line %d)", l.tanda.ID, l.num, first)
+	}
+	s.importError(fmt.Sprintf("duplicate id %s on line %d (first on line %d); %s",
+		l.tanda.ID, l.num, first, s.duplicates.outcome()))
+
+	earlier, err := batch.GetTanda(l.tanda.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tanda %s: %w", l.tanda.ID, err)
+	}
+	if earlier == nil {
+		// The first copy failed to write
+		return l.tanda, nil
+	}
+	if t := s.duplicates.resolve(earlier, l.tanda); t != earlier {
+		return t, nil
+	}
+	return nil, nil
+}
+
+func progress(started time.Time, rows int, read, size int64, running bool) ImportProgress {
+	elapsed := time.Since(started)
+	p := ImportProgress{
+		Running:   running,
+		Rows:      rows,
+		StartedAt: started,
+		Elapsed:   elapsed.Round(time.Millisecond).String(),
+	}
+	if size > 0 {
+		p.Percent = math.Min(100, float64(read)*100/float64(size))
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		p.RowsPerSec = float64(rows) / secs
+	}
+	return p
+}
+
+func (s *Syncer) setProgress(p ImportProgress) {
+	s.progressMu.Lock()
+	s.progress = p
+	s.progressMu.Unlock()
+}
+
+// Progress returns the running or most recent import's progress. It is
+// safe to call while an import runs.
+func (s *Syncer) Progress() ImportProgress {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	return s.progress
+}
+
+// ExportToJSONL writes all tandas from SQLite to JSONL, streaming rows
+// from the store so the registry is never held in memory whole
 func (s *Syncer) ExportToJSONL() error {
-	tandas, err := s.store.GetAllTandas()
+	return s.ExportToJSONLContext(context.Background())
+}
+
+// ExportToJSONLContext is ExportToJSONL, leaving issues.jsonl as it was
+// when ctx is done
+func (s *Syncer) ExportToJSONLContext(ctx context.Context) error {
+	prev, err := s.previous()
 	if err != nil {
-		return fmt.Errorf("failed to get tandas: %w", err)
+		return err
 	}
+	if s.replica == "" {
+		id, err := ReplicaID(filepath.Dir(s.jsonlPath))
+		if err != nil {
+			return err
+		}
+		s.replica = id
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
 
 	// Create temp file first
 	dir := filepath.Dir(s.jsonlPath)
@@ -103,32 +326,41 @@ func (s *Syncer) ExportToJSONL() error {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
 	tmpPath := tmpFile.Name()
+	fail := func(err error) error {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return err
+	}
 
-	writer := bufio.NewWriter(tmpFile)
-	for _, t := range tandas {
+	// Tandas whose clocks were stamped are saved back once the read is done
+	var stamped []*db.Tanda
+	hash := sha256.New()
+	writer := bufio.NewWriter(io.MultiWriter(tmpFile, hash))
+	err = s.store.ForEachTandaContext(ctx, db.Filter{}, func(t *db.Tanda) error {
+		if prev != nil && Touch(prev[t.ID], t, s.replica, now) {
+			stamped = append(stamped, t)
+		}
 		data, err := json.Marshal(t)
 		if err != nil {
-			tmpFile.Close()
-			os.Remove(tmpPath)
 			return fmt.Errorf("failed to marshal tanda %s: %w", t.ID, err)
 		}
-
 		if _, err := writer.Write(data); err != nil {
-			tmpFile.Close()
-			os.Remove(tmpPath)
 			return fmt.Errorf("failed to write tanda %s: %w", t.ID, err)
 		}
 		if _, err := writer.WriteString("\n"); err != nil {
-			tmpFile.Close()
-			os.Remove(tmpPath)
 			return fmt.Errorf("failed to write newline: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return fail(fmt.Errorf("failed to export tandas: %w", err))
 	}
 
 	if err := writer.Flush(); err != nil {
-		tmpFile.Close()
-		os.Remove(tmpPath)
-		return fmt.Errorf("failed to flush: %w", err)
+		return fail(fmt.Errorf("failed to flush: %w", err))
+	}
+	if err := s.saveClocks(stamped); err != nil {
+		return fail(err)
 	}
 
 	if err := tmpFile.Close(); err != nil {
@@ -136,21 +368,171 @@ func (s *Syncer) ExportToJSONL() error {
 		return fmt.Errorf("failed to close temp file: %w", err)
 	}
 
+	// Leave an identical file alone so its mtime, git status and watchers
+	// are not disturbed
+	if sum, err := fileHash(s.jsonlPath); err == nil && bytes.Equal(sum, hash.Sum(nil)) {
+		os.Remove(tmpPath)
+		s.synced()
+		return nil
+	}
+
 	// Atomic rename
 	if err := os.Rename(tmpPath, s.jsonlPath); err != nil {
 		os.Remove(tmpPath)
 		return fmt.Errorf("failed to rename: %w", err)
 	}
 
-	s.lastSync = time.Now()
+	s.progressMu.Lock()
+	s.writes++
+	s.progressMu.Unlock()
+	s.synced()
+	return nil
+}
+
+func fileHash(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// FileIDs returns the IDs in the JSONL, skipping lines that do not parse
+func (s *Syncer) FileIDs() (map[string]bool, error) {
+	ids := map[string]bool{}
+	file, err := os.Open(s.jsonlPath)
+	if os.IsNotExist(err) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open JSONL: %w", err)
+	}
+	defer file.Close()
+
+	lines := newLineReader(file, s.maxLine)
+	for {
+		line, err := lines.next(nil)
+		if err == io.EOF {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading JSONL: %w", err)
+		}
+		var entry struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(line.data, &entry) == nil && entry.ID != "" {
+			ids[entry.ID] = true
+		}
+	}
+}
+
+// skipped discards a JSON value without decoding it
+type skipped struct{}
+
+func (*skipped) UnmarshalJSON([]byte) error { return nil }
+
+// previous indexes the last exported copy by ID for stamping local edits
+// into clocks. Only the fields Touch compares are decoded; notes and run
+// history, most of a tanda's size, are skipped. It returns nil when the
+// file is unreadable, leaving clocks alone rather than stamping against a
+// broken file.
+func (s *Syncer) previous() (map[string]*db.Tanda, error) {
+	prev := map[string]*db.Tanda{}
+	file, err := os.Open(s.jsonlPath)
+	if os.IsNotExist(err) {
+		return prev, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open JSONL: %w", err)
+	}
+	defer file.Close()
+
+	lines := newLineReader(file, s.maxLine)
+	for {
+		l, err := lines.next(nil)
+		if err == io.EOF {
+			return prev, nil
+		}
+		if err != nil || l.oversized {
+			return nil, nil
+		}
+		line := bytes.TrimSpace(l.data)
+		if len(line) == 0 {
+			continue
+		}
+		var entry struct {
+			db.Tanda
+			Notes      skipped `json:"notes"`
+			RunHistory skipped `json:"run_history"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, nil
+		}
+		t := entry.Tanda
+		prev[t.ID] = &t
+	}
+}
+
+// saveClocks writes back tandas whose clocks were stamped during export,
+// so the cache carries the same stamps as the JSONL
+func (s *Syncer) saveClocks(tandas []*db.Tanda) error {
+	if len(tandas) == 0 {
+		return nil
+	}
+	batch, err := s.store.Begin()
+	if err != nil {
+		return err
+	}
+	defer batch.Rollback()
+	for _, t := range tandas {
+		if err := batch.UpsertTanda(t); err != nil {
+			return fmt.Errorf("failed to update clock for %s: %w", t.ID, err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return fmt.Errorf("failed to save clocks: %w", err)
+	}
 	return nil
 }
 
-// LastSyncTime returns the time of the last sync
+func (s *Syncer) importError(msg string) {
+	slog.Warn("Import problem", "problem", msg)
+	s.importErrors = append(s.importErrors, msg)
+}
+
+// ImportErrors returns the per-line problems from the last import
+func (s *Syncer) ImportErrors() []string {
+	return s.importErrors
+}
+
+// LastSyncTime returns the time of the last sync. It is safe to call while
+// a sync runs.
 func (s *Syncer) LastSyncTime() time.Time {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
 	return s.lastSync
 }
 
+// Writes counts the exports that changed issues.jsonl, as opposed to
+// finding it already up to date
+func (s *Syncer) Writes() uint64 {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	return s.writes
+}
+
+func (s *Syncer) synced() {
+	s.progressMu.Lock()
+	s.lastSync = time.Now()
+	s.progressMu.Unlock()
+}
+
 // NeedsSync checks if JSONL file has been modified since last sync
 func (s *Syncer) NeedsSync() (bool, error) {
 	info, err := os.Stat(s.jsonlPath)
@@ -161,5 +543,5 @@ func (s *Syncer) NeedsSync() (bool, error) {
 		return false, err
 	}
 
-	return info.ModTime().After(s.lastSync), nil
+	return info.ModTime().After(s.LastSyncTime()), nil
 }
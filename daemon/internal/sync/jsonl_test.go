@@ -2,13 +2,17 @@ package sync_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/tandas/daemon/internal/config"
 	"github.com/tandas/daemon/internal/db"
 	syncpkg "github.com/tandas/daemon/internal/sync"
+	"github.com/tandas/daemon/internal/workflow"
 )
 
 func TestImportFromJSONL(t *testing.T) {
@@ -40,6 +44,240 @@ func TestImportFromJSONL(t *testing.T) {
 	}
 }
 
+func TestImportNormalizesPaths(t *testing.T) {
+	store := newStore(t)
+	root := t.TempDir()
+	jsonl := filepath.Join(root, ".tandas", "issues.jsonl")
+	os.MkdirAll(filepath.Dir(jsonl), 0o755)
+	line, _ := json.Marshal(map[string]interface{}{
+		"id": "td-1", "title": "Login", "status": "active",
+		"file":   "./tests\\login.spec.ts",
+		"covers": []string{"auth", filepath.Join(root, "src", "auth.go"), "src/auth.go"},
+	})
+	if err := os.WriteFile(jsonl, append(line, '\n'), 0o644); err != nil {
+		t.Fatalf("write jsonl: %v", err)
+	}
+
+	if err := syncpkg.New(store, jsonl).ImportFromJSONL(); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	got, _ := store.GetTanda("td-1")
+	if got == nil || got.File != "tests/login.spec.ts" || strings.Join(got.Covers, ",") != "auth,src/auth.go" {
+		t.Fatalf("expected canonical paths, got %+v", got)
+	}
+}
+
+func TestImportChecksRefs(t *testing.T) {
+	store := newStore(t)
+	jsonl := filepath.Join(t.TempDir(), "issues.jsonl")
+	data := `{"id":"td-1","title":"Login","refs":[{"type":"pr","url":"https://github.com/o/r/pull/42","id":"#42"}]}` + "\n" +
+		`{"id":"td-2","title":"Search","refs":[{"type":"issue","id":"JIRA-7"},{"type":"wiki","url":"notes.md"}]}` + "\n"
+	if err := os.WriteFile(jsonl, []byte(data), 0o644); err != nil {
+		t.Fatalf("write jsonl: %v", err)
+	}
+
+	syncer := syncpkg.New(store, jsonl)
+	if err := syncer.ImportFromJSONL(); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	got, _ := store.GetTanda("td-1")
+	if got == nil || len(got.Refs) != 1 || got.Refs[0].URL != "https://github.com/o/r/pull/42" {
+		t.Fatalf("expected the pr ref imported, got %+v", got)
+	}
+	// A bad ref is reported but the tanda is kept, so no data is lost
+	errs := syncer.ImportErrors()
+	if len(errs) != 1 || !strings.Contains(errs[0], "line 2 (td-2): ref 2: invalid ref type \"wiki\"") {
+		t.Fatalf("expected the wiki ref reported, got %v", errs)
+	}
+	if got, _ := store.GetTanda("td-2"); got == nil || len(got.Refs) != 2 {
+		t.Fatalf("expected td-2 imported with its refs, got %+v", got)
+	}
+}
+
+func TestImportOversizedLines(t *testing.T) {
+	store := newStore(t)
+	dir := t.TempDir()
+	jsonl := filepath.Join(dir, "issues.jsonl")
+
+	// Over the old 1 MB scanner cap but under the limit
+	long, _ := json.Marshal(map[string]string{"id": "td-long", "title": strings.Repeat("x", 2<<20), "status": "active"})
+	huge := `{"id":"td-huge","title":"` + strings.Repeat("y", 3<<20) + `"}`
+	data := strings.Join([]string{
+		`{"id":"td-1","title":"First","status":"active"}`,
+		huge,
+		string(long),
+		`{"id":"td-2","title":"Last","status":"active"}`,
+		huge,
+	}, "\n")
+	if err := os.WriteFile(jsonl, []byte(data), 0o644); err != nil {
+		t.Fatalf("write jsonl: %v", err)
+	}
+
+	syncer := syncpkg.New(store, jsonl)
+	syncer.SetMaxLineBytes(3 << 20)
+	if err := syncer.ImportFromJSONL(); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	for _, id := range []string{"td-1", "td-long", "td-2"} {
+		if got, _ := store.GetTanda(id); got == nil {
+			t.Errorf("expected %s imported", id)
+		}
+	}
+	errs := syncer.ImportErrors()
+	if len(errs) != 2 || !strings.HasPrefix(errs[0], "line 2 is") || !strings.HasPrefix(errs[1], "line 5 is") {
+		t.Fatalf("expected lines 2 and 5 reported, got %v", errs)
+	}
+	set, err := os.ReadFile(filepath.Join(dir, syncpkg.OversizedFileName))
+	if err != nil {
+		t.Fatalf("read oversized lines: %v", err)
+	}
+	if string(set) != huge+"\n"+huge+"\n" {
+		t.Errorf("expected both oversized lines set aside intact, got %d bytes", len(set))
+	}
+	if ignore, _ := os.ReadFile(filepath.Join(dir, ".gitignore")); !strings.Contains(string(ignore), syncpkg.OversizedFileName) {
+		t.Errorf("expected %s ignored, got %q", syncpkg.OversizedFileName, ignore)
+	}
+}
+
+func TestExportSkipsUnchanged(t *testing.T) {
+	store := newStore(t)
+	tanda := &db.Tanda{ID: "td-3", Title: "Search", Status: "active",
+		CreatedAt: "2025-01-01T00:00:00Z", UpdatedAt: "2025-01-01T00:00:00Z"}
+	if err := store.UpsertTanda(tanda); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	jsonl := filepath.Join(t.TempDir(), "issues.jsonl")
+	syncer := syncpkg.New(store, jsonl)
+	if err := syncer.ExportToJSONL(); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(jsonl, old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if err := syncer.ExportToJSONL(); err != nil {
+		t.Fatalf("re-export: %v", err)
+	}
+	if info, _ := os.Stat(jsonl); !info.ModTime().Equal(old) {
+		t.Fatalf("expected unchanged export to keep mtime %v, got %v", old, info.ModTime())
+	}
+
+	tanda.Title = "Search results"
+	if err := store.UpsertTanda(tanda); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if err := syncer.ExportToJSONL(); err != nil {
+		t.Fatalf("export after edit: %v", err)
+	}
+	if info, _ := os.Stat(jsonl); info.ModTime().Equal(old) {
+		t.Fatal("expected changed export to rewrite the file")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(jsonl), "*.tmp")); len(matches) != 0 {
+		t.Fatalf("temp files left behind: %v", matches)
+	}
+}
+
+func TestImportFromJSONLChunks(t *testing.T) {
+	store := newStore(t)
+	jsonl := filepath.Join(t.TempDir(), "issues.jsonl")
+	n := syncpkg.ProgressInterval*2 + 5
+	var data []byte
+	for i := 0; i < n; i++ {
+		line, _ := json.Marshal(map[string]string{"id": fmt.Sprintf("td-%d", i), "title": "T", "status": "active"})
+		data = append(append(data, line...), '\n')
+	}
+	// A bad line early and late, and a later duplicate that must win as it
+	// would in a sequential read
+	data = append([]byte("not json\n"), data...)
+	data = append(data, `{"id":"td-0","title":"Last","status":"active"}`+"\nalso not json\n"...)
+	if err := os.WriteFile(jsonl, data, 0o644); err != nil {
+		t.Fatalf("write jsonl: %v", err)
+	}
+
+	syncer := syncpkg.New(store, jsonl)
+	if err := syncer.ImportFromJSONL(); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		t.Fatalf("get all: %v", err)
+	}
+	if len(tandas) != n {
+		t.Fatalf("expected %d tandas, got %d", n, len(tandas))
+	}
+	errs := syncer.ImportErrors()
+	if len(errs) != 3 || !strings.Contains(errs[0], "line 1:") ||
+		!strings.Contains(errs[1], fmt.Sprintf("duplicate id td-0 on line %d", n+2)) ||
+		!strings.Contains(errs[2], fmt.Sprintf("line %d:", n+3)) {
+		t.Fatalf("expected errors for lines 1, %d and %d in order, got %v", n+2, n+3, errs)
+	}
+	if got, _ := store.GetTanda("td-0"); got == nil || got.Title != "Last" {
+		t.Fatalf("expected the later duplicate to win, got %+v", got)
+	}
+	p := syncer.Progress()
+	if p.Running || p.Rows != n+1 || p.Percent != 100 {
+		t.Fatalf("unexpected progress %+v", p)
+	}
+}
+
+func TestImportDuplicatePolicies(t *testing.T) {
+	data := strings.Join([]string{
+		`{"id":"td-1","title":"Newer","status":"active","updated_at":"2025-06-02T10:00:00Z","run_history":[{"ts":"2025-06-02T10:00:00Z","result":"pass"}]}`,
+		`{"id":"td-2","title":"Other","status":"active"}`,
+		`{"id":"td-1","title":"Older","status":"active","updated_at":"2025-06-01T10:00:00Z","run_history":[{"ts":"2025-06-01T10:00:00Z","result":"fail"}]}`,
+	}, "\n") + "\n"
+
+	cases := []struct {
+		policy syncpkg.DuplicatePolicy
+		title  string
+		runs   int
+	}{
+		{syncpkg.DuplicatesLast, "Older", 1},
+		{syncpkg.DuplicatesNewest, "Newer", 1},
+		{syncpkg.DuplicatesMerge, "Newer", 2},
+	}
+	for _, c := range cases {
+		store := newStore(t)
+		jsonl := filepath.Join(t.TempDir(), "issues.jsonl")
+		if err := os.WriteFile(jsonl, []byte(data), 0o644); err != nil {
+			t.Fatalf("write jsonl: %v", err)
+		}
+		syncer := syncpkg.New(store, jsonl)
+		syncer.SetDuplicatePolicy(c.policy)
+		if err := syncer.ImportFromJSONL(); err != nil {
+			t.Fatalf("%s: import: %v", c.policy, err)
+		}
+		got, _ := store.GetTanda("td-1")
+		if got == nil || got.Title != c.title || len(got.RunHistory) != c.runs {
+			t.Errorf("%s: got %+v, want title %q with %d runs", c.policy, got, c.title, c.runs)
+		}
+		if errs := syncer.ImportErrors(); len(errs) != 1 || !strings.Contains(errs[0], "duplicate id td-1 on line 3 (first on line 1)") {
+			t.Errorf("%s: expected the duplicate reported, got %v", c.policy, errs)
+		}
+	}
+
+	// The error policy fails the import and keeps the previous registry
+	store := newStore(t)
+	store.UpsertTanda(&db.Tanda{ID: "td-9", Title: "Kept", Status: "active"})
+	jsonl := filepath.Join(t.TempDir(), "issues.jsonl")
+	if err := os.WriteFile(jsonl, []byte(data), 0o644); err != nil {
+		t.Fatalf("write jsonl: %v", err)
+	}
+	syncer := syncpkg.New(store, jsonl)
+	syncer.SetDuplicatePolicy(syncpkg.DuplicatesError)
+	if err := syncer.ImportFromJSONL(); err == nil || !strings.Contains(err.Error(), "duplicate id td-1 on line 3") {
+		t.Fatalf("expected a duplicate error, got %v", err)
+	}
+	if got, _ := store.GetTanda("td-9"); got == nil {
+		t.Fatal("failed import should leave the registry untouched")
+	}
+
+	if _, err := syncpkg.ParseDuplicatePolicy("first"); err == nil {
+		t.Error("expected an unknown policy to be rejected")
+	}
+}
+
 func TestExportToJSONL(t *testing.T) {
 	store := newStore(t)
 	tanda := &db.Tanda{
@@ -77,3 +315,116 @@ func newStore(t *testing.T) *db.Store {
 	t.Cleanup(func() { _ = store.Close() })
 	return store
 }
+
+func TestImportModes(t *testing.T) {
+	store := newStore(t)
+	store.UpsertTanda(&db.Tanda{ID: "td-1", Title: "Login", Status: "active"})
+	store.UpsertTanda(&db.Tanda{ID: "td-2", Title: "Search", Status: "active"})
+	incoming := func() []*db.Tanda {
+		return []*db.Tanda{
+			{ID: "td-2", Title: "Search v1", Status: "active"},
+			{ID: "td-3", Title: "Export", Status: "active"},
+			{ID: "td-2", Title: "Search v2", Status: "active"},
+		}
+	}
+
+	plan, err := syncpkg.Import(store, incoming(), syncpkg.ImportOptions{Mode: syncpkg.ImportReplace, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if fmt.Sprint(plan.Added, plan.Updated, plan.Removed) != "[td-3] [td-2] [td-1]" {
+		t.Fatalf("unexpected replace plan %+v", plan)
+	}
+	if got, _ := store.GetTanda("td-1"); got == nil {
+		t.Fatal("dry run changed the store")
+	}
+
+	if _, err := syncpkg.Import(store, incoming(), syncpkg.ImportOptions{Mode: syncpkg.ImportMerge}); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	all, _ := store.GetAllTandas()
+	if len(all) != 3 {
+		t.Fatalf("expected merge to keep td-1 and add td-3, got %d tandas", len(all))
+	}
+
+	if _, err := syncpkg.Import(store, incoming(), syncpkg.ImportOptions{Mode: syncpkg.ImportReplace}); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	all, _ = store.GetAllTandas()
+	if len(all) != 2 {
+		t.Fatalf("expected replace to leave 2 tandas, got %d", len(all))
+	}
+	if got, _ := store.GetTanda("td-2"); got == nil || got.Title != "Search v2" {
+		t.Errorf("expected the last copy of td-2, got %+v", got)
+	}
+	plan, _ = syncpkg.Import(store, incoming(), syncpkg.ImportOptions{Mode: syncpkg.ImportReplace})
+	if !plan.Empty() {
+		t.Errorf("expected a repeat replace to change nothing, got %+v", plan)
+	}
+}
+
+func TestImportChecksTandas(t *testing.T) {
+	store := newStore(t)
+	store.UpsertTanda(&db.Tanda{ID: "td-1", Title: "Login", Status: "active"})
+	statuses, err := workflow.New(config.StatusConfig{Transitions: map[string][]string{"archived": {"archived"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.UpsertTanda(&db.Tanda{ID: "td-2", Title: "Legacy", Status: "archived"})
+
+	for name, tanda := range map[string]*db.Tanda{
+		"unknown status":    {ID: "td-3", Title: "Export", Status: "retired"},
+		"status transition": {ID: "td-2", Title: "Legacy", Status: "active"},
+		"dangling ref":      {ID: "td-3", Title: "Export", Refs: []db.Ref{{Type: db.RefIssue}}},
+		"missing title":     {ID: "td-3"},
+		"bad priority":      {ID: "td-3", Title: "Export", Priority: "urgent"},
+	} {
+		incoming := []*db.Tanda{{ID: "td-4", Title: "Search"}, tanda}
+		if _, err := syncpkg.Import(store, incoming, syncpkg.ImportOptions{Mode: syncpkg.ImportMerge, Statuses: statuses}); err == nil {
+			t.Errorf("%s: import succeeded", name)
+		}
+	}
+	if got, _ := store.GetTanda("td-4"); got != nil {
+		t.Error("a rejected import wrote its valid tandas")
+	}
+}
+
+func TestImportDuplicatePolicy(t *testing.T) {
+	incoming := func() []*db.Tanda {
+		return []*db.Tanda{
+			{ID: "td-1", Title: "Login v1", Status: "active", UpdatedAt: "2025-06-02T10:00:00Z",
+				Notes: []db.Note{{Timestamp: "2025-06-02T10:00:00Z", Type: "comment", Text: "first"}}},
+			{ID: "td-1", Title: "Login v2", Status: "active", UpdatedAt: "2025-06-01T10:00:00Z",
+				Notes: []db.Note{{Timestamp: "2025-06-01T10:00:00Z", Type: "comment", Text: "second"}}},
+		}
+	}
+	for policy, want := range map[syncpkg.DuplicatePolicy]string{
+		syncpkg.DuplicatesLast:   "Login v2",
+		syncpkg.DuplicatesNewest: "Login v1",
+	} {
+		store := newStore(t)
+		if _, err := syncpkg.Import(store, incoming(), syncpkg.ImportOptions{Mode: syncpkg.ImportReplace, Duplicates: policy}); err != nil {
+			t.Fatalf("%s: %v", policy, err)
+		}
+		if got, _ := store.GetTanda("td-1"); got == nil || got.Title != want {
+			t.Errorf("%s kept %+v, want %s", policy, got, want)
+		}
+	}
+
+	store := newStore(t)
+	if _, err := syncpkg.Import(store, incoming(), syncpkg.ImportOptions{Mode: syncpkg.ImportReplace, Duplicates: syncpkg.DuplicatesMerge}); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if got, _ := store.GetTanda("td-1"); got == nil || len(got.Notes) != 2 {
+		t.Errorf("merge kept %+v, want the notes of both copies", got)
+	}
+
+	store = newStore(t)
+	_, err := syncpkg.Import(store, incoming(), syncpkg.ImportOptions{Mode: syncpkg.ImportReplace, Duplicates: syncpkg.DuplicatesError})
+	if err == nil || !strings.Contains(err.Error(), "duplicate id td-1") {
+		t.Fatalf("error policy = %v, want a duplicate id error", err)
+	}
+	if all, _ := store.GetAllTandas(); len(all) != 0 {
+		t.Errorf("error policy wrote %d tandas", len(all))
+	}
+}
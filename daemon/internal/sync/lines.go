@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// DefaultMaxLineBytes caps one JSONL line; tandas with very long run
+	// histories stay well below it
+	DefaultMaxLineBytes = 64 << 20
+	// OversizedFileName holds lines imports set aside for exceeding the
+	// cap, next to issues.jsonl
+	OversizedFileName = "oversized.jsonl"
+)
+
+// rawLine is one JSONL line without its newline. An oversized line has no
+// data; size counts its bytes, newline included.
+type rawLine struct {
+	num       int
+	data      []byte
+	size      int64
+	oversized bool
+}
+
+// lineReader reads lines of any length up to max without a scanner's
+// fixed buffer, stepping over longer lines without holding them in memory
+type lineReader struct {
+	r   *bufio.Reader
+	max int
+	num int
+}
+
+func newLineReader(r io.Reader, max int) *lineReader {
+	if max <= 0 {
+		max = DefaultMaxLineBytes
+	}
+	return &lineReader{r: bufio.NewReaderSize(r, 64*1024), max: max}
+}
+
+// next returns the next line, or io.EOF after the last. An oversized line
+// is copied to spill, when set, as it is read.
+func (lr *lineReader) next(spill io.Writer) (rawLine, error) {
+	var l rawLine
+	var buf []byte
+	for {
+		chunk, err := lr.r.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull && err != io.EOF {
+			return l, err
+		}
+		l.size += int64(len(chunk))
+
+		n := len(buf) + len(chunk)
+		if bytes.HasSuffix(chunk, []byte("\n")) {
+			n--
+		}
+		if !l.oversized && n > lr.max {
+			l.oversized = true
+			if spill != nil {
+				if _, err := spill.Write(buf); err != nil {
+					return l, err
+				}
+			}
+			buf = nil
+		}
+		if l.oversized {
+			if spill != nil {
+				if _, err := spill.Write(chunk); err != nil {
+					return l, err
+				}
+			}
+		} else {
+			buf = append(buf, chunk...)
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			if l.size == 0 {
+				return l, io.EOF
+			}
+			// The last line has no newline; keep spilled lines separate
+			if l.oversized && spill != nil {
+				if _, err := spill.Write([]byte("\n")); err != nil {
+					return l, err
+				}
+			}
+		}
+		break
+	}
+
+	lr.num++
+	l.num = lr.num
+	if !l.oversized {
+		l.data = bytes.TrimSuffix(bytes.TrimSuffix(buf, []byte("\n")), []byte("\r"))
+	}
+	return l, nil
+}
+
+// appendFile opens path for appending on the first write, so a file is only
+// created when something is set aside. The file is kept out of git.
+type appendFile struct {
+	path string
+	f    *os.File
+}
+
+func (a *appendFile) Write(p []byte) (int, error) {
+	if a.f == nil {
+		if err := IgnoreEntry(filepath.Dir(a.path), filepath.Base(a.path)); err != nil {
+			return 0, err
+		}
+		f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return 0, err
+		}
+		a.f = f
+	}
+	return a.f.Write(p)
+}
+
+func (a *appendFile) Close() error {
+	if a.f == nil {
+		return nil
+	}
+	return a.f.Close()
+}
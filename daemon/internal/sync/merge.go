@@ -0,0 +1,216 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// ParseJSONL reads tandas from JSONL, failing on the first invalid line
+func ParseJSONL(r io.Reader) ([]*db.Tanda, error) {
+	lines := newLineReader(r, DefaultMaxLineBytes)
+	var tandas []*db.Tanda
+	for {
+		l, err := lines.next(nil)
+		if err == io.EOF {
+			return tandas, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading JSONL: %w", err)
+		}
+		if l.oversized {
+			return nil, fmt.Errorf("line %d is over the %d byte limit", l.num, DefaultMaxLineBytes)
+		}
+		line := bytes.TrimSpace(l.data)
+		if len(line) == 0 {
+			continue
+		}
+		var t db.Tanda
+		if err := json.Unmarshal(line, &t); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d: %w", l.num, err)
+		}
+		tandas = append(tandas, &t)
+	}
+}
+
+// Merge combines two copies of the registry. Tandas present on one side
+// only are kept. For a tanda on both sides, a copy whose vector clock has
+// seen every edit of the other wins; concurrent edits are resolved field
+// by field, with the most recent write winning. Notes and run history
+// are grow-only and always the union of both. The result does not depend
+// on which side is local. Changed lists the IDs whose merged value
+// differs from local.
+func Merge(local, remote []*db.Tanda) (merged []*db.Tanda, changed []string) {
+	byID := make(map[string]*db.Tanda, len(local))
+	for _, t := range local {
+		byID[t.ID] = t
+	}
+
+	merged = append(merged, local...)
+	index := make(map[string]int, len(local))
+	for i, t := range local {
+		index[t.ID] = i
+	}
+
+	for _, r := range remote {
+		l, ok := byID[r.ID]
+		if !ok {
+			merged = append(merged, r)
+			changed = append(changed, r.ID)
+			continue
+		}
+		m := mergeTanda(l, r)
+		if !equal(l, m) {
+			merged[index[r.ID]] = m
+			changed = append(changed, r.ID)
+		}
+	}
+
+	sort.Strings(changed)
+	return merged, changed
+}
+
+// MergeInto merges tandas into the store and returns the IDs that changed
+func MergeInto(store *db.Store, remote []*db.Tanda) ([]string, error) {
+	local, err := store.GetAllTandas()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tandas: %w", err)
+	}
+
+	merged, changed := Merge(local, remote)
+	ids := make(map[string]bool, len(changed))
+	for _, id := range changed {
+		ids[id] = true
+	}
+	for _, t := range merged {
+		if !ids[t.ID] {
+			continue
+		}
+		if err := store.UpsertTanda(t); err != nil {
+			return nil, fmt.Errorf("failed to update tanda %s: %w", t.ID, err)
+		}
+	}
+	return changed, nil
+}
+
+func mergeTanda(local, remote *db.Tanda) *db.Tanda {
+	base := *local
+	switch compareClocks(local.Clock, remote.Clock) {
+	case clockAfter:
+	case clockBefore:
+		base = *remote
+	default:
+		// Concurrent, or neither side carries clocks: last writer wins
+		// per field
+		clock := cloneClock(nil)
+		for _, f := range fields {
+			ls, rs := stampOf(local, f.name), stampOf(remote, f.name)
+			winner, stamp := local, ls
+			if later(rs, ls) {
+				winner, stamp = remote, rs
+			}
+			f.set(&base, winner)
+			if stamp.Replica != "" {
+				clock.Fields[f.name] = stamp
+			}
+		}
+		base.Clock = clock
+	}
+
+	if local.Clock != nil || remote.Clock != nil {
+		clock := cloneClock(base.Clock)
+		for _, c := range []*db.Clock{local.Clock, remote.Clock} {
+			if c == nil {
+				continue
+			}
+			for k, n := range c.Vector {
+				if n > clock.Vector[k] {
+					clock.Vector[k] = n
+				}
+			}
+		}
+		base.Clock = clock
+	} else {
+		base.Clock = nil
+	}
+
+	if newer(remote.UpdatedAt, local.UpdatedAt) {
+		base.UpdatedAt = remote.UpdatedAt
+	} else {
+		base.UpdatedAt = local.UpdatedAt
+	}
+	if remote.CreatedAt != "" && (local.CreatedAt == "" || newer(local.CreatedAt, remote.CreatedAt)) {
+		base.CreatedAt = remote.CreatedAt
+	} else {
+		base.CreatedAt = local.CreatedAt
+	}
+	base.Notes = mergeNotes(local.Notes, remote.Notes)
+	base.RunHistory = mergeRuns(local.RunHistory, remote.RunHistory)
+	return &base
+}
+
+// newer compares registry timestamps, falling back to string order for
+// values that do not parse
+func newer(a, b string) bool {
+	ta, okA := db.ParseTimestamp(a)
+	tb, okB := db.ParseTimestamp(b)
+	if okA && okB {
+		return ta.After(tb)
+	}
+	return a > b
+}
+
+func mergeNotes(a, b []db.Note) []db.Note {
+	seen := make(map[string]bool)
+	out := []db.Note{}
+	for _, n := range append(append([]db.Note{}, a...), b...) {
+		if k := n.Key(); !seen[k] {
+			seen[k] = true
+			out = append(out, n)
+		}
+	}
+	if len(out) == 0 {
+		return a
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Timestamp != out[j].Timestamp {
+			return newer(out[j].Timestamp, out[i].Timestamp)
+		}
+		if out[i].Type+out[i].Text != out[j].Type+out[j].Text {
+			return out[i].Type+out[i].Text < out[j].Type+out[j].Text
+		}
+		return out[i].Key() < out[j].Key()
+	})
+	return out
+}
+
+func mergeRuns(a, b []db.RunResult) []db.RunResult {
+	seen := make(map[db.RunResult]bool)
+	out := []db.RunResult{}
+	for _, r := range append(append([]db.RunResult{}, a...), b...) {
+		if !seen[r] {
+			seen[r] = true
+			out = append(out, r)
+		}
+	}
+	if len(out) == 0 {
+		return a
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Timestamp != out[j].Timestamp {
+			return newer(out[j].Timestamp, out[i].Timestamp)
+		}
+		return fmt.Sprint(out[i]) < fmt.Sprint(out[j])
+	})
+	return out
+}
+
+func equal(a, b *db.Tanda) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
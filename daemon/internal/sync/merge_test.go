@@ -0,0 +1,125 @@
+package sync_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tandas/daemon/internal/db"
+	syncpkg "github.com/tandas/daemon/internal/sync"
+)
+
+func TestMerge(t *testing.T) {
+	local := []*db.Tanda{
+		{ID: "td-1", Title: "Login", Status: "active", UpdatedAt: "2025-06-02T10:00:00",
+			Notes: []db.Note{{Timestamp: "2025-06-01T09:00:00", Type: "note", Text: "local"}}},
+		{ID: "td-2", Title: "Search", UpdatedAt: "2025-06-01T10:00:00"},
+	}
+	remote := []*db.Tanda{
+		{ID: "td-1", Title: "Login (old)", Status: "flaky", UpdatedAt: "2025-06-01T10:00:00",
+			Notes: []db.Note{{Timestamp: "2025-06-01T08:00:00", Type: "note", Text: "remote"}}},
+		{ID: "td-2", Title: "Search", UpdatedAt: "2025-06-01T10:00:00"},
+		{ID: "td-3", Title: "Export", UpdatedAt: "2025-06-01T10:00:00"},
+	}
+
+	merged, changed := syncpkg.Merge(local, remote)
+	if len(merged) != 3 || len(changed) != 2 || changed[0] != "td-1" || changed[1] != "td-3" {
+		t.Fatalf("unexpected merge: %d tandas, changed %v", len(merged), changed)
+	}
+	login := merged[0]
+	if login.Title != "Login" || login.Status != "active" {
+		t.Fatalf("expected newer local fields to win, got %+v", login)
+	}
+	if len(login.Notes) != 2 || login.Notes[0].Text != "remote" {
+		t.Fatalf("expected notes from both sides in time order, got %+v", login.Notes)
+	}
+}
+
+func TestMergeConcurrentEdits(t *testing.T) {
+	base := &db.Tanda{ID: "td-1", Title: "Login", Status: "active", UpdatedAt: "2025-06-01T10:00:00"}
+	syncpkg.Touch(nil, base, "a", "2025-06-01T10:00:00Z")
+
+	// Replica a renames the tanda, replica b marks it flaky, both offline
+	onA := *base
+	onA.Title = "Login with SSO"
+	onA.UpdatedAt = "2025-06-02T10:00:00Z"
+	syncpkg.Touch(base, &onA, "a", "2025-06-02T10:00:00Z")
+	onA.Notes = []db.Note{{Timestamp: "2025-06-02T10:00:00Z", Type: "note", Text: "from a"}}
+
+	onB := *base
+	onB.Status = "flaky"
+	onB.UpdatedAt = "2025-06-02T09:00:00Z"
+	syncpkg.Touch(base, &onB, "b", "2025-06-02T09:00:00Z")
+	onB.RunHistory = []db.RunResult{{Timestamp: "2025-06-02T09:00:00Z", Result: "fail"}}
+
+	ab, _ := syncpkg.Merge([]*db.Tanda{&onA}, []*db.Tanda{&onB})
+	ba, _ := syncpkg.Merge([]*db.Tanda{&onB}, []*db.Tanda{&onA})
+	for _, m := range []*db.Tanda{ab[0], ba[0]} {
+		if m.Title != "Login with SSO" || m.Status != "flaky" {
+			t.Fatalf("expected both field edits to survive, got %+v", m)
+		}
+		if len(m.Notes) != 1 || len(m.RunHistory) != 1 {
+			t.Fatalf("expected notes and runs from both sides, got %+v", m)
+		}
+		if m.Clock.Vector["a"] != 2 || m.Clock.Vector["b"] != 1 {
+			t.Fatalf("expected merged vector clock, got %+v", m.Clock.Vector)
+		}
+	}
+
+	// b pulls the merge; a's old copy has been seen, so merging it again is a no-op
+	if _, changed := syncpkg.Merge(ab, []*db.Tanda{&onA}); len(changed) != 0 {
+		t.Fatalf("expected no change merging an older copy, got %v", changed)
+	}
+}
+
+func TestMergeNoteReplies(t *testing.T) {
+	root := db.Note{Timestamp: "2025-06-01T09:00:00Z", Type: "note", Author: "ana", Text: "fails on CI"}
+	root.ID = db.NoteID(root)
+	reply := func(author string) db.Note {
+		n := db.Note{Timestamp: "2025-06-02T09:00:00Z", Type: "note", Author: author, Parent: root.ID, Text: "+1"}
+		n.ID = db.NoteID(n)
+		return n
+	}
+	// Two people give the same reply at the same second on different replicas
+	onA := &db.Tanda{ID: "td-1", Title: "Login", UpdatedAt: "2025-06-02T09:00:00Z", Notes: []db.Note{root, reply("ana")}}
+	onB := &db.Tanda{ID: "td-1", Title: "Login", UpdatedAt: "2025-06-02T09:00:00Z", Notes: []db.Note{root, reply("ben")}}
+
+	ab, _ := syncpkg.Merge([]*db.Tanda{onA}, []*db.Tanda{onB})
+	ba, _ := syncpkg.Merge([]*db.Tanda{onB}, []*db.Tanda{onA})
+	if len(ab[0].Notes) != 3 || fmt.Sprint(ab[0].Notes) != fmt.Sprint(ba[0].Notes) {
+		t.Fatalf("expected both replies once, in the same order either way, got %+v and %+v", ab[0].Notes, ba[0].Notes)
+	}
+	if _, changed := syncpkg.Merge(ab, []*db.Tanda{onA}); len(changed) != 0 {
+		t.Fatalf("expected no change merging a copy already seen, got %v", changed)
+	}
+}
+
+func TestMergeDominatingClockWins(t *testing.T) {
+	old := &db.Tanda{ID: "td-1", Title: "Login", UpdatedAt: "2025-06-01T10:00:00Z"}
+	syncpkg.Touch(nil, old, "a", "2025-06-01T10:00:00Z")
+
+	// b edited after seeing a's copy, even though b's wall clock is behind
+	edited := *old
+	edited.Title = "Login v2"
+	syncpkg.Touch(old, &edited, "b", "2025-05-01T10:00:00Z")
+
+	merged, changed := syncpkg.Merge([]*db.Tanda{old}, []*db.Tanda{&edited})
+	if len(changed) != 1 || merged[0].Title != "Login v2" {
+		t.Fatalf("expected the descendant copy to win, got %+v", merged[0])
+	}
+}
+
+func TestTouch(t *testing.T) {
+	prev := &db.Tanda{ID: "td-1", Title: "Login", Covers: []string{}}
+	next := *prev
+	next.Covers = nil
+	if syncpkg.Touch(prev, &next, "a", "2025-06-01T10:00:00Z") {
+		t.Fatal("expected nil and empty covers to be treated as unchanged")
+	}
+	next.Status = "flaky"
+	if !syncpkg.Touch(prev, &next, "a", "2025-06-01T10:00:00Z") {
+		t.Fatal("expected the status edit to be stamped")
+	}
+	if _, ok := next.Clock.Fields["status"]; !ok || len(next.Clock.Fields) != 1 || next.Clock.Vector["a"] != 1 {
+		t.Fatalf("unexpected clock %+v", next.Clock)
+	}
+}
@@ -0,0 +1,155 @@
+package sync
+
+import (
+	"encoding/json"
+	"io"
+	"runtime"
+	gosync "sync"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// parseChunkLines is the number of lines handed to a parse worker at once
+const parseChunkLines = 256
+
+// parsedLine is one non-empty JSONL line and its decoded tanda. An
+// oversized line is not decoded; oversized holds its size.
+type parsedLine struct {
+	num       int
+	raw       []byte
+	tanda     *db.Tanda
+	err       error
+	oversized int64
+}
+
+// parsedChunk is a run of consecutive lines; seq orders chunks in the file
+// and bytes counts what they took up, blank lines included
+type parsedChunk struct {
+	seq   int
+	bytes int64
+	lines []parsedLine
+}
+
+// parseLines reads JSONL from r and unmarshals it on a pool of workers,
+// delivering chunks in file order so the single writer applies duplicate
+// IDs and reports errors exactly as a sequential read would. Lines over
+// max bytes are copied to spill instead. Closing done stops the pipeline
+// early. The returned func reports a read error once the channel is
+// closed.
+func parseLines(r io.Reader, max int, spill io.Writer, done <-chan struct{}) (<-chan *parsedChunk, func() error) {
+	workers := runtime.GOMAXPROCS(0)
+	jobs := make(chan *parsedChunk, workers)
+	parsed := make(chan *parsedChunk, workers)
+	out := make(chan *parsedChunk, workers)
+
+	var readErr error
+	go func() {
+		defer close(jobs)
+		lines := newLineReader(r, max)
+		chunk := &parsedChunk{}
+		for {
+			line, err := lines.next(spill)
+			if err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				break
+			}
+			chunk.bytes += line.size
+			switch {
+			case line.oversized:
+				chunk.lines = append(chunk.lines, parsedLine{num: line.num, oversized: line.size})
+			case len(line.data) == 0:
+				continue
+			default:
+				chunk.lines = append(chunk.lines, parsedLine{num: line.num, raw: line.data})
+			}
+			if len(chunk.lines) < parseChunkLines {
+				continue
+			}
+			select {
+			case jobs <- chunk:
+			case <-done:
+				return
+			}
+			chunk = &parsedChunk{seq: chunk.seq + 1}
+		}
+		// The last chunk goes out even when empty to account for its bytes
+		select {
+		case jobs <- chunk:
+		case <-done:
+		}
+	}()
+
+	var wg gosync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range jobs {
+				for i := range chunk.lines {
+					l := &chunk.lines[i]
+					if l.oversized > 0 {
+						continue
+					}
+					l.tanda, l.err = decodeTanda(l.raw)
+					l.raw = nil
+				}
+				select {
+				case parsed <- chunk:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(parsed)
+	}()
+
+	go func() {
+		defer close(out)
+		waiting := make(map[int]*parsedChunk)
+		next := 0
+		for chunk := range parsed {
+			waiting[chunk.seq] = chunk
+			for {
+				c, ok := waiting[next]
+				if !ok {
+					break
+				}
+				delete(waiting, next)
+				select {
+				case out <- c:
+				case <-done:
+					return
+				}
+				next++
+			}
+		}
+	}()
+
+	return out, func() error { return readErr }
+}
+
+// decodeTanda unmarshals one line, initializing empty slices
+func decodeTanda(line []byte) (*db.Tanda, error) {
+	var tanda db.Tanda
+	if err := json.Unmarshal(line, &tanda); err != nil {
+		return nil, err
+	}
+	if tanda.Covers == nil {
+		tanda.Covers = []string{}
+	}
+	if tanda.DependsOn == nil {
+		tanda.DependsOn = []string{}
+	}
+	if tanda.Notes == nil {
+		tanda.Notes = []db.Note{}
+	}
+	if tanda.RunHistory == nil {
+		tanda.RunHistory = []db.RunResult{}
+	}
+	return &tanda, nil
+}
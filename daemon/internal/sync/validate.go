@@ -0,0 +1,128 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+// ValidationError describes a problem on one JSONL line
+type ValidationError struct {
+	Line    int    `json:"line"`
+	ID      string `json:"id,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	if e.ID != "" {
+		return fmt.Sprintf("line %d (%s): %s", e.Line, e.ID, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// ValidateOptions carries the registry settings validation reports against
+type ValidateOptions struct {
+	// Duplicates is the import's policy for repeated IDs, named in reports
+	Duplicates DuplicatePolicy
+	// Statuses is the allowed status set; nil means the defaults
+	Statuses *workflow.Workflow
+	// MaxLineBytes is the import's line cap; zero means DefaultMaxLineBytes
+	MaxLineBytes int
+}
+
+// ValidateFile checks a JSONL registry file; a missing file is valid
+func ValidateFile(path string, opts ValidateOptions) ([]ValidationError, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open JSONL: %w", err)
+	}
+	defer file.Close()
+
+	return Validate(file, opts)
+}
+
+// Validate checks that every line is a tanda with an ID, a title and an
+// allowed status, that IDs are unique, and that depends_on only references
+// known tandas
+func Validate(r io.Reader, opts ValidateOptions) ([]ValidationError, error) {
+	if opts.Duplicates == "" {
+		opts.Duplicates = DuplicatesLast
+	}
+	if opts.Statuses == nil {
+		opts.Statuses = workflow.Default()
+	}
+
+	if opts.MaxLineBytes <= 0 {
+		opts.MaxLineBytes = DefaultMaxLineBytes
+	}
+	lines := newLineReader(r, opts.MaxLineBytes)
+
+	var problems []ValidationError
+	seen := make(map[string]int)
+	type dep struct {
+		line int
+		from string
+		to   string
+	}
+	var deps []dep
+
+	for {
+		l, err := lines.next(nil)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return problems, fmt.Errorf("error reading JSONL: %w", err)
+		}
+		lineNum, line := l.num, l.data
+		if l.oversized {
+			problems = append(problems, ValidationError{Line: lineNum,
+				Message: fmt.Sprintf("line is over the %d byte limit; import moves it to %s", opts.MaxLineBytes, OversizedFileName)})
+			continue
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		var t db.Tanda
+		if err := json.Unmarshal(line, &t); err != nil {
+			problems = append(problems, ValidationError{Line: lineNum, Message: fmt.Sprintf("invalid JSON: %v", err)})
+			continue
+		}
+
+		if t.ID == "" {
+			problems = append(problems, ValidationError{Line: lineNum, Message: "missing id"})
+			continue
+		}
+		if t.Title == "" {
+			problems = append(problems, ValidationError{Line: lineNum, ID: t.ID, Message: "missing title"})
+		}
+		if t.Status != "" {
+			if err := opts.Statuses.CheckStatus(t.Status); err != nil {
+				problems = append(problems, ValidationError{Line: lineNum, ID: t.ID, Message: err.Error()})
+			}
+		}
+		if first, ok := seen[t.ID]; ok {
+			problems = append(problems, ValidationError{Line: lineNum, ID: t.ID, Message: fmt.Sprintf("duplicate id (first on line %d); %s", first, opts.Duplicates.outcome())})
+		} else {
+			seen[t.ID] = lineNum
+		}
+		for _, d := range t.DependsOn {
+			deps = append(deps, dep{line: lineNum, from: t.ID, to: d})
+		}
+	}
+
+	for _, d := range deps {
+		if _, ok := seen[d.to]; !ok {
+			problems = append(problems, ValidationError{Line: d.line, ID: d.from, Message: fmt.Sprintf("depends on unknown tanda %s", d.to)})
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,42 @@
+package sync_test
+
+import (
+	"strings"
+	"testing"
+
+	syncpkg "github.com/tandas/daemon/internal/sync"
+)
+
+func TestValidate(t *testing.T) {
+	input := strings.Join([]string{
+		`{"id":"td-1","title":"Login","depends_on":["td-2"]}`,
+		`{"id":"td-1","title":"Login again"}`,
+		`{"title":"No id"}`,
+		`{"id":"td-3"}`,
+		`{"id":"td-4","title":"Done","status":"done"}`,
+		`not json`,
+		``,
+	}, "\n")
+
+	problems, err := syncpkg.Validate(strings.NewReader(input), syncpkg.ValidateOptions{Duplicates: syncpkg.DuplicatesMerge})
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	want := []string{
+		"line 2 (td-1): duplicate id (first on line 1); import merges the copies",
+		"line 3: missing id",
+		"line 4 (td-3): missing title",
+		"line 5 (td-4): unknown status \"done\"",
+		"line 6: invalid JSON",
+		"line 1 (td-1): depends on unknown tanda td-2",
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %v", len(want), problems)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(problems[i].Error(), w) {
+			t.Errorf("problem %d = %q, want prefix %q", i, problems[i].Error(), w)
+		}
+	}
+}
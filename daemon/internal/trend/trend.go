@@ -0,0 +1,130 @@
+package trend
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+)
+
+// DefaultWindows are reported when the caller does not choose any
+var DefaultWindows = []string{"7d", "30d"}
+
+// threshold is the score change below which a trend counts as stable
+const threshold = 0.05
+
+// Direction values
+const (
+	Improving = "improving"
+	Worsening = "worsening"
+	Stable    = "stable"
+	// Unknown means no snapshot predates the window
+	Unknown = "unknown"
+)
+
+// Window is a tanda's score change over one window
+type Window struct {
+	Window   string  `json:"window"`
+	Previous float64 `json:"previous"`
+	Delta    float64 `json:"delta"`
+	Trend    string  `json:"trend"`
+}
+
+// Trend is a tanda's current score and its change over each window
+type Trend struct {
+	TandaID string   `json:"tanda_id"`
+	Title   string   `json:"title"`
+	Current float64  `json:"current"`
+	Windows []Window `json:"windows"`
+}
+
+// ParseWindow parses a window such as "36h", "7d" or "2w"
+func ParseWindow(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil || v <= 0 {
+				return 0, fmt.Errorf("invalid window %q", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", s)
+	}
+	return d, nil
+}
+
+// Compute reports trends for the given tandas (all when tandaID is empty)
+// against the stored snapshots
+func Compute(store *db.Store, tandaID string, windows []string, now time.Time) ([]Trend, error) {
+	if len(windows) == 0 {
+		windows = DefaultWindows
+	}
+	spans := make([]time.Duration, len(windows))
+	for i, w := range windows {
+		d, err := ParseWindow(w)
+		if err != nil {
+			return nil, err
+		}
+		spans[i] = d
+	}
+
+	tandas, err := store.GetAllTandas()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tandas: %w", err)
+	}
+	snapshots, err := store.FlakinessSnapshots()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshots: %w", err)
+	}
+
+	out := []Trend{}
+	for _, t := range tandas {
+		if tandaID != "" && t.ID != tandaID {
+			continue
+		}
+
+		tr := Trend{TandaID: t.ID, Title: t.Title, Current: t.Flakiness()}
+		for i, span := range spans {
+			w := Window{Window: windows[i], Trend: Unknown}
+			if prev, ok := scoreAt(snapshots[t.ID], now.Add(-span)); ok {
+				w.Previous = prev
+				w.Delta = tr.Current - prev
+				w.Trend = direction(w.Delta)
+			}
+			tr.Windows = append(tr.Windows, w)
+		}
+		out = append(out, tr)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].TandaID < out[j].TandaID })
+	return out, nil
+}
+
+// scoreAt returns the latest snapshot at or before at
+func scoreAt(snaps []db.Snapshot, at time.Time) (float64, bool) {
+	score, ok := 0.0, false
+	for _, s := range snaps {
+		if s.Time.After(at) {
+			break
+		}
+		score, ok = s.Score, true
+	}
+	return score, ok
+}
+
+func direction(delta float64) string {
+	switch {
+	case delta <= -threshold:
+		return Improving
+	case delta >= threshold:
+		return Worsening
+	default:
+		return Stable
+	}
+}
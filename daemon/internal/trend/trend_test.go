@@ -0,0 +1,76 @@
+package trend_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/db"
+	"github.com/tandas/daemon/internal/trend"
+)
+
+func TestComputeTrend(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	tanda := &db.Tanda{ID: "td-1", Title: "Login", Status: "active",
+		RunHistory: []db.RunResult{{Result: "fail"}, {Result: "fail"}},
+		CreatedAt:  now.Format(time.RFC3339), UpdatedAt: now.Format(time.RFC3339)}
+	if err := store.UpsertTanda(tanda); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	// Flakiness was 100% ten days ago
+	if n, err := store.RecordFlakiness(now.Add(-10 * 24 * time.Hour)); err != nil || n != 1 {
+		t.Fatalf("record: %d, %v", n, err)
+	}
+	// Unchanged scores are not re-recorded
+	if n, err := store.RecordFlakiness(now.Add(-9 * 24 * time.Hour)); err != nil || n != 0 {
+		t.Fatalf("expected no snapshot for unchanged score, got %d, %v", n, err)
+	}
+
+	tanda.RunHistory = append(tanda.RunHistory, db.RunResult{Result: "pass"}, db.RunResult{Result: "pass"})
+	if err := store.UpsertTanda(tanda); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	trends, err := trend.Compute(store, "", []string{"7d", "30d"}, now)
+	if err != nil {
+		t.Fatalf("compute: %v", err)
+	}
+	if len(trends) != 1 {
+		t.Fatalf("expected one trend, got %+v", trends)
+	}
+	got := trends[0]
+	if got.Current != 0.5 {
+		t.Fatalf("expected current 0.5, got %v", got.Current)
+	}
+	if got.Windows[0].Trend != trend.Improving || got.Windows[0].Previous != 1 {
+		t.Fatalf("expected 7d window to be improving from 1.0, got %+v", got.Windows[0])
+	}
+	if got.Windows[1].Trend != trend.Unknown {
+		t.Fatalf("expected 30d window to predate history, got %+v", got.Windows[1])
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+	} {
+		got, err := trend.ParseWindow(in)
+		if err != nil || got != want {
+			t.Errorf("ParseWindow(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "0d", "-1d", "week"} {
+		if _, err := trend.ParseWindow(in); err == nil {
+			t.Errorf("expected error for %q", in)
+		}
+	}
+}
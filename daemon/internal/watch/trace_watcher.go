@@ -2,6 +2,7 @@ package watch
 
 import (
 	"fmt"
+	"log/slog"
 	"path/filepath"
 
 	"github.com/fsnotify/fsnotify"
@@ -48,7 +49,7 @@ func (t *TraceWatcher) Start() {
 			}
 		case err, ok := <-t.watcher.Errors:
 			if ok {
-				fmt.Printf("Trace watcher error (%s): %v\n", filepath.Base(t.dir), err)
+				slog.Error("Trace watcher error", "dir", filepath.Base(t.dir), "err", err)
 			}
 		case <-t.done:
 			return
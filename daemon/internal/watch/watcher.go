@@ -2,6 +2,7 @@ package watch
 
 import (
 	"fmt"
+	"log/slog"
 	"path/filepath"
 	"time"
 
@@ -74,7 +75,7 @@ func (w *Watcher) Start() {
 			if !ok {
 				return
 			}
-			fmt.Printf("Watcher error: %v\n", err)
+			slog.Error("Watcher error", "err", err)
 
 		case <-w.done:
 			if timer != nil {
@@ -0,0 +1,225 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/events"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the body, keyed by the
+	// webhook's secret, prefixed with "sha256="
+	SignatureHeader = "X-Tandas-Signature"
+	// EventHeader carries the event type
+	EventHeader = "X-Tandas-Event"
+	// DeliveryHeader carries a delivery ID that is stable across retries
+	DeliveryHeader = "X-Tandas-Delivery"
+
+	defaultMaxAttempts = 5
+	logCapacity        = 200
+)
+
+// Delivery records the outcome of sending one event to one webhook
+type Delivery struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Event      string    `json:"event"`
+	Status     string    `json:"status"` // pending, delivered or failed
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type hook struct {
+	url         string
+	secret      []byte
+	events      map[string]bool
+	owners      []string
+	maxAttempts int
+}
+
+// Dispatcher delivers events to registered webhooks with retry and backoff
+type Dispatcher struct {
+	hooks   []hook
+	client  *http.Client
+	backoff time.Duration
+	nextID  uint64
+	done    chan struct{}
+
+	mu  sync.Mutex
+	log []*Delivery
+}
+
+// NewDispatcher creates a dispatcher for the configured webhooks
+func NewDispatcher(cfgs []config.WebhookConfig) (*Dispatcher, error) {
+	d := &Dispatcher{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		backoff: time.Second,
+		done:    make(chan struct{}),
+	}
+
+	for i, c := range cfgs {
+		if c.URL == "" {
+			return nil, fmt.Errorf("webhook %d: url is required", i)
+		}
+		h := hook{url: c.URL, secret: []byte(c.Secret), owners: c.Owners, maxAttempts: c.MaxAttempts}
+		if h.maxAttempts <= 0 {
+			h.maxAttempts = defaultMaxAttempts
+		}
+		if len(c.Events) > 0 {
+			h.events = make(map[string]bool, len(c.Events))
+			for _, e := range c.Events {
+				h.events[e] = true
+			}
+		}
+		d.hooks = append(d.hooks, h)
+	}
+
+	return d, nil
+}
+
+// SetBackoff sets the delay before the first retry; it doubles per attempt
+func (d *Dispatcher) SetBackoff(b time.Duration) {
+	d.backoff = b
+}
+
+// Handle sends an event to every matching webhook in the background
+func (d *Dispatcher) Handle(e events.Event) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("Webhook marshal failed", "err", err)
+		return
+	}
+
+	for _, h := range d.hooks {
+		if h.events != nil && !h.events[e.Type] {
+			continue
+		}
+		if !e.MatchesOwners(h.owners) {
+			continue
+		}
+
+		delivery := &Delivery{
+			ID:        strconv.FormatUint(atomic.AddUint64(&d.nextID, 1), 10),
+			URL:       h.url,
+			Event:     e.Type,
+			Status:    "pending",
+			UpdatedAt: time.Now().UTC(),
+		}
+		d.record(delivery)
+		go d.deliver(h, delivery, payload)
+	}
+}
+
+// Stop abandons pending retries
+func (d *Dispatcher) Stop() {
+	close(d.done)
+}
+
+// Deliveries returns the most recent deliveries, newest first. A limit of
+// zero returns the whole log; status filters when non-empty.
+func (d *Dispatcher) Deliveries(limit int, status string) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := []Delivery{}
+	for i := len(d.log) - 1; i >= 0; i-- {
+		if status != "" && d.log[i].Status != status {
+			continue
+		}
+		out = append(out, *d.log[i])
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out
+}
+
+func (d *Dispatcher) deliver(h hook, delivery *Delivery, payload []byte) {
+	wait := d.backoff
+	for attempt := 1; attempt <= h.maxAttempts; attempt++ {
+		code, err := d.post(h, delivery, payload)
+
+		d.mu.Lock()
+		delivery.Attempts = attempt
+		delivery.StatusCode = code
+		delivery.UpdatedAt = time.Now().UTC()
+		if err == nil {
+			delivery.Status = "delivered"
+			delivery.LastError = ""
+			d.mu.Unlock()
+			return
+		}
+		delivery.LastError = err.Error()
+		if attempt == h.maxAttempts {
+			delivery.Status = "failed"
+		}
+		d.mu.Unlock()
+
+		if attempt == h.maxAttempts {
+			slog.Error("Webhook delivery failed", "delivery", delivery.ID, "url", h.url, "err", err)
+			return
+		}
+
+		select {
+		case <-time.After(wait):
+			wait *= 2
+		case <-d.done:
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) post(h hook, delivery *Delivery, payload []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	if len(h.secret) > 0 {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(h.secret, payload))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) record(delivery *Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.log = append(d.log, delivery)
+	if len(d.log) > logCapacity {
+		d.log = d.log[len(d.log)-logCapacity:]
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 of payload keyed by secret
+func Sign(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
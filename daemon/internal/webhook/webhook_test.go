@@ -0,0 +1,69 @@
+package webhook_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/events"
+	"github.com/tandas/daemon/internal/webhook"
+)
+
+func TestDispatcherSignsRetriesAndLogs(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get(webhook.SignatureHeader); got != "sha256="+webhook.Sign([]byte("s3cret"), body) {
+			t.Errorf("bad signature %q", got)
+		}
+		// Fail the first attempt to exercise the retry path
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	d, err := webhook.NewDispatcher([]config.WebhookConfig{{
+		URL:    server.URL,
+		Secret: "s3cret",
+		Events: []string{events.Quarantined},
+	}})
+	if err != nil {
+		t.Fatalf("new dispatcher: %v", err)
+	}
+	defer d.Stop()
+	d.SetBackoff(10 * time.Millisecond)
+
+	d.Handle(events.Event{Type: events.PassRateChanged})
+	d.Handle(events.Event{Type: events.Quarantined, TandaID: "td-1"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		log := d.Deliveries(0, "")
+		if len(log) != 1 {
+			t.Fatalf("expected only the matching event to be delivered, got %+v", log)
+		}
+		if log[0].Status == "delivered" {
+			if log[0].Attempts != 2 {
+				t.Fatalf("expected delivery on second attempt, got %+v", log[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery did not complete: %+v", log[0])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDispatcherRequiresURL(t *testing.T) {
+	if _, err := webhook.NewDispatcher([]config.WebhookConfig{{}}); err == nil {
+		t.Fatalf("expected error for webhook without url")
+	}
+}
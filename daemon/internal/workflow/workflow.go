@@ -0,0 +1,126 @@
+// Package workflow enforces the statuses a tanda may have and the moves
+// between them
+package workflow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tandas/daemon/internal/config"
+)
+
+// DefaultStatuses are always allowed. flaky and deprecated are set by the
+// CLI and by the daemon itself from run history.
+var DefaultStatuses = []string{"active", "flaky", "quarantined", "deprecated", "archived", "draft"}
+
+// DefaultRetired are the statuses that always retire a tanda
+var DefaultRetired = []string{"deprecated", "archived"}
+
+// Workflow is the allowed status set and, optionally, the transitions
+// allowed out of each status. A status without listed transitions may move
+// to any allowed status.
+type Workflow struct {
+	allowed     map[string]bool
+	transitions map[string]map[string]bool
+	retired     map[string]bool
+}
+
+// Default allows DefaultStatuses and every transition between them
+func Default() *Workflow {
+	w, _ := New(config.StatusConfig{})
+	return w
+}
+
+// New builds a workflow from config, which may add statuses and restrict
+// transitions
+func New(cfg config.StatusConfig) (*Workflow, error) {
+	w := &Workflow{
+		allowed:     make(map[string]bool),
+		transitions: make(map[string]map[string]bool),
+		retired:     make(map[string]bool),
+	}
+	for _, s := range append(append([]string{}, DefaultStatuses...), cfg.Extra...) {
+		if s == "" {
+			return nil, fmt.Errorf("statuses: empty status name")
+		}
+		w.allowed[s] = true
+	}
+	for from, tos := range cfg.Transitions {
+		if !w.allowed[from] {
+			return nil, fmt.Errorf("statuses: transitions from unknown status %q", from)
+		}
+		w.transitions[from] = make(map[string]bool)
+		for _, to := range tos {
+			if !w.allowed[to] {
+				return nil, fmt.Errorf("statuses: transition %s -> %s to unknown status", from, to)
+			}
+			w.transitions[from][to] = true
+		}
+	}
+	for _, s := range append(append([]string{}, DefaultRetired...), cfg.Retired...) {
+		if !w.allowed[s] {
+			return nil, fmt.Errorf("statuses: unknown retired status %q", s)
+		}
+		w.retired[s] = true
+	}
+	return w, nil
+}
+
+// IsRetired reports whether a status takes a tanda out of the suite for
+// good, so reports leave it out. A nil workflow knows DefaultRetired only.
+func (w *Workflow) IsRetired(status string) bool {
+	if w == nil {
+		for _, s := range DefaultRetired {
+			if status == s {
+				return true
+			}
+		}
+		return false
+	}
+	return w.retired[status]
+}
+
+// Filter is the window of runs and the retired statuses a report over run
+// history leaves out. Reports embed it in their options.
+type Filter struct {
+	// Days counts only the runs of the last Days days; 0 counts every run
+	// kept in run history
+	Days int `json:"days,omitempty"`
+	// Statuses decides which tandas are retired and left out; nil uses
+	// the default statuses
+	Statuses *Workflow `json:"-"`
+}
+
+// Statuses returns the allowed statuses, sorted
+func (w *Workflow) Statuses() []string {
+	out := make([]string, 0, len(w.allowed))
+	for s := range w.allowed {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// CheckStatus rejects a status outside the allowed set
+func (w *Workflow) CheckStatus(status string) error {
+	if !w.allowed[status] {
+		return fmt.Errorf("unknown status %q (allowed: %s)", status, strings.Join(w.Statuses(), ", "))
+	}
+	return nil
+}
+
+// CheckTransition rejects a move the workflow does not allow. Staying in
+// the same status is always allowed.
+func (w *Workflow) CheckTransition(from, to string) error {
+	if err := w.CheckStatus(to); err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	if next, ok := w.transitions[from]; ok && !next[to] {
+		return fmt.Errorf("status cannot change from %s to %s", from, to)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package workflow_test
+
+import (
+	"testing"
+
+	"github.com/tandas/daemon/internal/config"
+	"github.com/tandas/daemon/internal/workflow"
+)
+
+func TestWorkflow(t *testing.T) {
+	w, err := workflow.New(config.StatusConfig{
+		Extra:       []string{"blocked"},
+		Transitions: map[string][]string{"draft": {"active", "archived"}},
+	})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	for _, s := range []string{"active", "flaky", "blocked"} {
+		if err := w.CheckStatus(s); err != nil {
+			t.Errorf("CheckStatus(%q): %v", s, err)
+		}
+	}
+	if err := w.CheckStatus("done"); err == nil {
+		t.Error("expected an unknown status to be rejected")
+	}
+
+	cases := []struct {
+		from, to string
+		ok       bool
+	}{
+		{"draft", "active", true},
+		{"draft", "draft", true},
+		{"draft", "flaky", false},
+		{"active", "blocked", true},
+		{"active", "done", false},
+		{"", "draft", true},
+	}
+	for _, c := range cases {
+		if err := w.CheckTransition(c.from, c.to); (err == nil) != c.ok {
+			t.Errorf("CheckTransition(%q, %q) = %v, want ok=%v", c.from, c.to, err, c.ok)
+		}
+	}
+
+	if _, err := workflow.New(config.StatusConfig{Transitions: map[string][]string{"draft": {"done"}}}); err == nil {
+		t.Error("expected a transition to an unknown status to be rejected")
+	}
+}
+
+func TestIsRetired(t *testing.T) {
+	w, err := workflow.New(config.StatusConfig{Extra: []string{"obsolete"}, Retired: []string{"obsolete"}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	var defaults *workflow.Workflow
+	for _, c := range []struct {
+		status          string
+		configured, def bool
+	}{
+		{"deprecated", true, true},
+		{"archived", true, true},
+		{"obsolete", true, false},
+		{"flaky", false, false},
+	} {
+		if got := w.IsRetired(c.status); got != c.configured {
+			t.Errorf("IsRetired(%q) = %v, want %v", c.status, got, c.configured)
+		}
+		if got := defaults.IsRetired(c.status); got != c.def {
+			t.Errorf("nil IsRetired(%q) = %v, want %v", c.status, got, c.def)
+		}
+	}
+	if _, err := workflow.New(config.StatusConfig{Retired: []string{"obsolete"}}); err == nil {
+		t.Error("expected an unknown retired status to be rejected")
+	}
+}
@@ -11,17 +11,25 @@ Statuses: active | flaky | deprecated (never "closed")
 import argparse
 import hashlib
 import json
+import mimetypes
 import os
+import secrets
 import shutil
 import socket
 import sqlite3
 import subprocess
 import sys
 import time
-from datetime import datetime
+from datetime import datetime, timedelta, timezone
 from pathlib import Path
 from textwrap import dedent
 from typing import List, Optional
+from urllib.parse import urlparse
+
+try:
+    import yaml  # type: ignore
+except ImportError:  # pragma: no cover
+    yaml = None
 
 from lib.generator import (
     GenerationConfigError,
@@ -48,6 +56,20 @@ RESET = "\033[0m"
 
 DAEMON_SOCKET = TANDA_DIR / "td.sock"
 DAEMON_PID_FILE = TANDA_DIR / "daemon.pid"
+REPLICA_FILE = TANDA_DIR / "replica-id"
+# Last-writer-wins fields tracked in each tanda's clock (see daemon sync)
+CLOCK_FIELDS = ["title", "status", "file", "symbol", "line", "covers", "cover_lines", "depends_on", "external_refs", "refs", "owners",
+                "priority", "triage", "snoozed_until"]
+# Triage workflow states and priorities (p0 most urgent); see td triage
+TRIAGE_STATES = ["untriaged", "acknowledged", "fixing", "wontfix"]
+PRIORITIES = ["p0", "p1", "p2", "p3"]
+# Types of structured refs linking issues, pull requests and docs
+REF_TYPES = ["issue", "pr", "doc"]
+# Environment keys a run may carry (see td-daemon environments)
+RUN_ENV_KEYS = ["runner", "os", "browser", "shard"]
+# Note attachments are stored content-addressed here (see td-daemon note)
+BLOBS_DIR = TANDA_DIR / "blobs"
+MAX_ATTACHMENT_BYTES = 1 << 20
 DAEMON_BIN_ENV = "TD_DAEMON_BIN"
 DEFAULT_DAEMON_BIN = "td-daemon"
 
@@ -78,6 +100,9 @@ def init_db(conn: sqlite3.Connection):
             flakiness_score REAL DEFAULT 0.0,  -- Computed from run_history
             last_run_at TEXT,  -- Timestamp of last test run
             last_run_result TEXT,  -- pass/fail/skip
+            owners TEXT,  -- JSON array of users or teams
+            priority TEXT,  -- p0..p3
+            triage TEXT,  -- untriaged/acknowledged/fixing/wontfix
             created_at TEXT,
             updated_at TEXT
         );
@@ -86,6 +111,11 @@ def init_db(conn: sqlite3.Connection):
         CREATE INDEX IF NOT EXISTS idx_flakiness ON tandas(flakiness_score);
         CREATE INDEX IF NOT EXISTS idx_last_run ON tandas(last_run_at);
     """)
+    # Caches created before these columns existed
+    columns = {row[1] for row in conn.execute("PRAGMA table_info(tandas)")}
+    for column in ("owners", "priority", "triage"):
+        if column not in columns:
+            conn.execute(f"ALTER TABLE tandas ADD COLUMN {column} TEXT")
     conn.commit()
 
 
@@ -117,14 +147,65 @@ def load_all_from_jsonl() -> dict:
     return tandas
 
 
+def replica_id() -> str:
+    """Return this checkout's replica ID, creating it on first use."""
+    if REPLICA_FILE.exists():
+        rid = REPLICA_FILE.read_text().strip()
+        if rid:
+            return rid
+    rid = secrets.token_hex(8)
+    REPLICA_FILE.write_text(rid + "\n")
+    gitignore = TANDA_DIR / ".gitignore"
+    existing = gitignore.read_text().splitlines() if gitignore.exists() else []
+    if REPLICA_FILE.name not in existing:
+        with gitignore.open("a") as fh:
+            fh.write(REPLICA_FILE.name + "\n")
+    return rid
+
+
+def _clock_value(tanda: dict, field: str):
+    value = tanda.get(field)
+    return value if value not in (None, "", []) else None
+
+
+def stamp_clock(prev: Optional[dict], tanda: dict):
+    """Record locally edited fields in the tanda's clock for merging."""
+    if prev is None:
+        # New tandas only enter the vector clock; fields date from updated_at
+        if not tanda.get("clock"):
+            tanda["clock"] = {"vector": {replica_id(): 1}}
+        return
+    clock = tanda.get("clock") or {}
+    prev_fields = (prev.get("clock") or {}).get("fields", {})
+    fields = dict(clock.get("fields", {}))
+    stamped = [
+        f for f in CLOCK_FIELDS
+        if _clock_value(prev, f) != _clock_value(tanda, f)
+        and prev_fields.get(f) == fields.get(f)
+    ]
+    if not stamped:
+        return
+    rid = replica_id()
+    stamp = {"ts": now_iso(), "replica": rid}
+    for f in stamped:
+        fields[f] = stamp
+    vector = dict(clock.get("vector", {}))
+    vector[rid] = vector.get(rid, 0) + 1
+    tanda["clock"] = {"vector": vector, "fields": fields}
+
+
 def append_to_jsonl(tanda: dict):
     """Append a tanda record to JSONL file."""
+    stamp_clock(None, tanda)
     with open(ISSUES_FILE, "a") as f:
         f.write(json.dumps(tanda) + "\n")
 
 
 def rewrite_jsonl(tandas: dict):
     """Rewrite entire JSONL file (for updates)."""
+    previous = load_all_from_jsonl()
+    for tanda_id, tanda in tandas.items():
+        stamp_clock(previous.get(tanda_id), tanda)
     with open(ISSUES_FILE, "w") as f:
         for tanda in tandas.values():
             f.write(json.dumps(tanda) + "\n")
@@ -152,8 +233,8 @@ def sync_to_sqlite(tandas: dict):
         conn.execute("""
             INSERT INTO tandas (id, title, status, file, covers, depends_on, notes,
                                run_history, flakiness_score, last_run_at, last_run_result,
-                               created_at, updated_at)
-            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+                               owners, priority, triage, created_at, updated_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
         """, (
             t["id"],
             t["title"],
@@ -166,6 +247,9 @@ def sync_to_sqlite(tandas: dict):
             flakiness,
             last_run.get("ts"),
             last_run.get("result"),
+            json.dumps(t.get("owners", [])),
+            t.get("priority"),
+            t.get("triage"),
             t.get("created_at"),
             t.get("updated_at"),
         ))
@@ -404,6 +488,9 @@ def cmd_create(args):
     covers = []
     if args.covers:
         covers = [c.strip() for c in args.covers.split(",")]
+    owners = []
+    if args.owner:
+        owners = [o.strip() for o in args.owner.split(",") if o.strip()]
 
     tanda = {
         "id": tanda_id,
@@ -417,6 +504,17 @@ def cmd_create(args):
         "created_at": now,
         "updated_at": now,
     }
+    if owners:
+        tanda["owners"] = owners
+    if args.priority:
+        tanda["priority"] = args.priority
+    if args.symbol:
+        tanda["symbol"] = args.symbol
+    if args.line is not None:
+        if args.line < 1:
+            print(f"{RED}--line must be 1 or more{RESET}")
+            sys.exit(1)
+        tanda["line"] = args.line
 
     append_to_jsonl(tanda)
 
@@ -431,6 +529,10 @@ def cmd_create(args):
         print(f"  File:   {tanda['file']}")
     if covers:
         print(f"  Covers: {', '.join(covers)}")
+    if owners:
+        print(f"  Owners: {', '.join(owners)}")
+    if args.priority:
+        print(f"  Priority: {args.priority}")
 
 
 def cmd_list(args):
@@ -457,6 +559,18 @@ def cmd_list(args):
         query += " AND covers LIKE ?"
         params.append(f'%"{args.covers}"%')
 
+    if args.owner:
+        query += " AND owners LIKE ?"
+        params.append(f'%"{args.owner}"%')
+
+    if args.priority:
+        query += " AND priority = ?"
+        params.append(args.priority)
+
+    if args.triage:
+        query += " AND triage = ?"
+        params.append(args.triage)
+
     query += " ORDER BY updated_at DESC"
 
     rows = conn.execute(query, params).fetchall()
@@ -501,8 +615,21 @@ def cmd_show(args):
     print(f"  Title:      {tanda['title']}")
     print(f"  Status:     {status_color(tanda['status'])}")
     print(f"  File:       {tanda.get('file') or '(none)'}")
+    if tanda.get("line"):
+        symbol = tanda.get("symbol") or "(unnamed)"
+        print(f"  Symbol:     {symbol} at line {tanda['line']}")
     print(f"  Covers:     {', '.join(tanda.get('covers', [])) or '(none)'}")
     print(f"  Depends on: {', '.join(tanda.get('depends_on', [])) or '(none)'}")
+    print(f"  Owners:     {', '.join(tanda.get('owners', [])) or '(none)'}")
+    if tanda.get("priority") or tanda.get("triage"):
+        print(f"  Priority:   {tanda.get('priority') or '(none)'}")
+        print(f"  Triage:     {tanda.get('triage') or '(none)'}")
+    if tanda.get("snoozed_until"):
+        print(f"  Snoozed:    until {tanda['snoozed_until']}")
+    if tanda.get("external_refs"):
+        print(f"  Refs:       {', '.join(tanda['external_refs'])}")
+    for i, ref in enumerate(tanda.get("refs") or []):
+        print(f"  {'Links:' if i == 0 else '':<11} {format_ref(ref)}")
     print(f"  Created:    {tanda.get('created_at', 'unknown')}")
     print(f"  Updated:    {tanda.get('updated_at', 'unknown')}")
 
@@ -521,6 +648,8 @@ def cmd_show(args):
             print(f"  Flakiness:   {YELLOW}{flakiness * 100:.0f}%{RESET}")
         if last_run.get("trace"):
             print(f"  Trace:       {last_run['trace']}")
+        if last_run.get("error"):
+            print(f"  Error:       {last_run['error']}")
 
     # Display notes
     notes = tanda.get("notes", [])
@@ -530,10 +659,201 @@ def cmd_show(args):
         if isinstance(notes, str):
             print(f"  {notes.replace(chr(10), chr(10) + '  ')}")
         else:
-            for note in notes[-5:]:  # Show last 5 notes
+            for depth, note in thread_notes(notes)[-5:]:  # Show last 5 notes
+                indent = "    " * depth
                 ts = note.get("ts", "")[:10]  # Date only
                 text = note.get("text", str(note))
-                print(f"  [{ts}] {text}")
+                if note.get("author"):
+                    text = f"{note['author']}: {text}"
+                print(f"  {indent}[{ts}] {note_key(note)} {text}")
+                for a in note.get("attachments") or []:
+                    print(f"  {indent}    attached {a.get('name')} ({a.get('size')} bytes) {a.get('hash')}")
+
+
+def stamp_run_env(run: dict, specs: list) -> None:
+    """Set a run's environment from KEY=VALUE specs, then as td-daemon does.
+
+    Unset keys come from TD_RUNNER, TD_OS, TD_BROWSER and TD_SHARD, then from
+    GitLab CI and GitHub Actions variables; the OS falls back to this machine's.
+    The batch comes from TD_BATCH or the CI pipeline or workflow run ID, and
+    the commit from TD_COMMIT or the SHA CI is building.
+    """
+    for spec in specs:
+        key, sep, value = spec.partition("=")
+        if not sep or key not in RUN_ENV_KEYS or not value:
+            raise ValueError(f"invalid run environment '{spec}'. Use KEY=VALUE with KEY one of: {', '.join(RUN_ENV_KEYS)}")
+        run[key] = value
+    env = os.environ.get
+    runner = env("TD_RUNNER") or env("CI_RUNNER_DESCRIPTION") or env("RUNNER_NAME")
+    os_name = env("TD_OS") or env("RUNNER_OS") or {"win32": "windows"}.get(sys.platform, sys.platform)
+    shard = env("TD_SHARD")
+    if not shard and env("CI_NODE_INDEX") and env("CI_NODE_TOTAL"):
+        shard = f"{env('CI_NODE_INDEX')}/{env('CI_NODE_TOTAL')}"
+    for key, value in (("runner", runner), ("os", os_name), ("browser", env("TD_BROWSER")), ("shard", shard)):
+        if value and not run.get(key):
+            run[key] = value
+    batch = env("TD_BATCH") or env("CI_PIPELINE_ID") or env("GITHUB_RUN_ID")
+    if batch and not run.get("batch"):
+        run["batch"] = batch
+    commit = env("TD_COMMIT") or env("CI_COMMIT_SHA") or env("GITHUB_SHA")
+    if commit and not run.get("commit"):
+        run["commit"] = commit
+
+
+def note_id(note: dict) -> str:
+    """Derive a note's ID from its content, as the daemon's db.NoteID does."""
+    parts = [note.get(k) or "" for k in ("ts", "type", "author", "parent", "text")]
+    return "n-" + hashlib.sha256("\x00".join(parts).encode()).hexdigest()[:8]
+
+
+def note_key(note: dict) -> str:
+    """Return the note's ID, derived for notes written before notes had IDs."""
+    return note.get("id") or note_id(note)
+
+
+def note_author() -> str:
+    """Who notes are signed by: author in .tandas/config.yaml, else git config user.name."""
+    config_path = TANDA_DIR / "config.yaml"
+    if yaml is not None and config_path.exists():
+        try:
+            data = yaml.safe_load(config_path.read_text()) or {}
+        except yaml.YAMLError:
+            data = {}
+        if isinstance(data, dict) and data.get("author"):
+            return str(data["author"])
+    result = subprocess.run(["git", "config", "user.name"], capture_output=True, text=True)
+    return result.stdout.strip() if result.returncode == 0 else ""
+
+
+def thread_notes(notes: list) -> list:
+    """Order notes into threads as (depth, note), each note followed by its replies.
+
+    A note whose parent is gone starts a thread of its own.
+    """
+    keys = {note_key(n): i for i, n in enumerate(notes)}
+    replies, roots = {}, []
+    for i, n in enumerate(notes):
+        parent = keys.get(n.get("parent") or "")
+        if parent is not None and parent != i:
+            replies.setdefault(parent, []).append(i)
+        else:
+            roots.append(i)
+    out, placed = [], set()
+
+    def walk(i, depth):
+        if i in placed:
+            return
+        placed.add(i)
+        out.append((depth, notes[i]))
+        for r in replies.get(i, []):
+            walk(r, depth + 1)
+
+    for i in roots + list(range(len(notes))):
+        walk(i, 0)
+    return out
+
+
+def store_attachment(path: str) -> dict:
+    """Store a file under .tandas/blobs by its SHA-256 and return the note's reference to it."""
+    data = Path(path).read_bytes()
+    if len(data) > MAX_ATTACHMENT_BYTES:
+        raise ValueError(f"{path} is {len(data)} bytes, over the {MAX_ATTACHMENT_BYTES} byte limit")
+    digest = hashlib.sha256(data).hexdigest()
+    blob = BLOBS_DIR / digest[:2] / digest[2:]
+    if not blob.exists():
+        blob.parent.mkdir(parents=True, exist_ok=True)
+        tmp = blob.parent / f".blob-{os.getpid()}.tmp"
+        tmp.write_bytes(data)
+        tmp.replace(blob)
+    attachment = {"name": Path(path).name, "hash": f"sha256:{digest}", "size": len(data)}
+    media_type = mimetypes.guess_type(path)[0]
+    if media_type:
+        attachment["type"] = media_type
+    return attachment
+
+
+def parse_ref(spec: str) -> dict:
+    """Parse TYPE=URL or TYPE=ID (e.g. pr=https://..., issue=JIRA-123) into a ref."""
+    ref_type, sep, value = spec.partition("=")
+    ref_type, value = ref_type.strip(), value.strip()
+    if not sep or not value:
+        raise ValueError(f"expected TYPE=URL or TYPE=ID, got '{spec}'")
+    if ref_type not in REF_TYPES:
+        raise ValueError(f"invalid ref type '{ref_type}'. Use: {', '.join(REF_TYPES)}")
+    if "://" not in value:
+        return {"type": ref_type, "id": value}
+    url = urlparse(value)
+    if url.scheme not in ("http", "https") or not url.netloc:
+        raise ValueError(f"ref url '{value}' is not an http or https URL")
+    return {"type": ref_type, "url": value}
+
+
+def format_ref(ref: dict) -> str:
+    """Render a ref as 'pr #42 https://...', leaving out empty parts."""
+    return " ".join(p for p in (ref.get("type"), ref.get("id"), ref.get("url")) if p)
+
+
+def set_snooze(tanda: dict, days: str, timestamp: str) -> bool:
+    """Keep the tanda off the daemon's flaky leaderboard for a number of
+    days, or wake it with "none", noting the change like set_triage_field."""
+    until = None
+    if days != "none":
+        try:
+            count = int(days)
+        except ValueError:
+            count = 0
+        if count <= 0:
+            raise ValueError(f"invalid snooze {days!r}: use a number of days or none")
+        until = (datetime.now(timezone.utc) + timedelta(days=count)).strftime("%Y-%m-%dT%H:%M:%SZ")
+    if (tanda.get("snoozed_until") or None) == until:
+        return False
+    notes = tanda.get("notes", [])
+    if isinstance(notes, str):
+        notes = [{"ts": timestamp, "type": "note", "text": notes}] if notes else []
+    notes.append({"ts": timestamp, "type": "triage", "text": f"snoozed until {until}" if until else "snooze cleared"})
+    tanda["notes"] = notes
+    if until:
+        tanda["snoozed_until"] = until
+    else:
+        tanda.pop("snoozed_until", None)
+    return True
+
+
+def track_quarantine(tanda: dict, timestamp: str) -> bool:
+    """Open a quarantine span when the tanda became flaky or quarantined,
+    and close it when it recovered, like the daemon does on every write."""
+    spans = tanda.get("quarantines") or []
+    is_open = bool(spans) and not spans[-1].get("left")
+    quarantined = tanda.get("status") in ("flaky", "quarantined")
+    if quarantined and not is_open:
+        spans.append({"entered": timestamp})
+    elif not quarantined and is_open:
+        spans[-1]["left"] = timestamp
+    else:
+        return False
+    tanda["quarantines"] = spans
+    return True
+
+
+def set_triage_field(tanda: dict, field: str, value, timestamp: str) -> bool:
+    """Set priority or triage, keeping the transition as a triage note.
+
+    An empty value clears the field. Returns whether it changed.
+    """
+    old = tanda.get(field) or None
+    value = value or None
+    if old == value:
+        return False
+    notes = tanda.get("notes", [])
+    if isinstance(notes, str):
+        notes = [{"ts": timestamp, "type": "note", "text": notes}] if notes else []
+    notes.append({"ts": timestamp, "type": "triage", "text": f"{field}: {old or 'none'} -> {value or 'none'}"})
+    tanda["notes"] = notes
+    if value:
+        tanda[field] = value
+    else:
+        tanda.pop(field, None)
+    return True
 
 
 def cmd_update(args):
@@ -563,13 +883,30 @@ def cmd_update(args):
         tanda["status"] = args.status
         updated = True
 
-    if args.note:
+    if args.note or args.attach:
         timestamp = now_iso()
         notes = tanda.get("notes", [])
         # Migrate string notes to array format
         if isinstance(notes, str):
             notes = [{"ts": timestamp, "type": "note", "text": notes}] if notes else []
-        notes.append({"ts": timestamp, "type": "note", "text": args.note})
+        note = {"ts": timestamp, "type": "note"}
+        author = args.author or note_author()
+        if author:
+            note["author"] = author
+        if args.reply:
+            if not any(note_key(n) == args.reply for n in notes):
+                print(f"{RED}Tandas '{tanda_id}' has no note '{args.reply}'.{RESET}")
+                sys.exit(1)
+            note["parent"] = args.reply
+        note["text"] = args.note or ""
+        note = {"id": note_id(note), **note}
+        if args.attach:
+            try:
+                note["attachments"] = [store_attachment(p) for p in args.attach]
+            except (OSError, ValueError) as e:
+                print(f"{RED}{e}{RESET}")
+                sys.exit(1)
+        notes.append(note)
         tanda["notes"] = notes
         updated = True
 
@@ -584,6 +921,15 @@ def cmd_update(args):
             run_entry["duration"] = args.run_duration
         if args.run_trace:
             run_entry["trace"] = args.run_trace
+        if args.run_commit:
+            run_entry["commit"] = args.run_commit
+        if args.run_error:
+            run_entry["error"] = args.run_error
+        try:
+            stamp_run_env(run_entry, args.run_env or [])
+        except ValueError as e:
+            print(f"{RED}{e}{RESET}")
+            sys.exit(1)
         run_history.append(run_entry)
         tanda["run_history"] = run_history
 
@@ -592,19 +938,62 @@ def cmd_update(args):
         if flakiness >= 0.2 and tanda.get("status") == "active":
             tanda["status"] = "flaky"
             print(f"{YELLOW}Auto-marked as flaky (score: {flakiness}){RESET}")
+            if not tanda.get("triage"):
+                set_triage_field(tanda, "triage", "untriaged", timestamp)
         elif flakiness == 0.0 and tanda.get("status") == "flaky" and len(run_history) >= 3:
             tanda["status"] = "active"
             print(f"{GREEN}Auto-marked as active (3+ consecutive passes){RESET}")
 
         updated = True
 
+    if args.priority:
+        value = "" if args.priority == "none" else args.priority
+        if set_triage_field(tanda, "priority", value, now_iso()):
+            updated = True
+
+    if args.triage:
+        value = "" if args.triage == "none" else args.triage
+        if set_triage_field(tanda, "triage", value, now_iso()):
+            updated = True
+
+    if args.snooze:
+        try:
+            if set_snooze(tanda, args.snooze, now_iso()):
+                updated = True
+        except ValueError as e:
+            print(f"{RED}{e}{RESET}")
+            sys.exit(1)
+
     if args.file:
         tanda["file"] = args.file
         updated = True
 
+    if args.symbol is not None:
+        if args.symbol:
+            tanda["symbol"] = args.symbol
+        else:
+            tanda.pop("symbol", None)
+        updated = True
+
+    if args.line is not None:
+        if args.line < 0:
+            print(f"{RED}--line must be 0 or more{RESET}")
+            sys.exit(1)
+        if args.line:
+            tanda["line"] = args.line
+        else:
+            tanda.pop("line", None)
+        updated = True
+
     if args.covers:
         covers = [c.strip() for c in args.covers.split(",")]
         tanda["covers"] = covers
+        # Line data only describes files still covered
+        lines = {p: r for p, r in (tanda.get("cover_lines") or {}).items() if p in covers}
+        if lines:
+            tanda["cover_lines"] = lines
+        else:
+            tanda.pop("cover_lines", None)
         updated = True
 
     if args.add_dep:
@@ -621,15 +1010,66 @@ def cmd_update(args):
             tanda["depends_on"] = deps
             updated = True
 
+    if args.add_ref:
+        refs = tanda.get("external_refs", [])
+        if args.add_ref not in refs:
+            refs.append(args.add_ref)
+            tanda["external_refs"] = refs
+            updated = True
+
+    if args.remove_ref:
+        refs = tanda.get("external_refs", [])
+        if args.remove_ref in refs:
+            refs.remove(args.remove_ref)
+            tanda["external_refs"] = refs
+            updated = True
+
+    if args.link:
+        try:
+            ref = parse_ref(args.link)
+        except ValueError as e:
+            print(f"{RED}{e}{RESET}")
+            sys.exit(1)
+        refs = tanda.get("refs") or []
+        if ref not in refs:
+            refs.append(ref)
+            tanda["refs"] = refs
+            updated = True
+
+    if args.unlink:
+        refs = tanda.get("refs") or []
+        kept = [r for r in refs if args.unlink not in (r.get("url"), r.get("id"))]
+        if len(kept) != len(refs):
+            if kept:
+                tanda["refs"] = kept
+            else:
+                tanda.pop("refs", None)
+            updated = True
+
+    if args.add_owner:
+        owners = tanda.get("owners", [])
+        if args.add_owner not in owners:
+            owners.append(args.add_owner)
+            tanda["owners"] = owners
+            updated = True
+
+    if args.remove_owner:
+        owners = tanda.get("owners", [])
+        if args.remove_owner in owners:
+            owners.remove(args.remove_owner)
+            tanda["owners"] = owners
+            updated = True
+
     if updated:
         tanda["updated_at"] = now_iso()
+        track_quarantine(tanda, tanda["updated_at"])
         tandas[tanda_id] = tanda
         rewrite_jsonl(tandas)
         sync_cache_from_json(tandas)
         print(f"{GREEN}Updated {tanda_id}{RESET}")
         cmd_show(argparse.Namespace(id=tanda_id))
     else:
-        print("No updates specified. Use --status, --note, --file, --covers, --add-dep, or --remove-dep")
+        print("No updates specified. Use --status, --note, --attach, --file, --symbol, --line, --covers, --add-dep, --remove-dep, --add-ref, --remove-ref, --link, --unlink, --add-owner, --remove-owner, --priority, --triage, or --snooze")
 
 
 def find_tanda(tandas: dict, id_or_partial: str) -> tuple:
@@ -1277,10 +1717,14 @@ Examples:
     create_p = subparsers.add_parser("create", help="Create a new tanda")
     create_p.add_argument("title", help="Test title/name")
     create_p.add_argument("--file", "-f", help="Path to test file")
+    create_p.add_argument("--symbol", help="Test function in the file, e.g. TestLogin")
+    create_p.add_argument("--line", type=int, help="Line of the file where the test function is defined")
     create_p.add_argument("--status", "-s", default="active",
                           choices=["active", "flaky", "deprecated"],
                           help="Initial status (default: active)")
     create_p.add_argument("--covers", "-c", help="Comma-separated coverage tags")
+    create_p.add_argument("--owner", "-o", help="Comma-separated owners (users or teams, e.g. @org/checkout)")
+    create_p.add_argument("--priority", "-p", choices=PRIORITIES, help="Priority, p0 most urgent")
     create_p.set_defaults(func=cmd_create)
 
     # list
@@ -1290,6 +1734,9 @@ Examples:
     list_p.add_argument("--deprecated", "-d", action="store_true", help="Show only deprecated")
     list_p.add_argument("--status", "-s", help="Filter by status")
     list_p.add_argument("--covers", "-c", help="Filter by coverage tag")
+    list_p.add_argument("--owner", "-o", help="Filter by owner")
+    list_p.add_argument("--priority", "-p", choices=PRIORITIES, help="Filter by priority")
+    list_p.add_argument("--triage", "-t", choices=TRIAGE_STATES, help="Filter by triage state")
     list_p.set_defaults(func=cmd_list)
 
     # show
@@ -1302,14 +1749,37 @@ Examples:
     update_p.add_argument("id", help="Tandas ID (full or partial)")
     update_p.add_argument("--status", "-s", help="New status: active, flaky, deprecated")
     update_p.add_argument("--note", "-n", help="Add a timestamped note")
+    update_p.add_argument("--attach", action="append", metavar="FILE",
+                          help="Attach a file (screenshot, log excerpt) to the note; repeatable, 1 MiB max")
+    update_p.add_argument("--reply", metavar="NOTE_ID", help="Make the note a reply to this note (IDs in td show)")
+    update_p.add_argument("--author", help="Sign the note as this author (default: config author or git user.name)")
     update_p.add_argument("--file", "-f", help="Set file path")
+    update_p.add_argument("--symbol", help="Set the test function in the file (empty clears it)")
+    update_p.add_argument("--line", type=int, help="Set the line the test function is defined at (0 clears it)")
     update_p.add_argument("--covers", "-c", help="Set coverage tags (comma-separated)")
     update_p.add_argument("--add-dep", help="Add dependency on another tanda")
     update_p.add_argument("--remove-dep", help="Remove dependency")
+    update_p.add_argument("--add-ref", help="Link an external reference (e.g. JIRA-123)")
+    update_p.add_argument("--remove-ref", help="Unlink an external reference")
+    update_p.add_argument("--link", metavar="TYPE=URL|ID",
+                          help=f"Link an issue, PR or doc ({', '.join(REF_TYPES)}), e.g. pr=https://github.com/o/r/pull/42")
+    update_p.add_argument("--unlink", metavar="URL|ID", help="Remove the links with this URL or ID")
+    update_p.add_argument("--add-owner", help="Add an owner (user or team)")
+    update_p.add_argument("--remove-owner", help="Remove an owner")
+    update_p.add_argument("--priority", "-p", choices=PRIORITIES + ["none"],
+                          help="Set the priority (none clears it)")
+    update_p.add_argument("--triage", "-t", choices=TRIAGE_STATES + ["none"],
+                          help="Move through triage (none clears it); kept as a triage note")
+    update_p.add_argument("--snooze", metavar="DAYS",
+                          help="Keep off the daemon's flaky leaderboard for DAYS days (none wakes it)")
     update_p.add_argument("--run-result", "-r", choices=["pass", "fail", "skip"],
                           help="Record a test run result")
     update_p.add_argument("--run-duration", help="Duration of test run (e.g., '2.3s')")
     update_p.add_argument("--run-trace", help="Path to Playwright trace file")
+    update_p.add_argument("--run-error", help="Failure message of the test run")
+    update_p.add_argument("--run-commit", metavar="SHA", help="Git commit the run tested (default: TD_COMMIT or the CI's SHA)")
+    update_p.add_argument("--run-env", action="append", metavar="KEY=VALUE",
+                          help="Environment of the run: runner, os, browser or shard (repeatable)")
     update_p.set_defaults(func=cmd_update)
 
     # dep (dependency management)
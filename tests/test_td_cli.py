@@ -83,6 +83,159 @@ def test_create_and_list_tanda(tmp_path):
     assert "Login Flow" in result.stdout
 
 
+def test_owners_filter_list(tmp_path):
+    run_td(tmp_path, "init")
+    run_td(tmp_path, "create", "Cart Flow", "--owner", "@org/checkout")
+    run_td(tmp_path, "create", "Login Flow")
+
+    tandas = {t["title"]: t for t in load_tandas(tmp_path)}
+    assert tandas["Cart Flow"]["owners"] == ["@org/checkout"]
+
+    run_td(tmp_path, "update", tandas["Login Flow"]["id"], "--add-owner", "@org/auth")
+    result = run_td(tmp_path, "list", "--owner", "@org/auth")
+    assert "Login Flow" in result.stdout
+    assert "Cart Flow" not in result.stdout
+
+
+def test_runs_carry_their_environment(tmp_path):
+    run_td(tmp_path, "init")
+    run_td(tmp_path, "create", "Upload Flow")
+    tanda_id = load_tandas(tmp_path)[0]["id"]
+
+    run_td(tmp_path, "update", tanda_id, "-r", "fail", "--run-env", "browser=webkit",
+           extra_env={"TD_RUNNER": "ci-3", "CI_NODE_INDEX": "2", "CI_NODE_TOTAL": "4",
+                      "CI_PIPELINE_ID": "9120", "CI_COMMIT_SHA": "4f2c1e0"})
+
+    run = load_tandas(tmp_path)[0]["run_history"][-1]
+    assert run["browser"] == "webkit"
+    assert run["runner"] == "ci-3"
+    assert run["shard"] == "2/4"
+    assert run["os"]
+    assert run["batch"] == "9120" and run["commit"] == "4f2c1e0"
+    run_td(tmp_path, "update", tanda_id, "-r", "pass", "--run-commit", "a1b2c3d")
+    assert load_tandas(tmp_path)[0]["run_history"][-1]["commit"] == "a1b2c3d"
+    result = run_td(tmp_path, "update", tanda_id, "-r", "pass", "--run-env", "gpu=a100", check=False)
+    assert result.returncode != 0
+
+
+def test_triage_transitions_kept_as_notes(tmp_path):
+    run_td(tmp_path, "init")
+    run_td(tmp_path, "create", "Cart Flow", "--priority", "p2")
+    run_td(tmp_path, "create", "Login Flow")
+    tanda_id = {t["title"]: t["id"] for t in load_tandas(tmp_path)}["Cart Flow"]
+
+    # A tanda turning flaky enters triage
+    run_td(tmp_path, "update", tanda_id, "--run-result", "fail")
+    run_td(tmp_path, "update", tanda_id, "--triage", "fixing", "--priority", "p0")
+
+    tanda = {t["id"]: t for t in load_tandas(tmp_path)}[tanda_id]
+    assert tanda["triage"] == "fixing"
+    assert tanda["priority"] == "p0"
+    history = [n["text"] for n in tanda["notes"] if n["type"] == "triage"]
+    assert history == ["triage: none -> untriaged", "priority: p2 -> p0", "triage: untriaged -> fixing"]
+
+    result = run_td(tmp_path, "list", "--triage", "fixing")
+    assert "Cart Flow" in result.stdout
+    assert "Login Flow" not in result.stdout
+
+
+def test_snooze_is_kept_as_a_triage_note(tmp_path):
+    run_td(tmp_path, "init")
+    run_td(tmp_path, "create", "Cart Flow")
+    tanda_id = load_tandas(tmp_path)[0]["id"]
+
+    run_td(tmp_path, "update", tanda_id, "--snooze", "7")
+    tanda = load_tandas(tmp_path)[0]
+    assert tanda["snoozed_until"].endswith("Z")
+    assert "Snoozed:" in run_td(tmp_path, "show", tanda_id).stdout
+
+    run_td(tmp_path, "update", tanda_id, "--snooze", "none")
+    tanda = load_tandas(tmp_path)[0]
+    assert "snoozed_until" not in tanda
+    history = [n["text"] for n in tanda["notes"] if n["type"] == "triage"]
+    assert history[0].startswith("snoozed until ") and history[1] == "snooze cleared"
+
+    result = run_td(tmp_path, "update", tanda_id, "--snooze", "soon", check=False)
+    assert result.returncode != 0
+    assert "invalid snooze" in result.stdout
+
+
+def test_status_changes_open_and_close_quarantine_spans(tmp_path):
+    run_td(tmp_path, "init")
+    run_td(tmp_path, "create", "Cart Flow")
+    tanda_id = load_tandas(tmp_path)[0]["id"]
+
+    run_td(tmp_path, "update", tanda_id, "--status", "flaky")
+    spans = load_tandas(tmp_path)[0]["quarantines"]
+    assert len(spans) == 1 and "left" not in spans[0]
+
+    run_td(tmp_path, "update", tanda_id, "--note", "still flaky")
+    run_td(tmp_path, "update", tanda_id, "--status", "active")
+    spans = load_tandas(tmp_path)[0]["quarantines"]
+    assert len(spans) == 1 and spans[0]["left"] >= spans[0]["entered"]
+
+
+def test_links_are_structured_refs(tmp_path):
+    run_td(tmp_path, "init")
+    run_td(tmp_path, "create", "Cart Flow")
+    tanda_id = load_tandas(tmp_path)[0]["id"]
+
+    run_td(tmp_path, "update", tanda_id, "--link", "pr=https://github.com/o/r/pull/42")
+    run_td(tmp_path, "update", tanda_id, "--link", "issue=JIRA-123")
+    assert load_tandas(tmp_path)[0]["refs"] == [
+        {"type": "pr", "url": "https://github.com/o/r/pull/42"},
+        {"type": "issue", "id": "JIRA-123"},
+    ]
+    assert "issue JIRA-123" in run_td(tmp_path, "show", tanda_id).stdout
+
+    result = run_td(tmp_path, "update", tanda_id, "--link", "wiki=notes.md", check=False)
+    assert result.returncode != 0
+    assert "invalid ref type" in result.stdout
+
+    run_td(tmp_path, "update", tanda_id, "--unlink", "JIRA-123")
+    assert [r["type"] for r in load_tandas(tmp_path)[0]["refs"]] == ["pr"]
+
+
+def test_note_attachments_stored_by_hash(tmp_path):
+    run_td(tmp_path, "init")
+    run_td(tmp_path, "create", "Cart Flow")
+    tanda_id = load_tandas(tmp_path)[0]["id"]
+    log = Path(tmp_path) / "tail.log"
+    log.write_text("timeout waiting for #cart\n")
+
+    run_td(tmp_path, "update", tanda_id, "--note", "fails on CI", "--attach", str(log))
+
+    note = load_tandas(tmp_path)[0]["notes"][-1]
+    attachment = note["attachments"][0]
+    assert note["text"] == "fails on CI"
+    assert attachment["name"] == "tail.log"
+    assert attachment["size"] == len("timeout waiting for #cart\n")
+    digest = attachment["hash"].removeprefix("sha256:")
+    blob = Path(tmp_path) / ".tandas" / "blobs" / digest[:2] / digest[2:]
+    assert blob.read_text() == "timeout waiting for #cart\n"
+    assert "attached tail.log" in run_td(tmp_path, "show", tanda_id).stdout
+
+
+def test_notes_are_authored_and_threaded(tmp_path):
+    run_td(tmp_path, "init")
+    run_td(tmp_path, "create", "Cart Flow")
+    tanda_id = load_tandas(tmp_path)[0]["id"]
+
+    run_td(tmp_path, "update", tanda_id, "--note", "fails on CI", "--author", "ana")
+    root = load_tandas(tmp_path)[0]["notes"][-1]
+    run_td(tmp_path, "update", tanda_id, "--note", "token expiry?", "--author", "ben", "--reply", root["id"])
+
+    reply = load_tandas(tmp_path)[0]["notes"][-1]
+    assert root["author"] == "ana" and root["id"].startswith("n-")
+    assert reply["author"] == "ben" and reply["parent"] == root["id"]
+    output = run_td(tmp_path, "show", tanda_id).stdout
+    assert f"{reply['id']} ben: token expiry?" in output
+    assert output.index("ana: fails on CI") < output.index("      [")
+
+    result = run_td(tmp_path, "update", tanda_id, "--note", "x", "--reply", "n-00000000", check=False)
+    assert result.returncode != 0
+
+
 def test_dependency_management_affects_ready_order(tmp_path):
     run_td(tmp_path, "init")
 